@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	e "errors"
+	"log"
+	"os"
+
+	"github.com/wissance/Ferrum/api/admin/cli/operations"
+	"github.com/wissance/Ferrum/data"
+	"github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/globals"
+	"github.com/wissance/Ferrum/managers"
+)
+
+// adminPasswordEnv is an environment variable that is used as admin password if --admin_password is not provided
+const adminPasswordEnv = "FERRUM_ADMIN_PASSWORD"
+
+// checkAdminAccess authenticates administrator and checks that it has admin role required for operation, CLI exits if access is denied
+/* The only operation that doesn't require authentication is a creation of master realm if it doesn't exist yet (bootstrap), master
+ * realm administrators should be created with it. Changing of users who have admin roles additionally requires permission to change
+ * admin roles (see data.CanChangeAdminRoles).
+ * Parameters:
+ *     - ctx - context of CLI operation
+ *     - manager - data context
+ *     - adminRealm - name of a realm that administrator belongs to
+ *     - adminUsername - administrator username
+ *     - adminPassword - administrator password
+ *     - operation - CLI operation
+ *     - resource - CLI operation resource
+ *     - resourceId - resource identifier
+ *     - params - realm name for realm objects resources
+ *     - value - resource value
+ */
+func checkAdminAccess(ctx context.Context, manager managers.DataContext, adminRealm string, adminUsername string, adminPassword string,
+	operation operations.OperationType, resource operations.ResourceType, resourceId string, params string, value []byte,
+) {
+	var newRealm data.Realm
+	isRealmCreation := resource == operations.RealmResource &&
+		(operation == operations.CreateOperation || operation == operations.KeycloakImport)
+	if isRealmCreation {
+		if err := json.Unmarshal(value, &newRealm); err != nil {
+			log.Fatalf("json.Unmarshal failed: %s", err)
+		}
+		if newRealm.Name == globals.MasterRealm && !isRealmExists(ctx, manager, globals.MasterRealm) {
+			return
+		}
+	}
+
+	if adminUsername == "" {
+		log.Fatalf("Not specified Admin_user")
+	}
+	if adminPassword == "" {
+		adminPassword = os.Getenv(adminPasswordEnv)
+	}
+	realm, err := manager.GetRealm(ctx, adminRealm)
+	if err != nil {
+		log.Fatalf("GetRealm failed: %s", err)
+	}
+	admin, err := manager.GetUser(ctx, adminRealm, adminUsername)
+	if err != nil || realm.Encoder == nil || !realm.Encoder.IsPasswordsMatch(adminPassword, admin.GetPasswordHash()) {
+		log.Fatalf("Invalid administrator credentials")
+	}
+
+	targetRealm, roles := getRequiredAdminRoles(operation, resource, resourceId, params)
+	if !data.HasAdminRole(admin, adminRealm, targetRealm, roles...) {
+		log.Fatalf("Access denied: one of admin roles %v is required for realm \"%s\"", roles, targetRealm)
+	}
+
+	// administrators protection: user with admin roles could be created, changed or deleted only by who can change admin roles
+	changesAdmins := false
+	switch {
+	case isRealmCreation:
+		for _, u := range newRealm.Users {
+			changesAdmins = changesAdmins || len(data.CreateUser(u, nil).GetAdminRoles()) > 0
+		}
+	case isUserChangeOperation(operation, resource):
+		if operation == operations.CreateOperation || operation == operations.UpdateOperation {
+			var newUser any
+			if err := json.Unmarshal(value, &newUser); err != nil {
+				log.Fatalf("json.Unmarshal failed: %s", err)
+			}
+			changesAdmins = len(data.CreateUser(newUser, nil).GetAdminRoles()) > 0
+		}
+		if resourceId != "" {
+			if oldUser, err := manager.GetUser(ctx, params, resourceId); err == nil {
+				changesAdmins = changesAdmins || len(oldUser.GetAdminRoles()) > 0
+			}
+		}
+	}
+	if changesAdmins && !data.CanChangeAdminRoles(admin, adminRealm, targetRealm) {
+		log.Fatalf("Access denied: changing of administrators requires realm-admin role")
+	}
+}
+
+// getRequiredAdminRoles returns administered realm and admin roles (any of them) that are required to perform operation
+func getRequiredAdminRoles(operation operations.OperationType, resource operations.ResourceType, resourceId string,
+	params string,
+) (string, []data.AdminRole) {
+	switch operation {
+	case operations.ChangePassword, operations.ResetPassword, operations.RevokeOfflineSessions:
+		return params, []data.AdminRole{data.ManageUsers}
+	case operations.GetOfflineSessions:
+		return params, []data.AdminRole{data.ViewUsers}
+	case operations.GetSessions:
+		if resource == operations.RealmResource {
+			return resourceId, []data.AdminRole{data.ViewUsers}
+		}
+		return params, []data.AdminRole{data.ViewUsers}
+	case operations.Logout:
+		if resource == operations.RealmResource {
+			return resourceId, []data.AdminRole{data.ManageRealm}
+		}
+		return params, []data.AdminRole{data.ManageUsers}
+	case operations.SetNotBefore:
+		return resourceId, []data.AdminRole{data.ManageRealm}
+	case operations.KeycloakImport:
+		return data.AllRealms, []data.AdminRole{data.ManageRealm}
+	case operations.MigrateOperation, operations.CopyOperation:
+		// migration changes data of all realms, copy reads all data of copied realms (including users and clients secrets)
+		return data.AllRealms, []data.AdminRole{data.RealmAdmin}
+	case operations.KeycloakExport:
+		// export contains users, clients secrets and user federation bind credentials
+		return resourceId, []data.AdminRole{data.RealmAdmin}
+	case operations.HistoryOperation, operations.DiffOperation:
+		if resource == operations.RealmResource {
+			return resourceId, []data.AdminRole{data.ViewRealm}
+		}
+		// client revisions contain client secret
+		return params, []data.AdminRole{data.ManageClients}
+	}
+
+	isRead := operation == operations.GetOperation || operation == operations.ListOperation || operation == operations.SearchOperation
+	switch resource {
+	case operations.RealmResource:
+		if isRead {
+			return resourceId, []data.AdminRole{data.ViewRealm}
+		}
+		if operation == operations.CreateOperation {
+			return data.AllRealms, []data.AdminRole{data.ManageRealm}
+		}
+		return resourceId, []data.AdminRole{data.ManageRealm}
+	case operations.ClientResource:
+		if isRead {
+			return params, []data.AdminRole{data.ViewClients}
+		}
+		return params, []data.AdminRole{data.ManageClients}
+	case operations.UserFederationConfigResource:
+		if isRead {
+			return params, []data.AdminRole{data.ViewRealm, data.ManageFederation}
+		}
+		return params, []data.AdminRole{data.ManageFederation}
+	case operations.UserResource, operations.SessionResource:
+		if isRead {
+			return params, []data.AdminRole{data.ViewUsers}
+		}
+		return params, []data.AdminRole{data.ManageUsers}
+	}
+	// unknown operations are rejected before access check, but nobody has access to them anyway
+	return params, []data.AdminRole{}
+}
+
+// isUserChangeOperation checks whether operation changes (creates, updates, deletes or changes password of) user
+func isUserChangeOperation(operation operations.OperationType, resource operations.ResourceType) bool {
+	switch operation {
+	case operations.ChangePassword, operations.ResetPassword:
+		return true
+	case operations.CreateOperation, operations.UpdateOperation, operations.DeleteOperation:
+		return resource == operations.UserResource
+	}
+	return false
+}
+
+// isRealmExists checks whether realm exists, CLI exits if data store is not available
+func isRealmExists(ctx context.Context, manager managers.DataContext, realmName string) bool {
+	_, err := manager.GetRealm(ctx, realmName)
+	if err == nil {
+		return true
+	}
+	var notFoundErr errors.ObjectNotFoundError
+	if !e.As(err, &notFoundErr) {
+		log.Fatalf("GetRealm failed: %s", err)
+	}
+	return false
+}
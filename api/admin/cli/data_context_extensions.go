@@ -1,5 +1,7 @@
 package main
 
+import "context"
+
 type PasswordManager interface {
-	SetPassword(realmName string, userName string, password string) error
+	SetPassword(ctx context.Context, realmName string, userName string, password string) error
 }
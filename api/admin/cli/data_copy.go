@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/wissance/Ferrum/api/admin/cli/operations"
+	"github.com/wissance/Ferrum/config"
+	"github.com/wissance/Ferrum/data"
+	"github.com/wissance/Ferrum/logging"
+	"github.com/wissance/Ferrum/managers"
+	sf "github.com/wissance/stringFormatter"
+)
+
+// copyData copies realms with their clients, users and user federation configs between data stores and prints copy report as a
+// json object, progress of copying is printed to log
+/* Administrator is authenticated against source data store, operation requires realm-admin role for all realms. Administrator
+ * becomes author of revisions of copied realms and clients in target data store
+ * Parameters:
+ *     - ctx - context of CLI operation
+ *     - sourceCfg - source data store config
+ *     - targetConfigFile - application config file with target data store config
+ *     - logger - logger instance
+ *     - adminRealm - name of a realm that administrator belongs to
+ *     - adminUsername - administrator username
+ *     - adminPassword - administrator password
+ *     - realms - comma separated names of copied realms, all source realms are copied if it is empty
+ *     - onConflict - conflict strategy (skip, overwrite or fail)
+ *     - dryRun - if true data is not copied, actions that would be done are only printed
+ */
+func copyData(ctx context.Context, sourceCfg *config.DataSourceConfig, targetConfigFile string, logger *logging.AppLogger,
+	adminRealm string, adminUsername string, adminPassword string, realms string, onConflict string, dryRun bool,
+) {
+	if targetConfigFile == "" {
+		log.Fatalf("Not specified Target_config")
+	}
+	targetCfg, err := config.ReadAppConfig(targetConfigFile)
+	if err != nil {
+		log.Fatalf("readAppConfig failed: %s", err)
+	}
+	source := prepareDataStore(sourceCfg, logger, "source")
+	defer closeDataStore(source, "source")
+	checkAdminAccess(ctx, source, adminRealm, adminUsername, adminPassword, operations.CopyOperation, "", "", "", nil)
+	ctx = data.WithRevisionAuthor(ctx, adminRealm+"/"+adminUsername)
+	target := prepareDataStore(&targetCfg.DataSource, logger, "target")
+	defer closeDataStore(target, "target")
+
+	options := managers.CopyOptions{
+		OnConflict: data.ConflictStrategy(onConflict),
+		DryRun:     dryRun,
+		Progress: func(object data.CopiedObject, done int, total int) {
+			log.Print(sf.Format("[{0}/{1}] {2} \"{3}\" of realm \"{4}\": {5}", done, total, object.Type, object.Name, object.Realm,
+				object.Action))
+		},
+	}
+	for _, realm := range strings.Split(realms, ",") {
+		if realm = strings.TrimSpace(realm); realm != "" {
+			options.Realms = append(options.Realms, realm)
+		}
+	}
+	report, copyErr := managers.CopyData(ctx, source, target, options)
+	if report != nil {
+		reportJson, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			log.Fatalf("json.Marshal failed: %s", err)
+		}
+		fmt.Println(string(reportJson))
+	}
+	if copyErr != nil {
+		// deferred closing is skipped, data stores are closed by process exit
+		log.Fatalf("CopyData failed: %s", copyErr)
+	}
+}
+
+// prepareDataStore creates data store, CLI exits if it is not available
+func prepareDataStore(dataSourceCfg *config.DataSourceConfig, logger *logging.AppLogger, name string) managers.DataContext {
+	manager, err := managers.PrepareContext(dataSourceCfg, logger)
+	if err != nil {
+		log.Fatalf("prepareContext of %s data store failed: %s", name, err)
+	}
+	return manager
+}
+
+// closeDataStore closes data store, data store could save changes with delay (FILE data store with save_delay option)
+func closeDataStore(manager managers.DataContext, name string) {
+	if closer, ok := manager.(interface{ Close() error }); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("%s data store closing failed: %s", name, err)
+		}
+	}
+}
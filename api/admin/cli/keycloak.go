@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	e "errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/wissance/Ferrum/data"
+	"github.com/wissance/Ferrum/dto"
+	"github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/managers"
+	sf "github.com/wissance/stringFormatter"
+)
+
+// readKeycloakRealmExport reads Keycloak realm export from file (or from value if file is not provided) and converts it to realm,
+// realm json is returned too because realm import requires the same access as creation of this realm (see checkAdminAccess)
+/* Parameters:
+ *     - file - path to Keycloak realm export file
+ *     - value - Keycloak realm export json if file is not provided
+ * Returns: realm, import report and realm json
+ */
+func readKeycloakRealmExport(file string, value []byte) (data.Realm, *dto.RealmTransferReport, []byte) {
+	exportJson := value
+	if file != "" {
+		fileData, err := os.ReadFile(file)
+		if err != nil {
+			log.Fatalf("os.ReadFile failed: %s", err)
+		}
+		exportJson = fileData
+	}
+	if len(exportJson) == 0 {
+		log.Fatalf("Not specified File or Value")
+	}
+	realm, report, err := dto.ImportKeycloakRealm(exportJson)
+	if err != nil {
+		log.Fatalf("ImportKeycloakRealm failed: %s", err)
+	}
+	realmJson, err := json.Marshal(realm)
+	if err != nil {
+		log.Fatalf("json.Marshal failed: %s", err)
+	}
+	return realm, report, realmJson
+}
+
+// importKeycloakRealm creates realm that was read from Keycloak realm export and prints import report as a json object
+func importKeycloakRealm(ctx context.Context, manager managers.DataContext, realm data.Realm, report *dto.RealmTransferReport) {
+	if err := manager.CreateRealm(ctx, realm); err != nil {
+		log.Fatalf("CreateRealm failed: %s", err)
+	}
+	reportJson, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		log.Fatalf("json.Marshal failed: %s", err)
+	}
+	fmt.Println(string(reportJson))
+}
+
+// exportKeycloakRealm writes realm with clients, users and user federation configs in Keycloak realm export format to file (or
+// prints it if file is not provided), export report is printed to log
+func exportKeycloakRealm(ctx context.Context, manager managers.DataContext, realmName string, file string) {
+	realm, err := manager.GetRealm(ctx, realmName)
+	if err != nil {
+		log.Fatalf("GetRealm failed: %s", err)
+	}
+	clients, err := manager.GetClients(ctx, realmName)
+	if err != nil && !isEmptyList(err) {
+		log.Fatalf("GetClients failed: %s", err)
+	}
+	users, err := manager.GetUsers(ctx, realmName)
+	if err != nil && !isEmptyList(err) {
+		log.Fatalf("GetUsers failed: %s", err)
+	}
+	federationConfigs, err := manager.GetUserFederationConfigs(ctx, realmName)
+	if err != nil && !isEmptyList(err) {
+		log.Fatalf("GetUserFederationConfigs failed: %s", err)
+	}
+
+	export, report := dto.ExportKeycloakRealm(realm, clients, users, federationConfigs)
+	exportJson, err := json.MarshalIndent(export, "", "    ")
+	if err != nil {
+		log.Fatalf("json.Marshal failed: %s", err)
+	}
+	if file == "" {
+		fmt.Println(string(exportJson))
+	} else if err = os.WriteFile(file, exportJson, 0o600); err != nil {
+		// export contains clients secrets and bind credentials, therefore file is readable only by owner
+		log.Fatalf("os.WriteFile failed: %s", err)
+	}
+	reportJson, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		log.Fatalf("json.Marshal failed: %s", err)
+	}
+	log.Print(sf.Format("Realm: \"{0}\" successfully exported, report: {1}", realmName, string(reportJson)))
+}
+
+// isEmptyList checks whether error of realm objects list reading means that realm doesn't have such objects
+func isEmptyList(err error) bool {
+	var notFoundErr errors.ObjectNotFoundError
+	return e.Is(err, errors.ErrZeroLength) || e.As(err, &notFoundErr)
+}
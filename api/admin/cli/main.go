@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base32"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"strconv"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/wissance/Ferrum/dto"
+	"github.com/wissance/Ferrum/globals"
 	"github.com/wissance/Ferrum/managers"
+	"github.com/wissance/Ferrum/services"
+	"github.com/wissance/Ferrum/services/sessions"
 
 	"github.com/wissance/Ferrum/api/admin/cli/operations"
 	"github.com/wissance/Ferrum/config"
@@ -21,25 +29,53 @@ const defaultConfig = "./config_w_redis.json"
 
 var (
 	argConfigFile = flag.String("config", defaultConfig, "Application config for working with a persistent data store")
-	argOperation  = flag.String("operation", "", "One of the available operations read|create|update|delete or user specific change/reset password")
+	argOperation  = flag.String("operation", "", "One of the available operations read|create|update|delete or user specific list|search, change/reset password, get/revoke offline sessions, sessions specific get_sessions|logout|set_not_before, realm or client history|diff|rollback, data store schema migrate, realm keycloak_import|keycloak_export, data stores copy")
 	argResource   = flag.String("resource", "", "\"realm\", \"client\" or \"user\" or maybe other in future")
 	argResourceId = flag.String("resource_id", "", "resource object identifier, id required for the update|delete or read operation")
 	argParams     = flag.String("params", "", "Name of a realm for operations on client or user resources")
-	argValue      = flag.String("value", "", "Json encoded resource itself")
+	argValue      = flag.String("value", "", "Json encoded resource itself or revisions versions for the diff|rollback operations or comma separated realms names for the copy operation")
+	argOffset     = flag.Int("offset", 0, "Number of skipped users for the list|search operations")
+	argLimit      = flag.Int("limit", data.DefaultUsersPageSize, "Max number of users in a page for the list|search operations")
+	argIfVersion  = flag.Int64("if-version", data.NoExpectedVersion, "Expected version of realm, client or user for the update operation, update fails if stored object has other version (0 - update regardless of version)")
+	argDryRun     = flag.Bool("dry_run", false, "Print changes without applying them for the migrate|copy operations")
+	argFile       = flag.String("file", "", "Keycloak realm export file for the keycloak_import|keycloak_export operations (export is printed if it is not provided)")
+	argTargetCfg  = flag.String("target_config", "", "Application config with a target data store for the copy operation (source data store is from config)")
+	argOnConflict = flag.String("on_conflict", string(data.FailOnExisting), "What the copy operation does with objects that exist in a target data store: skip|overwrite|fail")
+	argAdminRealm = flag.String("admin_realm", globals.MasterRealm, "Name of a realm that administrator belongs to, realm administrator manages only own realm")
+	argAdminUser  = flag.String("admin_user", "", "Administrator username, administrator must have admin role required for operation")
+	argAdminPass  = flag.String("admin_password", "", "Administrator password, "+adminPasswordEnv+" environment variable is used if it is not provided")
 )
 
 func main() {
 	flag.Parse()
+	ctx := context.Background()
 	// TODO(UMV): extend config
 	cfg, err := config.ReadAppConfig(*argConfigFile)
 	if err != nil {
 		log.Fatalf("readAppConfig failed: %s", err)
 	}
 	logger := logging.CreateLogger(&cfg.Logging)
+	if operations.OperationType(*argOperation) == operations.MigrateOperation {
+		migrateDataStore(ctx, &cfg.DataSource, logger, *argAdminRealm, *argAdminUser, *argAdminPass, *argDryRun)
+		return
+	}
+	if operations.OperationType(*argOperation) == operations.CopyOperation {
+		copyData(ctx, &cfg.DataSource, *argTargetCfg, logger, *argAdminRealm, *argAdminUser, *argAdminPass, *argValue, *argOnConflict,
+			*argDryRun)
+		return
+	}
 	manager, err := managers.PrepareContext(&cfg.DataSource, logger)
 	if err != nil {
 		log.Fatalf("prepareContext failed: %s", err)
 	}
+	// data store could save changes with delay (FILE data store with save_delay option), changes must be saved before exit
+	if closer, ok := manager.(interface{ Close() error }); ok {
+		defer func() {
+			if closeErr := closer.Close(); closeErr != nil {
+				log.Printf("data store closing failed: %s", closeErr)
+			}
+		}()
+	}
 
 	operation := operations.OperationType(*argOperation)
 	resource := operations.ResourceType(*argResource)
@@ -49,22 +85,54 @@ func main() {
 
 	isInvalidOperation := operation != operations.GetOperation && operation != operations.CreateOperation &&
 		operation != operations.DeleteOperation && operation != operations.UpdateOperation &&
-		operation != operations.ChangePassword && operation != operations.ResetPassword
+		operation != operations.ChangePassword && operation != operations.ResetPassword &&
+		operation != operations.GetOfflineSessions && operation != operations.RevokeOfflineSessions &&
+		operation != operations.GetSessions && operation != operations.Logout && operation != operations.SetNotBefore &&
+		operation != operations.ListOperation && operation != operations.SearchOperation &&
+		operation != operations.HistoryOperation && operation != operations.DiffOperation && operation != operations.RollbackOperation &&
+		operation != operations.KeycloakImport && operation != operations.KeycloakExport
 	if isInvalidOperation {
 		log.Fatalf("bad Operation \"%s\"", operation)
 	}
-	// If there is a password change or password collection, it is not necessary to specify Resource
-	if !(operation == operations.ChangePassword || operation == operations.ResetPassword) {
-		isInvalidResource := resource != operations.RealmResource && resource != operations.ClientResource && resource != operations.UserResource
+	// If there is a password change or password collection or offline sessions operation, it is not necessary to specify Resource
+	isUserOperation := operation == operations.ChangePassword || operation == operations.ResetPassword ||
+		operation == operations.GetOfflineSessions || operation == operations.RevokeOfflineSessions
+	if !isUserOperation {
+		isInvalidResource := resource != operations.RealmResource && resource != operations.ClientResource && resource != operations.UserResource &&
+			resource != operations.UserFederationConfigResource && resource != operations.SessionResource
 		if isInvalidResource {
 			log.Fatalf("bad Resource \"%s\"", resource)
 		}
 	}
-	if (resource == operations.ClientResource) || (resource == operations.UserResource) {
+	if (resource == operations.ClientResource) || (resource == operations.UserResource) || (resource == operations.UserFederationConfigResource) ||
+		(resource == operations.SessionResource) {
 		if params == "" {
 			log.Fatalf("Not specified Params")
 		}
 	}
+	if (operation == operations.ListOperation || operation == operations.SearchOperation) && resource != operations.UserResource {
+		log.Fatalf("Bad Resource, only users could be listed or searched")
+	}
+	isRevisionOperation := operation == operations.HistoryOperation || operation == operations.DiffOperation ||
+		operation == operations.RollbackOperation
+	if isRevisionOperation && resource != operations.RealmResource && resource != operations.ClientResource {
+		log.Fatalf("Bad Resource, only realms and clients have revisions")
+	}
+	isKeycloakOperation := operation == operations.KeycloakImport || operation == operations.KeycloakExport
+	if isKeycloakOperation && resource != operations.RealmResource {
+		log.Fatalf("Bad Resource, only realms could be imported from or exported to Keycloak format")
+	}
+	var keycloakRealm data.Realm
+	var keycloakReport *dto.RealmTransferReport
+	if operation == operations.KeycloakImport {
+		// access to import is checked as access to creation of imported realm
+		keycloakRealm, keycloakReport, value = readKeycloakRealmExport(*argFile, value)
+	}
+	checkAdminAccess(ctx, manager, *argAdminRealm, *argAdminUser, *argAdminPass, operation, resource, resourceId, params, value)
+	if *argAdminUser != "" {
+		// administrator becomes author of realm and client revisions
+		ctx = data.WithRevisionAuthor(ctx, *argAdminRealm+"/"+*argAdminUser)
+	}
 
 	switch operation {
 	case operations.GetOperation:
@@ -73,32 +141,45 @@ func main() {
 		}
 		switch resource {
 		case operations.ClientResource:
-			client, err := manager.GetClient(params, resourceId)
+			client, err := manager.GetClient(ctx, params, resourceId)
 			if err != nil {
 				log.Fatalf("GetClient failed: %s", err)
 			}
 			fmt.Println(*client)
 
 		case operations.UserResource:
-			user, err := manager.GetUser(params, resourceId)
+			user, err := manager.GetUser(ctx, params, resourceId)
 			if err != nil {
 				log.Fatalf("GetUser failed: %s", err)
 			}
 			fmt.Println(user.GetUserInfo())
+			fmt.Println(sf.Format("version: {0}", user.GetVersion()))
 
 		case operations.RealmResource:
-			realm, err := manager.GetRealm(resourceId)
+			realm, err := manager.GetRealm(ctx, resourceId)
 			if err != nil {
 				log.Fatalf("GetRealm failed: %s", err)
 			}
 			fmt.Println(*realm)
 
 		case operations.UserFederationConfigResource:
-			userFederation, err := manager.GetUserFederationConfig(params, resourceId)
+			userFederation, err := manager.GetUserFederationConfig(ctx, params, resourceId)
 			if err != nil {
 				log.Fatalf("GetUserFederationConfig failed: %s", err)
 			}
 			fmt.Println(*userFederation)
+
+		case operations.SessionResource:
+			securityService := createSecurityService(cfg, &manager, logger, true)
+			sessionId, err := uuid.Parse(resourceId)
+			if err != nil {
+				log.Fatalf("Bad session id: %s", err)
+			}
+			session := securityService.GetSession(ctx, params, sessionId)
+			if session == nil {
+				log.Fatalf("Session \"%s\" doesn't exist", resourceId)
+			}
+			printSessions(ctx, securityService, params, []data.UserSession{*session})
 		}
 
 		return
@@ -112,7 +193,7 @@ func main() {
 			if unmarshalErr := json.Unmarshal(value, &clientNew); unmarshalErr != nil {
 				log.Fatal(sf.Format("json.Unmarshal failed: {0}", unmarshalErr.Error()))
 			}
-			if createErr := manager.CreateClient(params, clientNew); createErr != nil {
+			if createErr := manager.CreateClient(ctx, params, clientNew); createErr != nil {
 				log.Fatal(sf.Format("CreateClient failed: {0}", createErr.Error()))
 			}
 			log.Print(sf.Format("Client: \"{0}\" successfully created", clientNew.Name))
@@ -122,12 +203,12 @@ func main() {
 			if err := json.Unmarshal(value, &userNew); err != nil {
 				log.Fatalf("json.Unmarshal failed: %s", err)
 			}
-			realm, err := manager.GetRealm(params)
+			realm, err := manager.GetRealm(ctx, params)
 			if err != nil {
 				log.Fatalf("GetRealm failed: %s", err)
 			}
 			user := data.CreateUser(userNew, realm.Encoder)
-			if err := manager.CreateUser(params, user); err != nil {
+			if err := manager.CreateUser(ctx, params, user); err != nil {
 				log.Fatalf("CreateUser failed: %s", err)
 			}
 			fmt.Println(sf.Format("User: \"{0}\" successfully created", user.GetUsername()))
@@ -137,7 +218,7 @@ func main() {
 			if err := json.Unmarshal(value, &newRealm); err != nil {
 				log.Fatalf("json.Unmarshal failed: %s", err)
 			}
-			if err := manager.CreateRealm(newRealm); err != nil {
+			if err := manager.CreateRealm(ctx, newRealm); err != nil {
 				log.Fatalf("CreateRealm failed: %s", err)
 			}
 			fmt.Println(sf.Format("Realm: \"{0}\" successfully created", newRealm.Name))
@@ -146,7 +227,7 @@ func main() {
 			if err := json.Unmarshal(value, &userFederationConfig); err != nil {
 				log.Fatalf("json.Unmarshal failed: %s", err)
 			}
-			if err := manager.CreateUserFederationConfig(params, userFederationConfig); err != nil {
+			if err := manager.CreateUserFederationConfig(ctx, params, userFederationConfig); err != nil {
 				log.Fatalf("CreateUserFederationConfig failed: %s", err)
 			}
 			fmt.Println(sf.Format("User federation service config: \"{0}\" successfully created", userFederationConfig.Name))
@@ -159,28 +240,39 @@ func main() {
 		}
 		switch resource {
 		case operations.ClientResource:
-			if err := manager.DeleteClient(params, resourceId); err != nil {
+			if err := manager.DeleteClient(ctx, params, resourceId); err != nil {
 				log.Fatalf("DeleteClient failed: %s", err)
 			}
 			fmt.Println(sf.Format("Client: \"{0}\" successfully deleted", resourceId))
 
 		case operations.UserResource:
-			if err := manager.DeleteUser(params, resourceId); err != nil {
+			if err := manager.DeleteUser(ctx, params, resourceId); err != nil {
 				log.Fatalf("DeleteUser failed: %s", err)
 			}
 			fmt.Println(sf.Format("User: \"{0}\" successfully deleted", resourceId))
 
 		case operations.RealmResource:
-			if err := manager.DeleteRealm(resourceId); err != nil {
+			if err := manager.DeleteRealm(ctx, resourceId); err != nil {
 				log.Fatalf("DeleteRealm failed: %s", err)
 			}
 			fmt.Println(sf.Format("Realm: \"{0}\" successfully deleted", resourceId))
 
 		case operations.UserFederationConfigResource:
-			if err := manager.DeleteUserFederationConfig(params, resourceId); err != nil {
+			if err := manager.DeleteUserFederationConfig(ctx, params, resourceId); err != nil {
 				log.Fatalf("DeleteUserFederationConfig failed: %s", err)
 			}
 			fmt.Println(sf.Format("User federation service config: \"{0}\" successfully deleted", resourceId))
+
+		case operations.SessionResource:
+			securityService := createSecurityService(cfg, &manager, logger, true)
+			sessionId, err := uuid.Parse(resourceId)
+			if err != nil {
+				log.Fatalf("Bad session id: %s", err)
+			}
+			if !securityService.TerminateSession(ctx, params, sessionId) {
+				log.Fatalf("Session \"%s\" doesn't exist", resourceId)
+			}
+			fmt.Println(sf.Format("Session: \"{0}\" successfully terminated", resourceId))
 		}
 
 		return
@@ -197,7 +289,8 @@ func main() {
 			if err := json.Unmarshal(value, &newClient); err != nil {
 				log.Fatalf("json.Unmarshal failed: %s", err)
 			}
-			if err := manager.UpdateClient(params, resourceId, newClient); err != nil {
+			newClient.Version = *argIfVersion
+			if err := manager.UpdateClient(ctx, params, resourceId, newClient); err != nil {
 				log.Fatalf("UpdateClient failed: %s", err)
 			}
 			fmt.Println(sf.Format("Client: \"{0}\" successfully updated", newClient.Name))
@@ -208,7 +301,8 @@ func main() {
 				log.Fatalf("json.Unmarshal failed: %s", err)
 			}
 			user := data.CreateUser(newUser, nil)
-			if err := manager.UpdateUser(params, resourceId, user); err != nil {
+			user.SetVersion(*argIfVersion)
+			if err := manager.UpdateUser(ctx, params, resourceId, user); err != nil {
 				log.Fatalf("UpdateUser failed: %s", err)
 			}
 			fmt.Println(sf.Format("User: \"{0}\" successfully updated", user.GetUsername(), params))
@@ -218,7 +312,8 @@ func main() {
 			if err := json.Unmarshal(value, &newRealm); err != nil {
 				log.Fatalf("json.Unmarshal failed: %s", err)
 			}
-			if err := manager.UpdateRealm(resourceId, newRealm); err != nil {
+			newRealm.Version = *argIfVersion
+			if err := manager.UpdateRealm(ctx, resourceId, newRealm); err != nil {
 				log.Fatalf("UpdateRealm failed: %s", err)
 			}
 			fmt.Println(sf.Format("Realm: \"{0}\" successfully updated", newRealm.Name))
@@ -227,7 +322,7 @@ func main() {
 			if err := json.Unmarshal(value, &userFederationServiceConfig); err != nil {
 				log.Fatalf("json.Unmarshal failed: %s", err)
 			}
-			if err := manager.UpdateUserFederationConfig(params, resourceId, userFederationServiceConfig); err != nil {
+			if err := manager.UpdateUserFederationConfig(ctx, params, resourceId, userFederationServiceConfig); err != nil {
 				log.Fatalf("UpdateUserFederationConfig failed: %s", err)
 			}
 			fmt.Println(sf.Format("User federation service config: \"{0}\" successfully updated", userFederationServiceConfig.Name, params))
@@ -251,7 +346,7 @@ func main() {
 			}
 			password := string(value)
 			passwordManager := manager.(PasswordManager)
-			if err := passwordManager.SetPassword(params, resourceId, password); err != nil {
+			if err := passwordManager.SetPassword(ctx, params, resourceId, password); err != nil {
 				log.Fatalf("SetPassword failed: %s", err)
 			}
 			fmt.Printf("Password successfully changed")
@@ -274,7 +369,7 @@ func main() {
 			}
 			password := getRandPassword()
 			passwordManager := manager.(PasswordManager)
-			if err := passwordManager.SetPassword(params, resourceId, password); err != nil {
+			if err := passwordManager.SetPassword(ctx, params, resourceId, password); err != nil {
 				log.Fatalf("SetPassword failed: %s", err)
 			}
 			fmt.Printf("New password: %s", password)
@@ -283,12 +378,240 @@ func main() {
 			log.Fatalf("Bad Resource")
 		}
 
+		return
+	case operations.GetOfflineSessions:
+		if resource != operations.UserResource && resource != "" {
+			log.Fatalf("Bad Resource")
+		}
+		user := getUserForOfflineSessions(ctx, manager, params, resourceId)
+		offlineSessions, err := manager.GetUserOfflineSessions(ctx, params, user.GetId())
+		if err != nil {
+			log.Fatalf("GetUserOfflineSessions failed: %s", err)
+		}
+		offlineSessionsJson, err := json.MarshalIndent(offlineSessions, "", "    ")
+		if err != nil {
+			log.Fatalf("json.Marshal failed: %s", err)
+		}
+		fmt.Println(string(offlineSessionsJson))
+
+		return
+	case operations.RevokeOfflineSessions:
+		if resource != operations.UserResource && resource != "" {
+			log.Fatalf("Bad Resource")
+		}
+		user := getUserForOfflineSessions(ctx, manager, params, resourceId)
+		offlineSessions, err := manager.GetUserOfflineSessions(ctx, params, user.GetId())
+		if err != nil {
+			log.Fatalf("GetUserOfflineSessions failed: %s", err)
+		}
+		// value is optional, if it is not provided all user offline sessions are revoked
+		sessionToRevoke := string(value)
+		revoked := 0
+		for _, s := range offlineSessions {
+			if len(sessionToRevoke) > 0 && s.Id.String() != sessionToRevoke {
+				continue
+			}
+			if err := manager.DeleteOfflineSession(ctx, params, s.Id); err != nil {
+				log.Fatalf("DeleteOfflineSession failed: %s", err)
+			}
+			revoked++
+		}
+		if len(sessionToRevoke) > 0 && revoked == 0 {
+			log.Fatalf("User \"%s\" doesn't have offline session \"%s\"", resourceId, sessionToRevoke)
+		}
+		fmt.Println(sf.Format("{0} offline session(s) of user \"{1}\" successfully revoked", revoked, resourceId))
+
+		return
+	case operations.GetSessions:
+		if resourceId == "" {
+			log.Fatalf("Not specified Resource_id")
+		}
+		securityService := createSecurityService(cfg, &manager, logger, true)
+		switch resource {
+		case operations.RealmResource:
+			printSessions(ctx, securityService, resourceId, securityService.GetRealmSessions(ctx, resourceId))
+		case operations.UserResource:
+			user, err := manager.GetUser(ctx, params, resourceId)
+			if err != nil {
+				log.Fatalf("GetUser failed: %s", err)
+			}
+			printSessions(ctx, securityService, params, securityService.GetUserSessions(ctx, params, user.GetId()))
+		case operations.ClientResource:
+			client, err := manager.GetClient(ctx, params, resourceId)
+			if err != nil {
+				log.Fatalf("GetClient failed: %s", err)
+			}
+			printSessions(ctx, securityService, params, securityService.GetClientSessions(ctx, params, client.Name))
+		default:
+			log.Fatalf("Bad Resource")
+		}
+
+		return
+	case operations.ListOperation:
+		usersPage, err := manager.ListUsers(ctx, params, data.PageRequest{Offset: *argOffset, Limit: *argLimit})
+		if err != nil {
+			log.Fatalf("ListUsers failed: %s", err)
+		}
+		printUsersPage(usersPage)
+
+		return
+	case operations.SearchOperation:
+		var filter data.UsersFilter
+		if len(value) > 0 {
+			if err := json.Unmarshal(value, &filter); err != nil {
+				log.Fatalf("json.Unmarshal failed: %s", err)
+			}
+		}
+		usersPage, err := manager.SearchUsers(ctx, params, filter, data.PageRequest{Offset: *argOffset, Limit: *argLimit})
+		if err != nil {
+			log.Fatalf("SearchUsers failed: %s", err)
+		}
+		printUsersPage(usersPage)
+
+		return
+	case operations.Logout:
+		if resourceId == "" {
+			log.Fatalf("Not specified Resource_id")
+		}
+		securityService := createSecurityService(cfg, &manager, logger, true)
+		switch resource {
+		case operations.RealmResource:
+			terminated := securityService.TerminateRealmSessions(ctx, resourceId)
+			fmt.Println(sf.Format("{0} session(s) of realm \"{1}\" successfully terminated", terminated, resourceId))
+		case operations.UserResource:
+			user, err := manager.GetUser(ctx, params, resourceId)
+			if err != nil {
+				log.Fatalf("GetUser failed: %s", err)
+			}
+			terminated := securityService.TerminateUserSessions(ctx, params, user.GetId())
+			fmt.Println(sf.Format("{0} session(s) of user \"{1}\" successfully terminated", terminated, resourceId))
+		default:
+			log.Fatalf("Bad Resource")
+		}
+
+		return
+	case operations.SetNotBefore:
+		if resource != operations.RealmResource {
+			log.Fatalf("Bad Resource")
+		}
+		if resourceId == "" {
+			log.Fatalf("Not specified Resource_id")
+		}
+		// value is optional, if it is not provided current time is using
+		notBefore := time.Now().Unix()
+		if len(value) > 0 {
+			notBefore, err = strconv.ParseInt(string(value), 10, 64)
+			if err != nil || notBefore < 0 {
+				log.Fatalf("Bad Value, expected unix time in seconds: %s", value)
+			}
+		}
+		realm, err := manager.GetRealm(ctx, resourceId)
+		if err != nil {
+			log.Fatalf("GetRealm failed: %s", err)
+		}
+		// not-before is stored in a data store, therefore sessions store is not required
+		securityService := createSecurityService(cfg, &manager, logger, false)
+		if err := securityService.SetRealmNotBefore(ctx, realm, notBefore); err != nil {
+			log.Fatalf("SetRealmNotBefore failed: %s", err)
+		}
+		fmt.Println(sf.Format("Realm: \"{0}\" not-before successfully set to {1}", resourceId, notBefore))
+
+		return
+	case operations.HistoryOperation, operations.DiffOperation, operations.RollbackOperation:
+		if resourceId == "" {
+			log.Fatalf("Not specified Resource_id")
+		}
+		realmName, objectType, objectName := getRevisionObject(resource, resourceId, params)
+		switch operation {
+		case operations.HistoryOperation:
+			printRevisions(ctx, manager, realmName, objectType, objectName)
+		case operations.DiffOperation:
+			printRevisionsDiff(ctx, manager, realmName, objectType, objectName, value)
+		default:
+			rollbackRevision(ctx, manager, realmName, objectType, objectName, value)
+		}
+
+		return
+	case operations.KeycloakImport:
+		importKeycloakRealm(ctx, manager, keycloakRealm, keycloakReport)
+		fmt.Println(sf.Format("Realm: \"{0}\" successfully imported", keycloakRealm.Name))
+
+		return
+	case operations.KeycloakExport:
+		if resourceId == "" {
+			log.Fatalf("Not specified Resource_id")
+		}
+		exportKeycloakRealm(ctx, manager, resourceId, *argFile)
+
 		return
 	default:
 		log.Fatalf("Bad Operation")
 	}
 }
 
+// getUserForOfflineSessions returns user whose offline sessions are managed, it requires realm (params) and username (resourceId)
+func getUserForOfflineSessions(ctx context.Context, manager managers.DataContext, params string, resourceId string) data.User {
+	if params == "" {
+		log.Fatalf("Not specified Params")
+	}
+	if resourceId == "" {
+		log.Fatalf("Not specified Resource_id")
+	}
+	user, err := manager.GetUser(ctx, params, resourceId)
+	if err != nil {
+		log.Fatalf("GetUser failed: %s", err)
+	}
+	return user
+}
+
+// createSecurityService creates SecurityService that works with sessions store configured for server, sessions stored in
+// server memory are not accessible from CLI, therefore if requireSessionStore is true Redis sessions store must be configured
+func createSecurityService(cfg *config.AppConfig, manager *managers.DataContext, logger *logging.AppLogger,
+	requireSessionStore bool,
+) services.SecurityService {
+	if requireSessionStore && cfg.SessionStore.Type != config.RedisSessionStore {
+		log.Fatalf("Sessions are stored in server memory, use HTTP admin API to manage them")
+	}
+	sessionStore, err := sessions.CreateSessionStore(&cfg.SessionStore, &cfg.DataSource, *manager, logger)
+	if err != nil {
+		log.Fatalf("CreateSessionStore failed: %s", err)
+	}
+	return services.CreateSecurityService(manager, sessionStore, logger)
+}
+
+// printSessions prints sessions as a json array, sessions tokens are not printed
+func printSessions(ctx context.Context, securityService services.SecurityService, realm string, userSessions []data.UserSession) {
+	result := make([]dto.UserSessionRepresentation, len(userSessions))
+	for i := range userSessions {
+		username := ""
+		if user := securityService.GetCurrentUserById(ctx, realm, userSessions[i].UserId); user != nil {
+			username = user.GetUsername()
+		}
+		result[i] = dto.CreateUserSessionRepresentation(&userSessions[i], username)
+	}
+	sessionsJson, err := json.MarshalIndent(result, "", "    ")
+	if err != nil {
+		log.Fatalf("json.Marshal failed: %s", err)
+	}
+	fmt.Println(string(sessionsJson))
+}
+
+// printUsersPage prints page of users as a json object, users are printed as user info (without credentials)
+func printUsersPage(usersPage *data.UsersPage) {
+	users := make([]interface{}, len(usersPage.Users))
+	for i, user := range usersPage.Users {
+		users[i] = user.GetUserInfo()
+	}
+	result := map[string]interface{}{
+		"users": users, "total": usersPage.Total, "offset": usersPage.Offset, "limit": usersPage.Limit,
+	}
+	usersJson, err := json.MarshalIndent(result, "", "    ")
+	if err != nil {
+		log.Fatalf("json.Marshal failed: %s", err)
+	}
+	fmt.Println(string(usersJson))
+}
+
 func getRandPassword() string {
 	// TODO(SIA) Move password generation to another location
 	randomBytes := make([]byte, 32)
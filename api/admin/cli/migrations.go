@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/wissance/Ferrum/api/admin/cli/operations"
+	"github.com/wissance/Ferrum/config"
+	"github.com/wissance/Ferrum/data"
+	"github.com/wissance/Ferrum/logging"
+	"github.com/wissance/Ferrum/managers"
+)
+
+// migrateDataStore migrates stored data to the current data schema version and prints migration report as a json object
+/* Data store is created with disabled migrations on start (config.AutoMigrate), therefore dry run prints migrations that are not
+ * applied yet. Operation requires realm-admin role for all realms, administrator is authenticated before migration with outdated
+ * data (see data.WithOutdatedDataReading).
+ * Parameters:
+ *     - ctx - context of CLI operation
+ *     - dataSourceCfg - data source config
+ *     - logger - logger instance
+ *     - adminRealm - name of a realm that administrator belongs to
+ *     - adminUsername - administrator username
+ *     - adminPassword - administrator password
+ *     - dryRun - if true data is not changed, migrations that would be applied are only printed
+ */
+func migrateDataStore(ctx context.Context, dataSourceCfg *config.DataSourceConfig, logger *logging.AppLogger, adminRealm string,
+	adminUsername string, adminPassword string, dryRun bool,
+) {
+	if dataSourceCfg.Options == nil {
+		dataSourceCfg.Options = map[config.DataSourceConnOption]string{}
+	}
+	dataSourceCfg.Options[config.AutoMigrate] = "false"
+	manager, err := managers.PrepareContext(dataSourceCfg, logger)
+	if err != nil {
+		log.Fatalf("prepareContext failed: %s", err)
+	}
+	if closer, ok := manager.(interface{ Close() error }); ok {
+		defer func() {
+			if closeErr := closer.Close(); closeErr != nil {
+				log.Printf("data store closing failed: %s", closeErr)
+			}
+		}()
+	}
+	migrator, ok := manager.(managers.SchemaMigrator)
+	if !ok {
+		log.Fatalf("Data store \"%s\" doesn't have versioned data schema", dataSourceCfg.Type)
+	}
+	checkAdminAccess(data.WithOutdatedDataReading(ctx), manager, adminRealm, adminUsername, adminPassword, operations.MigrateOperation,
+		"", "", "", nil)
+	report, err := migrator.Migrate(ctx, dryRun)
+	if err != nil {
+		log.Fatalf("Migrate failed: %s", err)
+	}
+	reportJson, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		log.Fatalf("json.Marshal failed: %s", err)
+	}
+	fmt.Println(string(reportJson))
+}
@@ -7,15 +7,30 @@ const (
 	ClientResource               ResourceType = "client"
 	UserResource                 ResourceType = "user"
 	UserFederationConfigResource ResourceType = "user_federation"
+	SessionResource              ResourceType = "session"
 )
 
 type OperationType string
 
 const (
-	GetOperation    OperationType = "get"
-	CreateOperation OperationType = "create"
-	DeleteOperation OperationType = "delete"
-	UpdateOperation OperationType = "update"
-	ChangePassword  OperationType = "change_password"
-	ResetPassword   OperationType = "reset_password"
+	GetOperation          OperationType = "get"
+	CreateOperation       OperationType = "create"
+	DeleteOperation       OperationType = "delete"
+	UpdateOperation       OperationType = "update"
+	ChangePassword        OperationType = "change_password"
+	ResetPassword         OperationType = "reset_password"
+	GetOfflineSessions    OperationType = "get_offline_sessions"
+	RevokeOfflineSessions OperationType = "revoke_offline_sessions"
+	GetSessions           OperationType = "get_sessions"
+	Logout                OperationType = "logout"
+	SetNotBefore          OperationType = "set_not_before"
+	ListOperation         OperationType = "list"
+	SearchOperation       OperationType = "search"
+	HistoryOperation      OperationType = "history"
+	DiffOperation         OperationType = "diff"
+	RollbackOperation     OperationType = "rollback"
+	MigrateOperation      OperationType = "migrate"
+	KeycloakImport        OperationType = "keycloak_import"
+	KeycloakExport        OperationType = "keycloak_export"
+	CopyOperation         OperationType = "copy"
 )
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/wissance/Ferrum/api/admin/cli/operations"
+	"github.com/wissance/Ferrum/data"
+	"github.com/wissance/Ferrum/managers"
+	sf "github.com/wissance/stringFormatter"
+)
+
+// revisionsDiff is a result of diff operation
+type revisionsDiff struct {
+	From    int64                 `json:"from"`
+	To      int64                 `json:"to"`
+	Changes []data.RevisionChange `json:"changes"`
+}
+
+// getRevisionObject returns realm, type and name of object which revisions are managed: realm (resourceId) or client (resourceId)
+// of realm (params)
+func getRevisionObject(resource operations.ResourceType, resourceId string, params string) (string, data.RevisionObjectType, string) {
+	if resource == operations.RealmResource {
+		return resourceId, data.RealmRevision, ""
+	}
+	return params, data.ClientRevision, resourceId
+}
+
+// getRevisions returns all kept revisions of realm or client, CLI exits if data store doesn't keep history
+func getRevisions(ctx context.Context, manager managers.DataContext, realmName string, objectType data.RevisionObjectType,
+	objectName string,
+) []data.Revision {
+	keeper, ok := manager.(managers.RevisionsKeeper)
+	if !ok {
+		log.Fatalf("Data store doesn't keep revisions")
+	}
+	revisions, err := keeper.GetRevisions(ctx, realmName, objectType, objectName)
+	if err != nil {
+		log.Fatalf("GetRevisions failed: %s", err)
+	}
+	return revisions
+}
+
+// printRevisions prints kept revisions of realm or client as a json array ordered by version
+func printRevisions(ctx context.Context, manager managers.DataContext, realmName string, objectType data.RevisionObjectType,
+	objectName string,
+) {
+	revisionsJson, err := json.MarshalIndent(getRevisions(ctx, manager, realmName, objectType, objectName), "", "    ")
+	if err != nil {
+		log.Fatalf("json.Marshal failed: %s", err)
+	}
+	fmt.Println(string(revisionsJson))
+}
+
+// printRevisionsDiff prints changes between two revisions of realm or client as a json object
+/* Parameters:
+ *     - ctx - context of CLI operation
+ *     - manager - data context
+ *     - realmName - name of a realm
+ *     - objectType - data.RealmRevision or data.ClientRevision
+ *     - objectName - name of a client
+ *     - value - versions of compared revisions "{from},{to}" or "{from}" (revision is compared with the latest one)
+ */
+func printRevisionsDiff(ctx context.Context, manager managers.DataContext, realmName string, objectType data.RevisionObjectType,
+	objectName string, value []byte,
+) {
+	fromVersion, toVersion := parseRevisionVersions(value)
+	revisions := getRevisions(ctx, manager, realmName, objectType, objectName)
+	if len(revisions) == 0 {
+		log.Fatalf("%s \"%s\" doesn't have revisions", objectType, getRevisionObjectId(realmName, objectType, objectName))
+	}
+	if toVersion == 0 {
+		toVersion = revisions[len(revisions)-1].Version
+	}
+	from := data.FindRevision(revisions, fromVersion)
+	to := data.FindRevision(revisions, toVersion)
+	if from == nil || to == nil {
+		log.Fatalf("Revisions %d and %d of %s \"%s\" are not kept", fromVersion, toVersion, objectType,
+			getRevisionObjectId(realmName, objectType, objectName))
+	}
+	changes, err := data.DiffRevisions(from, to)
+	if err != nil {
+		log.Fatalf("DiffRevisions failed: %s", err)
+	}
+	diffJson, err := json.MarshalIndent(revisionsDiff{From: fromVersion, To: toVersion, Changes: changes}, "", "    ")
+	if err != nil {
+		log.Fatalf("json.Marshal failed: %s", err)
+	}
+	fmt.Println(string(diffJson))
+}
+
+// rollbackRevision restores realm settings or client from revision with version (value), rollback itself becomes a new revision
+func rollbackRevision(ctx context.Context, manager managers.DataContext, realmName string, objectType data.RevisionObjectType,
+	objectName string, value []byte,
+) {
+	version, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil || version <= 0 {
+		log.Fatalf("Bad Value, expected revision version: %s", value)
+	}
+	if objectType == data.RealmRevision {
+		err = managers.RollbackRealm(ctx, manager, realmName, version)
+	} else {
+		err = managers.RollbackClient(ctx, manager, realmName, objectName, version)
+	}
+	if err != nil {
+		log.Fatalf("Rollback failed: %s", err)
+	}
+	fmt.Println(sf.Format("{0}: \"{1}\" successfully rolled back to version {2}", objectType,
+		getRevisionObjectId(realmName, objectType, objectName), version))
+}
+
+// parseRevisionVersions parses diff operation value "{from},{to}" or "{from}" (to is 0 - the latest revision)
+func parseRevisionVersions(value []byte) (int64, int64) {
+	parts := strings.Split(string(value), ",")
+	if len(parts) > 2 {
+		log.Fatalf("Bad Value, expected revisions versions {from},{to}: %s", value)
+	}
+	versions := make([]int64, 2)
+	for i, part := range parts {
+		version, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil || version <= 0 {
+			log.Fatalf("Bad Value, expected revisions versions {from},{to}: %s", value)
+		}
+		versions[i] = version
+	}
+	return versions[0], versions[1]
+}
+
+// getRevisionObjectId returns realm name for realm and client name for client (for messages)
+func getRevisionObjectId(realmName string, objectType data.RevisionObjectType, objectName string) string {
+	if objectType == data.RealmRevision {
+		return realmName
+	}
+	return objectName
+}
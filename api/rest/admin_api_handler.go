@@ -0,0 +1,402 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	e "errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/wissance/Ferrum/data"
+	"github.com/wissance/Ferrum/dto"
+	"github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/globals"
+	sf "github.com/wissance/stringFormatter"
+)
+
+// GetRealmSessions this function is a Http Request Handler that is responsible for getting all active realm sessions
+// @Summary Getting all active realm sessions
+// @Description Getting all active realm sessions, requires access token of an administrator with view-users role
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Success 200 {array} dto.UserSessionRepresentation
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/sessions [get]
+// @Router /admin/realms/{realm}/sessions [get]
+func (wCtx *WebApiContext) GetRealmSessions(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	realmPtr, _, status, errDetails := wCtx.prepareAdminRequest(request, "Get realm sessions", data.ViewUsers)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	result := wCtx.getSessionsRepresentation(request.Context(), realmPtr.Name,
+		(*wCtx.Security).GetRealmSessions(request.Context(), realmPtr.Name))
+	afterHandle(&respWriter, http.StatusOK, &result)
+}
+
+// GetUserSessions this function is a Http Request Handler that is responsible for getting all active user sessions
+// @Summary Getting all active user sessions
+// @Description Getting all active user sessions (user is identified by id or username), requires access token of an administrator with view-users role
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Param id path string true "User id or username"
+// @Success 200 {array} dto.UserSessionRepresentation
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/users/{id}/sessions [get]
+// @Router /admin/realms/{realm}/users/{id}/sessions [get]
+func (wCtx *WebApiContext) GetUserSessions(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	realmPtr, _, status, errDetails := wCtx.prepareAdminRequest(request, "Get user sessions", data.ViewUsers)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	user := wCtx.getUserByIdOrName(request.Context(), realmPtr.Name, mux.Vars(request)[globals.IdPathVar])
+	if user == nil {
+		result := dto.ErrorDetails{Msg: sf.Format(errors.UserDoesNotExistsTemplate, mux.Vars(request)[globals.IdPathVar])}
+		afterHandle(&respWriter, http.StatusNotFound, &result)
+		return
+	}
+	result := wCtx.getSessionsRepresentation(request.Context(), realmPtr.Name,
+		(*wCtx.Security).GetUserSessions(request.Context(), realmPtr.Name, user.GetId()))
+	afterHandle(&respWriter, http.StatusOK, &result)
+}
+
+// GetClientSessions this function is a Http Request Handler that is responsible for getting all active sessions of a client
+// @Summary Getting all active client sessions
+// @Description Getting all active sessions started by client (client is identified by name or id), requires access token of an
+// @Description administrator with view-users role
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Param id path string true "Client name or id"
+// @Success 200 {array} dto.UserSessionRepresentation
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/clients/{id}/user-sessions [get]
+// @Router /admin/realms/{realm}/clients/{id}/user-sessions [get]
+func (wCtx *WebApiContext) GetClientSessions(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	realmPtr, _, status, errDetails := wCtx.prepareAdminRequest(request, "Get client sessions", data.ViewUsers)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	client := wCtx.getClientByNameOrId(request.Context(), realmPtr, mux.Vars(request)[globals.IdPathVar])
+	if client == nil {
+		result := dto.ErrorDetails{Msg: sf.Format(errors.ClientDoesNotExistsTemplate, mux.Vars(request)[globals.IdPathVar])}
+		afterHandle(&respWriter, http.StatusNotFound, &result)
+		return
+	}
+	result := wCtx.getSessionsRepresentation(request.Context(), realmPtr.Name,
+		(*wCtx.Security).GetClientSessions(request.Context(), realmPtr.Name, client.Name))
+	afterHandle(&respWriter, http.StatusOK, &result)
+}
+
+// DeleteSession this function is a Http Request Handler that is responsible for forced end of one session
+// @Summary Terminates session
+// @Description Terminates session, all tokens issued by it become invalid, requires access token of an administrator with manage-users role
+// @Tags admin
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Param session path string true "Session id"
+// @Success 204
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/sessions/{session} [delete]
+// @Router /admin/realms/{realm}/sessions/{session} [delete]
+func (wCtx *WebApiContext) DeleteSession(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	realmPtr, _, status, errDetails := wCtx.prepareAdminRequest(request, "Delete session", data.ManageUsers)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	sessionValue := mux.Vars(request)[globals.SessionPathVar]
+	sessionId, err := uuid.Parse(sessionValue)
+	if err != nil || !(*wCtx.Security).TerminateSession(request.Context(), realmPtr.Name, sessionId) {
+		result := dto.ErrorDetails{Msg: sf.Format(errors.SessionDoesNotExistsTemplate, sessionValue)}
+		afterHandle(&respWriter, http.StatusNotFound, &result)
+		return
+	}
+	afterHandle(&respWriter, http.StatusNoContent, nil)
+}
+
+// LogoutUser this function is a Http Request Handler that is responsible for forced end of all user sessions
+// @Summary Terminates all user sessions
+// @Description Terminates all user sessions (offline sessions are kept), requires access token of an administrator with manage-users role
+// @Tags admin
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Param id path string true "User id or username"
+// @Success 204
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/users/{id}/logout [post]
+// @Router /admin/realms/{realm}/users/{id}/logout [post]
+func (wCtx *WebApiContext) LogoutUser(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	realmPtr, _, status, errDetails := wCtx.prepareAdminRequest(request, "Logout user", data.ManageUsers)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	user := wCtx.getUserByIdOrName(request.Context(), realmPtr.Name, mux.Vars(request)[globals.IdPathVar])
+	if user == nil {
+		result := dto.ErrorDetails{Msg: sf.Format(errors.UserDoesNotExistsTemplate, mux.Vars(request)[globals.IdPathVar])}
+		afterHandle(&respWriter, http.StatusNotFound, &result)
+		return
+	}
+	(*wCtx.Security).TerminateUserSessions(request.Context(), realmPtr.Name, user.GetId())
+	afterHandle(&respWriter, http.StatusNoContent, nil)
+}
+
+// LogoutAll this function is a Http Request Handler that is responsible for forced end of all realm sessions
+// @Summary Terminates all realm sessions
+// @Description Terminates all realm sessions (offline sessions are kept), requires access token of an administrator with manage-realm role
+// @Tags admin
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Success 204
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/logout-all [post]
+// @Router /admin/realms/{realm}/logout-all [post]
+func (wCtx *WebApiContext) LogoutAll(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	realmPtr, _, status, errDetails := wCtx.prepareAdminRequest(request, "Logout all", data.ManageRealm)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	(*wCtx.Security).TerminateRealmSessions(request.Context(), realmPtr.Name)
+	afterHandle(&respWriter, http.StatusNoContent, nil)
+}
+
+// SetRealmNotBefore this function is a Http Request Handler that is responsible for setting realm revocation timestamp
+// @Summary Sets realm not-before revocation timestamp
+// @Description Tokens of all sessions (including offline) that were not active since notBefore (unix time in seconds, current time
+// @Description if body is empty) become invalid, requires writable data store and access token of an administrator with manage-realm role
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Param function body dto.NotBeforePolicy false "Revocation timestamp"
+// @Success 200 {object} dto.NotBeforePolicy
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Failure 501 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/not-before [post]
+// @Router /admin/realms/{realm}/not-before [post]
+func (wCtx *WebApiContext) SetRealmNotBefore(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	realmPtr, admin, status, errDetails := wCtx.prepareAdminRequest(request, "Set realm not-before", data.ManageRealm)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	policy := dto.NotBeforePolicy{NotBefore: time.Now().Unix()}
+	body, err := io.ReadAll(request.Body)
+	if err == nil && len(strings.TrimSpace(string(body))) > 0 {
+		err = json.Unmarshal(body, &policy)
+	}
+	if err != nil || policy.NotBefore < 0 {
+		wCtx.Logger.Debug("Set realm not-before: body is bad")
+		result := dto.ErrorDetails{Msg: errors.BadBodyMsg}
+		afterHandle(&respWriter, http.StatusBadRequest, &result)
+		return
+	}
+	if err = (*wCtx.Security).SetRealmNotBefore(admin.withAuthor(request.Context()), realmPtr, policy.NotBefore); err != nil {
+		status = http.StatusInternalServerError
+		result := dto.ErrorDetails{Msg: sf.Format(errors.OtherAppError, realmPtr.Name)}
+		if e.Is(err, errors.ErrOperationNotImplemented) {
+			status = http.StatusNotImplemented
+			result = dto.ErrorDetails{Msg: errors.OperationNotSupportedMsg}
+		} else {
+			wCtx.Logger.Error(sf.Format("Set realm not-before: an error occurred during realm update: {0}", err.Error()))
+		}
+		afterHandle(&respWriter, status, &result)
+		return
+	}
+	afterHandle(&respWriter, http.StatusOK, &policy)
+}
+
+// adminUser is an authenticated admin API caller: user and realm that user belongs to
+type adminUser struct {
+	user  data.User
+	realm string
+}
+
+// withAuthor returns context of data store changes that are made by admin, admin ({realm}/{username}) becomes author of
+// realm and client revisions (see data.WithRevisionAuthor)
+func (admin *adminUser) withAuthor(ctx context.Context) context.Context {
+	return data.WithRevisionAuthor(ctx, admin.realm+"/"+admin.user.GetUsername())
+}
+
+// prepareAdminRequest checks that request is authorized by admin access token and reads realm from path
+/* Parameters:
+ *     - request - http request with realm path variable
+ *     - operation - operation name for logging
+ *     - roles - admin roles that grant access to operation (any of them) for realm from path
+ * Returns: realm, admin user and nil error details, or http status and error details if request couldn't be processed
+ */
+func (wCtx *WebApiContext) prepareAdminRequest(request *http.Request, operation string, roles ...data.AdminRole) (*data.Realm, *adminUser,
+	int, *dto.ErrorDetails,
+) {
+	realm := mux.Vars(request)[globals.RealmPathVar]
+	if !Validate(realm) {
+		wCtx.Logger.Debug(sf.Format("{0}: is invalid realmName: '{1}'", operation, realm))
+		return nil, nil, http.StatusBadRequest, &dto.ErrorDetails{Msg: sf.Format(errors.InvalidRealm, realm)}
+	}
+	admin, status, errDetails := wCtx.checkAdminAccess(request, operation, realm, roles...)
+	if errDetails != nil {
+		return nil, nil, status, errDetails
+	}
+	realmPtr, status, errDetails := wCtx.getRealm(request.Context(), realm, operation)
+	return realmPtr, admin, status, errDetails
+}
+
+// checkAdminAccess checks that request has Authorization header with valid (active and not revoked) admin access token
+/* Access token must be issued by master realm or by administered realm (realm admin), token user must have any of roles
+ * for the administered realm (see data.HasAdminRole)
+ * Parameters:
+ *     - request - http request
+ *     - operation - operation name for logging
+ *     - realm - administered realm name or data.AllRealms
+ *     - roles - admin roles that grant access to operation (any of them)
+ * Returns: admin user and nil error details if access is granted, otherwise http status (401 or 403) and error details
+ */
+func (wCtx *WebApiContext) checkAdminAccess(request *http.Request, operation string, realm string, roles ...data.AdminRole) (*adminUser,
+	int, *dto.ErrorDetails,
+) {
+	unauthorized := &dto.ErrorDetails{Msg: errors.InvalidTokenMsg, Description: errors.AdminAccessRequiredDesc}
+	parts := strings.Split(request.Header.Get(authorizationHeader), " ")
+	if parts[0] != string(BearerToken) || len(parts) < 2 {
+		wCtx.Logger.Debug(sf.Format("{0}: admin access token not provided", operation))
+		return nil, http.StatusUnauthorized, unauthorized
+	}
+	tokenRealms := []string{globals.MasterRealm}
+	if realm != globals.MasterRealm && realm != data.AllRealms {
+		tokenRealms = append(tokenRealms, realm)
+	}
+	for _, tokenRealm := range tokenRealms {
+		tokenRealmPtr, status, errDetails := wCtx.getRealm(request.Context(), tokenRealm, operation)
+		if errDetails != nil {
+			if status == http.StatusNotFound {
+				continue
+			}
+			return nil, status, errDetails
+		}
+		session := (*wCtx.Security).GetSessionByAccessToken(request.Context(), tokenRealmPtr.Name, &parts[1])
+		if session == nil {
+			continue
+		}
+		if session.Expired.Before(time.Now()) || isRevokedByNotBefore(tokenRealmPtr, session.LastActivity) {
+			break
+		}
+		user := (*wCtx.Security).GetCurrentUserById(request.Context(), tokenRealmPtr.Name, session.UserId)
+		if user == nil {
+			break
+		}
+		if !data.HasAdminRole(user, tokenRealmPtr.Name, realm, roles...) {
+			wCtx.Logger.Debug(sf.Format("{0}: user \"{1}\" of realm \"{2}\" doesn't have required admin role", operation,
+				user.GetUsername(), tokenRealmPtr.Name))
+			return nil, http.StatusForbidden, &dto.ErrorDetails{Msg: errors.AccessDeniedMsg, Description: sf.Format(
+				errors.AdminRoleRequiredTemplate, roles, realm)}
+		}
+		return &adminUser{user: user, realm: tokenRealmPtr.Name}, http.StatusOK, nil
+	}
+	wCtx.Logger.Debug(sf.Format("{0}: admin access token is not valid", operation))
+	return nil, http.StatusUnauthorized, unauthorized
+}
+
+// getRealm reads realm from data store and converts read error to http status and error details
+func (wCtx *WebApiContext) getRealm(ctx context.Context, realm string, operation string) (*data.Realm, int, *dto.ErrorDetails) {
+	realmPtr, realmReadErr := (*wCtx.DataProvider).GetRealm(ctx, realm)
+	if realmReadErr == nil {
+		return realmPtr, http.StatusOK, nil
+	}
+	var notAvailableErr errors.DataProviderNotAvailable
+	var notFoundErr errors.ObjectNotFoundError
+	if e.As(realmReadErr, &notAvailableErr) {
+		wCtx.Logger.Error("Data provider not available")
+		return nil, http.StatusServiceUnavailable, &dto.ErrorDetails{Msg: errors.ServiceIsUnavailable}
+	}
+	if e.As(realmReadErr, &notFoundErr) {
+		wCtx.Logger.Debug(sf.Format("{0}: realm \"{1}\" doesn't exist", operation, realm))
+		return nil, http.StatusNotFound, &dto.ErrorDetails{Msg: sf.Format(errors.RealmDoesNotExistsTemplate, realm)}
+	}
+	wCtx.Logger.Error(sf.Format("Other error occurred: {0}", realmReadErr.Error()))
+	return nil, http.StatusInternalServerError, &dto.ErrorDetails{Msg: sf.Format(errors.OtherAppError, realm)}
+}
+
+// getUserByIdOrName returns realm user by identifier (Keycloak admin API uses ids) or by username, nil if user doesn't exist
+func (wCtx *WebApiContext) getUserByIdOrName(ctx context.Context, realm string, idOrName string) data.User {
+	if userId, err := uuid.Parse(idOrName); err == nil {
+		if user := (*wCtx.Security).GetCurrentUserById(ctx, realm, userId); user != nil {
+			return user
+		}
+	}
+	return (*wCtx.Security).GetCurrentUserByName(ctx, realm, idOrName)
+}
+
+// getClientByNameOrId returns realm client by name or by identifier (Keycloak admin API uses ids), nil if client doesn't exist
+func (wCtx *WebApiContext) getClientByNameOrId(ctx context.Context, realm *data.Realm, nameOrId string) *data.Client {
+	if client, err := (*wCtx.DataProvider).GetClient(ctx, realm.Name, nameOrId); err == nil && client != nil {
+		return client
+	}
+	if clientId, err := uuid.Parse(nameOrId); err == nil {
+		for i := range realm.Clients {
+			if realm.Clients[i].ID == clientId {
+				return &realm.Clients[i]
+			}
+		}
+	}
+	return nil
+}
+
+// getSessionsRepresentation converts sessions to Keycloak compatible representation, usernames are taken from data store
+func (wCtx *WebApiContext) getSessionsRepresentation(ctx context.Context, realm string,
+	userSessions []data.UserSession,
+) []dto.UserSessionRepresentation {
+	usernames := map[uuid.UUID]string{}
+	result := make([]dto.UserSessionRepresentation, 0, len(userSessions))
+	for _, s := range userSessions {
+		username, ok := usernames[s.UserId]
+		if !ok {
+			if user := (*wCtx.Security).GetCurrentUserById(ctx, realm, s.UserId); user != nil {
+				username = user.GetUsername()
+			}
+			usernames[s.UserId] = username
+		}
+		result = append(result, dto.CreateUserSessionRepresentation(&s, username))
+	}
+	return result
+}
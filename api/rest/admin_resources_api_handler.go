@@ -0,0 +1,1222 @@
+package rest
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	e "errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/wissance/Ferrum/data"
+	"github.com/wissance/Ferrum/dto"
+	"github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/globals"
+	"github.com/wissance/Ferrum/utils/encoding"
+	sf "github.com/wissance/stringFormatter"
+)
+
+const (
+	clientSecretLength  = 32
+	clientSecretSymbols = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	defaultMaxResults   = 100
+	attributesField     = "attributes"
+	secretCredential    = "secret"
+	eTagHeader          = "ETag"
+	ifMatchHeader       = "If-Match"
+)
+
+// CreateRealm this function is a Http Request Handler that is responsible for a new realm creation
+// @Summary Creates realm
+// @Description Creates realm with clients and users from Keycloak realm representation, requires writable data store and access
+// @Description token of a master realm administrator with manage-realm role for all realms ("*")
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param function body dto.RealmRepresentation true "Realm"
+// @Success 201
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 409 {string} dto.ErrorDetails
+// @Failure 501 {string} dto.ErrorDetails
+// @Router /auth/admin/realms [post]
+// @Router /admin/realms [post]
+func (wCtx *WebApiContext) CreateRealm(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	operation := "Create realm"
+	admin, status, errDetails := wCtx.checkAdminAccess(request, operation, data.AllRealms, data.ManageRealm)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	rep := dto.RealmRepresentation{}
+	realm := data.Realm{}
+	err := readRepresentation(request, &rep, nil)
+	if err == nil {
+		err = rep.ApplyTo(&realm)
+	}
+	if err == nil && !Validate(realm.Name) {
+		err = e.New(sf.Format("realm name \"{0}\" is invalid", realm.Name))
+	}
+	for i := 0; err == nil && i < len(rep.Clients); i++ {
+		var client data.Client
+		if client, err = rep.Clients[i].ToClient(); err == nil {
+			realm.Clients = append(realm.Clients, withClientSecret(client))
+		}
+	}
+	for i := 0; err == nil && i < len(rep.Users); i++ {
+		var user data.User
+		// passwords are hashed by data store during realm creation
+		if user, err = rep.Users[i].ToUser(nil, nil); err == nil {
+			realm.Users = append(realm.Users, user.GetRawData())
+		}
+	}
+	if err != nil {
+		wCtx.badRepresentation(&respWriter, operation, err)
+		return
+	}
+	if err = (*wCtx.DataProvider).CreateRealm(admin.withAuthor(request.Context()), realm); err != nil {
+		status, errDetails := wCtx.getDataErrorDetails(err, operation, "Realm", realm.Name)
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	setLocation(&respWriter, request, realm.Name)
+	afterHandle(&respWriter, http.StatusCreated, nil)
+}
+
+// GetRealmRepresentation this function is a Http Request Handler that is responsible for getting realm settings
+// @Summary Getting realm
+// @Description Getting Keycloak realm representation (without clients and users), requires access token of an administrator with view-realm role
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Success 200 {object} dto.RealmRepresentation
+// @Header 200 {string} ETag "Realm version"
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm} [get]
+// @Router /admin/realms/{realm} [get]
+func (wCtx *WebApiContext) GetRealmRepresentation(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	realmPtr, _, status, errDetails := wCtx.prepareAdminRequest(request, "Get realm", data.ViewRealm)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	result := dto.CreateRealmRepresentation(realmPtr)
+	setVersionTag(&respWriter, realmPtr.Version)
+	afterHandle(&respWriter, http.StatusOK, &result)
+}
+
+// UpdateRealm this function is a Http Request Handler that is responsible for realm settings update
+// @Summary Updates realm
+// @Description Updates realm settings, fields that are absent in body remain unchanged, realm can't be renamed, requires writable data
+// @Description store and access token of an administrator with manage-realm role. If If-Match header is set realm is updated
+// @Description only if it was not changed since it was read (If-Match must be ETag of GET response)
+// @Tags admin
+// @Accept json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param If-Match header string false "Realm version (ETag)"
+// @Param realm path string true "Realm"
+// @Param function body dto.RealmRepresentation true "Realm"
+// @Success 204
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Failure 412 {string} dto.ErrorDetails
+// @Failure 501 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm} [put]
+// @Router /admin/realms/{realm} [put]
+func (wCtx *WebApiContext) UpdateRealm(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	operation := "Update realm"
+	realmPtr, admin, status, errDetails := wCtx.prepareAdminRequest(request, operation, data.ManageRealm)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	expectedVersion, err := getExpectedVersion(request)
+	if err != nil {
+		wCtx.badVersionTag(&respWriter, operation, err)
+		return
+	}
+	realmName := realmPtr.Name
+	rep := dto.CreateRealmRepresentation(realmPtr)
+	err = readRepresentation(request, &rep, nil)
+	if err == nil {
+		err = rep.ApplyTo(realmPtr)
+	}
+	if err != nil {
+		wCtx.badRepresentation(&respWriter, operation, err)
+		return
+	}
+	realmPtr.Version = expectedVersion
+	if realmPtr.Name != realmName {
+		result := dto.ErrorDetails{Msg: errors.RealmRenameNotSupportedMsg}
+		afterHandle(&respWriter, http.StatusBadRequest, &result)
+		return
+	}
+	if err = (*wCtx.DataProvider).UpdateRealm(admin.withAuthor(request.Context()), realmName, *realmPtr); err != nil {
+		status, errDetails = wCtx.getDataErrorDetails(err, operation, "Realm", realmName)
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	afterHandle(&respWriter, http.StatusNoContent, nil)
+}
+
+// DeleteRealm this function is a Http Request Handler that is responsible for realm removal
+// @Summary Deletes realm
+// @Description Deletes realm with all its clients, users and active sessions, master realm can't be deleted, requires writable data
+// @Description store and access token of an administrator with manage-realm role
+// @Tags admin
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Success 204
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Failure 501 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm} [delete]
+// @Router /admin/realms/{realm} [delete]
+func (wCtx *WebApiContext) DeleteRealm(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	operation := "Delete realm"
+	realmPtr, _, status, errDetails := wCtx.prepareAdminRequest(request, operation, data.ManageRealm)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	if realmPtr.Name == globals.MasterRealm {
+		result := dto.ErrorDetails{Msg: errors.MasterRealmDeleteMsg}
+		afterHandle(&respWriter, http.StatusBadRequest, &result)
+		return
+	}
+	if err := (*wCtx.DataProvider).DeleteRealm(request.Context(), realmPtr.Name); err != nil {
+		status, errDetails = wCtx.getDataErrorDetails(err, operation, "Realm", realmPtr.Name)
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	(*wCtx.Security).TerminateRealmSessions(request.Context(), realmPtr.Name)
+	afterHandle(&respWriter, http.StatusNoContent, nil)
+}
+
+// GetClients this function is a Http Request Handler that is responsible for getting realm clients
+// @Summary Getting realm clients
+// @Description Getting realm clients (optionally filtered by clientId), requires access token of an administrator with view-clients role
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Param clientId query string false "Client name"
+// @Success 200 {array} dto.ClientRepresentation
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/clients [get]
+// @Router /admin/realms/{realm}/clients [get]
+func (wCtx *WebApiContext) GetClients(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	operation := "Get clients"
+	realmPtr, _, status, errDetails := wCtx.prepareAdminRequest(request, operation, data.ViewClients)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	clients, err := (*wCtx.DataProvider).GetClients(request.Context(), realmPtr.Name)
+	if err != nil && !e.Is(err, errors.ErrZeroLength) {
+		status, errDetails = wCtx.getDataErrorDetails(err, operation, "Realm", realmPtr.Name)
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	clientId := request.URL.Query().Get("clientId")
+	result := make([]dto.ClientRepresentation, 0, len(clients))
+	for i := range clients {
+		if len(clientId) == 0 || clients[i].Name == clientId {
+			result = append(result, dto.CreateClientRepresentation(&clients[i]))
+		}
+	}
+	afterHandle(&respWriter, http.StatusOK, &result)
+}
+
+// GetClient this function is a Http Request Handler that is responsible for getting realm client
+// @Summary Getting realm client
+// @Description Getting realm client by id or name, requires access token of an administrator with view-clients role
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Param id path string true "Client id or name"
+// @Success 200 {object} dto.ClientRepresentation
+// @Header 200 {string} ETag "Client version"
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/clients/{id} [get]
+// @Router /admin/realms/{realm}/clients/{id} [get]
+func (wCtx *WebApiContext) GetClient(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	client, _, _, status, errDetails := wCtx.prepareClientRequest(request, "Get client", data.ViewClients)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	result := dto.CreateClientRepresentation(client)
+	setVersionTag(&respWriter, client.Version)
+	afterHandle(&respWriter, http.StatusOK, &result)
+}
+
+// CreateClient this function is a Http Request Handler that is responsible for a new realm client creation
+// @Summary Creates realm client
+// @Description Creates realm client, secret is generated for confidential client without secret, requires writable data store and
+// @Description access token of an administrator with manage-clients role
+// @Tags admin
+// @Accept json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Param function body dto.ClientRepresentation true "Client"
+// @Success 201
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Failure 409 {string} dto.ErrorDetails
+// @Failure 501 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/clients [post]
+// @Router /admin/realms/{realm}/clients [post]
+func (wCtx *WebApiContext) CreateClient(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	operation := "Create client"
+	realmPtr, admin, status, errDetails := wCtx.prepareAdminRequest(request, operation, data.ManageClients)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	rep := dto.ClientRepresentation{}
+	var client data.Client
+	err := readRepresentation(request, &rep, nil)
+	if err == nil {
+		client, err = rep.ToClient()
+	}
+	if err != nil {
+		wCtx.badRepresentation(&respWriter, operation, err)
+		return
+	}
+	if wCtx.getClientByNameOrId(request.Context(), realmPtr, client.ID.String()) != nil {
+		status, errDetails = wCtx.getDataErrorDetails(errors.ErrExists, operation, "Client", client.ID.String())
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	client = withClientSecret(client)
+	if err = (*wCtx.DataProvider).CreateClient(admin.withAuthor(request.Context()), realmPtr.Name, client); err != nil {
+		status, errDetails = wCtx.getDataErrorDetails(err, operation, "Client", client.Name)
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	setLocation(&respWriter, request, client.ID.String())
+	afterHandle(&respWriter, http.StatusCreated, nil)
+}
+
+// UpdateClient this function is a Http Request Handler that is responsible for realm client update
+// @Summary Updates realm client
+// @Description Updates realm client, fields that are absent in body remain unchanged, client id can't be changed, requires writable
+// @Description data store and access token of an administrator with manage-clients role. If If-Match header is set client is
+// @Description updated only if it was not changed since it was read (If-Match must be ETag of GET response)
+// @Tags admin
+// @Accept json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param If-Match header string false "Client version (ETag)"
+// @Param realm path string true "Realm"
+// @Param id path string true "Client id or name"
+// @Param function body dto.ClientRepresentation true "Client"
+// @Success 204
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Failure 409 {string} dto.ErrorDetails
+// @Failure 412 {string} dto.ErrorDetails
+// @Failure 501 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/clients/{id} [put]
+// @Router /admin/realms/{realm}/clients/{id} [put]
+func (wCtx *WebApiContext) UpdateClient(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	operation := "Update client"
+	oldClient, realmPtr, admin, status, errDetails := wCtx.prepareClientRequest(request, operation, data.ManageClients)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	expectedVersion, err := getExpectedVersion(request)
+	if err != nil {
+		wCtx.badVersionTag(&respWriter, operation, err)
+		return
+	}
+	rep := dto.CreateClientRepresentation(oldClient)
+	var client data.Client
+	err = readRepresentation(request, &rep, func() { rep.Attributes = nil })
+	if err == nil {
+		rep.Id = oldClient.ID.String()
+		client, err = rep.ToClient()
+	}
+	if err != nil {
+		wCtx.badRepresentation(&respWriter, operation, err)
+		return
+	}
+	client.Version = expectedVersion
+	if client.Name != oldClient.Name {
+		if existing, _ := (*wCtx.DataProvider).GetClient(request.Context(), realmPtr.Name, client.Name); existing != nil {
+			status, errDetails = wCtx.getDataErrorDetails(errors.ErrExists, operation, "Client", client.Name)
+			afterHandle(&respWriter, status, errDetails)
+			return
+		}
+	}
+	if err = (*wCtx.DataProvider).UpdateClient(admin.withAuthor(request.Context()), realmPtr.Name, oldClient.Name, withClientSecret(client)); err != nil {
+		status, errDetails = wCtx.getDataErrorDetails(err, operation, "Client", oldClient.Name)
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	afterHandle(&respWriter, http.StatusNoContent, nil)
+}
+
+// DeleteClient this function is a Http Request Handler that is responsible for realm client removal
+// @Summary Deletes realm client
+// @Description Deletes realm client, requires writable data store and access token of an administrator with manage-clients role
+// @Tags admin
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Param id path string true "Client id or name"
+// @Success 204
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Failure 501 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/clients/{id} [delete]
+// @Router /admin/realms/{realm}/clients/{id} [delete]
+func (wCtx *WebApiContext) DeleteClient(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	operation := "Delete client"
+	client, realmPtr, _, status, errDetails := wCtx.prepareClientRequest(request, operation, data.ManageClients)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	if err := (*wCtx.DataProvider).DeleteClient(request.Context(), realmPtr.Name, client.Name); err != nil {
+		status, errDetails = wCtx.getDataErrorDetails(err, operation, "Client", client.Name)
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	afterHandle(&respWriter, http.StatusNoContent, nil)
+}
+
+// GetClientSecret this function is a Http Request Handler that is responsible for getting confidential client secret
+// @Summary Getting client secret
+// @Description Getting confidential client secret, requires access token of an administrator with view-clients role
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Param id path string true "Client id or name"
+// @Success 200 {object} dto.CredentialRepresentation
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/clients/{id}/client-secret [get]
+// @Router /admin/realms/{realm}/clients/{id}/client-secret [get]
+func (wCtx *WebApiContext) GetClientSecret(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	client, _, _, status, errDetails := wCtx.prepareClientRequest(request, "Get client secret", data.ViewClients)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	if client.Type == data.Public {
+		result := dto.ErrorDetails{Msg: errors.PublicClientHasNoSecretMsg}
+		afterHandle(&respWriter, http.StatusBadRequest, &result)
+		return
+	}
+	result := dto.CredentialRepresentation{Type: secretCredential, Value: client.Auth.Value}
+	afterHandle(&respWriter, http.StatusOK, &result)
+}
+
+// RegenerateClientSecret this function is a Http Request Handler that is responsible for confidential client secret regeneration
+// @Summary Regenerates client secret
+// @Description Generates new confidential client secret, requires writable data store and access token of an administrator with manage-clients role
+// @Description (If-Match header is checked as by client update)
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param If-Match header string false "Client version (ETag)"
+// @Param realm path string true "Realm"
+// @Param id path string true "Client id or name"
+// @Success 200 {object} dto.CredentialRepresentation
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Failure 501 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/clients/{id}/client-secret [post]
+// @Router /admin/realms/{realm}/clients/{id}/client-secret [post]
+func (wCtx *WebApiContext) RegenerateClientSecret(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	operation := "Regenerate client secret"
+	client, realmPtr, admin, status, errDetails := wCtx.prepareClientRequest(request, operation, data.ManageClients)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	if client.Type == data.Public {
+		result := dto.ErrorDetails{Msg: errors.PublicClientHasNoSecretMsg}
+		afterHandle(&respWriter, http.StatusBadRequest, &result)
+		return
+	}
+	expectedVersion, err := getExpectedVersion(request)
+	if err != nil {
+		wCtx.badVersionTag(&respWriter, operation, err)
+		return
+	}
+	newClient := *client
+	newClient.Version = expectedVersion
+	newClient.Auth = data.Authentication{Type: data.ClientIdAndSecrets}
+	newClient = withClientSecret(newClient)
+	if err = (*wCtx.DataProvider).UpdateClient(admin.withAuthor(request.Context()), realmPtr.Name, client.Name, newClient); err != nil {
+		status, errDetails = wCtx.getDataErrorDetails(err, operation, "Client", client.Name)
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	result := dto.CredentialRepresentation{Type: secretCredential, Value: newClient.Auth.Value}
+	afterHandle(&respWriter, http.StatusOK, &result)
+}
+
+// GetUsers this function is a Http Request Handler that is responsible for realm users search
+// @Summary Getting realm users
+// @Description Getting realm users filtered by username, email, firstName, lastName (substring match unless exact=true) or search
+// @Description (substring of any of them) with first/max paging, requires access token of an administrator with view-users role
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Success 200 {array} dto.UserRepresentation
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/users [get]
+// @Router /admin/realms/{realm}/users [get]
+func (wCtx *WebApiContext) GetUsers(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	operation := "Get users"
+	users, status, errDetails := wCtx.findUsers(request, operation, data.ViewUsers)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	query := request.URL.Query()
+	first, firstErr := getIntQueryValue(query, "first", 0)
+	maxResults, maxErr := getIntQueryValue(query, "max", defaultMaxResults)
+	if firstErr != nil || maxErr != nil {
+		wCtx.badRepresentation(&respWriter, operation, e.Join(firstErr, maxErr))
+		return
+	}
+	result := users[min(first, len(users)):min(first+maxResults, len(users))]
+	afterHandle(&respWriter, http.StatusOK, &result)
+}
+
+// GetUsersCount this function is a Http Request Handler that is responsible for realm users count
+// @Summary Getting realm users count
+// @Description Getting number of realm users with same filters as users search, requires access token of an administrator with view-users role
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Success 200 {integer} integer
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/users/count [get]
+// @Router /admin/realms/{realm}/users/count [get]
+func (wCtx *WebApiContext) GetUsersCount(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	users, status, errDetails := wCtx.findUsers(request, "Get users count", data.ViewUsers)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	result := len(users)
+	afterHandle(&respWriter, http.StatusOK, &result)
+}
+
+// GetUser this function is a Http Request Handler that is responsible for getting realm user
+// @Summary Getting realm user
+// @Description Getting realm user by id or username, requires access token of an administrator with view-users role
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Param id path string true "User id or username"
+// @Success 200 {object} dto.UserRepresentation
+// @Header 200 {string} ETag "User version"
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/users/{id} [get]
+// @Router /admin/realms/{realm}/users/{id} [get]
+func (wCtx *WebApiContext) GetUser(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	user, _, status, errDetails := wCtx.prepareUserRequest(request, "Get user", data.ViewUsers)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	result := dto.CreateUserRepresentation(user)
+	setVersionTag(&respWriter, user.GetVersion())
+	afterHandle(&respWriter, http.StatusOK, &result)
+}
+
+// CreateUser this function is a Http Request Handler that is responsible for a new realm user creation
+// @Summary Creates realm user
+// @Description Creates realm user, password credential is hashed before saving, requires writable data store and access token
+// @Description of an administrator with manage-users role
+// @Tags admin
+// @Accept json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Param function body dto.UserRepresentation true "User"
+// @Success 201
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Failure 409 {string} dto.ErrorDetails
+// @Failure 501 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/users [post]
+// @Router /admin/realms/{realm}/users [post]
+func (wCtx *WebApiContext) CreateUser(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	operation := "Create user"
+	realmPtr, _, status, errDetails := wCtx.prepareAdminRequest(request, operation, data.ManageUsers)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	rep := dto.UserRepresentation{}
+	var user data.User
+	err := readRepresentation(request, &rep, nil)
+	if err == nil {
+		user, err = rep.ToUser(nil, getRealmEncoder(realmPtr))
+	}
+	if err != nil {
+		wCtx.badRepresentation(&respWriter, operation, err)
+		return
+	}
+	if (*wCtx.Security).GetCurrentUserById(request.Context(), realmPtr.Name, user.GetId()) != nil {
+		status, errDetails = wCtx.getDataErrorDetails(errors.ErrExists, operation, "User", user.GetId().String())
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	if err = (*wCtx.DataProvider).CreateUser(request.Context(), realmPtr.Name, user); err != nil {
+		status, errDetails = wCtx.getDataErrorDetails(err, operation, "User", user.GetUsername())
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	setLocation(&respWriter, request, user.GetId().String())
+	afterHandle(&respWriter, http.StatusCreated, nil)
+}
+
+// UpdateUser this function is a Http Request Handler that is responsible for realm user update
+// @Summary Updates realm user
+// @Description Updates realm user, fields that are absent in body remain unchanged, attributes are replaced if present, password
+// @Description is changed only if body has password credential, user id can't be changed, requires writable data store and
+// @Description access token of an administrator with manage-users role. If If-Match header is set user is updated only if it was
+// @Description not changed since it was read (If-Match must be ETag of GET response)
+// @Tags admin
+// @Accept json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param If-Match header string false "User version (ETag)"
+// @Param realm path string true "Realm"
+// @Param id path string true "User id or username"
+// @Param function body dto.UserRepresentation true "User"
+// @Success 204
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Failure 409 {string} dto.ErrorDetails
+// @Failure 412 {string} dto.ErrorDetails
+// @Failure 501 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/users/{id} [put]
+// @Router /admin/realms/{realm}/users/{id} [put]
+func (wCtx *WebApiContext) UpdateUser(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	operation := "Update user"
+	oldUser, realmPtr, status, errDetails := wCtx.prepareUserRequest(request, operation, data.ManageUsers)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	expectedVersion, err := getExpectedVersion(request)
+	if err != nil {
+		wCtx.badVersionTag(&respWriter, operation, err)
+		return
+	}
+	rep := dto.CreateUserRepresentation(oldUser)
+	var user data.User
+	err = readRepresentation(request, &rep, func() { rep.Attributes = nil })
+	if err == nil {
+		rep.Id = oldUser.GetId().String()
+		user, err = rep.ToUser(oldUser, getRealmEncoder(realmPtr))
+	}
+	if err != nil {
+		wCtx.badRepresentation(&respWriter, operation, err)
+		return
+	}
+	user.SetVersion(expectedVersion)
+	if user.GetUsername() != oldUser.GetUsername() && (*wCtx.Security).GetCurrentUserByName(request.Context(), realmPtr.Name, user.GetUsername()) != nil {
+		status, errDetails = wCtx.getDataErrorDetails(errors.ErrExists, operation, "User", user.GetUsername())
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	if err = (*wCtx.DataProvider).UpdateUser(request.Context(), realmPtr.Name, oldUser.GetUsername(), user); err != nil {
+		status, errDetails = wCtx.getDataErrorDetails(err, operation, "User", oldUser.GetUsername())
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	afterHandle(&respWriter, http.StatusNoContent, nil)
+}
+
+// DeleteUser this function is a Http Request Handler that is responsible for realm user removal
+// @Summary Deletes realm user
+// @Description Deletes realm user and terminates all user sessions, requires writable data store and access token of an administrator with manage-users role
+// @Tags admin
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Param id path string true "User id or username"
+// @Success 204
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Failure 501 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/users/{id} [delete]
+// @Router /admin/realms/{realm}/users/{id} [delete]
+func (wCtx *WebApiContext) DeleteUser(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	operation := "Delete user"
+	user, realmPtr, status, errDetails := wCtx.prepareUserRequest(request, operation, data.ManageUsers)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	if err := (*wCtx.DataProvider).DeleteUser(request.Context(), realmPtr.Name, user.GetUsername()); err != nil {
+		status, errDetails = wCtx.getDataErrorDetails(err, operation, "User", user.GetUsername())
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	(*wCtx.Security).TerminateUserSessions(request.Context(), realmPtr.Name, user.GetId())
+	afterHandle(&respWriter, http.StatusNoContent, nil)
+}
+
+// ResetUserPassword this function is a Http Request Handler that is responsible for setting user password
+// @Summary Sets user password
+// @Description Sets user password from password credential (temporary passwords are not supported and are set as permanent),
+// @Description requires writable data store and access token of an administrator with manage-users role (If-Match header is
+// @Description checked as by user update)
+// @Tags admin
+// @Accept json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param If-Match header string false "User version (ETag)"
+// @Param realm path string true "Realm"
+// @Param id path string true "User id or username"
+// @Param function body dto.CredentialRepresentation true "Password credential"
+// @Success 204
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Failure 501 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/users/{id}/reset-password [put]
+// @Router /admin/realms/{realm}/users/{id}/reset-password [put]
+func (wCtx *WebApiContext) ResetUserPassword(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	operation := "Reset user password"
+	oldUser, realmPtr, status, errDetails := wCtx.prepareUserRequest(request, operation, data.ManageUsers)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	expectedVersion, err := getExpectedVersion(request)
+	if err != nil {
+		wCtx.badVersionTag(&respWriter, operation, err)
+		return
+	}
+	credential := dto.CredentialRepresentation{Type: dto.PasswordCredentialType}
+	err = readRepresentation(request, &credential, nil)
+	if err == nil && (credential.Type != dto.PasswordCredentialType || len(credential.Value) == 0) {
+		err = e.New("password credential with non-empty value is required")
+	}
+	var rawData interface{}
+	if err == nil {
+		// user data is copied because data store could return shared user object
+		err = json.Unmarshal([]byte(oldUser.GetJsonString()), &rawData)
+	}
+	if err != nil {
+		wCtx.badRepresentation(&respWriter, operation, err)
+		return
+	}
+	user := data.CreateUser(rawData, nil)
+	user.SetVersion(expectedVersion)
+	if err = user.SetPassword(credential.Value, getRealmEncoder(realmPtr)); err == nil {
+		err = (*wCtx.DataProvider).UpdateUser(request.Context(), realmPtr.Name, oldUser.GetUsername(), user)
+	}
+	if err != nil {
+		status, errDetails = wCtx.getDataErrorDetails(err, operation, "User", oldUser.GetUsername())
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	afterHandle(&respWriter, http.StatusNoContent, nil)
+}
+
+// GetComponents this function is a Http Request Handler that is responsible for getting realm user federation configs
+// @Summary Getting realm user federation components
+// @Description Getting realm user federation configs as Keycloak components (optionally filtered by type and name),
+// @Description requires access token of an administrator with view-realm or manage-federation role
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Param type query string false "Component type"
+// @Param name query string false "Component name"
+// @Success 200 {array} dto.ComponentRepresentation
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Failure 501 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/components [get]
+// @Router /admin/realms/{realm}/components [get]
+func (wCtx *WebApiContext) GetComponents(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	operation := "Get components"
+	realmPtr, _, status, errDetails := wCtx.prepareAdminRequest(request, operation, data.ViewRealm, data.ManageFederation)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	configs, err := (*wCtx.DataProvider).GetUserFederationConfigs(request.Context(), realmPtr.Name)
+	if err != nil && !e.Is(err, errors.ErrZeroLength) {
+		status, errDetails = wCtx.getDataErrorDetails(err, operation, "Realm", realmPtr.Name)
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	query := request.URL.Query()
+	componentType := query.Get("type")
+	name := query.Get("name")
+	result := make([]dto.ComponentRepresentation, 0, len(configs))
+	for i := range configs {
+		if (len(componentType) == 0 || componentType == dto.UserStorageProviderType) && (len(name) == 0 || configs[i].Name == name) {
+			result = append(result, dto.CreateComponentRepresentation(realmPtr.Name, &configs[i]))
+		}
+	}
+	afterHandle(&respWriter, http.StatusOK, &result)
+}
+
+// GetComponent this function is a Http Request Handler that is responsible for getting realm user federation config
+// @Summary Getting realm user federation component
+// @Description Getting realm user federation config as Keycloak component, requires access token of an administrator with view-realm or manage-federation role
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Param id path string true "Component id (config name)"
+// @Success 200 {object} dto.ComponentRepresentation
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Failure 501 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/components/{id} [get]
+// @Router /admin/realms/{realm}/components/{id} [get]
+func (wCtx *WebApiContext) GetComponent(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	cfg, realmPtr, status, errDetails := wCtx.prepareComponentRequest(request, "Get component", data.ViewRealm, data.ManageFederation)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	result := dto.CreateComponentRepresentation(realmPtr.Name, cfg)
+	afterHandle(&respWriter, http.StatusOK, &result)
+}
+
+// CreateComponent this function is a Http Request Handler that is responsible for a new realm user federation config creation
+// @Summary Creates realm user federation component
+// @Description Creates realm user federation config (ldap or freeipa) from Keycloak component, requires writable data store and
+// @Description access token of an administrator with manage-federation role
+// @Tags admin
+// @Accept json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Param function body dto.ComponentRepresentation true "Component"
+// @Success 201
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Failure 409 {string} dto.ErrorDetails
+// @Failure 501 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/components [post]
+// @Router /admin/realms/{realm}/components [post]
+func (wCtx *WebApiContext) CreateComponent(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	operation := "Create component"
+	realmPtr, _, status, errDetails := wCtx.prepareAdminRequest(request, operation, data.ManageFederation)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	rep := dto.ComponentRepresentation{}
+	var cfg data.UserFederationServiceConfig
+	err := readRepresentation(request, &rep, nil)
+	if err == nil {
+		cfg, err = rep.ToUserFederationConfig(nil)
+	}
+	if err != nil {
+		wCtx.badRepresentation(&respWriter, operation, err)
+		return
+	}
+	if err = (*wCtx.DataProvider).CreateUserFederationConfig(request.Context(), realmPtr.Name, cfg); err != nil {
+		status, errDetails = wCtx.getDataErrorDetails(err, operation, "Component", cfg.Name)
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	setLocation(&respWriter, request, cfg.Name)
+	afterHandle(&respWriter, http.StatusCreated, nil)
+}
+
+// UpdateComponent this function is a Http Request Handler that is responsible for realm user federation config update
+// @Summary Updates realm user federation component
+// @Description Updates realm user federation config, fields that are absent in body remain unchanged, component can't be renamed,
+// @Description masked bindCredential keeps current value, requires writable data store and access token of an administrator with manage-federation role
+// @Tags admin
+// @Accept json
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Param id path string true "Component id (config name)"
+// @Param function body dto.ComponentRepresentation true "Component"
+// @Success 204
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Failure 501 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/components/{id} [put]
+// @Router /admin/realms/{realm}/components/{id} [put]
+func (wCtx *WebApiContext) UpdateComponent(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	operation := "Update component"
+	oldCfg, realmPtr, status, errDetails := wCtx.prepareComponentRequest(request, operation, data.ManageFederation)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	rep := dto.CreateComponentRepresentation(realmPtr.Name, oldCfg)
+	var cfg data.UserFederationServiceConfig
+	err := readRepresentation(request, &rep, nil)
+	if err == nil {
+		rep.Name = oldCfg.Name
+		cfg, err = rep.ToUserFederationConfig(oldCfg)
+	}
+	if err != nil {
+		wCtx.badRepresentation(&respWriter, operation, err)
+		return
+	}
+	if err = (*wCtx.DataProvider).UpdateUserFederationConfig(request.Context(), realmPtr.Name, oldCfg.Name, cfg); err != nil {
+		status, errDetails = wCtx.getDataErrorDetails(err, operation, "Component", oldCfg.Name)
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	afterHandle(&respWriter, http.StatusNoContent, nil)
+}
+
+// DeleteComponent this function is a Http Request Handler that is responsible for realm user federation config removal
+// @Summary Deletes realm user federation component
+// @Description Deletes realm user federation config, requires writable data store and access token of an administrator with manage-federation role
+// @Tags admin
+// @Param Authorization header string true "Bearer TOKEN"
+// @Param realm path string true "Realm"
+// @Param id path string true "Component id (config name)"
+// @Success 204
+// @Failure 400 {string} dto.ErrorDetails
+// @Failure 401 {string} dto.ErrorDetails
+// @Failure 403 {string} dto.ErrorDetails
+// @Failure 404 {string} dto.ErrorDetails
+// @Failure 501 {string} dto.ErrorDetails
+// @Router /auth/admin/realms/{realm}/components/{id} [delete]
+// @Router /admin/realms/{realm}/components/{id} [delete]
+func (wCtx *WebApiContext) DeleteComponent(respWriter http.ResponseWriter, request *http.Request) {
+	beforeHandle(&respWriter)
+	operation := "Delete component"
+	cfg, realmPtr, status, errDetails := wCtx.prepareComponentRequest(request, operation, data.ManageFederation)
+	if errDetails != nil {
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	if err := (*wCtx.DataProvider).DeleteUserFederationConfig(request.Context(), realmPtr.Name, cfg.Name); err != nil {
+		status, errDetails = wCtx.getDataErrorDetails(err, operation, "Component", cfg.Name)
+		afterHandle(&respWriter, status, errDetails)
+		return
+	}
+	afterHandle(&respWriter, http.StatusNoContent, nil)
+}
+
+// prepareClientRequest checks admin access (any of roles) and reads realm and client (by id or name from path) from data store
+func (wCtx *WebApiContext) prepareClientRequest(request *http.Request, operation string, roles ...data.AdminRole) (*data.Client, *data.Realm,
+	*adminUser, int, *dto.ErrorDetails,
+) {
+	realmPtr, admin, status, errDetails := wCtx.prepareAdminRequest(request, operation, roles...)
+	if errDetails != nil {
+		return nil, nil, nil, status, errDetails
+	}
+	client := wCtx.getClientByNameOrId(request.Context(), realmPtr, mux.Vars(request)[globals.IdPathVar])
+	if client == nil {
+		return nil, nil, nil, http.StatusNotFound, &dto.ErrorDetails{Msg: sf.Format(errors.ClientDoesNotExistsTemplate, mux.Vars(request)[globals.IdPathVar])}
+	}
+	return client, realmPtr, admin, http.StatusOK, nil
+}
+
+// prepareUserRequest checks admin access (any of roles) and reads realm and user (by id or username from path) from data store
+/* Changing of user who has admin roles (roles contain data.ManageUsers) additionally requires permission to change admin roles
+ * (see data.CanChangeAdminRoles), otherwise user manager could take over administrator account.
+ */
+func (wCtx *WebApiContext) prepareUserRequest(request *http.Request, operation string, roles ...data.AdminRole) (data.User, *data.Realm,
+	int, *dto.ErrorDetails,
+) {
+	realmPtr, admin, status, errDetails := wCtx.prepareAdminRequest(request, operation, roles...)
+	if errDetails != nil {
+		return nil, nil, status, errDetails
+	}
+	user := wCtx.getUserByIdOrName(request.Context(), realmPtr.Name, mux.Vars(request)[globals.IdPathVar])
+	if user == nil {
+		return nil, nil, http.StatusNotFound, &dto.ErrorDetails{Msg: sf.Format(errors.UserDoesNotExistsTemplate, mux.Vars(request)[globals.IdPathVar])}
+	}
+	if slices.Contains(roles, data.ManageUsers) && len(user.GetAdminRoles()) > 0 &&
+		!data.CanChangeAdminRoles(admin.user, admin.realm, realmPtr.Name) {
+		wCtx.Logger.Debug(sf.Format("{0}: user \"{1}\" of realm \"{2}\" is not allowed to change administrator \"{3}\"", operation,
+			admin.user.GetUsername(), admin.realm, user.GetUsername()))
+		return nil, nil, http.StatusForbidden, &dto.ErrorDetails{Msg: errors.AccessDeniedMsg, Description: errors.AdminRolesChangeDeniedDesc}
+	}
+	return user, realmPtr, http.StatusOK, nil
+}
+
+// prepareComponentRequest checks admin access (any of roles) and reads realm and user federation config (by name from path) from data store
+func (wCtx *WebApiContext) prepareComponentRequest(request *http.Request, operation string, roles ...data.AdminRole) (*data.UserFederationServiceConfig,
+	*data.Realm, int, *dto.ErrorDetails,
+) {
+	realmPtr, _, status, errDetails := wCtx.prepareAdminRequest(request, operation, roles...)
+	if errDetails != nil {
+		return nil, nil, status, errDetails
+	}
+	name := mux.Vars(request)[globals.IdPathVar]
+	cfg, err := (*wCtx.DataProvider).GetUserFederationConfig(request.Context(), realmPtr.Name, name)
+	if (err == nil && cfg == nil) || e.Is(err, errors.ErrZeroLength) {
+		err = errors.NewObjectNotFoundError("Component", name, "")
+	}
+	if err != nil {
+		status, errDetails = wCtx.getDataErrorDetails(err, operation, "Component", name)
+		return nil, nil, status, errDetails
+	}
+	return cfg, realmPtr, http.StatusOK, nil
+}
+
+// findUsers checks admin access (any of roles) and returns realm users that match users search query parameters
+func (wCtx *WebApiContext) findUsers(request *http.Request, operation string, roles ...data.AdminRole) ([]dto.UserRepresentation, int,
+	*dto.ErrorDetails,
+) {
+	realmPtr, _, status, errDetails := wCtx.prepareAdminRequest(request, operation, roles...)
+	if errDetails != nil {
+		return nil, status, errDetails
+	}
+	users, err := (*wCtx.DataProvider).GetUsers(request.Context(), realmPtr.Name)
+	if err != nil && !e.Is(err, errors.ErrZeroLength) {
+		status, errDetails = wCtx.getDataErrorDetails(err, operation, "Realm", realmPtr.Name)
+		return nil, status, errDetails
+	}
+	query := request.URL.Query()
+	exact := query.Get("exact") == "true"
+	result := make([]dto.UserRepresentation, 0, len(users))
+	for _, u := range users {
+		rep := dto.CreateUserRepresentation(u)
+		matched := matchValue(rep.Username, query.Get("username"), exact) && matchValue(rep.Email, query.Get("email"), exact) &&
+			matchValue(rep.FirstName, query.Get("firstName"), exact) && matchValue(rep.LastName, query.Get("lastName"), exact)
+		if search := query.Get("search"); matched && len(search) > 0 {
+			matched = matchValue(rep.Username, search, false) || matchValue(rep.Email, search, false) ||
+				matchValue(rep.FirstName, search, false) || matchValue(rep.LastName, search, false)
+		}
+		if matched {
+			result = append(result, rep)
+		}
+	}
+	return result, http.StatusOK, nil
+}
+
+// getDataErrorDetails converts data store operation error to http status and error details
+/* Parameters:
+ *     - err - data store operation error
+ *     - operation - operation name for logging
+ *     - objectType - type of object that operation was performed on (for error message)
+ *     - objectId - identifier of object that operation was performed on (for error message)
+ * Returns: http status and error details
+ */
+func (wCtx *WebApiContext) getDataErrorDetails(err error, operation string, objectType string, objectId string) (int, *dto.ErrorDetails) {
+	var notAvailableErr errors.DataProviderNotAvailable
+	var notFoundErr errors.ObjectNotFoundError
+	var existsErr errors.ObjectAlreadyExistsError
+	var versionConflictErr errors.ObjectVersionConflictError
+	switch {
+	case e.As(err, &notAvailableErr):
+		wCtx.Logger.Error("Data provider not available")
+		return http.StatusServiceUnavailable, &dto.ErrorDetails{Msg: errors.ServiceIsUnavailable}
+	case e.As(err, &notFoundErr):
+		wCtx.Logger.Debug(sf.Format("{0}: {1}", operation, err.Error()))
+		return http.StatusNotFound, &dto.ErrorDetails{Msg: sf.Format(errors.ObjectDoesNotExistsTemplate, objectType, objectId)}
+	case e.As(err, &existsErr):
+		wCtx.Logger.Debug(sf.Format("{0}: {1} \"{2}\" already exists", operation, objectType, objectId))
+		return http.StatusConflict, &dto.ErrorDetails{Msg: sf.Format(errors.ObjectExistsTemplate, objectType, objectId)}
+	case e.As(err, &versionConflictErr):
+		wCtx.Logger.Debug(sf.Format("{0}: {1}", operation, err.Error()))
+		return http.StatusPreconditionFailed, &dto.ErrorDetails{Msg: errors.VersionConflictMsg, Description: err.Error()}
+	case e.Is(err, errors.ErrOperationNotImplemented) || e.Is(err, errors.ErrOperationNotSupported):
+		return http.StatusNotImplemented, &dto.ErrorDetails{Msg: errors.OperationNotSupportedMsg}
+	}
+	wCtx.Logger.Error(sf.Format("{0}: an error occurred: {1}", operation, err.Error()))
+	return http.StatusInternalServerError, &dto.ErrorDetails{Msg: sf.Format(errors.OtherAppError, objectId)}
+}
+
+// badRepresentation writes bad request response for invalid request body or query
+func (wCtx *WebApiContext) badRepresentation(respWriter *http.ResponseWriter, operation string, err error) {
+	wCtx.Logger.Debug(sf.Format("{0}: bad request: {1}", operation, err.Error()))
+	result := dto.ErrorDetails{Msg: errors.BadBodyMsg, Description: err.Error()}
+	afterHandle(respWriter, http.StatusBadRequest, &result)
+}
+
+// badVersionTag writes bad request response for invalid If-Match header
+func (wCtx *WebApiContext) badVersionTag(respWriter *http.ResponseWriter, operation string, err error) {
+	wCtx.Logger.Debug(sf.Format("{0}: bad request: {1}", operation, err.Error()))
+	result := dto.ErrorDetails{Msg: errors.InvalidIfMatchMsg, Description: err.Error()}
+	afterHandle(respWriter, http.StatusBadRequest, &result)
+}
+
+// setVersionTag sets ETag header to object version (see data.CheckVersion), client sends it back in If-Match header of update
+func setVersionTag(respWriter *http.ResponseWriter, version int64) {
+	(*respWriter).Header().Set(eTagHeader, strconv.Quote(strconv.FormatInt(version, 10)))
+}
+
+// getExpectedVersion returns object version from If-Match header (strong or weak ETag), absent header or "*" means
+// data.NoExpectedVersion (update regardless of stored object version)
+/* Parameters:
+ *     - request - http request
+ * Returns: expected version and error if header is not a single version ETag
+ */
+func getExpectedVersion(request *http.Request) (int64, error) {
+	value := strings.TrimSpace(request.Header.Get(ifMatchHeader))
+	if len(value) == 0 || value == "*" {
+		return data.NoExpectedVersion, nil
+	}
+	tag := strings.TrimPrefix(value, "W/")
+	if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+		return 0, e.New(sf.Format("ETag {0} must be a quoted string", value))
+	}
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil || version < 0 {
+		return 0, e.New(sf.Format("ETag {0} is not an object version", value))
+	}
+	return version, nil
+}
+
+// readRepresentation reads request body json over representation, fields that are absent in body keep their current values
+/* Parameters:
+ *     - request - http request
+ *     - representation - pointer to representation with current values
+ *     - resetAttributes - function that clears representation attributes, it is called if body has attributes
+ *       (attributes are replaced rather than merged), could be nil
+ * Returns: error if body is not a json object
+ */
+func readRepresentation(request *http.Request, representation interface{}, resetAttributes func()) error {
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		return err
+	}
+	fields := map[string]json.RawMessage{}
+	if err = json.Unmarshal(body, &fields); err != nil {
+		return err
+	}
+	if _, ok := fields[attributesField]; ok && resetAttributes != nil {
+		resetAttributes()
+	}
+	return json.Unmarshal(body, representation)
+}
+
+// setLocation sets Location header of a created object as Keycloak does
+func setLocation(respWriter *http.ResponseWriter, request *http.Request, id string) {
+	(*respWriter).Header().Set("Location", strings.TrimRight(request.URL.Path, "/")+"/"+url.PathEscape(id))
+}
+
+// withClientSecret returns client with generated secret if client is confidential and has no secret
+func withClientSecret(client data.Client) data.Client {
+	if client.Type != data.Confidential || len(client.Auth.Value) > 0 {
+		return client
+	}
+	secret := make([]byte, clientSecretLength)
+	for i := range secret {
+		index, _ := rand.Int(rand.Reader, big.NewInt(int64(len(clientSecretSymbols))))
+		secret[i] = clientSecretSymbols[index.Int64()]
+	}
+	client.Auth = data.Authentication{Type: data.ClientIdAndSecrets, Value: string(secret)}
+	return client
+}
+
+// getRealmEncoder returns realm password encoder, data stores that don't set realm encoder are using realm password salt
+func getRealmEncoder(realm *data.Realm) *encoding.PasswordJsonEncoder {
+	if realm.Encoder != nil {
+		return realm.Encoder
+	}
+	return encoding.NewPasswordJsonEncoder(realm.PasswordSalt)
+}
+
+func getIntQueryValue(query url.Values, key string, defaultValue int) (int, error) {
+	value := query.Get(key)
+	if len(value) == 0 {
+		return defaultValue, nil
+	}
+	intValue, err := strconv.Atoi(value)
+	if err == nil && intValue < 0 {
+		err = e.New(sf.Format("query parameter \"{0}\" must not be negative", key))
+	}
+	return intValue, err
+}
+
+func matchValue(value string, filter string, exact bool) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	if exact {
+		return value == filter
+	}
+	return strings.Contains(strings.ToLower(value), strings.ToLower(filter))
+}
@@ -14,6 +14,7 @@ type tokenType string
 const (
 	BearerToken  tokenType = "Bearer"
 	RefreshToken tokenType = "Refresh"
+	OfflineToken tokenType = "Offline"
 )
 
 // beforeHandle
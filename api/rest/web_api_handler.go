@@ -1,8 +1,10 @@
 package rest
 
 import (
+	"context"
 	"encoding/base64"
 	e "errors"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -51,7 +53,7 @@ func (wCtx *WebApiContext) IssueNewToken(respWriter http.ResponseWriter, request
 		afterHandle(&respWriter, status, &result)
 		return
 	}
-	realmPtr, realmReadErr := (*wCtx.DataProvider).GetRealm(realm)
+	realmPtr, realmReadErr := (*wCtx.DataProvider).GetRealm(request.Context(), realm)
 	if realmReadErr != nil {
 		if e.As(realmReadErr, &errors.ErrDataSourceNotAvailable) {
 			status = http.StatusServiceUnavailable
@@ -86,18 +88,69 @@ func (wCtx *WebApiContext) IssueNewToken(respWriter http.ResponseWriter, request
 			} else {
 				var currentUser data.User
 				var userId uuid.UUID
+				// sessionId is uuid.Nil for new login, on refresh it is id of session that refresh token belongs to
+				sessionId := uuid.Nil
+				// replacedRefreshToken is a refresh token of session on refresh, new tokens are assigned only if session still has it
+				replacedRefreshToken := ""
+				// offlineSession is not nil on refresh with offline token, offline token is issued on login with offline_access scope
+				var offlineSession *data.OfflineSession
+				isOfflineRequested := false
 				issueTokens := false
 				// 0. Check whether we deal with issuing a new token or refresh previous one
 				isRefresh := isTokenRefreshRequest(&tokenGenerationData)
 				if isRefresh {
 					// 1-2. Validate refresh token and check is it fresh enough
-					session := (*wCtx.Security).GetSessionByRefreshToken(realm, &tokenGenerationData.RefreshToken)
+					session := (*wCtx.Security).GetSessionByRefreshToken(request.Context(), realm, &tokenGenerationData.RefreshToken)
 					if session == nil {
-						status = http.StatusUnauthorized
+						// replaced refresh token is still valid if refresh token rotation is disabled
+						session = (*wCtx.Security).GetSessionByUsedRefreshToken(request.Context(), realmPtr, tokenGenerationData.ClientId,
+							&tokenGenerationData.RefreshToken)
+					}
+					if session == nil {
+						offlineSession = (*wCtx.Security).GetOfflineSessionByToken(request.Context(), realm, &tokenGenerationData.RefreshToken)
+					}
+					if offlineSession != nil {
+						if offlineSession.ClientId != tokenGenerationData.ClientId {
+							status = http.StatusBadRequest
+							wCtx.Logger.Debug("New token issue: offline token was issued to another client")
+							result = dto.ErrorDetails{Msg: errors.InvalidTokenMsg, Description: errors.TokenIssuedToAnotherClient}
+						} else if isRevokedByNotBefore(realmPtr, offlineSession.LastActivity) {
+							status = http.StatusBadRequest
+							wCtx.Logger.Debug("New token issue: offline token was revoked by realm not-before policy")
+							result = dto.ErrorDetails{Msg: errors.InvalidTokenMsg, Description: errors.TokenIsNotActive}
+						} else {
+							userId = offlineSession.UserId
+							currentUser = (*wCtx.Security).GetCurrentUserById(request.Context(), realmPtr.Name, userId)
+							if currentUser != nil {
+								issueTokens = true
+							} else {
+								status = http.StatusBadRequest
+								result = dto.ErrorDetails{Msg: errors.InvalidTokenMsg, Description: errors.TokenIsNotActive}
+							}
+						}
+					} else if session == nil {
+						if (*wCtx.Security).RevokeReusedRefreshToken(request.Context(), realmPtr, tokenGenerationData.ClientId, &tokenGenerationData.RefreshToken) {
+							status = http.StatusBadRequest
+							wCtx.Logger.Debug("New token issue: already used refresh token was presented")
+							result = dto.ErrorDetails{Msg: errors.InvalidTokenMsg, Description: errors.RefreshTokenWasAlreadyUsed}
+						} else {
+							status = http.StatusUnauthorized
+							result = dto.ErrorDetails{Msg: errors.InvalidTokenMsg, Description: errors.TokenIsNotActive}
+						}
+					} else if len(session.ClientId) > 0 && session.ClientId != tokenGenerationData.ClientId {
+						// session is tracked per client, therefore refresh token could be used only by client that token was issued to
+						status = http.StatusBadRequest
+						wCtx.Logger.Debug("New token issue: refresh token was issued to another client")
+						result = dto.ErrorDetails{Msg: errors.InvalidTokenMsg, Description: errors.TokenIssuedToAnotherClient}
+					} else if isRevokedByNotBefore(realmPtr, session.LastActivity) {
+						status = http.StatusBadRequest
+						wCtx.Logger.Debug("New token issue: refresh token was revoked by realm not-before policy")
 						result = dto.ErrorDetails{Msg: errors.InvalidTokenMsg, Description: errors.TokenIsNotActive}
 					} else {
 						userId = session.UserId
-						sessionExpired, refreshExpired := (*wCtx.Security).CheckSessionAndRefreshExpired(realm, userId)
+						sessionId = session.Id
+						replacedRefreshToken = session.JwtRefreshToken
+						sessionExpired, refreshExpired := (*wCtx.Security).CheckSessionAndRefreshExpired(request.Context(), realm, sessionId)
 						if sessionExpired {
 							// session expired, should request new one
 							status = http.StatusBadRequest
@@ -107,7 +160,7 @@ func (wCtx *WebApiContext) IssueNewToken(respWriter http.ResponseWriter, request
 								status = http.StatusBadRequest
 								result = dto.ErrorDetails{Msg: errors.InvalidTokenMsg, Description: errors.TokenIsNotActive}
 							} else {
-								currentUser = (*wCtx.Security).GetCurrentUserById(realmPtr.Name, userId)
+								currentUser = (*wCtx.Security).GetCurrentUserById(request.Context(), realmPtr.Name, userId)
 								if currentUser != nil {
 									issueTokens = true
 								} else {
@@ -127,38 +180,92 @@ func (wCtx *WebApiContext) IssueNewToken(respWriter http.ResponseWriter, request
 						result = dto.ErrorDetails{Msg: check.Msg, Description: check.Description}
 					} else {
 						// 2. User credentials validation
-						check = (*wCtx.Security).CheckCredentials(&tokenGenerationData, realmPtr.Name)
+						check = (*wCtx.Security).CheckCredentials(request.Context(), &tokenGenerationData, realmPtr.Name)
 						if check != nil {
 							wCtx.Logger.Debug("New token issue: invalid user credentials (username or password)")
 							status = http.StatusUnauthorized
+							if check.Msg == errors.ServiceIsUnavailable {
+								status = http.StatusServiceUnavailable
+							}
 							result = dto.ErrorDetails{Msg: check.Msg, Description: check.Description}
 						} else {
-							currentUser = (*wCtx.Security).GetCurrentUserByName(realmPtr.Name, tokenGenerationData.Username)
+							currentUser = (*wCtx.Security).GetCurrentUserByName(request.Context(), realmPtr.Name, tokenGenerationData.Username)
 							userId = currentUser.GetId()
+							isOfflineRequested = isOfflineAccessRequested(&tokenGenerationData)
 							issueTokens = true
 						}
 					}
 				}
 				if issueTokens {
-					// 3. Create access token && refresh token
-					duration := realmPtr.TokenExpiration
-					refresh := realmPtr.RefreshTokenExpiration
-					refreshDuration := realmPtr.RefreshTokenExpiration
-					// 4. Save session
-					sessionId := (*wCtx.Security).StartOrUpdateSession(realm, userId, duration, refresh)
-					session := (*wCtx.Security).GetSession(realm, userId)
-					// 5. Generate new tokens
-					accessToken := wCtx.TokenGenerator.GenerateJwtAccessToken(wCtx.getRealmBaseUrl(realm), string(BearerToken),
-						globals.ProfileEmailScope, session, currentUser)
-					refreshToken := wCtx.TokenGenerator.GenerateJwtRefreshToken(wCtx.getRealmBaseUrl(realm), string(RefreshToken),
-						globals.ProfileEmailScope, session)
-					(*wCtx.Security).AssignTokens(realm, userId, &accessToken, &refreshToken)
-					// 6. Assign token to result
-					result = dto.Token{
-						AccessToken: accessToken, Expires: duration, RefreshToken: refreshToken,
-						RefreshExpires: refreshDuration, TokenType: string(BearerToken), NotBeforePolicy: 0, Session: sessionId.String(),
+					// 3. Save session (new login or offline token refresh starts new session, refresh updates existing one)
+					var check *data.OperationError
+					sessionId, check = (*wCtx.Security).StartOrUpdateSession(request.Context(), realmPtr, sessionId, userId, tokenGenerationData.ClientId,
+						getUserIP(request))
+					if check == nil && (isOfflineRequested || offlineSession != nil) {
+						// 3.1 Save offline session in a data store
+						offlineSessionId := uuid.Nil
+						if offlineSession != nil {
+							offlineSessionId = offlineSession.Id
+						}
+						offlineSession, check = (*wCtx.Security).StartOrUpdateOfflineSession(request.Context(), realmPtr, offlineSessionId, sessionId, userId,
+							tokenGenerationData.ClientId)
+					}
+					if check != nil && check.Description == errors.RefreshTokenWasReplaced {
+						check = wCtx.getReplacedRefreshTokenError(request.Context(), realmPtr, &tokenGenerationData)
+					}
+					if check != nil {
+						status = http.StatusBadRequest
+						if check.Msg == errors.ServiceIsUnavailable {
+							status = http.StatusServiceUnavailable
+						}
+						wCtx.Logger.Debug("New token issue: session wasn't started")
+						result = dto.ErrorDetails{Msg: check.Msg, Description: check.Description}
+					} else {
+						session := (*wCtx.Security).GetSession(request.Context(), realm, sessionId)
+						scope := globals.ProfileEmailScope
+						if offlineSession != nil {
+							scope = scope + " " + globals.OfflineAccessScope
+						}
+						// 4. Generate new tokens, they are issued only if they were saved in session
+						var accessToken, refreshToken string
+						if session == nil {
+							check = &data.OperationError{Msg: errors.InvalidTokenMsg, Description: errors.SessionIsNotActive}
+						} else {
+							accessToken = wCtx.TokenGenerator.GenerateJwtAccessToken(wCtx.getRealmBaseUrl(realm), string(BearerToken),
+								scope, session, currentUser)
+							refreshToken = wCtx.TokenGenerator.GenerateJwtRefreshToken(wCtx.getRealmBaseUrl(realm), string(RefreshToken),
+								scope, session)
+							check = (*wCtx.Security).AssignTokens(request.Context(), realm, sessionId, &replacedRefreshToken, &accessToken,
+								&refreshToken)
+						}
+						if check != nil && check.Description == errors.RefreshTokenWasReplaced {
+							check = wCtx.getReplacedRefreshTokenError(request.Context(), realmPtr, &tokenGenerationData)
+						}
+						if check != nil {
+							status = http.StatusBadRequest
+							if check.Msg == errors.ServiceIsUnavailable {
+								status = http.StatusServiceUnavailable
+							}
+							wCtx.Logger.Debug("New token issue: tokens weren't assigned to session")
+							result = dto.ErrorDetails{Msg: check.Msg, Description: check.Description}
+							afterHandle(&respWriter, status, &result)
+							return
+						}
+						// 5. Assign token to result, lifetimes could be less than realm ones due to session idle timeout and max lifespan
+						duration := int(session.Expired.Sub(session.LastActivity) / time.Second)
+						refreshDuration := int(session.RefreshExpired.Sub(session.LastActivity) / time.Second)
+						if offlineSession != nil {
+							// offline token replaces refresh token in result, it is the only token that allows to get new tokens
+							refreshToken = wCtx.TokenGenerator.GenerateJwtOfflineToken(wCtx.getRealmBaseUrl(realm), string(OfflineToken),
+								scope, offlineSession)
+							(*wCtx.Security).AssignOfflineToken(request.Context(), realm, offlineSession, &refreshToken)
+							refreshDuration = int(offlineSession.Expired.Sub(offlineSession.LastActivity) / time.Second)
+						}
+						result = dto.Token{
+							AccessToken: accessToken, Expires: duration, RefreshToken: refreshToken,
+							RefreshExpires: refreshDuration, TokenType: string(BearerToken), NotBeforePolicy: int(realmPtr.NotBefore), Session: sessionId.String(),
+						}
 					}
-
 				}
 			}
 		}
@@ -197,7 +304,7 @@ func (wCtx *WebApiContext) GetUserInfo(respWriter http.ResponseWriter, request *
 		afterHandle(&respWriter, status, &result)
 		return
 	}
-	realmPtr, realmReadErr := (*wCtx.DataProvider).GetRealm(realm)
+	realmPtr, realmReadErr := (*wCtx.DataProvider).GetRealm(request.Context(), realm)
 	if realmReadErr != nil {
 		if e.As(realmReadErr, &errors.ErrDataSourceNotAvailable) {
 			status = http.StatusServiceUnavailable
@@ -228,18 +335,18 @@ func (wCtx *WebApiContext) GetUserInfo(respWriter http.ResponseWriter, request *
 			result = dto.ErrorDetails{Msg: errors.InvalidRequestMsg, Description: errors.InvalidRequestDesc}
 
 		} else {
-			session := (*wCtx.Security).GetSessionByAccessToken(realm, &parts[1])
+			session := (*wCtx.Security).GetSessionByAccessToken(request.Context(), realm, &parts[1])
 			if session == nil {
 				wCtx.Logger.Debug("Get userinfo: invalid token")
 				status = http.StatusUnauthorized
 				result = dto.ErrorDetails{Msg: errors.InvalidTokenMsg, Description: errors.InvalidTokenDesc}
 			} else {
-				if session.Expired.Before(time.Now()) {
+				if session.Expired.Before(time.Now()) || isRevokedByNotBefore(realmPtr, session.LastActivity) {
 					status = http.StatusUnauthorized
 					wCtx.Logger.Debug("Get userinfo: token expired")
 					result = dto.ErrorDetails{Msg: errors.InvalidTokenMsg, Description: errors.InvalidTokenDesc}
 				} else {
-					user, _ := (*wCtx.DataProvider).GetUserById(realmPtr.Name, session.UserId)
+					user, _ := (*wCtx.DataProvider).GetUserById(request.Context(), realmPtr.Name, session.UserId)
 					if user != nil {
 						result = user.GetUserInfo()
 					}
@@ -281,7 +388,7 @@ func (wCtx *WebApiContext) Introspect(respWriter http.ResponseWriter, request *h
 		afterHandle(&respWriter, status, &result)
 		return
 	}
-	realmPtr, realmReadErr := (*wCtx.DataProvider).GetRealm(realm)
+	realmPtr, realmReadErr := (*wCtx.DataProvider).GetRealm(request.Context(), realm)
 	if realmReadErr != nil {
 		var status int
 		var result interface{}
@@ -333,7 +440,7 @@ func (wCtx *WebApiContext) Introspect(respWriter http.ResponseWriter, request *h
 		return
 	}
 	token := request.FormValue(globals.TokenFormKey)
-	session := (*wCtx.Security).GetSessionByAccessToken(realm, &token)
+	session := (*wCtx.Security).GetSessionByAccessToken(request.Context(), realm, &token)
 	if session == nil {
 		status := http.StatusUnauthorized
 		result := dto.ErrorDetails{Msg: errors.InvalidTokenMsg, Description: errors.InvalidTokenDesc}
@@ -341,7 +448,7 @@ func (wCtx *WebApiContext) Introspect(respWriter http.ResponseWriter, request *h
 		afterHandle(&respWriter, status, &result)
 		return
 	}
-	active := !session.Expired.Before(time.Now())
+	active := !session.Expired.Before(time.Now()) && !isRevokedByNotBefore(realmPtr, session.LastActivity)
 	status := http.StatusOK
 	authTokenType := string(BearerToken)
 	result := dto.IntrospectTokenResult{
@@ -380,7 +487,7 @@ func (wCtx *WebApiContext) GetOpenIdConfiguration(respWriter http.ResponseWriter
 		afterHandle(&respWriter, status, &result)
 		return
 	}
-	_, realmReadErr := (*wCtx.DataProvider).GetRealm(realm)
+	_, realmReadErr := (*wCtx.DataProvider).GetRealm(request.Context(), realm)
 	if realmReadErr != nil {
 		if e.As(realmReadErr, &errors.ErrDataSourceNotAvailable) {
 			status = http.StatusServiceUnavailable
@@ -425,6 +532,18 @@ func (wCtx *WebApiContext) getRealmBaseUrl(realm string) string {
 	return sf.Format("/{0}/{1}/auth/realms/{2}", wCtx.Schema, wCtx.Address, realm)
 }
 
+// getReplacedRefreshTokenError returns error of refresh that lost race to concurrent refresh with the same refresh token: presented
+// token is already used, therefore it revokes session if refresh token rotation is enabled (see SecurityService.RevokeReusedRefreshToken)
+func (wCtx *WebApiContext) getReplacedRefreshTokenError(ctx context.Context, realm *data.Realm,
+	tokenIssueData *dto.TokenGenerationData,
+) *data.OperationError {
+	if (*wCtx.Security).RevokeReusedRefreshToken(ctx, realm, tokenIssueData.ClientId, &tokenIssueData.RefreshToken) {
+		wCtx.Logger.Debug("New token issue: refresh token was used by concurrent refresh")
+		return &data.OperationError{Msg: errors.InvalidTokenMsg, Description: errors.RefreshTokenWasAlreadyUsed}
+	}
+	return &data.OperationError{Msg: errors.InvalidTokenMsg, Description: errors.TokenIsNotActive}
+}
+
 func isTokenRefreshRequest(tokenIssueData *dto.TokenGenerationData) bool {
 	if len(tokenIssueData.RefreshToken) == 0 || tokenIssueData.GrantType != globals.RefreshTokenGrantType {
 		return false
@@ -432,15 +551,34 @@ func isTokenRefreshRequest(tokenIssueData *dto.TokenGenerationData) bool {
 	return true
 }
 
-// reserved for future use
-// nolint unused
+// isOfflineAccessRequested checks whether offline_access is one of the requested scopes (scopes are space separated)
+func isOfflineAccessRequested(tokenIssueData *dto.TokenGenerationData) bool {
+	for _, scope := range strings.Fields(tokenIssueData.Scope) {
+		if scope == globals.OfflineAccessScope {
+			return true
+		}
+	}
+	return false
+}
+
+// isRevokedByNotBefore checks whether tokens issued by session (user or offline) that was active at lastActivity time
+// are revoked by realm not-before policy (data.Realm NotBefore)
+func isRevokedByNotBefore(realm *data.Realm, lastActivity time.Time) bool {
+	return realm.NotBefore > 0 && lastActivity.Unix() < realm.NotBefore
+}
+
+// getUserIP returns IP address of a client, proxy headers are taking into account
 func getUserIP(r *http.Request) string {
 	IPAddress := r.Header.Get("X-Real-Ip")
 	if IPAddress == "" {
-		IPAddress = r.Header.Get("X-Forwarded-For")
+		// X-Forwarded-For contains comma separated list of addresses, the first one is a client address
+		IPAddress = strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-For"), ",")[0])
 	}
 	if IPAddress == "" {
 		IPAddress = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			IPAddress = host
+		}
 	}
 	return IPAddress
 }
@@ -0,0 +1,219 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wissance/Ferrum/config"
+	"github.com/wissance/Ferrum/data"
+	"github.com/wissance/Ferrum/dto"
+	"github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/globals"
+	"github.com/wissance/Ferrum/logging"
+	"github.com/wissance/Ferrum/managers"
+	"github.com/wissance/Ferrum/managers/files"
+	"github.com/wissance/Ferrum/services"
+	"github.com/wissance/Ferrum/services/sessions"
+)
+
+// notAvailableDataContext is a data store that is not available, operations that are not overridden panic
+type notAvailableDataContext struct {
+	managers.DataContext
+}
+
+func (mn *notAvailableDataContext) GetRealm(_ context.Context, _ string) (*data.Realm, error) {
+	return nil, errors.NewDataProviderNotAvailable(string(config.REDIS), "127.0.0.1:1")
+}
+
+func TestHandlersRespondServiceUnavailableWhenDataProviderIsNotAvailable(t *testing.T) {
+	var dataProvider managers.DataContext = &notAvailableDataContext{}
+	wCtx := WebApiContext{
+		DataProvider: &dataProvider,
+		Logger:       logging.CreateLogger(&config.LoggingConfig{}),
+	}
+	testCases := []struct {
+		name    string
+		method  string
+		handler http.HandlerFunc
+	}{
+		{name: "IssueNewToken", method: http.MethodPost, handler: wCtx.IssueNewToken},
+		{name: "GetUserInfo", method: http.MethodGet, handler: wCtx.GetUserInfo},
+		{name: "Introspect", method: http.MethodPost, handler: wCtx.Introspect},
+		{name: "GetOpenIdConfiguration", method: http.MethodGet, handler: wCtx.GetOpenIdConfiguration},
+	}
+
+	for _, tCase := range testCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			request := httptest.NewRequest(tCase.method, "/auth/realms/app", nil)
+			request = mux.SetURLVars(request, map[string]string{globals.RealmPathVar: "app"})
+			recorder := httptest.NewRecorder()
+			tCase.handler(recorder, request)
+
+			assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+			var details dto.ErrorDetails
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &details))
+			assert.Equal(t, errors.ServiceIsUnavailable, details.Msg)
+		})
+	}
+}
+
+func TestDataProviderNotAvailableErrorIsServiceUnavailable(t *testing.T) {
+	wCtx := WebApiContext{Logger: logging.CreateLogger(&config.LoggingConfig{})}
+	err := errors.NewDataProviderNotAvailable(string(config.POSTGRES), "127.0.0.1:1")
+	status, details := wCtx.getDataErrorDetails(err, "Get clients", "Realm", "app")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	require.NotNil(t, details)
+	assert.Equal(t, errors.ServiceIsUnavailable, details.Msg)
+}
+
+// failingSessionStore is a memory sessions store which Save and Rotate fail after failAfter successful writes (store becomes not available)
+type failingSessionStore struct {
+	*sessions.MemorySessionStore
+	failAfter int32
+	writes    atomic.Int32
+}
+
+func (store *failingSessionStore) Save(ctx context.Context, realm string, session *data.UserSession) error {
+	if store.writes.Add(1) > store.failAfter {
+		return errors.NewDataProviderNotAvailable(string(config.REDIS), "127.0.0.1:1")
+	}
+	return store.MemorySessionStore.Save(ctx, realm, session)
+}
+
+func (store *failingSessionStore) Rotate(ctx context.Context, realm string, expectedRefreshToken string, session *data.UserSession) error {
+	if store.writes.Add(1) > store.failAfter {
+		return errors.NewDataProviderNotAvailable(string(config.REDIS), "127.0.0.1:1")
+	}
+	return store.MemorySessionStore.Rotate(ctx, realm, expectedRefreshToken, session)
+}
+
+// barrierSessionStore is a memory sessions store which GetByRefreshToken returns when all refreshes (lookups) found session,
+// therefore all concurrent refreshes pass refresh token check before any of them replaces refresh token
+type barrierSessionStore struct {
+	*sessions.MemorySessionStore
+	lookups *sync.WaitGroup
+}
+
+func (store *barrierSessionStore) GetByRefreshToken(ctx context.Context, realm string, token string) (*data.UserSession, error) {
+	session, err := store.MemorySessionStore.GetByRefreshToken(ctx, realm, token)
+	if store.lookups != nil {
+		store.lookups.Done()
+		store.lookups.Wait()
+	}
+	return session, err
+}
+
+func TestIssueNewTokenConcurrentRefreshesWithSameRefreshToken(t *testing.T) {
+	logger := logging.CreateLogger(&config.LoggingConfig{})
+	sessionStore := &barrierSessionStore{MemorySessionStore: sessions.CreateMemorySessionStore()}
+	wCtx := createTestWebApiContext(t, sessionStore, logger, true)
+	loginResponse := issueTestToken(wCtx, url.Values{"grant_type": {"password"}, "client_id": {"app-client"}, "username": {"user"},
+		"password": {"1234567890"}})
+	require.Equal(t, http.StatusOK, loginResponse.Code)
+	var token dto.Token
+	require.NoError(t, json.Unmarshal(loginResponse.Body.Bytes(), &token))
+
+	refreshes := 4
+	sessionStore.lookups = &sync.WaitGroup{}
+	sessionStore.lookups.Add(refreshes)
+	responses := make([]*httptest.ResponseRecorder, refreshes)
+	var wg sync.WaitGroup
+	wg.Add(refreshes)
+	for i := 0; i < refreshes; i++ {
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = issueTestToken(wCtx, url.Values{"grant_type": {"refresh_token"}, "client_id": {"app-client"},
+				"refresh_token": {token.RefreshToken}})
+		}(i)
+	}
+	wg.Wait()
+
+	// refresh token is single-use: only one refresh gets tokens, others are detected as reuse and session is revoked
+	succeeded := 0
+	reuseDetected := false
+	for _, response := range responses {
+		if response.Code == http.StatusOK {
+			succeeded++
+			continue
+		}
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.NotContains(t, response.Body.String(), "access_token")
+		var details dto.ErrorDetails
+		require.NoError(t, json.Unmarshal(response.Body.Bytes(), &details))
+		reuseDetected = reuseDetected || details.Description == errors.RefreshTokenWasAlreadyUsed
+	}
+	assert.Equal(t, 1, succeeded)
+	assert.True(t, reuseDetected)
+	sessionId, err := uuid.Parse(token.Session)
+	require.NoError(t, err)
+	_, err = sessionStore.Get(context.Background(), "app", sessionId)
+	assert.Error(t, err, "session must be revoked")
+}
+
+func TestIssueNewTokenFailsWhenSessionIsNotSaved(t *testing.T) {
+	testCases := []struct {
+		name      string
+		failAfter int32
+	}{
+		{name: "SessionStart", failAfter: 0},
+		{name: "TokensAssignment", failAfter: 1},
+	}
+
+	for _, tCase := range testCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			logger := logging.CreateLogger(&config.LoggingConfig{})
+			sessionStore := &failingSessionStore{MemorySessionStore: sessions.CreateMemorySessionStore(), failAfter: tCase.failAfter}
+			wCtx := createTestWebApiContext(t, sessionStore, logger, false)
+			recorder := issueTestToken(wCtx, url.Values{"grant_type": {"password"}, "client_id": {"app-client"}, "username": {"user"},
+				"password": {"1234567890"}})
+
+			assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+			assert.NotContains(t, recorder.Body.String(), "access_token")
+			var details dto.ErrorDetails
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &details))
+			assert.Equal(t, errors.ServiceIsUnavailable, details.Msg)
+		})
+	}
+}
+
+// createTestWebApiContext creates web api context with a realm "app" that has public client "app-client" and user "user"
+func createTestWebApiContext(t *testing.T, sessionStore sessions.SessionStore, logger *logging.AppLogger, refreshTokenRotation bool) *WebApiContext {
+	manager, err := files.CreateFileDataManagerWithInitData(&data.ServerData{}, logger)
+	require.NoError(t, err)
+	realm := data.Realm{
+		Name: "app", TokenExpiration: 300, RefreshTokenExpiration: 600, RefreshTokenRotation: refreshTokenRotation,
+		Clients: []data.Client{{Name: "app-client", Type: data.Public, ID: uuid.New()}},
+		Users: []any{map[string]any{
+			"info":        map[string]any{"sub": uuid.New().String(), "preferred_username": "user"},
+			"credentials": map[string]any{"password": "1234567890"},
+		}},
+	}
+	require.NoError(t, manager.CreateRealm(context.Background(), realm))
+	var dataProvider managers.DataContext = manager
+	security := services.CreateSecurityService(&dataProvider, sessionStore, logger)
+	return &WebApiContext{
+		DataProvider: &dataProvider, Security: &security, Logger: logger,
+		TokenGenerator: &services.JwtGenerator{SignKey: []byte("test_sign_key"), Logger: logger},
+	}
+}
+
+// issueTestToken sends token request with form to realm "app"
+func issueTestToken(wCtx *WebApiContext, form url.Values) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/auth/realms/app/protocol/openid-connect/token", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request = mux.SetURLVars(request, map[string]string{globals.RealmPathVar: "app"})
+	recorder := httptest.NewRecorder()
+	wCtx.IssueNewToken(recorder, request)
+	return recorder
+}
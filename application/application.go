@@ -23,6 +23,7 @@ import (
 	"github.com/wissance/Ferrum/logging"
 	"github.com/wissance/Ferrum/managers"
 	"github.com/wissance/Ferrum/services"
+	"github.com/wissance/Ferrum/services/sessions"
 	r "github.com/wissance/gwuu/api/rest"
 	"github.com/wissance/stringFormatter"
 	"gopkg.in/natefinch/lumberjack.v2"
@@ -40,6 +41,7 @@ type Application struct {
 	secretKey          []byte
 	serverData         *data.ServerData
 	dataProvider       *managers.DataContext
+	sessionJanitor     *sessions.SessionJanitor
 	webApiHandler      *r.WebApiHandler
 	webApiContext      *rest.WebApiContext
 	logger             *logging.AppLogger
@@ -80,11 +82,13 @@ func CreateAppWithData(appConfig *config.AppConfig, serverData *data.ServerData,
 }
 
 // Start function that starts application
-/* This function must be called after Init it starts application web server either on HTTP or HTTPS 9depends on config Schema value)
+/* This function must be called after Init it starts expired sessions janitor and application web server either on HTTP or
+ * HTTPS (depends on config Schema value)
  * Parameters: no
  * Return start result (true if Start was successful) and error (nil if start was successful)
  */
 func (app *Application) Start() (bool, error) {
+	app.sessionJanitor.Start()
 	err := app.startWebService()
 	if err != nil {
 		app.logger.Error(stringFormatter.Format("An error occurred during API Service Start"))
@@ -158,14 +162,22 @@ func (app *Application) Init() (bool, error) {
 }
 
 // Stop function that stops application
-/* Now doesn't do anything, just a stub
+/* This function stops expired sessions janitor and gracefully shutdowns web server
  * Parameters : no
  * Returns result of app stop and error
  */
 func (app *Application) Stop(ctx context.Context) (bool, error) {
+	app.sessionJanitor.Stop()
 	ctx, cancel := context.WithTimeout(ctx, app.shutdownTimeout)
 	defer cancel()
 	err := app.httpServer.Shutdown(ctx)
+	// data store could watch data changes and save changes with delay (FILE data store with reload_interval and save_delay
+	// options), changes must not be lost on stop
+	if closer, ok := (*app.dataProvider).(interface{ Close() error }); ok {
+		if closeErr := closer.Close(); closeErr != nil {
+			app.logger.Error(stringFormatter.Format("An error occurred during data store closing: {0}", closeErr.Error()))
+		}
+	}
 	if err != nil {
 		return false, err
 	}
@@ -203,7 +215,12 @@ func (app *Application) initDataProviders() error {
 
 func (app *Application) initRestApi() error {
 	app.webApiHandler = r.NewWebApiHandler(true, r.AnyOrigin)
-	securityService := services.CreateSecurityService(app.dataProvider, app.logger)
+	sessionStore, err := sessions.CreateSessionStore(&app.appConfig.SessionStore, &app.appConfig.DataSource, *app.dataProvider, app.logger)
+	if err != nil {
+		return err
+	}
+	app.sessionJanitor = sessions.CreateSessionJanitor(sessionStore, app.appConfig.SessionStore.GetCleanupInterval(), app.logger)
+	securityService := services.CreateSecurityService(app.dataProvider, sessionStore, app.logger)
 	serverAddress := stringFormatter.Format("{0}:{1}", app.appConfig.ServerCfg.Address, app.appConfig.ServerCfg.Port)
 	app.webApiContext = &rest.WebApiContext{
 		Address: serverAddress, Schema: string(app.appConfig.ServerCfg.Schema),
@@ -214,6 +231,7 @@ func (app *Application) initRestApi() error {
 	router := app.webApiHandler.Router
 	router.StrictSlash(true)
 	app.initKeyCloakSimilarRestApiRoutes(router)
+	app.initAdminRestApiRoutes(router)
 	if app.devMode {
 		app.initSwaggerRoutes(router)
 	}
@@ -265,6 +283,7 @@ func (app *Application) initAuthServerDefs() {
 		globals.OpenIdScope,
 		globals.ProfileScope,
 		globals.EmailScope,
+		globals.OfflineAccessScope,
 	}
 
 	app.authenticationDefs.SupportedClaimTypes = []string{
@@ -293,6 +312,53 @@ func (app *Application) initKeyCloakSimilarRestApiRoutes(router *mux.Router) {
 	app.webApiHandler.HandleFunc(router, "/realms/{realm}/.well-known/openid-configuration", app.webApiContext.GetOpenIdConfiguration, http.MethodGet)
 }
 
+func (app *Application) initAdminRestApiRoutes(router *mux.Router) {
+	// Admin endpoints are protected by master realm access token, every endpoint is available with and without /auth prefix
+	for _, prefix := range []string{"/auth/admin/realms/{realm}", "/admin/realms/{realm}"} {
+		// 1. Sessions listing - realm, user and client sessions
+		app.webApiHandler.HandleFunc(router, prefix+"/sessions", app.webApiContext.GetRealmSessions, http.MethodGet)
+		app.webApiHandler.HandleFunc(router, prefix+"/users/{id}/sessions", app.webApiContext.GetUserSessions, http.MethodGet)
+		app.webApiHandler.HandleFunc(router, prefix+"/clients/{id}/user-sessions", app.webApiContext.GetClientSessions, http.MethodGet)
+		// 2. Forced logout - one session, all user sessions and all realm sessions
+		app.webApiHandler.HandleFunc(router, prefix+"/sessions/{session}", app.webApiContext.DeleteSession, http.MethodDelete)
+		app.webApiHandler.HandleFunc(router, prefix+"/users/{id}/logout", app.webApiContext.LogoutUser, http.MethodPost)
+		app.webApiHandler.HandleFunc(router, prefix+"/logout-all", app.webApiContext.LogoutAll, http.MethodPost)
+		// 3. Realm not-before revocation timestamp
+		app.webApiHandler.HandleFunc(router, prefix+"/not-before", app.webApiContext.SetRealmNotBefore, http.MethodPost)
+	}
+	// Keycloak compatible resources management: realms, clients, users (with credentials) and user federation components
+	for _, realmsPrefix := range []string{"/auth/admin/realms", "/admin/realms"} {
+		prefix := realmsPrefix + "/{realm}"
+		// 1. Realms
+		app.webApiHandler.HandleFunc(router, realmsPrefix, app.webApiContext.CreateRealm, http.MethodPost)
+		app.webApiHandler.HandleFunc(router, prefix, app.webApiContext.GetRealmRepresentation, http.MethodGet)
+		app.webApiHandler.HandleFunc(router, prefix, app.webApiContext.UpdateRealm, http.MethodPut)
+		app.webApiHandler.HandleFunc(router, prefix, app.webApiContext.DeleteRealm, http.MethodDelete)
+		// 2. Clients and clients secrets
+		app.webApiHandler.HandleFunc(router, prefix+"/clients", app.webApiContext.GetClients, http.MethodGet)
+		app.webApiHandler.HandleFunc(router, prefix+"/clients", app.webApiContext.CreateClient, http.MethodPost)
+		app.webApiHandler.HandleFunc(router, prefix+"/clients/{id}", app.webApiContext.GetClient, http.MethodGet)
+		app.webApiHandler.HandleFunc(router, prefix+"/clients/{id}", app.webApiContext.UpdateClient, http.MethodPut)
+		app.webApiHandler.HandleFunc(router, prefix+"/clients/{id}", app.webApiContext.DeleteClient, http.MethodDelete)
+		app.webApiHandler.HandleFunc(router, prefix+"/clients/{id}/client-secret", app.webApiContext.GetClientSecret, http.MethodGet)
+		app.webApiHandler.HandleFunc(router, prefix+"/clients/{id}/client-secret", app.webApiContext.RegenerateClientSecret, http.MethodPost)
+		// 3. Users and users passwords, count must be registered before {id}
+		app.webApiHandler.HandleFunc(router, prefix+"/users", app.webApiContext.GetUsers, http.MethodGet)
+		app.webApiHandler.HandleFunc(router, prefix+"/users", app.webApiContext.CreateUser, http.MethodPost)
+		app.webApiHandler.HandleFunc(router, prefix+"/users/count", app.webApiContext.GetUsersCount, http.MethodGet)
+		app.webApiHandler.HandleFunc(router, prefix+"/users/{id}", app.webApiContext.GetUser, http.MethodGet)
+		app.webApiHandler.HandleFunc(router, prefix+"/users/{id}", app.webApiContext.UpdateUser, http.MethodPut)
+		app.webApiHandler.HandleFunc(router, prefix+"/users/{id}", app.webApiContext.DeleteUser, http.MethodDelete)
+		app.webApiHandler.HandleFunc(router, prefix+"/users/{id}/reset-password", app.webApiContext.ResetUserPassword, http.MethodPut)
+		// 4. User federation configs as Keycloak components
+		app.webApiHandler.HandleFunc(router, prefix+"/components", app.webApiContext.GetComponents, http.MethodGet)
+		app.webApiHandler.HandleFunc(router, prefix+"/components", app.webApiContext.CreateComponent, http.MethodPost)
+		app.webApiHandler.HandleFunc(router, prefix+"/components/{id}", app.webApiContext.GetComponent, http.MethodGet)
+		app.webApiHandler.HandleFunc(router, prefix+"/components/{id}", app.webApiContext.UpdateComponent, http.MethodPut)
+		app.webApiHandler.HandleFunc(router, prefix+"/components/{id}", app.webApiContext.DeleteComponent, http.MethodDelete)
+	}
+}
+
 func (app *Application) startWebService() error {
 	var err error
 	addressTemplate := "{0}:{1}"
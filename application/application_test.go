@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -91,6 +92,434 @@ func TestApplicationOnHttps(t *testing.T) {
 	testRunCommonTestCycleImpl(t, &httpsAppConfig, stringFormatter.Format("{0}://{1}", httpsAppConfig.ServerCfg.Schema, serverAddress))
 }
 
+func TestApplicationMultipleUserSessions(t *testing.T) {
+	ctx := context.Background()
+	evictRealm := "evictrealm"
+	rejectRealm := "rejectrealm"
+	serverData := data.ServerData{
+		Realms: []data.Realm{
+			testServerData.Realms[0],
+			createTestRealmWithSessionsLimit(evictRealm, 1, data.EvictOldestSession),
+			createTestRealmWithSessionsLimit(rejectRealm, 1, data.RejectNewSession),
+		},
+	}
+	appConfig := httpAppConfig
+	appConfig.ServerCfg.Port = 8285
+	baseUrl := stringFormatter.Format("{0}://{1}:{2}", appConfig.ServerCfg.Schema, appConfig.ServerCfg.Address, appConfig.ServerCfg.Port)
+	app := CreateAppWithData(&appConfig, &serverData, testKey, true)
+	res, err := app.Init()
+	assert.True(t, res)
+	assert.Nil(t, err)
+	res, err = app.Start()
+	assert.True(t, res)
+	assert.Nil(t, err)
+	username := "vano"
+	password := "1234567890"
+
+	// 1. Without limit every login starts its own session, all sessions are active
+	response := issueNewToken(t, baseUrl, testRealm1, testClient1, testClient1Secret, username, password)
+	firstToken := getDataFromResponse[dto.Token](t, response)
+	response = issueNewToken(t, baseUrl, testRealm1, testClient1, testClient1Secret, username, password)
+	secondToken := getDataFromResponse[dto.Token](t, response)
+	assert.NotEqual(t, firstToken.Session, secondToken.Session)
+	getUserInfo(t, baseUrl, testRealm1, firstToken.AccessToken, "200 OK")
+	getUserInfo(t, baseUrl, testRealm1, secondToken.AccessToken, "200 OK")
+	// refresh keeps session
+	response = refreshToken(t, baseUrl, testRealm1, testClient1, testClient1Secret, firstToken.RefreshToken)
+	assert.Equal(t, "200 OK", response.Status)
+	refreshedToken := getDataFromResponse[dto.Token](t, response)
+	assert.Equal(t, firstToken.Session, refreshedToken.Session)
+	getUserInfo(t, baseUrl, testRealm1, secondToken.AccessToken, "200 OK")
+	// refresh token could be used only by client that it was issued to
+	response = refreshToken(t, baseUrl, testRealm1, "otherClient", testClient1Secret, secondToken.RefreshToken)
+	assert.Equal(t, "400 Bad Request", response.Status)
+	errResp := getDataFromResponse[dto.ErrorDetails](t, response)
+	assert.Equal(t, errors.TokenIssuedToAnotherClient, errResp.Description)
+
+	// 2. Limit with evict_oldest policy removes the oldest session
+	response = issueNewToken(t, baseUrl, evictRealm, testClient1, testClient1Secret, username, password)
+	firstToken = getDataFromResponse[dto.Token](t, response)
+	response = issueNewToken(t, baseUrl, evictRealm, testClient1, testClient1Secret, username, password)
+	assert.Equal(t, "200 OK", response.Status)
+	secondToken = getDataFromResponse[dto.Token](t, response)
+	getUserInfo(t, baseUrl, evictRealm, firstToken.AccessToken, "401 Unauthorized")
+	getUserInfo(t, baseUrl, evictRealm, secondToken.AccessToken, "200 OK")
+
+	// 3. Limit with reject_new policy rejects new login
+	response = issueNewToken(t, baseUrl, rejectRealm, testClient1, testClient1Secret, username, password)
+	firstToken = getDataFromResponse[dto.Token](t, response)
+	response = issueNewToken(t, baseUrl, rejectRealm, testClient1, testClient1Secret, username, password)
+	assert.Equal(t, "400 Bad Request", response.Status)
+	errResp = getDataFromResponse[dto.ErrorDetails](t, response)
+	assert.Equal(t, errors.InvalidUserCredentialsMsg, errResp.Msg)
+	getUserInfo(t, baseUrl, rejectRealm, firstToken.AccessToken, "200 OK")
+
+	res, err = app.Stop(ctx)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestApplicationSessionIdleTimeoutAndMaxLifespan(t *testing.T) {
+	ctx := context.Background()
+	idleRealm := "idlerealm"
+	lifespanRealm := "lifespanrealm"
+	idleRealmData := testServerData.Realms[0]
+	idleRealmData.Name = idleRealm
+	idleRealmData.SessionIdleTimeout = 1
+	lifespanRealmData := testServerData.Realms[0]
+	lifespanRealmData.Name = lifespanRealm
+	lifespanRealmData.SessionMaxLifespan = 2
+	serverData := data.ServerData{Realms: []data.Realm{idleRealmData, lifespanRealmData}}
+	appConfig := httpAppConfig
+	appConfig.ServerCfg.Port = 8286
+	// janitor doesn't run during test (it is tested separately), therefore expired sessions are rejected by session limits check
+	appConfig.SessionStore = config.SessionStoreConfig{Type: config.MemorySessionStore, CleanupInterval: 3600}
+	baseUrl := stringFormatter.Format("{0}://{1}:{2}", appConfig.ServerCfg.Schema, appConfig.ServerCfg.Address, appConfig.ServerCfg.Port)
+	app := CreateAppWithData(&appConfig, &serverData, testKey, true)
+	res, err := app.Init()
+	assert.True(t, res)
+	assert.Nil(t, err)
+	res, err = app.Start()
+	assert.True(t, res)
+	assert.Nil(t, err)
+	username := "vano"
+	password := "1234567890"
+
+	// 1. Tokens lifetime doesn't exceed session limits
+	response := issueNewToken(t, baseUrl, idleRealm, testClient1, testClient1Secret, username, password)
+	idleToken := getDataFromResponse[dto.Token](t, response)
+	assert.Equal(t, 1, idleToken.Expires)
+	assert.Equal(t, 1, idleToken.RefreshExpires)
+	response = issueNewToken(t, baseUrl, lifespanRealm, testClient1, testClient1Secret, username, password)
+	lifespanToken := getDataFromResponse[dto.Token](t, response)
+	assert.Equal(t, 2, lifespanToken.Expires)
+	assert.Equal(t, 2, lifespanToken.RefreshExpires)
+
+	// 2. Idle session couldn't be refreshed, session that is younger than max lifespan could be refreshed
+	time.Sleep(time.Millisecond * 1500)
+	response = refreshToken(t, baseUrl, idleRealm, testClient1, testClient1Secret, idleToken.RefreshToken)
+	assert.Equal(t, "400 Bad Request", response.Status)
+	response = refreshToken(t, baseUrl, lifespanRealm, testClient1, testClient1Secret, lifespanToken.RefreshToken)
+	assert.Equal(t, "200 OK", response.Status)
+	lifespanToken = getDataFromResponse[dto.Token](t, response)
+	assert.True(t, lifespanToken.RefreshExpires <= 1)
+
+	// 3. Session that is older than max lifespan couldn't be refreshed and its access token is not active
+	time.Sleep(time.Millisecond * 1000)
+	response = refreshToken(t, baseUrl, lifespanRealm, testClient1, testClient1Secret, lifespanToken.RefreshToken)
+	assert.Equal(t, "400 Bad Request", response.Status)
+	getUserInfo(t, baseUrl, lifespanRealm, lifespanToken.AccessToken, "401 Unauthorized")
+	tokenIntResult := checkIntrospectToken(t, baseUrl, lifespanRealm, lifespanToken.AccessToken, testClient1, testClient1Secret, "200 OK")
+	active, ok := tokenIntResult["active"]
+	assert.True(t, ok == false || active == nil || active.(bool) == false)
+
+	res, err = app.Stop(ctx)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestApplicationRefreshTokenRotation(t *testing.T) {
+	ctx := context.Background()
+	rotationRealm := "rotationrealm"
+	rotationEnabled := true
+	rotationRealmData := testServerData.Realms[0]
+	rotationRealmData.Name = rotationRealm
+	// realm policy is disabled, but client overrides it
+	rotationRealmData.Clients = []data.Client{rotationRealmData.Clients[0]}
+	rotationRealmData.Clients[0].RefreshTokenRotation = &rotationEnabled
+	serverData := data.ServerData{Realms: []data.Realm{testServerData.Realms[0], rotationRealmData}}
+	appConfig := httpAppConfig
+	appConfig.ServerCfg.Port = 8287
+	baseUrl := stringFormatter.Format("{0}://{1}:{2}", appConfig.ServerCfg.Schema, appConfig.ServerCfg.Address, appConfig.ServerCfg.Port)
+	app := CreateAppWithData(&appConfig, &serverData, testKey, true)
+	res, err := app.Init()
+	assert.True(t, res)
+	assert.Nil(t, err)
+	res, err = app.Start()
+	assert.True(t, res)
+	assert.Nil(t, err)
+	username := "vano"
+	password := "1234567890"
+
+	// 1. Without rotation replaced refresh token stays valid, session stays alive
+	response := issueNewToken(t, baseUrl, testRealm1, testClient1, testClient1Secret, username, password)
+	firstToken := getDataFromResponse[dto.Token](t, response)
+	response = refreshToken(t, baseUrl, testRealm1, testClient1, testClient1Secret, firstToken.RefreshToken)
+	assert.Equal(t, "200 OK", response.Status)
+	secondToken := getDataFromResponse[dto.Token](t, response)
+	assert.NotEqual(t, firstToken.RefreshToken, secondToken.RefreshToken)
+	response = refreshToken(t, baseUrl, testRealm1, testClient1, testClient1Secret, firstToken.RefreshToken)
+	assert.Equal(t, "200 OK", response.Status)
+	thirdToken := getDataFromResponse[dto.Token](t, response)
+	getUserInfo(t, baseUrl, testRealm1, thirdToken.AccessToken, "200 OK")
+	response = refreshToken(t, baseUrl, testRealm1, testClient1, testClient1Secret, secondToken.RefreshToken)
+	assert.Equal(t, "200 OK", response.Status)
+
+	// 2. With rotation used refresh token revokes whole session
+	response = issueNewToken(t, baseUrl, rotationRealm, testClient1, testClient1Secret, username, password)
+	firstToken = getDataFromResponse[dto.Token](t, response)
+	response = refreshToken(t, baseUrl, rotationRealm, testClient1, testClient1Secret, firstToken.RefreshToken)
+	assert.Equal(t, "200 OK", response.Status)
+	secondToken = getDataFromResponse[dto.Token](t, response)
+	getUserInfo(t, baseUrl, rotationRealm, secondToken.AccessToken, "200 OK")
+	response = refreshToken(t, baseUrl, rotationRealm, testClient1, testClient1Secret, firstToken.RefreshToken)
+	assert.Equal(t, "400 Bad Request", response.Status)
+	errResp := getDataFromResponse[dto.ErrorDetails](t, response)
+	assert.Equal(t, errors.RefreshTokenWasAlreadyUsed, errResp.Description)
+	getUserInfo(t, baseUrl, rotationRealm, secondToken.AccessToken, "401 Unauthorized")
+	response = refreshToken(t, baseUrl, rotationRealm, testClient1, testClient1Secret, secondToken.RefreshToken)
+	assert.Equal(t, "401 Unauthorized", response.Status)
+
+	res, err = app.Stop(ctx)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestApplicationOfflineTokensWithReadOnlyDataStore(t *testing.T) {
+	ctx := context.Background()
+	appConfig := httpAppConfig
+	appConfig.ServerCfg.Port = 8288
+	baseUrl := stringFormatter.Format("{0}://{1}:{2}", appConfig.ServerCfg.Schema, appConfig.ServerCfg.Address, appConfig.ServerCfg.Port)
+	app := CreateAppWithData(&appConfig, &testServerData, testKey, true)
+	res, err := app.Init()
+	assert.True(t, res)
+	assert.Nil(t, err)
+	res, err = app.Start()
+	assert.True(t, res)
+	assert.Nil(t, err)
+	username := "vano"
+	password := "1234567890"
+
+	// FILE data store is read only, therefore offline sessions couldn't be stored
+	response := issueNewTokenWithScope(t, baseUrl, testRealm1, testClient1, testClient1Secret, username, password, "profile offline_access")
+	assert.Equal(t, "400 Bad Request", response.Status)
+	errResp := getDataFromResponse[dto.ErrorDetails](t, response)
+	assert.Equal(t, errors.InvalidScopeMsg, errResp.Msg)
+	assert.Equal(t, errors.OfflineTokensNotSupported, errResp.Description)
+	// without offline_access scope login works as usual
+	response = issueNewToken(t, baseUrl, testRealm1, testClient1, testClient1Secret, username, password)
+	assert.Equal(t, "200 OK", response.Status)
+
+	res, err = app.Stop(ctx)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestApplicationAdminSessions(t *testing.T) {
+	ctx := context.Background()
+	masterRealm := testServerData.Realms[0]
+	masterRealm.Name = "master"
+	masterRealm.Users = []interface{}{
+		createTestAdminUser("5e6ecb1d-79bb-4a0d-a1b8-0cc1f6e6a2a1", "admin", map[string]interface{}{"*": []interface{}{"realm-admin"}}),
+		createTestAdminUser("0c9a4b43-2f4e-4d29-9a0e-8cf4a7c6a7d2", "viewer", map[string]interface{}{"*": []interface{}{"view-users"}}),
+	}
+	testRealm := testServerData.Realms[0]
+	testRealm.Users = append(slices.Clone(testRealm.Users),
+		createTestAdminUser("b7e5c3a1-4d0f-4c59-8f3e-2a6d9e1f0b4c", "realmadmin", map[string]interface{}{testRealm1: []interface{}{"manage-users"}}))
+	serverData := data.ServerData{Realms: []data.Realm{testRealm, masterRealm}}
+	appConfig := httpAppConfig
+	appConfig.ServerCfg.Port = 8289
+	baseUrl := stringFormatter.Format("{0}://{1}:{2}", appConfig.ServerCfg.Schema, appConfig.ServerCfg.Address, appConfig.ServerCfg.Port)
+	app := CreateAppWithData(&appConfig, &serverData, testKey, true)
+	res, err := app.Init()
+	assert.True(t, res)
+	assert.Nil(t, err)
+	res, err = app.Start()
+	assert.True(t, res)
+	assert.Nil(t, err)
+	username := "vano"
+	userId := "667ff6a7-3f6b-449b-a217-6fc5d9ac0723"
+	password := "1234567890"
+	adminUrl := stringFormatter.Format("{0}/admin/realms/{1}", baseUrl, testRealm1)
+
+	response := issueNewToken(t, baseUrl, masterRealm.Name, testClient1, testClient1Secret, "admin", password)
+	adminToken := getDataFromResponse[dto.Token](t, response)
+	response = issueNewToken(t, baseUrl, testRealm1, testClient1, testClient1Secret, username, password)
+	firstToken := getDataFromResponse[dto.Token](t, response)
+	response = issueNewToken(t, baseUrl, testRealm1, testClient1, testClient1Secret, username, password)
+	secondToken := getDataFromResponse[dto.Token](t, response)
+
+	// 1. Admin API requires access token of an administrator with admin role for realm
+	sendAdminRequest(t, http.MethodGet, adminUrl+"/sessions", "", "401 Unauthorized")
+	sendAdminRequest(t, http.MethodGet, adminUrl+"/sessions", firstToken.AccessToken, "403 Forbidden")
+	response = issueNewToken(t, baseUrl, masterRealm.Name, testClient1, testClient1Secret, "viewer", password)
+	viewerToken := getDataFromResponse[dto.Token](t, response)
+	sendAdminRequest(t, http.MethodGet, adminUrl+"/sessions", viewerToken.AccessToken, "200 OK")
+	sendAdminRequest(t, http.MethodDelete, adminUrl+"/sessions/"+firstToken.Session, viewerToken.AccessToken, "403 Forbidden")
+	sendAdminRequest(t, http.MethodPost, adminUrl+"/logout-all", viewerToken.AccessToken, "403 Forbidden")
+	// realm administrator manages only own realm
+	response = issueNewToken(t, baseUrl, testRealm1, testClient1, testClient1Secret, "realmadmin", password)
+	realmAdminToken := getDataFromResponse[dto.Token](t, response)
+	sendAdminRequest(t, http.MethodGet, adminUrl+"/users/"+userId+"/sessions", realmAdminToken.AccessToken, "200 OK")
+	sendAdminRequest(t, http.MethodPost, adminUrl+"/logout-all", realmAdminToken.AccessToken, "403 Forbidden")
+	sendAdminRequest(t, http.MethodGet, baseUrl+"/admin/realms/master/sessions", realmAdminToken.AccessToken, "401 Unauthorized")
+	sendAdminRequest(t, http.MethodDelete, adminUrl+"/sessions/"+realmAdminToken.Session, adminToken.AccessToken, "204 No Content")
+
+	// 2. Sessions listing by realm, user and client
+	realmSessions := getAdminSessions(t, adminUrl+"/sessions", adminToken.AccessToken)
+	assert.Equal(t, 2, len(realmSessions))
+	assert.Equal(t, firstToken.Session, realmSessions[0].Id)
+	assert.Equal(t, secondToken.Session, realmSessions[1].Id)
+	for _, s := range realmSessions {
+		assert.Equal(t, username, s.Username)
+		assert.Equal(t, userId, s.UserId)
+		assert.True(t, len(s.IpAddress) > 0)
+		assert.True(t, s.Start > 0 && s.LastAccess >= s.Start)
+		assert.Contains(t, s.Clients, testClient1)
+	}
+	userSessions := getAdminSessions(t, adminUrl+"/users/"+userId+"/sessions", adminToken.AccessToken)
+	assert.Equal(t, 2, len(userSessions))
+	clientSessions := getAdminSessions(t, baseUrl+"/auth/admin/realms/"+testRealm1+"/clients/"+testClient1+"/user-sessions",
+		adminToken.AccessToken)
+	assert.Equal(t, 2, len(clientSessions))
+	sendAdminRequest(t, http.MethodGet, adminUrl+"/clients/unknown/user-sessions", adminToken.AccessToken, "404 Not Found")
+
+	// 3. Terminate one session
+	sendAdminRequest(t, http.MethodDelete, adminUrl+"/sessions/"+firstToken.Session, adminToken.AccessToken, "204 No Content")
+	sendAdminRequest(t, http.MethodDelete, adminUrl+"/sessions/"+firstToken.Session, adminToken.AccessToken, "404 Not Found")
+	getUserInfo(t, baseUrl, testRealm1, firstToken.AccessToken, "401 Unauthorized")
+	getUserInfo(t, baseUrl, testRealm1, secondToken.AccessToken, "200 OK")
+	response = refreshToken(t, baseUrl, testRealm1, testClient1, testClient1Secret, firstToken.RefreshToken)
+	assert.Equal(t, "401 Unauthorized", response.Status)
+
+	// 4. Terminate all user sessions
+	response = issueNewToken(t, baseUrl, testRealm1, testClient1, testClient1Secret, username, password)
+	firstToken = getDataFromResponse[dto.Token](t, response)
+	sendAdminRequest(t, http.MethodPost, adminUrl+"/users/"+username+"/logout", adminToken.AccessToken, "204 No Content")
+	getUserInfo(t, baseUrl, testRealm1, firstToken.AccessToken, "401 Unauthorized")
+	getUserInfo(t, baseUrl, testRealm1, secondToken.AccessToken, "401 Unauthorized")
+	assert.Empty(t, getAdminSessions(t, adminUrl+"/users/"+userId+"/sessions", adminToken.AccessToken))
+	sendAdminRequest(t, http.MethodPost, adminUrl+"/users/unknown/logout", adminToken.AccessToken, "404 Not Found")
+
+	// 5. Terminate all realm sessions, sessions of other realms are kept
+	response = issueNewToken(t, baseUrl, testRealm1, testClient1, testClient1Secret, username, password)
+	firstToken = getDataFromResponse[dto.Token](t, response)
+	sendAdminRequest(t, http.MethodPost, adminUrl+"/logout-all", adminToken.AccessToken, "204 No Content")
+	getUserInfo(t, baseUrl, testRealm1, firstToken.AccessToken, "401 Unauthorized")
+	assert.Empty(t, getAdminSessions(t, adminUrl+"/sessions", adminToken.AccessToken))
+
+	// 6. Realm not-before is stored in a data store
+	sendAdminRequest(t, http.MethodPost, adminUrl+"/not-before", adminToken.AccessToken, "200 OK")
+
+	res, err = app.Stop(ctx)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestApplicationAdminResourcesWithFileDataStore(t *testing.T) {
+	ctx := context.Background()
+	masterRealm := testServerData.Realms[0]
+	masterRealm.Name = "master"
+	masterRealm.Users = []interface{}{
+		createTestAdminUser("5e6ecb1d-79bb-4a0d-a1b8-0cc1f6e6a2a1", "admin", map[string]interface{}{"*": []interface{}{"realm-admin"}}),
+		createTestAdminUser("0c9a4b43-2f4e-4d29-9a0e-8cf4a7c6a7d2", "viewer", map[string]interface{}{testRealm1: []interface{}{"view-clients"}}),
+	}
+	testRealm := testServerData.Realms[0]
+	testRealm.Users = append(slices.Clone(testRealm.Users),
+		createTestAdminUser("b7e5c3a1-4d0f-4c59-8f3e-2a6d9e1f0b4c", "manager", map[string]interface{}{testRealm1: []interface{}{"manage-users"}}),
+		createTestAdminUser("3f1d2c6b-8a7e-4b5d-9c0f-1e2a3b4c5d6e", "realmadmin", map[string]interface{}{testRealm1: []interface{}{"realm-admin"}}))
+	serverData := data.ServerData{Realms: []data.Realm{testRealm, masterRealm}}
+	appConfig := httpAppConfig
+	appConfig.ServerCfg.Port = 8290
+	baseUrl := stringFormatter.Format("{0}://{1}:{2}", appConfig.ServerCfg.Schema, appConfig.ServerCfg.Address, appConfig.ServerCfg.Port)
+	app := CreateAppWithData(&appConfig, &serverData, testKey, true)
+	res, err := app.Init()
+	assert.True(t, res)
+	assert.Nil(t, err)
+	res, err = app.Start()
+	assert.True(t, res)
+	assert.Nil(t, err)
+	userId := "667ff6a7-3f6b-449b-a217-6fc5d9ac0723"
+	adminUrl := stringFormatter.Format("{0}/admin/realms/{1}", baseUrl, testRealm1)
+	response := issueNewToken(t, baseUrl, masterRealm.Name, testClient1, testClient1Secret, "admin", "1234567890")
+	adminToken := getDataFromResponse[dto.Token](t, response).AccessToken
+
+	// 1. Admin API requires access token of an administrator with admin role for realm
+	sendAdminRequest(t, http.MethodGet, adminUrl, "", "401 Unauthorized")
+	sendAdminRequest(t, http.MethodGet, baseUrl+"/admin/realms/unknown", adminToken, "404 Not Found")
+	response = issueNewToken(t, baseUrl, masterRealm.Name, testClient1, testClient1Secret, "viewer", "1234567890")
+	viewerToken := getDataFromResponse[dto.Token](t, response).AccessToken
+	assert.Equal(t, 1, len(getAdminData[[]dto.ClientRepresentation](t, adminUrl+"/clients", viewerToken)))
+	sendAdminRequest(t, http.MethodGet, adminUrl+"/users", viewerToken, "403 Forbidden")
+	sendAdminRequest(t, http.MethodDelete, adminUrl+"/clients/"+testClient1, viewerToken, "403 Forbidden")
+	sendAdminRequest(t, http.MethodGet, baseUrl+"/admin/realms/master/clients", viewerToken, "403 Forbidden")
+	sendAdminRequestWithBody(t, http.MethodPost, baseUrl+"/admin/realms", viewerToken, `{"realm": "newrealm"}`, "403 Forbidden")
+	// realm user manager manages users of own realm except administrators, realm admin also manages administrators
+	response = issueNewToken(t, baseUrl, testRealm1, testClient1, testClient1Secret, "manager", "1234567890")
+	managerToken := getDataFromResponse[dto.Token](t, response).AccessToken
+	response = issueNewToken(t, baseUrl, testRealm1, testClient1, testClient1Secret, "realmadmin", "1234567890")
+	realmAdminToken := getDataFromResponse[dto.Token](t, response).AccessToken
+	assert.Equal(t, 3, getAdminData[int](t, adminUrl+"/users/count", managerToken))
+	sendAdminRequest(t, http.MethodGet, adminUrl+"/clients", managerToken, "403 Forbidden")
+	sendAdminRequestWithBody(t, http.MethodPut, adminUrl+"/users/"+userId, managerToken, `{"lastName": "ivanov"}`, "204 No Content")
+	sendAdminRequestWithBody(t, http.MethodPut, adminUrl+"/users/realmadmin", managerToken, `{"firstName": "ivan"}`, "403 Forbidden")
+	sendAdminRequest(t, http.MethodDelete, adminUrl+"/users/realmadmin", managerToken, "403 Forbidden")
+	sendAdminRequestWithBody(t, http.MethodPut, adminUrl+"/users/realmadmin", realmAdminToken, `{"lastName": "admin"}`, "204 No Content")
+	sendAdminRequest(t, http.MethodGet, baseUrl+"/admin/realms/master/users", realmAdminToken, "401 Unauthorized")
+	sendAdminRequestWithBody(t, http.MethodPost, baseUrl+"/admin/realms", realmAdminToken, `{"realm": "newrealm"}`, "401 Unauthorized")
+
+	// 2. Realm, clients and users representations
+	realm := getAdminData[dto.RealmRepresentation](t, adminUrl, adminToken)
+	assert.Equal(t, testRealm1, realm.Realm)
+	assert.Equal(t, testAccessTokenExpiration, realm.AccessTokenLifespan)
+	assert.Equal(t, "5", realm.Attributes["refreshTokenExpiration"])
+	clients := getAdminData[[]dto.ClientRepresentation](t, adminUrl+"/clients", adminToken)
+	assert.Equal(t, 1, len(clients))
+	assert.Equal(t, testClient1, clients[0].ClientId)
+	assert.False(t, clients[0].PublicClient)
+	assert.Empty(t, getAdminData[[]dto.ClientRepresentation](t, adminUrl+"/clients?clientId=unknown", adminToken))
+	secret := getAdminData[dto.CredentialRepresentation](t, adminUrl+"/clients/"+testClient1+"/client-secret", adminToken)
+	assert.Equal(t, testClient1Secret, secret.Value)
+	sendAdminRequest(t, http.MethodGet, adminUrl+"/clients/unknown", adminToken, "404 Not Found")
+	users := getAdminData[[]dto.UserRepresentation](t, baseUrl+"/auth/admin/realms/"+testRealm1+"/users?search=VAN", adminToken)
+	assert.Equal(t, 1, len(users))
+	assert.Equal(t, userId, users[0].Id)
+	assert.Equal(t, "vano", users[0].Username)
+	assert.Equal(t, "ivanov", users[0].LastName)
+	assert.True(t, users[0].EmailVerified)
+	assert.Equal(t, []string{"vano"}, users[0].Attributes["name"])
+	assert.Empty(t, users[0].Credentials)
+	assert.Empty(t, getAdminData[[]dto.UserRepresentation](t, adminUrl+"/users?username=van&exact=true", adminToken))
+	assert.Equal(t, 3, getAdminData[int](t, adminUrl+"/users/count", adminToken))
+	user := getAdminData[dto.UserRepresentation](t, adminUrl+"/users/"+userId, adminToken)
+	assert.Equal(t, users[0], user)
+	sendAdminRequest(t, http.MethodGet, adminUrl+"/users/unknown", adminToken, "404 Not Found")
+
+	// 3. FILE data store is writable (data is kept in memory if it was not loaded from a data file)
+	assert.Empty(t, getAdminData[[]any](t, adminUrl+"/components", adminToken))
+	sendAdminRequestWithBody(t, http.MethodPost, baseUrl+"/admin/realms", adminToken, `{"realm": "newrealm"}`, "201 Created")
+	sendAdminRequestWithBody(t, http.MethodPost, baseUrl+"/admin/realms", adminToken, `{"realm": "newrealm"}`, "409 Conflict")
+	sendAdminRequestWithBody(t, http.MethodPost, baseUrl+"/admin/realms", adminToken, `{"realm": "new realm"}`, "400 Bad Request")
+	assert.Equal(t, "newrealm", getAdminData[dto.RealmRepresentation](t, baseUrl+"/admin/realms/newrealm", adminToken).Realm)
+	sendAdminRequestWithBody(t, http.MethodPut, adminUrl, adminToken, `{"accessTokenLifespan": 600}`, "204 No Content")
+	sendAdminRequestWithBody(t, http.MethodPut, adminUrl, adminToken, `{"realm": "renamed"}`, "400 Bad Request")
+	assert.Equal(t, 600, getAdminData[dto.RealmRepresentation](t, adminUrl, adminToken).AccessTokenLifespan)
+	sendAdminRequestWithBody(t, http.MethodPost, adminUrl+"/clients", adminToken, `{"clientId": "newclient"}`, "201 Created")
+	sendAdminRequestWithBody(t, http.MethodPost, adminUrl+"/clients", adminToken, `{"clientId": "newclient"}`, "409 Conflict")
+	assert.Equal(t, 2, len(getAdminData[[]dto.ClientRepresentation](t, adminUrl+"/clients", adminToken)))
+	sendAdminRequestWithBody(t, http.MethodPost, adminUrl+"/users", adminToken, `{"username": "newuser"}`, "201 Created")
+	sendAdminRequestWithBody(t, http.MethodPost, adminUrl+"/users", adminToken, `{"email": "newuser@mail.com"}`, "400 Bad Request")
+	assert.Equal(t, 4, getAdminData[int](t, adminUrl+"/users/count", adminToken))
+	sendAdminRequestWithBody(t, http.MethodPut, adminUrl+"/users/"+userId, adminToken, `{"firstName": "ivan"}`, "204 No Content")
+	user = getAdminData[dto.UserRepresentation](t, adminUrl+"/users/vano", adminToken)
+	assert.Equal(t, "ivan", user.FirstName)
+	assert.Equal(t, "ivanov", user.LastName)
+	sendAdminRequestWithBody(t, http.MethodPut, adminUrl+"/users/"+userId+"/reset-password", adminToken,
+		`{"type": "password", "value": "qwerty"}`, "204 No Content")
+	response = issueNewToken(t, baseUrl, testRealm1, testClient1, testClient1Secret, "vano", "qwerty")
+	assert.NotEmpty(t, getDataFromResponse[dto.Token](t, response).AccessToken)
+	sendAdminRequest(t, http.MethodDelete, adminUrl+"/users/newuser", adminToken, "204 No Content")
+	sendAdminRequest(t, http.MethodGet, adminUrl+"/users/newuser", adminToken, "404 Not Found")
+	sendAdminRequest(t, http.MethodDelete, adminUrl+"/clients/newclient", adminToken, "204 No Content")
+	sendAdminRequest(t, http.MethodGet, adminUrl+"/clients/newclient", adminToken, "404 Not Found")
+	sendAdminRequest(t, http.MethodDelete, baseUrl+"/admin/realms/newrealm", adminToken, "204 No Content")
+	sendAdminRequest(t, http.MethodDelete, baseUrl+"/admin/realms/master", adminToken, "400 Bad Request")
+
+	res, err = app.Stop(ctx)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
 func testRunCommonTestCycleImpl(t *testing.T, appConfig *config.AppConfig, baseUrl string) {
 	ctx := context.Background()
 	app := CreateAppWithData(appConfig, &testServerData, testKey, true)
@@ -171,15 +600,29 @@ func testRunCommonTestCycleImpl(t *testing.T, appConfig *config.AppConfig, baseU
 	assert.Nil(t, err)
 }
 
+func createTestRealmWithSessionsLimit(name string, maxUserSessions int, policy data.SessionEvictionPolicy) data.Realm {
+	realm := testServerData.Realms[0]
+	realm.Name = name
+	realm.MaxUserSessions = maxUserSessions
+	realm.SessionEvictionPolicy = policy
+	return realm
+}
+
 func issueNewToken(t *testing.T, baseUrl string, realm string, clientId string, clientSecret string,
 	userName string, password string,
+) *http.Response {
+	return issueNewTokenWithScope(t, baseUrl, realm, clientId, clientSecret, userName, password, "profile")
+}
+
+func issueNewTokenWithScope(t *testing.T, baseUrl string, realm string, clientId string, clientSecret string,
+	userName string, password string, scope string,
 ) *http.Response {
 	tokenUrlTemplate := "{0}/auth/realms/{1}/protocol/openid-connect/token"
 	tokenUrl := stringFormatter.Format(tokenUrlTemplate, baseUrl, realm)
 	getTokenData := url.Values{}
 	getTokenData.Set("client_id", clientId)
 	getTokenData.Set("client_secret", clientSecret)
-	getTokenData.Set("scope", "profile")
+	getTokenData.Set("scope", scope)
 	getTokenData.Set("grant_type", "password")
 	getTokenData.Set("username", userName)
 	getTokenData.Set("password", password)
@@ -213,6 +656,48 @@ func getDataFromResponse[TR dto.Token | dto.ErrorDetails](t *testing.T, response
 	return result
 }
 
+func createTestAdminUser(id string, username string, adminRoles map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"info":        map[string]interface{}{"sub": id, "preferred_username": username},
+		"credentials": map[string]interface{}{"password": testHashedPassword},
+		"admin_roles": adminRoles,
+	}
+}
+
+func sendAdminRequest(t *testing.T, method string, reqUrl string, token string, expectedStatus string) *http.Response {
+	return sendAdminRequestWithBody(t, method, reqUrl, token, "", expectedStatus)
+}
+
+func sendAdminRequestWithBody(t *testing.T, method string, reqUrl string, token string, body string, expectedStatus string) *http.Response {
+	request, err := http.NewRequest(method, reqUrl, strings.NewReader(body))
+	assert.NoError(t, err)
+	if len(body) > 0 {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if len(token) > 0 {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := http.Client{}
+	response, err := client.Do(request)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedStatus, response.Status)
+	return response
+}
+
+func getAdminSessions(t *testing.T, reqUrl string, token string) []dto.UserSessionRepresentation {
+	return getAdminData[[]dto.UserSessionRepresentation](t, reqUrl, token)
+}
+
+func getAdminData[T any](t *testing.T, reqUrl string, token string) T {
+	response := sendAdminRequest(t, http.MethodGet, reqUrl, token, "200 OK")
+	responseBody, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	var result T
+	err = json.Unmarshal(responseBody, &result)
+	assert.Nil(t, err)
+	return result
+}
+
 func getUserInfo(t *testing.T, baseUrl string, realm string, token string, expectedStatus string) map[string]interface{} {
 	userInfoUrlTemplate := "{0}/auth/realms/{1}/protocol/openid-connect/userinfo/"
 	userInfoUrl := stringFormatter.Format(userInfoUrlTemplate, baseUrl, realm)
@@ -9,12 +9,14 @@ const (
 	serverValidationErrExitCode        = 567
 	dataSourceValidationErrExitCode    = 568
 	loggingSystemValidationErrExitCode = 569
+	sessionStoreValidationErrExitCode  = 570
 )
 
 type AppConfig struct {
-	ServerCfg  ServerConfig     `json:"server"`
-	DataSource DataSourceConfig `json:"data_source"`
-	Logging    LoggingConfig    `json:"logging"`
+	ServerCfg    ServerConfig       `json:"server"`
+	DataSource   DataSourceConfig   `json:"data_source"`
+	SessionStore SessionStoreConfig `json:"session_store"`
+	Logging      LoggingConfig      `json:"logging"`
 }
 
 func ReadAppConfig(pathToConfig string) (*AppConfig, error) {
@@ -39,6 +41,12 @@ func (cfg *AppConfig) Validate() {
 		os.Exit(dataSourceValidationErrExitCode)
 	}
 
+	sessionStoreCfgValidationErr := cfg.SessionStore.ValidateWithDataSource(&cfg.DataSource)
+	if sessionStoreCfgValidationErr != nil {
+		println(sessionStoreCfgValidationErr.Error())
+		os.Exit(sessionStoreValidationErrExitCode)
+	}
+
 	loggingSystemCfgValidationErr := cfg.Logging.Validate()
 	if loggingSystemCfgValidationErr != nil {
 		println(loggingSystemCfgValidationErr.Error())
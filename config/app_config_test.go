@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"path"
 	"testing"
+	"time"
 )
 
 func TestValidateAppConfigWithRedisDataSourceCfg(t *testing.T) {
@@ -46,6 +47,47 @@ func TestValidateAppConfigWithRedisDataSourceCfg(t *testing.T) {
 	}
 }
 
+func TestValidateAppConfigWithPostgresDataSourceCfg(t *testing.T) {
+	fileData, err := ioutil.ReadFile(path.Join("test_configs", "valid_config_w_min_postgres.json"))
+	assert.NoError(t, err)
+	appConfig := AppConfig{}
+	err = json.Unmarshal(fileData, &appConfig)
+	assert.NoError(t, err)
+	checkDataSourceValues(t, POSTGRES, "localhost:5432", &CredentialsConfig{Username: "dbmn", Password: "123"},
+		map[DataSourceConnOption]string{
+			DbName: "ferrum",
+		}, appConfig.DataSource)
+	err = appConfig.DataSource.Validate()
+	assert.NoError(t, err)
+}
+
+func TestValidatePostgresDataSourceCfg(t *testing.T) {
+	testCases := []struct {
+		name    string
+		source  string
+		options map[DataSourceConnOption]string
+		isValid bool
+	}{
+		{name: "WithTls", source: "localhost:5432", options: map[DataSourceConnOption]string{DbName: "ferrum", UseTls: "true"}, isValid: true},
+		{name: "WithoutPort", source: "localhost", options: map[DataSourceConnOption]string{DbName: "ferrum"}, isValid: false},
+		{name: "WithInvalidPort", source: "localhost:pg", options: map[DataSourceConnOption]string{DbName: "ferrum"}, isValid: false},
+		{name: "WithoutDbName", source: "localhost:5432", options: map[DataSourceConnOption]string{}, isValid: false},
+		{name: "WithInvalidUseTls", source: "localhost:5432", options: map[DataSourceConnOption]string{DbName: "ferrum", UseTls: "yes!"}, isValid: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dataSourceCfg := DataSourceConfig{Type: POSTGRES, Source: tc.source, Options: tc.options}
+			err := dataSourceCfg.Validate()
+			if tc.isValid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
 func checkDataSourceValues(t *testing.T, expectedSourceType DataSourceType, expectedSource string, expectedCredentials *CredentialsConfig,
 	expectedOptions map[DataSourceConnOption]string, actualCfg DataSourceConfig) {
 	assert.Equal(t, expectedSourceType, actualCfg.Type)
@@ -64,3 +106,264 @@ func checkDataSourceValues(t *testing.T, expectedSourceType DataSourceType, expe
 		assert.Equal(t, v, av)
 	}
 }
+
+func TestValidateSessionStoreCfg(t *testing.T) {
+	testCases := []struct {
+		name            string
+		storeType       SessionStoreType
+		dataSourceType  DataSourceType
+		cleanupInterval int
+		isValid         bool
+	}{
+		{name: "DefaultSessionStore", storeType: "", dataSourceType: FILE, isValid: true},
+		{name: "MemorySessionStoreWithRedis", storeType: MemorySessionStore, dataSourceType: REDIS, isValid: true},
+		{name: "RedisSessionStoreWithRedis", storeType: RedisSessionStore, dataSourceType: REDIS, isValid: true},
+		{name: "RedisSessionStoreWithFile", storeType: RedisSessionStore, dataSourceType: FILE, isValid: false},
+		{name: "UnknownSessionStore", storeType: "etcd", dataSourceType: REDIS, isValid: false},
+		{name: "SessionStoreWithCleanupInterval", storeType: MemorySessionStore, dataSourceType: FILE, cleanupInterval: 10, isValid: true},
+		{name: "SessionStoreWithNegativeCleanupInterval", storeType: MemorySessionStore, dataSourceType: FILE, cleanupInterval: -1, isValid: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storeCfg := SessionStoreConfig{Type: tc.storeType, CleanupInterval: tc.cleanupInterval}
+			dataSourceCfg := DataSourceConfig{Type: tc.dataSourceType}
+			err := storeCfg.ValidateWithDataSource(&dataSourceCfg)
+			if tc.isValid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateFileDataSourceSaveDelay(t *testing.T) {
+	testCases := []struct {
+		name          string
+		saveDelay     string
+		expectedDelay time.Duration
+		isValid       bool
+	}{
+		{name: "WithoutSaveDelay", saveDelay: "", expectedDelay: 0, isValid: true},
+		{name: "WithSaveDelay", saveDelay: "500", expectedDelay: 500 * time.Millisecond, isValid: true},
+		{name: "WithNegativeSaveDelay", saveDelay: "-1", isValid: false},
+		{name: "WithInvalidSaveDelay", saveDelay: "1s", isValid: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dataSourceCfg := DataSourceConfig{Type: FILE, Source: "data.json", Options: map[DataSourceConnOption]string{}}
+			if len(tc.saveDelay) > 0 {
+				dataSourceCfg.Options[SaveDelay] = tc.saveDelay
+			}
+			err := dataSourceCfg.Validate()
+			if tc.isValid {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedDelay, dataSourceCfg.GetSaveDelay())
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateFileDataSourceReloadInterval(t *testing.T) {
+	testCases := []struct {
+		name             string
+		reloadInterval   string
+		expectedInterval time.Duration
+		isValid          bool
+	}{
+		{name: "WithoutReloadInterval", reloadInterval: "", expectedInterval: DefaultReloadInterval, isValid: true},
+		{name: "WithReloadInterval", reloadInterval: "200", expectedInterval: 200 * time.Millisecond, isValid: true},
+		{name: "WithDisabledReload", reloadInterval: "0", expectedInterval: 0, isValid: true},
+		{name: "WithNegativeReloadInterval", reloadInterval: "-1", isValid: false},
+		{name: "WithInvalidReloadInterval", reloadInterval: "1s", isValid: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dataSourceCfg := DataSourceConfig{Type: FILE, Source: "data.json", Options: map[DataSourceConnOption]string{}}
+			if len(tc.reloadInterval) > 0 {
+				dataSourceCfg.Options[ReloadInterval] = tc.reloadInterval
+			}
+			err := dataSourceCfg.Validate()
+			if tc.isValid {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedInterval, dataSourceCfg.GetReloadInterval())
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateDataSourceOperationTimeout(t *testing.T) {
+	testCases := []struct {
+		name            string
+		dataSourceType  DataSourceType
+		timeout         string
+		expectedTimeout time.Duration
+		isValid         bool
+	}{
+		{name: "WithoutOperationTimeout", dataSourceType: REDIS, timeout: "", expectedTimeout: DefaultOperationTimeout, isValid: true},
+		{name: "WithOperationTimeout", dataSourceType: REDIS, timeout: "300", expectedTimeout: 300 * time.Millisecond, isValid: true},
+		{name: "WithDisabledOperationTimeout", dataSourceType: POSTGRES, timeout: "0", expectedTimeout: 0, isValid: true},
+		{name: "WithNegativeOperationTimeout", dataSourceType: POSTGRES, timeout: "-1", isValid: false},
+		{name: "WithInvalidOperationTimeout", dataSourceType: REDIS, timeout: "1s", isValid: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dataSourceCfg := DataSourceConfig{
+				Type: tc.dataSourceType, Source: "127.0.0.1:6379",
+				Options: map[DataSourceConnOption]string{DbNumber: "0", DbName: "ferrum"},
+			}
+			if len(tc.timeout) > 0 {
+				dataSourceCfg.Options[DataOperationTimeout] = tc.timeout
+			}
+			err := dataSourceCfg.Validate()
+			if tc.isValid {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedTimeout, dataSourceCfg.GetOperationTimeout())
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateDataSourceRevisionsLimit(t *testing.T) {
+	testCases := []struct {
+		name          string
+		limit         string
+		expectedLimit int
+		isValid       bool
+	}{
+		{name: "WithoutRevisionsLimit", limit: "", expectedLimit: DefaultRevisionsLimit, isValid: true},
+		{name: "WithRevisionsLimit", limit: "5", expectedLimit: 5, isValid: true},
+		{name: "WithDisabledHistory", limit: "0", expectedLimit: 0, isValid: true},
+		{name: "WithNegativeRevisionsLimit", limit: "-1", isValid: false},
+		{name: "WithInvalidRevisionsLimit", limit: "many", isValid: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dataSourceCfg := DataSourceConfig{Type: BOLT, Source: "ferrum.db", Options: map[DataSourceConnOption]string{}}
+			if len(tc.limit) > 0 {
+				dataSourceCfg.Options[RevisionsLimit] = tc.limit
+			}
+			err := dataSourceCfg.Validate()
+			if tc.isValid {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedLimit, dataSourceCfg.GetRevisionsLimit())
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateDataSourceAutoMigrate(t *testing.T) {
+	dataSourceCfg := DataSourceConfig{Type: POSTGRES, Source: "127.0.0.1:5432", Options: map[DataSourceConnOption]string{DbName: "ferrum"}}
+	assert.NoError(t, dataSourceCfg.Validate())
+	assert.True(t, dataSourceCfg.IsAutoMigrateEnabled())
+
+	dataSourceCfg.Options[AutoMigrate] = "false"
+	assert.NoError(t, dataSourceCfg.Validate())
+	assert.False(t, dataSourceCfg.IsAutoMigrateEnabled())
+
+	dataSourceCfg.Options[AutoMigrate] = "sometimes"
+	assert.Error(t, dataSourceCfg.Validate())
+}
+
+func TestValidateDataSourceCache(t *testing.T) {
+	dataSourceCfg := DataSourceConfig{
+		Type: REDIS, Source: "127.0.0.1:6379", Options: map[DataSourceConnOption]string{DbNumber: "0"},
+		Cache: &CacheConfig{RealmTtl: 300000, MaxUsers: 5},
+	}
+	assert.NoError(t, dataSourceCfg.Validate())
+	assert.Equal(t, 300*time.Second, dataSourceCfg.Cache.GetRealmTtl())
+	assert.Equal(t, DefaultCacheTtl, dataSourceCfg.Cache.GetUserTtl())
+	assert.Equal(t, 5, dataSourceCfg.Cache.GetMaxUsers())
+	assert.Equal(t, DefaultCacheSize, dataSourceCfg.Cache.GetMaxClients())
+
+	dataSourceCfg.Cache.ClientTtl = -1
+	assert.Error(t, dataSourceCfg.Validate())
+}
+
+func TestValidateRedisDataSourceModes(t *testing.T) {
+	testCases := []struct {
+		name              string
+		source            string
+		options           map[DataSourceConnOption]string
+		expectedMode      RedisMode
+		expectedAddresses []string
+		isValid           bool
+	}{
+		{
+			name: "Standalone", source: "127.0.0.1:6379", options: map[DataSourceConnOption]string{DbNumber: "0"},
+			expectedMode: RedisStandalone, expectedAddresses: []string{"127.0.0.1:6379"}, isValid: true,
+		},
+		{
+			name: "StandaloneWithSeveralAddresses", source: "127.0.0.1:6379,127.0.0.1:6380",
+			options: map[DataSourceConnOption]string{DbNumber: "0"}, isValid: false,
+		},
+		{
+			name: "Sentinel", source: "sentinel-1:26379, sentinel-2:26379",
+			options:      map[DataSourceConnOption]string{RedisModeOption: "sentinel", SentinelMasterName: "ferrum", DbNumber: "1"},
+			expectedMode: RedisSentinel, expectedAddresses: []string{"sentinel-1:26379", "sentinel-2:26379"}, isValid: true,
+		},
+		{
+			name: "SentinelWithoutMasterName", source: "sentinel-1:26379",
+			options: map[DataSourceConnOption]string{RedisModeOption: "sentinel", DbNumber: "1"}, isValid: false,
+		},
+		{
+			name: "Cluster", source: "node-1:6379,node-2:6379,node-3:6379",
+			options:      map[DataSourceConnOption]string{RedisModeOption: "cluster"},
+			expectedMode: RedisCluster, expectedAddresses: []string{"node-1:6379", "node-2:6379", "node-3:6379"}, isValid: true,
+		},
+		{
+			name: "ClusterWithNonZeroDbNumber", source: "node-1:6379",
+			options: map[DataSourceConnOption]string{RedisModeOption: "cluster", DbNumber: "2"}, isValid: false,
+		},
+		{
+			name: "UnknownMode", source: "127.0.0.1:6379",
+			options: map[DataSourceConnOption]string{RedisModeOption: "replicas", DbNumber: "0"}, isValid: false,
+		},
+		{
+			name: "InvalidAddress", source: "node-1:6379,node-2", options: map[DataSourceConnOption]string{RedisModeOption: "cluster"},
+			isValid: false,
+		},
+		{
+			name: "WithPoolOptions", source: "127.0.0.1:6379",
+			options: map[DataSourceConnOption]string{
+				DbNumber: "0", PoolSize: "20", MinIdleConns: "5", ReadTimeout: "-1", WriteTimeout: "500", MaxRetries: "2",
+			},
+			expectedMode: RedisStandalone, expectedAddresses: []string{"127.0.0.1:6379"}, isValid: true,
+		},
+		{
+			name: "WithNegativePoolSize", source: "127.0.0.1:6379",
+			options: map[DataSourceConnOption]string{DbNumber: "0", PoolSize: "-1"}, isValid: false,
+		},
+		{
+			name: "WithInvalidReadTimeout", source: "127.0.0.1:6379",
+			options: map[DataSourceConnOption]string{DbNumber: "0", ReadTimeout: "-2"}, isValid: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dataSourceCfg := DataSourceConfig{Type: REDIS, Source: tc.source, Options: tc.options}
+			err := dataSourceCfg.Validate()
+			if tc.isValid {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedMode, dataSourceCfg.GetRedisMode())
+				assert.Equal(t, tc.expectedAddresses, dataSourceCfg.GetRedisAddresses())
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
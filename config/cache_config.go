@@ -0,0 +1,86 @@
+package config
+
+import (
+	"errors"
+	"time"
+
+	sf "github.com/wissance/stringFormatter"
+)
+
+const (
+	// DefaultCacheTtl is a time to live of cached object if TTL of objects type wasn't configured
+	DefaultCacheTtl = 60 * time.Second
+	// DefaultCacheSize is a max number of cached objects of every type if it wasn't configured
+	DefaultCacheSize = 10000
+)
+
+// CacheConfig is a config of a read-through cache in front of data store (data_source.cache section)
+/* Cache is enabled if section exists. RealmTtl, ClientTtl and UserTtl are times to live in milliseconds of cached realms,
+ * clients and users (0 means DefaultCacheTtl). MaxRealms, MaxClients and MaxUsers are max numbers of cached objects of
+ * every type (0 means DefaultCacheSize), least recently used objects are evicted.
+ */
+type CacheConfig struct {
+	RealmTtl   int `json:"realm_ttl" example:"60000"`
+	ClientTtl  int `json:"client_ttl" example:"60000"`
+	UserTtl    int `json:"user_ttl" example:"30000"`
+	MaxRealms  int `json:"max_realms" example:"100"`
+	MaxClients int `json:"max_clients" example:"1000"`
+	MaxUsers   int `json:"max_users" example:"10000"`
+}
+
+func (cfg *CacheConfig) Validate() error {
+	values := map[string]int{
+		"realm_ttl": cfg.RealmTtl, "client_ttl": cfg.ClientTtl, "user_ttl": cfg.UserTtl,
+		"max_realms": cfg.MaxRealms, "max_clients": cfg.MaxClients, "max_users": cfg.MaxUsers,
+	}
+	for name, value := range values {
+		if value < 0 {
+			return errors.New(sf.Format("cache \"{0}\" must not be negative", name))
+		}
+	}
+	return nil
+}
+
+// GetRealmTtl returns time to live of cached realm
+func (cfg *CacheConfig) GetRealmTtl() time.Duration {
+	return getCacheTtl(cfg.RealmTtl)
+}
+
+// GetClientTtl returns time to live of cached client
+func (cfg *CacheConfig) GetClientTtl() time.Duration {
+	return getCacheTtl(cfg.ClientTtl)
+}
+
+// GetUserTtl returns time to live of cached user
+func (cfg *CacheConfig) GetUserTtl() time.Duration {
+	return getCacheTtl(cfg.UserTtl)
+}
+
+// GetMaxRealms returns max number of cached realms
+func (cfg *CacheConfig) GetMaxRealms() int {
+	return getCacheSize(cfg.MaxRealms)
+}
+
+// GetMaxClients returns max number of cached clients
+func (cfg *CacheConfig) GetMaxClients() int {
+	return getCacheSize(cfg.MaxClients)
+}
+
+// GetMaxUsers returns max number of cached users
+func (cfg *CacheConfig) GetMaxUsers() int {
+	return getCacheSize(cfg.MaxUsers)
+}
+
+func getCacheTtl(ttl int) time.Duration {
+	if ttl <= 0 {
+		return DefaultCacheTtl
+	}
+	return time.Duration(ttl) * time.Millisecond
+}
+
+func getCacheSize(size int) int {
+	if size <= 0 {
+		return DefaultCacheSize
+	}
+	return size
+}
@@ -6,30 +6,96 @@ import (
 	sf "github.com/wissance/stringFormatter"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type DataSourceType string
 type DataSourceConnOption string
 
+// RedisMode is a type of Redis deployment (RedisModeOption value)
+type RedisMode string
+
 const (
 	FILE DataSourceType = "file"
 	// MONGODB TODO (UMV): Mongo won't be using for sometime, maybe it will be removed completely
 	MONGODB DataSourceType = "mongodb"
 	// REDIS : redis server should be running with dump every write on a disk (AOF)
 	REDIS DataSourceType = "redis"
+	// BOLT : embedded transactional on-disk data store (bbolt), it doesn't require any server, but database file could be opened only
+	// by one process at a time
+	BOLT DataSourceType = "bolt"
+	// POSTGRES : PostgreSQL server, database schema is created and migrated on start
+	POSTGRES DataSourceType = "postgres"
 )
 
 const (
 	// DbNumber is a REDIS connection options, here we expect to receive int in a string
 	DbNumber DataSourceConnOption = "db_number"
-	// UseTls is a REDIS option to set up tls.Config and use TLS connection, here we expect to receive bool value in a string
+	// UseTls is a REDIS and POSTGRES option to set up tls.Config and use TLS connection, here we expect to receive bool value in a string
 	UseTls DataSourceConnOption = "use_tls"
-	// InsecureTls is a REDIS option to set up TLSConfig: &tls.Config{InsecureSkipVerify: true}, here we expect to receive bool value in a string
+	// InsecureTls is a REDIS and POSTGRES option to set up TLSConfig: &tls.Config{InsecureSkipVerify: true}, here we expect to receive bool value in a string
 	InsecureTls DataSourceConnOption = "allow_insecure_tls"
-	// Namespace is a prefix before any key
+	// Namespace is a prefix before any key (REDIS, all keys of namespace are stored in one slot in RedisCluster mode) or a database
+	// schema name (POSTGRES)
 	Namespace DataSourceConnOption = "namespace"
+	// DbName is a POSTGRES connection option, name of a database
+	DbName DataSourceConnOption = "db_name"
+	// SaveDelay is a FILE option, delay in milliseconds of data file saving after change, changes made during delay are saved
+	// together (0 or absent option means saving on every change), here we expect to receive int in a string
+	SaveDelay DataSourceConnOption = "save_delay"
+	// ReloadInterval is a FILE option, interval in milliseconds of data file changes checking, changed data file is reloaded
+	// (absent option means DefaultReloadInterval, 0 disables reloading), here we expect to receive int in a string
+	ReloadInterval DataSourceConnOption = "reload_interval"
+	// DataOperationTimeout is a REDIS and POSTGRES option (Redis session store uses it too), deadline in milliseconds of every
+	// data store operation, operation that didn't complete in time is cancelled and data store is treated as not available
+	// (absent option means DefaultOperationTimeout, 0 disables deadline), here we expect to receive int in a string
+	DataOperationTimeout DataSourceConnOption = "operation_timeout"
+	// RedisModeOption is a REDIS option, type of Redis deployment (RedisStandalone if option is absent), in RedisSentinel and RedisCluster
+	// modes source contains comma separated addresses of sentinels or cluster nodes
+	RedisModeOption DataSourceConnOption = "redis_mode"
+	// SentinelMasterName is a REDIS option, name of master that is monitored by sentinels, it is required in RedisSentinel mode
+	SentinelMasterName DataSourceConnOption = "sentinel_master_name"
+	// SentinelPassword is a REDIS option, password of sentinels (if they require authentication) in RedisSentinel mode
+	SentinelPassword DataSourceConnOption = "sentinel_password"
+	// PoolSize is a REDIS option, max number of connections (per node in RedisCluster mode), here we expect to receive int in a string
+	PoolSize DataSourceConnOption = "pool_size"
+	// MinIdleConns is a REDIS option, min number of idle connections, here we expect to receive int in a string
+	MinIdleConns DataSourceConnOption = "min_idle_conns"
+	// ReadTimeout is a REDIS option, timeout in milliseconds of socket reads (-1 means no timeout), here we expect to receive int in a string
+	ReadTimeout DataSourceConnOption = "read_timeout"
+	// WriteTimeout is a REDIS option, timeout in milliseconds of socket writes (-1 means no timeout), here we expect to receive int in a string
+	WriteTimeout DataSourceConnOption = "write_timeout"
+	// MaxRetries is a REDIS option, max number of command retries (-1 disables retries), here we expect to receive int in a string
+	MaxRetries DataSourceConnOption = "max_retries"
+	// RevisionsLimit is an option of all data stores, max number of kept revisions (see data.Revision) of every realm and client,
+	// the oldest revisions are removed (absent option means DefaultRevisionsLimit, 0 disables history), here we expect to receive int in a string
+	RevisionsLimit DataSourceConnOption = "revisions_limit"
+	// AutoMigrate is a REDIS and POSTGRES option, whether stored data is migrated to the current data schema version on start (absent
+	// option means true), if it is false data must be migrated by admin CLI migrate operation, otherwise data store is not available
+	// until data is migrated, here we expect to receive bool value in a string
+	AutoMigrate DataSourceConnOption = "auto_migrate"
 )
 
+const (
+	// RedisStandalone is a single Redis server, source is a server address
+	RedisStandalone RedisMode = "standalone"
+	// RedisSentinel is Redis master that is managed by sentinels (failover), source is a list of sentinels addresses
+	RedisSentinel RedisMode = "sentinel"
+	// RedisCluster is a Redis Cluster, source is a list of cluster nodes addresses (all nodes are discovered from any of them).
+	// Namespace is a hash tag in this mode, all keys of namespace are stored in one slot (data of one namespace is not sharded),
+	// because transactions that change several realms (i.e. realm rename) are allowed only for keys of one slot
+	RedisCluster RedisMode = "cluster"
+)
+
+// DefaultRevisionsLimit is a max number of kept revisions of every realm and client if RevisionsLimit option is absent
+const DefaultRevisionsLimit = 20
+
+// DefaultReloadInterval is an interval of data file changes checking if ReloadInterval option is absent
+const DefaultReloadInterval = 5 * time.Second
+
+// DefaultOperationTimeout is a deadline of every data store operation if DataOperationTimeout option is absent
+const DefaultOperationTimeout = 5 * time.Second
+
 var (
 	SourceISEmpty error = errors.New("field source (path to file or conn str to db) is empty")
 )
@@ -41,17 +107,20 @@ var (
  * - mongodb (but here we have very simple question how to pass parameters)
  * Source contains:
  * 1) if Type is FILE - full path to Json File
- * 2) if Type is REDIS - redis server address i.e. localhost:6739
+ * 2) if Type is REDIS - redis server address i.e. localhost:6739 (or comma separated sentinels or cluster nodes addresses, see RedisModeOption)
+ * 3) if Type is BOLT - path to database file (it is created if it doesn't exist)
+ * 4) if Type is POSTGRES - postgres server address i.e. localhost:5432
  * Options are connection options, see - https://www.mongodb.com/docs/drivers/go/current/fundamentals/connection/#std-label-golang-connection-guide
  * Here we should have Validator too
  * Credentials contains Username && Password could be null id authorization is not required:
- *
+ * Cache is a config of read-through cache in front of data store (cache is disabled if it is nil)
  */
 type DataSourceConfig struct {
 	Type        DataSourceType                  `json:"type"`
 	Source      string                          `json:"source"`
 	Credentials *CredentialsConfig              `json:"credentials"`
 	Options     map[DataSourceConnOption]string `json:"options"`
+	Cache       *CacheConfig                    `json:"cache"`
 }
 
 func (cfg *DataSourceConfig) Validate() error {
@@ -62,27 +131,83 @@ func (cfg *DataSourceConfig) Validate() error {
 	if cfg.Type == MONGODB {
 		return errors.New("mongodb is not supported ")
 	}
+	if cfg.Cache != nil {
+		if err := cfg.Cache.Validate(); err != nil {
+			return err
+		}
+	}
+	if operationTimeout, ok := cfg.Options[DataOperationTimeout]; ok {
+		timeout, err := strconv.Atoi(operationTimeout)
+		if err != nil || timeout < 0 {
+			return errors.New("\"operation_timeout\" config option must be non negative int value")
+		}
+	}
+	if revisionsLimit, ok := cfg.Options[RevisionsLimit]; ok {
+		limit, err := strconv.Atoi(revisionsLimit)
+		if err != nil || limit < 0 {
+			return errors.New("\"revisions_limit\" config option must be non negative int value")
+		}
+	}
+	if autoMigrate, ok := cfg.Options[AutoMigrate]; ok && !validators.IsStrValueOfRequiredType(validators.Boolean, &autoMigrate) {
+		return errors.New("\"auto_migrate\" config option must be bool value")
+	}
 	if cfg.Type == REDIS {
+		redisMode := cfg.GetRedisMode()
+		if redisMode != RedisStandalone && redisMode != RedisSentinel && redisMode != RedisCluster {
+			return errors.New(sf.Format("\"redis_mode\" redis config option must be one of: {0}, {1}, {2}", RedisStandalone,
+				RedisSentinel, RedisCluster))
+		}
 		// 1. Check whether source contains address or not
-		// 1.1 Check format
-		parts := strings.Split(cfg.Source, ":")
-		if len(parts) != 2 {
+		addresses := cfg.GetRedisAddresses()
+		if redisMode == RedisStandalone && len(addresses) != 1 {
 			return errors.New("field source for Redis datasource must contain pair IP Address/Domain Name:Port, i.e. 127.0.0.1:6379")
 		}
-		// 1.2
-		// todo(UMV): check IP Address / Domain Name is Valid
-		_, err := strconv.Atoi(parts[1])
-		if err != nil {
-			return errors.New(sf.Format("second part must be integer value, got parsing error: {0}", err.Error()))
+		for _, address := range addresses {
+			// 1.1 Check format
+			parts := strings.Split(address, ":")
+			if len(parts) != 2 {
+				return errors.New("field source for Redis datasource must contain pair(s) IP Address/Domain Name:Port, i.e. 127.0.0.1:6379")
+			}
+			// 1.2
+			// todo(UMV): check IP Address / Domain Name is Valid
+			_, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return errors.New(sf.Format("second part must be integer value, got parsing error: {0}", err.Error()))
+			}
 		}
-		// 1.3 Check we have following required fields: dbNumber
+		// 1.3 Check we have following required fields: dbNumber (Redis Cluster has only database 0)
 		dbNumber, ok := cfg.Options[DbNumber]
-		if !ok {
+		if !ok && redisMode != RedisCluster {
 			return errors.New("config must contain \"db_number\" in options")
 		}
-		checkResult := validators.IsStrValueOfRequiredType(validators.Integer, &dbNumber)
-		if !checkResult {
-			return errors.New("\"db_number\" redis config options must be int value")
+		if ok {
+			checkResult := validators.IsStrValueOfRequiredType(validators.Integer, &dbNumber)
+			if !checkResult {
+				return errors.New("\"db_number\" redis config options must be int value")
+			}
+			if redisMode == RedisCluster && dbNumber != "0" {
+				return errors.New("\"db_number\" redis config option must be 0 in cluster mode")
+			}
+		}
+		if masterName := cfg.Options[SentinelMasterName]; redisMode == RedisSentinel && len(masterName) == 0 {
+			return errors.New("config must contain \"sentinel_master_name\" in options in sentinel mode")
+		}
+		// 1.4 Check connection pool options
+		for _, option := range []DataSourceConnOption{PoolSize, MinIdleConns} {
+			if value, ok := cfg.Options[option]; ok {
+				intValue, err := strconv.Atoi(value)
+				if err != nil || intValue < 0 {
+					return errors.New(sf.Format("\"{0}\" redis config option must be non negative int value", option))
+				}
+			}
+		}
+		for _, option := range []DataSourceConnOption{ReadTimeout, WriteTimeout, MaxRetries} {
+			if value, ok := cfg.Options[option]; ok {
+				intValue, err := strconv.Atoi(value)
+				if err != nil || intValue < -1 {
+					return errors.New(sf.Format("\"{0}\" redis config option must be int value that is not less than -1", option))
+				}
+			}
 		}
 		return nil
 	}
@@ -103,5 +228,115 @@ func (cfg *DataSourceConfig) Validate() error {
 		}*/
 		return errors.New("MongoDB is not supported")
 	}
+	if cfg.Type == POSTGRES {
+		parts := strings.Split(cfg.Source, ":")
+		if len(parts) != 2 {
+			return errors.New("field source for Postgres datasource must contain pair IP Address/Domain Name:Port, i.e. 127.0.0.1:5432")
+		}
+		if _, err := strconv.Atoi(parts[1]); err != nil {
+			return errors.New(sf.Format("second part must be integer value, got parsing error: {0}", err.Error()))
+		}
+		if dbName, ok := cfg.Options[DbName]; !ok || len(dbName) == 0 {
+			return errors.New("config must contain \"db_name\" in options")
+		}
+		for _, option := range []DataSourceConnOption{UseTls, InsecureTls} {
+			if value, ok := cfg.Options[option]; ok && !validators.IsStrValueOfRequiredType(validators.Boolean, &value) {
+				return errors.New(sf.Format("\"{0}\" postgres config option must be bool value", option))
+			}
+		}
+		return nil
+	}
+	if cfg.Type == FILE {
+		if saveDelay, ok := cfg.Options[SaveDelay]; ok {
+			delay, err := strconv.Atoi(saveDelay)
+			if err != nil || delay < 0 {
+				return errors.New("\"save_delay\" file config option must be non negative int value")
+			}
+		}
+		if reloadInterval, ok := cfg.Options[ReloadInterval]; ok {
+			interval, err := strconv.Atoi(reloadInterval)
+			if err != nil || interval < 0 {
+				return errors.New("\"reload_interval\" file config option must be non negative int value")
+			}
+		}
+	}
 	return nil
 }
+
+// GetRedisMode returns REDIS data source deployment type (RedisModeOption option), RedisStandalone if option is absent
+func (cfg *DataSourceConfig) GetRedisMode() RedisMode {
+	redisMode, ok := cfg.Options[RedisModeOption]
+	if !ok || len(redisMode) == 0 {
+		return RedisStandalone
+	}
+	return RedisMode(redisMode)
+}
+
+// GetRedisAddresses returns REDIS data source addresses (source is split by comma)
+func (cfg *DataSourceConfig) GetRedisAddresses() []string {
+	var addresses []string
+	for _, address := range strings.Split(cfg.Source, ",") {
+		if address = strings.TrimSpace(address); len(address) > 0 {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// GetSaveDelay returns FILE data source delay of data file saving after change (SaveDelay option), 0 means no delay
+func (cfg *DataSourceConfig) GetSaveDelay() time.Duration {
+	delay, err := strconv.Atoi(cfg.Options[SaveDelay])
+	if err != nil || delay < 0 {
+		return 0
+	}
+	return time.Duration(delay) * time.Millisecond
+}
+
+// GetReloadInterval returns FILE data source interval of data file changes checking (ReloadInterval option), 0 means that
+// data file is not reloaded
+func (cfg *DataSourceConfig) GetReloadInterval() time.Duration {
+	reloadInterval, ok := cfg.Options[ReloadInterval]
+	if !ok {
+		return DefaultReloadInterval
+	}
+	interval, err := strconv.Atoi(reloadInterval)
+	if err != nil || interval < 0 {
+		return DefaultReloadInterval
+	}
+	return time.Duration(interval) * time.Millisecond
+}
+
+// GetOperationTimeout returns deadline of every data store operation (DataOperationTimeout option), 0 means that operations
+// have no deadline
+func (cfg *DataSourceConfig) GetOperationTimeout() time.Duration {
+	operationTimeout, ok := cfg.Options[DataOperationTimeout]
+	if !ok {
+		return DefaultOperationTimeout
+	}
+	timeout, err := strconv.Atoi(operationTimeout)
+	if err != nil || timeout < 0 {
+		return DefaultOperationTimeout
+	}
+	return time.Duration(timeout) * time.Millisecond
+}
+
+// GetRevisionsLimit returns max number of kept revisions of every realm and client (RevisionsLimit option), 0 means that history
+// is not kept
+func (cfg *DataSourceConfig) GetRevisionsLimit() int {
+	revisionsLimit, ok := cfg.Options[RevisionsLimit]
+	if !ok {
+		return DefaultRevisionsLimit
+	}
+	limit, err := strconv.Atoi(revisionsLimit)
+	if err != nil || limit < 0 {
+		return DefaultRevisionsLimit
+	}
+	return limit
+}
+
+// IsAutoMigrateEnabled returns whether stored data is migrated to the current data schema version on start (AutoMigrate option),
+// true if option is absent
+func (cfg *DataSourceConfig) IsAutoMigrateEnabled() bool {
+	autoMigrate, err := strconv.ParseBool(cfg.Options[AutoMigrate])
+	return err != nil || autoMigrate
+}
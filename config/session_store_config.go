@@ -0,0 +1,59 @@
+package config
+
+import (
+	"errors"
+	"time"
+
+	sf "github.com/wissance/stringFormatter"
+)
+
+type SessionStoreType string
+
+const (
+	// MemorySessionStore : sessions are storing in a process memory, they are lost on restart and are not shared between instances
+	MemorySessionStore SessionStoreType = "memory"
+	// RedisSessionStore : sessions are storing in Redis configured in a DataSourceConfig (data_source section)
+	RedisSessionStore SessionStoreType = "redis"
+)
+
+// DefaultSessionsCleanupInterval is an interval (in seconds) of expired sessions removing if it wasn't configured
+const DefaultSessionsCleanupInterval = 60
+
+// SessionStoreConfig is a config of a storage of users sessions
+/* Type could be empty, in this case MemorySessionStore is using. RedisSessionStore requires data source type REDIS,
+ * sessions are storing in the same Redis and namespace as other data.
+ * CleanupInterval is an interval in seconds between expired sessions removing, 0 means DefaultSessionsCleanupInterval
+ */
+type SessionStoreConfig struct {
+	Type            SessionStoreType `json:"type" example:"memory or redis"`
+	CleanupInterval int              `json:"cleanup_interval" example:"60"`
+}
+
+func (cfg *SessionStoreConfig) Validate() error {
+	if cfg.CleanupInterval < 0 {
+		return errors.New("session store cleanup interval must not be negative")
+	}
+	if cfg.Type == "" || cfg.Type == MemorySessionStore || cfg.Type == RedisSessionStore {
+		return nil
+	}
+	return errors.New(sf.Format("session store type \"{0}\" is not supported", cfg.Type))
+}
+
+// GetCleanupInterval returns configured interval of expired sessions removing or default one
+func (cfg *SessionStoreConfig) GetCleanupInterval() time.Duration {
+	if cfg.CleanupInterval <= 0 {
+		return DefaultSessionsCleanupInterval * time.Second
+	}
+	return time.Duration(cfg.CleanupInterval) * time.Second
+}
+
+// ValidateWithDataSource checks that session store could be used with configured data source
+func (cfg *SessionStoreConfig) ValidateWithDataSource(dataSourceCfg *DataSourceConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if cfg.Type == RedisSessionStore && dataSourceCfg.Type != REDIS {
+		return errors.New("redis session store requires \"redis\" data source")
+	}
+	return nil
+}
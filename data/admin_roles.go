@@ -0,0 +1,101 @@
+package data
+
+import "github.com/wissance/Ferrum/globals"
+
+// AdminRole is a role that grants access to admin operations (HTTP admin API and admin CLI) over one realm
+type AdminRole string
+
+const (
+	// RealmAdmin is a composite role that includes all other admin roles
+	RealmAdmin AdminRole = "realm-admin"
+	// ManageRealm allows to change realm settings, delete realm and revoke all realm sessions (includes ViewRealm)
+	ManageRealm AdminRole = "manage-realm"
+	// ViewRealm allows to read realm settings and user federation configs
+	ViewRealm AdminRole = "view-realm"
+	// ManageUsers allows to create, change and delete users and to terminate users sessions (includes ViewUsers)
+	ManageUsers AdminRole = "manage-users"
+	// ViewUsers allows to read users and sessions
+	ViewUsers AdminRole = "view-users"
+	// ManageClients allows to create, change and delete clients (includes ViewClients)
+	ManageClients AdminRole = "manage-clients"
+	// ViewClients allows to read clients and their secrets
+	ViewClients AdminRole = "view-clients"
+	// ManageFederation allows to create, change and delete user federation configs
+	ManageFederation AdminRole = "manage-federation"
+)
+
+// AllRealms is an admin roles scope that grants roles for every realm, it is applicable only for master realm users
+// (creation of a new realm requires ManageRealm in this scope)
+const AllRealms = "*"
+
+// impliedAdminRoles are roles that are granted with a role (except RealmAdmin that grants all roles)
+var impliedAdminRoles = map[AdminRole][]AdminRole{
+	ManageRealm:   {ViewRealm},
+	ManageUsers:   {ViewUsers},
+	ManageClients: {ViewClients},
+}
+
+// HasAdminRole checks whether user has at least one of roles for targetRealm
+/* User admin roles are stored by scope (realm name or AllRealms). User of master realm could have roles for any realm (own scope
+ * of the realm or AllRealms scope), user of other realm has only roles of own realm scope, therefore realm admin is able to
+ * manage only own realm. Composite (RealmAdmin) and implied (i.e. ManageUsers includes ViewUsers) roles are considered.
+ * Parameters:
+ *     - user - user to check, nil user doesn't have any roles
+ *     - userRealm - name of a realm that user belongs to
+ *     - targetRealm - name of a realm that is administered or AllRealms for operations that are not related to one realm
+ *     - roles - acceptable roles, any of them grants access
+ * Returns: true if user has any of roles
+ */
+func HasAdminRole(user User, userRealm string, targetRealm string, roles ...AdminRole) bool {
+	if user == nil {
+		return false
+	}
+	if userRealm != globals.MasterRealm && userRealm != targetRealm {
+		return false
+	}
+	adminRoles := user.GetAdminRoles()
+	scopes := []string{targetRealm}
+	if userRealm == globals.MasterRealm && targetRealm != AllRealms {
+		scopes = append(scopes, AllRealms)
+	}
+	for _, scope := range scopes {
+		for _, granted := range adminRoles[scope] {
+			for _, role := range roles {
+				if isRoleGranted(granted, role) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// CanChangeAdminRoles checks whether user is able to change (grant or revoke) admin roles of users of targetRealm
+/* It also protects administrators accounts: changing (i.e. password) or removing a user who has admin roles requires same
+ * permission, otherwise user with ManageUsers could take over the account of more privileged administrator.
+ * Admin roles of master realm users could be changed only by RealmAdmin of AllRealms scope, admin roles of other realm
+ * users - by RealmAdmin of this realm.
+ * Parameters:
+ *     - user - user to check
+ *     - userRealm - name of a realm that user belongs to
+ *     - targetRealm - name of a realm whose user admin roles are changing
+ * Returns: true if user is allowed to change admin roles
+ */
+func CanChangeAdminRoles(user User, userRealm string, targetRealm string) bool {
+	if targetRealm == globals.MasterRealm {
+		return HasAdminRole(user, userRealm, AllRealms, RealmAdmin)
+	}
+	return HasAdminRole(user, userRealm, targetRealm, RealmAdmin)
+}
+
+func isRoleGranted(granted AdminRole, required AdminRole) bool {
+	if granted == required || granted == RealmAdmin {
+		return true
+	}
+	for _, implied := range impliedAdminRoles[granted] {
+		if implied == required {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasAdminRole(t *testing.T) {
+	testCases := []struct {
+		name        string
+		adminRoles  string
+		userRealm   string
+		targetRealm string
+		roles       []AdminRole
+		expected    bool
+	}{
+		{name: "no_admin_roles", adminRoles: `null`, userRealm: "master", targetRealm: "myapp", roles: []AdminRole{ViewUsers}},
+		{name: "bad_admin_roles", adminRoles: `["realm-admin"]`, userRealm: "master", targetRealm: "myapp", roles: []AdminRole{ViewUsers}},
+		{
+			name: "master_user_all_realms_role", adminRoles: `{"*": ["realm-admin"]}`, userRealm: "master", targetRealm: "myapp",
+			roles: []AdminRole{ManageFederation}, expected: true,
+		},
+		{
+			name: "master_user_all_realms_scope", adminRoles: `{"*": ["manage-realm"]}`, userRealm: "master", targetRealm: AllRealms,
+			roles: []AdminRole{ManageRealm}, expected: true,
+		},
+		{
+			name: "master_user_realm_role", adminRoles: `{"myapp": ["manage-users"]}`, userRealm: "master", targetRealm: "myapp",
+			roles: []AdminRole{ViewUsers}, expected: true,
+		},
+		{
+			name: "master_user_other_realm_role", adminRoles: `{"myapp": ["realm-admin"]}`, userRealm: "master", targetRealm: "other",
+			roles: []AdminRole{ViewUsers},
+		},
+		{
+			name: "master_user_realm_scope_is_not_all_realms", adminRoles: `{"myapp": ["realm-admin"]}`, userRealm: "master",
+			targetRealm: AllRealms, roles: []AdminRole{ManageRealm},
+		},
+		{
+			name: "view_role_does_not_include_manage", adminRoles: `{"myapp": ["view-users"]}`, userRealm: "master", targetRealm: "myapp",
+			roles: []AdminRole{ManageUsers},
+		},
+		{
+			name: "any_of_roles", adminRoles: `{"myapp": ["manage-federation"]}`, userRealm: "master", targetRealm: "myapp",
+			roles: []AdminRole{ViewRealm, ManageFederation}, expected: true,
+		},
+		{
+			name: "realm_admin_own_realm", adminRoles: `{"myapp": ["manage-clients"]}`, userRealm: "myapp", targetRealm: "myapp",
+			roles: []AdminRole{ViewClients}, expected: true,
+		},
+		{
+			name: "realm_admin_other_realm", adminRoles: `{"other": ["realm-admin"]}`, userRealm: "myapp", targetRealm: "other",
+			roles: []AdminRole{ViewUsers},
+		},
+		{
+			name: "realm_user_all_realms_scope_is_ignored", adminRoles: `{"*": ["realm-admin"]}`, userRealm: "myapp", targetRealm: "myapp",
+			roles: []AdminRole{ViewUsers},
+		},
+	}
+
+	for _, tCase := range testCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			var rawUserData interface{}
+			err := json.Unmarshal([]byte(`{"info":{"preferred_username": "admin"}, "admin_roles": `+tCase.adminRoles+`}`), &rawUserData)
+			assert.NoError(t, err)
+			user := CreateUser(rawUserData, nil)
+			assert.Equal(t, tCase.expected, HasAdminRole(user, tCase.userRealm, tCase.targetRealm, tCase.roles...))
+		})
+	}
+}
+
+func TestCanChangeAdminRoles(t *testing.T) {
+	var rawUserData interface{}
+	err := json.Unmarshal([]byte(`{"info":{"preferred_username": "admin"}, "admin_roles": {"myapp": ["realm-admin"], "master": ["realm-admin"]}}`),
+		&rawUserData)
+	assert.NoError(t, err)
+	user := CreateUser(rawUserData, nil)
+	assert.True(t, CanChangeAdminRoles(user, "master", "myapp"))
+	assert.False(t, CanChangeAdminRoles(user, "master", "master"))
+	assert.False(t, CanChangeAdminRoles(user, "master", "other"))
+	assert.False(t, CanChangeAdminRoles(nil, "master", "myapp"))
+}
@@ -7,6 +7,9 @@ const (
 	ClientIdAndSecrets AuthenticationType = 1
 )
 
+// SecretMask is a value that is shown instead of secrets (i.e. in admin API responses and in revisions history)
+const SecretMask = "**********"
+
 // Authentication struct for Clients authentication data, for ClientIdAndSecrets Value stores ClientSecret
 type Authentication struct {
 	Type       AuthenticationType
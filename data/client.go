@@ -13,9 +13,13 @@ const (
 )
 
 // Client is a realm client, represents an application nad set of rules for interacting with Authorization server
+/* RefreshTokenRotation overrides Realm.RefreshTokenRotation policy for this client if it is set
+ */
 type Client struct {
-	Type ClientType
-	ID   uuid.UUID
-	Name string
-	Auth Authentication
+	Type                 ClientType
+	ID                   uuid.UUID
+	Name                 string
+	Auth                 Authentication
+	RefreshTokenRotation *bool `json:"refresh_token_rotation,omitempty"`
+	Version              int64 `json:"version,omitempty"`
 }
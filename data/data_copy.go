@@ -0,0 +1,47 @@
+package data
+
+// ConflictStrategy defines what data copying does with objects that already exist in a target data store
+type ConflictStrategy string
+
+const (
+	// SkipExisting : existing objects are kept as they are
+	SkipExisting ConflictStrategy = "skip"
+	// OverwriteExisting : existing objects are updated with copied data (realm password salt is never changed)
+	OverwriteExisting ConflictStrategy = "overwrite"
+	// FailOnExisting : nothing is copied if any of copied objects exists
+	FailOnExisting ConflictStrategy = "fail"
+)
+
+// CopyAction is what data copying does (or would do on dry run) with a copied object
+type CopyAction string
+
+const (
+	CopyCreated  CopyAction = "created"
+	CopyUpdated  CopyAction = "updated"
+	CopySkipped  CopyAction = "skipped"
+	CopyConflict CopyAction = "conflict"
+)
+
+// CopiedObject is a realm (settings) or a realm object (client, user or user federation config) that is copied between data stores
+/* Type is one of realm, client, user or user_federation, Name is a realm name for realm and object name for other types
+ */
+type CopiedObject struct {
+	Realm  string     `json:"realm"`
+	Type   string     `json:"type"`
+	Name   string     `json:"name"`
+	Action CopyAction `json:"action"`
+}
+
+// CopyReport is a result of data copying between data stores
+/* Objects are copied objects in order of copying, Created, Updated and Skipped are numbers of objects by action. If DryRun
+ * is true nothing is copied, Objects are actions that would be done. If copying fails because of FailOnExisting conflicts
+ * Objects contains all planned actions (existing objects have CopyConflict action).
+ */
+type CopyReport struct {
+	DryRun     bool             `json:"dry_run"`
+	OnConflict ConflictStrategy `json:"on_conflict"`
+	Created    int              `json:"created"`
+	Updated    int              `json:"updated"`
+	Skipped    int              `json:"skipped"`
+	Objects    []CopiedObject   `json:"objects"`
+}
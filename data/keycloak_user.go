@@ -11,6 +11,8 @@ import (
 
 const (
 	pathToPassword = "credentials.password"
+	adminRolesKey  = "admin_roles"
+	versionKey     = "version"
 )
 
 // KeyCloakUser this structure is for user data that looks similar to KeyCloak, Users in Keycloak have info field with preferred_username and sub
@@ -90,6 +92,61 @@ func (user *KeyCloakUser) GetId() uuid.UUID {
 	return id
 }
 
+// GetEmail returns user email as it stores in KeyCloak
+/* this function use internal map to navigate over info.email keys
+ * Parameters: no
+ * Returns: email or empty string if user doesn't have email
+ */
+func (user *KeyCloakUser) GetEmail() string {
+	return getPathStringValue[string](user.rawData, "info.email")
+}
+
+// IsEnabled returns user enabled flag as it stores in KeyCloak
+/* this function reads top level enabled key, user without this key (or with non-boolean value) is enabled
+ * Parameters: no
+ * Returns: true if user is enabled
+ */
+func (user *KeyCloakUser) IsEnabled() bool {
+	rawData, _ := user.rawData.(map[string]interface{})
+	enabled, ok := rawData["enabled"].(bool)
+	return !ok || enabled
+}
+
+// GetVersion returns version of stored user (see NoExpectedVersion)
+/* this function reads top level version key, user without this key (or with non-numeric value) has version 0
+ * Parameters: no
+ * Returns: user version
+ */
+func (user *KeyCloakUser) GetVersion() int64 {
+	rawData, _ := user.rawData.(map[string]interface{})
+	switch version := rawData[versionKey].(type) {
+	case float64:
+		return int64(version)
+	case int64:
+		return version
+	case int:
+		return int64(version)
+	case json.Number:
+		value, _ := version.Int64()
+		return value
+	}
+	return 0
+}
+
+// SetVersion sets top level version key in the user's rawData and jsonRawData
+/* Parameters:
+ *    - version - new version
+ */
+func (user *KeyCloakUser) SetVersion(version int64) {
+	rawData, ok := user.rawData.(map[string]interface{})
+	if !ok {
+		return
+	}
+	rawData[versionKey] = version
+	jsonData, _ := json.Marshal(&user.rawData)
+	user.jsonRawData = string(jsonData)
+}
+
 // GetUserInfo returns Json with all non-confidential user data as KeyCloak do
 /* this function use internal map to navigate over key info ant retrieve all public userinfo
  * Parameters: no
@@ -123,6 +180,33 @@ func (user *KeyCloakUser) GetFederationId() string {
 	return result
 }
 
+// GetAdminRoles returns user admin roles by scope
+/* this function reads top level admin_roles key, admin_roles is an object with realm name (or AllRealms)
+ * as a key and array of roles as a value, i.e. {"myapp": ["manage-users"]}, values of other types are skipped
+ * Parameters: no
+ * Returns: admin roles by scope, empty map if user doesn't have admin roles
+ */
+func (user *KeyCloakUser) GetAdminRoles() map[string][]AdminRole {
+	result := map[string][]AdminRole{}
+	rawData, _ := user.rawData.(map[string]interface{})
+	scopes, ok := rawData[adminRolesKey].(map[string]interface{})
+	if !ok {
+		return result
+	}
+	for scope, roles := range scopes {
+		rolesList, isList := roles.([]interface{})
+		if !isList {
+			continue
+		}
+		for _, r := range rolesList {
+			if role, isString := r.(string); isString {
+				result[scope] = append(result[scope], AdminRole(role))
+			}
+		}
+	}
+	return result
+}
+
 // getPathStringValue is a generic function to get actually map by key, key represents as a jsonpath navigation property
 /* this function uses json path to navigate over nested maps and return any required type
  * Parameters:
@@ -17,10 +17,11 @@ func TestInitUserWithJsonAndCheck(t *testing.T) {
 		isFederated       bool
 		userTemplate      string
 		federationId      string
+		email             string
 	}{
 		{
-			name: "simple_user", userName: "admin", preferredUsername: "Administrator", isFederated: false,
-			userTemplate: `{"info":{"name":"{0}", "preferred_username": "{1}"}}`,
+			name: "simple_user", userName: "admin", preferredUsername: "Administrator", isFederated: false, email: "admin@wissance.com",
+			userTemplate: `{"info":{"name":"{0}", "preferred_username": "{1}", "email": "admin@wissance.com"}}`,
 		},
 		{
 			name: "federated_user", userName: `m.ushakov`, preferredUsername: "m.ushakov", isFederated: true, federationId: "Wissance_test_domain",
@@ -42,9 +43,32 @@ func TestInitUserWithJsonAndCheck(t *testing.T) {
 			user := CreateUser(rawUserData, encoder)
 			assert.Equal(t, tCase.preferredUsername, user.GetUsername())
 			assert.Equal(t, tCase.isFederated, user.IsFederatedUser())
+			assert.Equal(t, tCase.email, user.GetEmail())
 			if user.IsFederatedUser() {
 				assert.Equal(t, tCase.federationId, user.GetFederationId())
 			}
 		})
 	}
 }
+
+func TestUserVersion(t *testing.T) {
+	var rawUserData interface{}
+	err := json.Unmarshal([]byte(`{"info":{"preferred_username": "admin"}, "credentials": {"password": "hash"}}`), &rawUserData)
+	assert.NoError(t, err)
+	user := CreateUser(rawUserData, nil)
+	assert.Equal(t, NoExpectedVersion, user.GetVersion())
+	assert.NoError(t, CheckVersion("user", "admin", 5, user.GetVersion()))
+
+	versioned := CreateUserWithVersion(user, 5)
+	assert.Equal(t, int64(5), versioned.GetVersion())
+	assert.Equal(t, NoExpectedVersion, user.GetVersion())
+	assert.Equal(t, "hash", versioned.GetPasswordHash())
+	assert.NoError(t, CheckVersion("user", "admin", 5, versioned.GetVersion()))
+	assert.Error(t, CheckVersion("user", "admin", 6, versioned.GetVersion()))
+
+	// version is kept when user is read back from json (i.e. from data store)
+	var storedRawData interface{}
+	err = json.Unmarshal([]byte(versioned.GetJsonString()), &storedRawData)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), CreateUser(storedRawData, nil).GetVersion())
+}
@@ -0,0 +1,45 @@
+package data
+
+import "context"
+
+// Migration is a versioned change of stored data schema (keys or tables layout and json shape of stored objects)
+/* Data stores that keep versioned data schema (see managers.SchemaMigrator) store version of the latest applied migration,
+ * migrations are applied in order of versions and every migration is applied once. Migrations must be idempotent because
+ * several application instances could apply them simultaneously.
+ */
+type Migration struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+}
+
+// MigrationReport is a result of data schema migration
+/* SchemaVersion is a version of data schema before migration, TargetVersion is the latest known version (data has it after
+ * migration), Migrations are applied migrations in order of applying (migrations that would be applied if DryRun is true)
+ */
+type MigrationReport struct {
+	SchemaVersion int         `json:"schema_version"`
+	TargetVersion int         `json:"target_version"`
+	Migrations    []Migration `json:"migrations"`
+	DryRun        bool        `json:"dry_run"`
+}
+
+// outdatedDataReadingKey is a context.Context key of outdated data reading permission
+type outdatedDataReadingKey struct{}
+
+// WithOutdatedDataReading returns context that allows data store to read data which is not migrated yet
+/* Data stores that are not available until data is migrated (config.AutoMigrate is false) read outdated data with this context,
+ * admin CLI uses it to authenticate administrator before migration. Context must be used only for reading, realm and user objects
+ * must be readable regardless of data version.
+ * Parameters:
+ *    - ctx - parent context
+ * Returns: context that allows outdated data reading
+ */
+func WithOutdatedDataReading(ctx context.Context) context.Context {
+	return context.WithValue(ctx, outdatedDataReadingKey{}, true)
+}
+
+// IsOutdatedDataReading checks whether context allows to read data which is not migrated yet (see WithOutdatedDataReading)
+func IsOutdatedDataReading(ctx context.Context) bool {
+	allowed, _ := ctx.Value(outdatedDataReadingKey{}).(bool)
+	return allowed
+}
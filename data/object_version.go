@@ -0,0 +1,44 @@
+package data
+
+import (
+	"encoding/json"
+
+	appErrs "github.com/wissance/Ferrum/errors"
+)
+
+// NoExpectedVersion is an expected version that means update regardless of stored object version
+/* Realm, Client and User have a version that is used for optimistic concurrency control: data store sets version 1 on object
+ * creation and increments version on every update. Update takes an expected version (version of updated object), if it is not
+ * NoExpectedVersion it must be equal to stored object version, otherwise update fails with errors.ObjectVersionConflictError.
+ * Objects that were stored by previous Ferrum versions have version 0 until first update.
+ */
+const NoExpectedVersion int64 = 0
+
+// CheckVersion checks that expected version of updated object matches version of stored object
+/* Parameters:
+ *    - objectType - type of object (for error message)
+ *    - objectId - object identifier (for error message)
+ *    - storedVersion - version of stored object
+ *    - expectedVersion - expected version, NoExpectedVersion matches any stored version
+ * Returns: errors.ObjectVersionConflictError if versions are different
+ */
+func CheckVersion(objectType string, objectId string, storedVersion int64, expectedVersion int64) error {
+	if expectedVersion != NoExpectedVersion && expectedVersion != storedVersion {
+		return appErrs.NewObjectVersionConflictError(objectType, objectId, expectedVersion, storedVersion)
+	}
+	return nil
+}
+
+// CreateUserWithVersion returns a copy of user with version, user itself is not changed (it could be i.e. a cached user)
+/* Parameters:
+ *    - user - user
+ *    - version - version of a copy
+ * Returns: copy of user
+ */
+func CreateUserWithVersion(user User, version int64) User {
+	var rawData interface{}
+	_ = json.Unmarshal([]byte(user.GetJsonString()), &rawData)
+	versioned := CreateUser(rawData, nil)
+	versioned.SetVersion(version)
+	return versioned
+}
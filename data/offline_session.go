@@ -0,0 +1,26 @@
+package data
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OfflineSession is a long-lived session that is started on login with offline_access scope
+/* Unlike UserSession, OfflineSession is stored in a data store (see managers.DataContext), therefore it survives server
+ * restarts and doesn't depend on SSO session: it lives until offline token wasn't used during Realm.OfflineSessionIdleTimeout
+ * or Realm.OfflineSessionMaxLifespan passed since login, or until it was revoked.
+ * UserSessionId - identifier of a UserSession that was started by the last offline token usage (access tokens belong to it)
+ * Expired - time when offline token expires
+ * TokenHash - hex encoded SHA-256 of the actual offline token, token itself is not stored, previous tokens are not valid after refresh
+ */
+type OfflineSession struct {
+	Id            uuid.UUID `json:"id"`
+	UserId        uuid.UUID `json:"user_id"`
+	ClientId      string    `json:"client_id"`
+	UserSessionId uuid.UUID `json:"user_session_id"`
+	Started       time.Time `json:"started"`
+	LastActivity  time.Time `json:"last_activity"`
+	Expired       time.Time `json:"expired"`
+	TokenHash     string    `json:"token_hash"`
+}
@@ -2,18 +2,53 @@ package data
 
 import "github.com/wissance/Ferrum/utils/encoding"
 
+// SessionEvictionPolicy defines what to do with new login when user already has Realm.MaxUserSessions active sessions
+type SessionEvictionPolicy string
+
+const (
+	// EvictOldestSession : the oldest (by start time) user sessions are removed to give place for a new one, it is default policy
+	EvictOldestSession SessionEvictionPolicy = "evict_oldest"
+	// RejectNewSession : new login is rejected until one of the user sessions ends
+	RejectNewSession SessionEvictionPolicy = "reject_new"
+)
+
+// DefaultOfflineSessionIdleTimeout is an offline session idle timeout (30 days in seconds) that is using if Realm.OfflineSessionIdleTimeout is not set
+const DefaultOfflineSessionIdleTimeout = 2592000
+
 // Realm is a struct that describes typical Realm
 /* It was originally designed to efficiently work in memory with small amount of data therefore it contains relations with Clients and Users
  * But in a systems with thousands of users working at the same time it is too expensive to fetch Realm with all relations therefore
  * in such systems Clients && Users would be empty, and we should to get User or Client separately
+ * MaxUserSessions limits number of concurrent sessions of one user (0 means no limit), SessionEvictionPolicy defines
+ * how this limit is applying on new login.
+ * SessionIdleTimeout and SessionMaxLifespan (in seconds, 0 means no limit) are SSO session limits, they are distinct from
+ * tokens lifetime: session ends if it wasn't refreshed during SessionIdleTimeout or when SessionMaxLifespan passed since
+ * login, tokens expiration never exceeds these limits.
+ * RefreshTokenRotation makes every refresh token single-use: presenting already used refresh token revokes the session
+ * that token was issued by. If it is disabled refresh tokens that were replaced by refresh stay valid while session is
+ * active. Client.RefreshTokenRotation overrides this value for a client
+ * OfflineSessionIdleTimeout and OfflineSessionMaxLifespan (in seconds) are limits of offline sessions (offline_access scope),
+ * offline session ends if offline token wasn't used during OfflineSessionIdleTimeout (0 means DefaultOfflineSessionIdleTimeout)
+ * or when OfflineSessionMaxLifespan passed since login (0 means no limit)
+ * NotBefore is a revocation timestamp (unix time in seconds, 0 means not set): tokens of sessions (including offline)
+ * which were not active (not refreshed) since this time are treated as revoked
  */
 type Realm struct {
-	Name                   string                        `json:"name"`
-	Clients                []Client                      `json:"clients"`
-	Users                  []interface{}                 `json:"users"`
-	TokenExpiration        int                           `json:"token_expiration"`
-	RefreshTokenExpiration int                           `json:"refresh_expiration"`
-	UserFederationServices []UserFederationServiceConfig `json:"user_federation_services"`
-	PasswordSalt           string                        `json:"password_salt"`
-	Encoder                *encoding.PasswordJsonEncoder
+	Name                      string                        `json:"name"`
+	Clients                   []Client                      `json:"clients"`
+	Users                     []interface{}                 `json:"users"`
+	TokenExpiration           int                           `json:"token_expiration"`
+	RefreshTokenExpiration    int                           `json:"refresh_expiration"`
+	UserFederationServices    []UserFederationServiceConfig `json:"user_federation_services"`
+	PasswordSalt              string                        `json:"password_salt"`
+	MaxUserSessions           int                           `json:"max_user_sessions"`
+	SessionEvictionPolicy     SessionEvictionPolicy         `json:"session_eviction_policy"`
+	SessionIdleTimeout        int                           `json:"session_idle_timeout"`
+	SessionMaxLifespan        int                           `json:"session_max_lifespan"`
+	RefreshTokenRotation      bool                          `json:"refresh_token_rotation"`
+	OfflineSessionIdleTimeout int                           `json:"offline_session_idle_timeout"`
+	OfflineSessionMaxLifespan int                           `json:"offline_session_max_lifespan"`
+	NotBefore                 int64                         `json:"not_before"`
+	Version                   int64                         `json:"version,omitempty"`
+	Encoder                   *encoding.PasswordJsonEncoder `json:"-"`
 }
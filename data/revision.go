@@ -0,0 +1,210 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RevisionObjectType is a type of object which changes are kept in a history (see Revision)
+type RevisionObjectType string
+
+const (
+	RealmRevision  RevisionObjectType = "realm"
+	ClientRevision RevisionObjectType = "client"
+)
+
+// Revision is a state of realm settings or of realm client after creation or update
+/* Data stores keep bounded (config.RevisionsLimit) history of every realm and client (see managers.RevisionsKeeper): revision
+ * is added on object creation and on every update, object version (see NoExpectedVersion) is a revision number. Object that
+ * was imported or created before history keeping gets revision of its state before the first update (without author).
+ * Realm revision contains realm settings without clients, users, user federation configs and password salt, realm revision
+ * doesn't have ObjectName. Author is an administrator that made change ({realm}/{username}), empty if it is not known.
+ * History of client is removed with client, history of realm (and its clients) is removed with realm.
+ */
+type Revision struct {
+	Realm      string             `json:"realm"`
+	ObjectType RevisionObjectType `json:"object_type"`
+	ObjectName string             `json:"object_name,omitempty"`
+	Version    int64              `json:"version"`
+	Created    time.Time          `json:"created"`
+	Author     string             `json:"author,omitempty"`
+	Data       json.RawMessage    `json:"data"`
+}
+
+// RevisionChange is a difference of one field between two revisions
+/* Path is a dot separated path of json field, Old and New are json values of field (nil if field is absent)
+ */
+type RevisionChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+}
+
+// revisionAuthorKey is a context.Context key of revision author
+type revisionAuthorKey struct{}
+
+// WithRevisionAuthor returns context with author of changes, data store writes author to revisions of changed objects
+/* Parameters:
+ *    - ctx - parent context
+ *    - author - administrator that makes changes ({realm}/{username})
+ * Returns: context with author
+ */
+func WithRevisionAuthor(ctx context.Context, author string) context.Context {
+	return context.WithValue(ctx, revisionAuthorKey{}, author)
+}
+
+// GetRevisionAuthor returns author of changes from context, empty string if author is not known
+func GetRevisionAuthor(ctx context.Context) string {
+	author, _ := ctx.Value(revisionAuthorKey{}).(string)
+	return author
+}
+
+// CreateRealmRevision creates revision of realm settings (realm.Version is a revision version)
+/* Parameters:
+ *    - ctx - context of operation that changes realm (contains author, see WithRevisionAuthor)
+ *    - realm - realm, clients, users, user federation configs and password salt are not included in revision
+ * Returns: revision and error of realm settings marshal
+ */
+func CreateRealmRevision(ctx context.Context, realm *Realm) (Revision, error) {
+	settings := *realm
+	settings.Clients = nil
+	settings.Users = nil
+	settings.UserFederationServices = nil
+	settings.PasswordSalt = ""
+	settings.Encoder = nil
+	revisionData, err := json.Marshal(settings)
+	if err != nil {
+		return Revision{}, err
+	}
+	return Revision{
+		Realm: realm.Name, ObjectType: RealmRevision, Version: realm.Version, Created: time.Now().UTC(),
+		Author: GetRevisionAuthor(ctx), Data: revisionData,
+	}, nil
+}
+
+// CreateClientRevision creates revision of realm client (client.Version is a revision version)
+/* Client secret (Auth.Value) is replaced by SecretMask as in admin API responses, therefore revisions history doesn't keep secrets
+ * Parameters:
+ *    - ctx - context of operation that changes client (contains author, see WithRevisionAuthor)
+ *    - realmName - name of a realm
+ *    - client - client
+ * Returns: revision and error of client marshal
+ */
+func CreateClientRevision(ctx context.Context, realmName string, client *Client) (Revision, error) {
+	maskedClient := *client
+	if len(maskedClient.Auth.Value) > 0 {
+		maskedClient.Auth.Value = SecretMask
+	}
+	revisionData, err := json.Marshal(maskedClient)
+	if err != nil {
+		return Revision{}, err
+	}
+	return Revision{
+		Realm: realmName, ObjectType: ClientRevision, ObjectName: client.Name, Version: client.Version, Created: time.Now().UTC(),
+		Author: GetRevisionAuthor(ctx), Data: revisionData,
+	}, nil
+}
+
+// AddRevision adds revision of changed object to object history
+/* Parameters:
+ *    - history - object revisions ordered by version
+ *    - previous - revision of object state before change (nil if object was created), it is added only if history doesn't
+ *      have revision of this version (object was imported or created before history keeping), author of this state is not known
+ *    - revision - revision of object state after change
+ *    - limit - max number of revisions, the oldest revisions are removed
+ * Returns: new history (history itself is not changed)
+ */
+func AddRevision(history []Revision, previous *Revision, revision Revision, limit int) []Revision {
+	newHistory := make([]Revision, 0, len(history)+2)
+	newHistory = append(newHistory, history...)
+	if previous != nil && FindRevision(history, previous.Version) == nil {
+		// object could be renamed by change
+		baseline := *previous
+		baseline.Realm = revision.Realm
+		baseline.ObjectName = revision.ObjectName
+		baseline.Author = ""
+		newHistory = append(newHistory, baseline)
+	}
+	newHistory = append(newHistory, revision)
+	if len(newHistory) > limit {
+		newHistory = newHistory[len(newHistory)-limit:]
+	}
+	return newHistory
+}
+
+// FindRevision returns revision with version from history, nil if history doesn't have it
+func FindRevision(history []Revision, version int64) *Revision {
+	for i := range history {
+		if history[i].Version == version {
+			return &history[i]
+		}
+	}
+	return nil
+}
+
+// GetRealm returns realm settings that were stored in realm revision
+func (revision *Revision) GetRealm() (*Realm, error) {
+	var realm Realm
+	if err := json.Unmarshal(revision.Data, &realm); err != nil {
+		return nil, err
+	}
+	return &realm, nil
+}
+
+// GetClient returns client that was stored in client revision
+func (revision *Revision) GetClient() (*Client, error) {
+	var client Client
+	if err := json.Unmarshal(revision.Data, &client); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// DiffRevisions returns fields that differ in two revisions of the same object ordered by path, version field is not compared
+/* Nested json objects are compared field by field, arrays are compared as a whole
+ * Parameters:
+ *    - from - older revision
+ *    - to - newer revision
+ * Returns: changed fields and error if revision data is not a json object
+ */
+func DiffRevisions(from *Revision, to *Revision) ([]RevisionChange, error) {
+	var fromData, toData map[string]interface{}
+	if err := json.Unmarshal(from.Data, &fromData); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(to.Data, &toData); err != nil {
+		return nil, err
+	}
+	delete(fromData, versionKey)
+	delete(toData, versionKey)
+	changes := make([]RevisionChange, 0)
+	diffValues(nil, fromData, toData, &changes)
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// diffValues adds changes of json values (nested objects are compared field by field) to changes
+func diffValues(path []string, oldValue interface{}, newValue interface{}, changes *[]RevisionChange) {
+	oldObject, isOldObject := oldValue.(map[string]interface{})
+	newObject, isNewObject := newValue.(map[string]interface{})
+	if isOldObject && isNewObject {
+		for key, value := range oldObject {
+			diffValues(append(path, key), value, newObject[key], changes)
+		}
+		for key, value := range newObject {
+			if _, ok := oldObject[key]; !ok {
+				diffValues(append(path, key), nil, value, changes)
+			}
+		}
+		return
+	}
+	if !reflect.DeepEqual(oldValue, newValue) {
+		*changes = append(*changes, RevisionChange{Path: strings.Join(path, "."), Old: oldValue, New: newValue})
+	}
+}
@@ -0,0 +1,105 @@
+package data
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddRevision(t *testing.T) {
+	ctx := WithRevisionAuthor(context.Background(), "master/admin")
+	client := Client{ID: uuid.New(), Name: "app", Type: Public, Version: 3}
+	previous := createTestClientRevision(t, ctx, &client)
+	client.Name = "app_renamed"
+	client.Version = 4
+
+	// 1. Previous state becomes a baseline if history doesn't have it, baseline gets name of changed object and has no author
+	history := AddRevision(nil, &previous, createTestClientRevision(t, ctx, &client), 10)
+	require.Len(t, history, 2)
+	assert.Equal(t, int64(3), history[0].Version)
+	assert.Equal(t, "app_renamed", history[0].ObjectName)
+	assert.Empty(t, history[0].Author)
+	assert.Equal(t, int64(4), history[1].Version)
+	assert.Equal(t, "master/admin", history[1].Author)
+
+	// 2. Previous state that is kept in history is not added again, history itself is not changed
+	previous = history[1]
+	client.Version = 5
+	newHistory := AddRevision(history, &previous, createTestClientRevision(t, ctx, &client), 10)
+	assert.Len(t, newHistory, 3)
+	assert.Len(t, history, 2)
+
+	// 3. The oldest revisions are removed
+	previous = newHistory[2]
+	client.Version = 6
+	newHistory = AddRevision(newHistory, &previous, createTestClientRevision(t, ctx, &client), 2)
+	require.Len(t, newHistory, 2)
+	assert.Equal(t, int64(5), newHistory[0].Version)
+	assert.Equal(t, int64(6), newHistory[1].Version)
+	assert.NotNil(t, FindRevision(newHistory, 6))
+	assert.Nil(t, FindRevision(newHistory, 4))
+}
+
+func TestCreateRealmRevisionDoesNotContainRealmObjects(t *testing.T) {
+	realm := Realm{
+		Name: "realm", TokenExpiration: 100, Version: 2, PasswordSalt: "salt",
+		Clients: []Client{{Name: "app"}}, Users: []any{map[string]any{"info": map[string]any{"preferred_username": "user"}}},
+	}
+	revision, err := CreateRealmRevision(context.Background(), &realm)
+	require.NoError(t, err)
+	assert.Equal(t, RealmRevision, revision.ObjectType)
+	assert.Empty(t, revision.ObjectName)
+	assert.Equal(t, int64(2), revision.Version)
+	revisionRealm, err := revision.GetRealm()
+	require.NoError(t, err)
+	assert.Equal(t, 100, revisionRealm.TokenExpiration)
+	assert.Empty(t, revisionRealm.Clients)
+	assert.Empty(t, revisionRealm.Users)
+	assert.Empty(t, revisionRealm.PasswordSalt)
+}
+
+func TestCreateClientRevisionMasksSecret(t *testing.T) {
+	client := Client{ID: uuid.New(), Name: "app", Type: Confidential, Auth: Authentication{Type: ClientIdAndSecrets, Value: "secret"}}
+	revision := createTestClientRevision(t, context.Background(), &client)
+	revisionClient, err := revision.GetClient()
+	require.NoError(t, err)
+	assert.Equal(t, SecretMask, revisionClient.Auth.Value)
+	assert.Equal(t, ClientIdAndSecrets, revisionClient.Auth.Type)
+	// client itself is not changed
+	assert.Equal(t, "secret", client.Auth.Value)
+
+	publicClient := Client{ID: uuid.New(), Name: "public", Type: Public}
+	revision = createTestClientRevision(t, context.Background(), &publicClient)
+	revisionClient, err = revision.GetClient()
+	require.NoError(t, err)
+	assert.Empty(t, revisionClient.Auth.Value)
+}
+
+func TestDiffRevisions(t *testing.T) {
+	client := Client{ID: uuid.New(), Name: "app", Type: Confidential, Auth: Authentication{Type: ClientIdAndSecrets, Value: "old"}, Version: 1}
+	from := createTestClientRevision(t, context.Background(), &client)
+	client.Auth.Value = "new"
+	client.Type = Public
+	client.Version = 2
+	to := createTestClientRevision(t, context.Background(), &client)
+
+	changes, err := DiffRevisions(&from, &to)
+	require.NoError(t, err)
+	// version is not compared, nested objects are compared field by field, secrets are masked in revisions
+	assert.Equal(t, []RevisionChange{
+		{Path: "Type", Old: string(Confidential), New: string(Public)},
+	}, changes)
+
+	changes, err = DiffRevisions(&to, &to)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func createTestClientRevision(t *testing.T, ctx context.Context, client *Client) Revision {
+	revision, err := CreateClientRevision(ctx, "realm", client)
+	require.NoError(t, err)
+	return revision
+}
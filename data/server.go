@@ -1,6 +1,10 @@
 package data
 
 // ServerData is used in managers.FileDataManager
+/* Revisions is a history of realms and clients changes (see Revision), it is kept by FileDataManager only in a separate
+ * revisions file, therefore it is not a part of data file
+ */
 type ServerData struct {
-	Realms []Realm
+	Realms    []Realm    `json:"realms"`
+	Revisions []Revision `json:"-"`
 }
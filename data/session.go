@@ -8,6 +8,8 @@ import (
 // UserSession is a struct that is using for store info about users logged in a Ferrum authorization server
 /* UserId - uuid representing unique user identifier
  * Started - time when token was Issued
+ * IpAddress - IP address of a client that started (or the last refreshed) session
+ * LastActivity - time of a last session start or refresh, it is using for idle timeout check
  * Expired - time when session expires
  * RefreshExpired - time when refresh expires
  * JwtAccessToken and JwtRefreshToken - access and refresh tokens
@@ -15,7 +17,10 @@ import (
 type UserSession struct {
 	Id              uuid.UUID
 	UserId          uuid.UUID
+	ClientId        string
+	IpAddress       string
 	Started         time.Time
+	LastActivity    time.Time
 	Expired         time.Time
 	RefreshExpired  time.Time
 	JwtAccessToken  string
@@ -12,16 +12,17 @@ type RawUserInfo interface{}
 
 // JwtCommonInfo - struct with all field for representing token in JWT format
 type JwtCommonInfo struct {
-	IssuedAt     time.Time `json:"iat"`
-	ExpiredAt    time.Time `json:"exp"`
-	JwtId        uuid.UUID `json:"jti"`
-	Type         string    `json:"typ"`
-	Issuer       string    `json:"iss"`
-	Audience     string    `json:"aud"`
-	Subject      uuid.UUID `json:"sub"`
-	SessionState uuid.UUID `json:"session_state"`
-	SessionId    uuid.UUID `json:"sid"`
-	Scope        string    `json:"scope"`
+	IssuedAt        time.Time `json:"iat"`
+	ExpiredAt       time.Time `json:"exp"`
+	JwtId           uuid.UUID `json:"jti"`
+	Type            string    `json:"typ"`
+	Issuer          string    `json:"iss"`
+	Audience        string    `json:"aud"`
+	Subject         uuid.UUID `json:"sub"`
+	SessionState    uuid.UUID `json:"session_state"`
+	SessionId       uuid.UUID `json:"sid"`
+	Scope           string    `json:"scope"`
+	AuthorizedParty string    `json:"azp,omitempty"`
 }
 
 // TokenRefreshData is a JWT token with embedded just a common data (JwtCommonInfo)
@@ -12,12 +12,22 @@ type User interface {
 	GetPasswordHash() string
 	SetPassword(password string, encoder *encoding.PasswordJsonEncoder) error
 	GetId() uuid.UUID
+	// GetEmail returns user email (empty string if user doesn't have email)
+	GetEmail() string
+	// IsEnabled returns whether user is enabled (user without enabled flag is enabled)
+	IsEnabled() bool
 	GetUserInfo() interface{}
 	GetRawData() interface{}
 	GetJsonString() string
 	IsFederatedUser() bool
 	// GetFederationId actually Federation Name
 	GetFederationId() string
+	// GetVersion returns version of stored user (0 if user was stored without version)
+	GetVersion() int64
+	// SetVersion sets user version, on update it is an expected version of stored user
+	SetVersion(version int64)
+	// GetAdminRoles returns user admin roles by scope (realm name or AllRealms)
+	GetAdminRoles() map[string][]AdminRole
 }
 
 var _ User = (*KeyCloakUser)(nil)
@@ -0,0 +1,136 @@
+package data
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/ohler55/ojg/jp"
+	sf "github.com/wissance/stringFormatter"
+)
+
+const (
+	// DefaultUsersPageSize is a number of users in a page if page limit is not set
+	DefaultUsersPageSize = 100
+	// MaxUsersPageSize is a max number of users in a page
+	MaxUsersPageSize = 1000
+)
+
+// PageRequest is a requested page of ordered objects
+/* Offset is a number of skipped objects, Limit is a max number of objects in a page (0 means DefaultUsersPageSize)
+ */
+type PageRequest struct {
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+// UsersFilter is a realm users search criteria, user must match all set criteria
+/* UsernamePrefix - username starts with prefix (case-sensitive as usernames are)
+ * Email - user email equals (case-insensitive)
+ * Enabled - user enabled flag equals (see User.IsEnabled)
+ * Attribute - jsonpath predicate over user raw data, i.e. @.info.department == 'sales' or @.info.roles[0] == 'admin'
+ */
+type UsersFilter struct {
+	UsernamePrefix string `json:"username_prefix,omitempty"`
+	Email          string `json:"email,omitempty"`
+	Enabled        *bool  `json:"enabled,omitempty"`
+	Attribute      string `json:"attribute,omitempty"`
+}
+
+// UsersPage is a page of realm users ordered by username
+/* Total is a number of all users that match search criteria, therefore next page exists if Offset + len(Users) < Total
+ */
+type UsersPage struct {
+	Users  []User
+	Total  int
+	Offset int
+	Limit  int
+}
+
+// GetLimit returns max number of objects in a page
+func (page PageRequest) GetLimit() int {
+	if page.Limit == 0 {
+		return DefaultUsersPageSize
+	}
+	return page.Limit
+}
+
+// Validate checks that offset is not negative and limit is in range [0, MaxUsersPageSize]
+func (page PageRequest) Validate() error {
+	if page.Offset < 0 {
+		return errors.New("page offset must not be negative")
+	}
+	if page.Limit < 0 || page.Limit > MaxUsersPageSize {
+		return errors.New(sf.Format("page limit must be in range [0, {0}]", MaxUsersPageSize))
+	}
+	return nil
+}
+
+// Slice returns bounds of page in a sequence of total objects
+/* Parameters:
+ *     - total - number of all objects
+ * Returns: start (inclusive) and end (exclusive) indexes, start == end if page is beyond total
+ */
+func (page PageRequest) Slice(total int) (int, int) {
+	start := min(page.Offset, total)
+	return start, min(start+page.GetLimit(), total)
+}
+
+// IsUsernameOnly checks whether filter has no criteria except UsernamePrefix, therefore users data is not required for matching
+func (filter *UsersFilter) IsUsernameOnly() bool {
+	return filter.Email == "" && filter.Enabled == nil && filter.Attribute == ""
+}
+
+// GetMatcher returns function that checks whether user matches all filter criteria
+/* Returns: matcher and error if Attribute is not a valid jsonpath predicate
+ */
+func (filter *UsersFilter) GetMatcher() (func(user User) bool, error) {
+	var attributeScript *jp.Script
+	if filter.Attribute != "" {
+		script, err := jp.NewScript(filter.Attribute)
+		if err != nil {
+			return nil, errors.New(sf.Format("invalid attribute predicate \"{0}\": {1}", filter.Attribute, err.Error()))
+		}
+		attributeScript = script
+	}
+	return func(user User) bool {
+		if !strings.HasPrefix(user.GetUsername(), filter.UsernamePrefix) {
+			return false
+		}
+		if filter.Email != "" && !strings.EqualFold(user.GetEmail(), filter.Email) {
+			return false
+		}
+		if filter.Enabled != nil && user.IsEnabled() != *filter.Enabled {
+			return false
+		}
+		return attributeScript == nil || attributeScript.Match(user.GetRawData())
+	}, nil
+}
+
+// GetUsersPage selects page of users that match filter, it is used by data stores that can't filter users by themselves
+/* Parameters:
+ *     - users - all realm users (any order)
+ *     - filter - search criteria
+ *     - page - requested page
+ * Returns: page of matched users ordered by username and error if filter or page is invalid
+ */
+func GetUsersPage(users []User, filter *UsersFilter, page PageRequest) (*UsersPage, error) {
+	if err := page.Validate(); err != nil {
+		return nil, err
+	}
+	matcher, err := filter.GetMatcher()
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]User, 0, len(users))
+	for _, user := range users {
+		if matcher(user) {
+			matched = append(matched, user)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].GetUsername() < matched[j].GetUsername()
+	})
+	start, end := page.Slice(len(matched))
+	return &UsersPage{Users: matched[start:end], Total: len(matched), Offset: page.Offset, Limit: page.GetLimit()}, nil
+}
@@ -0,0 +1,77 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetUsersPage(t *testing.T) {
+	users := createTestSearchUsers(t)
+	enabled := false
+	testCases := []struct {
+		name          string
+		filter        UsersFilter
+		page          PageRequest
+		expectedTotal int
+		expectedUsers []string
+	}{
+		{name: "AllUsers", expectedTotal: 4, expectedUsers: []string{"alex", "alice", "b_x", "bob"}},
+		{name: "Page", page: PageRequest{Offset: 1, Limit: 2}, expectedTotal: 4, expectedUsers: []string{"alice", "b_x"}},
+		{name: "PageBeyondUsers", page: PageRequest{Offset: 10}, expectedTotal: 4, expectedUsers: []string{}},
+		{name: "UsernamePrefix", filter: UsersFilter{UsernamePrefix: "al"}, expectedTotal: 2, expectedUsers: []string{"alex", "alice"}},
+		{name: "Email", filter: UsersFilter{Email: "ALICE@example.com"}, expectedTotal: 1, expectedUsers: []string{"alice"}},
+		{name: "Enabled", filter: UsersFilter{Enabled: &enabled}, expectedTotal: 1, expectedUsers: []string{"alex"}},
+		{
+			name: "Attribute", filter: UsersFilter{Attribute: "@.info.department == 'sales'"}, page: PageRequest{Offset: 1, Limit: 1},
+			expectedTotal: 2, expectedUsers: []string{"bob"},
+		},
+		{
+			name: "AllCriteria", filter: UsersFilter{UsernamePrefix: "a", Attribute: "@.info.department == 'sales'", Email: "alice@example.com"},
+			expectedTotal: 1, expectedUsers: []string{"alice"},
+		},
+	}
+
+	for _, tCase := range testCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			page, err := GetUsersPage(users, &tCase.filter, tCase.page)
+			require.NoError(t, err)
+			assert.Equal(t, tCase.expectedTotal, page.Total)
+			assert.Equal(t, tCase.page.Offset, page.Offset)
+			assert.Equal(t, tCase.page.GetLimit(), page.Limit)
+			userNames := make([]string, len(page.Users))
+			for i, user := range page.Users {
+				userNames[i] = user.GetUsername()
+			}
+			assert.Equal(t, tCase.expectedUsers, userNames)
+		})
+	}
+}
+
+func TestGetUsersPageFailsInvalidRequest(t *testing.T) {
+	users := createTestSearchUsers(t)
+	_, err := GetUsersPage(users, &UsersFilter{Attribute: "@.info.department =="}, PageRequest{})
+	assert.Error(t, err)
+	_, err = GetUsersPage(users, &UsersFilter{}, PageRequest{Offset: -1})
+	assert.Error(t, err)
+	_, err = GetUsersPage(users, &UsersFilter{}, PageRequest{Limit: MaxUsersPageSize + 1})
+	assert.Error(t, err)
+}
+
+func createTestSearchUsers(t *testing.T) []User {
+	rawUsers := `[
+		{"info": {"preferred_username": "bob", "department": "sales"}},
+		{"info": {"preferred_username": "alice", "email": "Alice@Example.com", "department": "sales"}, "enabled": true},
+		{"info": {"preferred_username": "b_x"}},
+		{"info": {"preferred_username": "alex", "department": "it"}, "enabled": false}
+	]`
+	var usersData []interface{}
+	require.NoError(t, json.Unmarshal([]byte(rawUsers), &usersData))
+	users := make([]User, len(usersData))
+	for i, userData := range usersData {
+		users[i] = CreateUser(userData, nil)
+	}
+	return users
+}
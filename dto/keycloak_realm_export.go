@@ -0,0 +1,775 @@
+package dto
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/wissance/Ferrum/data"
+	"github.com/wissance/Ferrum/globals"
+	sf "github.com/wissance/stringFormatter"
+)
+
+const (
+	// realmManagementClient is a Keycloak client which roles are admin roles of own realm
+	realmManagementClient = "realm-management"
+	// masterRealmClientSuffix is a suffix of Keycloak master realm clients ({realm}-realm) which roles are admin roles of other realms
+	masterRealmClientSuffix = "-realm"
+	// masterAdminRole is a Keycloak master realm role that grants all admin roles of all realms
+	masterAdminRole = "admin"
+	// defaultRolesPrefix is a prefix of Keycloak realm composite role that is granted to all realm users (default-roles-{realm})
+	defaultRolesPrefix     = "default-roles-"
+	openIdConnectProtocol  = "openid-connect"
+	ldapVendorConfigKey    = "vendor"
+	freeIpaLdapVendor      = "rhds"
+	realmAccessInfoKey     = "realm_access"
+	resourceAccessInfoKey  = "resource_access"
+	rolesInfoKey           = "roles"
+	adminRolesRawKey       = "admin_roles"
+	enabledRawKey          = "enabled"
+	randomPasswordByteSize = 32
+)
+
+// Keycloak creates these clients in every realm itself, they are not imported and exported
+var keycloakBuiltInClients = map[string]bool{
+	"account": true, "account-console": true, "admin-cli": true, "broker": true, realmManagementClient: true, "security-admin-console": true,
+}
+
+// Keycloak creates these realm roles in every realm (or in master realm) itself, they are not exported as role definitions
+var keycloakBuiltInRealmRoles = map[string]bool{"offline_access": true, "uma_authorization": true}
+
+var keycloakMasterRealmRoles = map[string]bool{masterAdminRole: true, "create-realm": true}
+
+// Keycloak admin roles that are implied by Ferrum view roles, they are silently skipped on import
+var keycloakQueryAdminRoles = map[string]bool{"query-users": true, "query-groups": true, "query-clients": true, "query-realms": true}
+
+// admin roles that exist both in Ferrum and in Keycloak (Keycloak doesn't have data.ManageFederation, it requires manage-realm)
+var keycloakAdminRoles = map[data.AdminRole]bool{
+	data.RealmAdmin: true, data.ManageRealm: true, data.ViewRealm: true, data.ManageUsers: true, data.ViewUsers: true,
+	data.ManageClients: true, data.ViewClients: true,
+}
+
+// export fields that are imported, fields that are only informational (i.e. keycloakVersion or createdTimestamp) are here too,
+// roles, groups, clients, users and components are imported (or reported) separately
+var (
+	importedRealmFields = map[string]bool{
+		"id": true, "realm": true, "enabled": true, "accessTokenLifespan": true, "ssoSessionIdleTimeout": true, "ssoSessionMaxLifespan": true,
+		"offlineSessionIdleTimeout": true, "offlineSessionMaxLifespan": true, "offlineSessionMaxLifespanEnabled": true,
+		"revokeRefreshToken": true, "notBefore": true, "attributes": true, "clients": true, "users": true, "roles": true, "groups": true,
+		"components": true, "defaultRole": true, "defaultRoles": true, "keycloakVersion": true,
+	}
+	importedRealmAttributes = map[string]bool{
+		refreshTokenExpirationAttribute: true, maxUserSessionsAttribute: true, sessionEvictionPolicyAttribute: true,
+	}
+	importedClientFields = map[string]bool{
+		"id": true, "clientId": true, "name": true, "enabled": true, "publicClient": true, "clientAuthenticatorType": true, "secret": true,
+		"attributes": true, "protocol": true,
+	}
+	importedClientAttributes = map[string]bool{refreshTokenRotationAttribute: true}
+	importedUserFields       = map[string]bool{
+		"id": true, "username": true, "email": true, "firstName": true, "lastName": true, "emailVerified": true, "enabled": true,
+		"federationLink": true, "attributes": true, "credentials": true, "realmRoles": true, "clientRoles": true, "groups": true,
+		"createdTimestamp": true,
+	}
+	importedComponentFields = map[string]bool{"id": true, "name": true, "providerId": true, "parentId": true, "config": true}
+	importedComponentConfig = map[string]bool{
+		connectionUrlConfigKey: true, bindDnConfigKey: true, bindCredentialConfigKey: true, usersDnConfigKey: true,
+	}
+)
+
+// RealmExportRepresentation is a Keycloak realm export (json file of Keycloak export or partial export of a realm)
+/* Ferrum doesn't have roles and groups: user role mappings (own, groups and composite roles) are imported as user info
+ * realm_access and resource_access (they are passed to tokens as Keycloak does), roles of realm-management client (and of
+ * {realm}-realm clients in master realm) are imported as user admin roles. Components of UserStorageProviderType type are
+ * user federation configs.
+ */
+type RealmExportRepresentation struct {
+	RealmRepresentation
+	Roles      *RolesRepresentation                 `json:"roles,omitempty"`
+	Groups     []GroupRepresentation                `json:"groups,omitempty"`
+	Components map[string][]ComponentRepresentation `json:"components,omitempty"`
+}
+
+// RolesRepresentation is a Keycloak representation of realm roles and clients roles (by clientId) definitions
+type RolesRepresentation struct {
+	Realm  []RoleRepresentation            `json:"realm,omitempty"`
+	Client map[string][]RoleRepresentation `json:"client,omitempty"`
+}
+
+// RoleRepresentation is a Keycloak role definition, composite role grants its Composites roles
+type RoleRepresentation struct {
+	Id          string                        `json:"id,omitempty"`
+	Name        string                        `json:"name"`
+	Description string                        `json:"description,omitempty"`
+	Composite   bool                          `json:"composite"`
+	Composites  *RoleCompositesRepresentation `json:"composites,omitempty"`
+	ClientRole  bool                          `json:"clientRole"`
+}
+
+// RoleCompositesRepresentation is a list of realm roles and clients roles (by clientId) that are granted by a composite role
+type RoleCompositesRepresentation struct {
+	Realm  []string            `json:"realm,omitempty"`
+	Client map[string][]string `json:"client,omitempty"`
+}
+
+// GroupRepresentation is a Keycloak group, group members have group roles and roles of all parent groups
+type GroupRepresentation struct {
+	Id          string                `json:"id,omitempty"`
+	Name        string                `json:"name"`
+	Path        string                `json:"path,omitempty"`
+	RealmRoles  []string              `json:"realmRoles,omitempty"`
+	ClientRoles map[string][]string   `json:"clientRoles,omitempty"`
+	SubGroups   []GroupRepresentation `json:"subGroups,omitempty"`
+}
+
+// RealmTransferReport is a result of realm import from or export to Keycloak realm export format
+/* Clients, Users and UserFederations are numbers of transferred objects, Unsupported describes data that was not transferred
+ * or was transferred partially (every item starts with object description, i.e. client "web": ...)
+ */
+type RealmTransferReport struct {
+	Realm           string   `json:"realm"`
+	Clients         int      `json:"clients"`
+	Users           int      `json:"users"`
+	UserFederations int      `json:"user_federations"`
+	Unsupported     []string `json:"unsupported"`
+}
+
+// ImportKeycloakRealm creates realm with clients, users and user federation configs from Keycloak realm export
+/* Users passwords are not hashed, realm must be created by DataContext.CreateRealm (it generates realm salt and hashes
+ * passwords). Keycloak exports hashes of passwords that could not be used by Ferrum, users with such passwords (and users
+ * without password) get random password that must be reset. Keycloak built-in and disabled clients are not imported,
+ * new secret is generated for confidential clients if export doesn't contain secret. Everything that is not imported
+ * (including export fields that Ferrum doesn't have) is described in the report.
+ * Parameters:
+ *     - exportJson - Keycloak realm export json
+ * Returns: realm, import report and error if export is not valid
+ */
+func ImportKeycloakRealm(exportJson []byte) (data.Realm, *RealmTransferReport, error) {
+	var export RealmExportRepresentation
+	var rawExport map[string]interface{}
+	if err := json.Unmarshal(exportJson, &export); err != nil {
+		return data.Realm{}, nil, fmt.Errorf("realm export is not a valid json: %w", err)
+	}
+	if err := json.Unmarshal(exportJson, &rawExport); err != nil {
+		return data.Realm{}, nil, fmt.Errorf("realm export is not a json object: %w", err)
+	}
+	if len(export.Realm) == 0 {
+		return data.Realm{}, nil, errors.New("realm name is required")
+	}
+	report := &RealmTransferReport{Realm: export.Realm, Unsupported: []string{}}
+	realm := data.Realm{Name: export.Realm}
+	if err := export.ApplyTo(&realm); err != nil {
+		return realm, nil, err
+	}
+	if _, ok := export.Attributes[refreshTokenExpirationAttribute]; !ok {
+		// Keycloak refresh token expires when SSO session becomes idle
+		realm.RefreshTokenExpiration = export.SsoSessionIdleTimeout
+	}
+	if !export.Enabled {
+		report.add("realm: disabled realm is imported as enabled")
+	}
+	report.addUnsupportedFields("realm", rawExport, importedRealmFields, importedRealmAttributes, "attributes")
+	if export.Roles != nil && (len(export.Roles.Realm) > 0 || len(export.Roles.Client) > 0) {
+		report.add("roles: role definitions are not imported, roles are imported as users roles (realm_access, resource_access) and admin roles")
+	}
+	if len(export.Groups) > 0 {
+		report.add("groups: groups are not imported, groups roles are imported as roles of group members")
+	}
+
+	if err := importClients(&export, rawExport, &realm, report); err != nil {
+		return realm, nil, err
+	}
+	federationNames, err := importUserFederations(&export, rawExport, &realm, report)
+	if err != nil {
+		return realm, nil, err
+	}
+	if err = importUsers(&export, rawExport, federationNames, &realm, report); err != nil {
+		return realm, nil, err
+	}
+	return realm, report, nil
+}
+
+// ExportKeycloakRealm creates Keycloak realm export from realm, its clients, users and user federation configs
+/* Export contains clients secrets and federation bind credentials (as Keycloak export does) but doesn't contain users
+ * passwords (Ferrum password hashes could not be used by Keycloak). Users roles (realm_access and resource_access user info)
+ * are exported as role mappings, admin roles as roles of realm-management client (master realm users roles are roles of
+ * {realm}-realm clients and admin role). Everything that is not exported is described in the report.
+ * Parameters:
+ *     - realm - realm settings
+ *     - clients - realm clients
+ *     - users - realm users
+ *     - federationConfigs - realm user federation configs
+ * Returns: Keycloak realm export and export report
+ */
+func ExportKeycloakRealm(realm *data.Realm, clients []data.Client, users []data.User,
+	federationConfigs []data.UserFederationServiceConfig,
+) (RealmExportRepresentation, *RealmTransferReport) {
+	report := &RealmTransferReport{Realm: realm.Name, Unsupported: []string{}}
+	export := RealmExportRepresentation{RealmRepresentation: CreateRealmRepresentation(realm)}
+	exportedClients := map[string]bool{}
+	for i := range clients {
+		rep := CreateClientRepresentation(&clients[i])
+		export.Clients = append(export.Clients, rep)
+		exportedClients[rep.ClientId] = true
+		report.Clients++
+	}
+
+	for i := range federationConfigs {
+		cfg := &federationConfigs[i]
+		rep := CreateComponentRepresentation(realm.Name, cfg)
+		if len(cfg.SysPassword) > 0 {
+			rep.Config[bindCredentialConfigKey] = []string{cfg.SysPassword}
+		}
+		object := sf.Format("user federation \"{0}\"", cfg.Name)
+		if cfg.Type == data.FreeIPA {
+			// FreeIPA directory is 389 Directory Server (Red Hat Directory Server LDAP vendor in Keycloak)
+			rep.ProviderId = string(data.LDAP)
+			rep.Config[ldapVendorConfigKey] = []string{freeIpaLdapVendor}
+			report.add(sf.Format("{0}: Keycloak doesn't have freeipa provider, config is exported as ldap provider", object))
+		}
+		report.add(sf.Format("{0}: only connection settings are exported, LDAP attributes mapping must be configured in Keycloak", object))
+		if export.Components == nil {
+			export.Components = map[string][]ComponentRepresentation{}
+		}
+		export.Components[UserStorageProviderType] = append(export.Components[UserStorageProviderType], rep)
+		report.UserFederations++
+	}
+
+	realmRoles := map[string]bool{}
+	clientRoles := map[string]map[string]bool{}
+	usersWithoutPassword := 0
+	for _, user := range users {
+		rep := exportUser(realm.Name, user, report)
+		for _, role := range rep.RealmRoles {
+			realmRoles[role] = true
+		}
+		for client, roles := range rep.ClientRoles {
+			if !exportedClients[client] {
+				continue
+			}
+			if clientRoles[client] == nil {
+				clientRoles[client] = map[string]bool{}
+			}
+			for _, role := range roles {
+				clientRoles[client][role] = true
+			}
+		}
+		if !user.IsFederatedUser() {
+			usersWithoutPassword++
+		}
+		export.Users = append(export.Users, rep)
+		report.Users++
+	}
+	export.Roles = createRolesRepresentation(realm.Name, realmRoles, clientRoles)
+	if usersWithoutPassword > 0 {
+		report.add(sf.Format("users: passwords are not exported, passwords of {0} user(s) must be reset in Keycloak", usersWithoutPassword))
+	}
+	return export, report
+}
+
+// importClients adds export clients to realm, Keycloak built-in, disabled and not OpenID Connect clients are skipped
+func importClients(export *RealmExportRepresentation, rawExport map[string]interface{}, realm *data.Realm, report *RealmTransferReport) error {
+	rawClients := getRawObjects(rawExport["clients"])
+	for i := range export.Clients {
+		rep := export.Clients[i]
+		rawClient := getRawObject(rawClients, i)
+		object := sf.Format("client \"{0}\"", rep.ClientId)
+		isMasterRealmClient := realm.Name == globals.MasterRealm && strings.HasSuffix(rep.ClientId, masterRealmClientSuffix)
+		if keycloakBuiltInClients[rep.ClientId] || isMasterRealmClient {
+			report.add(sf.Format("{0}: Keycloak built-in client is not imported", object))
+			continue
+		}
+		if !rep.Enabled {
+			report.add(sf.Format("{0}: disabled client is not imported", object))
+			continue
+		}
+		if protocol, _ := rawClient["protocol"].(string); len(protocol) > 0 && protocol != openIdConnectProtocol {
+			report.add(sf.Format("{0}: protocol \"{1}\" is not supported, client is not imported", object, protocol))
+			continue
+		}
+		if !rep.PublicClient {
+			if len(rep.ClientAuthenticatorType) > 0 && rep.ClientAuthenticatorType != ClientSecretAuthenticator {
+				report.add(sf.Format("{0}: authenticator \"{1}\" is not supported, client secret authentication is used", object,
+					rep.ClientAuthenticatorType))
+			}
+			if len(rep.Secret) == 0 || rep.Secret == SecretMask {
+				rep.Secret = uuid.NewString()
+				report.add(sf.Format("{0}: export doesn't contain client secret, new secret is generated", object))
+			}
+		}
+		client, err := rep.ToClient()
+		if err != nil {
+			return fmt.Errorf("%s: %w", object, err)
+		}
+		report.addUnsupportedFields(object, rawClient, importedClientFields, importedClientAttributes, "attributes")
+		realm.Clients = append(realm.Clients, client)
+		report.Clients++
+	}
+	return nil
+}
+
+// importUserFederations adds LDAP user federation components to realm, returns component identifier to config name map
+func importUserFederations(export *RealmExportRepresentation, rawExport map[string]interface{}, realm *data.Realm,
+	report *RealmTransferReport,
+) (map[string]string, error) {
+	federationNames := map[string]string{}
+	rawComponents, _ := rawExport["components"].(map[string]interface{})
+	componentTypes := make([]string, 0, len(export.Components))
+	for componentType := range export.Components {
+		componentTypes = append(componentTypes, componentType)
+	}
+	sort.Strings(componentTypes)
+	for _, componentType := range componentTypes {
+		if componentType != UserStorageProviderType {
+			report.add(sf.Format("components: components of type \"{0}\" are not imported", componentType))
+		}
+	}
+
+	rawFederations := getRawObjects(rawComponents[UserStorageProviderType])
+	for i, rep := range export.Components[UserStorageProviderType] {
+		object := sf.Format("user federation \"{0}\"", rep.Name)
+		if rep.ProviderId != string(data.LDAP) && rep.ProviderId != string(data.FreeIPA) {
+			report.add(sf.Format("{0}: provider \"{1}\" is not supported, user federation is not imported", object, rep.ProviderId))
+			continue
+		}
+		cfg, err := rep.ToUserFederationConfig(nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", object, err)
+		}
+		if getConfigValue(rep.Config, bindCredentialConfigKey) == SecretMask {
+			report.add(sf.Format("{0}: export doesn't contain bind credential, it must be set after import", object))
+		}
+		rawFederation := getRawObject(rawFederations, i)
+		report.addUnsupportedFields(object, rawFederation, importedComponentFields, importedComponentConfig, "config")
+		if len(rep.Id) > 0 {
+			federationNames[rep.Id] = cfg.Name
+		}
+		federationNames[cfg.Name] = cfg.Name
+		realm.UserFederationServices = append(realm.UserFederationServices, cfg)
+		report.UserFederations++
+	}
+	return federationNames, nil
+}
+
+// importUsers adds export users with their roles to realm, users of user federations that were not imported are skipped
+func importUsers(export *RealmExportRepresentation, rawExport map[string]interface{}, federationNames map[string]string,
+	realm *data.Realm, report *RealmTransferReport,
+) error {
+	roles := createKeycloakRoles(export)
+	rawUsers := getRawObjects(rawExport["users"])
+	for i := range export.Users {
+		rep := export.Users[i]
+		object := sf.Format("user \"{0}\"", rep.Username)
+		if len(rep.FederationLink) > 0 {
+			name, ok := federationNames[rep.FederationLink]
+			if !ok {
+				report.add(sf.Format("{0}: user federation \"{1}\" is not imported, user is not imported", object, rep.FederationLink))
+				continue
+			}
+			rep.FederationLink = name
+		}
+		password, err := importPassword(object, &rep, report)
+		if err != nil {
+			return err
+		}
+		rep.Credentials = nil
+		if len(password) > 0 {
+			rep.Credentials = []CredentialRepresentation{{Type: PasswordCredentialType, Value: password}}
+		}
+		user, err := rep.ToUser(nil, nil)
+		if err != nil {
+			return fmt.Errorf("%s: %w", object, err)
+		}
+		rawData := user.GetRawData().(map[string]interface{})
+		rawData[enabledRawKey] = rep.Enabled
+		realmRoles, clientRoles := roles.getUserRoles(&rep)
+		info := rawData["info"].(map[string]interface{})
+		if len(realmRoles) > 0 {
+			info[realmAccessInfoKey] = map[string]interface{}{rolesInfoKey: getRawValues(realmRoles)}
+		}
+		resourceAccess := map[string]interface{}{}
+		for client, clientRolesList := range clientRoles {
+			if !isAdminRolesClient(realm.Name, client) {
+				resourceAccess[client] = map[string]interface{}{rolesInfoKey: getRawValues(clientRolesList)}
+			}
+		}
+		if len(resourceAccess) > 0 {
+			info[resourceAccessInfoKey] = resourceAccess
+		}
+		if adminRoles := importAdminRoles(object, realm.Name, realmRoles, clientRoles, report); len(adminRoles) > 0 {
+			rawData[adminRolesRawKey] = adminRoles
+		}
+		report.addUnsupportedFields(object, getRawObject(rawUsers, i), importedUserFields, nil, "")
+		realm.Users = append(realm.Users, rawData)
+		report.Users++
+	}
+	return nil
+}
+
+// importPassword returns plain user password from credentials, user that doesn't have it gets random password (federated
+// users don't have own passwords)
+func importPassword(object string, rep *UserRepresentation, report *RealmTransferReport) (string, error) {
+	password := ""
+	for _, credential := range rep.Credentials {
+		switch {
+		case credential.Type != PasswordCredentialType:
+			report.add(sf.Format("{0}: credential of type \"{1}\" is not imported", object, credential.Type))
+		case len(credential.Value) > 0:
+			password = credential.Value
+			if credential.Temporary {
+				report.add(sf.Format("{0}: temporary password is imported as permanent", object))
+			}
+		default:
+			report.add(sf.Format("{0}: password hash could not be imported, password must be reset", object))
+		}
+	}
+	if len(password) > 0 || len(rep.FederationLink) > 0 {
+		return password, nil
+	}
+	// user without password could not log in, as in Keycloak
+	randomBytes := make([]byte, randomPasswordByteSize)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", fmt.Errorf("random password generation failed: %w", err)
+	}
+	return hex.EncodeToString(randomBytes), nil
+}
+
+// importAdminRoles converts Keycloak admin roles (realm-management client roles or master realm {realm}-realm clients
+// roles and admin role) to user admin_roles value
+func importAdminRoles(object string, realmName string, realmRoles []string, clientRoles map[string][]string,
+	report *RealmTransferReport,
+) map[string]interface{} {
+	adminRoles := map[string]interface{}{}
+	if realmName == globals.MasterRealm && slices.Contains(realmRoles, masterAdminRole) {
+		adminRoles[data.AllRealms] = []interface{}{string(data.RealmAdmin)}
+	}
+	clients := make([]string, 0, len(clientRoles))
+	for client := range clientRoles {
+		clients = append(clients, client)
+	}
+	sort.Strings(clients)
+	for _, client := range clients {
+		if !isAdminRolesClient(realmName, client) {
+			continue
+		}
+		scope := realmName
+		if realmName == globals.MasterRealm {
+			scope = strings.TrimSuffix(client, masterRealmClientSuffix)
+		}
+		roles := clientRoles[client]
+		if slices.Contains(roles, string(data.RealmAdmin)) {
+			// realm-admin is a composite role of all other admin roles
+			adminRoles[scope] = []interface{}{string(data.RealmAdmin)}
+			continue
+		}
+		var scopeRoles []string
+		var unsupportedRoles []string
+		for _, role := range roles {
+			if keycloakAdminRoles[data.AdminRole(role)] {
+				scopeRoles = append(scopeRoles, role)
+			} else if !keycloakQueryAdminRoles[role] {
+				unsupportedRoles = append(unsupportedRoles, role)
+			}
+		}
+		if len(scopeRoles) > 0 {
+			adminRoles[scope] = getRawValues(scopeRoles)
+		}
+		if len(unsupportedRoles) > 0 {
+			report.add(sf.Format("{0}: admin roles {1} of realm \"{2}\" are not supported", object, strings.Join(unsupportedRoles, ", "), scope))
+		}
+	}
+	return adminRoles
+}
+
+// exportUser creates user representation with role mappings from user roles and admin roles
+func exportUser(realmName string, user data.User, report *RealmTransferReport) UserRepresentation {
+	rep := CreateUserRepresentation(user)
+	rep.Enabled = user.IsEnabled()
+	object := sf.Format("user \"{0}\"", rep.Username)
+	info, _ := user.GetUserInfo().(map[string]interface{})
+	rep.RealmRoles = getInfoRoles(info[realmAccessInfoKey])
+	if resourceAccess, ok := info[resourceAccessInfoKey].(map[string]interface{}); ok {
+		for client, clientAccess := range resourceAccess {
+			if roles := getInfoRoles(clientAccess); len(roles) > 0 {
+				rep.addClientRoles(client, roles...)
+			}
+		}
+	}
+	delete(rep.Attributes, realmAccessInfoKey)
+	delete(rep.Attributes, resourceAccessInfoKey)
+	if len(rep.Attributes) == 0 {
+		rep.Attributes = nil
+	}
+
+	for scope, roles := range user.GetAdminRoles() {
+		var keycloakRoles []string
+		for _, role := range roles {
+			if keycloakAdminRoles[role] {
+				keycloakRoles = append(keycloakRoles, string(role))
+			} else {
+				report.add(sf.Format("{0}: admin role {1} doesn't exist in Keycloak, it is not exported", object, role))
+			}
+		}
+		if len(keycloakRoles) == 0 {
+			continue
+		}
+		switch {
+		case scope == data.AllRealms && realmName == globals.MasterRealm:
+			if slices.Contains(keycloakRoles, string(data.RealmAdmin)) {
+				rep.RealmRoles = appendIfMissing(rep.RealmRoles, masterAdminRole)
+			} else {
+				report.add(sf.Format("{0}: admin roles {1} of all realms are not supported by Keycloak, they are not exported", object,
+					strings.Join(keycloakRoles, ", ")))
+			}
+		case realmName == globals.MasterRealm:
+			rep.addClientRoles(scope+masterRealmClientSuffix, keycloakRoles...)
+		case scope == realmName:
+			rep.addClientRoles(realmManagementClient, keycloakRoles...)
+		default:
+			// non-master realm users roles of other realms have no effect
+			report.add(sf.Format("{0}: admin roles of realm \"{1}\" are not exported", object, scope))
+		}
+	}
+	return rep
+}
+
+// createRolesRepresentation creates roles definitions of roles that are used by users, Keycloak built-in realm roles and
+// roles of not exported clients are not included because Keycloak creates them itself
+func createRolesRepresentation(realmName string, realmRoles map[string]bool, clientRoles map[string]map[string]bool) *RolesRepresentation {
+	roles := &RolesRepresentation{}
+	for _, role := range getSortedKeys(realmRoles) {
+		isMasterRole := realmName == globals.MasterRealm && keycloakMasterRealmRoles[role]
+		if keycloakBuiltInRealmRoles[role] || isMasterRole || role == defaultRolesPrefix+realmName {
+			continue
+		}
+		roles.Realm = append(roles.Realm, RoleRepresentation{Name: role})
+	}
+	for client, clientRolesSet := range clientRoles {
+		if roles.Client == nil {
+			roles.Client = map[string][]RoleRepresentation{}
+		}
+		for _, role := range getSortedKeys(clientRolesSet) {
+			roles.Client[client] = append(roles.Client[client], RoleRepresentation{Name: role, ClientRole: true})
+		}
+	}
+	if len(roles.Realm) == 0 && len(roles.Client) == 0 {
+		return nil
+	}
+	return roles
+}
+
+// addClientRoles adds client roles to user role mappings, roles that user already has are skipped
+func (rep *UserRepresentation) addClientRoles(client string, roles ...string) {
+	if rep.ClientRoles == nil {
+		rep.ClientRoles = map[string][]string{}
+	}
+	for _, role := range roles {
+		rep.ClientRoles[client] = appendIfMissing(rep.ClientRoles[client], role)
+	}
+	sort.Strings(rep.ClientRoles[client])
+}
+
+// isAdminRolesClient checks whether client roles are admin roles (realm-management client or {realm}-realm client of master realm)
+func isAdminRolesClient(realmName string, client string) bool {
+	if realmName == globals.MasterRealm {
+		return strings.HasSuffix(client, masterRealmClientSuffix)
+	}
+	return client == realmManagementClient
+}
+
+// keycloakRole is a realm role (client is empty) or a client role
+type keycloakRole struct {
+	client string
+	name   string
+}
+
+// keycloakRoles resolves user effective roles: own role mappings, role mappings of groups (with parent groups) and roles
+// that are granted by composite roles
+type keycloakRoles struct {
+	composites map[keycloakRole]*RoleCompositesRepresentation
+	groups     map[string]*GroupRepresentation
+}
+
+func createKeycloakRoles(export *RealmExportRepresentation) *keycloakRoles {
+	roles := &keycloakRoles{composites: map[keycloakRole]*RoleCompositesRepresentation{}, groups: map[string]*GroupRepresentation{}}
+	if export.Roles != nil {
+		for i := range export.Roles.Realm {
+			roles.composites[keycloakRole{name: export.Roles.Realm[i].Name}] = export.Roles.Realm[i].Composites
+		}
+		for client, clientRoles := range export.Roles.Client {
+			for i := range clientRoles {
+				roles.composites[keycloakRole{client: client, name: clientRoles[i].Name}] = clientRoles[i].Composites
+			}
+		}
+	}
+	roles.addGroups("", export.Groups)
+	return roles
+}
+
+// addGroups adds groups by path, path is built from groups names (i.e. /parent/child)
+func (roles *keycloakRoles) addGroups(parentPath string, groups []GroupRepresentation) {
+	for i := range groups {
+		path := parentPath + "/" + groups[i].Name
+		roles.groups[path] = &groups[i]
+		roles.addGroups(path, groups[i].SubGroups)
+	}
+}
+
+// getUserRoles returns sorted user effective realm roles and clients roles
+func (roles *keycloakRoles) getUserRoles(user *UserRepresentation) ([]string, map[string][]string) {
+	var pending []keycloakRole
+	addRoles := func(realmRoles []string, clientRoles map[string][]string) {
+		for _, role := range realmRoles {
+			pending = append(pending, keycloakRole{name: role})
+		}
+		for client, clientRolesList := range clientRoles {
+			for _, role := range clientRolesList {
+				pending = append(pending, keycloakRole{client: client, name: role})
+			}
+		}
+	}
+	addRoles(user.RealmRoles, user.ClientRoles)
+	for _, groupPath := range user.Groups {
+		path := ""
+		for _, name := range strings.Split(strings.TrimPrefix(groupPath, "/"), "/") {
+			path += "/" + name
+			if group := roles.groups[path]; group != nil {
+				addRoles(group.RealmRoles, group.ClientRoles)
+			}
+		}
+	}
+
+	granted := map[keycloakRole]bool{}
+	for len(pending) > 0 {
+		role := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if granted[role] {
+			continue
+		}
+		granted[role] = true
+		if composites := roles.composites[role]; composites != nil {
+			addRoles(composites.Realm, composites.Client)
+		}
+	}
+
+	var realmRoles []string
+	clientRoles := map[string][]string{}
+	for role := range granted {
+		if len(role.client) == 0 {
+			realmRoles = append(realmRoles, role.name)
+		} else {
+			clientRoles[role.client] = append(clientRoles[role.client], role.name)
+		}
+	}
+	sort.Strings(realmRoles)
+	for client := range clientRoles {
+		sort.Strings(clientRoles[client])
+	}
+	return realmRoles, clientRoles
+}
+
+// add adds description of data that was not transferred to report
+func (report *RealmTransferReport) add(unsupported string) {
+	report.Unsupported = append(report.Unsupported, unsupported)
+}
+
+// addUnsupportedFields adds to report fields of raw export object that are not imported and have non-default values, fields
+// of nested object (i.e. attributes or config) that are not imported are reported with nested object name prefix
+func (report *RealmTransferReport) addUnsupportedFields(object string, rawObject map[string]interface{}, importedFields map[string]bool,
+	importedNestedFields map[string]bool, nestedObject string,
+) {
+	fields := getUnsupportedFields(rawObject, importedFields, "")
+	if nested, ok := rawObject[nestedObject].(map[string]interface{}); ok && importedNestedFields != nil {
+		fields = append(fields, getUnsupportedFields(nested, importedNestedFields, nestedObject+".")...)
+	}
+	if len(fields) > 0 {
+		report.add(sf.Format("{0}: fields {1} are not supported", object, strings.Join(fields, ", ")))
+	}
+}
+
+func getUnsupportedFields(rawObject map[string]interface{}, importedFields map[string]bool, prefix string) []string {
+	var fields []string
+	for field, value := range rawObject {
+		if !importedFields[field] && !isDefaultValue(value) {
+			fields = append(fields, prefix+field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// isDefaultValue checks whether json value is empty, false or zero (Keycloak attributes keep booleans as strings)
+func isDefaultValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case float64:
+		return v == 0
+	case string:
+		return len(v) == 0 || v == "false"
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+func getRawObjects(rawValue interface{}) []interface{} {
+	objects, _ := rawValue.([]interface{})
+	return objects
+}
+
+func getRawObject(rawObjects []interface{}, index int) map[string]interface{} {
+	if index >= len(rawObjects) {
+		return nil
+	}
+	object, _ := rawObjects[index].(map[string]interface{})
+	return object
+}
+
+// getInfoRoles returns roles of user info realm_access or resource_access item ({"roles": [...]})
+func getInfoRoles(access interface{}) []string {
+	accessObject, _ := access.(map[string]interface{})
+	rawRoles, _ := accessObject[rolesInfoKey].([]interface{})
+	var roles []string
+	for _, rawRole := range rawRoles {
+		if role, ok := rawRole.(string); ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// getRawValues converts values to json array value (users raw data keeps arrays as []interface{})
+func getRawValues(values []string) []interface{} {
+	rawValues := make([]interface{}, len(values))
+	for i, v := range values {
+		rawValues[i] = v
+	}
+	return rawValues
+}
+
+func getSortedKeys(values map[string]bool) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func appendIfMissing(values []string, value string) []string {
+	if slices.Contains(values, value) {
+		return values
+	}
+	return append(values, value)
+}
@@ -0,0 +1,255 @@
+package dto
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wissance/Ferrum/data"
+)
+
+const testKeycloakRealmExport = `{
+	"id": "2f4a9a52-5c1a-4c7e-9a43-7c0b6a4f1d11",
+	"realm": "app",
+	"enabled": true,
+	"accessTokenLifespan": 300,
+	"ssoSessionIdleTimeout": 1800,
+	"ssoSessionMaxLifespan": 36000,
+	"offlineSessionIdleTimeout": 2592000,
+	"offlineSessionMaxLifespanEnabled": false,
+	"offlineSessionMaxLifespan": 5184000,
+	"revokeRefreshToken": true,
+	"refreshTokenMaxReuse": 0,
+	"registrationAllowed": false,
+	"sslRequired": "external",
+	"keycloakVersion": "24.0.1",
+	"attributes": {"frontendUrl": "https://sso.example.com", "cibaBackchannelTokenDeliveryMode": "", "userProfileEnabled": "false"},
+	"roles": {
+		"realm": [
+			{"name": "offline_access", "composite": false, "clientRole": false},
+			{"name": "developer", "composite": false, "clientRole": false},
+			{"name": "default-roles-app", "composite": true, "composites": {"realm": ["offline_access"], "client": {"account": ["view-profile"]}}, "clientRole": false}
+		],
+		"client": {
+			"web": [{"name": "editor", "composite": false, "clientRole": true}],
+			"realm-management": [
+				{"name": "realm-admin", "composite": true, "composites": {"client": {"realm-management": ["manage-users", "view-users", "query-users"]}}, "clientRole": true},
+				{"name": "view-users", "composite": true, "composites": {"client": {"realm-management": ["query-users"]}}, "clientRole": true}
+			]
+		}
+	},
+	"groups": [
+		{"name": "staff", "path": "/staff", "clientRoles": {"web": ["editor"]}, "subGroups": [{"name": "devs", "path": "/staff/devs", "realmRoles": ["developer"]}]}
+	],
+	"clients": [
+		{"id": "3a1f5d0e-7b0c-4d5e-8f3a-1b2c3d4e5f60", "clientId": "web", "enabled": true, "publicClient": false,
+		 "clientAuthenticatorType": "client-secret", "secret": "web_secret", "protocol": "openid-connect",
+		 "redirectUris": ["https://app.example.com/*"], "bearerOnly": false, "attributes": {"refresh.token.rotation": "true", "pkce.code.challenge.method": "S256"}},
+		{"id": "4b2f6e1f-8c1d-4e6f-9a4b-2c3d4e5f6071", "clientId": "spa", "enabled": true, "publicClient": true, "protocol": "openid-connect"},
+		{"id": "5c3a7f20-9d2e-4f70-8b5c-3d4e5f607182", "clientId": "backend", "enabled": true, "publicClient": false, "secret": "**********"},
+		{"id": "6d4b8031-ae3f-4081-9c6d-4e5f60718293", "clientId": "legacy", "enabled": false},
+		{"id": "7e5c9142-bf40-4192-ad7e-5f60718293a4", "clientId": "saml-app", "enabled": true, "protocol": "saml"},
+		{"id": "8f6da253-c051-42a3-be8f-60718293a4b5", "clientId": "account", "enabled": true, "publicClient": true}
+	],
+	"components": {
+		"org.keycloak.storage.UserStorageProvider": [
+			{"id": "b1c2d3e4", "name": "corp-ldap", "providerId": "ldap", "subComponents": {"org.keycloak.storage.ldap.mappers.LDAPStorageMapper": [{"name": "email"}]},
+			 "config": {"connectionUrl": ["ldap://ldap.example.com"], "bindDn": ["cn=admin,dc=example,dc=com"], "bindCredential": ["**********"],
+			            "usersDn": ["ou=users,dc=example,dc=com"], "vendor": ["other"]}},
+			{"id": "c2d3e4f5", "name": "kerberos", "providerId": "kerberos", "config": {}}
+		],
+		"org.keycloak.keys.KeyProvider": [{"name": "rsa-generated", "providerId": "rsa-generated"}]
+	},
+	"users": [
+		{"id": "0b0f5c2e-1e8b-4c56-9c3e-2f2a4d5b6c7d", "username": "alice", "email": "alice@example.com", "firstName": "Alice",
+		 "emailVerified": true, "enabled": true, "createdTimestamp": 1700000000000, "totp": false, "requiredActions": [],
+		 "attributes": {"department": ["sales"]},
+		 "credentials": [{"type": "password", "secretData": "{\"value\":\"hash\",\"salt\":\"salt\"}", "credentialData": "{\"hashIterations\":27500,\"algorithm\":\"pbkdf2-sha256\"}"}],
+		 "realmRoles": ["default-roles-app"], "groups": ["/staff/devs"]},
+		{"id": "1c1a6d3f-2f9c-4d67-8d4f-3a3b5e6c7d8e", "username": "bob", "enabled": false,
+		 "credentials": [{"type": "password", "value": "bob_password", "temporary": true}, {"type": "otp", "secretData": "{}"}],
+		 "clientRoles": {"realm-management": ["view-users", "view-events"], "web": ["editor"]}},
+		{"id": "2d2b7e40-3a0d-4e78-9e50-4b4c6f7d8e9f", "username": "carol", "enabled": true, "clientRoles": {"realm-management": ["realm-admin"]}},
+		{"id": "3e3c8f51-4b1e-4f89-af61-5c5d7a8e9fa0", "username": "dave", "enabled": true, "federationLink": "b1c2d3e4"},
+		{"id": "4f4d9062-5c2f-409a-b072-6d6e8b9fa0b1", "username": "erin", "enabled": true, "federationLink": "c2d3e4f5"}
+	]
+}`
+
+func TestImportKeycloakRealm(t *testing.T) {
+	realm, report, err := ImportKeycloakRealm([]byte(testKeycloakRealmExport))
+	require.NoError(t, err)
+
+	assert.Equal(t, "app", realm.Name)
+	assert.Equal(t, 300, realm.TokenExpiration)
+	assert.Equal(t, 1800, realm.RefreshTokenExpiration)
+	assert.Equal(t, 1800, realm.SessionIdleTimeout)
+	assert.Equal(t, 0, realm.OfflineSessionMaxLifespan)
+	assert.True(t, realm.RefreshTokenRotation)
+	assert.Equal(t, RealmTransferReport{Realm: "app", Clients: 3, Users: 4, UserFederations: 1, Unsupported: report.Unsupported}, *report)
+
+	require.Len(t, realm.Clients, 3)
+	assert.Equal(t, "web", realm.Clients[0].Name)
+	assert.Equal(t, "web_secret", realm.Clients[0].Auth.Value)
+	assert.True(t, *realm.Clients[0].RefreshTokenRotation)
+	assert.Equal(t, data.Public, realm.Clients[1].Type)
+	assert.NotEqual(t, SecretMask, realm.Clients[2].Auth.Value)
+	assert.NotEmpty(t, realm.Clients[2].Auth.Value)
+
+	require.Len(t, realm.UserFederationServices, 1)
+	assert.Equal(t, "corp-ldap", realm.UserFederationServices[0].Name)
+	assert.Equal(t, "ldap://ldap.example.com", realm.UserFederationServices[0].Url)
+	assert.Empty(t, realm.UserFederationServices[0].SysPassword)
+
+	require.Len(t, realm.Users, 4)
+	users := map[string]data.User{}
+	for _, u := range realm.Users {
+		user := data.CreateUser(u, nil)
+		users[user.GetUsername()] = user
+	}
+	alice := users["alice"]
+	require.NotNil(t, alice)
+	info := alice.GetUserInfo().(map[string]interface{})
+	assert.Equal(t, "sales", info["department"])
+	assert.Equal(t, []string{"default-roles-app", "developer", "offline_access"}, getInfoRoles(info[realmAccessInfoKey]))
+	resourceAccess := info[resourceAccessInfoKey].(map[string]interface{})
+	assert.Equal(t, []string{"view-profile"}, getInfoRoles(resourceAccess["account"]))
+	assert.Equal(t, []string{"editor"}, getInfoRoles(resourceAccess["web"]))
+	// user with password hash gets random password
+	assert.NotEmpty(t, alice.GetPasswordHash())
+	assert.Empty(t, alice.GetAdminRoles())
+
+	bob := users["bob"]
+	assert.Equal(t, "bob_password", bob.GetPasswordHash())
+	assert.False(t, bob.IsEnabled())
+	assert.Equal(t, map[string][]data.AdminRole{"app": {data.ViewUsers}}, bob.GetAdminRoles())
+	bobInfo := bob.GetUserInfo().(map[string]interface{})
+	assert.NotContains(t, bobInfo[resourceAccessInfoKey], realmManagementClient)
+
+	assert.Equal(t, map[string][]data.AdminRole{"app": {data.RealmAdmin}}, users["carol"].GetAdminRoles())
+	assert.Equal(t, "corp-ldap", users["dave"].GetFederationId())
+	assert.Empty(t, users["dave"].GetPasswordHash())
+
+	assert.ElementsMatch(t, []string{
+		"realm: fields sslRequired, attributes.frontendUrl are not supported",
+		"roles: role definitions are not imported, roles are imported as users roles (realm_access, resource_access) and admin roles",
+		"groups: groups are not imported, groups roles are imported as roles of group members",
+		"client \"web\": fields redirectUris, attributes.pkce.code.challenge.method are not supported",
+		"client \"backend\": export doesn't contain client secret, new secret is generated",
+		"client \"legacy\": disabled client is not imported",
+		"client \"saml-app\": protocol \"saml\" is not supported, client is not imported",
+		"client \"account\": Keycloak built-in client is not imported",
+		"components: components of type \"org.keycloak.keys.KeyProvider\" are not imported",
+		"user federation \"corp-ldap\": export doesn't contain bind credential, it must be set after import",
+		"user federation \"corp-ldap\": fields subComponents, config.vendor are not supported",
+		"user federation \"kerberos\": provider \"kerberos\" is not supported, user federation is not imported",
+		"user \"alice\": password hash could not be imported, password must be reset",
+		"user \"bob\": temporary password is imported as permanent",
+		"user \"bob\": credential of type \"otp\" is not imported",
+		"user \"bob\": admin roles view-events of realm \"app\" are not supported",
+		"user \"erin\": user federation \"c2d3e4f5\" is not imported, user is not imported",
+	}, report.Unsupported)
+}
+
+func TestImportKeycloakMasterRealmAdminRoles(t *testing.T) {
+	export := `{"realm": "master", "enabled": true, "users": [
+		{"username": "admin", "enabled": true, "credentials": [{"type": "password", "value": "admin_password"}], "realmRoles": ["admin"]},
+		{"username": "app_admin", "enabled": true, "credentials": [{"type": "password", "value": "password"}],
+		 "clientRoles": {"app-realm": ["manage-users", "manage-clients"], "master-realm": ["view-realm"]}}
+	]}`
+	realm, report, err := ImportKeycloakRealm([]byte(export))
+	require.NoError(t, err)
+	assert.Empty(t, report.Unsupported)
+	require.Len(t, realm.Users, 2)
+	admin := data.CreateUser(realm.Users[0], nil)
+	assert.Equal(t, map[string][]data.AdminRole{data.AllRealms: {data.RealmAdmin}}, admin.GetAdminRoles())
+	appAdmin := data.CreateUser(realm.Users[1], nil)
+	assert.Equal(t, map[string][]data.AdminRole{"app": {data.ManageClients, data.ManageUsers}, "master": {data.ViewRealm}},
+		appAdmin.GetAdminRoles())
+	assert.NotContains(t, appAdmin.GetUserInfo(), resourceAccessInfoKey)
+}
+
+func TestImportInvalidKeycloakRealm(t *testing.T) {
+	testCases := []struct {
+		name   string
+		export string
+	}{
+		{name: "not_json", export: `realm`},
+		{name: "no_realm_name", export: `{"enabled": true}`},
+		{name: "bad_attribute", export: `{"realm": "app", "attributes": {"maxUserSessions": "many"}}`},
+		{name: "bad_client_id", export: `{"realm": "app", "clients": [{"id": "1", "clientId": "web", "enabled": true, "publicClient": true}]}`},
+		{name: "no_username", export: `{"realm": "app", "users": [{"enabled": true}]}`},
+	}
+	for _, tCase := range testCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			_, _, err := ImportKeycloakRealm([]byte(tCase.export))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestExportKeycloakRealm(t *testing.T) {
+	realm := data.Realm{Name: "app", TokenExpiration: 300, RefreshTokenExpiration: 1200, SessionIdleTimeout: 1800}
+	rotation := false
+	clients := []data.Client{
+		{Name: "web", Type: data.Confidential, Auth: data.Authentication{Type: data.ClientIdAndSecrets, Value: "web_secret"},
+			RefreshTokenRotation: &rotation},
+	}
+	var rawUsers []interface{}
+	err := json.Unmarshal([]byte(`[
+		{"info": {"sub": "0b0f5c2e-1e8b-4c56-9c3e-2f2a4d5b6c7d", "preferred_username": "alice", "department": "sales",
+		          "realm_access": {"roles": ["developer", "offline_access"]}, "resource_access": {"web": {"roles": ["editor"]}, "account": {"roles": ["view-profile"]}}},
+		 "credentials": {"password": "hash"}, "enabled": false, "admin_roles": {"app": ["manage-users", "manage-federation"], "other": ["realm-admin"]}},
+		{"info": {"sub": "1c1a6d3f-2f9c-4d67-8d4f-3a3b5e6c7d8e", "preferred_username": "dave"}, "federation": {"name": "corp-ldap"}}
+	]`), &rawUsers)
+	require.NoError(t, err)
+	users := []data.User{data.CreateUser(rawUsers[0], nil), data.CreateUser(rawUsers[1], nil)}
+	federationConfigs := []data.UserFederationServiceConfig{
+		{Name: "corp-ldap", Type: data.FreeIPA, Url: "ldap://ipa.example.com", SysUser: "uid=admin", SysPassword: "secret", EntryPoint: "cn=users"},
+	}
+
+	export, report := ExportKeycloakRealm(&realm, clients, users, federationConfigs)
+	assert.Equal(t, "app", export.Realm)
+	assert.Equal(t, 300, export.AccessTokenLifespan)
+	require.Len(t, export.Clients, 1)
+	assert.Equal(t, "web_secret", export.Clients[0].Secret)
+	component := export.Components[UserStorageProviderType][0]
+	assert.Equal(t, string(data.LDAP), component.ProviderId)
+	assert.Equal(t, []string{"secret"}, component.Config[bindCredentialConfigKey])
+	assert.Equal(t, []string{freeIpaLdapVendor}, component.Config[ldapVendorConfigKey])
+
+	require.Len(t, export.Users, 2)
+	alice := export.Users[0]
+	assert.False(t, alice.Enabled)
+	assert.Equal(t, map[string][]string{"department": {"sales"}}, alice.Attributes)
+	assert.Equal(t, []string{"developer", "offline_access"}, alice.RealmRoles)
+	assert.Equal(t, map[string][]string{"web": {"editor"}, "account": {"view-profile"}, realmManagementClient: {"manage-users"}},
+		alice.ClientRoles)
+	assert.Empty(t, alice.Credentials)
+	assert.Equal(t, "corp-ldap", export.Users[1].FederationLink)
+	// only roles of exported clients and not built-in realm roles are defined
+	assert.Equal(t, &RolesRepresentation{
+		Realm:  []RoleRepresentation{{Name: "developer"}},
+		Client: map[string][]RoleRepresentation{"web": {{Name: "editor", ClientRole: true}}},
+	}, export.Roles)
+
+	assert.Equal(t, RealmTransferReport{Realm: "app", Clients: 1, Users: 2, UserFederations: 1, Unsupported: report.Unsupported}, *report)
+	assert.ElementsMatch(t, []string{
+		"user federation \"corp-ldap\": Keycloak doesn't have freeipa provider, config is exported as ldap provider",
+		"user federation \"corp-ldap\": only connection settings are exported, LDAP attributes mapping must be configured in Keycloak",
+		"user \"alice\": admin role manage-federation doesn't exist in Keycloak, it is not exported",
+		"user \"alice\": admin roles of realm \"other\" are not exported",
+		"users: passwords are not exported, passwords of 1 user(s) must be reset in Keycloak",
+	}, report.Unsupported)
+
+	// exported realm is imported back with the same roles
+	exportJson, err := json.Marshal(export)
+	require.NoError(t, err)
+	importedRealm, _, err := ImportKeycloakRealm(exportJson)
+	require.NoError(t, err)
+	importedAlice := data.CreateUser(importedRealm.Users[0], nil)
+	assert.Equal(t, map[string][]data.AdminRole{"app": {data.ManageUsers}}, importedAlice.GetAdminRoles())
+	assert.Equal(t, users[0].GetUserInfo().(map[string]interface{})[realmAccessInfoKey],
+		importedAlice.GetUserInfo().(map[string]interface{})[realmAccessInfoKey])
+	assert.Equal(t, 1200, importedRealm.RefreshTokenExpiration)
+}
@@ -0,0 +1,459 @@
+package dto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/wissance/Ferrum/data"
+	"github.com/wissance/Ferrum/utils/encoding"
+	sf "github.com/wissance/stringFormatter"
+)
+
+const (
+	// SecretMask is a value that is returned instead of secrets (i.e. federation bind credentials), if it is sent back secret remains unchanged
+	SecretMask = data.SecretMask
+	// UserStorageProviderType is a Keycloak type of components that are user federation providers
+	UserStorageProviderType = "org.keycloak.storage.UserStorageProvider"
+	// PasswordCredentialType is a Keycloak type of password credential
+	PasswordCredentialType = "password"
+	// ClientSecretAuthenticator is a Keycloak authenticator type of confidential clients
+	ClientSecretAuthenticator = "client-secret"
+
+	refreshTokenExpirationAttribute = "refreshTokenExpiration"
+	maxUserSessionsAttribute        = "maxUserSessions"
+	sessionEvictionPolicyAttribute  = "sessionEvictionPolicy"
+	refreshTokenRotationAttribute   = "refresh.token.rotation"
+
+	connectionUrlConfigKey  = "connectionUrl"
+	bindDnConfigKey         = "bindDn"
+	bindCredentialConfigKey = "bindCredential"
+	usersDnConfigKey        = "usersDn"
+)
+
+// standard user info keys that are mapped to UserRepresentation fields, all other info keys are user attributes
+var userInfoFields = map[string]bool{
+	"sub": true, "preferred_username": true, "email": true, "given_name": true, "family_name": true, "email_verified": true,
+}
+
+// RealmRepresentation is a Keycloak compatible realm representation for admin API
+/* Ferrum realms are always enabled, realm settings that Keycloak doesn't have are passed via Attributes (refreshTokenExpiration,
+ * maxUserSessions and sessionEvictionPolicy). Clients and Users are using only on realm creation.
+ */
+type RealmRepresentation struct {
+	Id                               string                 `json:"id,omitempty"`
+	Realm                            string                 `json:"realm"`
+	Enabled                          bool                   `json:"enabled"`
+	AccessTokenLifespan              int                    `json:"accessTokenLifespan"`
+	SsoSessionIdleTimeout            int                    `json:"ssoSessionIdleTimeout"`
+	SsoSessionMaxLifespan            int                    `json:"ssoSessionMaxLifespan"`
+	OfflineSessionIdleTimeout        int                    `json:"offlineSessionIdleTimeout"`
+	OfflineSessionMaxLifespan        int                    `json:"offlineSessionMaxLifespan"`
+	OfflineSessionMaxLifespanEnabled bool                   `json:"offlineSessionMaxLifespanEnabled"`
+	RevokeRefreshToken               bool                   `json:"revokeRefreshToken"`
+	NotBefore                        int64                  `json:"notBefore"`
+	Attributes                       map[string]string      `json:"attributes,omitempty"`
+	Clients                          []ClientRepresentation `json:"clients,omitempty"`
+	Users                            []UserRepresentation   `json:"users,omitempty"`
+}
+
+// ClientRepresentation is a Keycloak compatible client representation for admin API
+/* Id is a client identifier (uuid), ClientId is a client name (Ferrum client name is also unique in a realm)
+ */
+type ClientRepresentation struct {
+	Id                      string            `json:"id,omitempty"`
+	ClientId                string            `json:"clientId"`
+	Name                    string            `json:"name,omitempty"`
+	Enabled                 bool              `json:"enabled"`
+	PublicClient            bool              `json:"publicClient"`
+	ClientAuthenticatorType string            `json:"clientAuthenticatorType,omitempty"`
+	Secret                  string            `json:"secret,omitempty"`
+	Attributes              map[string]string `json:"attributes,omitempty"`
+}
+
+// CredentialRepresentation is a Keycloak compatible credential representation, only password credentials are supported
+/* SecretData and CredentialData are present only in Keycloak realm exports (hashed password and hashing algorithm), they
+ * could not be used by Ferrum because Ferrum hashes passwords by own algorithm
+ */
+type CredentialRepresentation struct {
+	Type           string `json:"type"`
+	Value          string `json:"value"`
+	Temporary      bool   `json:"temporary"`
+	SecretData     string `json:"secretData,omitempty"`
+	CredentialData string `json:"credentialData,omitempty"`
+}
+
+// UserRepresentation is a Keycloak compatible user representation for admin API
+/* Id is info.sub, Username is info.preferred_username, all user info keys that don't have own field are Attributes,
+ * FederationLink is a name of user federation config. Credentials are never returned. RealmRoles, ClientRoles and Groups
+ * (group paths) are role mappings of Keycloak realm exports (see RealmExportRepresentation).
+ */
+type UserRepresentation struct {
+	Id             string                     `json:"id,omitempty"`
+	Username       string                     `json:"username"`
+	Email          string                     `json:"email,omitempty"`
+	FirstName      string                     `json:"firstName,omitempty"`
+	LastName       string                     `json:"lastName,omitempty"`
+	EmailVerified  bool                       `json:"emailVerified"`
+	Enabled        bool                       `json:"enabled"`
+	FederationLink string                     `json:"federationLink,omitempty"`
+	Attributes     map[string][]string        `json:"attributes,omitempty"`
+	Credentials    []CredentialRepresentation `json:"credentials,omitempty"`
+	RealmRoles     []string                   `json:"realmRoles,omitempty"`
+	ClientRoles    map[string][]string        `json:"clientRoles,omitempty"`
+	Groups         []string                   `json:"groups,omitempty"`
+}
+
+// ComponentRepresentation is a Keycloak compatible component representation of user federation config
+/* Id and Name are both config name, ProviderId is config type (ldap or freeipa), ParentId is realm name,
+ * Config keys are connectionUrl, bindDn, bindCredential (always masked) and usersDn
+ */
+type ComponentRepresentation struct {
+	Id           string              `json:"id,omitempty"`
+	Name         string              `json:"name"`
+	ProviderId   string              `json:"providerId"`
+	ProviderType string              `json:"providerType"`
+	ParentId     string              `json:"parentId,omitempty"`
+	Config       map[string][]string `json:"config,omitempty"`
+}
+
+// CreateRealmRepresentation creates RealmRepresentation from realm, clients and users are not included
+/* Parameters:
+ *     - realm - realm
+ * Returns: realm representation
+ */
+func CreateRealmRepresentation(realm *data.Realm) RealmRepresentation {
+	rep := RealmRepresentation{
+		Id: realm.Name, Realm: realm.Name, Enabled: true, AccessTokenLifespan: realm.TokenExpiration,
+		SsoSessionIdleTimeout: realm.SessionIdleTimeout, SsoSessionMaxLifespan: realm.SessionMaxLifespan,
+		OfflineSessionIdleTimeout: realm.OfflineSessionIdleTimeout, OfflineSessionMaxLifespan: realm.OfflineSessionMaxLifespan,
+		OfflineSessionMaxLifespanEnabled: realm.OfflineSessionMaxLifespan > 0, RevokeRefreshToken: realm.RefreshTokenRotation,
+		NotBefore: realm.NotBefore,
+		Attributes: map[string]string{
+			refreshTokenExpirationAttribute: strconv.Itoa(realm.RefreshTokenExpiration),
+			maxUserSessionsAttribute:        strconv.Itoa(realm.MaxUserSessions),
+		},
+	}
+	if len(realm.SessionEvictionPolicy) > 0 {
+		rep.Attributes[sessionEvictionPolicyAttribute] = string(realm.SessionEvictionPolicy)
+	}
+	return rep
+}
+
+// ApplyTo sets realm settings from representation, realm name is changed only if Realm is not empty
+/* Attributes that are absent in the representation remain unchanged
+ * Parameters:
+ *     - realm - realm to change
+ * Returns: error if representation values are invalid
+ */
+func (rep *RealmRepresentation) ApplyTo(realm *data.Realm) error {
+	if len(rep.Realm) > 0 {
+		realm.Name = rep.Realm
+	}
+	realm.TokenExpiration = rep.AccessTokenLifespan
+	realm.SessionIdleTimeout = rep.SsoSessionIdleTimeout
+	realm.SessionMaxLifespan = rep.SsoSessionMaxLifespan
+	realm.OfflineSessionIdleTimeout = rep.OfflineSessionIdleTimeout
+	realm.OfflineSessionMaxLifespan = rep.OfflineSessionMaxLifespan
+	if !rep.OfflineSessionMaxLifespanEnabled {
+		realm.OfflineSessionMaxLifespan = 0
+	}
+	realm.RefreshTokenRotation = rep.RevokeRefreshToken
+	realm.NotBefore = rep.NotBefore
+	intAttributes := map[string]*int{
+		refreshTokenExpirationAttribute: &realm.RefreshTokenExpiration,
+		maxUserSessionsAttribute:        &realm.MaxUserSessions,
+	}
+	for name, field := range intAttributes {
+		if value, ok := rep.Attributes[name]; ok {
+			intValue, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("realm attribute \"%s\" must be an integer: %w", name, err)
+			}
+			*field = intValue
+		}
+	}
+	if policy, ok := rep.Attributes[sessionEvictionPolicyAttribute]; ok {
+		realm.SessionEvictionPolicy = data.SessionEvictionPolicy(policy)
+	}
+	if realm.TokenExpiration < 0 || realm.RefreshTokenExpiration < 0 || realm.MaxUserSessions < 0 || realm.SessionIdleTimeout < 0 ||
+		realm.SessionMaxLifespan < 0 || realm.OfflineSessionIdleTimeout < 0 || realm.OfflineSessionMaxLifespan < 0 || realm.NotBefore < 0 {
+		return errors.New("realm timeouts and limits must not be negative")
+	}
+	return nil
+}
+
+// CreateClientRepresentation creates ClientRepresentation from client
+/* Parameters:
+ *     - client - realm client
+ * Returns: client representation
+ */
+func CreateClientRepresentation(client *data.Client) ClientRepresentation {
+	rep := ClientRepresentation{
+		Id: client.ID.String(), ClientId: client.Name, Name: client.Name, Enabled: true, PublicClient: client.Type == data.Public,
+	}
+	if client.Type == data.Confidential {
+		rep.ClientAuthenticatorType = ClientSecretAuthenticator
+		rep.Secret = client.Auth.Value
+	}
+	if client.RefreshTokenRotation != nil {
+		rep.Attributes = map[string]string{refreshTokenRotationAttribute: strconv.FormatBool(*client.RefreshTokenRotation)}
+	}
+	return rep
+}
+
+// ToClient creates client from representation, new identifier is generated if Id is empty
+/* Returns: client and error if representation values are invalid
+ */
+func (rep *ClientRepresentation) ToClient() (data.Client, error) {
+	client := data.Client{Name: rep.ClientId, Type: data.Confidential}
+	if len(client.Name) == 0 {
+		return client, errors.New("clientId is required")
+	}
+	client.ID = uuid.New()
+	if len(rep.Id) > 0 {
+		id, err := uuid.Parse(rep.Id)
+		if err != nil {
+			return client, fmt.Errorf("client id must be uuid: %w", err)
+		}
+		client.ID = id
+	}
+	if rep.PublicClient {
+		client.Type = data.Public
+	} else {
+		client.Auth = data.Authentication{Type: data.ClientIdAndSecrets, Value: rep.Secret}
+	}
+	if value, ok := rep.Attributes[refreshTokenRotationAttribute]; ok && len(value) > 0 {
+		rotation, err := strconv.ParseBool(value)
+		if err != nil {
+			return client, fmt.Errorf("client attribute \"%s\" must be a boolean: %w", refreshTokenRotationAttribute, err)
+		}
+		client.RefreshTokenRotation = &rotation
+	}
+	return client, nil
+}
+
+// CreateUserRepresentation creates UserRepresentation from user, credentials are not included
+/* Parameters:
+ *     - user - realm user
+ * Returns: user representation
+ */
+func CreateUserRepresentation(user data.User) UserRepresentation {
+	rep := UserRepresentation{Id: user.GetId().String(), Username: user.GetUsername(), Enabled: true, FederationLink: user.GetFederationId()}
+	info, _ := user.GetUserInfo().(map[string]interface{})
+	rep.Email, _ = info["email"].(string)
+	rep.FirstName, _ = info["given_name"].(string)
+	rep.LastName, _ = info["family_name"].(string)
+	rep.EmailVerified, _ = info["email_verified"].(bool)
+	for key, value := range info {
+		if userInfoFields[key] {
+			continue
+		}
+		if rep.Attributes == nil {
+			rep.Attributes = map[string][]string{}
+		}
+		rep.Attributes[key] = getAttributeValues(value)
+	}
+	return rep
+}
+
+// ToUser creates user from representation, representation is applied over oldUser data if it is not nil
+/* User info keys that are not present in Attributes are removed if Attributes is not nil, attributes that were not changed
+ * keep their original json type. Password from Credentials is hashed using encoder, if encoder is nil password is kept as is
+ * (i.e. realm creation hashes passwords itself). New identifier is generated if Id is empty.
+ * Parameters:
+ *     - oldUser - current user data or nil
+ *     - encoder - realm password encoder
+ * Returns: user and error if representation values are invalid
+ */
+func (rep *UserRepresentation) ToUser(oldUser data.User, encoder *encoding.PasswordJsonEncoder) (data.User, error) {
+	if len(rep.Username) == 0 {
+		return nil, errors.New("username is required")
+	}
+	id := uuid.New()
+	if len(rep.Id) > 0 {
+		parsedId, err := uuid.Parse(rep.Id)
+		if err != nil {
+			return nil, fmt.Errorf("user id must be uuid: %w", err)
+		}
+		id = parsedId
+	}
+	rawData := map[string]interface{}{}
+	if oldUser != nil {
+		if err := json.Unmarshal([]byte(oldUser.GetJsonString()), &rawData); err != nil {
+			return nil, fmt.Errorf("user data is not an object: %w", err)
+		}
+	}
+	info, _ := rawData["info"].(map[string]interface{})
+	if info == nil {
+		info = map[string]interface{}{}
+	}
+	if rep.Attributes != nil {
+		for key, value := range info {
+			if userInfoFields[key] {
+				continue
+			}
+			newValue, ok := rep.Attributes[key]
+			if !ok {
+				delete(info, key)
+			} else if !equalValues(getAttributeValues(value), newValue) {
+				info[key] = getAttributeRawValue(newValue)
+			}
+		}
+		for key, newValue := range rep.Attributes {
+			if _, ok := info[key]; !ok && !userInfoFields[key] {
+				info[key] = getAttributeRawValue(newValue)
+			}
+		}
+	}
+	info["sub"] = id.String()
+	info["preferred_username"] = rep.Username
+	info["email_verified"] = rep.EmailVerified
+	setOrDeleteValue(info, "email", rep.Email)
+	setOrDeleteValue(info, "given_name", rep.FirstName)
+	setOrDeleteValue(info, "family_name", rep.LastName)
+	rawData["info"] = info
+	if len(rep.FederationLink) > 0 {
+		rawData["federation"] = map[string]interface{}{"name": rep.FederationLink}
+	} else {
+		delete(rawData, "federation")
+	}
+
+	password := rep.GetPassword()
+	if password != nil {
+		rawData["credentials"] = map[string]interface{}{"password": *password}
+	}
+	user := data.CreateUser(rawData, nil)
+	if password != nil && encoder != nil {
+		if err := user.SetPassword(*password, encoder); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// GetPassword returns password from Credentials or nil if representation has no password credential
+func (rep *UserRepresentation) GetPassword() *string {
+	for i := range rep.Credentials {
+		if (rep.Credentials[i].Type == PasswordCredentialType || len(rep.Credentials[i].Type) == 0) && len(rep.Credentials[i].Value) > 0 {
+			return &rep.Credentials[i].Value
+		}
+	}
+	return nil
+}
+
+// CreateComponentRepresentation creates ComponentRepresentation from user federation config, bind credential is masked
+/* Parameters:
+ *     - realmName - name of a realm that config belongs to
+ *     - cfg - user federation config
+ * Returns: component representation
+ */
+func CreateComponentRepresentation(realmName string, cfg *data.UserFederationServiceConfig) ComponentRepresentation {
+	rep := ComponentRepresentation{
+		Id: cfg.Name, Name: cfg.Name, ProviderId: string(cfg.Type), ProviderType: UserStorageProviderType, ParentId: realmName,
+		Config: map[string][]string{
+			connectionUrlConfigKey: {cfg.Url},
+			bindDnConfigKey:        {cfg.SysUser},
+			usersDnConfigKey:       {cfg.EntryPoint},
+		},
+	}
+	if len(cfg.SysPassword) > 0 {
+		rep.Config[bindCredentialConfigKey] = []string{SecretMask}
+	}
+	return rep
+}
+
+// ToUserFederationConfig creates user federation config from representation
+/* If bind credential is SecretMask, bind credential of oldCfg is used
+ * Parameters:
+ *     - oldCfg - current config or nil
+ * Returns: user federation config and error if representation values are invalid
+ */
+func (rep *ComponentRepresentation) ToUserFederationConfig(oldCfg *data.UserFederationServiceConfig) (data.UserFederationServiceConfig, error) {
+	cfg := data.UserFederationServiceConfig{
+		Name: rep.Name, Type: data.UserFederationServiceType(rep.ProviderId), Url: getConfigValue(rep.Config, connectionUrlConfigKey),
+		SysUser: getConfigValue(rep.Config, bindDnConfigKey), SysPassword: getConfigValue(rep.Config, bindCredentialConfigKey),
+		EntryPoint: getConfigValue(rep.Config, usersDnConfigKey),
+	}
+	if len(cfg.Name) == 0 {
+		return cfg, errors.New("component name is required")
+	}
+	if cfg.Type != data.LDAP && cfg.Type != data.FreeIPA {
+		return cfg, errors.New(sf.Format("providerId \"{0}\" is not supported, use \"{1}\" or \"{2}\"", rep.ProviderId, data.LDAP, data.FreeIPA))
+	}
+	if len(rep.ProviderType) > 0 && rep.ProviderType != UserStorageProviderType {
+		return cfg, errors.New(sf.Format("providerType \"{0}\" is not supported", rep.ProviderType))
+	}
+	if cfg.SysPassword == SecretMask {
+		cfg.SysPassword = ""
+		if oldCfg != nil {
+			cfg.SysPassword = oldCfg.SysPassword
+		}
+	}
+	return cfg, nil
+}
+
+// getAttributeValues converts user info value to attribute values, arrays are converted by items, other values to their string form
+func getAttributeValues(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, item := range v {
+			values[i] = getAttributeValue(item)
+		}
+		return values
+	default:
+		return []string{getAttributeValue(v)}
+	}
+}
+
+func getAttributeValue(value interface{}) string {
+	if str, ok := value.(string); ok {
+		return str
+	}
+	jsonValue, _ := json.Marshal(value)
+	return string(jsonValue)
+}
+
+// getAttributeRawValue converts attribute values to user info value, single value is stored as string, multiple values as array
+func getAttributeRawValue(values []string) interface{} {
+	if len(values) == 1 {
+		return values[0]
+	}
+	rawValues := make([]interface{}, len(values))
+	for i, v := range values {
+		rawValues[i] = v
+	}
+	return rawValues
+}
+
+func equalValues(first []string, second []string) bool {
+	if len(first) != len(second) {
+		return false
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func setOrDeleteValue(values map[string]interface{}, key string, value string) {
+	if len(value) > 0 {
+		values[key] = value
+	} else {
+		delete(values, key)
+	}
+}
+
+func getConfigValue(config map[string][]string, key string) string {
+	if values := config[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
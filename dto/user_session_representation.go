@@ -0,0 +1,38 @@
+package dto
+
+import "github.com/wissance/Ferrum/data"
+
+// UserSessionRepresentation is a Keycloak compatible user session info for admin API
+/* Start and LastAccess are unix time in milliseconds, Clients is a map of clients that session was started by (key and value are client name)
+ */
+type UserSessionRepresentation struct {
+	Id         string            `json:"id"`
+	Username   string            `json:"username"`
+	UserId     string            `json:"userId"`
+	IpAddress  string            `json:"ipAddress"`
+	Start      int64             `json:"start"`
+	LastAccess int64             `json:"lastAccess"`
+	Clients    map[string]string `json:"clients"`
+}
+
+// CreateUserSessionRepresentation creates UserSessionRepresentation from session, tokens are not included
+/* Parameters:
+ *     - session - user session
+ *     - username - name of a user that session belongs to
+ * Returns: session representation
+ */
+func CreateUserSessionRepresentation(session *data.UserSession, username string) UserSessionRepresentation {
+	clients := map[string]string{}
+	if len(session.ClientId) > 0 {
+		clients[session.ClientId] = session.ClientId
+	}
+	return UserSessionRepresentation{
+		Id: session.Id.String(), Username: username, UserId: session.UserId.String(), IpAddress: session.IpAddress,
+		Start: session.Started.UnixMilli(), LastAccess: session.LastActivity.UnixMilli(), Clients: clients,
+	}
+}
+
+// NotBeforePolicy is a realm revocation timestamp (unix time in seconds), tokens of sessions that were not active since it are not valid
+type NotBeforePolicy struct {
+	NotBefore int64 `json:"notBefore"`
+}
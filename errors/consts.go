@@ -14,6 +14,31 @@ const (
 	InvalidTokenMsg              = "Invalid token"
 	InvalidTokenDesc             = "Token verification failed"
 	TokenIsNotActive             = "Token is not active"
+	TokenIssuedToAnotherClient   = "Token was issued to another client"
+	SessionIsNotActive           = "Session is not active"
+	RefreshTokenWasAlreadyUsed   = "Refresh token was already used, session is revoked"
+	RefreshTokenWasReplaced      = "Refresh token was replaced by concurrent refresh"
+	InvalidScopeMsg              = "Invalid scope"
+	OfflineTokensNotSupported    = "Offline tokens are not supported by data storage"
+	AdminAccessRequiredDesc      = "Valid access token of an administrator is required"
+	UserDoesNotExistsTemplate    = "User \"{0}\" does not exists"
+	ClientDoesNotExistsTemplate  = "Client \"{0}\" does not exists"
+	SessionDoesNotExistsTemplate = "Session \"{0}\" does not exists"
+	BadBodyMsg                   = "Bad request body"
+	OperationNotSupportedMsg     = "Operation is not supported by data storage"
+	VersionConflictMsg           = "Object was changed by someone else, reload it and retry"
+	InvalidIfMatchMsg            = "If-Match header must contain object version (ETag)"
+
+	ObjectDoesNotExistsTemplate = "{0} \"{1}\" does not exists"
+	ObjectExistsTemplate        = "{0} \"{1}\" already exists"
+	MasterRealmDeleteMsg        = "Master realm can't be deleted"
+	RealmRenameNotSupportedMsg  = "Realm renaming is not supported"
+	PublicClientHasNoSecretMsg  = "Public client doesn't have a secret"
+	AccessDeniedMsg             = "Access denied"
+	AdminRoleRequiredTemplate   = "One of admin roles {0} is required for realm \"{1}\""
+	AdminRolesChangeDeniedDesc  = "Changing of administrators requires realm-admin role"
+
+	UserSessionsLimitReachedDescTemplate = "Maximum number of user sessions ({0}) is reached"
 
 	ServiceIsUnavailable = "Service is not available, please check again later"
 	OtherAppError        = "Other error"
@@ -14,6 +14,7 @@ var (
 	ErrOperationNotSupported   = errors.New("manager operation is not supported yet (temporarily or permanent)")
 	ErrOperationNotImplemented = errors.New("manager operation is not implemented yet (wait for future releases)")
 	ErrDataSourceNotAvailable  = DataProviderNotAvailable{}
+	ErrVersionConflict         = ObjectVersionConflictError{}
 )
 
 type ObjectAlreadyExistsError struct {
@@ -28,6 +29,15 @@ type ObjectNotFoundError struct {
 	additionalInfo string
 }
 
+// ObjectVersionConflictError is returned by update when stored object version differs from the expected version (object was
+// changed by someone else after it had been read)
+type ObjectVersionConflictError struct {
+	objectType      string
+	objectId        string
+	expectedVersion int64
+	actualVersion   int64
+}
+
 type UnknownError struct {
 	operation   string
 	method      string
@@ -57,6 +67,15 @@ func (e ObjectNotFoundError) Error() string {
 		e.additionalInfo)
 }
 
+func NewObjectVersionConflictError(objectType string, objectId string, expectedVersion int64, actualVersion int64) ObjectVersionConflictError {
+	return ObjectVersionConflictError{objectType: objectType, objectId: objectId, expectedVersion: expectedVersion, actualVersion: actualVersion}
+}
+
+func (e ObjectVersionConflictError) Error() string {
+	return sf.Format("object of type \"{0}\" with id: \"{1}\" has version {2} in data store, but version {3} was expected", e.objectType,
+		e.objectId, e.actualVersion, e.expectedVersion)
+}
+
 func NewUnknownError(operation string, method string, internalErr error) UnknownError {
 	return UnknownError{operation: operation, method: method, internalErr: internalErr}
 }
@@ -65,6 +84,12 @@ func (e UnknownError) Error() string {
 	return sf.Format("An error occurred during: \"{0}\" in method: \"{1}\", internal error: {2}", e.operation, e.method, e.internalErr)
 }
 
+// Unwrap returns internal error, therefore errors.Is and errors.As see through UnknownError (i.e. DataProviderNotAvailable
+// returned by a nested operation)
+func (e UnknownError) Unwrap() error {
+	return e.internalErr
+}
+
 func NewDataProviderNotAvailable(providerType string, source string) DataProviderNotAvailable {
 	return DataProviderNotAvailable{providerType: providerType, source: source}
 }
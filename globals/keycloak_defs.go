@@ -5,10 +5,14 @@ const (
 	AuthorizationTokenGrantType = "authorization_token"
 	PasswordGrantType           = "password"
 	RealmPathVar                = "realm"
+	IdPathVar                   = "id"
+	SessionPathVar              = "session"
+	MasterRealm                 = "master"
 	ProfileScope                = "profile"
 	ProfileEmailScope           = "profile email"
 	EmailScope                  = "email"
 	OpenIdScope                 = "openid"
+	OfflineAccessScope          = "offline_access"
 	TokenFormKey                = "token"
 	TokenResponseType           = "token"
 	CodeResponseType            = "code"
@@ -9,6 +9,7 @@ require (
 	github.com/gorilla/handlers v1.5.1
 	github.com/gorilla/mux v1.8.0
 	github.com/gorilla/schema v1.2.0
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-colorable v0.1.6
 	github.com/ohler55/ojg v1.25.0
 	github.com/redis/go-redis/v9 v9.0.2
@@ -20,6 +21,7 @@ require (
 	github.com/wissance/go-config-extender v1.0.0
 	github.com/wissance/gwuu v1.2.4
 	github.com/wissance/stringFormatter v1.3.0
+	go.etcd.io/bbolt v1.3.10
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0
 )
 
@@ -0,0 +1,262 @@
+package bolt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/wissance/Ferrum/config"
+	appErrs "github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/logging"
+	sf "github.com/wissance/stringFormatter"
+	"go.etcd.io/bbolt"
+)
+
+// This set of const contains names of buckets and keys, every realm has its own bucket (named as realm) inside realmsBucket
+const (
+	realmsBucket              = "realms"
+	realmKey                  = "realm"
+	clientsBucket             = "clients"
+	usersBucket               = "users"
+	userIdsBucket             = "user_ids"
+	userFederationsBucket     = "user_federations"
+	offlineSessionsBucket     = "offline_sessions"
+	userOfflineSessionsBucket = "user_offline_sessions"
+	revisionsBucket           = "revisions"
+)
+
+// realmSubBuckets are buckets that every realm bucket contains
+var realmSubBuckets = []string{clientsBucket, usersBucket, userIdsBucket, userFederationsBucket, offlineSessionsBucket, userOfflineSessionsBucket}
+
+type objectType string
+
+const (
+	Realm                objectType = "realm"
+	Client               objectType = "client"
+	User                 objectType = "user"
+	UserFederationConfig objectType = "user federation config"
+	OfflineSession       objectType = "offline session"
+	Revision             objectType = "revision"
+)
+
+// openTimeout is a time of waiting for database file lock (database file could be opened only by one process at a time)
+const openTimeout = 5 * time.Second
+
+// BoltDataManager is an embedded transactional data store, it keeps all data in a single database file (bbolt)
+/*
+ * There are following store rules:
+ * 1. Every realm has its own bucket (named as realm) inside realmsBucket, realm (data.Realm) itself is stored by key realmKey
+ *    without clients, users and user federation configs
+ * 2. Every realm bucket contains sub-buckets (see realmSubBuckets):
+ *    - clientsBucket - clients (data.Client) by client name
+ *    - usersBucket - users raw data by username (index on username)
+ *    - userIdsBucket - usernames by user id (index on user id)
+ *    - userFederationsBucket - user federation configs (data.UserFederationServiceConfig) by config name
+ *    - offlineSessionsBucket - offline sessions (data.OfflineSession) by session id
+ *    - userOfflineSessionsBucket - empty values by keys {userId}_{sessionId} (index on user id)
+ * 3. Every DataContext operation is executed in a single transaction, therefore it is either applied completely or not at all
+ * 4. Expired offline sessions are not returned, they are removed on creation of a new offline session of the same user
+ * 5. Realm bucket could also contain revisionsBucket (it is created on first change) - revisions (data.Revision) of realm and
+ *    of every client as JSON array by key {objectType}:{clientName} ("realm" for realm), history of up to revisionsLimit revisions
+ *    is changed in the same transaction as object itself
+ */
+type BoltDataManager struct {
+	dbFile         string
+	db             *bbolt.DB
+	logger         *logging.AppLogger
+	revisionsLimit int
+}
+
+// CreateBoltDataManager is factory function for instance of BoltDataManager creation
+/* Opens (creates if it doesn't exist) database file, if database file is opened by other process function waits openTimeout
+ * Parameters:
+ *     - dataSourceCfg - Source is a path to database file, Options could contain config.RevisionsLimit
+ *     - logger - initialized logger instance
+ * Returns: data manager and error
+ */
+func CreateBoltDataManager(dataSourceCfg *config.DataSourceConfig, logger *logging.AppLogger) (*BoltDataManager, error) {
+	db, err := bbolt.Open(dataSourceCfg.Source, 0o600, &bbolt.Options{Timeout: openTimeout})
+	if err != nil {
+		logger.Error(sf.Format("An error occurred during database file \"{0}\" opening: {1}", dataSourceCfg.Source, err.Error()))
+		return nil, appErrs.NewUnknownError("bbolt.Open", "CreateBoltDataManager", err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, createErr := tx.CreateBucketIfNotExists([]byte(realmsBucket))
+		return createErr
+	})
+	if err != nil {
+		_ = db.Close()
+		logger.Error(sf.Format("An error occurred during database file \"{0}\" initialization: {1}", dataSourceCfg.Source, err.Error()))
+		return nil, appErrs.NewUnknownError("bbolt.DB.Update", "CreateBoltDataManager", err)
+	}
+	return &BoltDataManager{dbFile: dataSourceCfg.Source, db: db, logger: logger, revisionsLimit: dataSourceCfg.GetRevisionsLimit()}, nil
+}
+
+// IsAvailable methods that checks whether DataContext could be used or not
+/* Availability means that database file is opened (manager was not closed)
+ * Parameters: no
+ * Returns true if DataContext is available
+ */
+func (mn *BoltDataManager) IsAvailable() bool {
+	return mn.db.View(func(tx *bbolt.Tx) error { return nil }) == nil
+}
+
+// Close closes database file, manager could not be used after Close
+func (mn *BoltDataManager) Close() error {
+	return mn.db.Close()
+}
+
+// view executes read-only transaction
+/* Errors returned by fn are returned as is, therefore fn must return errors of errors package
+ * Parameters:
+ *     - ctx - context of operation, transaction is not started if it is already cancelled
+ *     - method - name of a calling method for errors
+ *     - fn - transaction function
+ * Returns: error
+ */
+func (mn *BoltDataManager) view(ctx context.Context, method string, fn func(tx *bbolt.Tx) error) error {
+	if err := mn.checkContext(ctx, method); err != nil {
+		return err
+	}
+	var fnErr error
+	err := mn.db.View(func(tx *bbolt.Tx) error {
+		fnErr = fn(tx)
+		return fnErr
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	return mn.getDbError("bbolt.DB.View", method, err)
+}
+
+// update executes read-write transaction, transaction is rolled back if fn returns error
+/* Write transactions are serialized by bbolt, therefore context is checked again when transaction is started and transaction
+ * is rolled back if operation was cancelled (or its deadline passed) while it waited for previous write transactions.
+ * Errors returned by fn are returned as is, therefore fn must return errors of errors package
+ * Parameters:
+ *     - ctx - context of operation
+ *     - method - name of a calling method for errors
+ *     - fn - transaction function
+ * Returns: error
+ */
+func (mn *BoltDataManager) update(ctx context.Context, method string, fn func(tx *bbolt.Tx) error) error {
+	if err := mn.checkContext(ctx, method); err != nil {
+		return err
+	}
+	var fnErr error
+	err := mn.db.Update(func(tx *bbolt.Tx) error {
+		if fnErr = mn.checkContext(ctx, method); fnErr != nil {
+			return fnErr
+		}
+		fnErr = fn(tx)
+		return fnErr
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	return mn.getDbError("bbolt.DB.Update", method, err)
+}
+
+// checkContext returns appErrs.DataProviderNotAvailable if operation was cancelled (i.e. client disconnected) or its deadline passed
+func (mn *BoltDataManager) checkContext(ctx context.Context, method string) error {
+	if err := ctx.Err(); err != nil {
+		mn.logger.Warn(sf.Format("Operation {0} was not completed: {1}", method, err.Error()))
+		return appErrs.NewDataProviderNotAvailable(string(config.BOLT), mn.dbFile)
+	}
+	return nil
+}
+
+// getDbError converts bbolt error to errors package error
+func (mn *BoltDataManager) getDbError(operation string, method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, bbolt.ErrDatabaseNotOpen) {
+		return appErrs.NewDataProviderNotAvailable(string(config.BOLT), mn.dbFile)
+	}
+	mn.logger.Error(sf.Format("An error occurred during {0} in {1}: {2}", operation, method, err.Error()))
+	return appErrs.NewUnknownError(operation, method, err)
+}
+
+// getRealmBucket returns bucket of realm with name = realmName
+/* Parameters:
+ *     - tx - transaction
+ *     - realmName - name of a realm
+ * Returns: bucket and error (appErrs.ObjectNotFoundError if realm doesn't exist)
+ */
+func getRealmBucket(tx *bbolt.Tx, realmName string) (*bbolt.Bucket, error) {
+	bucket := tx.Bucket([]byte(realmsBucket)).Bucket([]byte(realmName))
+	if bucket == nil {
+		return nil, appErrs.NewObjectNotFoundError(string(Realm), realmName, "")
+	}
+	return bucket, nil
+}
+
+// getRealmSubBucket returns sub-bucket (one of realmSubBuckets) of realm with name = realmName
+func getRealmSubBucket(tx *bbolt.Tx, realmName string, bucketName string) (*bbolt.Bucket, error) {
+	bucket, err := getRealmBucket(tx, realmName)
+	if err != nil {
+		return nil, err
+	}
+	return bucket.Bucket([]byte(bucketName)), nil
+}
+
+// getObject reads object by key from bucket
+/* Parameters:
+ *     - bucket - bucket that contains object
+ *     - objType - type of object (for errors)
+ *     - key - object key
+ *     - realmName - name of a realm that object belongs to (for errors)
+ * Returns: object and error (appErrs.ObjectNotFoundError if bucket doesn't contain key)
+ */
+func getObject[T any](bucket *bbolt.Bucket, objType objectType, key string, realmName string) (*T, error) {
+	value := bucket.Get([]byte(key))
+	if value == nil {
+		return nil, appErrs.NewObjectNotFoundError(string(objType), key, sf.Format("realm: {0}", realmName))
+	}
+	var obj T
+	if err := json.Unmarshal(value, &obj); err != nil {
+		return nil, appErrs.NewUnknownError("json.Unmarshal", sf.Format("getObject[{0}]", objType), err)
+	}
+	return &obj, nil
+}
+
+// getObjects reads all bucket objects (ordered by key)
+func getObjects[T any](bucket *bbolt.Bucket, objType objectType) ([]T, error) {
+	objects := make([]T, 0, bucket.Stats().KeyN)
+	err := bucket.ForEach(func(k, v []byte) error {
+		var obj T
+		if err := json.Unmarshal(v, &obj); err != nil {
+			return appErrs.NewUnknownError("json.Unmarshal", sf.Format("getObjects[{0}]", objType), err)
+		}
+		objects = append(objects, obj)
+		return nil
+	})
+	return objects, err
+}
+
+// putObject marshals object to JSON and stores it by key in bucket (existing value is overwritten)
+func putObject(bucket *bbolt.Bucket, objType objectType, key string, obj any) error {
+	value, err := json.Marshal(obj)
+	if err != nil {
+		return appErrs.NewUnknownError("json.Marshal", sf.Format("putObject[{0}]", objType), err)
+	}
+	return putValue(bucket, objType, key, value)
+}
+
+// putValue stores value by key in bucket (existing value is overwritten)
+func putValue(bucket *bbolt.Bucket, objType objectType, key string, value []byte) error {
+	if err := bucket.Put([]byte(key), value); err != nil {
+		return appErrs.NewUnknownError("bbolt.Bucket.Put", sf.Format("putValue[{0}]", objType), err)
+	}
+	return nil
+}
+
+// deleteKey removes key from bucket
+func deleteKey(bucket *bbolt.Bucket, objType objectType, key string) error {
+	if err := bucket.Delete([]byte(key)); err != nil {
+		return appErrs.NewUnknownError("bbolt.Bucket.Delete", sf.Format("deleteKey[{0}]", objType), err)
+	}
+	return nil
+}
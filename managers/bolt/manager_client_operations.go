@@ -0,0 +1,164 @@
+package bolt
+
+import (
+	"context"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	sf "github.com/wissance/stringFormatter"
+	"go.etcd.io/bbolt"
+)
+
+// GetClients function for getting all realm clients (ordered by name)
+/* Parameters:
+ *     - realmName - name of a realm
+ * Returns: clients (empty slice if realm doesn't have clients) and error (appErrs.ObjectNotFoundError if realm doesn't exist)
+ */
+func (mn *BoltDataManager) GetClients(ctx context.Context, realmName string) ([]data.Client, error) {
+	var clients []data.Client
+	err := mn.view(ctx, "BoltDataManager.GetClients", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmSubBucket(tx, realmName, clientsBucket)
+		if err != nil {
+			return err
+		}
+		clients, err = getObjects[data.Client](bucket, Client)
+		return err
+	})
+	return clients, err
+}
+
+// GetClient function for getting realm client by name
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - clientName - name of a client
+ * Returns: client and error (appErrs.ObjectNotFoundError if realm or client doesn't exist)
+ */
+func (mn *BoltDataManager) GetClient(ctx context.Context, realmName string, clientName string) (*data.Client, error) {
+	var client *data.Client
+	err := mn.view(ctx, "BoltDataManager.GetClient", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmSubBucket(tx, realmName, clientsBucket)
+		if err != nil {
+			return err
+		}
+		client, err = getObject[data.Client](bucket, Client, clientName, realmName)
+		return err
+	})
+	return client, err
+}
+
+// CreateClient creates new client in a realm, client gets version 1 and the first revision
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - clientNew - new client data
+ * Returns: error (appErrs.ObjectNotFoundError if realm doesn't exist, appErrs.ObjectAlreadyExistsError if client exists)
+ */
+func (mn *BoltDataManager) CreateClient(ctx context.Context, realmName string, clientNew data.Client) error {
+	return mn.update(ctx, "BoltDataManager.CreateClient", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmBucket(tx, realmName)
+		if err != nil {
+			return err
+		}
+		clientNew.Version = 1
+		if err = createClientObject(bucket, realmName, &clientNew); err != nil {
+			return err
+		}
+		revision, err := data.CreateClientRevision(ctx, realmName, &clientNew)
+		if err != nil {
+			return appErrs.NewUnknownError("CreateClientRevision", "BoltDataManager.CreateClient", err)
+		}
+		return mn.addRevision(bucket, nil, revision)
+	})
+}
+
+// UpdateClient updates existing realm client and adds its revision, client could be renamed (with its history)
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - clientName - name of a client
+ *     - clientNew - new client data, clientNew.Version is an expected version of stored client (see data.CheckVersion)
+ * Returns: error (appErrs.ObjectNotFoundError if client doesn't exist, appErrs.ObjectAlreadyExistsError if client with new name exists,
+ * appErrs.ObjectVersionConflictError if stored client has other version)
+ */
+func (mn *BoltDataManager) UpdateClient(ctx context.Context, realmName string, clientName string, clientNew data.Client) error {
+	return mn.update(ctx, "BoltDataManager.UpdateClient", func(tx *bbolt.Tx) error {
+		realmBucket, err := getRealmBucket(tx, realmName)
+		if err != nil {
+			return err
+		}
+		bucket := realmBucket.Bucket([]byte(clientsBucket))
+		oldClient, err := getObject[data.Client](bucket, Client, clientName, realmName)
+		if err != nil {
+			return err
+		}
+		if err = data.CheckVersion(string(Client), clientName, oldClient.Version, clientNew.Version); err != nil {
+			return err
+		}
+		clientNew.Version = oldClient.Version + 1
+		if clientNew.Name != clientName {
+			if bucket.Get([]byte(clientNew.Name)) != nil {
+				return appErrs.NewObjectExistsError(string(Client), clientNew.Name, sf.Format("realm: {0}", realmName))
+			}
+			if err = deleteKey(bucket, Client, clientName); err != nil {
+				return err
+			}
+			if err = moveClientRevisions(realmBucket, realmName, clientName, clientNew.Name); err != nil {
+				return err
+			}
+		}
+		if err = putObject(bucket, Client, clientNew.Name, &clientNew); err != nil {
+			return err
+		}
+		previous, err := data.CreateClientRevision(ctx, realmName, oldClient)
+		if err != nil {
+			return appErrs.NewUnknownError("CreateClientRevision", "BoltDataManager.UpdateClient", err)
+		}
+		revision, err := data.CreateClientRevision(ctx, realmName, &clientNew)
+		if err != nil {
+			return appErrs.NewUnknownError("CreateClientRevision", "BoltDataManager.UpdateClient", err)
+		}
+		return mn.addRevision(realmBucket, &previous, revision)
+	})
+}
+
+// DeleteClient removes realm client with its history
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - clientName - name of a client
+ * Returns: error (appErrs.ObjectNotFoundError if client doesn't exist)
+ */
+func (mn *BoltDataManager) DeleteClient(ctx context.Context, realmName string, clientName string) error {
+	return mn.update(ctx, "BoltDataManager.DeleteClient", func(tx *bbolt.Tx) error {
+		realmBucket, err := getRealmBucket(tx, realmName)
+		if err != nil {
+			return err
+		}
+		bucket := realmBucket.Bucket([]byte(clientsBucket))
+		if bucket.Get([]byte(clientName)) == nil {
+			return appErrs.NewObjectNotFoundError(string(Client), clientName, sf.Format("realm: {0}", realmName))
+		}
+		if err = deleteKey(bucket, Client, clientName); err != nil {
+			return err
+		}
+		// client history is removed with client
+		return putRevisions(realmBucket, data.ClientRevision, clientName, nil)
+	})
+}
+
+// createClientObject stores new client in realm bucket
+func createClientObject(realmBucket *bbolt.Bucket, realmName string, client *data.Client) error {
+	bucket := realmBucket.Bucket([]byte(clientsBucket))
+	if bucket.Get([]byte(client.Name)) != nil {
+		return appErrs.NewObjectExistsError(string(Client), client.Name, sf.Format("realm: {0}", realmName))
+	}
+	return putObject(bucket, Client, client.Name, client)
+}
+
+// moveClientRevisions moves history of renamed client to its new name
+func moveClientRevisions(realmBucket *bbolt.Bucket, realmName string, clientName string, newClientName string) error {
+	history, err := getRevisions(realmBucket, realmName, data.ClientRevision, clientName)
+	if err != nil {
+		return err
+	}
+	if err = putRevisions(realmBucket, data.ClientRevision, clientName, nil); err != nil {
+		return err
+	}
+	return putRevisions(realmBucket, data.ClientRevision, newClientName, history)
+}
@@ -0,0 +1,191 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	sf "github.com/wissance/stringFormatter"
+	"go.etcd.io/bbolt"
+)
+
+// GetOfflineSession returns data.OfflineSession by its identifier
+/* Parameters:
+ *     - realmName - name of a Realm
+ *     - sessionId - offline session identifier
+ * Returns: offline session and error (appErrs.ObjectNotFoundError if realm or session doesn't exist or session expired)
+ */
+func (mn *BoltDataManager) GetOfflineSession(ctx context.Context, realmName string, sessionId uuid.UUID) (*data.OfflineSession, error) {
+	var session *data.OfflineSession
+	err := mn.view(ctx, "BoltDataManager.GetOfflineSession", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmBucket(tx, realmName)
+		if err != nil {
+			return err
+		}
+		session, err = getOfflineSessionObject(bucket, realmName, sessionId)
+		return err
+	})
+	return session, err
+}
+
+// GetUserOfflineSessions returns all active offline sessions of a user (index on user id)
+/* Parameters:
+ *     - realmName - name of a Realm
+ *     - userId - user identifier
+ * Returns: offline sessions ordered by start time (the oldest first) and error
+ */
+func (mn *BoltDataManager) GetUserOfflineSessions(ctx context.Context, realmName string, userId uuid.UUID) ([]data.OfflineSession, error) {
+	result := []data.OfflineSession{}
+	err := mn.view(ctx, "BoltDataManager.GetUserOfflineSessions", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmBucket(tx, realmName)
+		if err != nil {
+			return err
+		}
+		return forEachUserOfflineSession(bucket, userId, func(sessionId string) error {
+			session, getErr := getOfflineSessionObject(bucket, realmName, uuid.MustParse(sessionId))
+			if getErr == nil {
+				result = append(result, *session)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Started.Before(result[j].Started)
+	})
+	return result, nil
+}
+
+// CreateOfflineSession creates new data.OfflineSession in a Realm, expired offline sessions of the same user are removed
+/* Parameters:
+ *     - realmName - name of a Realm
+ *     - session - new offline session
+ * Returns: error (appErrs.ObjectNotFoundError if realm doesn't exist, appErrs.ObjectAlreadyExistsError if session with same id exists)
+ */
+func (mn *BoltDataManager) CreateOfflineSession(ctx context.Context, realmName string, session data.OfflineSession) error {
+	return mn.update(ctx, "BoltDataManager.CreateOfflineSession", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmBucket(tx, realmName)
+		if err != nil {
+			return err
+		}
+		if bucket.Bucket([]byte(offlineSessionsBucket)).Get([]byte(session.Id.String())) != nil {
+			return appErrs.NewObjectExistsError(string(OfflineSession), session.Id.String(), sf.Format("realm: {0}", realmName))
+		}
+		if err = deleteExpiredUserOfflineSessions(bucket, session.UserId); err != nil {
+			return err
+		}
+		if err = putObject(bucket.Bucket([]byte(offlineSessionsBucket)), OfflineSession, session.Id.String(), &session); err != nil {
+			return err
+		}
+		return putValue(bucket.Bucket([]byte(userOfflineSessionsBucket)), OfflineSession, getUserOfflineSessionKey(session.UserId,
+			session.Id.String()), []byte{})
+	})
+}
+
+// UpdateOfflineSession updates existing data.OfflineSession (i.e. on offline token refresh)
+/* Parameters:
+ *     - realmName - name of a Realm
+ *     - session - offline session new data
+ * Returns: error (appErrs.ObjectNotFoundError if session doesn't exist or expired)
+ */
+func (mn *BoltDataManager) UpdateOfflineSession(ctx context.Context, realmName string, session data.OfflineSession) error {
+	return mn.update(ctx, "BoltDataManager.UpdateOfflineSession", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmBucket(tx, realmName)
+		if err != nil {
+			return err
+		}
+		oldSession, err := getOfflineSessionObject(bucket, realmName, session.Id)
+		if err != nil {
+			return err
+		}
+		// session owner is not changed, index on user id remains valid
+		session.UserId = oldSession.UserId
+		return putObject(bucket.Bucket([]byte(offlineSessionsBucket)), OfflineSession, session.Id.String(), &session)
+	})
+}
+
+// DeleteOfflineSession removes (revokes) data.OfflineSession
+/* Parameters:
+ *     - realmName - name of a Realm
+ *     - sessionId - offline session identifier
+ * Returns: error (appErrs.ObjectNotFoundError if session doesn't exist or expired)
+ */
+func (mn *BoltDataManager) DeleteOfflineSession(ctx context.Context, realmName string, sessionId uuid.UUID) error {
+	return mn.update(ctx, "BoltDataManager.DeleteOfflineSession", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmBucket(tx, realmName)
+		if err != nil {
+			return err
+		}
+		session, err := getOfflineSessionObject(bucket, realmName, sessionId)
+		if err != nil {
+			return err
+		}
+		return deleteOfflineSessionObject(bucket, session.UserId, sessionId.String())
+	})
+}
+
+// getOfflineSessionObject reads offline session from realm bucket, expired session is considered as not existing
+func getOfflineSessionObject(realmBucket *bbolt.Bucket, realmName string, sessionId uuid.UUID) (*data.OfflineSession, error) {
+	session, err := getObject[data.OfflineSession](realmBucket.Bucket([]byte(offlineSessionsBucket)), OfflineSession,
+		sessionId.String(), realmName)
+	if err != nil {
+		return nil, err
+	}
+	if session.Expired.Before(time.Now()) {
+		return nil, appErrs.NewObjectNotFoundError(string(OfflineSession), sessionId.String(), sf.Format("realm: {0}", realmName))
+	}
+	return session, nil
+}
+
+// deleteOfflineSessionObject removes offline session and its index key from realm bucket
+func deleteOfflineSessionObject(realmBucket *bbolt.Bucket, userId uuid.UUID, sessionId string) error {
+	if err := deleteKey(realmBucket.Bucket([]byte(offlineSessionsBucket)), OfflineSession, sessionId); err != nil {
+		return err
+	}
+	return deleteKey(realmBucket.Bucket([]byte(userOfflineSessionsBucket)), OfflineSession, getUserOfflineSessionKey(userId, sessionId))
+}
+
+// deleteExpiredUserOfflineSessions removes all expired offline sessions of a user from realm bucket
+func deleteExpiredUserOfflineSessions(realmBucket *bbolt.Bucket, userId uuid.UUID) error {
+	var expiredSessions []string
+	err := forEachUserOfflineSession(realmBucket, userId, func(sessionId string) error {
+		session, err := getObject[data.OfflineSession](realmBucket.Bucket([]byte(offlineSessionsBucket)), OfflineSession, sessionId, "")
+		if err != nil || session.Expired.Before(time.Now()) {
+			expiredSessions = append(expiredSessions, sessionId)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// keys must not be deleted during iteration
+	for _, sessionId := range expiredSessions {
+		if err = deleteOfflineSessionObject(realmBucket, userId, sessionId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEachUserOfflineSession calls fn for every offline session id of a user (including expired sessions)
+func forEachUserOfflineSession(realmBucket *bbolt.Bucket, userId uuid.UUID, fn func(sessionId string) error) error {
+	prefix := []byte(getUserOfflineSessionKey(userId, ""))
+	cursor := realmBucket.Bucket([]byte(userOfflineSessionsBucket)).Cursor()
+	for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+		if err := fn(string(k[len(prefix):])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getUserOfflineSessionKey returns key of userOfflineSessionsBucket
+func getUserOfflineSessionKey(userId uuid.UUID, sessionId string) string {
+	return sf.Format("{0}_{1}", userId.String(), sessionId)
+}
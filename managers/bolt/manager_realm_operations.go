@@ -0,0 +1,254 @@
+package bolt
+
+import (
+	"context"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/utils/encoding"
+	"go.etcd.io/bbolt"
+)
+
+// GetRealmNames returns names of all realms ordered by name (see managers.RealmsLister)
+func (mn *BoltDataManager) GetRealmNames(ctx context.Context) ([]string, error) {
+	names := []string{}
+	err := mn.view(ctx, "BoltDataManager.GetRealmNames", func(tx *bbolt.Tx) error {
+		// realms bucket contains only realms buckets, bolt keeps keys sorted
+		return tx.Bucket([]byte(realmsBucket)).ForEach(func(name []byte, _ []byte) error {
+			names = append(names, string(name))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// GetRealm function for getting realm by name, returns the realm with clients and user federation configs but no users
+/* Parameters:
+ *     - realmName name of a realm
+ * Returns: realm and error (appErrs.ObjectNotFoundError if realm doesn't exist)
+ */
+func (mn *BoltDataManager) GetRealm(ctx context.Context, realmName string) (*data.Realm, error) {
+	var realm *data.Realm
+	err := mn.view(ctx, "BoltDataManager.GetRealm", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmBucket(tx, realmName)
+		if err != nil {
+			return err
+		}
+		if realm, err = getObject[data.Realm](bucket, Realm, realmKey, realmName); err != nil {
+			return err
+		}
+		if realm.Clients, err = getObjects[data.Client](bucket.Bucket([]byte(clientsBucket)), Client); err != nil {
+			return err
+		}
+		realm.UserFederationServices, err = getObjects[data.UserFederationServiceConfig](bucket.Bucket([]byte(userFederationsBucket)),
+			UserFederationConfig)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	realm.Encoder = encoding.NewPasswordJsonEncoder(realm.PasswordSalt)
+	return realm, nil
+}
+
+// CreateRealm creates a realm with all its clients, users and user federation configs
+/* New password salt is generated for realm, users passwords are hashed with it. Realm, its clients and users get version 1,
+ * realm and clients get the first revision
+ * Parameters:
+ *     - newRealm - newly creating realm body data with clients, users and user federation configs
+ * Returns: error (appErrs.ObjectAlreadyExistsError if realm exists or new realm contains objects with same names)
+ */
+func (mn *BoltDataManager) CreateRealm(ctx context.Context, newRealm data.Realm) error {
+	return mn.update(ctx, "BoltDataManager.CreateRealm", func(tx *bbolt.Tx) error {
+		newRealm.PasswordSalt = encoding.GenerateRandomSalt()
+		if err := createRealmBucket(tx, &newRealm, encoding.NewPasswordJsonEncoder(newRealm.PasswordSalt)); err != nil {
+			return err
+		}
+		bucket, err := getRealmBucket(tx, newRealm.Name)
+		if err != nil {
+			return err
+		}
+		revision, err := data.CreateRealmRevision(ctx, &newRealm)
+		if err != nil {
+			return appErrs.NewUnknownError("CreateRealmRevision", "BoltDataManager.CreateRealm", err)
+		}
+		if err = mn.addRevision(bucket, nil, revision); err != nil {
+			return err
+		}
+		clients, err := getObjects[data.Client](bucket.Bucket([]byte(clientsBucket)), Client)
+		if err != nil {
+			return err
+		}
+		for _, client := range clients {
+			if revision, err = data.CreateClientRevision(ctx, newRealm.Name, &client); err != nil {
+				return appErrs.NewUnknownError("CreateClientRevision", "BoltDataManager.CreateRealm", err)
+			}
+			if err = mn.addRevision(bucket, nil, revision); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ImportRealm creates a realm as it is: realm password salt and versions are kept and users are stored without passwords hashing
+/* It is using for a data store seeding (see managers.RealmImporter), passwords must be already hashed with realm salt
+ * Parameters:
+ *     - realm - realm with clients, users and user federation configs
+ * Returns: error (appErrs.ObjectAlreadyExistsError if realm exists or realm contains objects with same names)
+ */
+func (mn *BoltDataManager) ImportRealm(ctx context.Context, realm data.Realm) error {
+	return mn.update(ctx, "BoltDataManager.ImportRealm", func(tx *bbolt.Tx) error {
+		return createRealmBucket(tx, &realm, nil)
+	})
+}
+
+// UpdateRealm updates realm settings and adds realm revision, clients, users, user federation configs and password salt are kept
+/* If realm name was changed all realm objects (and history) are moved to a new realm
+ * Parameters:
+ *     - realmName - name of a realm
+ *     - realmNew - new realm data (clients, users and user federation configs are ignored), realmNew.Version is an expected
+ *       version of stored realm (see data.CheckVersion)
+ * Returns: error (appErrs.ObjectNotFoundError if realm doesn't exist, appErrs.ObjectAlreadyExistsError if realm with new name exists,
+ * appErrs.ObjectVersionConflictError if stored realm has other version)
+ */
+func (mn *BoltDataManager) UpdateRealm(ctx context.Context, realmName string, realmNew data.Realm) error {
+	return mn.update(ctx, "BoltDataManager.UpdateRealm", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmBucket(tx, realmName)
+		if err != nil {
+			return err
+		}
+		oldRealm, err := getObject[data.Realm](bucket, Realm, realmKey, realmName)
+		if err != nil {
+			return err
+		}
+		if err = data.CheckVersion(string(Realm), realmName, oldRealm.Version, realmNew.Version); err != nil {
+			return err
+		}
+		realmNew.Version = oldRealm.Version + 1
+		// salt is not changed on update, otherwise stored passwords hashes become invalid
+		realmNew.PasswordSalt = oldRealm.PasswordSalt
+		if realmNew.Name != realmName {
+			realms := tx.Bucket([]byte(realmsBucket))
+			newBucket, createErr := realms.CreateBucket([]byte(realmNew.Name))
+			if createErr != nil {
+				if createErr == bbolt.ErrBucketExists {
+					return appErrs.NewObjectExistsError(string(Realm), realmNew.Name, "")
+				}
+				return appErrs.NewUnknownError("bbolt.Bucket.CreateBucket", "BoltDataManager.UpdateRealm", createErr)
+			}
+			if err = copyBucket(bucket, newBucket); err != nil {
+				return err
+			}
+			if err = realms.DeleteBucket([]byte(realmName)); err != nil {
+				return appErrs.NewUnknownError("bbolt.Bucket.DeleteBucket", "BoltDataManager.UpdateRealm", err)
+			}
+			bucket = newBucket
+		}
+		if err = putObject(bucket, Realm, realmKey, getShortRealm(&realmNew)); err != nil {
+			return err
+		}
+		previous, err := data.CreateRealmRevision(ctx, oldRealm)
+		if err != nil {
+			return appErrs.NewUnknownError("CreateRealmRevision", "BoltDataManager.UpdateRealm", err)
+		}
+		revision, err := data.CreateRealmRevision(ctx, &realmNew)
+		if err != nil {
+			return appErrs.NewUnknownError("CreateRealmRevision", "BoltDataManager.UpdateRealm", err)
+		}
+		return mn.addRevision(bucket, &previous, revision)
+	})
+}
+
+// DeleteRealm removes realm with all its clients, users, user federation configs and offline sessions
+/* Parameters:
+ *     - realmName - name of a realm
+ * Returns: error (appErrs.ObjectNotFoundError if realm doesn't exist)
+ */
+func (mn *BoltDataManager) DeleteRealm(ctx context.Context, realmName string) error {
+	return mn.update(ctx, "BoltDataManager.DeleteRealm", func(tx *bbolt.Tx) error {
+		if err := tx.Bucket([]byte(realmsBucket)).DeleteBucket([]byte(realmName)); err != nil {
+			if err == bbolt.ErrBucketNotFound {
+				return appErrs.NewObjectNotFoundError(string(Realm), realmName, "")
+			}
+			return appErrs.NewUnknownError("bbolt.Bucket.DeleteBucket", "BoltDataManager.DeleteRealm", err)
+		}
+		return nil
+	})
+}
+
+// createRealmBucket creates realm bucket with realm, clients, users and user federation configs, if encoder is not nil users
+// passwords are hashed by encoder and realm, clients and users get version 1 (otherwise realm is imported as is)
+func createRealmBucket(tx *bbolt.Tx, realm *data.Realm, encoder *encoding.PasswordJsonEncoder) error {
+	if encoder != nil {
+		realm.Version = 1
+	}
+	bucket, err := tx.Bucket([]byte(realmsBucket)).CreateBucket([]byte(realm.Name))
+	if err != nil {
+		if err == bbolt.ErrBucketExists {
+			return appErrs.NewObjectExistsError(string(Realm), realm.Name, "")
+		}
+		return appErrs.NewUnknownError("bbolt.Bucket.CreateBucket", "createRealmBucket", err)
+	}
+	for _, subBucket := range realmSubBuckets {
+		if _, err = bucket.CreateBucket([]byte(subBucket)); err != nil {
+			return appErrs.NewUnknownError("bbolt.Bucket.CreateBucket", "createRealmBucket", err)
+		}
+	}
+	if err = putObject(bucket, Realm, realmKey, getShortRealm(realm)); err != nil {
+		return err
+	}
+	for _, client := range realm.Clients {
+		if encoder != nil {
+			client.Version = 1
+		}
+		if err = createClientObject(bucket, realm.Name, &client); err != nil {
+			return err
+		}
+	}
+	for _, rawUser := range realm.Users {
+		user := data.CreateUser(rawUser, encoder)
+		if encoder != nil {
+			user = data.CreateUserWithVersion(user, 1)
+		}
+		if err = createUserObject(bucket, realm.Name, user); err != nil {
+			return err
+		}
+	}
+	for _, cfg := range realm.UserFederationServices {
+		if err = createUserFederationConfigObject(bucket, realm.Name, &cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getShortRealm returns copy of realm without clients, users and user federation configs (they are stored in realm sub-buckets)
+func getShortRealm(realm *data.Realm) *data.Realm {
+	shortRealm := *realm
+	shortRealm.Clients = nil
+	shortRealm.Users = nil
+	shortRealm.UserFederationServices = nil
+	shortRealm.Encoder = nil
+	return &shortRealm
+}
+
+// copyBucket copies all keys and nested buckets from source bucket to target bucket
+func copyBucket(source *bbolt.Bucket, target *bbolt.Bucket) error {
+	return source.ForEach(func(k, v []byte) error {
+		if v != nil {
+			if err := target.Put(k, v); err != nil {
+				return appErrs.NewUnknownError("bbolt.Bucket.Put", "copyBucket", err)
+			}
+			return nil
+		}
+		// nil value means nested bucket
+		nested, err := target.CreateBucket(k)
+		if err != nil {
+			return appErrs.NewUnknownError("bbolt.Bucket.CreateBucket", "copyBucket", err)
+		}
+		return copyBucket(source.Bucket(k), nested)
+	})
+}
@@ -0,0 +1,94 @@
+package bolt
+
+import (
+	"context"
+
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	"go.etcd.io/bbolt"
+)
+
+// GetRevisions returns revisions of realm or realm client (see managers.RevisionsKeeper)
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - objectType - data.RealmRevision or data.ClientRevision
+ *     - objectName - name of a client (not used for realm)
+ * Returns: revisions ordered by version (empty slice if object doesn't have revisions) and error (appErrs.ObjectNotFoundError
+ * if realm doesn't exist)
+ */
+func (mn *BoltDataManager) GetRevisions(ctx context.Context, realmName string, objectType data.RevisionObjectType, objectName string,
+) ([]data.Revision, error) {
+	var revisions []data.Revision
+	err := mn.view(ctx, "BoltDataManager.GetRevisions", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmBucket(tx, realmName)
+		if err != nil {
+			return err
+		}
+		revisions, err = getRevisions(bucket, realmName, objectType, objectName)
+		return err
+	})
+	return revisions, err
+}
+
+// addRevision adds revision to history of changed object (see data.AddRevision), history is not kept if revisionsLimit is 0
+/* Parameters:
+ *     - realmBucket - bucket of a realm that object belongs to
+ *     - previous - revision of object state before change (nil if object was created)
+ *     - revision - revision of object state after change
+ * Returns: error
+ */
+func (mn *BoltDataManager) addRevision(realmBucket *bbolt.Bucket, previous *data.Revision, revision data.Revision) error {
+	if mn.revisionsLimit <= 0 {
+		return nil
+	}
+	history, err := getRevisions(realmBucket, revision.Realm, revision.ObjectType, revision.ObjectName)
+	if err != nil {
+		return err
+	}
+	history = data.AddRevision(history, previous, revision, mn.revisionsLimit)
+	return putRevisions(realmBucket, revision.ObjectType, revision.ObjectName, history)
+}
+
+// getRevisions reads revisions of object from revisionsBucket of realm bucket (realms that were created by previous Ferrum
+// versions don't have it), revisions are stored without actual realm name (realm could be renamed)
+func getRevisions(realmBucket *bbolt.Bucket, realmName string, objectType data.RevisionObjectType, objectName string,
+) ([]data.Revision, error) {
+	revisions := make([]data.Revision, 0)
+	bucket := realmBucket.Bucket([]byte(revisionsBucket))
+	if bucket == nil || bucket.Get([]byte(getRevisionsKey(objectType, objectName))) == nil {
+		return revisions, nil
+	}
+	stored, err := getObject[[]data.Revision](bucket, Revision, getRevisionsKey(objectType, objectName), realmName)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range *stored {
+		r.Realm = realmName
+		revisions = append(revisions, r)
+	}
+	return revisions, nil
+}
+
+// putRevisions stores revisions of object (JSON array by key {objectType}:{objectName}), empty history is removed
+func putRevisions(realmBucket *bbolt.Bucket, objectType data.RevisionObjectType, objectName string, history []data.Revision) error {
+	bucket, err := realmBucket.CreateBucketIfNotExists([]byte(revisionsBucket))
+	if err != nil {
+		return appErrs.NewUnknownError("bbolt.Bucket.CreateBucketIfNotExists", "putRevisions", err)
+	}
+	key := getRevisionsKey(objectType, objectName)
+	if len(history) == 0 {
+		return deleteKey(bucket, Revision, key)
+	}
+	for i := range history {
+		history[i].ObjectName = objectName
+	}
+	return putObject(bucket, Revision, key, history)
+}
+
+// getRevisionsKey returns key of object revisions in revisionsBucket
+func getRevisionsKey(objectType data.RevisionObjectType, objectName string) string {
+	if objectType == data.RealmRevision {
+		return string(objectType)
+	}
+	return string(objectType) + ":" + objectName
+}
@@ -0,0 +1,128 @@
+package bolt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wissance/Ferrum/config"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/logging"
+	sf "github.com/wissance/stringFormatter"
+	"go.etcd.io/bbolt"
+)
+
+func TestExpiredOfflineSessionsAreRemoved(t *testing.T) {
+	manager := createTestBoltDataManager(t, filepath.Join(t.TempDir(), "ferrum.db"))
+	realm := data.Realm{Name: "app", TokenExpiration: 3600, RefreshTokenExpiration: 1800}
+	require.NoError(t, manager.CreateRealm(context.Background(), realm))
+	userId := uuid.New()
+	now := time.Now()
+	expiredSession := data.OfflineSession{
+		Id: uuid.New(), UserId: userId, ClientId: "web_app", Started: now.Add(-2 * time.Hour), Expired: now.Add(-time.Hour),
+	}
+	require.NoError(t, manager.CreateOfflineSession(context.Background(), realm.Name, expiredSession))
+
+	// creation of a new session of the same user removes expired session from a store
+	activeSession := data.OfflineSession{
+		Id: uuid.New(), UserId: userId, ClientId: "web_app", Started: now, Expired: now.Add(time.Hour),
+	}
+	require.NoError(t, manager.CreateOfflineSession(context.Background(), realm.Name, activeSession))
+	err := manager.view(context.Background(), "test", func(tx *bbolt.Tx) error {
+		bucket, bucketErr := getRealmBucket(tx, realm.Name)
+		require.NoError(t, bucketErr)
+		assert.Equal(t, 1, bucket.Bucket([]byte(offlineSessionsBucket)).Stats().KeyN)
+		assert.Equal(t, 1, bucket.Bucket([]byte(userOfflineSessionsBucket)).Stats().KeyN)
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestDataIsPersistedBetweenReopens(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "ferrum.db")
+	manager := createTestBoltDataManager(t, dbFile)
+	realm := createTestRealm(t, "app")
+	require.NoError(t, manager.CreateRealm(context.Background(), realm))
+	r, err := manager.GetRealm(context.Background(), realm.Name)
+	require.NoError(t, err)
+	require.NoError(t, manager.Close())
+	assert.False(t, manager.IsAvailable())
+	_, err = manager.GetRealm(context.Background(), realm.Name)
+	assert.True(t, errors.As(err, &appErrs.DataProviderNotAvailable{}))
+
+	manager = createTestBoltDataManager(t, dbFile)
+	assert.True(t, manager.IsAvailable())
+	reopenedRealm, err := manager.GetRealm(context.Background(), realm.Name)
+	require.NoError(t, err)
+	assert.Equal(t, r, reopenedRealm)
+	users, err := manager.GetUsers(context.Background(), realm.Name)
+	require.NoError(t, err)
+	assert.Equal(t, len(realm.Users), len(users))
+}
+
+func TestOperationsFailWithCancelledContext(t *testing.T) {
+	manager := createTestBoltDataManager(t, filepath.Join(t.TempDir(), "ferrum.db"))
+	realm := createTestRealm(t, "app")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := manager.CreateRealm(ctx, realm)
+	assert.True(t, errors.As(err, &appErrs.DataProviderNotAvailable{}))
+	_, err = manager.GetRealm(ctx, realm.Name)
+	assert.True(t, errors.As(err, &appErrs.DataProviderNotAvailable{}))
+	// realm wasn't created by cancelled operation
+	_, err = manager.GetRealm(context.Background(), realm.Name)
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+}
+
+func TestRealmObjectsOfNonExistingRealmAreNotFound(t *testing.T) {
+	manager := createTestBoltDataManager(t, filepath.Join(t.TempDir(), "ferrum.db"))
+	realm := createTestRealm(t, "app")
+	require.NoError(t, manager.CreateRealm(context.Background(), realm))
+	_, err := manager.GetClients(context.Background(), "unknown_realm")
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+
+	// realm objects are removed with realm
+	require.NoError(t, manager.DeleteRealm(context.Background(), realm.Name))
+	_, err = manager.GetUsers(context.Background(), realm.Name)
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+	_, err = manager.GetClients(context.Background(), realm.Name)
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+}
+
+func createTestBoltDataManager(t *testing.T, dbFile string) *BoltDataManager {
+	dataSourceCfg := config.DataSourceConfig{
+		Type:   config.BOLT,
+		Source: dbFile,
+	}
+	loggerCfg := config.LoggingConfig{}
+	logger := logging.CreateLogger(&loggerCfg)
+	manager, err := CreateBoltDataManager(&dataSourceCfg, logger)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = manager.Close()
+	})
+	return manager
+}
+
+// createTestRealm creates realm with one client and one user, DataContext behaviour common for all data stores is checked by
+// conformance tests of managers package
+func createTestRealm(t *testing.T, realmName string) data.Realm {
+	var rawUser interface{}
+	err := json.Unmarshal([]byte(sf.Format(`{"info":{"sub":"{0}","preferred_username":"user1"}, "credentials":{"password": "123"}}`,
+		uuid.New().String())), &rawUser)
+	require.NoError(t, err)
+	return data.Realm{
+		Name:                   realmName,
+		TokenExpiration:        3600,
+		RefreshTokenExpiration: 1800,
+		Clients:                []data.Client{{Name: "client1", Type: data.Public, ID: uuid.New()}},
+		Users:                  []interface{}{rawUser},
+	}
+}
@@ -0,0 +1,123 @@
+package bolt
+
+import (
+	"context"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	sf "github.com/wissance/stringFormatter"
+	"go.etcd.io/bbolt"
+)
+
+// GetUserFederationConfigs function for getting all realm user federation configs (ordered by name)
+/* Parameters:
+ *     - realmName - name of a realm
+ * Returns: configs and error (appErrs.ErrZeroLength if realm doesn't have configs, appErrs.ObjectNotFoundError if realm doesn't exist)
+ */
+func (mn *BoltDataManager) GetUserFederationConfigs(ctx context.Context, realmName string) ([]data.UserFederationServiceConfig, error) {
+	var configs []data.UserFederationServiceConfig
+	err := mn.view(ctx, "BoltDataManager.GetUserFederationConfigs", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmSubBucket(tx, realmName, userFederationsBucket)
+		if err != nil {
+			return err
+		}
+		configs, err = getObjects[data.UserFederationServiceConfig](bucket, UserFederationConfig)
+		return err
+	})
+	if err == nil && len(configs) == 0 {
+		return nil, appErrs.ErrZeroLength
+	}
+	return configs, err
+}
+
+// GetUserFederationConfig function for getting realm user federation config by name
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - configName - name of a user federation config
+ * Returns: config and error (appErrs.ObjectNotFoundError if realm or config doesn't exist)
+ */
+func (mn *BoltDataManager) GetUserFederationConfig(ctx context.Context, realmName string, configName string) (*data.UserFederationServiceConfig, error) {
+	var cfg *data.UserFederationServiceConfig
+	err := mn.view(ctx, "BoltDataManager.GetUserFederationConfig", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmSubBucket(tx, realmName, userFederationsBucket)
+		if err != nil {
+			return err
+		}
+		cfg, err = getObject[data.UserFederationServiceConfig](bucket, UserFederationConfig, configName, realmName)
+		return err
+	})
+	return cfg, err
+}
+
+// CreateUserFederationConfig creates new realm user federation config
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - userFederationConfig - new user federation config
+ * Returns: error (appErrs.ObjectNotFoundError if realm doesn't exist, appErrs.ObjectAlreadyExistsError if config exists)
+ */
+func (mn *BoltDataManager) CreateUserFederationConfig(ctx context.Context, realmName string, userFederationConfig data.UserFederationServiceConfig) error {
+	return mn.update(ctx, "BoltDataManager.CreateUserFederationConfig", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmBucket(tx, realmName)
+		if err != nil {
+			return err
+		}
+		return createUserFederationConfigObject(bucket, realmName, &userFederationConfig)
+	})
+}
+
+// UpdateUserFederationConfig updates existing realm user federation config, config could be renamed
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - configName - name of a user federation config
+ *     - userFederationConfig - new user federation config data
+ * Returns: error (appErrs.ObjectNotFoundError if config doesn't exist, appErrs.ObjectAlreadyExistsError if config with new name exists)
+ */
+func (mn *BoltDataManager) UpdateUserFederationConfig(ctx context.Context, realmName string, configName string,
+	userFederationConfig data.UserFederationServiceConfig,
+) error {
+	return mn.update(ctx, "BoltDataManager.UpdateUserFederationConfig", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmSubBucket(tx, realmName, userFederationsBucket)
+		if err != nil {
+			return err
+		}
+		if bucket.Get([]byte(configName)) == nil {
+			return appErrs.NewObjectNotFoundError(string(UserFederationConfig), configName, sf.Format("realm: {0}", realmName))
+		}
+		if userFederationConfig.Name != configName {
+			if bucket.Get([]byte(userFederationConfig.Name)) != nil {
+				return appErrs.NewObjectExistsError(string(UserFederationConfig), userFederationConfig.Name, sf.Format("realm: {0}", realmName))
+			}
+			if err = deleteKey(bucket, UserFederationConfig, configName); err != nil {
+				return err
+			}
+		}
+		return putObject(bucket, UserFederationConfig, userFederationConfig.Name, &userFederationConfig)
+	})
+}
+
+// DeleteUserFederationConfig removes realm user federation config
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - configName - name of a user federation config
+ * Returns: error (appErrs.ObjectNotFoundError if realm or config doesn't exist)
+ */
+func (mn *BoltDataManager) DeleteUserFederationConfig(ctx context.Context, realmName string, configName string) error {
+	return mn.update(ctx, "BoltDataManager.DeleteUserFederationConfig", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmSubBucket(tx, realmName, userFederationsBucket)
+		if err != nil {
+			return err
+		}
+		if bucket.Get([]byte(configName)) == nil {
+			return appErrs.NewObjectNotFoundError(string(UserFederationConfig), configName, sf.Format("realm: {0}", realmName))
+		}
+		return deleteKey(bucket, UserFederationConfig, configName)
+	})
+}
+
+// createUserFederationConfigObject stores new user federation config in realm bucket
+func createUserFederationConfigObject(realmBucket *bbolt.Bucket, realmName string, cfg *data.UserFederationServiceConfig) error {
+	bucket := realmBucket.Bucket([]byte(userFederationsBucket))
+	if bucket.Get([]byte(cfg.Name)) != nil {
+		return appErrs.NewObjectExistsError(string(UserFederationConfig), cfg.Name, sf.Format("realm: {0}", realmName))
+	}
+	return putObject(bucket, UserFederationConfig, cfg.Name, cfg)
+}
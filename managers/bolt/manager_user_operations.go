@@ -0,0 +1,282 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/utils/encoding"
+	sf "github.com/wissance/stringFormatter"
+	"go.etcd.io/bbolt"
+)
+
+// GetUsers function for getting all realm users (ordered by username)
+/* Parameters:
+ *     - realmName - name of a realm
+ * Returns: users (empty slice if realm doesn't have users) and error (appErrs.ObjectNotFoundError if realm doesn't exist)
+ */
+func (mn *BoltDataManager) GetUsers(ctx context.Context, realmName string) ([]data.User, error) {
+	var users []data.User
+	err := mn.view(ctx, "BoltDataManager.GetUsers", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmSubBucket(tx, realmName, usersBucket)
+		if err != nil {
+			return err
+		}
+		rawUsers, err := getObjects[interface{}](bucket, User)
+		if err != nil {
+			return err
+		}
+		users = make([]data.User, len(rawUsers))
+		for i, rawUser := range rawUsers {
+			users[i] = data.CreateUser(rawUser, nil)
+		}
+		return nil
+	})
+	return users, err
+}
+
+// ListUsers function for getting page of realm users ordered by username
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - page - requested page
+ * Returns: page of users and error (appErrs.ObjectNotFoundError if realm doesn't exist)
+ */
+func (mn *BoltDataManager) ListUsers(ctx context.Context, realmName string, page data.PageRequest) (*data.UsersPage, error) {
+	return mn.SearchUsers(ctx, realmName, data.UsersFilter{}, page)
+}
+
+// SearchUsers function for getting page of realm users that match filter ordered by username
+/* Users are stored by username, therefore only users with filter username prefix are read (cursor seeks to prefix). Users that
+ * are out of page are not decoded if filter has no other criteria.
+ * Parameters:
+ *     - realmName - name of a realm
+ *     - filter - search criteria
+ *     - page - requested page
+ * Returns: page of users and error (appErrs.ObjectNotFoundError if realm doesn't exist)
+ */
+func (mn *BoltDataManager) SearchUsers(ctx context.Context, realmName string, filter data.UsersFilter, page data.PageRequest) (*data.UsersPage, error) {
+	if err := page.Validate(); err != nil {
+		return nil, err
+	}
+	matcher, err := filter.GetMatcher()
+	if err != nil {
+		return nil, err
+	}
+	result := &data.UsersPage{Users: []data.User{}, Offset: page.Offset, Limit: page.GetLimit()}
+	err = mn.view(ctx, "BoltDataManager.SearchUsers", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmSubBucket(tx, realmName, usersBucket)
+		if err != nil {
+			return err
+		}
+		prefix := []byte(filter.UsernamePrefix)
+		cursor := bucket.Cursor()
+		for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+			isInPage := result.Total >= page.Offset && len(result.Users) < result.Limit
+			if !isInPage && filter.IsUsernameOnly() {
+				result.Total++
+				continue
+			}
+			var rawUser interface{}
+			if err = json.Unmarshal(v, &rawUser); err != nil {
+				return appErrs.NewUnknownError("json.Unmarshal", "BoltDataManager.SearchUsers", err)
+			}
+			user := data.CreateUser(rawUser, nil)
+			if !matcher(user) {
+				continue
+			}
+			if isInPage {
+				result.Users = append(result.Users, user)
+			}
+			result.Total++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetUser function for getting realm user by username (index on username)
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - userName - name of a user
+ * Returns: user and error (appErrs.ObjectNotFoundError if realm or user doesn't exist)
+ */
+func (mn *BoltDataManager) GetUser(ctx context.Context, realmName string, userName string) (data.User, error) {
+	var user data.User
+	err := mn.view(ctx, "BoltDataManager.GetUser", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmBucket(tx, realmName)
+		if err != nil {
+			return err
+		}
+		user, err = getUserObject(bucket, realmName, userName)
+		return err
+	})
+	return user, err
+}
+
+// GetUserById function for getting realm user by id (index on user id)
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - userId - identifier of a user
+ * Returns: user and error (appErrs.ObjectNotFoundError if realm or user doesn't exist)
+ */
+func (mn *BoltDataManager) GetUserById(ctx context.Context, realmName string, userId uuid.UUID) (data.User, error) {
+	var user data.User
+	err := mn.view(ctx, "BoltDataManager.GetUserById", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmBucket(tx, realmName)
+		if err != nil {
+			return err
+		}
+		userName := bucket.Bucket([]byte(userIdsBucket)).Get([]byte(userId.String()))
+		if userName == nil {
+			return appErrs.NewObjectNotFoundError(string(User), userId.String(), sf.Format("realm: {0}", realmName))
+		}
+		user, err = getUserObject(bucket, realmName, string(userName))
+		return err
+	})
+	return user, err
+}
+
+// CreateUser creates new realm user, user data is stored as is (password must be already hashed) with version 1
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - userNew - new user
+ * Returns: error (appErrs.ObjectNotFoundError if realm doesn't exist, appErrs.ObjectAlreadyExistsError if user with same
+ * name or id exists)
+ */
+func (mn *BoltDataManager) CreateUser(ctx context.Context, realmName string, userNew data.User) error {
+	return mn.update(ctx, "BoltDataManager.CreateUser", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmBucket(tx, realmName)
+		if err != nil {
+			return err
+		}
+		return createUserObject(bucket, realmName, data.CreateUserWithVersion(userNew, 1))
+	})
+}
+
+// UpdateUser updates existing realm user, user could be renamed
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - userName - name of a user
+ *     - userNew - new user data, userNew version is an expected version of stored user (see data.CheckVersion)
+ * Returns: error (appErrs.ObjectNotFoundError if user doesn't exist, appErrs.ObjectAlreadyExistsError if other user with
+ * new name or id exists, appErrs.ObjectVersionConflictError if stored user has other version)
+ */
+func (mn *BoltDataManager) UpdateUser(ctx context.Context, realmName string, userName string, userNew data.User) error {
+	return mn.update(ctx, "BoltDataManager.UpdateUser", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmBucket(tx, realmName)
+		if err != nil {
+			return err
+		}
+		oldUser, err := getUserObject(bucket, realmName, userName)
+		if err != nil {
+			return err
+		}
+		if err = data.CheckVersion(string(User), userName, oldUser.GetVersion(), userNew.GetVersion()); err != nil {
+			return err
+		}
+		if err = deleteUserObject(bucket, realmName, userName); err != nil {
+			return err
+		}
+		return createUserObject(bucket, realmName, data.CreateUserWithVersion(userNew, oldUser.GetVersion()+1))
+	})
+}
+
+// DeleteUser removes realm user
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - userName - name of a user
+ * Returns: error (appErrs.ObjectNotFoundError if realm or user doesn't exist)
+ */
+func (mn *BoltDataManager) DeleteUser(ctx context.Context, realmName string, userName string) error {
+	return mn.update(ctx, "BoltDataManager.DeleteUser", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmBucket(tx, realmName)
+		if err != nil {
+			return err
+		}
+		return deleteUserObject(bucket, realmName, userName)
+	})
+}
+
+// SetPassword sets new user password, password is hashed with realm password salt, user version is incremented
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - userName - name of a user
+ *     - password - new password
+ * Returns: error (appErrs.ObjectNotFoundError if realm or user doesn't exist)
+ */
+func (mn *BoltDataManager) SetPassword(ctx context.Context, realmName string, userName string, password string) error {
+	return mn.update(ctx, "BoltDataManager.SetPassword", func(tx *bbolt.Tx) error {
+		bucket, err := getRealmBucket(tx, realmName)
+		if err != nil {
+			return err
+		}
+		realm, err := getObject[data.Realm](bucket, Realm, realmKey, realmName)
+		if err != nil {
+			return err
+		}
+		user, err := getUserObject(bucket, realmName, userName)
+		if err != nil {
+			return err
+		}
+		if err = user.SetPassword(password, encoding.NewPasswordJsonEncoder(realm.PasswordSalt)); err != nil {
+			return appErrs.NewUnknownError("SetPassword", "BoltDataManager.SetPassword", err)
+		}
+		user.SetVersion(user.GetVersion() + 1)
+		return putValue(bucket.Bucket([]byte(usersBucket)), User, userName, []byte(user.GetJsonString()))
+	})
+}
+
+// getUserObject reads user by username from realm bucket
+func getUserObject(realmBucket *bbolt.Bucket, realmName string, userName string) (data.User, error) {
+	value := realmBucket.Bucket([]byte(usersBucket)).Get([]byte(userName))
+	if value == nil {
+		return nil, appErrs.NewObjectNotFoundError(string(User), userName, sf.Format("realm: {0}", realmName))
+	}
+	var rawUser interface{}
+	if err := json.Unmarshal(value, &rawUser); err != nil {
+		return nil, appErrs.NewUnknownError("json.Unmarshal", "getUserObject", err)
+	}
+	return data.CreateUser(rawUser, nil), nil
+}
+
+// createUserObject stores new user and its id in realm bucket (user without id is not indexed by id)
+func createUserObject(realmBucket *bbolt.Bucket, realmName string, user data.User) error {
+	users := realmBucket.Bucket([]byte(usersBucket))
+	userIds := realmBucket.Bucket([]byte(userIdsBucket))
+	userName := user.GetUsername()
+	if users.Get([]byte(userName)) != nil {
+		return appErrs.NewObjectExistsError(string(User), userName, sf.Format("realm: {0}", realmName))
+	}
+	if err := putValue(users, User, userName, []byte(user.GetJsonString())); err != nil {
+		return err
+	}
+	if user.GetId() == uuid.Nil {
+		return nil
+	}
+	userId := user.GetId().String()
+	if userIds.Get([]byte(userId)) != nil {
+		return appErrs.NewObjectExistsError(string(User), userId, sf.Format("realm: {0}", realmName))
+	}
+	return putValue(userIds, User, userId, []byte(userName))
+}
+
+// deleteUserObject removes user and its id from realm bucket
+func deleteUserObject(realmBucket *bbolt.Bucket, realmName string, userName string) error {
+	user, err := getUserObject(realmBucket, realmName, userName)
+	if err != nil {
+		return err
+	}
+	if err = deleteKey(realmBucket.Bucket([]byte(usersBucket)), User, userName); err != nil {
+		return err
+	}
+	if user.GetId() == uuid.Nil {
+		return nil
+	}
+	return deleteKey(realmBucket.Bucket([]byte(userIdsBucket)), User, user.GetId().String())
+}
@@ -1,6 +1,7 @@
 package managers
 
 import (
+	"context"
 	"errors"
 	"path/filepath"
 
@@ -10,57 +11,96 @@ import (
 	"github.com/google/uuid"
 	"github.com/wissance/Ferrum/config"
 	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
 	"github.com/wissance/Ferrum/logging"
 	"github.com/wissance/stringFormatter"
 )
 
-// DataContext is a common interface to implement operations with authorization server entities (data.Realm, data.Client, data.User)
-// now contains only set of Get methods, during implementation admin CLI should be expanded to create && update entities
-// DataContext is a CRUD operations interface over a business objects (data.Realm, data.Client, data.User)
+// DataContext is a common interface to implement CRUD operations with authorization server entities (data.Realm, data.Client,
+// data.User, data.UserFederationServiceConfig and data.OfflineSession)
+/* Every operation receives context.Context (usually context of HTTP request), therefore operation is cancelled if client
+ * disconnects, network data stores also limit every operation by deadline (config.DataOperationTimeout). Operation that was
+ * cancelled or didn't complete in time returns errors.DataProviderNotAvailable.
+ */
 type DataContext interface {
 	// IsAvailable Checks is Data Storage accessible or not
 	IsAvailable() bool
 	// GetRealm returns realm by name (unique) returns realm with clients but no users
-	GetRealm(realmName string) (*data.Realm, error)
+	GetRealm(ctx context.Context, realmName string) (*data.Realm, error)
+	// GetClients returns all realm clients (realm without clients returns empty slice or errors.ErrZeroLength)
+	GetClients(ctx context.Context, realmName string) ([]data.Client, error)
 	// GetClient returns realm client by name (client name is also unique in a realm)
-	GetClient(realmName string, name string) (*data.Client, error)
+	GetClient(ctx context.Context, realmName string, name string) (*data.Client, error)
+	// GetUsers returns all realm users (realm without users returns empty slice or errors.ErrZeroLength)
+	GetUsers(ctx context.Context, realmName string) ([]data.User, error)
+	// ListUsers returns page of realm users ordered by username (realm without users returns empty page)
+	ListUsers(ctx context.Context, realmName string, page data.PageRequest) (*data.UsersPage, error)
+	// SearchUsers returns page of realm users that match filter ordered by username (data.UsersFilter describes criteria)
+	SearchUsers(ctx context.Context, realmName string, filter data.UsersFilter, page data.PageRequest) (*data.UsersPage, error)
 	// GetUser return realm user (consider what to do with Federated users) by name
-	GetUser(realmName string, userName string) (data.User, error)
+	GetUser(ctx context.Context, realmName string, userName string) (data.User, error)
+	// GetUserFederationConfigs returns all realm user federation configs (realm without configs returns errors.ErrZeroLength)
+	GetUserFederationConfigs(ctx context.Context, realmName string) ([]data.UserFederationServiceConfig, error)
 	// GetUserFederationConfig return user federation config by name
-	GetUserFederationConfig(realmName string, configName string) (*data.UserFederationServiceConfig, error)
+	GetUserFederationConfig(ctx context.Context, realmName string, configName string) (*data.UserFederationServiceConfig, error)
 	// GetUserById return realm user by id
-	GetUserById(realmName string, userId uuid.UUID) (data.User, error)
+	GetUserById(ctx context.Context, realmName string, userId uuid.UUID) (data.User, error)
 	// CreateRealm creates new data.Realm in a data store, receive realmData unmarshalled json in a data.Realm
-	CreateRealm(realmData data.Realm) error
+	CreateRealm(ctx context.Context, realmData data.Realm) error
 	// CreateClient creates new data.Client in a data store, requires to pass realmName (because client name is not unique), clientData is an unmarshalled json of type data.Client
-	CreateClient(realmName string, clientData data.Client) error
+	CreateClient(ctx context.Context, realmName string, clientData data.Client) error
 	// CreateUser creates new data.User in a data store within a realm with name = realmName
-	CreateUser(realmName string, userData data.User) error
+	CreateUser(ctx context.Context, realmName string, userData data.User) error
 	// CreateUserFederationConfig creates new user federation (LDAP, FreeIPA & so on)
-	CreateUserFederationConfig(realmName string, userFederationConfig data.UserFederationServiceConfig) error
+	CreateUserFederationConfig(ctx context.Context, realmName string, userFederationConfig data.UserFederationServiceConfig) error
 	// UpdateRealm updates existing data.Realm in a data store within name = realmData, and new data = realmData
-	UpdateRealm(realmName string, realmData data.Realm) error
+	UpdateRealm(ctx context.Context, realmName string, realmData data.Realm) error
 	// UpdateClient updates existing data.Client in a data store with name = clientName and new data = clientData
-	UpdateClient(realmName string, clientName string, clientData data.Client) error
+	UpdateClient(ctx context.Context, realmName string, clientName string, clientData data.Client) error
 	// UpdateUser updates existing data.User in a data store with realm name = realName, username = userName and data=userData
-	UpdateUser(realmName string, userName string, userData data.User) error
+	UpdateUser(ctx context.Context, realmName string, userName string, userData data.User) error
 	// UpdateUserFederationConfig updates existing user federation config
-	UpdateUserFederationConfig(realmName string, configName string, userFederationConfig data.UserFederationServiceConfig) error
+	UpdateUserFederationConfig(ctx context.Context, realmName string, configName string, userFederationConfig data.UserFederationServiceConfig) error
 	// DeleteRealm removes realm from data storage (Should be a CASCADE remove of all related Users and Clients)
-	DeleteRealm(realmName string) error
+	DeleteRealm(ctx context.Context, realmName string) error
 	// DeleteClient removes client with name = clientName from realm with name = clientName
-	DeleteClient(realmName string, clientName string) error
+	DeleteClient(ctx context.Context, realmName string, clientName string) error
 	// DeleteUser removes data.User from data store by user (userName) and realm (realmName) name respectively
-	DeleteUser(realmName string, userName string) error
+	DeleteUser(ctx context.Context, realmName string, userName string) error
 	// DeleteUserFederationConfig removes data.UserFederationServiceConfig from collection
-	DeleteUserFederationConfig(realmName string, configName string) error
-	// SetPassword(realmName string, userName string, password string) error
+	DeleteUserFederationConfig(ctx context.Context, realmName string, configName string) error
+	// GetOfflineSession returns data.OfflineSession by realm name and offline session identifier
+	GetOfflineSession(ctx context.Context, realmName string, sessionId uuid.UUID) (*data.OfflineSession, error)
+	// GetUserOfflineSessions returns all active offline sessions of a user with id = userId
+	GetUserOfflineSessions(ctx context.Context, realmName string, userId uuid.UUID) ([]data.OfflineSession, error)
+	// CreateOfflineSession creates new data.OfflineSession in a data store within a realm with name = realmName
+	CreateOfflineSession(ctx context.Context, realmName string, session data.OfflineSession) error
+	// UpdateOfflineSession updates existing data.OfflineSession (i.e. on offline token refresh)
+	UpdateOfflineSession(ctx context.Context, realmName string, session data.OfflineSession) error
+	// DeleteOfflineSession removes (revokes) data.OfflineSession from data store
+	DeleteOfflineSession(ctx context.Context, realmName string, sessionId uuid.UUID) error
+	// SetPassword(ctx context.Context, realmName string, userName string, password string) error
+}
+
+// RealmImporter is an optional DataContext extension that is required for DataContext initialization with data (data seeding)
+/* Unlike DataContext.CreateRealm (it generates new realm password salt and hashes users passwords) ImportRealm stores realm
+ * as it is: realm password salt is kept and users passwords must be already hashed with it (as they are stored in a data file).
+ * All built-in data stores implement this interface.
+ */
+type RealmImporter interface {
+	// ImportRealm creates realm with all its clients, users and user federation configs as it is
+	ImportRealm(ctx context.Context, realm data.Realm) error
 }
 
+var errRealmImporterNotImplemented = errors.New("data context doesn't support initialization with data (RealmImporter is not implemented)")
+
 // PrepareContextUsingData is a factory function that creates instance of DataContext
 /* This function creates instance of appropriate DataContext according to input arguments values, if dataSourceConfig is config.FILE function
- * creates instance of FileDataManager.
- * loads all data (realms, clients and users) in a memory.
+ * creates instance of FileDataManager that holds data in a memory (changes are not persisted).
+ * Any other data source DataContext is created by a registered factory (see PrepareContext) and seeded with data: every realm
+ * (with clients, users and user federation configs) is imported (DataContext must implement RealmImporter), realms that
+ * already exist in a data store are kept as they are, therefore data is seeded only once and persistent data store could
+ * be initialized with same data on every start.
  * Parameters:
  *     - dataSourceCfg configuration section related to DataSource
  *     - data - ServerData
@@ -68,26 +108,32 @@ type DataContext interface {
  * Return: new instance of DataContext and error (nil if there are no errors)
  */
 func PrepareContextUsingData(dataSourceCfg *config.DataSourceConfig, data *data.ServerData, logger *logging.AppLogger) (DataContext, error) {
-	var dc DataContext
-	var err error
-	switch dataSourceCfg.Type {
-	case config.FILE:
-		dc, err = files.CreateFileDataManagerWithInitData(data)
-
-	case config.REDIS:
-		return nil, errors.New("not supported initialization with init data")
-
-	default:
-		return nil, errors.New("not supported")
+	if data == nil {
+		return nil, errors.New("data is nil")
 	}
-
-	return dc, err
+	if dataSourceCfg.Type == config.FILE {
+		mn, err := files.CreateFileDataManagerWithInitData(data, logger)
+		if err != nil {
+			return nil, err
+		}
+		return mn, nil
+	}
+	dc, err := PrepareContext(dataSourceCfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err = seedDataContext(dc, data, logger); err != nil {
+		closeDataContext(dc, logger)
+		return nil, err
+	}
+	return dc, nil
 }
 
 // PrepareContextUsingFile is a factory function that creates instance of DataContext
 /* This function creates instance of appropriate DataContext according to input arguments values, if dataSourceConfig is config.FILE function
  * creates instance of FileDataManager. For this type of context if dataFile is not nil and exists this function also provides data initialization:
- * loads all data (realms, clients and users) in a memory.
+ * loads all data (realms, clients and users) in a memory, changes are saved to dataFile (with config.SaveDelay option delay),
+ * changed dataFile is reloaded every config.ReloadInterval (config.DefaultReloadInterval if option is absent).
  * Parameters:
  *     - dataSourceCfg configuration section related to DataSource
  *     - dataFile - data for initialization (this is using only when dataSourceCfg is config.FILE)
@@ -98,58 +144,86 @@ func PrepareContextUsingFile(dataSourceCfg *config.DataSourceConfig, dataFile *s
 	if dataFile == nil {
 		return nil, errors.New("data file is nil")
 	}
-	var dc DataContext
-	var err error
-	switch dataSourceCfg.Type {
-	case config.FILE:
-		absPath, pathErr := filepath.Abs(*dataFile)
-		if pathErr != nil {
-			// todo: umv: think what to do on error
-			msg := stringFormatter.Format("An error occurred during attempt to get abs path of data file: {0}", err.Error())
-			logger.Error(msg)
-			err = pathErr
-		}
-		// init, load data in memory ...
-		mn, mnErr := files.CreateFileDataManager(absPath, logger)
-		if mnErr != nil {
-			// at least and think what to do further
-			msg := stringFormatter.Format("An error occurred during data loading: {0}", mnErr.Error())
-			logger.Error(msg)
-			return nil, mnErr
-		}
-		dc = DataContext(mn)
-
-	case config.REDIS:
-		return nil, errors.New("not supported initialization with init data")
-
-	default:
-		return nil, errors.New("not supported")
+	if dataSourceCfg.Type != config.FILE {
+		return nil, errors.New("not supported initialization with data file")
 	}
-
-	return dc, err
+	absPath, err := filepath.Abs(*dataFile)
+	if err != nil {
+		logger.Error(stringFormatter.Format("An error occurred during attempt to get abs path of data file: {0}", err.Error()))
+		return nil, err
+	}
+	fileDataSourceCfg := *dataSourceCfg
+	fileDataSourceCfg.Source = absPath
+	// init, load data in memory ...
+	dc, err := createFileDataContext(&fileDataSourceCfg, logger)
+	if err != nil {
+		logger.Error(stringFormatter.Format("An error occurred during data loading: {0}", err.Error()))
+		return nil, err
+	}
+	return dc, nil
 }
 
 // PrepareContext is a factory function that creates instance of DataContext
-/* If dataSourceCfg is config.REDIS this function creates instance of RedisDataManager by calling CreateRedisDataManager function
+/* DataContext is created by a factory that was registered for dataSourceCfg.Type (see RegisterDataContextFactory), built-in
+ * factories are:
+ * 1. config.FILE - FileDataManager that loads data from a data file (dataSourceCfg.Source)
+ * 2. config.REDIS - RedisDataManager
+ * 3. config.BOLT - BoltDataManager (embedded database file)
+ * 4. config.POSTGRES - PostgresDataManager (database schema is migrated on creation)
+ * If dataSourceCfg.Cache is set DataContext is wrapped by CachedDataContext, cache invalidations are shared between application
+ * instances via Redis pub/sub if data source is config.REDIS
  * Parameters:
  *     - dataSourceCfg configuration section related to DataSource
  *     - logger - logger instance
  * Return: new instance of DataContext and error (nil if there are no errors)
  */
 func PrepareContext(dataSourceCfg *config.DataSourceConfig, logger *logging.AppLogger) (DataContext, error) {
-	var dc DataContext
-	var err error
-	switch dataSourceCfg.Type {
-	case config.FILE:
-		return nil, errors.New("not supported initialization without init data")
-
-	case config.REDIS:
-		dc, err = redis.CreateRedisDataManager(dataSourceCfg, logger)
+	factory, err := getDataContextFactory(dataSourceCfg.Type)
+	if err != nil {
+		logger.Error(stringFormatter.Format("Data source type \"{0}\" is not supported", dataSourceCfg.Type))
+		return nil, err
+	}
+	dc, err := factory(dataSourceCfg, logger)
+	if err != nil || dataSourceCfg.Cache == nil {
+		return dc, err
+	}
+	var bus MessageBus
+	if dataSourceCfg.Type == config.REDIS {
+		bus = redis.CreateRedisMessageBus(dataSourceCfg, cacheInvalidationChannel, logger)
+	}
+	return CreateCachedDataContext(dc, dataSourceCfg.Cache, bus, logger), nil
+}
 
-	default:
-		return nil, errors.New("not supported")
+// seedDataContext imports all realms of serverData that don't exist in a data store
+func seedDataContext(dc DataContext, serverData *data.ServerData, logger *logging.AppLogger) error {
+	if len(serverData.Realms) == 0 {
+		return nil
 	}
-	// todo implement other data sources
+	importer, ok := dc.(RealmImporter)
+	if !ok {
+		return errRealmImporterNotImplemented
+	}
+	for _, realm := range serverData.Realms {
+		err := importer.ImportRealm(context.Background(), realm)
+		if err == nil {
+			logger.Info(stringFormatter.Format("Realm \"{0}\" was imported to data store", realm.Name))
+			continue
+		}
+		if !errors.As(err, &appErrs.ObjectAlreadyExistsError{}) {
+			logger.Error(stringFormatter.Format("An error occurred during realm \"{0}\" import: {1}", realm.Name, err.Error()))
+			return err
+		}
+		// realm was imported on previous start (or was created by admin), existing data must not be overwritten
+		logger.Info(stringFormatter.Format("Realm \"{0}\" already exists in data store, it was not imported", realm.Name))
+	}
+	return nil
+}
 
-	return dc, err
+// closeDataContext closes DataContext if it holds resources (connections, files)
+func closeDataContext(dc DataContext, logger *logging.AppLogger) {
+	if closer, ok := dc.(interface{ Close() error }); ok {
+		if err := closer.Close(); err != nil {
+			logger.Warn(stringFormatter.Format("An error occurred during data context closing: {0}", err.Error()))
+		}
+	}
 }
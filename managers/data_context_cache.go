@@ -0,0 +1,523 @@
+package managers
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/wissance/Ferrum/config"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/logging"
+	redisManager "github.com/wissance/Ferrum/managers/redis"
+	"github.com/wissance/stringFormatter"
+)
+
+// cacheInvalidationChannel is a name of message bus channel of cache invalidations
+const cacheInvalidationChannel = "cache_invalidation"
+
+// cacheKeySeparator separates realm name and object name (or id) in keys of cached clients and users
+const cacheKeySeparator = "\x00"
+
+type cachedObjectType string
+
+const (
+	cachedRealm  cachedObjectType = "realm"
+	cachedClient cachedObjectType = "client"
+	cachedUser   cachedObjectType = "user"
+	// cachedAll invalidates all cached objects (i.e. after data migration)
+	cachedAll cachedObjectType = "all"
+)
+
+// MessageBus delivers messages to all application instances that share a data store (i.e. RedisMessageBus)
+type MessageBus interface {
+	// Publish sends message to all subscribers (including subscriber of this bus)
+	Publish(ctx context.Context, message string) error
+	// Subscribe starts receiving of messages, onSubscribe is called on every (re)subscription (messages could be lost before it)
+	Subscribe(onMessage func(message string), onSubscribe func())
+	// Close stops receiving of messages
+	Close() error
+}
+
+// cacheInvalidation is a message about changed objects, realm invalidation invalidates all realm objects
+type cacheInvalidation struct {
+	Type  cachedObjectType `json:"type"`
+	Realm string           `json:"realm,omitempty"`
+	// Names are names of changed objects (realms names for realm invalidation)
+	Names []string `json:"names"`
+}
+
+// CachedDataContext is a read-through cache in front of DataContext
+/* Realms (GetRealm), clients (GetClient) and users (GetUser, GetUserById) are cached with TTL and size bounds
+ * (config.CacheConfig), other methods are executed by data store as is. Every change (even failed one, because it could
+ * be partially applied) invalidates changed objects: cached realm is invalidated with all its clients and users, client
+ * change invalidates realm too (realm contains clients). Invalidations are published to MessageBus (if it is set), therefore
+ * caches of all application instances that use the same data store are invalidated. Messages could be lost while bus is
+ * disconnected, therefore cache is cleared on every bus (re)subscription, TTL limits staleness if message bus is not set.
+ * Value that was read from data store is not cached if any invalidation happened during reading (generation was changed).
+ * Cached realms and clients are cached and returned as copies (realm slices of clients, users and user federation configs
+ * are copied too, authentication attributes are shared), users are shared (as in FileDataManager) and must not be changed.
+ * User federation config change invalidates realm (realm contains configs, federated users depend on them).
+ */
+type CachedDataContext struct {
+	dataContext DataContext
+	bus         MessageBus
+	logger      *logging.AppLogger
+	realms      *lruCache[data.Realm]
+	clients     *lruCache[data.Client]
+	users       *lruCache[data.User]
+	userIds     *lruCache[data.User]
+	// invalidationMutex makes generation check and caching of read value atomic relative to invalidations
+	invalidationMutex sync.Mutex
+	generation        atomic.Uint64
+}
+
+// CreateCachedDataContext creates read-through cache in front of dataContext
+/* Parameters:
+ *     - dataContext - data store
+ *     - cacheCfg - TTLs and size bounds of cached objects
+ *     - bus - bus of invalidation messages between application instances (nil if invalidations are not shared)
+ *     - logger - logger instance
+ * Returns: cached data context
+ */
+func CreateCachedDataContext(dataContext DataContext, cacheCfg *config.CacheConfig, bus MessageBus, logger *logging.AppLogger) *CachedDataContext {
+	dc := &CachedDataContext{
+		dataContext: dataContext, bus: bus, logger: logger,
+		realms:  newLruCache[data.Realm](cacheCfg.GetRealmTtl(), cacheCfg.GetMaxRealms()),
+		clients: newLruCache[data.Client](cacheCfg.GetClientTtl(), cacheCfg.GetMaxClients()),
+		users:   newLruCache[data.User](cacheCfg.GetUserTtl(), cacheCfg.GetMaxUsers()),
+		userIds: newLruCache[data.User](cacheCfg.GetUserTtl(), cacheCfg.GetMaxUsers()),
+	}
+	if bus != nil {
+		bus.Subscribe(dc.onInvalidationMessage, dc.clear)
+	}
+	return dc
+}
+
+var (
+	_ DataContext    = (*CachedDataContext)(nil)
+	_ RealmImporter  = (*CachedDataContext)(nil)
+	_ SchemaMigrator = (*CachedDataContext)(nil)
+	_ RealmsLister   = (*CachedDataContext)(nil)
+
+	_ redisManager.ClientProvider = (*CachedDataContext)(nil)
+)
+
+// IsAvailable checks whether data store is available
+func (dc *CachedDataContext) IsAvailable() bool {
+	return dc.dataContext.IsAvailable()
+}
+
+// GetRealm returns cached realm or realm from data store
+func (dc *CachedDataContext) GetRealm(ctx context.Context, realmName string) (*data.Realm, error) {
+	if realm, ok := dc.realms.get(realmName); ok {
+		return cloneRealm(&realm), nil
+	}
+	generation := dc.generation.Load()
+	realm, err := dc.dataContext.GetRealm(ctx, realmName)
+	if err != nil {
+		return nil, err
+	}
+	dc.cache(generation, func() {
+		dc.realms.set(realmName, *cloneRealm(realm))
+	})
+	return realm, nil
+}
+
+// GetClients returns realm clients from data store
+func (dc *CachedDataContext) GetClients(ctx context.Context, realmName string) ([]data.Client, error) {
+	return dc.dataContext.GetClients(ctx, realmName)
+}
+
+// GetClient returns cached client or client from data store
+func (dc *CachedDataContext) GetClient(ctx context.Context, realmName string, name string) (*data.Client, error) {
+	key := getCacheKey(realmName, name)
+	if client, ok := dc.clients.get(key); ok {
+		return cloneClient(&client), nil
+	}
+	generation := dc.generation.Load()
+	client, err := dc.dataContext.GetClient(ctx, realmName, name)
+	if err != nil {
+		return nil, err
+	}
+	dc.cache(generation, func() {
+		dc.clients.set(key, *cloneClient(client))
+	})
+	return client, nil
+}
+
+// GetUsers returns realm users from data store
+func (dc *CachedDataContext) GetUsers(ctx context.Context, realmName string) ([]data.User, error) {
+	return dc.dataContext.GetUsers(ctx, realmName)
+}
+
+// ListUsers returns page of realm users from data store
+func (dc *CachedDataContext) ListUsers(ctx context.Context, realmName string, page data.PageRequest) (*data.UsersPage, error) {
+	return dc.dataContext.ListUsers(ctx, realmName, page)
+}
+
+// SearchUsers returns page of realm users that match filter from data store
+func (dc *CachedDataContext) SearchUsers(ctx context.Context, realmName string, filter data.UsersFilter, page data.PageRequest) (*data.UsersPage, error) {
+	return dc.dataContext.SearchUsers(ctx, realmName, filter, page)
+}
+
+// GetUser returns cached user or user from data store
+func (dc *CachedDataContext) GetUser(ctx context.Context, realmName string, userName string) (data.User, error) {
+	key := getCacheKey(realmName, userName)
+	if user, ok := dc.users.get(key); ok {
+		return user, nil
+	}
+	generation := dc.generation.Load()
+	user, err := dc.dataContext.GetUser(ctx, realmName, userName)
+	if err != nil {
+		return nil, err
+	}
+	dc.cache(generation, func() {
+		dc.users.set(key, user)
+	})
+	return user, nil
+}
+
+// GetUserById returns cached user or user from data store
+func (dc *CachedDataContext) GetUserById(ctx context.Context, realmName string, userId uuid.UUID) (data.User, error) {
+	key := getCacheKey(realmName, userId.String())
+	if user, ok := dc.userIds.get(key); ok {
+		return user, nil
+	}
+	generation := dc.generation.Load()
+	user, err := dc.dataContext.GetUserById(ctx, realmName, userId)
+	if err != nil {
+		return nil, err
+	}
+	dc.cache(generation, func() {
+		dc.userIds.set(key, user)
+	})
+	return user, nil
+}
+
+// GetUserFederationConfigs returns realm user federation configs from data store
+func (dc *CachedDataContext) GetUserFederationConfigs(ctx context.Context, realmName string) ([]data.UserFederationServiceConfig, error) {
+	return dc.dataContext.GetUserFederationConfigs(ctx, realmName)
+}
+
+// GetUserFederationConfig returns user federation config from data store
+func (dc *CachedDataContext) GetUserFederationConfig(ctx context.Context, realmName string, configName string) (*data.UserFederationServiceConfig, error) {
+	return dc.dataContext.GetUserFederationConfig(ctx, realmName, configName)
+}
+
+// CreateRealm creates realm in data store and invalidates it
+func (dc *CachedDataContext) CreateRealm(ctx context.Context, realmData data.Realm) error {
+	err := dc.dataContext.CreateRealm(ctx, realmData)
+	dc.invalidate(ctx, cacheInvalidation{Type: cachedRealm, Names: []string{realmData.Name}})
+	return err
+}
+
+// CreateClient creates client in data store and invalidates it
+func (dc *CachedDataContext) CreateClient(ctx context.Context, realmName string, clientData data.Client) error {
+	err := dc.dataContext.CreateClient(ctx, realmName, clientData)
+	dc.invalidate(ctx, cacheInvalidation{Type: cachedClient, Realm: realmName, Names: []string{clientData.Name}})
+	return err
+}
+
+// CreateUser creates user in data store and invalidates it
+func (dc *CachedDataContext) CreateUser(ctx context.Context, realmName string, userData data.User) error {
+	err := dc.dataContext.CreateUser(ctx, realmName, userData)
+	dc.invalidate(ctx, cacheInvalidation{Type: cachedUser, Realm: realmName, Names: []string{userData.GetUsername()}})
+	return err
+}
+
+// CreateUserFederationConfig creates user federation config in data store and invalidates realm
+func (dc *CachedDataContext) CreateUserFederationConfig(ctx context.Context, realmName string, userFederationConfig data.UserFederationServiceConfig) error {
+	err := dc.dataContext.CreateUserFederationConfig(ctx, realmName, userFederationConfig)
+	dc.invalidate(ctx, cacheInvalidation{Type: cachedRealm, Names: []string{realmName}})
+	return err
+}
+
+// UpdateRealm updates realm in data store and invalidates old and new realm
+func (dc *CachedDataContext) UpdateRealm(ctx context.Context, realmName string, realmData data.Realm) error {
+	err := dc.dataContext.UpdateRealm(ctx, realmName, realmData)
+	dc.invalidate(ctx, cacheInvalidation{Type: cachedRealm, Names: []string{realmName, realmData.Name}})
+	return err
+}
+
+// UpdateClient updates client in data store and invalidates old and new client
+func (dc *CachedDataContext) UpdateClient(ctx context.Context, realmName string, clientName string, clientData data.Client) error {
+	err := dc.dataContext.UpdateClient(ctx, realmName, clientName, clientData)
+	dc.invalidate(ctx, cacheInvalidation{Type: cachedClient, Realm: realmName, Names: []string{clientName, clientData.Name}})
+	return err
+}
+
+// UpdateUser updates user in data store and invalidates old and new user
+func (dc *CachedDataContext) UpdateUser(ctx context.Context, realmName string, userName string, userData data.User) error {
+	err := dc.dataContext.UpdateUser(ctx, realmName, userName, userData)
+	dc.invalidate(ctx, cacheInvalidation{Type: cachedUser, Realm: realmName, Names: []string{userName, userData.GetUsername()}})
+	return err
+}
+
+// UpdateUserFederationConfig updates user federation config in data store and invalidates realm
+func (dc *CachedDataContext) UpdateUserFederationConfig(ctx context.Context, realmName string, configName string, userFederationConfig data.UserFederationServiceConfig) error {
+	err := dc.dataContext.UpdateUserFederationConfig(ctx, realmName, configName, userFederationConfig)
+	dc.invalidate(ctx, cacheInvalidation{Type: cachedRealm, Names: []string{realmName}})
+	return err
+}
+
+// DeleteRealm removes realm from data store and invalidates it
+func (dc *CachedDataContext) DeleteRealm(ctx context.Context, realmName string) error {
+	err := dc.dataContext.DeleteRealm(ctx, realmName)
+	dc.invalidate(ctx, cacheInvalidation{Type: cachedRealm, Names: []string{realmName}})
+	return err
+}
+
+// DeleteClient removes client from data store and invalidates it
+func (dc *CachedDataContext) DeleteClient(ctx context.Context, realmName string, clientName string) error {
+	err := dc.dataContext.DeleteClient(ctx, realmName, clientName)
+	dc.invalidate(ctx, cacheInvalidation{Type: cachedClient, Realm: realmName, Names: []string{clientName}})
+	return err
+}
+
+// DeleteUser removes user from data store and invalidates it
+func (dc *CachedDataContext) DeleteUser(ctx context.Context, realmName string, userName string) error {
+	err := dc.dataContext.DeleteUser(ctx, realmName, userName)
+	dc.invalidate(ctx, cacheInvalidation{Type: cachedUser, Realm: realmName, Names: []string{userName}})
+	return err
+}
+
+// DeleteUserFederationConfig removes user federation config from data store and invalidates realm
+func (dc *CachedDataContext) DeleteUserFederationConfig(ctx context.Context, realmName string, configName string) error {
+	err := dc.dataContext.DeleteUserFederationConfig(ctx, realmName, configName)
+	dc.invalidate(ctx, cacheInvalidation{Type: cachedRealm, Names: []string{realmName}})
+	return err
+}
+
+// GetOfflineSession returns offline session from data store
+func (dc *CachedDataContext) GetOfflineSession(ctx context.Context, realmName string, sessionId uuid.UUID) (*data.OfflineSession, error) {
+	return dc.dataContext.GetOfflineSession(ctx, realmName, sessionId)
+}
+
+// GetUserOfflineSessions returns user offline sessions from data store
+func (dc *CachedDataContext) GetUserOfflineSessions(ctx context.Context, realmName string, userId uuid.UUID) ([]data.OfflineSession, error) {
+	return dc.dataContext.GetUserOfflineSessions(ctx, realmName, userId)
+}
+
+// CreateOfflineSession creates offline session in data store
+func (dc *CachedDataContext) CreateOfflineSession(ctx context.Context, realmName string, session data.OfflineSession) error {
+	return dc.dataContext.CreateOfflineSession(ctx, realmName, session)
+}
+
+// UpdateOfflineSession updates offline session in data store
+func (dc *CachedDataContext) UpdateOfflineSession(ctx context.Context, realmName string, session data.OfflineSession) error {
+	return dc.dataContext.UpdateOfflineSession(ctx, realmName, session)
+}
+
+// DeleteOfflineSession removes offline session from data store
+func (dc *CachedDataContext) DeleteOfflineSession(ctx context.Context, realmName string, sessionId uuid.UUID) error {
+	return dc.dataContext.DeleteOfflineSession(ctx, realmName, sessionId)
+}
+
+// ImportRealm imports realm to data store (data store must implement RealmImporter) and invalidates it
+func (dc *CachedDataContext) ImportRealm(ctx context.Context, realm data.Realm) error {
+	importer, ok := dc.dataContext.(RealmImporter)
+	if !ok {
+		return errRealmImporterNotImplemented
+	}
+	err := importer.ImportRealm(ctx, realm)
+	dc.invalidate(ctx, cacheInvalidation{Type: cachedRealm, Names: []string{realm.Name}})
+	return err
+}
+
+// SetPassword sets user password in data store (if data store supports it) and invalidates user
+/* Returns: error (errors.ErrOperationNotImplemented if data store doesn't support password setting)
+ */
+func (dc *CachedDataContext) SetPassword(ctx context.Context, realmName string, userName string, password string) error {
+	passwordManager, ok := dc.dataContext.(interface {
+		SetPassword(ctx context.Context, realmName string, userName string, password string) error
+	})
+	if !ok {
+		return appErrs.ErrOperationNotImplemented
+	}
+	err := passwordManager.SetPassword(ctx, realmName, userName, password)
+	dc.invalidate(ctx, cacheInvalidation{Type: cachedUser, Realm: realmName, Names: []string{userName}})
+	return err
+}
+
+// GetRevisions returns revisions of realm or client from data store (if data store keeps history), revisions are not cached
+/* Returns: revisions and error (errors.ErrOperationNotImplemented if data store doesn't keep history)
+ */
+func (dc *CachedDataContext) GetRevisions(ctx context.Context, realmName string, objectType data.RevisionObjectType, objectName string,
+) ([]data.Revision, error) {
+	keeper, ok := dc.dataContext.(RevisionsKeeper)
+	if !ok {
+		return nil, appErrs.ErrOperationNotImplemented
+	}
+	return keeper.GetRevisions(ctx, realmName, objectType, objectName)
+}
+
+// GetRealmNames returns names of all realms (data store must implement RealmsLister), realms list is not cached
+func (dc *CachedDataContext) GetRealmNames(ctx context.Context) ([]string, error) {
+	lister, ok := dc.dataContext.(RealmsLister)
+	if !ok {
+		return nil, appErrs.ErrOperationNotImplemented
+	}
+	return lister.GetRealmNames(ctx)
+}
+
+// GetRedisClient returns Redis client of data store (if data store keeps data in Redis) to share it with other components
+func (dc *CachedDataContext) GetRedisClient() redis.UniversalClient {
+	if provider, ok := dc.dataContext.(redisManager.ClientProvider); ok {
+		return provider.GetRedisClient()
+	}
+	return nil
+}
+
+// Migrate migrates data of data store (if data store keeps versioned data schema), all cached objects are invalidated
+/* Returns: migration report and error (errors.ErrOperationNotImplemented if data store doesn't keep versioned data schema)
+ */
+func (dc *CachedDataContext) Migrate(ctx context.Context, dryRun bool) (*data.MigrationReport, error) {
+	migrator, ok := dc.dataContext.(SchemaMigrator)
+	if !ok {
+		return nil, appErrs.ErrOperationNotImplemented
+	}
+	report, err := migrator.Migrate(ctx, dryRun)
+	if !dryRun {
+		dc.invalidate(ctx, cacheInvalidation{Type: cachedAll})
+	}
+	return report, err
+}
+
+// Close stops receiving of invalidations and closes data store (if it holds resources)
+func (dc *CachedDataContext) Close() error {
+	if dc.bus != nil {
+		if err := dc.bus.Close(); err != nil {
+			dc.logger.Warn(stringFormatter.Format("An error occurred during cache invalidation bus closing: {0}", err.Error()))
+		}
+	}
+	if closer, ok := dc.dataContext.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// cache caches value that was read from data store by setter if there were no invalidations since read start (generation)
+func (dc *CachedDataContext) cache(generation uint64, setter func()) {
+	dc.invalidationMutex.Lock()
+	defer dc.invalidationMutex.Unlock()
+	if dc.generation.Load() == generation {
+		setter()
+	}
+}
+
+// invalidate removes changed objects from cache and publishes invalidation to other application instances
+func (dc *CachedDataContext) invalidate(ctx context.Context, invalidation cacheInvalidation) {
+	dc.applyInvalidation(invalidation)
+	if dc.bus == nil {
+		return
+	}
+	message, err := json.Marshal(invalidation)
+	if err == nil {
+		err = dc.bus.Publish(ctx, string(message))
+	}
+	if err != nil {
+		dc.logger.Warn(stringFormatter.Format("Cache invalidation of {0} \"{1}\" was not published: {2}", invalidation.Type,
+			strings.Join(invalidation.Names, ","), err.Error()))
+	}
+}
+
+// onInvalidationMessage applies invalidation that was published by any application instance (including this one)
+func (dc *CachedDataContext) onInvalidationMessage(message string) {
+	var invalidation cacheInvalidation
+	if err := json.Unmarshal([]byte(message), &invalidation); err != nil {
+		dc.logger.Warn(stringFormatter.Format("Invalid cache invalidation message was received: {0}", err.Error()))
+		// message could contain any changes
+		dc.clear()
+		return
+	}
+	dc.applyInvalidation(invalidation)
+}
+
+// applyInvalidation removes changed objects from cache
+func (dc *CachedDataContext) applyInvalidation(invalidation cacheInvalidation) {
+	dc.invalidationMutex.Lock()
+	defer dc.invalidationMutex.Unlock()
+	dc.generation.Add(1)
+	switch invalidation.Type {
+	case cachedRealm:
+		for _, realmName := range invalidation.Names {
+			dc.realms.delete(realmName)
+			realmPrefix := getCacheKey(realmName, "")
+			dc.clients.deleteIf(func(key string, _ data.Client) bool {
+				return strings.HasPrefix(key, realmPrefix)
+			})
+			isRealmUser := func(key string, _ data.User) bool {
+				return strings.HasPrefix(key, realmPrefix)
+			}
+			dc.users.deleteIf(isRealmUser)
+			dc.userIds.deleteIf(isRealmUser)
+		}
+	case cachedClient:
+		dc.realms.delete(invalidation.Realm)
+		for _, clientName := range invalidation.Names {
+			dc.clients.delete(getCacheKey(invalidation.Realm, clientName))
+		}
+	case cachedUser:
+		userNames := make(map[string]bool, len(invalidation.Names))
+		for _, userName := range invalidation.Names {
+			dc.users.delete(getCacheKey(invalidation.Realm, userName))
+			userNames[userName] = true
+		}
+		realmPrefix := getCacheKey(invalidation.Realm, "")
+		dc.userIds.deleteIf(func(key string, user data.User) bool {
+			return strings.HasPrefix(key, realmPrefix) && userNames[user.GetUsername()]
+		})
+	default:
+		dc.clearAll()
+	}
+}
+
+// clear removes all cached objects (i.e. when invalidations could be lost)
+func (dc *CachedDataContext) clear() {
+	dc.invalidationMutex.Lock()
+	defer dc.invalidationMutex.Unlock()
+	dc.generation.Add(1)
+	dc.clearAll()
+}
+
+func (dc *CachedDataContext) clearAll() {
+	dc.realms.clear()
+	dc.clients.clear()
+	dc.users.clear()
+	dc.userIds.clear()
+}
+
+// cloneRealm returns copy of realm that doesn't share clients, users and user federation configs with realm
+func cloneRealm(realm *data.Realm) *data.Realm {
+	realmCopy := *realm
+	if realm.Clients != nil {
+		realmCopy.Clients = make([]data.Client, len(realm.Clients))
+		for i := range realm.Clients {
+			realmCopy.Clients[i] = *cloneClient(&realm.Clients[i])
+		}
+	}
+	realmCopy.Users = slices.Clone(realm.Users)
+	realmCopy.UserFederationServices = slices.Clone(realm.UserFederationServices)
+	return &realmCopy
+}
+
+// cloneClient returns copy of client that doesn't share refresh token rotation flag with client
+func cloneClient(client *data.Client) *data.Client {
+	clientCopy := *client
+	if client.RefreshTokenRotation != nil {
+		refreshTokenRotation := *client.RefreshTokenRotation
+		clientCopy.RefreshTokenRotation = &refreshTokenRotation
+	}
+	return &clientCopy
+}
+
+// getCacheKey returns key of cached client or user
+func getCacheKey(realmName string, name string) string {
+	return realmName + cacheKeySeparator + name
+}
@@ -0,0 +1,773 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wissance/Ferrum/config"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/logging"
+	"github.com/wissance/Ferrum/utils/encoding"
+	sf "github.com/wissance/stringFormatter"
+)
+
+const (
+	testDbUser         = "ferrum_db"
+	testDbUserPassword = "FeRRuM000"
+	testRedisSource    = "127.0.0.1:6379"
+	testPostgresSource = "127.0.0.1:5432"
+	testPostgresDbName = "ferrum_test"
+	testUserTemplate   = `{"info":{"sub":"{0}","preferred_username":"{1}"}, "credentials":{"password": "{2}"}}`
+)
+
+// testDataContextCreator creates empty data store with additional data source options, test is skipped if data store is not available
+type testDataContextCreator func(t *testing.T, options map[config.DataSourceConnOption]string) DataContext
+
+// passwordSetter is implemented by all built-in data stores (see CachedDataContext.SetPassword)
+type passwordSetter interface {
+	SetPassword(ctx context.Context, realmName string, userName string, password string) error
+}
+
+func TestRedisDataContextConformance(t *testing.T) {
+	runDataContextConformanceSuite(t, createTestRedisDataContext)
+}
+
+func TestBoltDataContextConformance(t *testing.T) {
+	runDataContextConformanceSuite(t, createTestBoltDataContext)
+}
+
+func TestPostgresDataContextConformance(t *testing.T) {
+	runDataContextConformanceSuite(t, createTestPostgresDataContext)
+}
+
+// runDataContextConformanceSuite checks behaviour that is common for all built-in data stores, every check gets own empty data store
+func runDataContextConformanceSuite(t *testing.T, createDataContext testDataContextCreator) {
+	checks := []struct {
+		name    string
+		options map[config.DataSourceConnOption]string
+		check   func(t *testing.T, manager DataContext)
+	}{
+		{name: "CreateRealm", check: checkCreateRealm},
+		{name: "CreateRealmIsRolledBackOnError", check: checkCreateRealmIsRolledBackOnError},
+		{name: "ImportRealmKeepsPasswordSaltAndHashes", check: checkImportRealmKeepsPasswordSaltAndHashes},
+		{name: "UpdateRealm", check: checkUpdateRealm},
+		{name: "Clients", check: checkClientsOperations},
+		{name: "Users", check: checkUsersOperations},
+		{name: "UserFederationConfigs", check: checkUserFederationConfigsOperations},
+		{name: "OfflineSessions", check: checkOfflineSessionsOperations},
+		{name: "SearchUsers", check: checkSearchUsers},
+		{name: "UpdatesFailOnVersionConflict", check: checkUpdatesFailOnVersionConflict},
+		{
+			name: "RevisionsHistory", options: map[config.DataSourceConnOption]string{config.RevisionsLimit: "3"},
+			check: checkRevisionsHistory,
+		},
+	}
+
+	for _, c := range checks {
+		check := c
+		t.Run(check.name, func(t *testing.T) {
+			check.check(t, createDataContext(t, check.options))
+		})
+	}
+}
+
+func checkCreateRealm(t *testing.T, manager DataContext) {
+	realm := createTestRealm(t, "app")
+	err := manager.CreateRealm(context.Background(), realm)
+	require.NoError(t, err)
+
+	r, err := manager.GetRealm(context.Background(), realm.Name)
+	require.NoError(t, err)
+	checkRealm(t, &realm, r)
+	checkClients(t, &realm.Clients, &r.Clients)
+	assert.NotEmpty(t, r.PasswordSalt)
+	assert.NotNil(t, r.Encoder)
+	users, err := manager.GetUsers(context.Background(), realm.Name)
+	require.NoError(t, err)
+	// users raw data passwords were hashed during realm creation
+	expectedUsers := make([]data.User, len(realm.Users))
+	for i := range realm.Users {
+		expectedUsers[i] = data.CreateUser(realm.Users[i], nil)
+	}
+	checkUsers(t, &expectedUsers, &users)
+
+	err = manager.CreateRealm(context.Background(), realm)
+	assert.True(t, errors.As(err, &appErrs.ObjectAlreadyExistsError{}))
+}
+
+func checkCreateRealmIsRolledBackOnError(t *testing.T, manager DataContext) {
+	realm := createTestRealm(t, "app")
+	// second user has same username, therefore realm must not be created at all
+	realm.Users = append(realm.Users, createTestRawUser(t, uuid.New(), "user1", "123"))
+	err := manager.CreateRealm(context.Background(), realm)
+	assert.True(t, errors.As(err, &appErrs.ObjectAlreadyExistsError{}))
+	_, err = manager.GetRealm(context.Background(), realm.Name)
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+}
+
+func checkImportRealmKeepsPasswordSaltAndHashes(t *testing.T, manager DataContext) {
+	importer, ok := manager.(RealmImporter)
+	require.True(t, ok)
+	realm := createTestRealm(t, "app")
+	realm.PasswordSalt = encoding.GenerateRandomSalt()
+	encoder := encoding.NewPasswordJsonEncoder(realm.PasswordSalt)
+	realm.Users = []interface{}{createTestRawUser(t, uuid.New(), "user1", encoder.GetB64PasswordHash("123"))}
+	require.NoError(t, importer.ImportRealm(context.Background(), realm))
+
+	r, err := manager.GetRealm(context.Background(), realm.Name)
+	require.NoError(t, err)
+	assert.Equal(t, realm.PasswordSalt, r.PasswordSalt)
+	checkClients(t, &realm.Clients, &r.Clients)
+	checkUserFederationConfigs(t, &realm.UserFederationServices, &r.UserFederationServices)
+	user, err := manager.GetUser(context.Background(), realm.Name, "user1")
+	require.NoError(t, err)
+	assert.True(t, r.Encoder.IsPasswordsMatch("123", user.GetPasswordHash()))
+	err = importer.ImportRealm(context.Background(), realm)
+	assert.True(t, errors.As(err, &appErrs.ObjectAlreadyExistsError{}))
+}
+
+func checkUpdateRealm(t *testing.T, manager DataContext) {
+	realm := createTestRealm(t, "app")
+	require.NoError(t, manager.CreateRealm(context.Background(), realm))
+	r, err := manager.GetRealm(context.Background(), realm.Name)
+	require.NoError(t, err)
+	user, err := manager.GetUser(context.Background(), realm.Name, "user1")
+	require.NoError(t, err)
+
+	// 1. Rename realm, all realm objects are moved
+	realmNew := data.Realm{
+		Name: "app_renamed", TokenExpiration: 100, RefreshTokenExpiration: 50,
+		UserFederationServices: realm.UserFederationServices,
+	}
+	err = manager.UpdateRealm(context.Background(), realm.Name, realmNew)
+	require.NoError(t, err)
+	_, err = manager.GetRealm(context.Background(), realm.Name)
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+	renamedRealm, err := manager.GetRealm(context.Background(), realmNew.Name)
+	require.NoError(t, err)
+	checkRealm(t, &realmNew, renamedRealm)
+	checkClients(t, &realm.Clients, &renamedRealm.Clients)
+	assert.Equal(t, r.PasswordSalt, renamedRealm.PasswordSalt)
+	u, err := manager.GetUserById(context.Background(), realmNew.Name, user.GetId())
+	require.NoError(t, err)
+	checkUser(t, &user, &u)
+
+	// 2. Rename to existing realm and update of non-existing realm fail
+	otherRealm := createTestRealm(t, "other_app")
+	require.NoError(t, manager.CreateRealm(context.Background(), otherRealm))
+	err = manager.UpdateRealm(context.Background(), realmNew.Name, otherRealm)
+	assert.True(t, errors.As(err, &appErrs.ObjectAlreadyExistsError{}))
+	err = manager.UpdateRealm(context.Background(), realm.Name, realmNew)
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+
+	// 3. Delete realm
+	err = manager.DeleteRealm(context.Background(), realmNew.Name)
+	assert.NoError(t, err)
+	err = manager.DeleteRealm(context.Background(), realmNew.Name)
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+	_, err = manager.GetUserById(context.Background(), realmNew.Name, user.GetId())
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+}
+
+func checkClientsOperations(t *testing.T, manager DataContext) {
+	realm := data.Realm{Name: "app", TokenExpiration: 3600, RefreshTokenExpiration: 1800}
+	require.NoError(t, manager.CreateRealm(context.Background(), realm))
+	clients, err := manager.GetClients(context.Background(), realm.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(clients))
+
+	client := createTestClient("client1")
+	require.NoError(t, manager.CreateClient(context.Background(), realm.Name, client))
+	err = manager.CreateClient(context.Background(), realm.Name, client)
+	assert.True(t, errors.As(err, &appErrs.ObjectAlreadyExistsError{}))
+	otherClient := createTestClient("client2")
+	require.NoError(t, manager.CreateClient(context.Background(), realm.Name, otherClient))
+	c, err := manager.GetClient(context.Background(), realm.Name, client.Name)
+	require.NoError(t, err)
+	checkClient(t, &client, c)
+
+	// rename client
+	client.Name = "client1_renamed"
+	err = manager.UpdateClient(context.Background(), realm.Name, "client1", client)
+	require.NoError(t, err)
+	_, err = manager.GetClient(context.Background(), realm.Name, "client1")
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+	c, err = manager.GetClient(context.Background(), realm.Name, client.Name)
+	require.NoError(t, err)
+	checkClient(t, &client, c)
+	err = manager.UpdateClient(context.Background(), realm.Name, client.Name, otherClient)
+	assert.True(t, errors.As(err, &appErrs.ObjectAlreadyExistsError{}))
+	err = manager.UpdateClient(context.Background(), realm.Name, "unknown_client", client)
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+
+	require.NoError(t, manager.DeleteClient(context.Background(), realm.Name, client.Name))
+	err = manager.DeleteClient(context.Background(), realm.Name, client.Name)
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+	clients, err = manager.GetClients(context.Background(), realm.Name)
+	assert.NoError(t, err)
+	checkClients(t, &[]data.Client{otherClient}, &clients)
+}
+
+func checkUsersOperations(t *testing.T, manager DataContext) {
+	realm := data.Realm{Name: "app", TokenExpiration: 3600, RefreshTokenExpiration: 1800}
+	require.NoError(t, manager.CreateRealm(context.Background(), realm))
+	r, err := manager.GetRealm(context.Background(), realm.Name)
+	require.NoError(t, err)
+
+	// 1. Create users, username and id must be unique
+	userId := uuid.New()
+	user := data.CreateUser(createTestRawUser(t, userId, "user1", "123"), r.Encoder)
+	require.NoError(t, manager.CreateUser(context.Background(), realm.Name, user))
+	err = manager.CreateUser(context.Background(), realm.Name, data.CreateUser(createTestRawUser(t, uuid.New(), "user1", "123"), r.Encoder))
+	assert.True(t, errors.As(err, &appErrs.ObjectAlreadyExistsError{}))
+	err = manager.CreateUser(context.Background(), realm.Name, data.CreateUser(createTestRawUser(t, userId, "user2", "123"), r.Encoder))
+	assert.True(t, errors.As(err, &appErrs.ObjectAlreadyExistsError{}))
+	otherUser := data.CreateUser(createTestRawUser(t, uuid.New(), "user2", "123"), r.Encoder)
+	require.NoError(t, manager.CreateUser(context.Background(), realm.Name, otherUser))
+	err = manager.CreateUser(context.Background(), "unknown_realm", user)
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+	// users without id are not indexed by id
+	for _, userName := range []string{"user_without_id1", "user_without_id2"} {
+		var rawUser interface{}
+		err = json.Unmarshal([]byte(sf.Format(`{"info":{"preferred_username":"{0}"}}`, userName)), &rawUser)
+		require.NoError(t, err)
+		require.NoError(t, manager.CreateUser(context.Background(), realm.Name, data.CreateUser(rawUser, nil)))
+	}
+	require.NoError(t, manager.DeleteUser(context.Background(), realm.Name, "user_without_id1"))
+	require.NoError(t, manager.DeleteUser(context.Background(), realm.Name, "user_without_id2"))
+
+	u, err := manager.GetUser(context.Background(), realm.Name, "user1")
+	require.NoError(t, err)
+	checkUser(t, &user, &u)
+	u, err = manager.GetUserById(context.Background(), realm.Name, userId)
+	require.NoError(t, err)
+	checkUser(t, &user, &u)
+	_, err = manager.GetUserById(context.Background(), realm.Name, uuid.New())
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+
+	// 2. Rename user, indexes on username and id are updated
+	user = data.CreateUser(createTestRawUser(t, userId, "user1_renamed", "123"), r.Encoder)
+	require.NoError(t, manager.UpdateUser(context.Background(), realm.Name, "user1", user))
+	_, err = manager.GetUser(context.Background(), realm.Name, "user1")
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+	u, err = manager.GetUserById(context.Background(), realm.Name, userId)
+	require.NoError(t, err)
+	checkUser(t, &user, &u)
+	err = manager.UpdateUser(context.Background(), realm.Name, "user1_renamed", otherUser)
+	assert.True(t, errors.As(err, &appErrs.ObjectAlreadyExistsError{}))
+	err = manager.UpdateUser(context.Background(), realm.Name, "user1_renamed",
+		data.CreateUser(createTestRawUser(t, userId, "user2", "123"), r.Encoder))
+	assert.True(t, errors.As(err, &appErrs.ObjectAlreadyExistsError{}))
+	u, err = manager.GetUser(context.Background(), realm.Name, "user2")
+	require.NoError(t, err)
+	checkUser(t, &otherUser, &u)
+	u, err = manager.GetUser(context.Background(), realm.Name, "user1_renamed")
+	require.NoError(t, err)
+	checkUser(t, &user, &u)
+	err = manager.UpdateUser(context.Background(), realm.Name, "unknown_user", user)
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+
+	// 3. Set password
+	passwordManager, ok := manager.(passwordSetter)
+	require.True(t, ok)
+	require.NoError(t, passwordManager.SetPassword(context.Background(), realm.Name, "user1_renamed", "new_password"))
+	expectedUser := data.CreateUser(createTestRawUser(t, userId, "user1_renamed", "new_password"), r.Encoder)
+	u, err = manager.GetUser(context.Background(), realm.Name, "user1_renamed")
+	require.NoError(t, err)
+	checkUser(t, &expectedUser, &u)
+
+	// 4. Delete user
+	require.NoError(t, manager.DeleteUser(context.Background(), realm.Name, "user1_renamed"))
+	err = manager.DeleteUser(context.Background(), realm.Name, "user1_renamed")
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+	_, err = manager.GetUserById(context.Background(), realm.Name, userId)
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+	users, err := manager.GetUsers(context.Background(), realm.Name)
+	require.NoError(t, err)
+	checkUsers(t, &[]data.User{otherUser}, &users)
+}
+
+func checkUserFederationConfigsOperations(t *testing.T, manager DataContext) {
+	realm := data.Realm{Name: "app", TokenExpiration: 3600, RefreshTokenExpiration: 1800}
+	require.NoError(t, manager.CreateRealm(context.Background(), realm))
+	_, err := manager.GetUserFederationConfigs(context.Background(), realm.Name)
+	assert.True(t, errors.Is(err, appErrs.ErrZeroLength))
+
+	cfg := data.UserFederationServiceConfig{Name: "ldap1", Type: data.LDAP, Url: "ldap://ldap.example.com"}
+	require.NoError(t, manager.CreateUserFederationConfig(context.Background(), realm.Name, cfg))
+	err = manager.CreateUserFederationConfig(context.Background(), realm.Name, cfg)
+	assert.True(t, errors.As(err, &appErrs.ObjectAlreadyExistsError{}))
+	c, err := manager.GetUserFederationConfig(context.Background(), realm.Name, cfg.Name)
+	require.NoError(t, err)
+	checkUserFederationConfig(t, &cfg, c)
+
+	cfg.Name = "ldap1_renamed"
+	cfg.Url = "ldaps://ldap.example.com"
+	require.NoError(t, manager.UpdateUserFederationConfig(context.Background(), realm.Name, "ldap1", cfg))
+	_, err = manager.GetUserFederationConfig(context.Background(), realm.Name, "ldap1")
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+	configs, err := manager.GetUserFederationConfigs(context.Background(), realm.Name)
+	require.NoError(t, err)
+	checkUserFederationConfigs(t, &[]data.UserFederationServiceConfig{cfg}, &configs)
+	r, err := manager.GetRealm(context.Background(), realm.Name)
+	require.NoError(t, err)
+	checkUserFederationConfigs(t, &[]data.UserFederationServiceConfig{cfg}, &r.UserFederationServices)
+	err = manager.UpdateUserFederationConfig(context.Background(), realm.Name, "ldap1", cfg)
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+
+	require.NoError(t, manager.DeleteUserFederationConfig(context.Background(), realm.Name, cfg.Name))
+	err = manager.DeleteUserFederationConfig(context.Background(), realm.Name, cfg.Name)
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+}
+
+func checkOfflineSessionsOperations(t *testing.T, manager DataContext) {
+	realm := data.Realm{Name: "app", TokenExpiration: 3600, RefreshTokenExpiration: 1800}
+	require.NoError(t, manager.CreateRealm(context.Background(), realm))
+
+	// 1. Create offline sessions of one user, the newest first
+	userId := uuid.New()
+	now := time.Now().Truncate(time.Second)
+	newSession := data.OfflineSession{
+		Id: uuid.New(), UserId: userId, ClientId: "mobile_app", Started: now, LastActivity: now,
+		Expired: now.Add(time.Hour), TokenHash: "hash1",
+	}
+	oldSession := data.OfflineSession{
+		Id: uuid.New(), UserId: userId, ClientId: "web_app", Started: now.Add(-time.Minute), LastActivity: now,
+		Expired: now.Add(time.Hour), TokenHash: "hash2",
+	}
+	require.NoError(t, manager.CreateOfflineSession(context.Background(), realm.Name, newSession))
+	require.NoError(t, manager.CreateOfflineSession(context.Background(), realm.Name, oldSession))
+	err := manager.CreateOfflineSession(context.Background(), realm.Name, newSession)
+	assert.True(t, errors.As(err, &appErrs.ObjectAlreadyExistsError{}))
+	err = manager.CreateOfflineSession(context.Background(), "unknown_realm", data.OfflineSession{Id: uuid.New(), Expired: now.Add(time.Hour)})
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+
+	s, err := manager.GetOfflineSession(context.Background(), realm.Name, newSession.Id)
+	require.NoError(t, err)
+	checkOfflineSession(t, &newSession, s)
+	userSessions, err := manager.GetUserOfflineSessions(context.Background(), realm.Name, userId)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(userSessions))
+	checkOfflineSession(t, &oldSession, &userSessions[0])
+	checkOfflineSession(t, &newSession, &userSessions[1])
+
+	// 2. Update offline session
+	newSession.TokenHash = "hash3"
+	newSession.Expired = now.Add(2 * time.Hour)
+	require.NoError(t, manager.UpdateOfflineSession(context.Background(), realm.Name, newSession))
+	s, err = manager.GetOfflineSession(context.Background(), realm.Name, newSession.Id)
+	require.NoError(t, err)
+	checkOfflineSession(t, &newSession, s)
+	err = manager.UpdateOfflineSession(context.Background(), realm.Name, data.OfflineSession{Id: uuid.New(), Expired: now.Add(time.Hour)})
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+
+	// 3. Delete offline session
+	require.NoError(t, manager.DeleteOfflineSession(context.Background(), realm.Name, oldSession.Id))
+	_, err = manager.GetOfflineSession(context.Background(), realm.Name, oldSession.Id)
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+	err = manager.DeleteOfflineSession(context.Background(), realm.Name, oldSession.Id)
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+	userSessions, err = manager.GetUserOfflineSessions(context.Background(), realm.Name, userId)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(userSessions))
+	userSessions, err = manager.GetUserOfflineSessions(context.Background(), realm.Name, uuid.New())
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(userSessions))
+
+	// 4. Expired session is not returned
+	expiredSession := data.OfflineSession{
+		Id: uuid.New(), UserId: userId, ClientId: "web_app", Started: now.Add(-2 * time.Hour), Expired: now.Add(-time.Hour),
+	}
+	require.NoError(t, manager.CreateOfflineSession(context.Background(), realm.Name, expiredSession))
+	_, err = manager.GetOfflineSession(context.Background(), realm.Name, expiredSession.Id)
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+	userSessions, err = manager.GetUserOfflineSessions(context.Background(), realm.Name, userId)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(userSessions))
+}
+
+func checkSearchUsers(t *testing.T, manager DataContext) {
+	realm := createTestRealm(t, "search_app")
+	realm.Users = createTestSearchRawUsers(t)
+	require.NoError(t, manager.CreateRealm(context.Background(), realm))
+	enabled := false
+	testCases := []struct {
+		name          string
+		filter        data.UsersFilter
+		page          data.PageRequest
+		expectedTotal int
+		expectedUsers []string
+	}{
+		{name: "AllUsers", page: data.PageRequest{Offset: 1, Limit: 2}, expectedTotal: 4, expectedUsers: []string{"alice", "b_x"}},
+		{name: "UsernamePrefix", filter: data.UsersFilter{UsernamePrefix: "b_"}, expectedTotal: 1, expectedUsers: []string{"b_x"}},
+		{name: "Email", filter: data.UsersFilter{Email: "ALICE@example.com"}, expectedTotal: 1, expectedUsers: []string{"alice"}},
+		{name: "Enabled", filter: data.UsersFilter{Enabled: &enabled}, expectedTotal: 1, expectedUsers: []string{"alex"}},
+		{
+			name: "Attribute", filter: data.UsersFilter{Attribute: "@.info.department == 'sales'"}, page: data.PageRequest{Offset: 1, Limit: 1},
+			expectedTotal: 2, expectedUsers: []string{"bob"},
+		},
+	}
+
+	for _, tCase := range testCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			page, err := manager.SearchUsers(context.Background(), realm.Name, tCase.filter, tCase.page)
+			require.NoError(t, err)
+			assert.Equal(t, tCase.expectedTotal, page.Total)
+			userNames := make([]string, len(page.Users))
+			for i, user := range page.Users {
+				userNames[i] = user.GetUsername()
+			}
+			assert.Equal(t, tCase.expectedUsers, userNames)
+		})
+	}
+
+	page, err := manager.ListUsers(context.Background(), realm.Name, data.PageRequest{Limit: 3})
+	require.NoError(t, err)
+	assert.Equal(t, 4, page.Total)
+	assert.Len(t, page.Users, 3)
+	_, err = manager.SearchUsers(context.Background(), realm.Name, data.UsersFilter{Attribute: "@.info.department =="}, data.PageRequest{})
+	assert.Error(t, err)
+}
+
+func checkUpdatesFailOnVersionConflict(t *testing.T, manager DataContext) {
+	realm := createTestRealm(t, "app")
+	require.NoError(t, manager.CreateRealm(context.Background(), realm))
+
+	// 1. Realm version is incremented on every update, update with a stale version fails
+	r, err := manager.GetRealm(context.Background(), realm.Name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), r.Version)
+	realmNew := *r
+	realmNew.TokenExpiration = 100
+	require.NoError(t, manager.UpdateRealm(context.Background(), realm.Name, realmNew))
+	err = manager.UpdateRealm(context.Background(), realm.Name, realmNew)
+	assert.True(t, errors.As(err, &appErrs.ObjectVersionConflictError{}))
+	realmNew.Version = data.NoExpectedVersion
+	require.NoError(t, manager.UpdateRealm(context.Background(), realm.Name, realmNew))
+	r, err = manager.GetRealm(context.Background(), realm.Name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), r.Version)
+
+	// 2. Client
+	c, err := manager.GetClient(context.Background(), realm.Name, "client1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), c.Version)
+	require.NoError(t, manager.UpdateClient(context.Background(), realm.Name, c.Name, *c))
+	err = manager.UpdateClient(context.Background(), realm.Name, c.Name, *c)
+	assert.True(t, errors.As(err, &appErrs.ObjectVersionConflictError{}))
+	c, err = manager.GetClient(context.Background(), realm.Name, "client1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), c.Version)
+
+	// 3. User, password change increments version too
+	u, err := manager.GetUser(context.Background(), realm.Name, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), u.GetVersion())
+	require.NoError(t, manager.UpdateUser(context.Background(), realm.Name, "user1", u))
+	err = manager.UpdateUser(context.Background(), realm.Name, "user1", u)
+	assert.True(t, errors.As(err, &appErrs.ObjectVersionConflictError{}))
+	passwordManager, ok := manager.(passwordSetter)
+	require.True(t, ok)
+	require.NoError(t, passwordManager.SetPassword(context.Background(), realm.Name, "user1", "new_password"))
+	u, err = manager.GetUser(context.Background(), realm.Name, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), u.GetVersion())
+
+	// 4. Renamed realm is moved with its versions and passwords hashes
+	realmNew.Name = "app_renamed"
+	realmNew.Version = 3
+	require.NoError(t, manager.UpdateRealm(context.Background(), realm.Name, realmNew))
+	r, err = manager.GetRealm(context.Background(), realmNew.Name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), r.Version)
+	renamedUser, err := manager.GetUser(context.Background(), realmNew.Name, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), renamedUser.GetVersion())
+	assert.True(t, r.Encoder.IsPasswordsMatch("new_password", renamedUser.GetPasswordHash()))
+}
+
+// checkRevisionsHistory expects data store with config.RevisionsLimit = 3
+func checkRevisionsHistory(t *testing.T, manager DataContext) {
+	keeper, ok := manager.(RevisionsKeeper)
+	require.True(t, ok)
+	importer, ok := manager.(RealmImporter)
+	require.True(t, ok)
+	ctx := data.WithRevisionAuthor(context.Background(), "master/admin")
+	realm := createTestRealm(t, "app")
+	require.NoError(t, manager.CreateRealm(ctx, realm))
+
+	// 1. Realm and clients get first revision with author on creation
+	revisions, err := keeper.GetRevisions(ctx, realm.Name, data.RealmRevision, "")
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	assert.Equal(t, int64(1), revisions[0].Version)
+	assert.Equal(t, "master/admin", revisions[0].Author)
+	assert.Equal(t, realm.Name, revisions[0].Realm)
+
+	// 2. Client update adds revision, history is moved to a new client name
+	c, err := manager.GetClient(ctx, realm.Name, "client1")
+	require.NoError(t, err)
+	c.Name = "client3"
+	require.NoError(t, manager.UpdateClient(ctx, realm.Name, "client1", *c))
+	revisions, err = keeper.GetRevisions(ctx, realm.Name, data.ClientRevision, "client3")
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+	assert.Equal(t, []int64{1, 2}, []int64{revisions[0].Version, revisions[1].Version})
+	assert.Equal(t, "client3", revisions[0].ObjectName)
+	revisions, err = keeper.GetRevisions(ctx, realm.Name, data.ClientRevision, "client1")
+	require.NoError(t, err)
+	assert.Empty(t, revisions)
+
+	// 3. Only 3 latest revisions are kept, realm history (with clients history) is moved on realm rename
+	r, err := manager.GetRealm(ctx, realm.Name)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		r.TokenExpiration += 10
+		r.Version = data.NoExpectedVersion
+		require.NoError(t, manager.UpdateRealm(ctx, r.Name, *r))
+	}
+	r.Name = "app_renamed"
+	require.NoError(t, manager.UpdateRealm(ctx, realm.Name, *r))
+	revisions, err = keeper.GetRevisions(ctx, r.Name, data.RealmRevision, "")
+	require.NoError(t, err)
+	require.Len(t, revisions, 3)
+	assert.Equal(t, []int64{3, 4, 5}, []int64{revisions[0].Version, revisions[1].Version, revisions[2].Version})
+	assert.Equal(t, r.Name, revisions[2].Realm)
+	revisions, err = keeper.GetRevisions(ctx, r.Name, data.ClientRevision, "client3")
+	require.NoError(t, err)
+	assert.Len(t, revisions, 2)
+
+	// 4. Client history is removed with client, realm history is removed with realm
+	require.NoError(t, manager.DeleteClient(ctx, r.Name, "client3"))
+	revisions, err = keeper.GetRevisions(ctx, r.Name, data.ClientRevision, "client3")
+	require.NoError(t, err)
+	assert.Empty(t, revisions)
+	require.NoError(t, manager.DeleteRealm(ctx, r.Name))
+	_, err = keeper.GetRevisions(ctx, r.Name, data.RealmRevision, "")
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+
+	// 5. Imported client doesn't have revisions, its state before the first update becomes a revision without author
+	imported := createTestRealm(t, "imported")
+	imported.Clients[0].Version = 7
+	require.NoError(t, importer.ImportRealm(ctx, imported))
+	revisions, err = keeper.GetRevisions(ctx, imported.Name, data.ClientRevision, "client1")
+	require.NoError(t, err)
+	assert.Empty(t, revisions)
+	require.NoError(t, manager.UpdateClient(ctx, imported.Name, "client1", imported.Clients[0]))
+	revisions, err = keeper.GetRevisions(ctx, imported.Name, data.ClientRevision, "client1")
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+	assert.Equal(t, int64(7), revisions[0].Version)
+	assert.Empty(t, revisions[0].Author)
+	assert.Equal(t, "master/admin", revisions[1].Author)
+}
+
+// createTestRedisDataContext creates Redis data store with random namespace
+func createTestRedisDataContext(t *testing.T, options map[config.DataSourceConnOption]string) DataContext {
+	dataSourceCfg := config.DataSourceConfig{
+		Type:   config.REDIS,
+		Source: testRedisSource,
+		Options: map[config.DataSourceConnOption]string{
+			config.Namespace: sf.Format("ferrum_test_{0}", uuid.New().String()),
+			config.DbNumber:  "0",
+		},
+		Credentials: &config.CredentialsConfig{Username: testDbUser, Password: testDbUserPassword},
+	}
+	return createTestDataContext(t, &dataSourceCfg, options)
+}
+
+// createTestBoltDataContext creates Bolt data store in a temporary directory
+func createTestBoltDataContext(t *testing.T, options map[config.DataSourceConnOption]string) DataContext {
+	dataSourceCfg := config.DataSourceConfig{
+		Type:    config.BOLT,
+		Source:  filepath.Join(t.TempDir(), "ferrum.db"),
+		Options: map[config.DataSourceConnOption]string{},
+	}
+	return createTestDataContext(t, &dataSourceCfg, options)
+}
+
+// createTestPostgresDataContext creates Postgres data store that uses separate schema, schema is removed after test
+func createTestPostgresDataContext(t *testing.T, options map[config.DataSourceConnOption]string) DataContext {
+	schema := sf.Format("ferrum_test_{0}", strings.ReplaceAll(uuid.New().String(), "-", ""))
+	dataSourceCfg := config.DataSourceConfig{
+		Type:   config.POSTGRES,
+		Source: testPostgresSource,
+		Options: map[config.DataSourceConnOption]string{
+			config.DbName:    testPostgresDbName,
+			config.Namespace: schema,
+		},
+		Credentials: &config.CredentialsConfig{Username: testDbUser, Password: testDbUserPassword},
+	}
+	manager := createTestDataContext(t, &dataSourceCfg, options)
+	t.Cleanup(func() {
+		db, err := sql.Open("postgres", sf.Format("postgres://{0}:{1}@{2}/{3}?sslmode=disable", testDbUser, testDbUserPassword,
+			testPostgresSource, testPostgresDbName))
+		if err != nil {
+			return
+		}
+		defer db.Close()
+		_, _ = db.Exec(sf.Format("DROP SCHEMA IF EXISTS {0} CASCADE", pq.QuoteIdentifier(schema)))
+	})
+	return manager
+}
+
+// createTestDataContext creates data store with additional options, test is skipped if data store is not available
+func createTestDataContext(t *testing.T, dataSourceCfg *config.DataSourceConfig, options map[config.DataSourceConnOption]string) DataContext {
+	for option, value := range options {
+		dataSourceCfg.Options[option] = value
+	}
+	logger := logging.CreateLogger(&config.LoggingConfig{})
+	manager, err := PrepareContext(dataSourceCfg, logger)
+	if errors.As(err, &appErrs.DataProviderNotAvailable{}) {
+		t.Skip(sf.Format("{0} is not available: {1}", dataSourceCfg.Type, err.Error()))
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		closeDataContext(manager, logger)
+	})
+	if !manager.IsAvailable() {
+		t.Skip(sf.Format("{0} is not available", dataSourceCfg.Type))
+	}
+	return manager
+}
+
+func createTestRealm(t *testing.T, realmName string) data.Realm {
+	return data.Realm{
+		Name:                   realmName,
+		TokenExpiration:        3600,
+		RefreshTokenExpiration: 1800,
+		Clients:                []data.Client{createTestClient("client1"), createTestClient("client2")},
+		Users: []interface{}{
+			createTestRawUser(t, uuid.New(), "user1", "123"),
+			createTestRawUser(t, uuid.New(), "user2", "321"),
+		},
+		UserFederationServices: []data.UserFederationServiceConfig{
+			{Name: "ldap1", Type: data.LDAP, Url: "ldap://ldap.example.com"},
+		},
+	}
+}
+
+func createTestClient(clientName string) data.Client {
+	return data.Client{
+		Name: clientName,
+		Type: data.Confidential,
+		ID:   uuid.New(),
+		Auth: data.Authentication{
+			Type:  data.ClientIdAndSecrets,
+			Value: uuid.New().String(),
+		},
+	}
+}
+
+func createTestRawUser(t *testing.T, userId uuid.UUID, userName string, password string) interface{} {
+	var rawUser interface{}
+	err := json.Unmarshal([]byte(sf.Format(testUserTemplate, userId.String(), userName, password)), &rawUser)
+	require.NoError(t, err)
+	return rawUser
+}
+
+// createTestSearchRawUsers creates users for search tests (ordered by username: alex, alice, b_x, bob)
+func createTestSearchRawUsers(t *testing.T) []interface{} {
+	rawUsers := sf.Format(`[
+		{"info": {"sub": "{0}", "preferred_username": "bob", "department": "sales"}, "credentials": {"password": "123"}},
+		{"info": {"sub": "{1}", "preferred_username": "alice", "email": "Alice@Example.com", "department": "sales"}, "enabled": true, "credentials": {"password": "123"}},
+		{"info": {"sub": "{2}", "preferred_username": "b_x"}, "credentials": {"password": "123"}},
+		{"info": {"sub": "{3}", "preferred_username": "alex", "department": "it"}, "enabled": false, "credentials": {"password": "123"}}
+	]`, uuid.New(), uuid.New(), uuid.New(), uuid.New())
+	var users []interface{}
+	require.NoError(t, json.Unmarshal([]byte(rawUsers), &users))
+	return users
+}
+
+func checkOfflineSession(t *testing.T, expected *data.OfflineSession, actual *data.OfflineSession) {
+	assert.Equal(t, expected.Id, actual.Id)
+	assert.Equal(t, expected.UserId, actual.UserId)
+	assert.Equal(t, expected.ClientId, actual.ClientId)
+	assert.True(t, expected.Started.Equal(actual.Started))
+	assert.True(t, expected.Expired.Equal(actual.Expired))
+	assert.Equal(t, expected.TokenHash, actual.TokenHash)
+}
+
+func checkRealm(t *testing.T, expected *data.Realm, actual *data.Realm) {
+	assert.Equal(t, expected.Name, actual.Name)
+	assert.Equal(t, expected.TokenExpiration, actual.TokenExpiration)
+	assert.Equal(t, expected.RefreshTokenExpiration, actual.RefreshTokenExpiration)
+	checkUserFederationConfigs(t, &expected.UserFederationServices, &actual.UserFederationServices)
+}
+
+func checkClients(t *testing.T, expected *[]data.Client, actual *[]data.Client) {
+	assert.Equal(t, len(*expected), len(*actual))
+	for _, e := range *expected {
+		found := false
+		for _, a := range *actual {
+			if e.Name == a.Name {
+				checkClient(t, &e, &a)
+				found = true
+				break
+			}
+		}
+		assert.True(t, found)
+	}
+}
+
+func checkClient(t *testing.T, expected *data.Client, actual *data.Client) {
+	assert.Equal(t, expected.Name, actual.Name)
+	assert.Equal(t, expected.Type, actual.Type)
+	assert.Equal(t, expected.ID, actual.ID)
+	assert.Equal(t, expected.Auth.Type, actual.Auth.Type)
+	assert.Equal(t, expected.Auth.Value, actual.Auth.Value)
+}
+
+func checkUsers(t *testing.T, expected *[]data.User, actual *[]data.User) {
+	assert.Equal(t, len(*expected), len(*actual))
+	for _, e := range *expected {
+		found := false
+		for _, a := range *actual {
+			if e.GetId() == a.GetId() {
+				checkUser(t, &e, &a)
+				found = true
+				break
+			}
+		}
+		assert.True(t, found)
+	}
+}
+
+func checkUser(t *testing.T, expected *data.User, actual *data.User) {
+	assert.Equal(t, (*expected).GetId(), (*actual).GetId())
+	assert.Equal(t, (*expected).GetUsername(), (*actual).GetUsername())
+	assert.Equal(t, (*expected).GetPasswordHash(), (*actual).GetPasswordHash())
+}
+
+func checkUserFederationConfigs(t *testing.T, expected *[]data.UserFederationServiceConfig, actual *[]data.UserFederationServiceConfig) {
+	assert.Equal(t, len(*expected), len(*actual))
+	for _, e := range *expected {
+		found := false
+		for _, a := range *actual {
+			if e.Name == a.Name {
+				checkUserFederationConfig(t, &e, &a)
+				found = true
+				break
+			}
+		}
+		assert.True(t, found)
+	}
+}
+
+func checkUserFederationConfig(t *testing.T, expected *data.UserFederationServiceConfig, actual *data.UserFederationServiceConfig) {
+	assert.Equal(t, expected.Name, actual.Name)
+	assert.Equal(t, expected.Type, actual.Type)
+	assert.Equal(t, expected.Url, actual.Url)
+	assert.Equal(t, expected.SysUser, actual.SysUser)
+}
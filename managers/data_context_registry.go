@@ -0,0 +1,127 @@
+package managers
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/wissance/Ferrum/config"
+	appErrs "github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/logging"
+	"github.com/wissance/Ferrum/managers/bolt"
+	"github.com/wissance/Ferrum/managers/files"
+	"github.com/wissance/Ferrum/managers/postgres"
+	"github.com/wissance/Ferrum/managers/redis"
+)
+
+// DataContextFactory is a function that creates DataContext of a data source type it was registered for
+/* Parameters:
+ *     - dataSourceCfg - configuration section related to DataSource (Source, Credentials and Options meaning is defined by factory)
+ *     - logger - logger instance
+ * Returns: new instance of DataContext and error
+ */
+type DataContextFactory func(dataSourceCfg *config.DataSourceConfig, logger *logging.AppLogger) (DataContext, error)
+
+// dataContextFactory is a registered factories object type (for errors)
+const dataContextFactory = "data context factory"
+
+var (
+	dataContextFactoriesMutex sync.RWMutex
+	// dataContextFactories contains factories of all supported data source types, built-in data stores are registered here,
+	// other data stores could be added by RegisterDataContextFactory
+	dataContextFactories = map[config.DataSourceType]DataContextFactory{
+		config.FILE:     createFileDataContext,
+		config.REDIS:    createRedisDataContext,
+		config.BOLT:     createBoltDataContext,
+		config.POSTGRES: createPostgresDataContext,
+	}
+)
+
+// RegisterDataContextFactory registers DataContext factory for a data source type
+/* This function makes data stores pluggable: application that embeds Ferrum could register its own DataContext implementation
+ * (before application Init) and use it via config (data_source.type = dataSourceType). DataContext that also implements
+ * RealmImporter could be initialized with data (PrepareContextUsingData).
+ * Parameters:
+ *     - dataSourceType - data source type (config data_source.type value)
+ *     - factory - function that creates DataContext
+ * Returns: error (appErrs.ObjectAlreadyExistsError if factory for dataSourceType is already registered, built-in data stores
+ * could not be replaced)
+ */
+func RegisterDataContextFactory(dataSourceType config.DataSourceType, factory DataContextFactory) error {
+	if len(dataSourceType) == 0 {
+		return errors.New("data source type is empty")
+	}
+	if factory == nil {
+		return errors.New("data context factory is nil")
+	}
+	dataContextFactoriesMutex.Lock()
+	defer dataContextFactoriesMutex.Unlock()
+	if _, ok := dataContextFactories[dataSourceType]; ok {
+		return appErrs.NewObjectExistsError(dataContextFactory, string(dataSourceType), "")
+	}
+	dataContextFactories[dataSourceType] = factory
+	return nil
+}
+
+// GetDataSourceTypes returns all data source types that have registered DataContext factory (sorted by name)
+func GetDataSourceTypes() []config.DataSourceType {
+	dataContextFactoriesMutex.RLock()
+	defer dataContextFactoriesMutex.RUnlock()
+	types := make([]config.DataSourceType, 0, len(dataContextFactories))
+	for dataSourceType := range dataContextFactories {
+		types = append(types, dataSourceType)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i] < types[j]
+	})
+	return types
+}
+
+// getDataContextFactory returns registered DataContext factory for a data source type
+func getDataContextFactory(dataSourceType config.DataSourceType) (DataContextFactory, error) {
+	dataContextFactoriesMutex.RLock()
+	defer dataContextFactoriesMutex.RUnlock()
+	factory, ok := dataContextFactories[dataSourceType]
+	if !ok {
+		return nil, appErrs.NewObjectNotFoundError(dataContextFactory, string(dataSourceType), "data source type is not supported")
+	}
+	return factory, nil
+}
+
+// createFileDataContext creates FileDataManager that loads data from a data file (dataSourceCfg.Source), changes are saved
+// to this file
+func createFileDataContext(dataSourceCfg *config.DataSourceConfig, logger *logging.AppLogger) (DataContext, error) {
+	mn, err := files.CreateFileDataManager(dataSourceCfg.Source, dataSourceCfg.GetSaveDelay(), dataSourceCfg.GetReloadInterval(),
+		dataSourceCfg.GetRevisionsLimit(), logger)
+	if err != nil {
+		return nil, err
+	}
+	return mn, nil
+}
+
+// createRedisDataContext creates RedisDataManager
+func createRedisDataContext(dataSourceCfg *config.DataSourceConfig, logger *logging.AppLogger) (DataContext, error) {
+	mn, err := redis.CreateRedisDataManager(dataSourceCfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	return mn, nil
+}
+
+// createBoltDataContext creates BoltDataManager (embedded database file)
+func createBoltDataContext(dataSourceCfg *config.DataSourceConfig, logger *logging.AppLogger) (DataContext, error) {
+	mn, err := bolt.CreateBoltDataManager(dataSourceCfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	return mn, nil
+}
+
+// createPostgresDataContext creates PostgresDataManager (database schema is migrated on creation)
+func createPostgresDataContext(dataSourceCfg *config.DataSourceConfig, logger *logging.AppLogger) (DataContext, error) {
+	mn, err := postgres.CreatePostgresDataManager(dataSourceCfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	return mn, nil
+}
@@ -0,0 +1,382 @@
+package managers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wissance/Ferrum/config"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/logging"
+	"github.com/wissance/Ferrum/managers/files"
+	"github.com/wissance/Ferrum/utils/encoding"
+	sf "github.com/wissance/stringFormatter"
+)
+
+const testDataSourceType config.DataSourceType = "test_custom"
+
+// dataContextWithoutImport is a DataContext that doesn't implement RealmImporter
+type dataContextWithoutImport struct {
+	DataContext
+}
+
+// countingDataContext counts reads of objects that are cached by CachedDataContext
+type countingDataContext struct {
+	DataContext
+	reads atomic.Int32
+}
+
+func (dc *countingDataContext) GetRealm(ctx context.Context, realmName string) (*data.Realm, error) {
+	dc.reads.Add(1)
+	return dc.DataContext.GetRealm(ctx, realmName)
+}
+
+func (dc *countingDataContext) GetClient(ctx context.Context, realmName string, name string) (*data.Client, error) {
+	dc.reads.Add(1)
+	return dc.DataContext.GetClient(ctx, realmName, name)
+}
+
+func (dc *countingDataContext) GetUser(ctx context.Context, realmName string, userName string) (data.User, error) {
+	dc.reads.Add(1)
+	return dc.DataContext.GetUser(ctx, realmName, userName)
+}
+
+func (dc *countingDataContext) GetUserById(ctx context.Context, realmName string, userId uuid.UUID) (data.User, error) {
+	dc.reads.Add(1)
+	return dc.DataContext.GetUserById(ctx, realmName, userId)
+}
+
+// migratingDataContext is a DataContext that implements SchemaMigrator
+type migratingDataContext struct {
+	countingDataContext
+}
+
+func (dc *migratingDataContext) Migrate(_ context.Context, dryRun bool) (*data.MigrationReport, error) {
+	return &data.MigrationReport{SchemaVersion: 1, TargetVersion: 2, Migrations: []data.Migration{{Version: 2}}, DryRun: dryRun}, nil
+}
+
+// memoryMessageBroker delivers messages of all its buses to all subscribers at once
+type memoryMessageBroker struct {
+	mutex       sync.Mutex
+	subscribers []func(message string)
+	onSubscribe []func()
+}
+
+type memoryMessageBus struct {
+	broker *memoryMessageBroker
+}
+
+func (bus *memoryMessageBus) Publish(_ context.Context, message string) error {
+	bus.broker.mutex.Lock()
+	subscribers := append([]func(message string){}, bus.broker.subscribers...)
+	bus.broker.mutex.Unlock()
+	for _, subscriber := range subscribers {
+		subscriber(message)
+	}
+	return nil
+}
+
+func (bus *memoryMessageBus) Subscribe(onMessage func(message string), onSubscribe func()) {
+	bus.broker.mutex.Lock()
+	bus.broker.subscribers = append(bus.broker.subscribers, onMessage)
+	bus.broker.onSubscribe = append(bus.broker.onSubscribe, onSubscribe)
+	bus.broker.mutex.Unlock()
+	onSubscribe()
+}
+
+func (bus *memoryMessageBus) Close() error {
+	return nil
+}
+
+// resubscribe emulates restoring of all subscriptions after connection loss
+func (broker *memoryMessageBroker) resubscribe() {
+	for _, onSubscribe := range broker.onSubscribe {
+		onSubscribe()
+	}
+}
+
+func TestRegisterDataContextFactory(t *testing.T) {
+	logger := logging.CreateLogger(&config.LoggingConfig{})
+	serverData := createTestServerData(t, "custom", "salt", "123")
+	registerTestDataContextFactory(t, testDataSourceType, func(dataSourceCfg *config.DataSourceConfig, logger *logging.AppLogger) (DataContext, error) {
+		return files.CreateFileDataManagerWithInitData(&serverData, logger)
+	})
+	assert.Contains(t, GetDataSourceTypes(), testDataSourceType)
+	dc, err := PrepareContext(&config.DataSourceConfig{Type: testDataSourceType}, logger)
+	require.NoError(t, err)
+	_, err = dc.GetRealm(context.Background(), "custom")
+	assert.NoError(t, err)
+
+	factory := func(dataSourceCfg *config.DataSourceConfig, logger *logging.AppLogger) (DataContext, error) {
+		return nil, errors.New("must not be used")
+	}
+	err = RegisterDataContextFactory(testDataSourceType, factory)
+	assert.True(t, errors.As(err, &appErrs.ObjectAlreadyExistsError{}))
+	// built-in data stores could not be replaced
+	err = RegisterDataContextFactory(config.REDIS, factory)
+	assert.True(t, errors.As(err, &appErrs.ObjectAlreadyExistsError{}))
+	assert.Error(t, RegisterDataContextFactory("", factory))
+	assert.Error(t, RegisterDataContextFactory("test_nil", nil))
+
+	_, err = PrepareContext(&config.DataSourceConfig{Type: "unknown"}, logger)
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+
+	dc, err = PrepareContext(&config.DataSourceConfig{Type: testDataSourceType, Cache: &config.CacheConfig{}}, logger)
+	require.NoError(t, err)
+	assert.IsType(t, &CachedDataContext{}, dc)
+}
+
+func TestCachedDataContextReadsThroughAndInvalidatesOnChanges(t *testing.T) {
+	ctx := context.Background()
+	logger := logging.CreateLogger(&config.LoggingConfig{})
+	serverData := createTestServerData(t, "app", "salt", "123")
+	mn, err := files.CreateFileDataManagerWithInitData(&serverData, logger)
+	require.NoError(t, err)
+	dataStore := &countingDataContext{DataContext: mn}
+	dc := CreateCachedDataContext(dataStore, &config.CacheConfig{}, nil, logger)
+
+	// every object is read from data store once
+	for i := 0; i < 3; i++ {
+		realm, getErr := dc.GetRealm(ctx, "app")
+		require.NoError(t, getErr)
+		assert.Equal(t, 3600, realm.TokenExpiration)
+		// cached realm is not changed by caller
+		realm.TokenExpiration = 1
+		_, getErr = dc.GetClient(ctx, "app", "client")
+		require.NoError(t, getErr)
+		user, getErr := dc.GetUser(ctx, "app", "user")
+		require.NoError(t, getErr)
+		_, getErr = dc.GetUserById(ctx, "app", user.GetId())
+		require.NoError(t, getErr)
+	}
+	assert.Equal(t, int32(4), dataStore.reads.Load())
+
+	// user rename invalidates user by name and by id
+	user, err := dc.GetUser(ctx, "app", "user")
+	require.NoError(t, err)
+	var rawUser interface{}
+	require.NoError(t, json.Unmarshal([]byte(strings.Replace(user.GetJsonString(), `"user"`, `"renamed_user"`, 1)), &rawUser))
+	require.NoError(t, dc.UpdateUser(ctx, "app", "user", data.CreateUser(rawUser, nil)))
+	_, err = dc.GetUser(ctx, "app", "user")
+	assert.True(t, errors.As(err, &appErrs.EmptyNotFoundErr))
+	renamedUser, err := dc.GetUserById(ctx, "app", user.GetId())
+	require.NoError(t, err)
+	assert.Equal(t, "renamed_user", renamedUser.GetUsername())
+
+	// client change invalidates client and realm (realm contains clients)
+	reads := dataStore.reads.Load()
+	require.NoError(t, dc.UpdateClient(ctx, "app", "client", data.Client{Name: "client", Type: data.Confidential, ID: uuid.New()}))
+	client, err := dc.GetClient(ctx, "app", "client")
+	require.NoError(t, err)
+	assert.Equal(t, data.Confidential, client.Type)
+	_, err = dc.GetRealm(ctx, "app")
+	require.NoError(t, err)
+	assert.Equal(t, reads+2, dataStore.reads.Load())
+
+	// cached realm and client slices are not changed by caller
+	realm, err := dc.GetRealm(ctx, "app")
+	require.NoError(t, err)
+	require.NotEmpty(t, realm.Clients)
+	realm.Clients[0].Name = "changed_client"
+	realm, err = dc.GetRealm(ctx, "app")
+	require.NoError(t, err)
+	assert.Equal(t, "client", realm.Clients[0].Name)
+
+	// user federation config change invalidates realm (realm contains configs)
+	federationCfg := data.UserFederationServiceConfig{Type: data.LDAP, Name: "ldap", Url: "ldap://127.0.0.1:389"}
+	require.NoError(t, dc.CreateUserFederationConfig(ctx, "app", federationCfg))
+	realm, err = dc.GetRealm(ctx, "app")
+	require.NoError(t, err)
+	assert.Equal(t, []data.UserFederationServiceConfig{federationCfg}, realm.UserFederationServices)
+	require.NoError(t, dc.DeleteUserFederationConfig(ctx, "app", federationCfg.Name))
+	realm, err = dc.GetRealm(ctx, "app")
+	require.NoError(t, err)
+	assert.Empty(t, realm.UserFederationServices)
+
+	// realm removal invalidates all realm objects
+	require.NoError(t, dc.DeleteRealm(ctx, "app"))
+	_, err = dc.GetRealm(ctx, "app")
+	assert.Error(t, err)
+	_, err = dc.GetClient(ctx, "app", "client")
+	assert.Error(t, err)
+	_, err = dc.GetUserById(ctx, "app", user.GetId())
+	assert.Error(t, err)
+}
+
+func TestCachedDataContextSharesInvalidationsBetweenInstances(t *testing.T) {
+	ctx := context.Background()
+	logger := logging.CreateLogger(&config.LoggingConfig{})
+	serverData := createTestServerData(t, "app", "salt", "123")
+	mn, err := files.CreateFileDataManagerWithInitData(&serverData, logger)
+	require.NoError(t, err)
+	dataStore := &countingDataContext{DataContext: mn}
+	broker := &memoryMessageBroker{}
+	firstInstance := CreateCachedDataContext(dataStore, &config.CacheConfig{}, &memoryMessageBus{broker: broker}, logger)
+	secondInstance := CreateCachedDataContext(dataStore, &config.CacheConfig{}, &memoryMessageBus{broker: broker}, logger)
+
+	realm, err := firstInstance.GetRealm(ctx, "app")
+	require.NoError(t, err)
+	realm.TokenExpiration = 100
+	require.NoError(t, secondInstance.UpdateRealm(ctx, "app", *realm))
+	realm, err = firstInstance.GetRealm(ctx, "app")
+	require.NoError(t, err)
+	assert.Equal(t, 100, realm.TokenExpiration)
+
+	// every (re)subscription clears cache because invalidations could be lost
+	reads := dataStore.reads.Load()
+	broker.resubscribe()
+	_, err = firstInstance.GetRealm(ctx, "app")
+	require.NoError(t, err)
+	assert.Equal(t, reads+1, dataStore.reads.Load())
+}
+
+func TestCachedDataContextIsClearedAfterMigration(t *testing.T) {
+	ctx := context.Background()
+	logger := logging.CreateLogger(&config.LoggingConfig{})
+	serverData := createTestServerData(t, "app", "salt", "123")
+	mn, err := files.CreateFileDataManagerWithInitData(&serverData, logger)
+	require.NoError(t, err)
+	_, err = CreateCachedDataContext(mn, &config.CacheConfig{}, nil, logger).Migrate(ctx, false)
+	assert.ErrorIs(t, err, appErrs.ErrOperationNotImplemented)
+
+	dataStore := &migratingDataContext{countingDataContext{DataContext: mn}}
+	dc := CreateCachedDataContext(dataStore, &config.CacheConfig{}, nil, logger)
+	_, err = dc.GetRealm(ctx, "app")
+	require.NoError(t, err)
+	// dry run doesn't change data, therefore cache is kept
+	report, err := dc.Migrate(ctx, true)
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	_, err = dc.GetRealm(ctx, "app")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), dataStore.reads.Load())
+
+	_, err = dc.Migrate(ctx, false)
+	require.NoError(t, err)
+	_, err = dc.GetRealm(ctx, "app")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), dataStore.reads.Load())
+}
+
+func TestLruCacheEvictsExpiredAndLeastRecentlyUsedValues(t *testing.T) {
+	cache := newLruCache[int](100*time.Millisecond, 2)
+	cache.set("a", 1)
+	cache.set("b", 2)
+	_, ok := cache.get("a")
+	assert.True(t, ok)
+	cache.set("c", 3)
+	_, ok = cache.get("b")
+	assert.False(t, ok)
+	assert.Equal(t, 2, cache.len())
+	value, ok := cache.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+
+	time.Sleep(150 * time.Millisecond)
+	_, ok = cache.get("c")
+	assert.False(t, ok)
+	cache.deleteIf(func(key string, _ int) bool {
+		return key == "a"
+	})
+	assert.Equal(t, 0, cache.len())
+}
+
+func TestPrepareContextCreatesFileDataContextFromSource(t *testing.T) {
+	logger := logging.CreateLogger(&config.LoggingConfig{})
+	dataSourceCfg := config.DataSourceConfig{
+		Type:    config.FILE,
+		Source:  filepath.Join("files", "test_data.json"),
+		Options: map[config.DataSourceConnOption]string{config.ReloadInterval: "0"},
+	}
+	dc, err := PrepareContext(&dataSourceCfg, logger)
+	require.NoError(t, err)
+	_, err = dc.GetRealm(context.Background(), "myapp")
+	assert.NoError(t, err)
+}
+
+func TestPrepareContextUsingDataSeedsDataStore(t *testing.T) {
+	logger := logging.CreateLogger(&config.LoggingConfig{})
+	dataSourceCfg := config.DataSourceConfig{Type: config.BOLT, Source: filepath.Join(t.TempDir(), "ferrum.db")}
+	serverData := createTestServerData(t, "app", "salt", "123")
+
+	dc, err := PrepareContextUsingData(&dataSourceCfg, &serverData, logger)
+	require.NoError(t, err)
+	realm, err := dc.GetRealm(context.Background(), "app")
+	require.NoError(t, err)
+	assert.Equal(t, "salt", realm.PasswordSalt)
+	user, err := dc.GetUser(context.Background(), "app", "user")
+	require.NoError(t, err)
+	assert.True(t, realm.Encoder.IsPasswordsMatch("123", user.GetPasswordHash()))
+	// seed data is not changed by a data store
+	rawUserData, err := json.Marshal(serverData.Realms[0].Users[0])
+	require.NoError(t, err)
+	assert.JSONEq(t, user.GetJsonString(), string(rawUserData))
+	require.NoError(t, dc.UpdateRealm(context.Background(), "app", data.Realm{Name: "app", TokenExpiration: 100}))
+	closeDataContext(dc, logger)
+
+	// existing realms are not overwritten by seed data, new realms are imported
+	serverData.Realms = append(serverData.Realms, createTestServerData(t, "other_app", "other_salt", "321").Realms...)
+	dc, err = PrepareContextUsingData(&dataSourceCfg, &serverData, logger)
+	require.NoError(t, err)
+	defer closeDataContext(dc, logger)
+	realm, err = dc.GetRealm(context.Background(), "app")
+	require.NoError(t, err)
+	assert.Equal(t, 100, realm.TokenExpiration)
+	assert.Equal(t, "salt", realm.PasswordSalt)
+	otherRealm, err := dc.GetRealm(context.Background(), "other_app")
+	require.NoError(t, err)
+	assert.Equal(t, "other_salt", otherRealm.PasswordSalt)
+}
+
+func TestPrepareContextUsingDataFailsWithoutRealmImporter(t *testing.T) {
+	logger := logging.CreateLogger(&config.LoggingConfig{})
+	registerTestDataContextFactory(t, testDataSourceType, func(dataSourceCfg *config.DataSourceConfig, logger *logging.AppLogger) (DataContext, error) {
+		mn, err := files.CreateFileDataManagerWithInitData(&data.ServerData{}, logger)
+		return &dataContextWithoutImport{DataContext: mn}, err
+	})
+	serverData := createTestServerData(t, "app", "salt", "123")
+	_, err := PrepareContextUsingData(&config.DataSourceConfig{Type: testDataSourceType}, &serverData, logger)
+	assert.Error(t, err)
+	// there is nothing to seed
+	_, err = PrepareContextUsingData(&config.DataSourceConfig{Type: testDataSourceType}, &data.ServerData{}, logger)
+	assert.NoError(t, err)
+}
+
+func registerTestDataContextFactory(t *testing.T, dataSourceType config.DataSourceType, factory DataContextFactory) {
+	require.NoError(t, RegisterDataContextFactory(dataSourceType, factory))
+	t.Cleanup(func() {
+		dataContextFactoriesMutex.Lock()
+		defer dataContextFactoriesMutex.Unlock()
+		delete(dataContextFactories, dataSourceType)
+	})
+}
+
+func createTestServerData(t *testing.T, realmName string, salt string, password string) data.ServerData {
+	encoder := encoding.NewPasswordJsonEncoder(salt)
+	var rawUser interface{}
+	err := json.Unmarshal([]byte(sf.Format(`{"info": {"sub": "{0}", "preferred_username": "user"}, "credentials": {"password": "{1}"}}`,
+		uuid.New().String(), encoder.GetB64PasswordHash(password))), &rawUser)
+	require.NoError(t, err)
+	return data.ServerData{
+		Realms: []data.Realm{
+			{
+				Name:                   realmName,
+				TokenExpiration:        3600,
+				RefreshTokenExpiration: 1800,
+				PasswordSalt:           salt,
+				Clients:                []data.Client{{Name: "client", Type: data.Public, ID: uuid.New()}},
+				Users:                  []interface{}{rawUser},
+			},
+		},
+	}
+}
@@ -0,0 +1,312 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	sf "github.com/wissance/stringFormatter"
+)
+
+// RealmsLister is an optional DataContext extension that lists realms of a data store
+/* File, Bolt and Postgres data stores implement this interface, Redis data store doesn't have realms index (realms to copy
+ * from it must be named explicitly, see CopyOptions.Realms)
+ */
+type RealmsLister interface {
+	// GetRealmNames returns names of all realms ordered by name
+	GetRealmNames(ctx context.Context) ([]string, error)
+}
+
+// types of copied objects (data.CopiedObject Type), they are the same as admin CLI resources
+const (
+	copiedRealm          = "realm"
+	copiedClient         = "client"
+	copiedUser           = "user"
+	copiedUserFederation = "user_federation"
+)
+
+// CopyOptions are options of data copying between data stores (see CopyData)
+type CopyOptions struct {
+	// Realms are names of copied realms, if it is empty all source realms are copied (source must implement RealmsLister)
+	Realms []string
+	// OnConflict defines what to do with objects that exist in target data store
+	OnConflict data.ConflictStrategy
+	// DryRun - if true nothing is copied, report contains actions that would be done
+	DryRun bool
+	// Progress (optional) is called after every object is copied (planned on dry run), done is a number of processed objects
+	Progress func(object data.CopiedObject, done int, total int)
+}
+
+// realmCopy is a copied realm with its objects and planned actions
+type realmCopy struct {
+	realm             *data.Realm
+	clients           []data.Client
+	users             []data.User
+	federationConfigs []data.UserFederationServiceConfig
+	// exists is true if realm exists in target data store
+	exists bool
+	// objects are planned actions in order of copying: realm, user federation configs, clients, users
+	objects []data.CopiedObject
+}
+
+// CopyData copies realms with their clients, users and user federation configs from source data store to target data store
+/* Data is copied as it is (as RealmImporter does): realm password salt, users passwords hashes and objects identifiers are
+ * kept, therefore users could be copied to existing realm only if it has the same password salt. Realms that don't exist in
+ * target are imported (target must implement RealmImporter), objects of existing realms are created, updated or skipped
+ * one by one according to options.OnConflict. All actions are planned before copying, therefore if copying is impossible
+ * (data.FailOnExisting conflicts, different password salt) nothing is copied. Offline sessions and revisions are not copied.
+ * Parameters:
+ *     - ctx - context of operation
+ *     - source - data store to copy from
+ *     - target - data store to copy to
+ *     - options - copying options
+ * Returns: copy report and error (report contains planned actions if copying fails because of conflicts)
+ */
+func CopyData(ctx context.Context, source DataContext, target DataContext, options CopyOptions) (*data.CopyReport, error) {
+	if options.OnConflict != data.SkipExisting && options.OnConflict != data.OverwriteExisting && options.OnConflict != data.FailOnExisting {
+		return nil, errors.New(sf.Format("conflict strategy \"{0}\" is not supported, use \"{1}\", \"{2}\" or \"{3}\"", options.OnConflict,
+			data.SkipExisting, data.OverwriteExisting, data.FailOnExisting))
+	}
+	realmNames := options.Realms
+	if len(realmNames) == 0 {
+		var err error
+		if realmNames, err = getRealmNames(ctx, source); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &data.CopyReport{DryRun: options.DryRun, OnConflict: options.OnConflict, Objects: []data.CopiedObject{}}
+	copies := make([]*realmCopy, 0, len(realmNames))
+	var conflicts []string
+	for _, realmName := range realmNames {
+		realmData, err := planRealmCopy(ctx, source, target, realmName, options.OnConflict)
+		if err != nil {
+			return nil, err
+		}
+		if _, isImporter := target.(RealmImporter); !realmData.exists && !isImporter {
+			return nil, errRealmImporterNotImplemented
+		}
+		for _, object := range realmData.objects {
+			report.Objects = append(report.Objects, object)
+			if object.Action == data.CopyConflict {
+				conflicts = append(conflicts, sf.Format("{0} \"{1}\" of realm \"{2}\"", object.Type, object.Name, object.Realm))
+			}
+		}
+		copies = append(copies, realmData)
+	}
+	if len(conflicts) > 0 {
+		return report, errors.New(sf.Format("{0} object(s) already exist in target data store: {1}", len(conflicts),
+			strings.Join(conflicts, ", ")))
+	}
+
+	total := len(report.Objects)
+	done := 0
+	for _, realmData := range copies {
+		if !options.DryRun {
+			if err := applyRealmCopy(ctx, target, realmData); err != nil {
+				return report, err
+			}
+		}
+		for _, object := range realmData.objects {
+			switch object.Action {
+			case data.CopyCreated:
+				report.Created++
+			case data.CopyUpdated:
+				report.Updated++
+			default:
+				report.Skipped++
+			}
+			done++
+			if options.Progress != nil {
+				options.Progress(object, done, total)
+			}
+		}
+	}
+	return report, nil
+}
+
+// planRealmCopy reads realm with its objects from source and plans actions by checking which objects exist in target
+func planRealmCopy(ctx context.Context, source DataContext, target DataContext, realmName string,
+	onConflict data.ConflictStrategy,
+) (*realmCopy, error) {
+	realm, err := source.GetRealm(ctx, realmName)
+	if err != nil {
+		return nil, err
+	}
+	realmData := &realmCopy{realm: realm}
+	if realmData.clients, err = source.GetClients(ctx, realmName); err != nil && !isEmptyObjectsList(err) {
+		return nil, err
+	}
+	if realmData.users, err = source.GetUsers(ctx, realmName); err != nil && !isEmptyObjectsList(err) {
+		return nil, err
+	}
+	if realmData.federationConfigs, err = source.GetUserFederationConfigs(ctx, realmName); err != nil && !isEmptyObjectsList(err) {
+		return nil, err
+	}
+
+	targetRealm, err := target.GetRealm(ctx, realmName)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	realmData.exists = err == nil
+	// action of an object that exists in target (isExists is checked only if realm exists)
+	getAction := func(isExists func() (bool, error)) (data.CopyAction, error) {
+		if !realmData.exists {
+			return data.CopyCreated, nil
+		}
+		exists, existsErr := isExists()
+		if existsErr != nil || !exists {
+			return data.CopyCreated, existsErr
+		}
+		switch onConflict {
+		case data.OverwriteExisting:
+			return data.CopyUpdated, nil
+		case data.SkipExisting:
+			return data.CopySkipped, nil
+		}
+		return data.CopyConflict, nil
+	}
+
+	action, _ := getAction(func() (bool, error) { return true, nil })
+	realmData.objects = append(realmData.objects, data.CopiedObject{Realm: realmName, Type: copiedRealm, Name: realmName, Action: action})
+	for _, cfg := range realmData.federationConfigs {
+		action, err = getAction(func() (bool, error) {
+			return isObjectExists(target.GetUserFederationConfig(ctx, realmName, cfg.Name))
+		})
+		if err != nil {
+			return nil, err
+		}
+		realmData.objects = append(realmData.objects, data.CopiedObject{Realm: realmName, Type: copiedUserFederation, Name: cfg.Name, Action: action})
+	}
+	for _, client := range realmData.clients {
+		action, err = getAction(func() (bool, error) { return isObjectExists(target.GetClient(ctx, realmName, client.Name)) })
+		if err != nil {
+			return nil, err
+		}
+		realmData.objects = append(realmData.objects, data.CopiedObject{Realm: realmName, Type: copiedClient, Name: client.Name, Action: action})
+	}
+	copiesUsers := false
+	for _, user := range realmData.users {
+		action, err = getAction(func() (bool, error) { return isObjectExists(target.GetUser(ctx, realmName, user.GetUsername())) })
+		if err != nil {
+			return nil, err
+		}
+		copiesUsers = copiesUsers || action == data.CopyCreated || action == data.CopyUpdated
+		realmData.objects = append(realmData.objects, data.CopiedObject{Realm: realmName, Type: copiedUser, Name: user.GetUsername(), Action: action})
+	}
+	if copiesUsers && realmData.exists && targetRealm.PasswordSalt != realm.PasswordSalt {
+		return nil, errors.New(sf.Format("realm \"{0}\" has other password salt in target data store, users passwords hashes could not "+
+			"be copied to it", realmName))
+	}
+	return realmData, nil
+}
+
+// applyRealmCopy performs planned actions: imports realm that doesn't exist in target or creates and updates realm objects
+func applyRealmCopy(ctx context.Context, target DataContext, realmData *realmCopy) error {
+	realmName := realmData.realm.Name
+	if !realmData.exists {
+		realm := *realmData.realm
+		realm.Clients = realmData.clients
+		realm.UserFederationServices = realmData.federationConfigs
+		realm.Users = make([]interface{}, len(realmData.users))
+		for i, user := range realmData.users {
+			realm.Users[i] = user.GetRawData()
+		}
+		realm.Encoder = nil
+		return target.(RealmImporter).ImportRealm(ctx, realm)
+	}
+
+	// objects are in order of planning: realm, user federation configs, clients, users
+	objects := realmData.objects
+	if objects[0].Action == data.CopyUpdated {
+		realm := *realmData.realm
+		realm.Clients = nil
+		realm.Users = nil
+		realm.UserFederationServices = nil
+		realm.Encoder = nil
+		realm.Version = data.NoExpectedVersion
+		if err := target.UpdateRealm(ctx, realmName, realm); err != nil {
+			return err
+		}
+	}
+	objects = objects[1:]
+	for i, cfg := range realmData.federationConfigs {
+		var err error
+		switch objects[i].Action {
+		case data.CopyCreated:
+			err = target.CreateUserFederationConfig(ctx, realmName, cfg)
+		case data.CopyUpdated:
+			err = target.UpdateUserFederationConfig(ctx, realmName, cfg.Name, cfg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	objects = objects[len(realmData.federationConfigs):]
+	for i, client := range realmData.clients {
+		client.Version = data.NoExpectedVersion
+		var err error
+		switch objects[i].Action {
+		case data.CopyCreated:
+			err = target.CreateClient(ctx, realmName, client)
+		case data.CopyUpdated:
+			err = target.UpdateClient(ctx, realmName, client.Name, client)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	objects = objects[len(realmData.clients):]
+	for i, user := range realmData.users {
+		user = data.CreateUserWithVersion(user, data.NoExpectedVersion)
+		var err error
+		switch objects[i].Action {
+		case data.CopyCreated:
+			err = target.CreateUser(ctx, realmName, user)
+		case data.CopyUpdated:
+			err = target.UpdateUser(ctx, realmName, user.GetUsername(), user)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getRealmNames returns names of all data store realms, data store must implement RealmsLister
+func getRealmNames(ctx context.Context, dataContext DataContext) ([]string, error) {
+	errNotLister := errors.New("source data store doesn't list realms, realms to copy must be specified")
+	lister, ok := dataContext.(RealmsLister)
+	if !ok {
+		return nil, errNotLister
+	}
+	names, err := lister.GetRealmNames(ctx)
+	if errors.Is(err, appErrs.ErrOperationNotImplemented) {
+		// CachedDataContext over data store that doesn't list realms
+		return nil, errNotLister
+	}
+	return names, err
+}
+
+// isObjectExists converts result of object reading to object existence
+func isObjectExists[T any](_ T, err error) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+	if isNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+func isNotFound(err error) bool {
+	var notFoundErr appErrs.ObjectNotFoundError
+	return errors.As(err, &notFoundErr)
+}
+
+// isEmptyObjectsList checks whether error of realm objects list reading means that realm doesn't have such objects
+func isEmptyObjectsList(err error) bool {
+	return errors.Is(err, appErrs.ErrZeroLength) || isNotFound(err)
+}
@@ -0,0 +1,129 @@
+package managers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wissance/Ferrum/config"
+	"github.com/wissance/Ferrum/data"
+	"github.com/wissance/Ferrum/logging"
+	"github.com/wissance/Ferrum/managers/files"
+)
+
+func TestCopyDataToNewRealm(t *testing.T) {
+	logger := logging.CreateLogger(&config.LoggingConfig{})
+	sourceData := createTestServerData(t, "app", "salt", "password")
+	source, err := files.CreateFileDataManagerWithInitData(&sourceData, logger)
+	require.NoError(t, err)
+	targetData := createTestServerData(t, "other", "other_salt", "password")
+	target, err := files.CreateFileDataManagerWithInitData(&targetData, logger)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	var progress []int
+	report, err := CopyData(ctx, source, target, CopyOptions{
+		OnConflict: data.FailOnExisting,
+		Progress: func(object data.CopiedObject, done int, total int) {
+			assert.Equal(t, 3, total)
+			progress = append(progress, done)
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, progress)
+	assert.Equal(t, 3, report.Created)
+	assert.Equal(t, []data.CopiedObject{
+		{Realm: "app", Type: "realm", Name: "app", Action: data.CopyCreated},
+		{Realm: "app", Type: "client", Name: "client", Action: data.CopyCreated},
+		{Realm: "app", Type: "user", Name: "user", Action: data.CopyCreated},
+	}, report.Objects)
+
+	// realm salt and password hashes are kept
+	realm, err := target.GetRealm(ctx, "app")
+	require.NoError(t, err)
+	assert.Equal(t, "salt", realm.PasswordSalt)
+	user, err := target.GetUser(ctx, "app", "user")
+	require.NoError(t, err)
+	assert.True(t, realm.Encoder.IsPasswordsMatch("password", user.GetPasswordHash()))
+}
+
+func TestCopyDataToExistingRealm(t *testing.T) {
+	testCases := []struct {
+		name           string
+		onConflict     data.ConflictStrategy
+		dryRun         bool
+		expectedAction data.CopyAction
+		expectedError  bool
+	}{
+		{name: "skip", onConflict: data.SkipExisting, expectedAction: data.CopySkipped},
+		{name: "overwrite", onConflict: data.OverwriteExisting, expectedAction: data.CopyUpdated},
+		{name: "overwrite_dry_run", onConflict: data.OverwriteExisting, dryRun: true, expectedAction: data.CopyUpdated},
+		{name: "fail", onConflict: data.FailOnExisting, expectedAction: data.CopyConflict, expectedError: true},
+	}
+	for _, tCase := range testCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			logger := logging.CreateLogger(&config.LoggingConfig{})
+			ctx := context.Background()
+			sourceData := createTestServerData(t, "app", "salt", "new_password")
+			sourceData.Realms[0].TokenExpiration = 100
+			source, err := files.CreateFileDataManagerWithInitData(&sourceData, logger)
+			require.NoError(t, err)
+			require.NoError(t, source.CreateClient(ctx, "app", data.Client{Name: "web", Type: data.Public, ID: uuid.New()}))
+			targetData := createTestServerData(t, "app", "salt", "old_password")
+			target, err := files.CreateFileDataManagerWithInitData(&targetData, logger)
+			require.NoError(t, err)
+
+			report, err := CopyData(ctx, source, target, CopyOptions{Realms: []string{"app"}, OnConflict: tCase.onConflict, DryRun: tCase.dryRun})
+			require.NotNil(t, report)
+			assert.Equal(t, []data.CopiedObject{
+				{Realm: "app", Type: "realm", Name: "app", Action: tCase.expectedAction},
+				{Realm: "app", Type: "client", Name: "client", Action: tCase.expectedAction},
+				{Realm: "app", Type: "client", Name: "web", Action: data.CopyCreated},
+				{Realm: "app", Type: "user", Name: "user", Action: tCase.expectedAction},
+			}, report.Objects)
+			if tCase.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			realm, err := target.GetRealm(ctx, "app")
+			require.NoError(t, err)
+			user, err := target.GetUser(ctx, "app", "user")
+			require.NoError(t, err)
+			_, webErr := target.GetClient(ctx, "app", "web")
+			copied := !tCase.dryRun && !tCase.expectedError
+			assert.Equal(t, copied, webErr == nil)
+			overwritten := copied && tCase.onConflict == data.OverwriteExisting
+			assert.Equal(t, overwritten, realm.TokenExpiration == 100)
+			assert.Equal(t, overwritten, realm.Encoder.IsPasswordsMatch("new_password", user.GetPasswordHash()))
+		})
+	}
+}
+
+func TestCopyDataFails(t *testing.T) {
+	logger := logging.CreateLogger(&config.LoggingConfig{})
+	ctx := context.Background()
+	sourceData := createTestServerData(t, "app", "salt", "password")
+	source, err := files.CreateFileDataManagerWithInitData(&sourceData, logger)
+	require.NoError(t, err)
+	targetData := createTestServerData(t, "app", "other_salt", "password")
+	target, err := files.CreateFileDataManagerWithInitData(&targetData, logger)
+	require.NoError(t, err)
+
+	// users passwords hashes are not valid with other realm salt
+	_, err = CopyData(ctx, source, target, CopyOptions{OnConflict: data.OverwriteExisting})
+	assert.Error(t, err)
+	user, err := target.GetUser(ctx, "app", "user")
+	require.NoError(t, err)
+	assert.Equal(t, targetData.Realms[0].Users[0], user.GetRawData())
+
+	_, err = CopyData(ctx, source, target, CopyOptions{OnConflict: "replace"})
+	assert.Error(t, err)
+	_, err = CopyData(ctx, &dataContextWithoutImport{DataContext: source}, target, CopyOptions{OnConflict: data.SkipExisting})
+	assert.Error(t, err)
+	_, err = CopyData(ctx, source, target, CopyOptions{Realms: []string{"unknown"}, OnConflict: data.SkipExisting})
+	assert.Error(t, err)
+}
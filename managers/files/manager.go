@@ -1,8 +1,13 @@
 package files
 
 import (
+	"context"
 	"encoding/json"
+	e "errors"
 	"os"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/wissance/Ferrum/config"
 	"github.com/wissance/Ferrum/utils/encoding"
@@ -18,40 +23,86 @@ import (
 type objectType string
 
 const (
-	Realm  objectType = "realm"
-	Client objectType = "client"
-	User   objectType = "user"
+	Realm                objectType = "realm"
+	Client               objectType = "client"
+	User                 objectType = "user"
+	UserFederationConfig objectType = "user federation config"
 )
 
-// FileDataManager is the simplest Data Storage without any dependencies, it uses single JSON file (it is users and clients RO auth server)
-// This context type is extremely useful for simple systems
+// FileDataManager is the simplest Data Storage without any dependencies, it uses single JSON file (realms with clients and users)
+// This context type is extremely useful for simple systems and tests
+/* All data is stored in memory (serverData) and guarded by mutex, changes are made as copy-on-write (realms, clients, users
+ * slices are never changed in place), therefore objects that were returned earlier are not affected by later changes.
+ * If manager was created with data file every change is persisted to this file (see saveData), with saveDelay > 0 changes
+ * made during delay are persisted together. Manager that was created with init data (without file) keeps changes in memory only.
+ * With reloadInterval > 0 data file is watched and reloaded on change (see Reload), manager must be closed (see Close).
+ * Offline sessions are not stored in a data file, therefore they are not supported. History of realms and clients changes
+ * (up to revisionsLimit revisions of every realm and client, see data.Revision) is stored in a separate revisions file next to
+ * data file (see getRevisionsFile), therefore data file that is edited manually contains realms only.
+ * Operations don't wait for any external resource, therefore context.Context that every operation receives is not used.
+ */
 type FileDataManager struct {
-	dataFile   string
-	serverData data.ServerData
-	logger     *logging.AppLogger
+	dataFile      string
+	dataFileState dataFileState
+	serverData    data.ServerData
+	logger        *logging.AppLogger
+	mutex         sync.RWMutex
+	saveDelay     time.Duration
+	saveTimer     *time.Timer
+	saveMutex     sync.Mutex
+	watcher       *dataFileWatcher
+	// revisionsLimit is a max number of kept revisions of every realm and client, 0 means that history is not kept
+	revisionsLimit int
 }
 
 // CreateFileDataManagerWithInitData initializes instance of FileDataManager and sets loaded data to serverData
-/* This factory function creates initialize with data instance of  FileDataManager, error reserved for usage but always nil here
+/* This factory function creates initialize with data instance of  FileDataManager, error reserved for usage but always nil here.
+ * Changes are not persisted, passed serverData is never changed by manager.
  * Parameters:
- *    serverData already loaded data.ServerData from Json file in memory
+ *    - serverData already loaded data.ServerData from Json file in memory
+ *    - logger - logger instance
  * Returns: context and error (currently is nil)
  */
-func CreateFileDataManagerWithInitData(serverData *data.ServerData) (*FileDataManager, error) {
+func CreateFileDataManagerWithInitData(serverData *data.ServerData, logger *logging.AppLogger) (*FileDataManager, error) {
 	// todo(UMV): todo provide an error handling
-	mn := &FileDataManager{serverData: *serverData}
+	mn := &FileDataManager{serverData: *serverData, logger: logger, revisionsLimit: config.DefaultRevisionsLimit}
 	return mn, nil
 }
 
-func CreateFileDataManager(dataFile string, logger *logging.AppLogger) (*FileDataManager, error) {
-	// todo(UMV): todo provide an error handling
-	mn := &FileDataManager{dataFile: dataFile, logger: logger}
+// CreateFileDataManager initializes instance of FileDataManager and loads data from dataFile
+/* Parameters:
+ *    - dataFile - path to JSON data file, changes are persisted to this file
+ *    - saveDelay - delay of data file saving after change (0 means saving on every change)
+ *    - reloadInterval - interval of data file changes checking (0 means that data file is not reloaded)
+ *    - revisionsLimit - max number of kept revisions of every realm and client (0 means that history is not kept)
+ *    - logger - logger instance
+ * Returns: context and error
+ */
+func CreateFileDataManager(dataFile string, saveDelay time.Duration, reloadInterval time.Duration, revisionsLimit int,
+	logger *logging.AppLogger,
+) (*FileDataManager, error) {
+	mn := &FileDataManager{dataFile: dataFile, saveDelay: saveDelay, logger: logger, revisionsLimit: revisionsLimit}
 	if err := mn.loadData(); err != nil {
 		return nil, errors.NewUnknownError("data loading", "CreateFileDataManager", err)
 	}
+	if reloadInterval > 0 {
+		mn.watcher = createDataFileWatcher(mn, reloadInterval, logger)
+		mn.watcher.Start()
+	}
 	return mn, nil
 }
 
+// Close stops data file watching and saves changes that are waiting for saving
+/* Manager could be used after Close, but data file is not reloaded anymore
+ * Returns: error of data file saving
+ */
+func (mn *FileDataManager) Close() error {
+	if mn.watcher != nil {
+		mn.watcher.Stop()
+	}
+	return mn.Flush()
+}
+
 // IsAvailable methods that checks whether DataContext could be used or not
 /* Availability means that serverData is not empty, so simple
  * Parameters: no
@@ -62,28 +113,48 @@ func (mn *FileDataManager) IsAvailable() bool {
 		_, err := os.Stat(mn.dataFile)
 		return err == nil
 	}
+	mn.mutex.RLock()
+	defer mn.mutex.RUnlock()
 	return len(mn.serverData.Realms) > 0
 }
 
+// GetRealmNames returns names of all realms ordered by name (see managers.RealmsLister)
+func (mn *FileDataManager) GetRealmNames(ctx context.Context) ([]string, error) {
+	if !mn.IsAvailable() {
+		return nil, errors.NewDataProviderNotAvailable(string(config.FILE), mn.dataFile)
+	}
+	mn.mutex.RLock()
+	defer mn.mutex.RUnlock()
+	names := make([]string, len(mn.serverData.Realms))
+	for i := range mn.serverData.Realms {
+		names[i] = mn.serverData.Realms[i].Name
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
 // GetRealm function for getting Realm by name
 /* Searches for a realm with name realmName in serverData adn return it. Returns realm with clients but no users
  * Parameters:
  *     - realmName - name of a realm
  * Returns: Realm and error
  */
-func (mn *FileDataManager) GetRealm(realmName string) (*data.Realm, error) {
+func (mn *FileDataManager) GetRealm(ctx context.Context, realmName string) (*data.Realm, error) {
 	if !mn.IsAvailable() {
 		return nil, errors.NewDataProviderNotAvailable(string(config.FILE), mn.dataFile)
 	}
-	for _, e := range mn.serverData.Realms {
-		// case-sensitive comparison, myapp and MyApP are different realms
-		if e.Name == realmName {
-			e.Users = nil
-			e.Encoder = encoding.NewPasswordJsonEncoder(e.PasswordSalt)
-			return &e, nil
-		}
+	mn.mutex.RLock()
+	defer mn.mutex.RUnlock()
+	index := mn.findRealm(realmName)
+	if index < 0 {
+		return nil, errors.NewObjectNotFoundError(string(Realm), realmName, "")
 	}
-	return nil, errors.NewObjectNotFoundError(string(Realm), realmName, "")
+	realm := mn.serverData.Realms[index]
+	realm.Users = nil
+	realm.Clients = slices.Clone(realm.Clients)
+	realm.UserFederationServices = slices.Clone(realm.UserFederationServices)
+	realm.Encoder = encoding.NewPasswordJsonEncoder(realm.PasswordSalt)
+	return &realm, nil
 }
 
 // GetUsers function for getting all Realm User
@@ -92,25 +163,72 @@ func (mn *FileDataManager) GetRealm(realmName string) (*data.Realm, error) {
  *     - realmName - name of a realm
  * Returns: slice of users and error
  */
-func (mn *FileDataManager) GetUsers(realmName string) ([]data.User, error) {
+func (mn *FileDataManager) GetUsers(ctx context.Context, realmName string) ([]data.User, error) {
 	if !mn.IsAvailable() {
 		return nil, errors.NewDataProviderNotAvailable(string(config.FILE), mn.dataFile)
 	}
-	for _, e := range mn.serverData.Realms {
-		// case-sensitive comparison, myapp and MyApP are different realms
-		if e.Name == realmName {
-			if len(e.Users) == 0 {
-				return nil, errors.ErrZeroLength
-			}
-			users := make([]data.User, len(e.Users))
-			for i, u := range e.Users {
-				user := data.CreateUser(u, nil)
-				users[i] = user
-			}
-			return users, nil
-		}
+	mn.mutex.RLock()
+	defer mn.mutex.RUnlock()
+	index := mn.findRealm(realmName)
+	if index < 0 {
+		return nil, errors.NewObjectNotFoundError(string(User), "", sf.Format("get realm: {0} users", realmName))
 	}
-	return nil, errors.NewObjectNotFoundError(string(User), "", sf.Format("get realm: {0} users", realmName))
+	realmUsers := mn.serverData.Realms[index].Users
+	if len(realmUsers) == 0 {
+		return nil, errors.ErrZeroLength
+	}
+	users := make([]data.User, len(realmUsers))
+	for i, u := range realmUsers {
+		users[i] = data.CreateUser(cloneRawUser(u), nil)
+	}
+	return users, nil
+}
+
+// ListUsers function for getting page of realm users ordered by username
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - page - requested page
+ * Returns: page of users and error
+ */
+func (mn *FileDataManager) ListUsers(ctx context.Context, realmName string, page data.PageRequest) (*data.UsersPage, error) {
+	return mn.SearchUsers(ctx, realmName, data.UsersFilter{}, page)
+}
+
+// SearchUsers function for getting page of realm users that match filter ordered by username
+/* All users are in memory, therefore this function filters all realm users (see GetUsers)
+ * Parameters:
+ *     - realmName - name of a realm
+ *     - filter - search criteria
+ *     - page - requested page
+ * Returns: page of users and error
+ */
+func (mn *FileDataManager) SearchUsers(ctx context.Context, realmName string, filter data.UsersFilter, page data.PageRequest) (*data.UsersPage, error) {
+	users, err := mn.GetUsers(ctx, realmName)
+	if err != nil && !e.Is(err, errors.ErrZeroLength) {
+		return nil, err
+	}
+	return data.GetUsersPage(users, &filter, page)
+}
+
+// GetClients function for getting all Realm Clients
+/* This function get realm by name and extract all its clients
+ * Parameters:
+ *     - realmName - name of a realm
+ * Returns: slice of clients and error
+ */
+func (mn *FileDataManager) GetClients(ctx context.Context, realmName string) ([]data.Client, error) {
+	if !mn.IsAvailable() {
+		return nil, errors.NewDataProviderNotAvailable(string(config.FILE), mn.dataFile)
+	}
+	realm, err := mn.GetRealm(ctx, realmName)
+	if err != nil {
+		mn.logger.Warn(sf.Format("GetRealm failed: {0}", err.Error()))
+		return nil, err
+	}
+	if len(realm.Clients) == 0 {
+		return nil, errors.ErrZeroLength
+	}
+	return realm.Clients, nil
 }
 
 // GetClient function for getting Realm Client by name
@@ -120,11 +238,11 @@ func (mn *FileDataManager) GetUsers(realmName string) ([]data.User, error) {
  *     - clientName - name of a client
  * Returns: Client and error
  */
-func (mn *FileDataManager) GetClient(realmName string, clientName string) (*data.Client, error) {
+func (mn *FileDataManager) GetClient(ctx context.Context, realmName string, clientName string) (*data.Client, error) {
 	if !mn.IsAvailable() {
 		return nil, errors.NewDataProviderNotAvailable(string(config.FILE), mn.dataFile)
 	}
-	realm, err := mn.GetRealm(realmName)
+	realm, err := mn.GetRealm(ctx, realmName)
 	if err != nil {
 		mn.logger.Warn(sf.Format("GetRealm failed: {0}", err.Error()))
 		return nil, err
@@ -145,119 +263,553 @@ func (mn *FileDataManager) GetClient(realmName string, clientName string) (*data
  *     - userName - name of a user
  * Returns: User and error
  */
-func (mn *FileDataManager) GetUser(realmName string, userName string) (data.User, error) {
+func (mn *FileDataManager) GetUser(ctx context.Context, realmName string, userName string) (data.User, error) {
 	if !mn.IsAvailable() {
 		return data.User(nil), errors.NewDataProviderNotAvailable(string(config.FILE), mn.dataFile)
 	}
-	users, err := mn.GetUsers(realmName)
+	user, err := mn.findUser(realmName, func(u data.User) bool { return u.GetUsername() == userName })
 	if err != nil {
 		mn.logger.Warn(sf.Format("GetUsers failed: {0}", err.Error()))
 		return nil, err
 	}
-	for _, u := range users {
-		if u.GetUsername() == userName {
-			return u, nil
-		}
+	if user == nil {
+		return nil, errors.NewObjectNotFoundError(string(User), userName, sf.Format("realm: {0}", realmName))
 	}
-	return nil, errors.NewObjectNotFoundError(string(User), userName, sf.Format("realm: {0}", realmName))
+	return user, nil
 }
 
 // GetUserById function for getting Realm User by UserId (uuid)
 /* same functions as GetUser but uses userId to search instead of username, works by sequential iteration
  */
-func (mn *FileDataManager) GetUserById(realmName string, userId uuid.UUID) (data.User, error) {
+func (mn *FileDataManager) GetUserById(ctx context.Context, realmName string, userId uuid.UUID) (data.User, error) {
 	if !mn.IsAvailable() {
 		return data.User(nil), errors.NewDataProviderNotAvailable(string(config.FILE), mn.dataFile)
 	}
-	users, err := mn.GetUsers(realmName)
+	user, err := mn.findUser(realmName, func(u data.User) bool { return u.GetId() == userId })
 	if err != nil {
 		mn.logger.Warn(sf.Format("GetUsers failed: {0}", err.Error()))
 		return nil, err
 	}
-	for _, u := range users {
-		if u.GetId() == userId {
-			return u, nil
-		}
+	if user == nil {
+		return nil, errors.NewObjectNotFoundError(string(User), userId.String(), sf.Format("realm: {0}", realmName))
 	}
-	return nil, errors.NewObjectNotFoundError(string(User), userId.String(), sf.Format("realm: {0}", realmName))
+	return user, nil
 }
 
 // CreateRealm creates new data.Realm in a data store, receive realmData unmarshalled json in a data.Realm
-/*
- *
+/* Realm is created with its clients, users and user federation configs. As RedisDataManager does, it generates new realm
+ * password salt and hashes users passwords with it. Realm, its clients and users get version 1, realm and clients get the first
+ * revision.
+ * Parameters:
+ *     - realmData - newly creating realm
+ * Returns: error (errors.ObjectAlreadyExistsError if realm with same name exists)
  */
-func (mn *FileDataManager) CreateRealm(realmData data.Realm) error {
-	return errors.ErrOperationNotImplemented
+func (mn *FileDataManager) CreateRealm(ctx context.Context, realmData data.Realm) error {
+	salt := encoding.GenerateRandomSalt()
+	return mn.createRealm(ctx, realmData, salt, encoding.NewPasswordJsonEncoder(salt), "FileDataManager.CreateRealm")
+}
+
+// ImportRealm creates a realm as it is: realm password salt and versions are kept and users are stored without passwords hashing
+/* It is using for a data store seeding (see managers.RealmImporter), passwords must be already hashed with realm salt
+ * Parameters:
+ *     - realmData - realm with clients, users and user federation configs
+ * Returns: error (errors.ObjectAlreadyExistsError if realm with same name exists)
+ */
+func (mn *FileDataManager) ImportRealm(ctx context.Context, realmData data.Realm) error {
+	return mn.createRealm(ctx, realmData, realmData.PasswordSalt, nil, "FileDataManager.ImportRealm")
+}
+
+// createRealm adds realm with password salt = salt, users passwords are hashed with encoder and realm, clients and users get
+// version 1 (realm is imported as is if encoder is nil)
+func (mn *FileDataManager) createRealm(ctx context.Context, realmData data.Realm, salt string, encoder *encoding.PasswordJsonEncoder,
+	method string,
+) error {
+	mn.mutex.Lock()
+	defer mn.mutex.Unlock()
+	if mn.findRealm(realmData.Name) >= 0 {
+		return errors.NewObjectExistsError(string(Realm), realmData.Name, "")
+	}
+	realm := realmData
+	realm.PasswordSalt = salt
+	realm.Encoder = nil
+	realm.Clients = slices.Clone(realmData.Clients)
+	realm.UserFederationServices = slices.Clone(realmData.UserFederationServices)
+	realm.Users = make([]interface{}, len(realmData.Users))
+	for i, u := range realmData.Users {
+		user := data.CreateUser(cloneRawUser(u), encoder)
+		if encoder != nil {
+			user.SetVersion(1)
+		}
+		realm.Users[i] = user.GetRawData()
+	}
+	revisions := mn.serverData.Revisions
+	if encoder != nil {
+		realm.Version = 1
+		revision, err := data.CreateRealmRevision(ctx, &realm)
+		if err != nil {
+			return errors.NewUnknownError("CreateRealmRevision", method, err)
+		}
+		revisions = mn.addRevision(revisions, nil, revision)
+		for i := range realm.Clients {
+			realm.Clients[i].Version = 1
+			if revision, err = data.CreateClientRevision(ctx, realm.Name, &realm.Clients[i]); err != nil {
+				return errors.NewUnknownError("CreateClientRevision", method, err)
+			}
+			revisions = mn.addRevision(revisions, nil, revision)
+		}
+	}
+	realms := append(slices.Clone(mn.serverData.Realms), realm)
+	return mn.commit(realms, revisions, method)
 }
 
 // CreateClient creates new data.Client in a data store, requires to pass realmName (because client name is not unique), clientData is an unmarshalled json of type data.Client
-func (mn *FileDataManager) CreateClient(realmName string, clientData data.Client) error {
-	return errors.ErrOperationNotImplemented
+func (mn *FileDataManager) CreateClient(ctx context.Context, realmName string, clientData data.Client) error {
+	return mn.changeRealmAndRevisions(realmName, "FileDataManager.CreateClient", func(realm *data.Realm, revisions *[]data.Revision) error {
+		if slices.IndexFunc(realm.Clients, func(c data.Client) bool { return c.Name == clientData.Name }) >= 0 {
+			return errors.NewObjectExistsError(string(Client), clientData.Name, sf.Format("realm: {0}", realmName))
+		}
+		clientData.Version = 1
+		realm.Clients = append(slices.Clone(realm.Clients), clientData)
+		revision, err := data.CreateClientRevision(ctx, realmName, &clientData)
+		if err != nil {
+			return errors.NewUnknownError("CreateClientRevision", "FileDataManager.CreateClient", err)
+		}
+		*revisions = mn.addRevision(*revisions, nil, revision)
+		return nil
+	})
 }
 
 // CreateUser creates new data.User in a data store within a realm with name = realmName
-func (mn *FileDataManager) CreateUser(realmName string, userData data.User) error {
-	return errors.ErrOperationNotImplemented
+/* As RedisDataManager does, it stores user as is, therefore password must be hashed before (i.e. data.CreateUser with realm encoder)
+ */
+func (mn *FileDataManager) CreateUser(ctx context.Context, realmName string, userData data.User) error {
+	return mn.changeRealm(realmName, "FileDataManager.CreateUser", func(realm *data.Realm) error {
+		userName := userData.GetUsername()
+		if findRawUser(realm.Users, userName) >= 0 {
+			return errors.NewObjectExistsError(string(User), userName, sf.Format("realm: {0}", realmName))
+		}
+		realm.Users = append(slices.Clone(realm.Users), data.CreateUserWithVersion(userData, 1).GetRawData())
+		return nil
+	})
 }
 
 // UpdateRealm updates existing data.Realm in a data store within name = realmData, and new data = realmData
-func (mn *FileDataManager) UpdateRealm(realmName string, realmData data.Realm) error {
-	return errors.ErrOperationNotImplemented
+/* Only realm settings are updated, realm clients, users and user federation configs are kept (as RedisDataManager does they
+ * should be changed separately), password salt is never changed, otherwise stored passwords hashes become invalid.
+ * Realm could be renamed if there is no realm with a new name. Update fails with errors.ObjectVersionConflictError if
+ * realmData.Version is set and differs from stored realm version (see data.CheckVersion). Realm revision is added to realm history.
+ */
+func (mn *FileDataManager) UpdateRealm(ctx context.Context, realmName string, realmData data.Realm) error {
+	mn.mutex.Lock()
+	defer mn.mutex.Unlock()
+	index := mn.findRealm(realmName)
+	if index < 0 {
+		return errors.NewObjectNotFoundError(string(Realm), realmName, "")
+	}
+	if realmData.Name != realmName && mn.findRealm(realmData.Name) >= 0 {
+		return errors.NewObjectExistsError(string(Realm), realmData.Name, "")
+	}
+	oldRealm := mn.serverData.Realms[index]
+	if err := data.CheckVersion(string(Realm), realmName, oldRealm.Version, realmData.Version); err != nil {
+		return err
+	}
+	realm := realmData
+	realm.Version = oldRealm.Version + 1
+	realm.Clients = oldRealm.Clients
+	realm.Users = oldRealm.Users
+	realm.UserFederationServices = oldRealm.UserFederationServices
+	realm.PasswordSalt = oldRealm.PasswordSalt
+	realm.Encoder = nil
+	realms := slices.Clone(mn.serverData.Realms)
+	realms[index] = realm
+	revisions := mn.serverData.Revisions
+	if realm.Name != realmName {
+		revisions = renameRealmRevisions(revisions, realmName, realm.Name)
+	}
+	previous, err := data.CreateRealmRevision(ctx, &oldRealm)
+	if err != nil {
+		return errors.NewUnknownError("CreateRealmRevision", "FileDataManager.UpdateRealm", err)
+	}
+	revision, err := data.CreateRealmRevision(ctx, &realm)
+	if err != nil {
+		return errors.NewUnknownError("CreateRealmRevision", "FileDataManager.UpdateRealm", err)
+	}
+	revisions = mn.addRevision(revisions, &previous, revision)
+	return mn.commit(realms, revisions, "FileDataManager.UpdateRealm")
 }
 
 // UpdateClient updates existing data.Client in a data store with name = clientName and new data = clientData
-func (mn *FileDataManager) UpdateClient(realmName string, clientName string, clientData data.Client) error {
-	return errors.ErrOperationNotImplemented
+/* Update fails with errors.ObjectVersionConflictError if clientData.Version is set and differs from stored client version.
+ * Client revision is added to client history, history of renamed client is moved to its new name
+ */
+func (mn *FileDataManager) UpdateClient(ctx context.Context, realmName string, clientName string, clientData data.Client) error {
+	return mn.changeRealmAndRevisions(realmName, "FileDataManager.UpdateClient", func(realm *data.Realm, revisions *[]data.Revision) error {
+		index := slices.IndexFunc(realm.Clients, func(c data.Client) bool { return c.Name == clientName })
+		if index < 0 {
+			return errors.NewObjectNotFoundError(string(Client), clientName, sf.Format("realm: {0}", realmName))
+		}
+		if clientData.Name != clientName && slices.IndexFunc(realm.Clients, func(c data.Client) bool { return c.Name == clientData.Name }) >= 0 {
+			return errors.NewObjectExistsError(string(Client), clientData.Name, sf.Format("realm: {0}", realmName))
+		}
+		if err := data.CheckVersion(string(Client), clientName, realm.Clients[index].Version, clientData.Version); err != nil {
+			return err
+		}
+		clientData.Version = realm.Clients[index].Version + 1
+		previous, err := data.CreateClientRevision(ctx, realmName, &realm.Clients[index])
+		if err != nil {
+			return errors.NewUnknownError("CreateClientRevision", "FileDataManager.UpdateClient", err)
+		}
+		revision, err := data.CreateClientRevision(ctx, realmName, &clientData)
+		if err != nil {
+			return errors.NewUnknownError("CreateClientRevision", "FileDataManager.UpdateClient", err)
+		}
+		realm.Clients = slices.Clone(realm.Clients)
+		realm.Clients[index] = clientData
+		if clientData.Name != clientName {
+			history := getObjectRevisions(*revisions, realmName, data.ClientRevision, clientName)
+			*revisions = setObjectRevisions(*revisions, realmName, data.ClientRevision, clientName, nil)
+			*revisions = setObjectRevisions(*revisions, realmName, data.ClientRevision, clientData.Name, history)
+		}
+		*revisions = mn.addRevision(*revisions, &previous, revision)
+		return nil
+	})
 }
 
 // UpdateUser updates existing data.User in a data store with realm name = realName, username = userName and data=userData
-func (mn *FileDataManager) UpdateUser(realmName string, userName string, userData data.User) error {
-	return errors.ErrOperationNotImplemented
+/* Update fails with errors.ObjectVersionConflictError if userData version is set and differs from stored user version
+ */
+func (mn *FileDataManager) UpdateUser(ctx context.Context, realmName string, userName string, userData data.User) error {
+	return mn.changeRealm(realmName, "FileDataManager.UpdateUser", func(realm *data.Realm) error {
+		index := findRawUser(realm.Users, userName)
+		if index < 0 {
+			return errors.NewObjectNotFoundError(string(User), userName, sf.Format("realm: {0}", realmName))
+		}
+		newUserName := userData.GetUsername()
+		if newUserName != userName && findRawUser(realm.Users, newUserName) >= 0 {
+			return errors.NewObjectExistsError(string(User), newUserName, sf.Format("realm: {0}", realmName))
+		}
+		storedVersion := data.CreateUser(realm.Users[index], nil).GetVersion()
+		if err := data.CheckVersion(string(User), userName, storedVersion, userData.GetVersion()); err != nil {
+			return err
+		}
+		realm.Users = slices.Clone(realm.Users)
+		realm.Users[index] = data.CreateUserWithVersion(userData, storedVersion+1).GetRawData()
+		return nil
+	})
 }
 
-// DeleteRealm removes realm from data storage (Should be a CASCADE remove of all related Users and Clients)
-func (mn *FileDataManager) DeleteRealm(realmName string) error {
-	return errors.ErrOperationNotImplemented
+// SetPassword sets (hashes with realm encoder) new password of user with username = userName, user version is incremented
+func (mn *FileDataManager) SetPassword(ctx context.Context, realmName string, userName string, password string) error {
+	return mn.changeRealm(realmName, "FileDataManager.SetPassword", func(realm *data.Realm) error {
+		index := findRawUser(realm.Users, userName)
+		if index < 0 {
+			return errors.NewObjectNotFoundError(string(User), userName, sf.Format("realm: {0}", realmName))
+		}
+		user := data.CreateUser(cloneRawUser(realm.Users[index]), nil)
+		if err := user.SetPassword(password, encoding.NewPasswordJsonEncoder(realm.PasswordSalt)); err != nil {
+			return errors.NewUnknownError("SetPassword", "FileDataManager.SetPassword", err)
+		}
+		user.SetVersion(user.GetVersion() + 1)
+		realm.Users = slices.Clone(realm.Users)
+		realm.Users[index] = user.GetRawData()
+		return nil
+	})
 }
 
-// DeleteClient removes client with name = clientName from realm with name = clientName
-func (mn *FileDataManager) DeleteClient(realmName string, clientName string) error {
-	return errors.ErrOperationNotImplemented
+// DeleteRealm removes realm from data storage (Should be a CASCADE remove of all related Users and Clients) with realm history
+func (mn *FileDataManager) DeleteRealm(ctx context.Context, realmName string) error {
+	mn.mutex.Lock()
+	defer mn.mutex.Unlock()
+	index := mn.findRealm(realmName)
+	if index < 0 {
+		return errors.NewObjectNotFoundError(string(Realm), realmName, "")
+	}
+	realms := slices.Delete(slices.Clone(mn.serverData.Realms), index, index+1)
+	revisions := slices.DeleteFunc(slices.Clone(mn.serverData.Revisions), func(r data.Revision) bool { return r.Realm == realmName })
+	return mn.commit(realms, revisions, "FileDataManager.DeleteRealm")
+}
+
+// DeleteClient removes client with name = clientName from realm with name = clientName with client history
+func (mn *FileDataManager) DeleteClient(ctx context.Context, realmName string, clientName string) error {
+	return mn.changeRealmAndRevisions(realmName, "FileDataManager.DeleteClient", func(realm *data.Realm, revisions *[]data.Revision) error {
+		index := slices.IndexFunc(realm.Clients, func(c data.Client) bool { return c.Name == clientName })
+		if index < 0 {
+			return errors.NewObjectNotFoundError(string(Client), clientName, sf.Format("realm: {0}", realmName))
+		}
+		realm.Clients = slices.Delete(slices.Clone(realm.Clients), index, index+1)
+		*revisions = setObjectRevisions(*revisions, realmName, data.ClientRevision, clientName, nil)
+		return nil
+	})
 }
 
 // DeleteUser removes data.User from data store by user (userName) and realm (realmName) name respectively
-func (mn *FileDataManager) DeleteUser(realmName string, userName string) error {
-	return errors.ErrOperationNotImplemented
+func (mn *FileDataManager) DeleteUser(ctx context.Context, realmName string, userName string) error {
+	return mn.changeRealm(realmName, "FileDataManager.DeleteUser", func(realm *data.Realm) error {
+		index := findRawUser(realm.Users, userName)
+		if index < 0 {
+			return errors.NewObjectNotFoundError(string(User), userName, sf.Format("realm: {0}", realmName))
+		}
+		realm.Users = slices.Delete(slices.Clone(realm.Users), index, index+1)
+		return nil
+	})
+}
+
+// GetUserFederationConfigs returns all realm user federation configs (realm without configs returns errors.ErrZeroLength)
+func (mn *FileDataManager) GetUserFederationConfigs(ctx context.Context, realmName string) ([]data.UserFederationServiceConfig, error) {
+	realm, err := mn.GetRealm(ctx, realmName)
+	if err != nil {
+		return nil, err
+	}
+	if len(realm.UserFederationServices) == 0 {
+		return nil, errors.ErrZeroLength
+	}
+	return realm.UserFederationServices, nil
+}
+
+// GetUserFederationConfig returns realm user federation config by name
+func (mn *FileDataManager) GetUserFederationConfig(ctx context.Context, realmName string, configName string) (*data.UserFederationServiceConfig, error) {
+	realm, err := mn.GetRealm(ctx, realmName)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range realm.UserFederationServices {
+		if c.Name == configName {
+			return &c, nil
+		}
+	}
+	return nil, errors.NewObjectNotFoundError(string(UserFederationConfig), configName, sf.Format("realm: {0}", realmName))
+}
+
+// CreateUserFederationConfig creates new user federation config in a realm with name = realmName
+func (mn *FileDataManager) CreateUserFederationConfig(ctx context.Context, realmName string, userFederationConfig data.UserFederationServiceConfig) error {
+	return mn.changeRealm(realmName, "FileDataManager.CreateUserFederationConfig", func(realm *data.Realm) error {
+		if findUserFederationConfig(realm.UserFederationServices, userFederationConfig.Name) >= 0 {
+			return errors.NewObjectExistsError(string(UserFederationConfig), userFederationConfig.Name, sf.Format("realm: {0}", realmName))
+		}
+		realm.UserFederationServices = append(slices.Clone(realm.UserFederationServices), userFederationConfig)
+		return nil
+	})
+}
+
+// UpdateUserFederationConfig updates existing user federation config with name = configName
+func (mn *FileDataManager) UpdateUserFederationConfig(ctx context.Context, realmName string, configName string, userFederationConfig data.UserFederationServiceConfig) error {
+	return mn.changeRealm(realmName, "FileDataManager.UpdateUserFederationConfig", func(realm *data.Realm) error {
+		index := findUserFederationConfig(realm.UserFederationServices, configName)
+		if index < 0 {
+			return errors.NewObjectNotFoundError(string(UserFederationConfig), configName, sf.Format("realm: {0}", realmName))
+		}
+		if userFederationConfig.Name != configName && findUserFederationConfig(realm.UserFederationServices, userFederationConfig.Name) >= 0 {
+			return errors.NewObjectExistsError(string(UserFederationConfig), userFederationConfig.Name, sf.Format("realm: {0}", realmName))
+		}
+		realm.UserFederationServices = slices.Clone(realm.UserFederationServices)
+		realm.UserFederationServices[index] = userFederationConfig
+		return nil
+	})
+}
+
+// DeleteUserFederationConfig removes user federation config with name = configName
+func (mn *FileDataManager) DeleteUserFederationConfig(ctx context.Context, realmName string, configName string) error {
+	return mn.changeRealm(realmName, "FileDataManager.DeleteUserFederationConfig", func(realm *data.Realm) error {
+		index := findUserFederationConfig(realm.UserFederationServices, configName)
+		if index < 0 {
+			return errors.NewObjectNotFoundError(string(UserFederationConfig), configName, sf.Format("realm: {0}", realmName))
+		}
+		realm.UserFederationServices = slices.Delete(slices.Clone(realm.UserFederationServices), index, index+1)
+		return nil
+	})
+}
+
+// GetOfflineSession is not supported by FileDataManager, offline sessions are not stored in a data file
+func (mn *FileDataManager) GetOfflineSession(ctx context.Context, realmName string, sessionId uuid.UUID) (*data.OfflineSession, error) {
+	return nil, errors.ErrOperationNotImplemented
 }
 
-func (mn *FileDataManager) GetUserFederationConfig(realmName string, configName string) (*data.UserFederationServiceConfig, error) {
+// GetUserOfflineSessions is not supported by FileDataManager
+func (mn *FileDataManager) GetUserOfflineSessions(ctx context.Context, realmName string, userId uuid.UUID) ([]data.OfflineSession, error) {
 	return nil, errors.ErrOperationNotImplemented
 }
 
-func (mn *FileDataManager) CreateUserFederationConfig(realmName string, userFederationConfig data.UserFederationServiceConfig) error {
+// CreateOfflineSession is not supported by FileDataManager
+func (mn *FileDataManager) CreateOfflineSession(ctx context.Context, realmName string, session data.OfflineSession) error {
 	return errors.ErrOperationNotImplemented
 }
 
-func (mn *FileDataManager) UpdateUserFederationConfig(realmName string, configName string, userFederationConfig data.UserFederationServiceConfig) error {
+// UpdateOfflineSession is not supported by FileDataManager
+func (mn *FileDataManager) UpdateOfflineSession(ctx context.Context, realmName string, session data.OfflineSession) error {
 	return errors.ErrOperationNotImplemented
 }
 
-func (mn *FileDataManager) DeleteUserFederationConfig(realmName string, configName string) error {
+// DeleteOfflineSession is not supported by FileDataManager
+func (mn *FileDataManager) DeleteOfflineSession(ctx context.Context, realmName string, sessionId uuid.UUID) error {
 	return errors.ErrOperationNotImplemented
 }
 
 // loadData this function loads data from JSON file (dataFile) to serverData
 func (mn *FileDataManager) loadData() error {
-	rawData, err := os.ReadFile(mn.dataFile)
+	serverData, state, err := mn.readData()
+	if err != nil {
+		return err
+	}
+	mn.serverData = *serverData
+	mn.dataFileState = state
+	return nil
+}
+
+// changeRealm applies change to a copy of realm with name = realmName and commits realms with changed realm
+/* change must not modify realm slices in place (it must clone them), if change returns error nothing is changed
+ * Parameters:
+ *     - realmName - name of a changing realm
+ *     - method - name of a calling method for errors
+ *     - change - function that changes realm copy
+ * Returns: error (errors.ObjectNotFoundError if realm doesn't exist)
+ */
+func (mn *FileDataManager) changeRealm(realmName string, method string, change func(realm *data.Realm) error) error {
+	return mn.changeRealmAndRevisions(realmName, method, func(realm *data.Realm, _ *[]data.Revision) error {
+		return change(realm)
+	})
+}
+
+// changeRealmAndRevisions is changeRealm that also changes revisions, change must not modify revisions slice in place (see addRevision)
+func (mn *FileDataManager) changeRealmAndRevisions(realmName string, method string,
+	change func(realm *data.Realm, revisions *[]data.Revision) error,
+) error {
+	mn.mutex.Lock()
+	defer mn.mutex.Unlock()
+	index := mn.findRealm(realmName)
+	if index < 0 {
+		return errors.NewObjectNotFoundError(string(Realm), realmName, "")
+	}
+	realm := mn.serverData.Realms[index]
+	revisions := mn.serverData.Revisions
+	if err := change(&realm, &revisions); err != nil {
+		return err
+	}
+	realms := slices.Clone(mn.serverData.Realms)
+	realms[index] = realm
+	return mn.commit(realms, revisions, method)
+}
+
+// findUser returns copy of first realm user that matches or nil if there is no such user
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - match - user predicate, it receives stored user that must not be changed
+ * Returns: user copy and error (errors.ObjectNotFoundError if realm doesn't exist, errors.ErrZeroLength if realm has no users)
+ */
+func (mn *FileDataManager) findUser(realmName string, match func(u data.User) bool) (data.User, error) {
+	mn.mutex.RLock()
+	defer mn.mutex.RUnlock()
+	index := mn.findRealm(realmName)
+	if index < 0 {
+		return nil, errors.NewObjectNotFoundError(string(User), "", sf.Format("get realm: {0} users", realmName))
+	}
+	realmUsers := mn.serverData.Realms[index].Users
+	if len(realmUsers) == 0 {
+		return nil, errors.ErrZeroLength
+	}
+	for _, u := range realmUsers {
+		if match(data.CreateUser(u, nil)) {
+			return data.CreateUser(cloneRawUser(u), nil), nil
+		}
+	}
+	return nil, nil
+}
+
+// findRealm returns index of realm with name = realmName in serverData or -1, it must be called under mutex
+func (mn *FileDataManager) findRealm(realmName string) int {
+	// case-sensitive comparison, myapp and MyApP are different realms
+	return slices.IndexFunc(mn.serverData.Realms, func(r data.Realm) bool { return r.Name == realmName })
+}
+
+// findRawUser returns index of user with username = userName in realm users raw data or -1
+func findRawUser(users []interface{}, userName string) int {
+	return slices.IndexFunc(users, func(u interface{}) bool { return data.CreateUser(u, nil).GetUsername() == userName })
+}
+
+// findUserFederationConfig returns index of config with name = configName or -1
+func findUserFederationConfig(configs []data.UserFederationServiceConfig, configName string) int {
+	return slices.IndexFunc(configs, func(c data.UserFederationServiceConfig) bool { return c.Name == configName })
+}
+
+// cloneRawUser makes deep copy of user raw data, therefore stored users are not affected by changes of returned (or passed) users
+func cloneRawUser(rawUser interface{}) interface{} {
+	userJson, err := json.Marshal(rawUser)
 	if err != nil {
-		mn.logger.Error(sf.Format("An error occurred during config file reading: {0}", err.Error()))
-		return errors.NewUnknownError("os.ReadFile", "FileDataManager.loadData", err)
+		return rawUser
+	}
+	var clone interface{}
+	if err = json.Unmarshal(userJson, &clone); err != nil {
+		return rawUser
 	}
-	mn.serverData = data.ServerData{}
-	if err = json.Unmarshal(rawData, &mn.serverData); err != nil {
-		mn.logger.Error(sf.Format("An error occurred during data file unmarshal: {0}", err.Error()))
-		return errors.NewUnknownError("json.Unmarshal", "FileDataManager.loadData", err)
+	return clone
+}
+
+// GetRevisions returns revisions of realm or realm client (see managers.RevisionsKeeper)
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - objectType - data.RealmRevision or data.ClientRevision
+ *     - objectName - name of a client (not used for realm)
+ * Returns: revisions ordered by version (empty slice if object doesn't have revisions) and error (errors.ObjectNotFoundError
+ * if realm doesn't exist)
+ */
+func (mn *FileDataManager) GetRevisions(ctx context.Context, realmName string, objectType data.RevisionObjectType, objectName string,
+) ([]data.Revision, error) {
+	if !mn.IsAvailable() {
+		return nil, errors.NewDataProviderNotAvailable(string(config.FILE), mn.dataFile)
 	}
+	mn.mutex.RLock()
+	defer mn.mutex.RUnlock()
+	if mn.findRealm(realmName) < 0 {
+		return nil, errors.NewObjectNotFoundError(string(Realm), realmName, "")
+	}
+	if objectType == data.RealmRevision {
+		objectName = ""
+	}
+	return getObjectRevisions(mn.serverData.Revisions, realmName, objectType, objectName), nil
+}
 
-	return nil
+// addRevision adds revision to history of changed object (see data.AddRevision), it returns new revisions (revisions itself are not changed)
+func (mn *FileDataManager) addRevision(revisions []data.Revision, previous *data.Revision, revision data.Revision) []data.Revision {
+	if mn.revisionsLimit <= 0 {
+		return revisions
+	}
+	history := getObjectRevisions(revisions, revision.Realm, revision.ObjectType, revision.ObjectName)
+	history = data.AddRevision(history, previous, revision, mn.revisionsLimit)
+	return setObjectRevisions(revisions, revision.Realm, revision.ObjectType, revision.ObjectName, history)
+}
+
+// getObjectRevisions returns copy of object revisions (revisions of realm object doesn't have name)
+func getObjectRevisions(revisions []data.Revision, realmName string, objectType data.RevisionObjectType, objectName string) []data.Revision {
+	history := make([]data.Revision, 0)
+	for _, r := range revisions {
+		if r.Realm == realmName && r.ObjectType == objectType && r.ObjectName == objectName {
+			history = append(history, r)
+		}
+	}
+	return history
+}
+
+// setObjectRevisions returns copy of revisions where object revisions are replaced by history (revisions itself are not changed)
+func setObjectRevisions(revisions []data.Revision, realmName string, objectType data.RevisionObjectType, objectName string,
+	history []data.Revision,
+) []data.Revision {
+	newRevisions := slices.DeleteFunc(slices.Clone(revisions), func(r data.Revision) bool {
+		return r.Realm == realmName && r.ObjectType == objectType && r.ObjectName == objectName
+	})
+	for _, r := range history {
+		r.Realm = realmName
+		r.ObjectName = objectName
+		newRevisions = append(newRevisions, r)
+	}
+	return newRevisions
+}
+
+// renameRealmRevisions returns copy of revisions where revisions of realm and its clients are moved to realm with a new name
+func renameRealmRevisions(revisions []data.Revision, realmName string, newRealmName string) []data.Revision {
+	newRevisions := slices.Clone(revisions)
+	for i := range newRevisions {
+		if newRevisions[i].Realm == realmName {
+			newRevisions[i].Realm = newRealmName
+		}
+	}
+	return newRevisions
 }
@@ -1,15 +1,25 @@
 package files
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/wissance/Ferrum/config"
 	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
 	"github.com/wissance/Ferrum/logging"
+	"github.com/wissance/Ferrum/utils/encoding"
+	sf "github.com/wissance/stringFormatter"
 )
 
 const testDataFile = "test_data.json"
@@ -21,7 +31,7 @@ func TestGetRealmSuccessfully(t *testing.T) {
 		TokenExpiration:        330,
 		RefreshTokenExpiration: 200,
 	}
-	r, err := manager.GetRealm("myapp")
+	r, err := manager.GetRealm(context.Background(), "myapp")
 	assert.NoError(t, err)
 	checkRealm(t, &expectedRealm, r)
 }
@@ -40,11 +50,21 @@ func TestGetClientSuccessfully(t *testing.T) {
 		},
 	}
 
-	c, err := manager.GetClient(realm, expectedClient.Name)
+	c, err := manager.GetClient(context.Background(), realm, expectedClient.Name)
 	assert.NoError(t, err)
 	checkClient(t, &expectedClient, c)
 }
 
+func TestGetClientsSuccessfully(t *testing.T) {
+	manager := createTestFileDataManager(t)
+	clients, err := manager.GetClients(context.Background(), "myapp")
+	assert.NoError(t, err)
+	require.Equal(t, 1, len(clients))
+	assert.Equal(t, "test-service-app-client", clients[0].Name)
+	_, err = manager.GetClients(context.Background(), "unknown")
+	assert.Error(t, err)
+}
+
 func TestGetUserSuccessfully(t *testing.T) {
 	manager := createTestFileDataManager(t)
 	realm := "myapp"
@@ -69,7 +89,7 @@ func TestGetUserSuccessfully(t *testing.T) {
 	err := json.Unmarshal([]byte(userJson), &rawUser)
 	assert.NoError(t, err)
 	expectedUser := data.CreateUser(rawUser, nil)
-	user, err := manager.GetUser(realm, userName)
+	user, err := manager.GetUser(context.Background(), realm, userName)
 	assert.NoError(t, err)
 	checkUser(t, &expectedUser, &user)
 }
@@ -98,21 +118,472 @@ func TestGetUserByIdSuccessfully(t *testing.T) {
 	err := json.Unmarshal([]byte(userJson), &rawUser)
 	assert.NoError(t, err)
 	expectedUser := data.CreateUser(rawUser, nil)
-	user, err := manager.GetUserById(realm, userId)
+	user, err := manager.GetUserById(context.Background(), realm, userId)
 	assert.NoError(t, err)
 	checkUser(t, &expectedUser, &user)
 }
 
+func TestChangesArePersistedToDataFile(t *testing.T) {
+	dataFile := copyTestDataFile(t)
+	manager := createFileDataManager(t, dataFile, 0)
+	realm := "myapp"
+	clientId := uuid.New()
+	client := data.Client{ID: clientId, Name: "new-client", Type: data.Public}
+	require.NoError(t, manager.CreateClient(context.Background(), realm, client))
+	assert.Error(t, manager.CreateClient(context.Background(), realm, client))
+	var rawUser interface{}
+	err := json.Unmarshal([]byte(`{"info": {"sub": "2e8a4a1b-5c9d-4f0e-8d7a-6b3c2a1f0e9d", "preferred_username": "newuser"},
+                                   "credentials": {"password": "qwerty"}}`), &rawUser)
+	require.NoError(t, err)
+	require.NoError(t, manager.CreateUser(context.Background(), realm, data.CreateUser(rawUser, nil)))
+	require.NoError(t, manager.SetPassword(context.Background(), realm, "newuser", "1234567890"))
+	require.NoError(t, manager.DeleteUser(context.Background(), realm, "admin"))
+	require.NoError(t, manager.CreateRealm(context.Background(), data.Realm{Name: "newrealm", TokenExpiration: 100, RefreshTokenExpiration: 50}))
+	require.NoError(t, manager.UpdateRealm(context.Background(), "newrealm", data.Realm{Name: "renamed", TokenExpiration: 200}))
+	require.NoError(t, manager.CreateUserFederationConfig(context.Background(), "renamed", data.UserFederationServiceConfig{Name: "ldap", Type: data.LDAP}))
+
+	// new manager reads all changes from data file
+	reloaded := createFileDataManager(t, dataFile, 0)
+	c, err := reloaded.GetClient(context.Background(), realm, client.Name)
+	require.NoError(t, err)
+	checkClient(t, &client, c)
+	user, err := reloaded.GetUser(context.Background(), realm, "newuser")
+	require.NoError(t, err)
+	realmData, err := reloaded.GetRealm(context.Background(), realm)
+	require.NoError(t, err)
+	assert.True(t, realmData.Encoder.IsPasswordsMatch("1234567890", user.GetPasswordHash()))
+	_, err = reloaded.GetUser(context.Background(), realm, "admin")
+	assert.Error(t, err)
+	_, err = reloaded.GetRealm(context.Background(), "newrealm")
+	assert.Error(t, err)
+	renamed, err := reloaded.GetRealm(context.Background(), "renamed")
+	require.NoError(t, err)
+	assert.Equal(t, 200, renamed.TokenExpiration)
+	assert.NotEmpty(t, renamed.PasswordSalt)
+	cfg, err := reloaded.GetUserFederationConfig(context.Background(), "renamed", "ldap")
+	require.NoError(t, err)
+	assert.Equal(t, data.LDAP, cfg.Type)
+
+	require.NoError(t, reloaded.UpdateClient(context.Background(), realm, client.Name, data.Client{ID: clientId, Name: "renamed-client", Type: data.Public}))
+	require.NoError(t, reloaded.DeleteRealm(context.Background(), "renamed"))
+	reloaded = createFileDataManager(t, dataFile, 0)
+	_, err = reloaded.GetClient(context.Background(), realm, "renamed-client")
+	assert.NoError(t, err)
+	_, err = reloaded.GetRealm(context.Background(), "renamed")
+	assert.Error(t, err)
+	files, err := os.ReadDir(filepath.Dir(dataFile))
+	require.NoError(t, err)
+	fileNames := make([]string, 0, len(files))
+	for _, f := range files {
+		fileNames = append(fileNames, f.Name())
+	}
+	revisionsFile := strings.TrimSuffix(filepath.Base(dataFile), ".json") + ".revisions.json"
+	assert.ElementsMatch(t, []string{filepath.Base(dataFile), revisionsFile}, fileNames, "temporary files must be removed")
+}
+
+func TestImportRealmKeepsPasswordSaltAndHashes(t *testing.T) {
+	manager := createFileDataManager(t, copyTestDataFile(t), 0)
+	encoder := encoding.NewPasswordJsonEncoder("salt")
+	var rawUser interface{}
+	err := json.Unmarshal([]byte(sf.Format(`{"info": {"sub": "{0}", "preferred_username": "user"}, "credentials": {"password": "{1}"}}`,
+		uuid.New().String(), encoder.GetB64PasswordHash("123"))), &rawUser)
+	require.NoError(t, err)
+	realm := data.Realm{Name: "imported", TokenExpiration: 100, PasswordSalt: "salt", Users: []interface{}{rawUser}}
+	require.NoError(t, manager.ImportRealm(context.Background(), realm))
+	assert.Error(t, manager.ImportRealm(context.Background(), realm))
+
+	r, err := manager.GetRealm(context.Background(), realm.Name)
+	require.NoError(t, err)
+	assert.Equal(t, "salt", r.PasswordSalt)
+	user, err := manager.GetUser(context.Background(), realm.Name, "user")
+	require.NoError(t, err)
+	assert.True(t, r.Encoder.IsPasswordsMatch("123", user.GetPasswordHash()))
+}
+
+func TestChangesAreSavedWithDelay(t *testing.T) {
+	dataFile := copyTestDataFile(t)
+	manager := createFileDataManager(t, dataFile, time.Hour)
+	require.NoError(t, manager.DeleteClient(context.Background(), "myapp", "test-service-app-client"))
+	_, err := createFileDataManager(t, dataFile, 0).GetClient(context.Background(), "myapp", "test-service-app-client")
+	assert.NoError(t, err, "data file must be saved after delay")
+	require.NoError(t, manager.Flush())
+	_, err = createFileDataManager(t, dataFile, 0).GetClient(context.Background(), "myapp", "test-service-app-client")
+	assert.Error(t, err)
+
+	manager = createFileDataManager(t, dataFile, 10*time.Millisecond)
+	require.NoError(t, manager.DeleteUser(context.Background(), "myapp", "admin"))
+	assert.Eventually(t, func() bool {
+		_, getErr := createFileDataManager(t, dataFile, 0).GetUser(context.Background(), "myapp", "admin")
+		return getErr != nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestChangesDoNotAffectInitDataAndReturnedObjects(t *testing.T) {
+	var serverData data.ServerData
+	rawData, err := os.ReadFile(testDataFile)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(rawData, &serverData))
+	manager, err := CreateFileDataManagerWithInitData(&serverData, logging.CreateLogger(&config.LoggingConfig{}))
+	require.NoError(t, err)
+	realm := "myapp"
+	user, err := manager.GetUser(context.Background(), realm, "admin")
+	require.NoError(t, err)
+	clients, err := manager.GetClients(context.Background(), realm)
+	require.NoError(t, err)
+
+	require.NoError(t, manager.SetPassword(context.Background(), realm, "admin", "new password"))
+	require.NoError(t, manager.UpdateClient(context.Background(), realm, clients[0].Name, data.Client{Name: "changed"}))
+	assert.Equal(t, "1s2d3f4g90xs", user.GetPasswordHash())
+	assert.Equal(t, "test-service-app-client", clients[0].Name)
+	assert.Equal(t, "test-service-app-client", serverData.Realms[0].Clients[0].Name)
+	assert.Equal(t, "1s2d3f4g90xs", data.CreateUser(serverData.Realms[0].Users[0], nil).GetPasswordHash())
+	changed, err := manager.GetUser(context.Background(), realm, "admin")
+	require.NoError(t, err)
+	assert.NotEqual(t, "1s2d3f4g90xs", changed.GetPasswordHash())
+}
+
+func TestConcurrentChanges(t *testing.T) {
+	manager := createFileDataManager(t, copyTestDataFile(t), 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clientName := sf.Format("client_{0}", i)
+			assert.NoError(t, manager.CreateClient(context.Background(), "myapp", data.Client{ID: uuid.New(), Name: clientName}))
+			_, err := manager.GetClient(context.Background(), "myapp", clientName)
+			assert.NoError(t, err)
+			_, err = manager.GetUser(context.Background(), "myapp", "admin")
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	clients, err := createFileDataManager(t, manager.dataFile, 0).GetClients(context.Background(), "myapp")
+	require.NoError(t, err)
+	assert.Equal(t, 11, len(clients))
+}
+
+func TestDataFileReload(t *testing.T) {
+	dataFile := copyTestDataFile(t)
+	manager := createFileDataManager(t, dataFile, 0)
+	reloaded, err := manager.Reload()
+	assert.NoError(t, err)
+	assert.False(t, reloaded, "not changed data file must not be reloaded")
+
+	// 1. Changed data file is reloaded
+	changeTestDataFile(t, dataFile, func(serverData *data.ServerData) {
+		serverData.Realms[0].TokenExpiration = 100
+		serverData.Realms[0].Clients = append(serverData.Realms[0].Clients, data.Client{ID: uuid.New(), Name: "new-client"})
+	})
+	reloaded, err = manager.Reload()
+	assert.NoError(t, err)
+	assert.True(t, reloaded)
+	realm, err := manager.GetRealm(context.Background(), "myapp")
+	require.NoError(t, err)
+	assert.Equal(t, 100, realm.TokenExpiration)
+	assert.Equal(t, 2, len(realm.Clients))
+
+	// 2. Invalid data file is not loaded, previous data is kept
+	require.NoError(t, os.WriteFile(dataFile, []byte(`{"realms": [`), 0o600))
+	reloaded, err = manager.Reload()
+	assert.Error(t, err)
+	assert.False(t, reloaded)
+	reloaded, err = manager.Reload()
+	assert.NoError(t, err, "invalid data file must not be loaded again until it is changed")
+	assert.False(t, reloaded)
+	changeTestDataFile(t, testDataFile, func(serverData *data.ServerData) {
+		serverData.Realms[0].Clients = append(serverData.Realms[0].Clients, serverData.Realms[0].Clients[0])
+	}, dataFile)
+	_, err = manager.Reload()
+	assert.Error(t, err)
+	_, err = manager.GetClient(context.Background(), "myapp", "new-client")
+	assert.NoError(t, err)
+	require.NoError(t, os.Remove(dataFile))
+	_, err = manager.Reload()
+	assert.Error(t, err)
+
+	// 3. Fixed data file is reloaded, data file saved by manager is not reloaded
+	changeTestDataFile(t, testDataFile, func(serverData *data.ServerData) {}, dataFile)
+	reloaded, err = manager.Reload()
+	assert.NoError(t, err)
+	assert.True(t, reloaded)
+	_, err = manager.GetClient(context.Background(), "myapp", "new-client")
+	assert.Error(t, err)
+	require.NoError(t, manager.DeleteUser(context.Background(), "myapp", "admin"))
+	reloaded, err = manager.Reload()
+	assert.NoError(t, err)
+	assert.False(t, reloaded)
+}
+
+func TestDataFileChangesAreNotOverwritten(t *testing.T) {
+	// 1. Change fails with conflict, changed data file is loaded and change could be retried
+	dataFile := copyTestDataFile(t)
+	manager := createFileDataManager(t, dataFile, 0)
+	changeTestDataFile(t, dataFile, func(serverData *data.ServerData) {
+		serverData.Realms[0].Clients[0].Name = "renamed-client"
+	})
+	err := manager.DeleteUser(context.Background(), "myapp", "admin")
+	assert.True(t, errors.As(err, &appErrs.ObjectVersionConflictError{}))
+	_, err = manager.GetClient(context.Background(), "myapp", "renamed-client")
+	assert.NoError(t, err)
+	require.NoError(t, manager.DeleteUser(context.Background(), "myapp", "admin"))
+	saved := createFileDataManager(t, dataFile, 0)
+	_, err = saved.GetUser(context.Background(), "myapp", "admin")
+	assert.Error(t, err)
+	_, err = saved.GetClient(context.Background(), "myapp", "renamed-client")
+	assert.NoError(t, err)
+
+	// 2. Changes that are waiting for saving conflict with data file changes, they are discarded by reload and saving
+	for _, isReloaded := range []bool{true, false} {
+		dataFile = copyTestDataFile(t)
+		manager = createFileDataManager(t, dataFile, time.Hour)
+		require.NoError(t, manager.DeleteUser(context.Background(), "myapp", "admin"))
+		changeTestDataFile(t, dataFile, func(serverData *data.ServerData) {
+			serverData.Realms[0].Clients[0].Name = "renamed-client"
+		})
+		if isReloaded {
+			reloaded, reloadErr := manager.Reload()
+			assert.NoError(t, reloadErr)
+			assert.True(t, reloaded)
+			assert.NoError(t, manager.Flush())
+		} else {
+			err = manager.Flush()
+			assert.True(t, errors.As(err, &appErrs.ObjectVersionConflictError{}))
+		}
+		for _, m := range []*FileDataManager{manager, createFileDataManager(t, dataFile, 0)} {
+			_, err = m.GetUser(context.Background(), "myapp", "admin")
+			assert.NoError(t, err)
+			_, err = m.GetClient(context.Background(), "myapp", "renamed-client")
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestDataFileIsWatched(t *testing.T) {
+	dataFile := copyTestDataFile(t)
+	manager, err := CreateFileDataManager(dataFile, 0, 10*time.Millisecond, config.DefaultRevisionsLimit, logging.CreateLogger(&config.LoggingConfig{}))
+	require.NoError(t, err)
+	changeTestDataFile(t, dataFile, func(serverData *data.ServerData) {
+		serverData.Realms[0].Clients[0].Name = "renamed-client"
+	})
+	assert.Eventually(t, func() bool {
+		_, getErr := manager.GetClient(context.Background(), "myapp", "renamed-client")
+		return getErr == nil
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, manager.Close())
+	changeTestDataFile(t, dataFile, func(serverData *data.ServerData) {
+		serverData.Realms[0].Clients[0].Name = "closed-client"
+	})
+	time.Sleep(50 * time.Millisecond)
+	_, err = manager.GetClient(context.Background(), "myapp", "renamed-client")
+	assert.NoError(t, err, "closed manager must not reload data file")
+}
+
+func TestSearchUsersSuccessfully(t *testing.T) {
+	realm := data.Realm{Name: "search_app", TokenExpiration: 3600, RefreshTokenExpiration: 1800, Users: createTestSearchRawUsers(t)}
+	manager, err := CreateFileDataManagerWithInitData(&data.ServerData{Realms: []data.Realm{realm}}, logging.CreateLogger(&config.LoggingConfig{}))
+	require.NoError(t, err)
+	enabled := false
+	testCases := []struct {
+		name          string
+		filter        data.UsersFilter
+		page          data.PageRequest
+		expectedTotal int
+		expectedUsers []string
+	}{
+		{name: "AllUsers", page: data.PageRequest{Offset: 1, Limit: 2}, expectedTotal: 4, expectedUsers: []string{"alice", "b_x"}},
+		{name: "UsernamePrefix", filter: data.UsersFilter{UsernamePrefix: "b_"}, expectedTotal: 1, expectedUsers: []string{"b_x"}},
+		{name: "Email", filter: data.UsersFilter{Email: "ALICE@example.com"}, expectedTotal: 1, expectedUsers: []string{"alice"}},
+		{name: "Enabled", filter: data.UsersFilter{Enabled: &enabled}, expectedTotal: 1, expectedUsers: []string{"alex"}},
+		{
+			name: "Attribute", filter: data.UsersFilter{Attribute: "@.info.department == 'sales'"}, page: data.PageRequest{Offset: 1, Limit: 1},
+			expectedTotal: 2, expectedUsers: []string{"bob"},
+		},
+	}
+
+	for _, tCase := range testCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			page, err := manager.SearchUsers(context.Background(), realm.Name, tCase.filter, tCase.page)
+			require.NoError(t, err)
+			assert.Equal(t, tCase.expectedTotal, page.Total)
+			userNames := make([]string, len(page.Users))
+			for i, user := range page.Users {
+				userNames[i] = user.GetUsername()
+			}
+			assert.Equal(t, tCase.expectedUsers, userNames)
+		})
+	}
+
+	page, err := manager.ListUsers(context.Background(), realm.Name, data.PageRequest{Limit: 3})
+	require.NoError(t, err)
+	assert.Equal(t, 4, page.Total)
+	assert.Len(t, page.Users, 3)
+	_, err = manager.SearchUsers(context.Background(), realm.Name, data.UsersFilter{Attribute: "@.info.department =="}, data.PageRequest{})
+	assert.Error(t, err)
+}
+
+func TestUpdatesFailOnVersionConflict(t *testing.T) {
+	dataFile := copyTestDataFile(t)
+	manager := createFileDataManager(t, dataFile, 0)
+	var rawUser interface{}
+	err := json.Unmarshal([]byte(`{"info": {"sub": "0b4c8f5e-3b6a-4a8e-9f1d-2c7e5a9b1d3f", "preferred_username": "user"}}`), &rawUser)
+	require.NoError(t, err)
+	realm := data.Realm{
+		Name: "versioned", TokenExpiration: 100, RefreshTokenExpiration: 50,
+		Clients: []data.Client{{ID: uuid.New(), Name: "client", Type: data.Public}}, Users: []interface{}{rawUser},
+	}
+	require.NoError(t, manager.CreateRealm(context.Background(), realm))
+
+	// 1. Realm version is incremented on every update, update with a stale version fails
+	r, err := manager.GetRealm(context.Background(), realm.Name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), r.Version)
+	realmNew := *r
+	realmNew.TokenExpiration = 200
+	require.NoError(t, manager.UpdateRealm(context.Background(), realm.Name, realmNew))
+	err = manager.UpdateRealm(context.Background(), realm.Name, realmNew)
+	assert.True(t, errors.As(err, &appErrs.ObjectVersionConflictError{}))
+	realmNew.Version = data.NoExpectedVersion
+	require.NoError(t, manager.UpdateRealm(context.Background(), realm.Name, realmNew))
+
+	// 2. Client
+	c, err := manager.GetClient(context.Background(), realm.Name, "client")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), c.Version)
+	require.NoError(t, manager.UpdateClient(context.Background(), realm.Name, c.Name, *c))
+	err = manager.UpdateClient(context.Background(), realm.Name, c.Name, *c)
+	assert.True(t, errors.As(err, &appErrs.ObjectVersionConflictError{}))
+
+	// 3. User, password change increments version too
+	u, err := manager.GetUser(context.Background(), realm.Name, "user")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), u.GetVersion())
+	require.NoError(t, manager.UpdateUser(context.Background(), realm.Name, "user", u))
+	err = manager.UpdateUser(context.Background(), realm.Name, "user", u)
+	assert.True(t, errors.As(err, &appErrs.ObjectVersionConflictError{}))
+	require.NoError(t, manager.SetPassword(context.Background(), realm.Name, "user", "new_password"))
+
+	// 4. Versions are persisted to data file
+	reloaded := createFileDataManager(t, dataFile, 0)
+	r, err = reloaded.GetRealm(context.Background(), realm.Name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), r.Version)
+	c, err = reloaded.GetClient(context.Background(), realm.Name, "client")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), c.Version)
+	u, err = reloaded.GetUser(context.Background(), realm.Name, "user")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), u.GetVersion())
+}
+
+func TestRevisionsHistory(t *testing.T) {
+	dataFile := copyTestDataFile(t)
+	manager := createFileDataManager(t, dataFile, 0)
+	ctx := data.WithRevisionAuthor(context.Background(), "master/admin")
+	realm := data.Realm{
+		Name: "history", TokenExpiration: 100, RefreshTokenExpiration: 50,
+		Clients: []data.Client{{
+			ID: uuid.New(), Name: "client1", Type: data.Confidential,
+			Auth: data.Authentication{Type: data.ClientIdAndSecrets, Value: "client1_secret"},
+		}},
+	}
+	require.NoError(t, manager.CreateRealm(ctx, realm))
+
+	// 1. Realm and clients get first revision with author on creation
+	revisions, err := manager.GetRevisions(ctx, realm.Name, data.RealmRevision, "")
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	assert.Equal(t, int64(1), revisions[0].Version)
+	assert.Equal(t, "master/admin", revisions[0].Author)
+
+	// 2. Client update adds revision, history is moved to a new client name
+	c, err := manager.GetClient(ctx, realm.Name, "client1")
+	require.NoError(t, err)
+	c.Name = "client2"
+	require.NoError(t, manager.UpdateClient(ctx, realm.Name, "client1", *c))
+	revisions, err = manager.GetRevisions(ctx, realm.Name, data.ClientRevision, "client2")
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+	assert.Equal(t, []int64{1, 2}, []int64{revisions[0].Version, revisions[1].Version})
+	revisions, err = manager.GetRevisions(ctx, realm.Name, data.ClientRevision, "client1")
+	require.NoError(t, err)
+	assert.Empty(t, revisions)
+
+	// 3. Only revisionsLimit latest revisions are kept, realm history is moved on realm rename
+	manager.revisionsLimit = 3
+	r, err := manager.GetRealm(ctx, realm.Name)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		r.TokenExpiration += 10
+		r.Version = data.NoExpectedVersion
+		require.NoError(t, manager.UpdateRealm(ctx, r.Name, *r))
+	}
+	r.Name = "history_renamed"
+	require.NoError(t, manager.UpdateRealm(ctx, realm.Name, *r))
+	revisions, err = manager.GetRevisions(ctx, r.Name, data.RealmRevision, "")
+	require.NoError(t, err)
+	require.Len(t, revisions, 3)
+	assert.Equal(t, []int64{3, 4, 5}, []int64{revisions[0].Version, revisions[1].Version, revisions[2].Version})
+	assert.Equal(t, r.Name, revisions[2].Realm)
+
+	// 4. History is saved to revisions file, data file contains realms only, client secrets are masked in history
+	reopened := createFileDataManager(t, dataFile, 0)
+	revisions, err = reopened.GetRevisions(ctx, r.Name, data.ClientRevision, "client2")
+	require.NoError(t, err)
+	assert.Len(t, revisions, 2)
+	dataFileContent, err := os.ReadFile(dataFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(dataFileContent), "revisions")
+	revisionsFileContent, err := os.ReadFile(strings.TrimSuffix(dataFile, ".json") + ".revisions.json")
+	require.NoError(t, err)
+	assert.Contains(t, string(revisionsFileContent), "client2")
+	assert.NotContains(t, string(revisionsFileContent), "client1_secret")
+
+	// 5. Client history is removed with client, realm history is removed with realm
+	require.NoError(t, manager.DeleteClient(ctx, r.Name, "client2"))
+	revisions, err = manager.GetRevisions(ctx, r.Name, data.ClientRevision, "client2")
+	require.NoError(t, err)
+	assert.Empty(t, revisions)
+	require.NoError(t, manager.DeleteRealm(ctx, r.Name))
+	_, err = manager.GetRevisions(ctx, r.Name, data.RealmRevision, "")
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+
+	// 6. Client from data file doesn't have revisions, its state before the first update becomes a revision without author
+	c, err = manager.GetClient(ctx, "myapp", "test-service-app-client")
+	require.NoError(t, err)
+	require.NoError(t, manager.UpdateClient(ctx, "myapp", c.Name, *c))
+	revisions, err = manager.GetRevisions(ctx, "myapp", data.ClientRevision, c.Name)
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+	assert.Equal(t, c.Version, revisions[0].Version)
+	assert.Empty(t, revisions[0].Author)
+	assert.Equal(t, "master/admin", revisions[1].Author)
+}
+
 func createTestFileDataManager(t *testing.T) *FileDataManager {
+	return createFileDataManager(t, testDataFile, 0)
+}
+
+func createFileDataManager(t *testing.T, dataFile string, saveDelay time.Duration) *FileDataManager {
 	loggerCfg := config.LoggingConfig{}
 
 	logger := logging.CreateLogger(&loggerCfg)
 
-	manager, err := CreateFileDataManager(testDataFile, logger)
+	manager, err := CreateFileDataManager(dataFile, saveDelay, 0, config.DefaultRevisionsLimit, logger)
 	require.NoError(t, err)
 	return manager
 }
 
+// copyTestDataFile copies test data file to a temporary directory, tests that change data must use a copy
+func copyTestDataFile(t *testing.T) string {
+	content, err := os.ReadFile(testDataFile)
+	require.NoError(t, err)
+	dataFile := filepath.Join(t.TempDir(), testDataFile)
+	require.NoError(t, os.WriteFile(dataFile, content, 0o600))
+	return dataFile
+}
+
 func checkRealm(t *testing.T, expected *data.Realm, actual *data.Realm) {
 	assert.Equal(t, expected.Name, actual.Name)
 	assert.Equal(t, expected.TokenExpiration, actual.TokenExpiration)
@@ -165,3 +636,31 @@ func checkUser(t *testing.T, expected *data.User, actual *data.User) {
 	assert.Equal(t, (*expected).GetUsername(), (*actual).GetUsername())
 	assert.Equal(t, (*expected).GetPasswordHash(), (*actual).GetPasswordHash())
 }
+
+// changeTestDataFile reads data file, changes data and writes it (to targetFile if it is passed)
+func changeTestDataFile(t *testing.T, dataFile string, change func(serverData *data.ServerData), targetFile ...string) {
+	rawData, err := os.ReadFile(dataFile)
+	require.NoError(t, err)
+	var serverData data.ServerData
+	require.NoError(t, json.Unmarshal(rawData, &serverData))
+	change(&serverData)
+	rawData, err = json.Marshal(&serverData)
+	require.NoError(t, err)
+	if len(targetFile) > 0 {
+		dataFile = targetFile[0]
+	}
+	require.NoError(t, os.WriteFile(dataFile, rawData, 0o600))
+}
+
+// createTestSearchRawUsers creates users for search tests (ordered by username: alex, alice, b_x, bob)
+func createTestSearchRawUsers(t *testing.T) []interface{} {
+	rawUsers := sf.Format(`[
+		{"info": {"sub": "{0}", "preferred_username": "bob", "department": "sales"}, "credentials": {"password": "123"}},
+		{"info": {"sub": "{1}", "preferred_username": "alice", "email": "Alice@Example.com", "department": "sales"}, "enabled": true, "credentials": {"password": "123"}},
+		{"info": {"sub": "{2}", "preferred_username": "b_x"}, "credentials": {"password": "123"}},
+		{"info": {"sub": "{3}", "preferred_username": "alex", "department": "it"}, "enabled": false, "credentials": {"password": "123"}}
+	]`, uuid.New(), uuid.New(), uuid.New(), uuid.New())
+	var users []interface{}
+	require.NoError(t, json.Unmarshal([]byte(rawUsers), &users))
+	return users
+}
@@ -0,0 +1,337 @@
+package files
+
+import (
+	"encoding/json"
+	e "errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wissance/Ferrum/data"
+	"github.com/wissance/Ferrum/errors"
+	sf "github.com/wissance/stringFormatter"
+)
+
+// commit replaces realms and revisions in serverData and persists them to data file and revisions file, it must be called under
+// mutex (write lock)
+/* Without saveDelay data file is saved immediately, if saving fails realms are not replaced and error is returned. Data file
+ * that was changed by someone else since last load or save is not overwritten: changed data file is loaded (see
+ * loadChangedDataFile) and change fails with errors.ObjectVersionConflictError (it could be retried with loaded data).
+ * With saveDelay saving is scheduled (if it wasn't scheduled yet) and saving errors are only logged.
+ * Parameters:
+ *     - realms - new realms (copy, slice that is stored in serverData must not be changed in place)
+ *     - revisions - new revisions (copy as well)
+ *     - method - name of a calling method for errors
+ * Returns: error
+ */
+func (mn *FileDataManager) commit(realms []data.Realm, revisions []data.Revision, method string) error {
+	newData := data.ServerData{Realms: realms, Revisions: revisions}
+	if len(mn.dataFile) > 0 && mn.saveDelay <= 0 {
+		if conflictErr := mn.checkDataFileIsNotChanged(); conflictErr != nil {
+			return conflictErr
+		}
+		state, err := mn.saveData(&newData)
+		if err != nil {
+			return errors.NewUnknownError("saveData", method, err)
+		}
+		mn.dataFileState = state
+	}
+	mn.serverData = newData
+	if len(mn.dataFile) > 0 && mn.saveDelay > 0 && mn.saveTimer == nil {
+		mn.saveTimer = time.AfterFunc(mn.saveDelay, func() {
+			_ = mn.Flush()
+		})
+	}
+	return nil
+}
+
+// Flush saves changes that are waiting for saving (if manager saves data file with delay) immediately
+/* It should be called before application stop, otherwise changes made during last delay are lost. Data file that was
+ * changed by someone else after last load or save is not overwritten, changes conflict with it: changed data file is loaded
+ * (see loadChangedDataFile) and errors.ObjectVersionConflictError is returned.
+ * Returns: error of data file saving
+ */
+func (mn *FileDataManager) Flush() error {
+	// saveMutex guarantees that data files are written in order of changes
+	mn.saveMutex.Lock()
+	defer mn.saveMutex.Unlock()
+	mn.mutex.Lock()
+	if mn.saveTimer == nil {
+		mn.mutex.Unlock()
+		return nil
+	}
+	if conflictErr := mn.checkDataFileIsNotChanged(); conflictErr != nil {
+		mn.mutex.Unlock()
+		return conflictErr
+	}
+	mn.saveTimer.Stop()
+	mn.saveTimer = nil
+	// serverData is changed as copy-on-write, therefore it could be saved without lock
+	snapshot := mn.serverData
+	mn.mutex.Unlock()
+	state, err := mn.saveData(&snapshot)
+	if err != nil {
+		return errors.NewUnknownError("saveData", "FileDataManager.Flush", err)
+	}
+	// data file saved by manager itself must not be reloaded
+	mn.mutex.Lock()
+	mn.dataFileState = state
+	mn.mutex.Unlock()
+	return nil
+}
+
+// Reload loads data file again if it was changed (by modification time or size) since last load or save
+/* Data is replaced at once (all realms, clients and users), if data file is invalid (it couldn't be read or parsed or
+ * it contains invalid data, see validateServerData) previous data is kept and error is logged, invalid data file is not
+ * loaded again until it is changed. Data file changes are never overwritten: changes that are waiting for saving (saveDelay)
+ * conflict with them and are discarded (see loadChangedDataFile).
+ * Returns: true if data was reloaded and error
+ */
+func (mn *FileDataManager) Reload() (bool, error) {
+	if len(mn.dataFile) == 0 {
+		return false, nil
+	}
+	// reload must not be mixed with delayed saving (see Flush)
+	mn.saveMutex.Lock()
+	defer mn.saveMutex.Unlock()
+	state, err := getDataFileState(mn.dataFile)
+	mn.mutex.RLock()
+	isChanged := state != mn.dataFileState
+	mn.mutex.RUnlock()
+	if !isChanged {
+		return false, nil
+	}
+
+	mn.mutex.Lock()
+	defer mn.mutex.Unlock()
+	if err != nil {
+		// i.e. editor removes data file before writing new one, previous data is kept
+		mn.logger.Warn(sf.Format("Data file \"{0}\" is not available, previous data is kept: {1}", mn.dataFile, err.Error()))
+		mn.dataFileState = state
+		return false, errors.NewUnknownError("os.Stat", "FileDataManager.Reload", err)
+	}
+	if err = mn.loadChangedDataFile(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// checkDataFileIsNotChanged checks that data file was not changed by someone else since last load or save before data file
+// saving, it must be called under mutex (write lock)
+/* Changed data file is loaded (see loadChangedDataFile), absent data file is not a conflict (it is created by saving)
+ * Returns: errors.ObjectVersionConflictError (modification times of data file are versions) if data file was changed
+ */
+func (mn *FileDataManager) checkDataFileIsNotChanged() error {
+	state, err := getDataFileState(mn.dataFile)
+	if err != nil || state == mn.dataFileState {
+		return nil
+	}
+	conflictErr := errors.NewObjectVersionConflictError(dataFileObjectType, mn.dataFile, mn.dataFileState.modTime, state.modTime)
+	// invalid data file is not a conflict, it is overwritten
+	if loadErr := mn.loadChangedDataFile(); loadErr != nil {
+		return nil
+	}
+	return conflictErr
+}
+
+// loadChangedDataFile replaces data with data file that was changed by someone else, it must be called under mutex (write lock)
+/* Changes that are waiting for saving (saveDelay) conflict with data file changes, they are discarded and error is logged.
+ * If data file is invalid previous data (and changes that are waiting for saving) is kept and error is logged.
+ * Returns: error if data file is invalid
+ */
+func (mn *FileDataManager) loadChangedDataFile() error {
+	serverData, state, err := mn.readData()
+	mn.dataFileState = state
+	if err != nil {
+		mn.logger.Error(sf.Format("Data file \"{0}\" was changed but it is invalid, previous data is kept", mn.dataFile))
+		return err
+	}
+	if mn.saveTimer != nil {
+		mn.saveTimer.Stop()
+		mn.saveTimer = nil
+		mn.logger.Error(sf.Format("Data file \"{0}\" was changed while changes made via admin API were not saved yet, these "+
+			"changes conflict with data file changes and are discarded", mn.dataFile))
+	}
+	mn.serverData = *serverData
+	mn.logger.Info(sf.Format("Data file \"{0}\" was changed and reloaded", mn.dataFile))
+	return nil
+}
+
+// readData reads, parses and validates data file
+/* Returns: data, data file state before reading (it is known even if data is invalid) and error
+ */
+func (mn *FileDataManager) readData() (*data.ServerData, dataFileState, error) {
+	state, err := getDataFileState(mn.dataFile)
+	if err != nil {
+		mn.logger.Error(sf.Format("An error occurred during data file reading: {0}", err.Error()))
+		return nil, state, errors.NewUnknownError("os.Stat", "FileDataManager.readData", err)
+	}
+	rawData, err := os.ReadFile(mn.dataFile)
+	if err != nil {
+		mn.logger.Error(sf.Format("An error occurred during data file reading: {0}", err.Error()))
+		return nil, state, errors.NewUnknownError("os.ReadFile", "FileDataManager.readData", err)
+	}
+	serverData := data.ServerData{}
+	if err = json.Unmarshal(rawData, &serverData); err != nil {
+		mn.logger.Error(sf.Format("An error occurred during data file unmarshal: {0}", err.Error()))
+		return nil, state, errors.NewUnknownError("json.Unmarshal", "FileDataManager.readData", err)
+	}
+	if err = validateServerData(&serverData); err != nil {
+		mn.logger.Error(sf.Format("Data file contains invalid data: {0}", err.Error()))
+		return nil, state, errors.NewUnknownError("validateServerData", "FileDataManager.readData", err)
+	}
+	if serverData.Revisions, err = mn.readRevisions(); err != nil {
+		return nil, state, err
+	}
+	return &serverData, state, nil
+}
+
+// readRevisions reads revisions from revisions file (see getRevisionsFile), absent revisions file means that there are no revisions
+func (mn *FileDataManager) readRevisions() ([]data.Revision, error) {
+	revisionsFile := getRevisionsFile(mn.dataFile)
+	rawRevisions, err := os.ReadFile(revisionsFile)
+	if err != nil {
+		if e.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		mn.logger.Error(sf.Format("An error occurred during revisions file \"{0}\" reading: {1}", revisionsFile, err.Error()))
+		return nil, errors.NewUnknownError("os.ReadFile", "FileDataManager.readRevisions", err)
+	}
+	var revisions []data.Revision
+	if err = json.Unmarshal(rawRevisions, &revisions); err != nil {
+		mn.logger.Error(sf.Format("An error occurred during revisions file \"{0}\" unmarshal: {1}", revisionsFile, err.Error()))
+		return nil, errors.NewUnknownError("json.Unmarshal", "FileDataManager.readRevisions", err)
+	}
+	return revisions, nil
+}
+
+// saveData writes serverData to data file and revisions to revisions file (see getRevisionsFile), revisions file is written first and
+// it is not created while there are no revisions. Returns state of saved data file
+func (mn *FileDataManager) saveData(serverData *data.ServerData) (dataFileState, error) {
+	revisionsFile := getRevisionsFile(mn.dataFile)
+	if _, statErr := os.Stat(revisionsFile); len(serverData.Revisions) > 0 || statErr == nil {
+		revisions := serverData.Revisions
+		if revisions == nil {
+			revisions = []data.Revision{}
+		}
+		content, err := json.MarshalIndent(revisions, "", "    ")
+		if err != nil {
+			mn.logger.Error(sf.Format("An error occurred during revisions marshal: {0}", err.Error()))
+			return dataFileState{}, err
+		}
+		if err = mn.writeFile(revisionsFile, content); err != nil {
+			return dataFileState{}, err
+		}
+	}
+	content, err := json.MarshalIndent(serverData, "", "    ")
+	if err != nil {
+		mn.logger.Error(sf.Format("An error occurred during data marshal: {0}", err.Error()))
+		return dataFileState{}, err
+	}
+	if err = mn.writeFile(mn.dataFile, content); err != nil {
+		return dataFileState{}, err
+	}
+	state, err := getDataFileState(mn.dataFile)
+	if err != nil {
+		// data is saved, but it will be reloaded once
+		mn.logger.Warn(sf.Format("An error occurred during saved data file \"{0}\" checking: {1}", mn.dataFile, err.Error()))
+	}
+	return state, nil
+}
+
+// writeFile writes file atomically: content is written to a temporary file in the same directory that replaces file by rename,
+// therefore file always contains either previous or new content. Permissions of existing file are kept
+func (mn *FileDataManager) writeFile(fileName string, content []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		mn.logger.Error(sf.Format("An error occurred during temporary file creation: {0}", err.Error()))
+		return err
+	}
+	tmpName := tmpFile.Name()
+	_, err = tmpFile.Write(content)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		if info, statErr := os.Stat(fileName); statErr == nil {
+			err = os.Chmod(tmpName, info.Mode().Perm())
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmpName, fileName)
+	}
+	if err != nil {
+		_ = os.Remove(tmpName)
+		mn.logger.Error(sf.Format("An error occurred during file \"{0}\" saving: {1}", fileName, err.Error()))
+		return err
+	}
+	return nil
+}
+
+// getRevisionsFile returns name of file that keeps revisions of data file realms and clients: file in the same directory with
+// ".revisions" suffix before extension, i.e. data.revisions.json for data.json
+func getRevisionsFile(dataFile string) string {
+	extension := filepath.Ext(dataFile)
+	return strings.TrimSuffix(dataFile, extension) + ".revisions" + extension
+}
+
+// dataFileObjectType is a type of data file in errors.ObjectVersionConflictError
+const dataFileObjectType = "data file"
+
+// dataFileState is used to detect data file changes
+type dataFileState struct {
+	modTime int64
+	size    int64
+}
+
+// getDataFileState returns data file modification time and size, if data file is not available returns empty state and error
+func getDataFileState(dataFile string) (dataFileState, error) {
+	info, err := os.Stat(dataFile)
+	if err != nil {
+		return dataFileState{}, err
+	}
+	return dataFileState{modTime: info.ModTime().UnixNano(), size: info.Size()}, nil
+}
+
+// validateServerData checks data that is loaded from data file: realms, clients, users and user federation configs must have
+// unique not empty names (user name is info.preferred_username)
+func validateServerData(serverData *data.ServerData) error {
+	realms := map[string]bool{}
+	for _, realm := range serverData.Realms {
+		if len(realm.Name) == 0 {
+			return e.New("realm name is empty")
+		}
+		if realms[realm.Name] {
+			return e.New(sf.Format("realm \"{0}\" is duplicated", realm.Name))
+		}
+		realms[realm.Name] = true
+		clients := map[string]bool{}
+		for _, client := range realm.Clients {
+			if len(client.Name) == 0 || clients[client.Name] {
+				return e.New(sf.Format("realm \"{0}\" contains client with empty or duplicated name \"{1}\"", realm.Name, client.Name))
+			}
+			clients[client.Name] = true
+		}
+		users := map[string]bool{}
+		for _, rawUser := range realm.Users {
+			username := data.CreateUser(rawUser, nil).GetUsername()
+			if len(username) == 0 || users[username] {
+				return e.New(sf.Format("realm \"{0}\" contains user with empty or duplicated username \"{1}\"", realm.Name, username))
+			}
+			users[username] = true
+		}
+		federationConfigs := map[string]bool{}
+		for _, cfg := range realm.UserFederationServices {
+			if len(cfg.Name) == 0 || federationConfigs[cfg.Name] {
+				return e.New(sf.Format("realm \"{0}\" contains user federation config with empty or duplicated name \"{1}\"",
+					realm.Name, cfg.Name))
+			}
+			federationConfigs[cfg.Name] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package files
+
+import (
+	"sync"
+	"time"
+
+	"github.com/wissance/Ferrum/logging"
+	sf "github.com/wissance/stringFormatter"
+)
+
+// dataFileWatcher is a background worker that periodically checks data file changes and reloads changed data file
+/* Data file is checked by modification time and size (see FileDataManager.Reload), Start and Stop are safe to call several times
+ */
+type dataFileWatcher struct {
+	manager  *FileDataManager
+	interval time.Duration
+	logger   *logging.AppLogger
+	mutex    sync.Mutex
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// createDataFileWatcher creates dataFileWatcher (not started) that checks manager data file every interval
+func createDataFileWatcher(manager *FileDataManager, interval time.Duration, logger *logging.AppLogger) *dataFileWatcher {
+	return &dataFileWatcher{manager: manager, interval: interval, logger: logger}
+}
+
+// Start starts background checking, if watcher is already started function does nothing
+func (watcher *dataFileWatcher) Start() {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	if watcher.stop != nil {
+		return
+	}
+	watcher.stop = make(chan struct{})
+	watcher.done = make(chan struct{})
+	go watcher.run(watcher.stop, watcher.done)
+	watcher.logger.Info(sf.Format("Data file \"{0}\" watcher started with interval: {1}", watcher.manager.dataFile, watcher.interval.String()))
+}
+
+// Stop stops background checking and waits until current reload finishes, if watcher is not started function does nothing
+func (watcher *dataFileWatcher) Stop() {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	if watcher.stop == nil {
+		return
+	}
+	close(watcher.stop)
+	<-watcher.done
+	watcher.stop = nil
+	watcher.done = nil
+	watcher.logger.Info(sf.Format("Data file \"{0}\" watcher stopped", watcher.manager.dataFile))
+}
+
+func (watcher *dataFileWatcher) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(watcher.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			// errors are logged by Reload, previous data is kept until data file is fixed
+			_, _ = watcher.manager.Reload()
+		}
+	}
+}
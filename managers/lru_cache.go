@@ -0,0 +1,105 @@
+package managers
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruCache is a size bounded cache of values with time to live, least recently used value is evicted when cache is full
+type lruCache[V any] struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	items   map[string]*list.Element
+	// order contains items from the most recently used to the least recently used
+	order *list.List
+}
+
+// lruCacheItem is a cached value with its key (key is required for eviction) and expiration time
+type lruCacheItem[V any] struct {
+	key        string
+	value      V
+	expiration time.Time
+}
+
+func newLruCache[V any](ttl time.Duration, maxSize int) *lruCache[V] {
+	return &lruCache[V]{ttl: ttl, maxSize: maxSize, items: make(map[string]*list.Element), order: list.New()}
+}
+
+// get returns value by key, expired value is removed and is not returned
+func (c *lruCache[V]) get(key string) (V, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.items[key]
+	if !ok {
+		var empty V
+		return empty, false
+	}
+	item := element.Value.(*lruCacheItem[V])
+	if time.Now().After(item.expiration) {
+		c.removeElement(element)
+		var empty V
+		return empty, false
+	}
+	c.order.MoveToFront(element)
+	return item.value, true
+}
+
+// set adds or replaces value, the least recently used value is evicted if cache is full
+func (c *lruCache[V]) set(key string, value V) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	expiration := time.Now().Add(c.ttl)
+	if element, ok := c.items[key]; ok {
+		item := element.Value.(*lruCacheItem[V])
+		item.value = value
+		item.expiration = expiration
+		c.order.MoveToFront(element)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruCacheItem[V]{key: key, value: value, expiration: expiration})
+	for c.order.Len() > c.maxSize {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// delete removes value by key
+func (c *lruCache[V]) delete(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.items[key]; ok {
+		c.removeElement(element)
+	}
+}
+
+// deleteIf removes all values that match condition
+func (c *lruCache[V]) deleteIf(condition func(key string, value V) bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key, element := range c.items {
+		if condition(key, element.Value.(*lruCacheItem[V]).value) {
+			c.removeElement(element)
+		}
+	}
+}
+
+// clear removes all values
+func (c *lruCache[V]) clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.items = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// len returns number of cached values (including expired values that were not removed yet)
+func (c *lruCache[V]) len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+func (c *lruCache[V]) removeElement(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.items, element.Value.(*lruCacheItem[V]).key)
+}
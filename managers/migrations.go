@@ -0,0 +1,16 @@
+package managers
+
+import (
+	"context"
+
+	"github.com/wissance/Ferrum/data"
+)
+
+// SchemaMigrator is an optional DataContext extension of data stores that keep versioned data schema (see data.Migration)
+/* Data is migrated on data store creation unless config.AutoMigrate option is false, in that case data store is not available
+ * until data is migrated by Migrate (admin CLI migrate operation). Redis and Postgres data stores implement this interface.
+ */
+type SchemaMigrator interface {
+	// Migrate applies migrations that were not applied yet, if dryRun is true migrations are only returned in the report
+	Migrate(ctx context.Context, dryRun bool) (*data.MigrationReport, error)
+}
@@ -0,0 +1,398 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/wissance/Ferrum/config"
+	appErrs "github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/logging"
+	sf "github.com/wissance/stringFormatter"
+)
+
+type objectType string
+
+const (
+	Realm                objectType = "realm"
+	Client               objectType = "client"
+	User                 objectType = "user"
+	UserFederationConfig objectType = "user federation config"
+	OfflineSession       objectType = "offline session"
+)
+
+const (
+	defaultSchema = "ferrum"
+	// connectTimeout is a timeout of connection to postgres server in seconds
+	connectTimeout = 5
+	// uniqueViolation is a postgres error code of unique constraint violation
+	uniqueViolation = "23505"
+)
+
+// PostgresDataManager is a data manager that stores authorization server data in PostgreSQL
+/*
+ * There are following store rules:
+ * 1. All tables are created in a schema (config.Namespace option or defaultSchema) by versioned migrations (see migrations)
+ *    that are applied on manager creation
+ * 2. Realm (data.Realm) is stored in realms table without clients, users and user federation configs, realm settings are
+ *    stored as JSONB, realm has surrogate id therefore realm rename doesn't affect related objects
+ * 3. Clients, users, user federation configs and offline sessions are stored in their own tables with realm id foreign key
+ *    (ON DELETE CASCADE), every object is stored as JSONB (users data is stored as is, it is a free-form KeyCloakUser data)
+ * 4. Users are indexed by username (primary key) and by user id (unique key, users without id have NULL)
+ * 5. Every DataContext operation is either a single statement or a transaction, therefore it is applied completely or not at all
+ * 6. Expired offline sessions are not returned, they are removed on creation of a new offline session of the same user
+ * 7. Revisions of realms and clients (data.Revision) are stored in revisions table (realm revisions have empty object_name),
+ *    up to revisionsLimit revisions of every object are kept
+ */
+type PostgresDataManager struct {
+	source           string
+	schema           string
+	db               *sql.DB
+	logger           *logging.AppLogger
+	ctx              context.Context
+	operationTimeout time.Duration
+	// revisionsLimit is a max number of kept revisions of realm or client (see config.RevisionsLimit)
+	revisionsLimit int
+	// migrated is false while database schema is outdated (config.AutoMigrate is false), it is shared by all manager copies
+	migrated *atomic.Bool
+}
+
+// CreatePostgresDataManager is factory function for instance of PostgresDataManager creation
+/* Connects to postgres server and applies schema migrations, function fails if server is not available or migrations
+ * could not be applied. If config.AutoMigrate option is false migrations are not applied, manager is not available until
+ * schema is migrated by Migrate
+ * Parameters:
+ *     - dataSourceCfg - Source is a postgres server address, Credentials are user and password, options contain
+ *       config.DbName, config.Namespace (schema), config.UseTls and config.InsecureTls
+ *     - logger - initialized logger instance
+ * Returns: data manager and error
+ */
+func CreatePostgresDataManager(dataSourceCfg *config.DataSourceConfig, logger *logging.AppLogger) (*PostgresDataManager, error) {
+	schema := GetSchema(dataSourceCfg)
+	db, err := sql.Open("postgres", buildConnectionString(dataSourceCfg, schema))
+	if err != nil {
+		logger.Error(sf.Format("An error occurred during postgres connection \"{0}\" opening: {1}", dataSourceCfg.Source, err.Error()))
+		return nil, appErrs.NewUnknownError("sql.Open", "CreatePostgresDataManager", err)
+	}
+	mn := &PostgresDataManager{
+		source: dataSourceCfg.Source, schema: schema, db: db, logger: logger, ctx: context.Background(),
+		operationTimeout: dataSourceCfg.GetOperationTimeout(), revisionsLimit: dataSourceCfg.GetRevisionsLimit(), migrated: &atomic.Bool{},
+	}
+	// migrations are applied without operation deadline, they could wait for migrations of other instances
+	autoMigrate := dataSourceCfg.IsAutoMigrateEnabled()
+	report, err := mn.applyMigrations(!autoMigrate)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if len(report.Migrations) > 0 && report.DryRun {
+		logger.Warn(sf.Format("Postgres schema \"{0}\" version {1} is outdated (latest version is {2}), schema must be migrated "+
+			"by admin CLI migrate operation", schema, report.SchemaVersion, report.TargetVersion))
+		return mn, nil
+	}
+	mn.migrated.Store(true)
+	return mn, nil
+}
+
+// GetSchema returns database schema name from data source config (config.Namespace option) or defaultSchema if option is not set
+func GetSchema(dataSourceCfg *config.DataSourceConfig) string {
+	schema, ok := dataSourceCfg.Options[config.Namespace]
+	if !ok || len(schema) == 0 {
+		schema = defaultSchema
+	}
+	return schema
+}
+
+// IsAvailable methods that checks whether DataContext could be used or not
+/* Availability means that postgres server responds on ping and database schema is migrated
+ * Parameters: no
+ * Returns true if DataContext is available
+ */
+func (mn *PostgresDataManager) IsAvailable() bool {
+	err := mn.db.PingContext(mn.ctx)
+	if err != nil {
+		mn.logger.Debug(sf.Format("Postgres Ping executed with error: {0}", err.Error()))
+		return false
+	}
+	return mn.migrated.Load()
+}
+
+// Close closes all postgres connections, manager could not be used after Close
+func (mn *PostgresDataManager) Close() error {
+	return mn.db.Close()
+}
+
+// buildConnectionString builds lib/pq connection url, schema is set as a search_path, therefore all queries use tables without schema
+func buildConnectionString(dataSourceCfg *config.DataSourceConfig, schema string) string {
+	sslMode := "disable"
+	useTls, _ := strconv.ParseBool(dataSourceCfg.Options[config.UseTls])
+	insecureTls, _ := strconv.ParseBool(dataSourceCfg.Options[config.InsecureTls])
+	if useTls {
+		sslMode = "verify-full"
+		if insecureTls {
+			sslMode = "require"
+		}
+	}
+	params := url.Values{}
+	params.Set("sslmode", sslMode)
+	params.Set("connect_timeout", strconv.Itoa(connectTimeout))
+	params.Set("search_path", pq.QuoteIdentifier(schema))
+	connUrl := url.URL{
+		Scheme:   "postgres",
+		Host:     dataSourceCfg.Source,
+		Path:     dataSourceCfg.Options[config.DbName],
+		RawQuery: params.Encode(),
+	}
+	if dataSourceCfg.Credentials != nil {
+		connUrl.User = url.UserPassword(dataSourceCfg.Credentials.Username, dataSourceCfg.Credentials.Password)
+	}
+	return connUrl.String()
+}
+
+// withOperationContext returns copy of manager that executes all statements with context of one operation
+/* Every DataContext method starts with this call, therefore all statements of operation (including nested DataContext
+ * calls that must receive mn.ctx) are cancelled together when ctx is cancelled (i.e. client disconnected) or when
+ * operationTimeout passed. Manager itself is never changed, therefore it could be used concurrently.
+ * Parameters:
+ *     - ctx - context of operation (usually context of HTTP request)
+ * Returns: manager copy and cancel function that must be called when operation is completed
+ */
+func (mn *PostgresDataManager) withOperationContext(ctx context.Context) (*PostgresDataManager, context.CancelFunc) {
+	operationMn := *mn
+	var cancel context.CancelFunc
+	if mn.operationTimeout > 0 {
+		operationMn.ctx, cancel = context.WithTimeout(ctx, mn.operationTimeout)
+	} else {
+		operationMn.ctx, cancel = context.WithCancel(ctx)
+	}
+	return &operationMn, cancel
+}
+
+// inTransaction executes fn in a transaction, transaction is rolled back if fn returns error
+/* Errors returned by fn are returned as is, therefore fn must return errors of errors package
+ * Parameters:
+ *     - method - name of a calling method for errors
+ *     - fn - transaction function
+ * Returns: error
+ */
+func (mn *PostgresDataManager) inTransaction(method string, fn func(tx *sql.Tx) error) error {
+	tx, err := mn.db.BeginTx(mn.ctx, nil)
+	if err != nil {
+		return mn.getDbError("sql.DB.Begin", method, err)
+	}
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return mn.getDbError("sql.Tx.Commit", method, err)
+	}
+	return nil
+}
+
+// getDbError converts database/sql error to errors package error, postgres errors become appErrs.UnknownError, all
+// other errors (connection errors) and errors of cancelled operations (or operations which deadline passed, postgres
+// returns query_canceled error for them) mean that postgres is not available
+func (mn *PostgresDataManager) getDbError(operation string, method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var pqErr *pq.Error
+	var netErr net.Error
+	if mn.ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) ||
+		(!errors.As(err, &pqErr) && (errors.As(err, &netErr) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, driver.ErrBadConn))) {
+		mn.logger.Warn(sf.Format("Postgres is not available during {0} in {1}: {2}", operation, method, err.Error()))
+		return appErrs.NewDataProviderNotAvailable(string(config.POSTGRES), mn.source)
+	}
+	mn.logger.Error(sf.Format("An error occurred during {0} in {1}: {2}", operation, method, err.Error()))
+	return appErrs.NewUnknownError(operation, method, err)
+}
+
+// isUniqueViolation checks whether error is a postgres unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+// queryer is a common interface of sql.DB and sql.Tx
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// getRealmId returns surrogate id of realm with name = realmName
+/* Parameters:
+ *     - q - database or transaction
+ *     - realmName - name of a realm
+ *     - forUpdate - lock realm row until transaction end
+ * Returns: realm id and error (appErrs.ObjectNotFoundError if realm doesn't exist)
+ */
+func (mn *PostgresDataManager) getRealmId(q queryer, realmName string, forUpdate bool) (int64, error) {
+	query := "SELECT id FROM realms WHERE name = $1"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	var realmId int64
+	err := q.QueryRowContext(mn.ctx, query, realmName).Scan(&realmId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, appErrs.NewObjectNotFoundError(string(Realm), realmName, "")
+		}
+		return 0, mn.getDbError("sql.Row.Scan", "PostgresDataManager.getRealmId", err)
+	}
+	return realmId, nil
+}
+
+// getObject reads single JSONB object by query
+/* Parameters:
+ *     - mn - data manager
+ *     - q - database or transaction
+ *     - objType - type of object (for errors)
+ *     - objId - object identifier (for errors)
+ *     - realmName - name of a realm that object belongs to (for errors)
+ *     - query - query that returns single column with JSONB object
+ *     - args - query arguments
+ * Returns: object and error (appErrs.ObjectNotFoundError if query doesn't return rows)
+ */
+func getObject[T any](mn *PostgresDataManager, q queryer, objType objectType, objId string, realmName string, query string,
+	args ...any,
+) (*T, error) {
+	var value []byte
+	err := q.QueryRowContext(mn.ctx, query, args...).Scan(&value)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, appErrs.NewObjectNotFoundError(string(objType), objId, sf.Format("realm: {0}", realmName))
+		}
+		return nil, mn.getDbError("sql.Row.Scan", sf.Format("getObject[{0}]", objType), err)
+	}
+	var obj T
+	if err = json.Unmarshal(value, &obj); err != nil {
+		return nil, appErrs.NewUnknownError("json.Unmarshal", sf.Format("getObject[{0}]", objType), err)
+	}
+	return &obj, nil
+}
+
+// getObjects reads all JSONB objects returned by query
+func getObjects[T any](mn *PostgresDataManager, q queryer, objType objectType, query string, args ...any) ([]T, error) {
+	rows, err := q.QueryContext(mn.ctx, query, args...)
+	if err != nil {
+		return nil, mn.getDbError("sql.DB.Query", sf.Format("getObjects[{0}]", objType), err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	objects := []T{}
+	for rows.Next() {
+		var value []byte
+		if err = rows.Scan(&value); err != nil {
+			return nil, mn.getDbError("sql.Rows.Scan", sf.Format("getObjects[{0}]", objType), err)
+		}
+		var obj T
+		if err = json.Unmarshal(value, &obj); err != nil {
+			return nil, appErrs.NewUnknownError("json.Unmarshal", sf.Format("getObjects[{0}]", objType), err)
+		}
+		objects = append(objects, obj)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, mn.getDbError("sql.Rows.Next", sf.Format("getObjects[{0}]", objType), err)
+	}
+	return objects, nil
+}
+
+// marshalObject converts object to JSON for JSONB column
+func marshalObject(objType objectType, obj any) ([]byte, error) {
+	value, err := json.Marshal(obj)
+	if err != nil {
+		return nil, appErrs.NewUnknownError("json.Marshal", sf.Format("marshalObject[{0}]", objType), err)
+	}
+	return value, nil
+}
+
+// checkAffected returns appErrs.ObjectNotFoundError if statement didn't affect any row
+func (mn *PostgresDataManager) checkAffected(result sql.Result, method string, objType objectType, objId string, realmName string) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return mn.getDbError("sql.Result.RowsAffected", method, err)
+	}
+	if affected == 0 {
+		return appErrs.NewObjectNotFoundError(string(objType), objId, sf.Format("realm: {0}", realmName))
+	}
+	return nil
+}
+
+// insertNamedObject inserts object into a table with (realm_id, name, data) columns (clients, user_federation_configs)
+/* Parameters:
+ *     - q - database or transaction
+ *     - table - name of a table
+ *     - objType - type of object
+ *     - realmId - surrogate realm id
+ *     - realmName - name of a realm (for errors)
+ *     - name - object name
+ *     - obj - object that is stored as JSONB
+ * Returns: error (appErrs.ObjectAlreadyExistsError if object with same name exists in a realm)
+ */
+func (mn *PostgresDataManager) insertNamedObject(q queryer, table string, objType objectType, realmId int64, realmName string,
+	name string, obj any,
+) error {
+	value, err := marshalObject(objType, obj)
+	if err != nil {
+		return err
+	}
+	query := sf.Format("INSERT INTO {0} (realm_id, name, data) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", table)
+	result, err := q.ExecContext(mn.ctx, query, realmId, name, value)
+	if err != nil {
+		return mn.getDbError("sql.Exec", sf.Format("insertNamedObject[{0}]", objType), err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return mn.getDbError("sql.Result.RowsAffected", sf.Format("insertNamedObject[{0}]", objType), err)
+	}
+	if affected == 0 {
+		return appErrs.NewObjectExistsError(string(objType), name, sf.Format("realm: {0}", realmName))
+	}
+	return nil
+}
+
+// updateNamedObject updates (and renames if name was changed) object in a table with (realm_id, name, data) columns
+/* Returns: error (appErrs.ObjectNotFoundError if object doesn't exist, appErrs.ObjectAlreadyExistsError if object with
+ * new name exists in a realm)
+ */
+func (mn *PostgresDataManager) updateNamedObject(q queryer, table string, objType objectType, realmName string, name string, newName string,
+	obj any,
+) error {
+	value, err := marshalObject(objType, obj)
+	if err != nil {
+		return err
+	}
+	query := sf.Format("UPDATE {0} SET name = $1, data = $2 WHERE realm_id = (SELECT id FROM realms WHERE name = $3) AND name = $4",
+		table)
+	result, err := q.ExecContext(mn.ctx, query, newName, value, realmName, name)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return appErrs.NewObjectExistsError(string(objType), newName, sf.Format("realm: {0}", realmName))
+		}
+		return mn.getDbError("sql.Exec", sf.Format("updateNamedObject[{0}]", objType), err)
+	}
+	return mn.checkAffected(result, sf.Format("updateNamedObject[{0}]", objType), objType, name, realmName)
+}
+
+// deleteNamedObject removes object from a table with (realm_id, name, data) columns
+/* Returns: error (appErrs.ObjectNotFoundError if object doesn't exist)
+ */
+func (mn *PostgresDataManager) deleteNamedObject(q queryer, table string, objType objectType, realmName string, name string) error {
+	query := sf.Format("DELETE FROM {0} WHERE realm_id = (SELECT id FROM realms WHERE name = $1) AND name = $2", table)
+	result, err := q.ExecContext(mn.ctx, query, realmName, name)
+	if err != nil {
+		return mn.getDbError("sql.DB.Exec", sf.Format("deleteNamedObject[{0}]", objType), err)
+	}
+	return mn.checkAffected(result, sf.Format("deleteNamedObject[{0}]", objType), objType, name, realmName)
+}
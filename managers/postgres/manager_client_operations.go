@@ -0,0 +1,131 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+)
+
+const clientsTable = "clients"
+
+// GetClients function for getting all realm clients (ordered by name)
+/* Parameters:
+ *     - realmName - name of a realm
+ * Returns: clients (empty slice if realm doesn't exist or doesn't have clients) and error
+ */
+func (mn *PostgresDataManager) GetClients(ctx context.Context, realmName string) ([]data.Client, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return getObjects[data.Client](mn, mn.db, Client,
+		"SELECT c.data FROM clients c JOIN realms r ON r.id = c.realm_id WHERE r.name = $1 ORDER BY c.name", realmName)
+}
+
+// GetClient function for getting realm client by name
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - clientName - name of a client
+ * Returns: client and error (appErrs.ObjectNotFoundError if realm or client doesn't exist)
+ */
+func (mn *PostgresDataManager) GetClient(ctx context.Context, realmName string, clientName string) (*data.Client, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return getObject[data.Client](mn, mn.db, Client, clientName, realmName,
+		"SELECT c.data FROM clients c JOIN realms r ON r.id = c.realm_id WHERE r.name = $1 AND c.name = $2", realmName, clientName)
+}
+
+// CreateClient creates new client in a realm, client gets version 1 and first revision
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - clientNew - new client data
+ * Returns: error (appErrs.ObjectNotFoundError if realm doesn't exist, appErrs.ObjectAlreadyExistsError if client exists)
+ */
+func (mn *PostgresDataManager) CreateClient(ctx context.Context, realmName string, clientNew data.Client) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return mn.inTransaction("PostgresDataManager.CreateClient", func(tx *sql.Tx) error {
+		realmId, err := mn.getRealmId(tx, realmName, false)
+		if err != nil {
+			return err
+		}
+		clientNew.Version = 1
+		if err = mn.insertClient(tx, realmId, realmName, &clientNew); err != nil {
+			return err
+		}
+		revision, err := data.CreateClientRevision(mn.ctx, realmName, &clientNew)
+		if err != nil {
+			return appErrs.NewUnknownError("CreateClientRevision", "PostgresDataManager.CreateClient", err)
+		}
+		return mn.addRevision(tx, realmId, nil, revision)
+	})
+}
+
+// UpdateClient updates existing realm client, client could be renamed (client revisions are renamed too)
+/* Stored client row is locked until transaction end, therefore version check, update and revision adding are atomic
+ * Parameters:
+ *     - realmName - name of a realm
+ *     - clientName - name of a client
+ *     - clientNew - new client data, clientNew.Version is an expected version of stored client (see data.CheckVersion)
+ * Returns: error (appErrs.ObjectNotFoundError if client doesn't exist, appErrs.ObjectAlreadyExistsError if client with new name exists,
+ * appErrs.ObjectVersionConflictError if stored client has other version)
+ */
+func (mn *PostgresDataManager) UpdateClient(ctx context.Context, realmName string, clientName string, clientNew data.Client) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return mn.inTransaction("PostgresDataManager.UpdateClient", func(tx *sql.Tx) error {
+		oldClient, err := getObject[data.Client](mn, tx, Client, clientName, realmName,
+			"SELECT c.data FROM clients c JOIN realms r ON r.id = c.realm_id WHERE r.name = $1 AND c.name = $2 FOR UPDATE OF c",
+			realmName, clientName)
+		if err != nil {
+			return err
+		}
+		if err = data.CheckVersion(string(Client), clientName, oldClient.Version, clientNew.Version); err != nil {
+			return err
+		}
+		clientNew.Version = oldClient.Version + 1
+		if err = mn.updateNamedObject(tx, clientsTable, Client, realmName, clientName, clientNew.Name, &clientNew); err != nil {
+			return err
+		}
+		realmId, err := mn.getRealmId(tx, realmName, false)
+		if err != nil {
+			return err
+		}
+		if clientNew.Name != clientName {
+			if err = mn.renameRevisions(tx, realmId, data.ClientRevision, clientName, clientNew.Name); err != nil {
+				return err
+			}
+		}
+		previous, err := data.CreateClientRevision(mn.ctx, realmName, oldClient)
+		if err != nil {
+			return appErrs.NewUnknownError("CreateClientRevision", "PostgresDataManager.UpdateClient", err)
+		}
+		revision, err := data.CreateClientRevision(mn.ctx, realmName, &clientNew)
+		if err != nil {
+			return appErrs.NewUnknownError("CreateClientRevision", "PostgresDataManager.UpdateClient", err)
+		}
+		return mn.addRevision(tx, realmId, &previous, revision)
+	})
+}
+
+// DeleteClient removes realm client and its revisions
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - clientName - name of a client
+ * Returns: error (appErrs.ObjectNotFoundError if client doesn't exist)
+ */
+func (mn *PostgresDataManager) DeleteClient(ctx context.Context, realmName string, clientName string) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return mn.inTransaction("PostgresDataManager.DeleteClient", func(tx *sql.Tx) error {
+		if err := mn.deleteNamedObject(tx, clientsTable, Client, realmName, clientName); err != nil {
+			return err
+		}
+		return mn.deleteRevisions(tx, realmName, data.ClientRevision, clientName)
+	})
+}
+
+// insertClient stores new client of a realm with id = realmId
+func (mn *PostgresDataManager) insertClient(q queryer, realmId int64, realmName string, client *data.Client) error {
+	return mn.insertNamedObject(q, clientsTable, Client, realmId, realmName, client.Name, client)
+}
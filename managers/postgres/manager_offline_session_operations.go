@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	sf "github.com/wissance/stringFormatter"
+)
+
+// GetOfflineSession returns data.OfflineSession by its identifier
+/* Parameters:
+ *     - realmName - name of a Realm
+ *     - sessionId - offline session identifier
+ * Returns: offline session and error (appErrs.ObjectNotFoundError if realm or session doesn't exist or session expired)
+ */
+func (mn *PostgresDataManager) GetOfflineSession(ctx context.Context, realmName string, sessionId uuid.UUID) (*data.OfflineSession, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return getObject[data.OfflineSession](mn, mn.db, OfflineSession, sessionId.String(), realmName,
+		"SELECT s.data FROM offline_sessions s JOIN realms r ON r.id = s.realm_id WHERE r.name = $1 AND s.id = $2 AND s.expired > $3",
+		realmName, sessionId, time.Now())
+}
+
+// GetUserOfflineSessions returns all active offline sessions of a user
+/* Parameters:
+ *     - realmName - name of a Realm
+ *     - userId - user identifier
+ * Returns: offline sessions ordered by start time (the oldest first) and error
+ */
+func (mn *PostgresDataManager) GetUserOfflineSessions(ctx context.Context, realmName string, userId uuid.UUID) ([]data.OfflineSession, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return getObjects[data.OfflineSession](mn, mn.db, OfflineSession,
+		"SELECT s.data FROM offline_sessions s JOIN realms r ON r.id = s.realm_id "+
+			"WHERE r.name = $1 AND s.user_id = $2 AND s.expired > $3 ORDER BY s.started",
+		realmName, userId, time.Now())
+}
+
+// CreateOfflineSession creates new data.OfflineSession in a Realm, expired offline sessions of the same user are removed
+/* Parameters:
+ *     - realmName - name of a Realm
+ *     - session - new offline session
+ * Returns: error (appErrs.ObjectNotFoundError if realm doesn't exist, appErrs.ObjectAlreadyExistsError if session with same id exists)
+ */
+func (mn *PostgresDataManager) CreateOfflineSession(ctx context.Context, realmName string, session data.OfflineSession) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return mn.inTransaction("PostgresDataManager.CreateOfflineSession", func(tx *sql.Tx) error {
+		realmId, err := mn.getRealmId(tx, realmName, false)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(mn.ctx, "DELETE FROM offline_sessions WHERE realm_id = $1 AND user_id = $2 AND expired <= $3", realmId,
+			session.UserId, time.Now())
+		if err != nil {
+			return mn.getDbError("sql.Tx.Exec", "PostgresDataManager.CreateOfflineSession", err)
+		}
+		value, err := marshalObject(OfflineSession, &session)
+		if err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(mn.ctx, "INSERT INTO offline_sessions (realm_id, id, user_id, started, expired, data) "+
+			"VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING",
+			realmId, session.Id, session.UserId, session.Started, session.Expired, value)
+		if err != nil {
+			return mn.getDbError("sql.Tx.Exec", "PostgresDataManager.CreateOfflineSession", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return mn.getDbError("sql.Result.RowsAffected", "PostgresDataManager.CreateOfflineSession", err)
+		}
+		if affected == 0 {
+			return appErrs.NewObjectExistsError(string(OfflineSession), session.Id.String(), sf.Format("realm: {0}", realmName))
+		}
+		return nil
+	})
+}
+
+// UpdateOfflineSession updates existing data.OfflineSession (i.e. on offline token refresh)
+/* Parameters:
+ *     - realmName - name of a Realm
+ *     - session - offline session new data
+ * Returns: error (appErrs.ObjectNotFoundError if session doesn't exist or expired)
+ */
+func (mn *PostgresDataManager) UpdateOfflineSession(ctx context.Context, realmName string, session data.OfflineSession) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return mn.inTransaction("PostgresDataManager.UpdateOfflineSession", func(tx *sql.Tx) error {
+		oldSession, err := getObject[data.OfflineSession](mn, tx, OfflineSession, session.Id.String(), realmName,
+			"SELECT s.data FROM offline_sessions s JOIN realms r ON r.id = s.realm_id "+
+				"WHERE r.name = $1 AND s.id = $2 AND s.expired > $3 FOR UPDATE OF s",
+			realmName, session.Id, time.Now())
+		if err != nil {
+			return err
+		}
+		// session owner is not changed
+		session.UserId = oldSession.UserId
+		value, err := marshalObject(OfflineSession, &session)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(mn.ctx, "UPDATE offline_sessions SET started = $1, expired = $2, data = $3 "+
+			"WHERE realm_id = (SELECT id FROM realms WHERE name = $4) AND id = $5",
+			session.Started, session.Expired, value, realmName, session.Id)
+		return mn.getDbError("sql.Tx.Exec", "PostgresDataManager.UpdateOfflineSession", err)
+	})
+}
+
+// DeleteOfflineSession removes (revokes) data.OfflineSession
+/* Parameters:
+ *     - realmName - name of a Realm
+ *     - sessionId - offline session identifier
+ * Returns: error (appErrs.ObjectNotFoundError if session doesn't exist or expired)
+ */
+func (mn *PostgresDataManager) DeleteOfflineSession(ctx context.Context, realmName string, sessionId uuid.UUID) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	result, err := mn.db.ExecContext(mn.ctx, "DELETE FROM offline_sessions "+
+		"WHERE realm_id = (SELECT id FROM realms WHERE name = $1) AND id = $2 AND expired > $3", realmName, sessionId, time.Now())
+	if err != nil {
+		return mn.getDbError("sql.DB.Exec", "PostgresDataManager.DeleteOfflineSession", err)
+	}
+	return mn.checkAffected(result, "PostgresDataManager.DeleteOfflineSession", OfflineSession, sessionId.String(), realmName)
+}
@@ -0,0 +1,234 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/utils/encoding"
+)
+
+// GetRealmNames returns names of all realms ordered by name (see managers.RealmsLister)
+func (mn *PostgresDataManager) GetRealmNames(ctx context.Context) ([]string, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	rows, err := mn.db.QueryContext(mn.ctx, "SELECT name FROM realms ORDER BY name")
+	if err != nil {
+		return nil, mn.getDbError("sql.DB.Query", "PostgresDataManager.GetRealmNames", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, mn.getDbError("sql.Rows.Scan", "PostgresDataManager.GetRealmNames", err)
+		}
+		names = append(names, name)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, mn.getDbError("sql.Rows.Next", "PostgresDataManager.GetRealmNames", err)
+	}
+	return names, nil
+}
+
+// GetRealm function for getting realm by name, returns the realm with clients and user federation configs but no users
+/* Parameters:
+ *     - realmName name of a realm
+ * Returns: realm and error (appErrs.ObjectNotFoundError if realm doesn't exist)
+ */
+func (mn *PostgresDataManager) GetRealm(ctx context.Context, realmName string) (*data.Realm, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	realm, err := getObject[data.Realm](mn, mn.db, Realm, realmName, realmName, "SELECT data FROM realms WHERE name = $1", realmName)
+	if err != nil {
+		return nil, err
+	}
+	realm.Clients, err = mn.GetClients(mn.ctx, realmName)
+	if err != nil {
+		return nil, err
+	}
+	realm.UserFederationServices, err = getObjects[data.UserFederationServiceConfig](mn, mn.db, UserFederationConfig,
+		"SELECT c.data FROM user_federation_configs c JOIN realms r ON r.id = c.realm_id WHERE r.name = $1 ORDER BY c.name", realmName)
+	if err != nil {
+		return nil, err
+	}
+	realm.Encoder = encoding.NewPasswordJsonEncoder(realm.PasswordSalt)
+	return realm, nil
+}
+
+// CreateRealm creates a realm with all its clients, users and user federation configs in one transaction
+/* New password salt is generated for realm, users passwords are hashed with it. Realm, its clients and users get version 1,
+ * realm and its clients get first revision
+ * Parameters:
+ *     - newRealm - newly creating realm body data with clients, users and user federation configs
+ * Returns: error (appErrs.ObjectAlreadyExistsError if realm exists or new realm contains objects with same names)
+ */
+func (mn *PostgresDataManager) CreateRealm(ctx context.Context, newRealm data.Realm) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	newRealm.PasswordSalt = encoding.GenerateRandomSalt()
+	return mn.createRealm(newRealm, encoding.NewPasswordJsonEncoder(newRealm.PasswordSalt), "PostgresDataManager.CreateRealm")
+}
+
+// ImportRealm creates a realm as it is: realm password salt and versions are kept and users are stored without passwords hashing
+/* It is using for a data store seeding (see managers.RealmImporter), passwords must be already hashed with realm salt
+ * Parameters:
+ *     - realm - realm with clients, users and user federation configs
+ * Returns: error (appErrs.ObjectAlreadyExistsError if realm exists or realm contains objects with same names)
+ */
+func (mn *PostgresDataManager) ImportRealm(ctx context.Context, realm data.Realm) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return mn.createRealm(realm, nil, "PostgresDataManager.ImportRealm")
+}
+
+// createRealm creates realm with clients, users and user federation configs in one transaction, if encoder is not nil users
+// passwords are hashed by encoder, realm, clients and users get version 1 and realm and clients get first revision (otherwise realm
+// is imported as is)
+func (mn *PostgresDataManager) createRealm(newRealm data.Realm, encoder *encoding.PasswordJsonEncoder, method string) error {
+	if encoder != nil {
+		newRealm.Version = 1
+	}
+	return mn.inTransaction(method, func(tx *sql.Tx) error {
+		value, err := marshalObject(Realm, getShortRealm(&newRealm))
+		if err != nil {
+			return err
+		}
+		var realmId int64
+		err = tx.QueryRowContext(mn.ctx, "INSERT INTO realms (name, data) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING RETURNING id",
+			newRealm.Name, value).Scan(&realmId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return appErrs.NewObjectExistsError(string(Realm), newRealm.Name, "")
+			}
+			return mn.getDbError("sql.Row.Scan", method, err)
+		}
+		for _, client := range newRealm.Clients {
+			if encoder != nil {
+				client.Version = 1
+			}
+			if err = mn.insertClient(tx, realmId, newRealm.Name, &client); err != nil {
+				return err
+			}
+			if encoder != nil {
+				revision, revisionErr := data.CreateClientRevision(mn.ctx, newRealm.Name, &client)
+				if revisionErr != nil {
+					return appErrs.NewUnknownError("CreateClientRevision", method, revisionErr)
+				}
+				if err = mn.addRevision(tx, realmId, nil, revision); err != nil {
+					return err
+				}
+			}
+		}
+		if encoder != nil {
+			revision, revisionErr := data.CreateRealmRevision(mn.ctx, &newRealm)
+			if revisionErr != nil {
+				return appErrs.NewUnknownError("CreateRealmRevision", method, revisionErr)
+			}
+			if err = mn.addRevision(tx, realmId, nil, revision); err != nil {
+				return err
+			}
+		}
+		for _, rawUser := range newRealm.Users {
+			user := data.CreateUser(rawUser, encoder)
+			if encoder != nil {
+				user = data.CreateUserWithVersion(user, 1)
+			}
+			if err = mn.insertUser(tx, realmId, newRealm.Name, user); err != nil {
+				return err
+			}
+		}
+		for _, cfg := range newRealm.UserFederationServices {
+			if err = mn.insertUserFederationConfig(tx, realmId, newRealm.Name, &cfg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateRealm updates realm settings, clients, users, user federation configs and password salt are kept
+/* Realm could be renamed, related objects (and revisions) refer realm by surrogate id therefore they are not changed, realm gets
+ * new revision
+ * Parameters:
+ *     - realmName - name of a realm
+ *     - realmNew - new realm data (clients, users and user federation configs are ignored), realmNew.Version is an expected
+ *       version of stored realm (see data.CheckVersion)
+ * Returns: error (appErrs.ObjectNotFoundError if realm doesn't exist, appErrs.ObjectAlreadyExistsError if realm with new name exists,
+ * appErrs.ObjectVersionConflictError if stored realm has other version)
+ */
+func (mn *PostgresDataManager) UpdateRealm(ctx context.Context, realmName string, realmNew data.Realm) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return mn.inTransaction("PostgresDataManager.UpdateRealm", func(tx *sql.Tx) error {
+		oldRealm, err := getObject[data.Realm](mn, tx, Realm, realmName, realmName,
+			"SELECT data FROM realms WHERE name = $1 FOR UPDATE", realmName)
+		if err != nil {
+			return err
+		}
+		if err = data.CheckVersion(string(Realm), realmName, oldRealm.Version, realmNew.Version); err != nil {
+			return err
+		}
+		realmNew.Version = oldRealm.Version + 1
+		// salt is not changed on update, otherwise stored passwords hashes become invalid
+		realmNew.PasswordSalt = oldRealm.PasswordSalt
+		value, err := marshalObject(Realm, getShortRealm(&realmNew))
+		if err != nil {
+			return err
+		}
+		var realmId int64
+		err = tx.QueryRowContext(mn.ctx, "UPDATE realms SET name = $1, data = $2 WHERE name = $3 RETURNING id", realmNew.Name, value,
+			realmName).Scan(&realmId)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return appErrs.NewObjectExistsError(string(Realm), realmNew.Name, "")
+			}
+			return mn.getDbError("sql.Row.Scan", "PostgresDataManager.UpdateRealm", err)
+		}
+		previous, err := data.CreateRealmRevision(mn.ctx, oldRealm)
+		if err != nil {
+			return appErrs.NewUnknownError("CreateRealmRevision", "PostgresDataManager.UpdateRealm", err)
+		}
+		revision, err := data.CreateRealmRevision(mn.ctx, &realmNew)
+		if err != nil {
+			return appErrs.NewUnknownError("CreateRealmRevision", "PostgresDataManager.UpdateRealm", err)
+		}
+		return mn.addRevision(tx, realmId, &previous, revision)
+	})
+}
+
+// DeleteRealm removes realm, all its clients, users, user federation configs, offline sessions and revisions are removed by cascade
+/* Parameters:
+ *     - realmName - name of a realm
+ * Returns: error (appErrs.ObjectNotFoundError if realm doesn't exist)
+ */
+func (mn *PostgresDataManager) DeleteRealm(ctx context.Context, realmName string) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	result, err := mn.db.ExecContext(mn.ctx, "DELETE FROM realms WHERE name = $1", realmName)
+	if err != nil {
+		return mn.getDbError("sql.DB.Exec", "PostgresDataManager.DeleteRealm", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return mn.getDbError("sql.Result.RowsAffected", "PostgresDataManager.DeleteRealm", err)
+	}
+	if affected == 0 {
+		return appErrs.NewObjectNotFoundError(string(Realm), realmName, "")
+	}
+	return nil
+}
+
+// getShortRealm returns copy of realm without clients, users and user federation configs (they are stored in their own tables)
+func getShortRealm(realm *data.Realm) *data.Realm {
+	shortRealm := *realm
+	shortRealm.Clients = nil
+	shortRealm.Users = nil
+	shortRealm.UserFederationServices = nil
+	shortRealm.Encoder = nil
+	return &shortRealm
+}
@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/wissance/Ferrum/data"
+)
+
+// GetRevisions returns revisions of realm or realm client (see managers.RevisionsKeeper)
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - objectType - data.RealmRevision or data.ClientRevision
+ *     - objectName - name of a client (not used for realm)
+ * Returns: revisions ordered by version (empty slice if object doesn't have revisions) and error (appErrs.ObjectNotFoundError
+ * if realm doesn't exist)
+ */
+func (mn *PostgresDataManager) GetRevisions(ctx context.Context, realmName string, objectType data.RevisionObjectType, objectName string,
+) ([]data.Revision, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	realmId, err := mn.getRealmId(mn.db, realmName, false)
+	if err != nil {
+		return nil, err
+	}
+	objectName = getRevisionObjectName(objectType, objectName)
+	rows, err := mn.db.QueryContext(mn.ctx, "SELECT version, created, author, data FROM revisions "+
+		"WHERE realm_id = $1 AND object_type = $2 AND object_name = $3 ORDER BY version", realmId, string(objectType), objectName)
+	if err != nil {
+		return nil, mn.getDbError("sql.DB.Query", "PostgresDataManager.GetRevisions", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	revisions := make([]data.Revision, 0)
+	for rows.Next() {
+		revision := data.Revision{Realm: realmName, ObjectType: objectType, ObjectName: objectName}
+		var created time.Time
+		var value []byte
+		if err = rows.Scan(&revision.Version, &created, &revision.Author, &value); err != nil {
+			return nil, mn.getDbError("sql.Rows.Scan", "PostgresDataManager.GetRevisions", err)
+		}
+		revision.Created = created.UTC()
+		revision.Data = value
+		revisions = append(revisions, revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, mn.getDbError("sql.Rows.Next", "PostgresDataManager.GetRevisions", err)
+	}
+	return revisions, nil
+}
+
+// addRevision adds revision to history of changed object and removes the oldest revisions (see data.AddRevision), history is
+// not kept if revisionsLimit is 0
+/* Parameters:
+ *     - q - transaction of change
+ *     - realmId - surrogate id of a realm that object belongs to
+ *     - previous - revision of object state before change (nil if object was created), it is added only if history doesn't have it
+ *     - revision - revision of object state after change
+ * Returns: error
+ */
+func (mn *PostgresDataManager) addRevision(q queryer, realmId int64, previous *data.Revision, revision data.Revision) error {
+	if mn.revisionsLimit <= 0 {
+		return nil
+	}
+	objectName := getRevisionObjectName(revision.ObjectType, revision.ObjectName)
+	if previous != nil {
+		// author of state that was not kept in history is not known
+		_, err := q.ExecContext(mn.ctx, "INSERT INTO revisions (realm_id, object_type, object_name, version, created, author, data) "+
+			"VALUES ($1, $2, $3, $4, $5, '', $6) ON CONFLICT DO NOTHING", realmId, string(revision.ObjectType), objectName, previous.Version,
+			previous.Created, []byte(previous.Data))
+		if err != nil {
+			return mn.getDbError("sql.Exec", "PostgresDataManager.addRevision", err)
+		}
+	}
+	_, err := q.ExecContext(mn.ctx, "INSERT INTO revisions (realm_id, object_type, object_name, version, created, author, data) "+
+		"VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (realm_id, object_type, object_name, version) "+
+		"DO UPDATE SET created = EXCLUDED.created, author = EXCLUDED.author, data = EXCLUDED.data",
+		realmId, string(revision.ObjectType), objectName, revision.Version, revision.Created, revision.Author, []byte(revision.Data))
+	if err != nil {
+		return mn.getDbError("sql.Exec", "PostgresDataManager.addRevision", err)
+	}
+	_, err = q.ExecContext(mn.ctx, "DELETE FROM revisions WHERE realm_id = $1 AND object_type = $2 AND object_name = $3 AND version NOT IN "+
+		"(SELECT version FROM revisions WHERE realm_id = $1 AND object_type = $2 AND object_name = $3 ORDER BY version DESC LIMIT $4)",
+		realmId, string(revision.ObjectType), objectName, mn.revisionsLimit)
+	if err != nil {
+		return mn.getDbError("sql.Exec", "PostgresDataManager.addRevision", err)
+	}
+	return nil
+}
+
+// renameRevisions moves revisions of renamed object to a new name
+func (mn *PostgresDataManager) renameRevisions(q queryer, realmId int64, objectType data.RevisionObjectType, name string, newName string) error {
+	_, err := q.ExecContext(mn.ctx, "UPDATE revisions SET object_name = $1 WHERE realm_id = $2 AND object_type = $3 AND object_name = $4",
+		newName, realmId, string(objectType), name)
+	if err != nil {
+		return mn.getDbError("sql.Exec", "PostgresDataManager.renameRevisions", err)
+	}
+	return nil
+}
+
+// deleteRevisions removes revisions of removed object (revisions of realm are removed with realm by cascade)
+func (mn *PostgresDataManager) deleteRevisions(q queryer, realmName string, objectType data.RevisionObjectType, objectName string) error {
+	_, err := q.ExecContext(mn.ctx, "DELETE FROM revisions WHERE realm_id = (SELECT id FROM realms WHERE name = $1) "+
+		"AND object_type = $2 AND object_name = $3", realmName, string(objectType), getRevisionObjectName(objectType, objectName))
+	if err != nil {
+		return mn.getDbError("sql.Exec", "PostgresDataManager.deleteRevisions", err)
+	}
+	return nil
+}
+
+// getRevisionObjectName returns object_name column value, realm revisions have empty name
+func getRevisionObjectName(objectType data.RevisionObjectType, objectName string) string {
+	if objectType == data.RealmRevision {
+		return ""
+	}
+	return objectName
+}
@@ -0,0 +1,178 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wissance/Ferrum/config"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/logging"
+	sf "github.com/wissance/stringFormatter"
+)
+
+func TestExpiredOfflineSessionsAreRemoved(t *testing.T) {
+	manager := createTestPostgresDataManager(t, createTestSchemaName())
+	realm := data.Realm{Name: "app", TokenExpiration: 3600, RefreshTokenExpiration: 1800}
+	require.NoError(t, manager.CreateRealm(context.Background(), realm))
+	userId := uuid.New()
+	now := time.Now()
+	expiredSession := data.OfflineSession{
+		Id: uuid.New(), UserId: userId, ClientId: "web_app", Started: now.Add(-2 * time.Hour), Expired: now.Add(-time.Hour),
+	}
+	require.NoError(t, manager.CreateOfflineSession(context.Background(), realm.Name, expiredSession))
+
+	// creation of a new session of the same user removes expired session from a store
+	activeSession := data.OfflineSession{
+		Id: uuid.New(), UserId: userId, ClientId: "web_app", Started: now, Expired: now.Add(time.Hour),
+	}
+	require.NoError(t, manager.CreateOfflineSession(context.Background(), realm.Name, activeSession))
+	var sessionsCount int
+	err := manager.db.QueryRow("SELECT COUNT(*) FROM offline_sessions WHERE user_id = $1", userId).Scan(&sessionsCount)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sessionsCount)
+}
+
+func TestMigrationsAreAppliedOnce(t *testing.T) {
+	schema := createTestSchemaName()
+	manager := createTestPostgresDataManager(t, schema)
+	version, err := manager.getSchemaVersion(manager.db)
+	require.NoError(t, err)
+	assert.Equal(t, migrations[len(migrations)-1].version, version)
+	realm := createTestRealm(t, "app")
+	require.NoError(t, manager.CreateRealm(context.Background(), realm))
+	r, err := manager.GetRealm(context.Background(), realm.Name)
+	require.NoError(t, err)
+	require.NoError(t, manager.Close())
+	assert.False(t, manager.IsAvailable())
+
+	// second start doesn't apply migrations again and data is kept
+	manager = createTestPostgresDataManager(t, schema)
+	assert.True(t, manager.IsAvailable())
+	var migrationsCount int
+	err = manager.db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&migrationsCount)
+	require.NoError(t, err)
+	assert.Equal(t, len(migrations), migrationsCount)
+	reopenedRealm, err := manager.GetRealm(context.Background(), realm.Name)
+	require.NoError(t, err)
+	assert.Equal(t, r, reopenedRealm)
+	users, err := manager.GetUsers(context.Background(), realm.Name)
+	require.NoError(t, err)
+	assert.Equal(t, len(realm.Users), len(users))
+}
+
+func TestMigrateWhenAutoMigrationIsDisabled(t *testing.T) {
+	schema := createTestSchemaName()
+	dataSourceCfg := createTestDataSourceConfig(schema)
+	dataSourceCfg.Options[config.AutoMigrate] = "false"
+	manager, err := CreatePostgresDataManager(dataSourceCfg, logging.CreateLogger(&config.LoggingConfig{}))
+	if errors.As(err, &appErrs.DataProviderNotAvailable{}) {
+		t.Skip(sf.Format("postgres is not available: {0}", err.Error()))
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = manager.db.Exec(sf.Format("DROP SCHEMA IF EXISTS {0} CASCADE", pq.QuoteIdentifier(schema)))
+		_ = manager.Close()
+	})
+	ctx := context.Background()
+	latestVersion := migrations[len(migrations)-1].version
+
+	// 1. Schema that is not migrated can't be used, dry run doesn't create it
+	assert.False(t, manager.IsAvailable())
+	report, err := manager.Migrate(ctx, true)
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 0, report.SchemaVersion)
+	assert.Equal(t, latestVersion, report.TargetVersion)
+	assert.Len(t, report.Migrations, len(migrations))
+	version, err := manager.getSchemaVersion(manager.db)
+	require.NoError(t, err)
+	assert.Equal(t, 0, version)
+	assert.False(t, manager.IsAvailable())
+
+	// 2. Migration makes data store available
+	report, err = manager.Migrate(ctx, false)
+	require.NoError(t, err)
+	assert.Len(t, report.Migrations, len(migrations))
+	assert.True(t, manager.IsAvailable())
+	report, err = manager.Migrate(ctx, true)
+	require.NoError(t, err)
+	assert.Equal(t, latestVersion, report.SchemaVersion)
+	assert.Empty(t, report.Migrations)
+}
+
+func TestNewerSchemaVersionIsNotSupported(t *testing.T) {
+	schema := createTestSchemaName()
+	manager := createTestPostgresDataManager(t, schema)
+	newerVersion := migrations[len(migrations)-1].version + 1
+	_, err := manager.db.Exec("INSERT INTO schema_migrations (version, description) VALUES ($1, $2)", newerVersion, "future")
+	require.NoError(t, err)
+
+	_, err = CreatePostgresDataManager(createTestDataSourceConfig(schema), logging.CreateLogger(&config.LoggingConfig{}))
+	assert.True(t, errors.As(err, &appErrs.UnknownError{}))
+}
+
+func TestCreateManagerWhenPostgresIsNotAvailable(t *testing.T) {
+	dataSourceCfg := createTestDataSourceConfig(createTestSchemaName())
+	dataSourceCfg.Source = "127.0.0.1:1"
+	_, err := CreatePostgresDataManager(dataSourceCfg, logging.CreateLogger(&config.LoggingConfig{}))
+	assert.True(t, errors.As(err, &appErrs.DataProviderNotAvailable{}))
+}
+
+func createTestPostgresDataManager(t *testing.T, schema string) *PostgresDataManager {
+	loggerCfg := config.LoggingConfig{}
+	logger := logging.CreateLogger(&loggerCfg)
+	manager, err := CreatePostgresDataManager(createTestDataSourceConfig(schema), logger)
+	if errors.As(err, &appErrs.DataProviderNotAvailable{}) {
+		t.Skip(sf.Format("postgres is not available: {0}", err.Error()))
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = manager.db.Exec(sf.Format("DROP SCHEMA IF EXISTS {0} CASCADE", pq.QuoteIdentifier(schema)))
+		_ = manager.Close()
+	})
+	return manager
+}
+
+func createTestDataSourceConfig(schema string) *config.DataSourceConfig {
+	return &config.DataSourceConfig{
+		Type:   config.POSTGRES,
+		Source: "127.0.0.1:5432",
+		Credentials: &config.CredentialsConfig{
+			Username: "ferrum_db",
+			Password: "FeRRuM000",
+		},
+		Options: map[config.DataSourceConnOption]string{
+			config.DbName:    "ferrum_test",
+			config.Namespace: schema,
+		},
+	}
+}
+
+func createTestSchemaName() string {
+	return sf.Format("ferrum_test_{0}", strings.ReplaceAll(uuid.New().String(), "-", ""))
+}
+
+// createTestRealm creates realm with one client and one user, DataContext behaviour common for all data stores is checked by
+// conformance tests of managers package
+func createTestRealm(t *testing.T, realmName string) data.Realm {
+	var rawUser interface{}
+	err := json.Unmarshal([]byte(sf.Format(`{"info":{"sub":"{0}","preferred_username":"user1"}, "credentials":{"password": "123"}}`,
+		uuid.New().String())), &rawUser)
+	require.NoError(t, err)
+	return data.Realm{
+		Name:                   realmName,
+		TokenExpiration:        3600,
+		RefreshTokenExpiration: 1800,
+		Clients:                []data.Client{{Name: "client1", Type: data.Public, ID: uuid.New()}},
+		Users:                  []interface{}{rawUser},
+	}
+}
@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+)
+
+const userFederationConfigsTable = "user_federation_configs"
+
+// GetUserFederationConfigs function for getting all realm user federation configs (ordered by name)
+/* Parameters:
+ *     - realmName - name of a realm
+ * Returns: configs and error (appErrs.ErrZeroLength if realm doesn't exist or doesn't have configs)
+ */
+func (mn *PostgresDataManager) GetUserFederationConfigs(ctx context.Context, realmName string) ([]data.UserFederationServiceConfig, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	configs, err := getObjects[data.UserFederationServiceConfig](mn, mn.db, UserFederationConfig,
+		"SELECT c.data FROM user_federation_configs c JOIN realms r ON r.id = c.realm_id WHERE r.name = $1 ORDER BY c.name", realmName)
+	if err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return nil, appErrs.ErrZeroLength
+	}
+	return configs, nil
+}
+
+// GetUserFederationConfig function for getting realm user federation config by name
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - configName - name of a user federation config
+ * Returns: config and error (appErrs.ObjectNotFoundError if realm or config doesn't exist)
+ */
+func (mn *PostgresDataManager) GetUserFederationConfig(ctx context.Context, realmName string, configName string) (*data.UserFederationServiceConfig, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return getObject[data.UserFederationServiceConfig](mn, mn.db, UserFederationConfig, configName, realmName,
+		"SELECT c.data FROM user_federation_configs c JOIN realms r ON r.id = c.realm_id WHERE r.name = $1 AND c.name = $2",
+		realmName, configName)
+}
+
+// CreateUserFederationConfig creates new user federation config in a realm
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - userFederationConfig - new user federation config
+ * Returns: error (appErrs.ObjectNotFoundError if realm doesn't exist, appErrs.ObjectAlreadyExistsError if config exists)
+ */
+func (mn *PostgresDataManager) CreateUserFederationConfig(ctx context.Context, realmName string, userFederationConfig data.UserFederationServiceConfig) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return mn.inTransaction("PostgresDataManager.CreateUserFederationConfig", func(tx *sql.Tx) error {
+		realmId, err := mn.getRealmId(tx, realmName, false)
+		if err != nil {
+			return err
+		}
+		return mn.insertUserFederationConfig(tx, realmId, realmName, &userFederationConfig)
+	})
+}
+
+// UpdateUserFederationConfig updates existing user federation config, config could be renamed
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - configName - name of a user federation config
+ *     - userFederationConfig - new config data
+ * Returns: error (appErrs.ObjectNotFoundError if config doesn't exist, appErrs.ObjectAlreadyExistsError if config with new name exists)
+ */
+func (mn *PostgresDataManager) UpdateUserFederationConfig(ctx context.Context, realmName string, configName string,
+	userFederationConfig data.UserFederationServiceConfig,
+) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return mn.updateNamedObject(mn.db, userFederationConfigsTable, UserFederationConfig, realmName, configName, userFederationConfig.Name,
+		&userFederationConfig)
+}
+
+// DeleteUserFederationConfig removes user federation config from a realm
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - configName - name of a user federation config
+ * Returns: error (appErrs.ObjectNotFoundError if config doesn't exist)
+ */
+func (mn *PostgresDataManager) DeleteUserFederationConfig(ctx context.Context, realmName string, configName string) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return mn.deleteNamedObject(mn.db, userFederationConfigsTable, UserFederationConfig, realmName, configName)
+}
+
+// insertUserFederationConfig stores new user federation config of a realm with id = realmId
+func (mn *PostgresDataManager) insertUserFederationConfig(q queryer, realmId int64, realmName string,
+	cfg *data.UserFederationServiceConfig,
+) error {
+	return mn.insertNamedObject(q, userFederationConfigsTable, UserFederationConfig, realmId, realmName, cfg.Name, cfg)
+}
@@ -0,0 +1,302 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/utils/encoding"
+	sf "github.com/wissance/stringFormatter"
+)
+
+// usersPrimaryKey is a name of users table primary key constraint (username unique in a realm)
+const usersPrimaryKey = "users_pkey"
+
+// GetUsers function for getting all realm users (ordered by username)
+/* Parameters:
+ *     - realmName - name of a realm
+ * Returns: users (empty slice if realm doesn't exist or doesn't have users) and error
+ */
+func (mn *PostgresDataManager) GetUsers(ctx context.Context, realmName string) ([]data.User, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	rawUsers, err := getObjects[interface{}](mn, mn.db, User,
+		"SELECT u.data FROM users u JOIN realms r ON r.id = u.realm_id WHERE r.name = $1 ORDER BY u.username", realmName)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]data.User, len(rawUsers))
+	for i, rawUser := range rawUsers {
+		users[i] = data.CreateUser(rawUser, nil)
+	}
+	return users, nil
+}
+
+// ListUsers function for getting page of realm users ordered by username
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - page - requested page
+ * Returns: page of users (empty page if realm doesn't exist or doesn't have users) and error
+ */
+func (mn *PostgresDataManager) ListUsers(ctx context.Context, realmName string, page data.PageRequest) (*data.UsersPage, error) {
+	return mn.SearchUsers(ctx, realmName, data.UsersFilter{}, page)
+}
+
+// SearchUsers function for getting page of realm users that match filter ordered by username
+/* Username prefix, email and enabled criteria are checked by database (see getUsersFilterConditions) and page is selected by
+ * database too. Attribute predicate (jsonpath) can't be checked by database, therefore if filter has it all users that match
+ * other criteria are read and filtered by predicate.
+ * Parameters:
+ *     - realmName - name of a realm
+ *     - filter - search criteria
+ *     - page - requested page
+ * Returns: page of users (empty page if realm doesn't exist or doesn't have users) and error
+ */
+func (mn *PostgresDataManager) SearchUsers(ctx context.Context, realmName string, filter data.UsersFilter, page data.PageRequest) (*data.UsersPage, error) {
+	if err := page.Validate(); err != nil {
+		return nil, err
+	}
+	attributeFilter := data.UsersFilter{Attribute: filter.Attribute}
+	if _, err := attributeFilter.GetMatcher(); err != nil {
+		return nil, err
+	}
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	conditions, args := getUsersFilterConditions(realmName, &filter)
+	fromQuery := "FROM users u JOIN realms r ON r.id = u.realm_id WHERE " + strings.Join(conditions, " AND ")
+	if filter.Attribute != "" {
+		rawUsers, err := getObjects[interface{}](mn, mn.db, User, "SELECT u.data "+fromQuery+" ORDER BY u.username", args...)
+		if err != nil {
+			return nil, err
+		}
+		return data.GetUsersPage(createUsers(rawUsers), &attributeFilter, page)
+	}
+
+	var total int
+	if err := mn.db.QueryRowContext(mn.ctx, "SELECT COUNT(*) "+fromQuery, args...).Scan(&total); err != nil {
+		return nil, mn.getDbError("sql.Row.Scan", "PostgresDataManager.SearchUsers", err)
+	}
+	pageQuery := sf.Format("SELECT u.data {0} ORDER BY u.username LIMIT ${1} OFFSET ${2}", fromQuery, len(args)+1, len(args)+2)
+	rawUsers, err := getObjects[interface{}](mn, mn.db, User, pageQuery, append(args, page.GetLimit(), page.Offset)...)
+	if err != nil {
+		return nil, err
+	}
+	return &data.UsersPage{Users: createUsers(rawUsers), Total: total, Offset: page.Offset, Limit: page.GetLimit()}, nil
+}
+
+// GetUser function for getting realm user by username
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - userName - name of a user
+ * Returns: user and error (appErrs.ObjectNotFoundError if realm or user doesn't exist)
+ */
+func (mn *PostgresDataManager) GetUser(ctx context.Context, realmName string, userName string) (data.User, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return mn.getUser(mn.db, realmName, userName, false)
+}
+
+// GetUserById function for getting realm user by id
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - userId - identifier of a user
+ * Returns: user and error (appErrs.ObjectNotFoundError if realm or user doesn't exist)
+ */
+func (mn *PostgresDataManager) GetUserById(ctx context.Context, realmName string, userId uuid.UUID) (data.User, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	rawUser, err := getObject[interface{}](mn, mn.db, User, userId.String(), realmName,
+		"SELECT u.data FROM users u JOIN realms r ON r.id = u.realm_id WHERE r.name = $1 AND u.user_id = $2", realmName, userId)
+	if err != nil {
+		return nil, err
+	}
+	return data.CreateUser(*rawUser, nil), nil
+}
+
+// CreateUser creates new realm user, user data is stored as is (password must be already hashed) with version 1
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - userNew - new user
+ * Returns: error (appErrs.ObjectNotFoundError if realm doesn't exist, appErrs.ObjectAlreadyExistsError if user with same
+ * name or id exists)
+ */
+func (mn *PostgresDataManager) CreateUser(ctx context.Context, realmName string, userNew data.User) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return mn.inTransaction("PostgresDataManager.CreateUser", func(tx *sql.Tx) error {
+		realmId, err := mn.getRealmId(tx, realmName, false)
+		if err != nil {
+			return err
+		}
+		return mn.insertUser(tx, realmId, realmName, data.CreateUserWithVersion(userNew, 1))
+	})
+}
+
+// UpdateUser updates existing realm user, user could be renamed
+/* Stored user row is locked until transaction end, therefore version check and update are atomic
+ * Parameters:
+ *     - realmName - name of a realm
+ *     - userName - name of a user
+ *     - userNew - new user data, userNew version is an expected version of stored user (see data.CheckVersion)
+ * Returns: error (appErrs.ObjectNotFoundError if user doesn't exist, appErrs.ObjectAlreadyExistsError if other user with
+ * new name or id exists, appErrs.ObjectVersionConflictError if stored user has other version)
+ */
+func (mn *PostgresDataManager) UpdateUser(ctx context.Context, realmName string, userName string, userNew data.User) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return mn.inTransaction("PostgresDataManager.UpdateUser", func(tx *sql.Tx) error {
+		oldUser, err := mn.getUser(tx, realmName, userName, true)
+		if err != nil {
+			return err
+		}
+		if err = data.CheckVersion(string(User), userName, oldUser.GetVersion(), userNew.GetVersion()); err != nil {
+			return err
+		}
+		user := data.CreateUserWithVersion(userNew, oldUser.GetVersion()+1)
+		_, err = tx.ExecContext(mn.ctx, "UPDATE users SET username = $1, user_id = $2, data = $3 "+
+			"WHERE realm_id = (SELECT id FROM realms WHERE name = $4) AND username = $5",
+			user.GetUsername(), getUserIdValue(user), user.GetJsonString(), realmName, userName)
+		if err != nil {
+			return mn.getUserError(err, "sql.Tx.Exec", "PostgresDataManager.UpdateUser", realmName, user)
+		}
+		return nil
+	})
+}
+
+// DeleteUser removes realm user
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - userName - name of a user
+ * Returns: error (appErrs.ObjectNotFoundError if realm or user doesn't exist)
+ */
+func (mn *PostgresDataManager) DeleteUser(ctx context.Context, realmName string, userName string) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	result, err := mn.db.ExecContext(mn.ctx, "DELETE FROM users WHERE realm_id = (SELECT id FROM realms WHERE name = $1) AND username = $2",
+		realmName, userName)
+	if err != nil {
+		return mn.getDbError("sql.DB.Exec", "PostgresDataManager.DeleteUser", err)
+	}
+	return mn.checkAffected(result, "PostgresDataManager.DeleteUser", User, userName, realmName)
+}
+
+// SetPassword sets new user password, password is hashed with realm password salt, user version is incremented
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - userName - name of a user
+ *     - password - new password
+ * Returns: error (appErrs.ObjectNotFoundError if realm or user doesn't exist)
+ */
+func (mn *PostgresDataManager) SetPassword(ctx context.Context, realmName string, userName string, password string) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return mn.inTransaction("PostgresDataManager.SetPassword", func(tx *sql.Tx) error {
+		realm, err := getObject[data.Realm](mn, tx, Realm, realmName, realmName, "SELECT data FROM realms WHERE name = $1", realmName)
+		if err != nil {
+			return err
+		}
+		user, err := mn.getUser(tx, realmName, userName, true)
+		if err != nil {
+			return err
+		}
+		if err = user.SetPassword(password, encoding.NewPasswordJsonEncoder(realm.PasswordSalt)); err != nil {
+			return appErrs.NewUnknownError("SetPassword", "PostgresDataManager.SetPassword", err)
+		}
+		user.SetVersion(user.GetVersion() + 1)
+		_, err = tx.ExecContext(mn.ctx, "UPDATE users SET data = $1 WHERE realm_id = (SELECT id FROM realms WHERE name = $2) AND username = $3",
+			user.GetJsonString(), realmName, userName)
+		return mn.getDbError("sql.Tx.Exec", "PostgresDataManager.SetPassword", err)
+	})
+}
+
+// getUser reads user by username, forUpdate locks user row until transaction end
+func (mn *PostgresDataManager) getUser(q queryer, realmName string, userName string, forUpdate bool) (data.User, error) {
+	query := "SELECT u.data FROM users u JOIN realms r ON r.id = u.realm_id WHERE r.name = $1 AND u.username = $2"
+	if forUpdate {
+		query += " FOR UPDATE OF u"
+	}
+	var value []byte
+	if err := q.QueryRowContext(mn.ctx, query, realmName, userName).Scan(&value); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, appErrs.NewObjectNotFoundError(string(User), userName, sf.Format("realm: {0}", realmName))
+		}
+		return nil, mn.getDbError("sql.Row.Scan", "PostgresDataManager.getUser", err)
+	}
+	var rawUser interface{}
+	if err := json.Unmarshal(value, &rawUser); err != nil {
+		return nil, appErrs.NewUnknownError("json.Unmarshal", "PostgresDataManager.getUser", err)
+	}
+	return data.CreateUser(rawUser, nil), nil
+}
+
+// insertUser stores new user of a realm with id = realmId (user without id has NULL user_id)
+func (mn *PostgresDataManager) insertUser(q queryer, realmId int64, realmName string, user data.User) error {
+	_, err := q.ExecContext(mn.ctx, "INSERT INTO users (realm_id, username, user_id, data) VALUES ($1, $2, $3, $4)", realmId,
+		user.GetUsername(), getUserIdValue(user), user.GetJsonString())
+	if err != nil {
+		return mn.getUserError(err, "sql.Exec", "PostgresDataManager.insertUser", realmName, user)
+	}
+	return nil
+}
+
+// getUserError converts unique constraint violation to appErrs.ObjectAlreadyExistsError (with username or user id
+// depending on violated constraint), all other errors are converted by getDbError
+func (mn *PostgresDataManager) getUserError(err error, operation string, method string, realmName string, user data.User) error {
+	var pqErr *pq.Error
+	if !isUniqueViolation(err) || !errors.As(err, &pqErr) {
+		return mn.getDbError(operation, method, err)
+	}
+	if pqErr.Constraint == usersPrimaryKey {
+		return appErrs.NewObjectExistsError(string(User), user.GetUsername(), sf.Format("realm: {0}", realmName))
+	}
+	return appErrs.NewObjectExistsError(string(User), user.GetId().String(), sf.Format("realm: {0}", realmName))
+}
+
+// getUsersFilterConditions returns SQL conditions (for users u joined with realms r) and their arguments of all filter
+// criteria except attribute predicate, user is enabled unless its data has enabled: false (see data.KeyCloakUser.IsEnabled)
+func getUsersFilterConditions(realmName string, filter *data.UsersFilter) ([]string, []any) {
+	conditions := []string{"r.name = $1"}
+	args := []any{realmName}
+	addCondition := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, sf.Format(condition, len(args)))
+	}
+	if filter.UsernamePrefix != "" {
+		addCondition(`u.username LIKE ${0} ESCAPE '\'`, escapeLikePattern(filter.UsernamePrefix)+"%")
+	}
+	if filter.Email != "" {
+		addCondition("lower(u.data->'info'->>'email') = lower(${0})", filter.Email)
+	}
+	if filter.Enabled != nil {
+		addCondition("(u.data->'enabled' IS DISTINCT FROM 'false'::jsonb) = ${0}", *filter.Enabled)
+	}
+	return conditions, args
+}
+
+// escapeLikePattern escapes characters that have special meaning in LIKE patterns
+func escapeLikePattern(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// createUsers creates users from raw users data
+func createUsers(rawUsers []interface{}) []data.User {
+	users := make([]data.User, len(rawUsers))
+	for i, rawUser := range rawUsers {
+		users[i] = data.CreateUser(rawUser, nil)
+	}
+	return users
+}
+
+// getUserIdValue returns user id for user_id column, users without id have NULL user_id (NULLs are not unique)
+func getUserIdValue(user data.User) any {
+	if user.GetId() == uuid.Nil {
+		return nil
+	}
+	return user.GetId()
+}
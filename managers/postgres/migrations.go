@@ -0,0 +1,208 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	sf "github.com/wissance/stringFormatter"
+)
+
+// migrationsLockId is a key of postgres advisory lock that prevents concurrent migrations from several Ferrum instances
+const migrationsLockId int64 = 0x46657272756d
+
+// migration is a versioned database schema change
+type migration struct {
+	version     int
+	description string
+	statements  []string
+}
+
+// migrations is an ordered (by version) list of database schema changes, applied migrations must never be changed,
+// every schema change must be added as a new migration with next version
+var migrations = []migration{
+	{
+		version:     1,
+		description: "realms, clients, users, user federation configs and offline sessions",
+		statements: []string{
+			`CREATE TABLE realms (
+				id BIGSERIAL PRIMARY KEY,
+				name TEXT NOT NULL UNIQUE,
+				data JSONB NOT NULL
+			)`,
+			`CREATE TABLE clients (
+				realm_id BIGINT NOT NULL REFERENCES realms (id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				data JSONB NOT NULL,
+				PRIMARY KEY (realm_id, name)
+			)`,
+			`CREATE TABLE users (
+				realm_id BIGINT NOT NULL REFERENCES realms (id) ON DELETE CASCADE,
+				username TEXT NOT NULL,
+				user_id UUID,
+				data JSONB NOT NULL,
+				PRIMARY KEY (realm_id, username),
+				UNIQUE (realm_id, user_id)
+			)`,
+			`CREATE TABLE user_federation_configs (
+				realm_id BIGINT NOT NULL REFERENCES realms (id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				data JSONB NOT NULL,
+				PRIMARY KEY (realm_id, name)
+			)`,
+			`CREATE TABLE offline_sessions (
+				realm_id BIGINT NOT NULL REFERENCES realms (id) ON DELETE CASCADE,
+				id UUID NOT NULL,
+				user_id UUID NOT NULL,
+				started TIMESTAMPTZ NOT NULL,
+				expired TIMESTAMPTZ NOT NULL,
+				data JSONB NOT NULL,
+				PRIMARY KEY (realm_id, id)
+			)`,
+			`CREATE INDEX offline_sessions_user_idx ON offline_sessions (realm_id, user_id)`,
+		},
+	},
+	{
+		version:     2,
+		description: "realms and clients revisions",
+		statements: []string{
+			`CREATE TABLE revisions (
+				realm_id BIGINT NOT NULL REFERENCES realms (id) ON DELETE CASCADE,
+				object_type TEXT NOT NULL,
+				object_name TEXT NOT NULL,
+				version BIGINT NOT NULL,
+				created TIMESTAMPTZ NOT NULL,
+				author TEXT NOT NULL,
+				data JSONB NOT NULL,
+				PRIMARY KEY (realm_id, object_type, object_name, version)
+			)`,
+		},
+	},
+}
+
+// Migrate applies migrations that were not applied to database schema yet (see managers.SchemaMigrator)
+/* Migrations are applied without operation deadline (they could wait for migrations of other instances), therefore ctx
+ * should have own deadline
+ * Parameters:
+ *     - ctx - context of operation
+ *     - dryRun - if true migrations are not applied, they are only returned in report
+ * Returns: migration report and error
+ */
+func (mn *PostgresDataManager) Migrate(ctx context.Context, dryRun bool) (*data.MigrationReport, error) {
+	migrator := *mn
+	migrator.ctx = ctx
+	report, err := migrator.applyMigrations(dryRun)
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		mn.migrated.Store(true)
+	}
+	return report, nil
+}
+
+// applyMigrations creates schema and applies all not applied migrations in one transaction
+/* Applied migrations versions are stored in schema_migrations table, migrations are executed under advisory lock therefore
+ * several instances could be started simultaneously. Function fails if database schema version is newer than the latest
+ * known migration (database was migrated by newer Ferrum version)
+ * Parameters:
+ *     - dryRun - if true schema is not changed, migrations that would be applied are only returned in report
+ * Returns: migration report and error
+ */
+func (mn *PostgresDataManager) applyMigrations(dryRun bool) (*data.MigrationReport, error) {
+	if dryRun {
+		return mn.getMigrationReport(mn.db, true)
+	}
+	var report *data.MigrationReport
+	err := mn.inTransaction("PostgresDataManager.applyMigrations", func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(mn.ctx, "SELECT pg_advisory_xact_lock($1)", migrationsLockId); err != nil {
+			return mn.getDbError("sql.Tx.Exec", "PostgresDataManager.applyMigrations", err)
+		}
+		statements := []string{
+			sf.Format("CREATE SCHEMA IF NOT EXISTS {0}", pq.QuoteIdentifier(mn.schema)),
+			`CREATE TABLE IF NOT EXISTS schema_migrations (
+				version INTEGER PRIMARY KEY,
+				description TEXT NOT NULL,
+				applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+			)`,
+		}
+		for _, statement := range statements {
+			if _, err := tx.ExecContext(mn.ctx, statement); err != nil {
+				return mn.getDbError("sql.Tx.Exec", "PostgresDataManager.applyMigrations", err)
+			}
+		}
+		var err error
+		report, err = mn.getMigrationReport(tx, false)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if m.version <= report.SchemaVersion {
+				continue
+			}
+			for _, statement := range m.statements {
+				if _, err = tx.ExecContext(mn.ctx, statement); err != nil {
+					mn.logger.Error(sf.Format("An error occurred during postgres schema migration {0} (\"{1}\"): {2}",
+						m.version, m.description, err.Error()))
+					return mn.getDbError("sql.Tx.Exec", "PostgresDataManager.applyMigrations", err)
+				}
+			}
+			if _, err = tx.ExecContext(mn.ctx, "INSERT INTO schema_migrations (version, description) VALUES ($1, $2)", m.version,
+				m.description); err != nil {
+				return mn.getDbError("sql.Tx.Exec", "PostgresDataManager.applyMigrations", err)
+			}
+			mn.logger.Info(sf.Format("Postgres schema \"{0}\" was migrated to version {1}: {2}", mn.schema, m.version, m.description))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// getMigrationReport returns report with migrations that are not applied to database schema yet
+/* Parameters:
+ *     - q - database or transaction
+ *     - dryRun - report DryRun value
+ * Returns: migration report and error (appErrs.UnknownError if database schema version is newer than the latest known migration)
+ */
+func (mn *PostgresDataManager) getMigrationReport(q queryer, dryRun bool) (*data.MigrationReport, error) {
+	currentVersion, err := mn.getSchemaVersion(q)
+	if err != nil {
+		return nil, err
+	}
+	latestVersion := migrations[len(migrations)-1].version
+	if currentVersion > latestVersion {
+		mn.logger.Error(sf.Format("Postgres schema \"{0}\" version {1} is newer than supported version {2}", mn.schema,
+			currentVersion, latestVersion))
+		return nil, appErrs.NewUnknownError("getMigrationReport", "PostgresDataManager.getMigrationReport",
+			errors.New(sf.Format("schema version {0} is not supported", currentVersion)))
+	}
+	report := &data.MigrationReport{SchemaVersion: currentVersion, TargetVersion: latestVersion, Migrations: []data.Migration{}, DryRun: dryRun}
+	for _, m := range migrations {
+		if m.version > currentVersion {
+			report.Migrations = append(report.Migrations, data.Migration{Version: m.version, Description: m.description})
+		}
+	}
+	return report, nil
+}
+
+// getSchemaVersion returns version of the latest applied migration (0 if there are no applied migrations or schema doesn't exist)
+func (mn *PostgresDataManager) getSchemaVersion(q queryer) (int, error) {
+	var exists bool
+	if err := q.QueryRowContext(mn.ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return 0, mn.getDbError("sql.Row.Scan", "PostgresDataManager.getSchemaVersion", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+	var version int
+	if err := q.QueryRowContext(mn.ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, mn.getDbError("sql.Row.Scan", "PostgresDataManager.getSchemaVersion", err)
+	}
+	return version, nil
+}
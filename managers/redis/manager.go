@@ -4,13 +4,18 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	e "errors"
 	"fmt"
+	"net"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/wissance/Ferrum/errors"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/wissance/Ferrum/config"
+	"github.com/wissance/Ferrum/data"
 	"github.com/wissance/Ferrum/logging"
 	sf "github.com/wissance/stringFormatter"
 )
@@ -21,9 +26,13 @@ const (
 	realmKeyTemplate                   = "{0}.realm_{1}"
 	realmClientsKeyTemplate            = "{0}.realm_{1}_clients"
 	clientKeyTemplate                  = "{0}.{1}_client_{2}"
-	realmUsersKeyTemplate              = "{0}.realm_{1}_users"
+	realmUserNamesKeyTemplate          = "{0}.realm_{1}_user_names"
+	realmUserIdsKeyTemplate            = "{0}.realm_{1}_user_ids"
+	realmUserEmailsKeyTemplate         = "{0}.realm_{1}_user_emails"
 	realmUserFederationServiceTemplate = "{0}.realm_{1}_user_federations"
-	// realmUsersFullDataKeyTemplate = "{0}.realm_{1}_users_full_data"
+	offlineSessionKeyTemplate          = "{0}.realm_{1}_offline_session_{2}"
+	userOfflineSessionsKeyTemplate     = "{0}.realm_{1}_user_{2}_offline_sessions"
+	realmRevisionsKeyTemplate          = "{0}.realm_{1}_revisions"
 )
 
 type objectType string
@@ -32,9 +41,13 @@ const (
 	Realm                     objectType = "realm"
 	RealmClients              objectType = "realm clients"
 	RealmUsers                objectType = "realm users"
+	RealmUserIds              objectType = "realm users ids"
+	RealmUserEmails           objectType = "realm users emails"
 	RealmUserFederationConfig objectType = " realm user federation config"
 	Client                    objectType = "client"
 	User                      objectType = "user"
+	OfflineSession            objectType = "offline session"
+	RealmRevisions            objectType = "realm revisions"
 )
 
 const defaultNamespace = "fe"
@@ -52,23 +65,49 @@ const defaultNamespace = "fe"
  *    could be received by key - fe.wissance_client_homeApp
  * 4. Every User in Redis storing by it own key forming by userName + template (userKeyTemplate) -> i.e. user with (ID: 6e09faca-1004-11ee-be56-0242ac120002 Name: homeApp) stored
  *    by key fe.wissance_user_homeApp
- * 5. Client to Realm and User to Realm relation stored by separate keys forming using template and realm name, these relations stores array of data.ExtendedIdentifier
- *    that wires together Realm Name with User.ID and User.Name.
+ * 5. Client to Realm relation stored by separate key forming using template and realm name, this relation stores array of data.ExtendedIdentifier
+ *    that wires together Realm Name with Client.ID and Client.Name.
+ *    User to Realm relation is a SORTED SET of usernames with score 0 (realmUserNamesKeyTemplate), therefore usernames are ordered
+ *    lexicographically and page of users (with username prefix) is read by ZRANGE BYLEX without reading all usernames of realm.
+ *    Users are also indexed by id and by email: HASHes with username as a value (realmUserIdsKeyTemplate, realmUserEmailsKeyTemplate),
+ *    therefore user could be found by id or email with two commands regardless of number of users in realm. Users without id or email
+ *    are not indexed by them.
+ * 6. Offline sessions (data.OfflineSession) are stored by key forming from realm name and session id (offlineSessionKeyTemplate)
+ *    with TTL until offline session expiration, ids of user offline sessions are stored in a SET (userOfflineSessionsKeyTemplate)
+ * 7. Revisions of realm and realm clients (data.Revision) are stored in a HASH by key forming from realm name (realmRevisionsKeyTemplate),
+ *    field "realm" contains JSON array of realm revisions, field "client:{name}" contains JSON array of client revisions
  *    IMPORTANT NOTES:
- *    1. When save Client or User don't forget to save relations in Redis too (see templates realmClientsKeyTemplate && realmUsersKeyTemplate)
- *    2. When add/modify new or existing user don't forget to update realmUsersFullDataKeyTemplate maybe this collection will be removed in future but currently
- *       we have it.
+ *    1. When save Client or User don't forget to save relations in Redis too (see templates realmClientsKeyTemplate && realmUserNamesKeyTemplate)
+ *    2. When add/modify new or existing user don't forget to update user indexes: usernames SORTED SET (realmUserNamesKeyTemplate), id and email
+ *       HASHes (realmUserIdsKeyTemplate, realmUserEmailsKeyTemplate), use addUserToRealm and deleteUserFromRealm (old user) for it, otherwise
+ *       user could not be found by new id or email or could be found by old ones.
+ *    3. Operations that change several keys (i.e. object and relation) must be executed in transaction (see transaction), otherwise failure
+ *       in the middle of operation leaves orphaned objects or dangling relations.
  */
 type RedisDataManager struct {
-	namespace   string
-	redisOption *redis.Options
-	redisClient *redis.Client
-	logger      *logging.AppLogger
-	ctx         context.Context
+	namespace        string
+	redisOption      *redis.UniversalOptions
+	redisClient      redis.UniversalClient
+	logger           *logging.AppLogger
+	ctx              context.Context
+	operationTimeout time.Duration
+	// pipe is a pipeline of transaction that operation is executed in (nil outside of transaction), write commands are queued in it
+	pipe redis.Pipeliner
+	// migrations is shared by all manager copies (see migrate)
+	migrations *migrationsState
+	// revisionsLimit is a max number of kept revisions of realm or client (see config.RevisionsLimit)
+	revisionsLimit int
 }
 
+// maxTransactionAttempts is a number of attempts to execute transaction if watched keys were changed by someone else
+const maxTransactionAttempts = 10
+
+// usersSearchBatchSize is a number of users that are read at once during users search (see SearchUsers)
+const usersSearchBatchSize = 500
+
 // IsAvailable methods that checks whether DataContext could be used or not
-/* Availability means that redisClient is not NULL and Ready for receive requests
+/* Availability means that redisClient is not NULL and Ready for receive requests and data is migrated (outdated data is
+ * available only for reading with data.WithOutdatedDataReading context)
  * Parameters: no
  * Returns true if DataContext is available
  */
@@ -81,48 +120,158 @@ func (mn *RedisDataManager) IsAvailable() bool {
 	_, err := cmd.Result()
 	if err != nil {
 		mn.logger.Debug(sf.Format("Redis Ping executed with error: {0}", err.Error()))
+		return false
 	}
-	return err == nil
+	// data that is not migrated can't be used
+	return data.IsOutdatedDataReading(mn.ctx) || mn.migrate() == nil
 }
 
 // CreateRedisDataManager is factory function for instance of RedisDataManager creation
 /* Simply creates instance of RedisDataManager and initializes redis client, this function requires config.Namespace to be set up in configs, otherwise
- * defaultNamespace is using
+ * defaultNamespace is using. Data of namespace that was stored by previous Ferrum versions is migrated (see applyMigrations), if Redis is not
+ * available migrations are applied when it becomes available. If config.AutoMigrate option is false data is not migrated, manager is not
+ * available until data is migrated by Migrate
  * Parameters:
  *     - dataSourceCfg contains Redis specific settings in Options map (see allowed keys of map in config.DataSourceConnOption)
  *     - logger - initialized logger instance
  */
 func CreateRedisDataManager(dataSourceCfg *config.DataSourceConfig, logger *logging.AppLogger) (*RedisDataManager, error) {
-	// todo(UMV): todo provide an error handling
+	rClient, opts := CreateRedisClient(dataSourceCfg, logger)
+	mn := &RedisDataManager{
+		logger: logger, redisOption: opts, redisClient: rClient, ctx: context.Background(),
+		namespace: GetNamespace(dataSourceCfg), operationTimeout: dataSourceCfg.GetOperationTimeout(), migrations: &migrationsState{autoMigrate: dataSourceCfg.IsAutoMigrateEnabled()},
+		revisionsLimit: dataSourceCfg.GetRevisionsLimit(),
+	}
+	if mn.redisClient.Ping(mn.ctx).Err() != nil {
+		logger.Warn(sf.Format("Redis \"{0}\" is not available, namespace \"{1}\" data will be migrated when it becomes available",
+			mn.getRedisAddress(), mn.namespace))
+		return mn, nil
+	}
+	// data that is not migrated automatically is checked only, data store is not available until data is migrated
+	if err := mn.migrate(); err != nil && mn.migrations.autoMigrate {
+		_ = rClient.Close()
+		return nil, err
+	}
+	return mn, nil
+}
+
+// ClientProvider is implemented by data stores that keep data in Redis (RedisDataManager and data stores that wrap it),
+// other components that store their data in the same Redis (i.e. sessions store) share client of data store
+type ClientProvider interface {
+	// GetRedisClient returns client of data store (nil if data store doesn't keep data in Redis)
+	GetRedisClient() redis.UniversalClient
+}
+
+// GetRedisClient returns client of manager, other components that store their data in the same Redis (i.e. sessions store)
+// share it instead of opening own connections pool
+func (mn *RedisDataManager) GetRedisClient() redis.UniversalClient {
+	return mn.redisClient
+}
+
+// withOperationContext returns copy of manager that executes all Redis commands with context of one operation
+/* Every DataContext method starts with this call, therefore all Redis commands of operation (including nested DataContext
+ * calls that must receive mn.ctx) are cancelled together when ctx is cancelled (i.e. client disconnected) or when
+ * operationTimeout passed. Manager itself is never changed, therefore it could be used concurrently.
+ * Parameters:
+ *     - ctx - context of operation (usually context of HTTP request)
+ * Returns: manager copy and cancel function that must be called when operation is completed
+ */
+func (mn *RedisDataManager) withOperationContext(ctx context.Context) (*RedisDataManager, context.CancelFunc) {
+	operationMn := *mn
+	var cancel context.CancelFunc
+	if mn.operationTimeout > 0 {
+		operationMn.ctx, cancel = context.WithTimeout(ctx, mn.operationTimeout)
+	} else {
+		operationMn.ctx, cancel = context.WithCancel(ctx)
+	}
+	return &operationMn, cancel
+}
+
+// CreateRedisClient creates go-redis client using data source config
+/* This function is using by RedisDataManager and by other components that store their data in the same Redis
+ * (i.e. sessions store), they also should use GetNamespace to build keys. Client type depends on config.RedisModeOption:
+ * single server client, failover client (config.RedisSentinel) or cluster client (config.RedisCluster)
+ * Parameters:
+ *     - dataSourceCfg contains Redis specific settings in Options map (see allowed keys of map in config.DataSourceConnOption)
+ *     - logger - initialized logger instance
+ * Returns: client and options that were used for client creation
+ */
+func CreateRedisClient(dataSourceCfg *config.DataSourceConfig, logger *logging.AppLogger) (redis.UniversalClient, *redis.UniversalOptions) {
 	opts := buildRedisConfig(dataSourceCfg, logger)
-	rClient := redis.NewClient(opts)
+	switch dataSourceCfg.GetRedisMode() {
+	case config.RedisSentinel:
+		return redis.NewFailoverClient(opts.Failover()), opts
+	case config.RedisCluster:
+		return redis.NewClusterClient(opts.Cluster()), opts
+	default:
+		return redis.NewClient(opts.Simple()), opts
+	}
+}
+
+// GetNamespace returns prefix for all keys from data source config (config.Namespace option) or defaultNamespace if option is not set
+/* In config.RedisCluster mode namespace is a hash tag (i.e. {fe}), therefore all keys of namespace are stored in one cluster slot,
+ * otherwise keys that are changed in one transaction or are read by one MGET could be stored on different cluster nodes.
+ * Single slot is intentional: per-realm hash tags are not enough, because realm rename (UpdateRealm) moves keys of one realm to
+ * keys of another realm in one transaction, therefore data of one namespace is not sharded between cluster nodes
+ */
+func GetNamespace(dataSourceCfg *config.DataSourceConfig) string {
 	namespace, ok := dataSourceCfg.Options[config.Namespace]
 	if !ok || len(namespace) == 0 {
 		namespace = defaultNamespace
 	}
-	mn := &RedisDataManager{
-		logger: logger, redisOption: opts, redisClient: rClient, ctx: context.Background(),
-		namespace: namespace,
+	if dataSourceCfg.GetRedisMode() == config.RedisCluster {
+		namespace = "{" + namespace + "}"
 	}
-	return mn, nil
+	return namespace
 }
 
-// buildRedisConfig builds redis.Options from map of values by known in config package set of keys
-func buildRedisConfig(dataSourceCfd *config.DataSourceConfig, logger *logging.AppLogger) *redis.Options {
-	dbNum, err := strconv.Atoi(dataSourceCfd.Options[config.DbNumber])
-	if err != nil {
-		logger.Error(sf.Format("can't be because we already called Validate(), but in any case: parsing error: {0}", err.Error()))
-		return nil
+// buildRedisConfig builds redis.UniversalOptions from map of values by known in config package set of keys
+func buildRedisConfig(dataSourceCfd *config.DataSourceConfig, logger *logging.AppLogger) *redis.UniversalOptions {
+	opts := redis.UniversalOptions{
+		Addrs:      dataSourceCfd.GetRedisAddresses(),
+		MasterName: dataSourceCfd.Options[config.SentinelMasterName],
+		// without it go-redis ignores operation context deadline (config.DataOperationTimeout) waiting for server response
+		ContextTimeoutEnabled: true,
+	}
+	// db_number is optional in cluster mode
+	if dbNumber, ok := dataSourceCfd.Options[config.DbNumber]; ok || dataSourceCfd.GetRedisMode() != config.RedisCluster {
+		dbNum, err := strconv.Atoi(dbNumber)
+		if err != nil {
+			logger.Error(sf.Format("can't be because we already called Validate(), but in any case: parsing error: {0}", err.Error()))
+		}
+		opts.DB = dbNum
+	}
+	// passing connection pool settings, absent options mean go-redis defaults
+	intOptions := map[config.DataSourceConnOption]*int{
+		config.PoolSize:     &opts.PoolSize,
+		config.MinIdleConns: &opts.MinIdleConns,
+		config.MaxRetries:   &opts.MaxRetries,
+	}
+	for option, value := range intOptions {
+		if intValue, err := strconv.Atoi(dataSourceCfd.Options[option]); err == nil {
+			*value = intValue
+		}
 	}
-	opts := redis.Options{
-		Addr: dataSourceCfd.Source,
-		DB:   dbNum,
+	timeoutOptions := map[config.DataSourceConnOption]*time.Duration{
+		config.ReadTimeout:  &opts.ReadTimeout,
+		config.WriteTimeout: &opts.WriteTimeout,
+	}
+	for option, value := range timeoutOptions {
+		if timeout, err := strconv.Atoi(dataSourceCfd.Options[option]); err == nil {
+			// go-redis treats -1 (not -1 ms) as no timeout
+			if timeout < 0 {
+				*value = -1
+			} else {
+				*value = time.Duration(timeout) * time.Millisecond
+			}
+		}
 	}
 	// passing credentials if we have it
 	if dataSourceCfd.Credentials != nil {
 		opts.Username = dataSourceCfd.Credentials.Username
 		opts.Password = dataSourceCfd.Credentials.Password
 	}
+	opts.SentinelPassword = dataSourceCfd.Options[config.SentinelPassword]
 	// passing TLS if we have it
 	val, ok := dataSourceCfd.Options[config.UseTls]
 	if ok {
@@ -142,7 +291,151 @@ func buildRedisConfig(dataSourceCfd *config.DataSourceConfig, logger *logging.Ap
 	return &opts
 }
 
-// TODO(SIA) add function keyExists
+// GetRedisError converts error of Redis command that was executed with ctx
+/* Command that was not completed because operation was cancelled (i.e. client disconnected), operation deadline passed
+ * (config.DataOperationTimeout) or Redis is not reachable returns errors.DataProviderNotAvailable, other errors are returned as is.
+ * This function is using by RedisDataManager and by other components that store their data in the same Redis (i.e. sessions store)
+ * Parameters:
+ *     - ctx - context that command was executed with
+ *     - address - Redis address for error (see GetRedisAddress), it is taken from config because client of some modes
+ *       (i.e. failover client) doesn't know addresses it was configured with
+ *     - err - command error
+ * Returns: error
+ */
+func GetRedisError(ctx context.Context, address string, err error) error {
+	var netErr net.Error
+	if ctx.Err() != nil || e.Is(err, context.DeadlineExceeded) || e.Is(err, context.Canceled) || e.As(err, &netErr) {
+		return errors.NewDataProviderNotAvailable(string(config.REDIS), address)
+	}
+	return err
+}
+
+// GetRedisAddress returns address of Redis from data source config for errors: comma separated addresses of cluster nodes or
+// sentinels, sentinels addresses are prefixed with master name (config.SentinelMasterName)
+func GetRedisAddress(dataSourceCfg *config.DataSourceConfig) string {
+	return formatRedisAddress(dataSourceCfg.GetRedisAddresses(), dataSourceCfg.Options[config.SentinelMasterName])
+}
+
+// getRedisAddress returns address of Redis (comma separated addresses of sentinels or cluster nodes) for errors
+func (mn *RedisDataManager) getRedisAddress() string {
+	return formatRedisAddress(mn.redisOption.Addrs, mn.redisOption.MasterName)
+}
+
+func formatRedisAddress(addrs []string, masterName string) string {
+	address := strings.Join(addrs, ",")
+	if len(masterName) > 0 {
+		return masterName + "@" + address
+	}
+	return address
+}
+
+// transaction executes operation atomically, all write commands of operation are executed in MULTI/EXEC at once
+/* Transaction is executed by ExecuteTransaction. Operation receives manager copy that reads data at once as usual, but queues
+ * write commands (upsertRedisString, appendStringToRedisList, deleteRedisObject) into transaction, therefore operation can't
+ * read data it has written. Operation that is called inside another transaction (i.e. DeleteUser inside UpdateUser) becomes
+ * a part of it.
+ * Parameters:
+ *     - method - name of method that executes operation (for logging and errors)
+ *     - operation - function that executes operation with manager copy
+ *     - keys - keys that operation reads and changes
+ * Returns: error of operation or error of transaction execution
+ */
+func (mn *RedisDataManager) transaction(method string, operation func(mn *RedisDataManager) error, keys ...string) error {
+	if mn.pipe != nil {
+		return operation(mn)
+	}
+	return ExecuteTransaction(mn.ctx, mn.redisClient, mn.getRedisAddress(), mn.logger, method, func(_ *redis.Tx, pipe redis.Pipeliner) error {
+		txMn := *mn
+		txMn.pipe = pipe
+		return operation(&txMn)
+	}, keys...)
+}
+
+// ExecuteTransaction executes operation atomically, all write commands that operation queues into pipe are executed in MULTI/EXEC at once
+/* Keys that operation depends on are watched (WATCH) before operation starts, if someone else changes any of them before EXEC,
+ * transaction is not executed and operation is repeated (up to maxTransactionAttempts times). Therefore, operation either changes
+ * all keys or nothing at all (i.e. if Redis becomes unavailable or operation fails in the middle), and data that operation read
+ * before writing is not changed by concurrent operations. This function is using by RedisDataManager and by other components
+ * that store their data in the same Redis (i.e. sessions store)
+ * Parameters:
+ *     - ctx - context of operation
+ *     - redisClient - client that executes transaction
+ *     - address - Redis address for errors (see GetRedisAddress)
+ *     - logger - logger instance
+ *     - method - name of method that executes operation (for logging and errors)
+ *     - operation - function that reads data (with tx to use connection that watches keys or with redisClient) and
+ *                   queues write commands into pipe
+ *     - keys - keys that operation reads and changes
+ * Returns: error of operation or error of transaction execution
+ */
+func ExecuteTransaction(ctx context.Context, redisClient redis.UniversalClient, address string, logger *logging.AppLogger, method string,
+	operation func(tx *redis.Tx, pipe redis.Pipeliner) error, keys ...string,
+) error {
+	for attempt := 1; attempt <= maxTransactionAttempts; attempt++ {
+		var operationErr error
+		err := redisClient.Watch(ctx, func(tx *redis.Tx) error {
+			_, txErr := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				operationErr = operation(tx, pipe)
+				return operationErr
+			})
+			return txErr
+		}, keys...)
+		if operationErr != nil {
+			return operationErr
+		}
+		if err == nil {
+			return nil
+		}
+		if !e.Is(err, redis.TxFailedErr) {
+			logger.Warn(sf.Format("An error occurred during transaction execution of {0}: {1}", method, err.Error()))
+			return errors.NewUnknownError("TxPipelined", method, GetRedisError(ctx, address, err))
+		}
+		logger.Debug(sf.Format("Transaction of {0} was not executed because watched keys were changed, attempt: {1}", method, attempt))
+	}
+	return errors.NewUnknownError("TxPipelined", method, redis.TxFailedErr)
+}
+
+// extendTtlScript sets TTL (ARGV[1] milliseconds) of key (KEYS[1]) if key doesn't have TTL or its TTL is shorter
+const extendTtlScript = `if redis.call('PTTL', KEYS[1]) < tonumber(ARGV[1]) then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return 0`
+
+// ExtendTtl queues into pipe setting of key TTL that only extends TTL: key without TTL gets it, key with a longer TTL keeps own
+/* Script is using instead of EXPIRE NX and EXPIRE GT options because they require Redis 7.0
+ * Parameters:
+ *     - ctx - context of operation
+ *     - pipe - pipeline (usually of transaction) that key was changed by
+ *     - key - key (i.e. index set) which TTL is extended
+ *     - ttl - new key TTL
+ */
+func ExtendTtl(ctx context.Context, pipe redis.Pipeliner, key string, ttl time.Duration) {
+	pipe.Eval(ctx, extendTtlScript, []string{key}, ttl.Milliseconds())
+}
+
+// writer returns pipeline of transaction if operation is executed in transaction, otherwise redis client
+func (mn *RedisDataManager) writer() redis.Cmdable {
+	if mn.pipe != nil {
+		return mn.pipe
+	}
+	return mn.redisClient
+}
+
+// keyExists checks whether Redis has a key
+/* Arguments:
+ *    - objName - type of object (for logger)
+ *    - objKey - key object in redis
+ * Returns: true if key exists and error
+ */
+func (mn *RedisDataManager) keyExists(objName objectType, objKey string) (bool, error) {
+	redisIntCmd := mn.redisClient.Exists(mn.ctx, objKey)
+	if redisIntCmd.Err() != nil {
+		mn.logger.Warn(sf.Format("An error occurred during Exists {0}: \"{1}\" from Redis server", objName, objKey))
+		return false, GetRedisError(mn.ctx, mn.getRedisAddress(), redisIntCmd.Err())
+	}
+	return redisIntCmd.Val() > 0, nil
+}
+
 // TODO(SIA) Add a function to delete multiple keys at once
 
 // upsertRedisString - inserting or updating a value by key
@@ -154,26 +447,37 @@ func buildRedisConfig(dataSourceCfd *config.DataSourceConfig, logger *logging.Ap
  * Returns: error
  */
 func (mn *RedisDataManager) upsertRedisString(objName objectType, objKey string, objValue string) error {
-	statusCmd := mn.redisClient.Set(mn.ctx, objKey, objValue, 0)
+	statusCmd := mn.writer().Set(mn.ctx, objKey, objValue, 0)
 	if statusCmd.Err() != nil {
 		mn.logger.Warn(sf.Format("An error occurred during Set {0}: \"{1}\" from Redis server", objName, objKey))
-		return statusCmd.Err()
+		return GetRedisError(mn.ctx, mn.getRedisAddress(), statusCmd.Err())
 	}
 	return nil
 }
 
 // deleteRedisObject - delete key
-/* Returns an error, if 0 items are deleted
+/* Returns an error, if 0 items are deleted (in transaction key existence is checked before deletion)
  * Arguments:
  *    - objName - type of object = resource or table (basically is using for a logger)
  *    - objKey - key object in redis
  * Returns: error
  */
 func (mn *RedisDataManager) deleteRedisObject(objName objectType, objKey string) error {
+	if mn.pipe != nil {
+		exists, err := mn.keyExists(objName, objKey)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			mn.logger.Warn(sf.Format("An error occurred during Del, key doesn't exist {0}: \"{1}\" in Redis server", objName, objKey))
+			return errors.NewObjectNotFoundError(string(objName), objKey, "")
+		}
+		return mn.pipe.Del(mn.ctx, objKey).Err()
+	}
 	redisIntCmd := mn.redisClient.Del(mn.ctx, objKey)
 	if redisIntCmd.Err() != nil {
 		mn.logger.Warn(sf.Format("An error occurred during Del {0}: \"{1}\" from Redis server", objName, objKey))
-		return redisIntCmd.Err()
+		return GetRedisError(mn.ctx, mn.getRedisAddress(), redisIntCmd.Err())
 	}
 	res := redisIntCmd.Val()
 	if res == 0 {
@@ -196,7 +500,7 @@ func (mn *RedisDataManager) deleteRedisListItem(objName objectType, objKey strin
 	//.Del(mn.ctx, objKey)
 	if redisIntCmd.Err() != nil {
 		mn.logger.Warn(sf.Format("An error occurred during Del {0}: \"{1}\" from Redis server", objName, objKey))
-		return redisIntCmd.Err()
+		return GetRedisError(mn.ctx, mn.getRedisAddress(), redisIntCmd.Err())
 	}
 	res := redisIntCmd.Val()
 	if res == 0 {
@@ -215,16 +519,100 @@ func (mn *RedisDataManager) deleteRedisListItem(objName objectType, objKey strin
  * Returns: error
  */
 func (mn *RedisDataManager) appendStringToRedisList(objName objectType, objKey string, objValue string) error {
-	redisIntCmd := mn.redisClient.RPush(mn.ctx, objKey, objValue)
+	redisIntCmd := mn.writer().RPush(mn.ctx, objKey, objValue)
 	if redisIntCmd.Err() != nil {
 		mn.logger.Warn(sf.Format("An error occurred during RPush {0}: \"{1}\" from Redis server", objName, objKey))
-		return redisIntCmd.Err()
+		return GetRedisError(mn.ctx, mn.getRedisAddress(), redisIntCmd.Err())
+	}
+	return nil
+}
+
+// addRedisSortedSetItem - adds an item to the SORTED SET with score 0, items with equal scores are ordered lexicographically
+/* Arguments:
+ *    - objName - for logger
+ *    - objKey - key object in redis
+ *    - item - new SORTED SET item
+ * Returns: error
+ */
+func (mn *RedisDataManager) addRedisSortedSetItem(objName objectType, objKey string, item string) error {
+	redisIntCmd := mn.writer().ZAdd(mn.ctx, objKey, redis.Z{Score: 0, Member: item})
+	if redisIntCmd.Err() != nil {
+		mn.logger.Warn(sf.Format("An error occurred during ZAdd {0}: \"{1}\" from Redis server", objName, objKey))
+		return GetRedisError(mn.ctx, mn.getRedisAddress(), redisIntCmd.Err())
+	}
+	return nil
+}
+
+// deleteRedisSortedSetItem - removes an item from the SORTED SET, absence of item is not an error
+/* Arguments:
+ *    - objName - for logger
+ *    - objKey - key object in redis
+ *    - item - SORTED SET item to remove
+ * Returns: error
+ */
+func (mn *RedisDataManager) deleteRedisSortedSetItem(objName objectType, objKey string, item string) error {
+	redisIntCmd := mn.writer().ZRem(mn.ctx, objKey, item)
+	if redisIntCmd.Err() != nil {
+		mn.logger.Warn(sf.Format("An error occurred during ZRem {0}: \"{1}\" from Redis server", objName, objKey))
+		return GetRedisError(mn.ctx, mn.getRedisAddress(), redisIntCmd.Err())
 	}
 	return nil
 }
 
+// upsertRedisHashField - inserting or updating a HASH field value
+/* Arguments:
+ *    - objName - for logger
+ *    - objKey - key object in redis
+ *    - field - HASH field
+ *    - value - new field value
+ * Returns: error
+ */
+func (mn *RedisDataManager) upsertRedisHashField(objName objectType, objKey string, field string, value string) error {
+	redisIntCmd := mn.writer().HSet(mn.ctx, objKey, field, value)
+	if redisIntCmd.Err() != nil {
+		mn.logger.Warn(sf.Format("An error occurred during HSet {0}: \"{1}\" from Redis server", objName, objKey))
+		return GetRedisError(mn.ctx, mn.getRedisAddress(), redisIntCmd.Err())
+	}
+	return nil
+}
+
+// deleteRedisHashField - removes a HASH field, absence of field is not an error
+/* Arguments:
+ *    - objName - for logger
+ *    - objKey - key object in redis
+ *    - field - HASH field to remove
+ * Returns: error
+ */
+func (mn *RedisDataManager) deleteRedisHashField(objName objectType, objKey string, field string) error {
+	redisIntCmd := mn.writer().HDel(mn.ctx, objKey, field)
+	if redisIntCmd.Err() != nil {
+		mn.logger.Warn(sf.Format("An error occurred during HDel {0}: \"{1}\" from Redis server", objName, objKey))
+		return GetRedisError(mn.ctx, mn.getRedisAddress(), redisIntCmd.Err())
+	}
+	return nil
+}
+
+// getRedisHashField - get a HASH field value
+/* Arguments:
+ *    - objName - type of object (for logger and error)
+ *    - objKey - key object in redis
+ *    - field - HASH field
+ * Returns: field value and error (errors.ObjectNotFoundError if HASH doesn't have field)
+ */
+func (mn *RedisDataManager) getRedisHashField(objName objectType, objKey string, field string) (string, error) {
+	redisCmd := mn.redisClient.HGet(mn.ctx, objKey, field)
+	if redisCmd.Err() != nil {
+		if redisCmd.Err() == redis.Nil {
+			return "", errors.NewObjectNotFoundError(string(objName), field, "")
+		}
+		mn.logger.Warn(sf.Format("An error occurred during HGet {0}: \"{1}\" from Redis server", objName, objKey))
+		return "", GetRedisError(mn.ctx, mn.getRedisAddress(), redisCmd.Err())
+	}
+	return redisCmd.Val(), nil
+}
+
 // getSingleRedisObject is a method that DOESN'T work with List type object, only a String object type.
-func getSingleRedisObject[T any](redisClient *redis.Client, ctx context.Context, logger *logging.AppLogger,
+func getSingleRedisObject[T any](redisClient redis.UniversalClient, address string, ctx context.Context, logger *logging.AppLogger,
 	objName objectType, objKey string,
 ) (*T, error) {
 	redisCmd := redisClient.Get(ctx, objKey)
@@ -233,7 +621,7 @@ func getSingleRedisObject[T any](redisClient *redis.Client, ctx context.Context,
 		if redisCmd.Err() == redis.Nil {
 			return nil, errors.NewObjectNotFoundError(string(objName), objKey, "")
 		}
-		return nil, redisCmd.Err()
+		return nil, GetRedisError(ctx, address, redisCmd.Err())
 	}
 
 	var obj T
@@ -247,27 +635,32 @@ func getSingleRedisObject[T any](redisClient *redis.Client, ctx context.Context,
 }
 
 // getMultipleRedisObjects is a method that DOESN'T work with List type object, only a String object type
-// Does not return an error if the object is not found
-func getMultipleRedisObjects[T any](redisClient *redis.Client, ctx context.Context, logger *logging.AppLogger,
+// Does not return an error if the object is not found, not found objects are skipped (result could be shorter than objKey)
+func getMultipleRedisObjects[T any](redisClient redis.UniversalClient, address string, ctx context.Context, logger *logging.AppLogger,
 	objName objectType, objKey []string,
 ) ([]T, error) {
 	redisCmd := redisClient.MGet(ctx, objKey...)
 	if redisCmd.Err() != nil {
 		// todo(UMV): print when this will be done https://github.com/Wissance/stringFormatter/issues/14
 		logger.Warn(sf.Format("An error occurred during fetching {0}: from Redis server", objName))
-		return nil, redisCmd.Err()
+		return nil, GetRedisError(ctx, address, redisCmd.Err())
 	}
 
 	raw := redisCmd.Val()
-	result := make([]T, len(raw))
+	result := make([]T, 0, len(raw))
 	var unMarshalledRaw interface{}
-	for i, v := range raw {
-		err := json.Unmarshal([]byte(v.(string)), &unMarshalledRaw)
+	for _, v := range raw {
+		value, ok := v.(string)
+		if !ok {
+			// MGET returns nil for key that doesn't exist
+			continue
+		}
+		err := json.Unmarshal([]byte(value), &unMarshalledRaw)
 		if err != nil {
 			logger.Error(sf.Format("An error occurred during unmarshall {0} : \"{1}\"", objName, objKey))
 			return nil, fmt.Errorf("json.Unmarshal failed: %w", err)
 		}
-		result[i] = unMarshalledRaw.(T)
+		result = append(result, unMarshalledRaw.(T))
 	}
 	return result, nil
 }
@@ -277,19 +670,20 @@ func getMultipleRedisObjects[T any](redisClient *redis.Client, ctx context.Conte
  * Every item of LIST is a SLICE of T -> []T
  * Parameters:
  * - redisClient - client to access Redis database
+ * - address - Redis address for errors (see getRedisAddress)
  * - ctx - go context
  * - logger - logger
  * - objName - name of resource (table)
  * - objKey - name of a list
  * Returns: slice []T and error
  */
-func getObjectsListOfSlicesItemsFromRedis[T any](redisClient *redis.Client, ctx context.Context, logger *logging.AppLogger,
+func getObjectsListOfSlicesItemsFromRedis[T any](redisClient redis.UniversalClient, address string, ctx context.Context, logger *logging.AppLogger,
 	objName objectType, objKey string,
 ) ([]T, error) {
 	redisCmd := redisClient.LRange(ctx, objKey, 0, -1)
 	if redisCmd.Err() != nil {
 		logger.Warn(sf.Format("An error occurred during fetching {0}: \"{1}\" from Redis server", objName, objKey))
-		return nil, redisCmd.Err()
+		return nil, GetRedisError(ctx, address, redisCmd.Err())
 	}
 
 	// var obj T
@@ -317,19 +711,20 @@ func getObjectsListOfSlicesItemsFromRedis[T any](redisClient *redis.Client, ctx
  * Every item of LIST is a T
  * Parameters:
  * - redisClient - client to access Redis database
+ * - address - Redis address for errors (see getRedisAddress)
  * - ctx - go context
  * - logger - logger
  * - objName - name of resource (table)
  * - objKey - name of a list
  * Returns: slice []T and error
  */
-func getObjectsListOfNonSlicesItemsFromRedis[T any](redisClient *redis.Client, ctx context.Context, logger *logging.AppLogger,
+func getObjectsListOfNonSlicesItemsFromRedis[T any](redisClient redis.UniversalClient, address string, ctx context.Context, logger *logging.AppLogger,
 	objName objectType, objKey string,
 ) ([]T, error) {
 	redisCmd := redisClient.LRange(ctx, objKey, 0, -1)
 	if redisCmd.Err() != nil {
 		logger.Warn(sf.Format("An error occurred during fetching {0}: \"{1}\" from Redis server", objName, objKey))
-		return nil, redisCmd.Err()
+		return nil, GetRedisError(ctx, address, redisCmd.Err())
 	}
 
 	// var obj T
@@ -352,14 +747,14 @@ func getObjectsListOfNonSlicesItemsFromRedis[T any](redisClient *redis.Client, c
 	return result, nil
 }
 
-func updateObjectListItemInRedis[T any](redisClient *redis.Client, ctx context.Context, logger *logging.AppLogger,
+func updateObjectListItemInRedis[T any](redisClient redis.UniversalClient, address string, ctx context.Context, logger *logging.AppLogger,
 	objName objectType, objKey string, index int64, item T,
 ) error {
 	redisCmd := redisClient.LSet(ctx, objKey, index, item)
 	if redisCmd.Err() != nil {
 		logger.Warn(sf.Format("An error occurred during setting (update) item in LIST with key: \"{0}\" of type \"{1}\" with index {2}, error: {3}",
 			objKey, objName, index, redisCmd.Err()))
-		return errors.NewUnknownError("LSet", "updateObjectListItemInRedis", redisCmd.Err())
+		return errors.NewUnknownError("LSet", "updateObjectListItemInRedis", GetRedisError(ctx, address, redisCmd.Err()))
 	}
 
 	return nil
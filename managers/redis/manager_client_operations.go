@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 
@@ -17,9 +18,11 @@ import (
  *    - realmName
  * Returns: Tuple = slice of client, error
  */
-func (mn *RedisDataManager) GetClients(realmName string) ([]data.Client, error) {
+func (mn *RedisDataManager) GetClients(ctx context.Context, realmName string) ([]data.Client, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
 	if !mn.IsAvailable() {
-		return []data.Client{}, errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
+		return []data.Client{}, errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
 
 	realmClients, err := mn.getRealmClients(realmName)
@@ -32,7 +35,7 @@ func (mn *RedisDataManager) GetClients(realmName string) ([]data.Client, error)
 	clients := make([]data.Client, len(realmClients))
 	for i, rc := range realmClients {
 		// todo(UMV) get all them at once
-		client, readClientErr := mn.GetClient(realmName, rc.Name)
+		client, readClientErr := mn.GetClient(mn.ctx, realmName, rc.Name)
 		if readClientErr != nil {
 			if errors.As(readClientErr, &errors2.ObjectNotFoundError{}) {
 				mn.logger.Error(sf.Format("Realm: \"{0}\" has client: \"{1}\", that Redis does not have", realmName, rc.Name))
@@ -51,13 +54,15 @@ func (mn *RedisDataManager) GetClients(realmName string) ([]data.Client, error)
  *     - clientName - name of a client
  * Returns: client and error
  */
-func (mn *RedisDataManager) GetClient(realmName string, clientName string) (*data.Client, error) {
+func (mn *RedisDataManager) GetClient(ctx context.Context, realmName string, clientName string) (*data.Client, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
 	if !mn.IsAvailable() {
-		return nil, errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
+		return nil, errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
 
 	clientKey := sf.Format(clientKeyTemplate, mn.namespace, realmName, clientName)
-	client, err := getSingleRedisObject[data.Client](mn.redisClient, mn.ctx, mn.logger, Client, clientKey)
+	client, err := getSingleRedisObject[data.Client](mn.redisClient, mn.getRedisAddress(), mn.ctx, mn.logger, Client, clientKey)
 	if err != nil {
 		return nil, err
 	}
@@ -69,118 +74,175 @@ func (mn *RedisDataManager) GetClient(realmName string, clientName string) (*dat
  * must be unique!
  * 1. Check Realm, that is not possible to create client in non-existing Realm
  * 2. Check Client, if we found we are rising error
+ * 3. Save Client (with version 1), Realm - Client relation and Client first revision in one transaction
  * Arguments:
  *    - realmName - name of a Realm that newly creating Client is associated
  *    - clientNew - new Client data (body)
  * Returns: error if creation failed, otherwise - nil
  */
-func (mn *RedisDataManager) CreateClient(realmName string, clientNew data.Client) error {
+func (mn *RedisDataManager) CreateClient(ctx context.Context, realmName string, clientNew data.Client) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
 	if !mn.IsAvailable() {
-		return errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
-	}
-	// TODO(SIA) Add transaction
-	// TODO(SIA) use function isExists
-	_, err := mn.getRealmObject(realmName)
-	if err != nil {
-		return err
-	}
-	// TODO(SIA) use function isExists
-	_, err = mn.GetClient(realmName, clientNew.Name)
-	if err == nil {
-		return errors2.NewObjectExistsError(string(Client), clientNew.Name, sf.Format("realm: {0}", realmName))
-	}
-	if !errors.As(err, &errors2.ObjectNotFoundError{}) {
-		return err
-	}
-
-	clientBytes, err := json.Marshal(clientNew)
-	if err != nil {
-		mn.logger.Error(sf.Format("An error occurred during Marshal Client: {0}", err.Error()))
-		return errors2.NewUnknownError("json.Marshal", "RedisDataManager.CreateClient", err)
-	}
-	err = mn.upsertClientObject(realmName, clientNew.Name, string(clientBytes))
-	if err != nil {
-		return errors2.NewUnknownError("upsertClientObject", "RedisDataManager.CreateClient", err)
+		return errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
+	return mn.transaction("RedisDataManager.CreateClient", func(mn *RedisDataManager) error {
+		// TODO(SIA) use function isExists
+		_, err := mn.getRealmObject(realmName)
+		if err != nil {
+			return err
+		}
+		// TODO(SIA) use function isExists
+		_, err = mn.GetClient(mn.ctx, realmName, clientNew.Name)
+		if err == nil {
+			return errors2.NewObjectExistsError(string(Client), clientNew.Name, sf.Format("realm: {0}", realmName))
+		}
+		if !errors.As(err, &errors2.ObjectNotFoundError{}) {
+			return err
+		}
 
-	if addClientErr := mn.addClientToRealm(realmName, &clientNew); addClientErr != nil {
-		return errors2.NewUnknownError("addClientToRealm", "RedisDataManager.CreateClient", addClientErr)
-	}
+		clientNew.Version = 1
+		clientBytes, err := json.Marshal(clientNew)
+		if err != nil {
+			mn.logger.Error(sf.Format("An error occurred during Marshal Client: {0}", err.Error()))
+			return errors2.NewUnknownError("json.Marshal", "RedisDataManager.CreateClient", err)
+		}
+		err = mn.upsertClientObject(realmName, clientNew.Name, string(clientBytes))
+		if err != nil {
+			return errors2.NewUnknownError("upsertClientObject", "RedisDataManager.CreateClient", err)
+		}
 
-	return nil
+		if addClientErr := mn.addClientToRealm(realmName, &clientNew); addClientErr != nil {
+			return errors2.NewUnknownError("addClientToRealm", "RedisDataManager.CreateClient", addClientErr)
+		}
+		revision, revisionErr := data.CreateClientRevision(mn.ctx, realmName, &clientNew)
+		if revisionErr != nil {
+			return errors2.NewUnknownError("CreateClientRevision", "RedisDataManager.CreateClient", revisionErr)
+		}
+		if revisionErr = mn.addRevision(nil, nil, revision); revisionErr != nil {
+			return errors2.NewUnknownError("addRevision", "RedisDataManager.CreateClient", revisionErr)
+		}
+		return nil
+	}, sf.Format(realmKeyTemplate, mn.namespace, realmName), sf.Format(clientKeyTemplate, mn.namespace, realmName, clientNew.Name),
+		sf.Format(realmClientsKeyTemplate, mn.namespace, realmName), sf.Format(realmRevisionsKeyTemplate, mn.namespace, realmName))
 }
 
 // DeleteClient - deleting an existing client by pair (realmName, clientName)
-/* It also deletes the client from realmClients, clients && realmClients stored in a separate collections
+/* It also deletes the client from realmClients and client revisions in the same transaction, clients && realmClients stored in a
+ * separate collections
  * Arguments:
  *    - realmName - name of a realm
  *    - clientName - name of a client
  * Returns: error
  */
-func (mn *RedisDataManager) DeleteClient(realmName string, clientName string) error {
+func (mn *RedisDataManager) DeleteClient(ctx context.Context, realmName string, clientName string) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
 	if !mn.IsAvailable() {
-		return errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
+		return errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
 
-	if err := mn.deleteClientObject(realmName, clientName); err != nil {
-		if errors.As(err, &errors2.EmptyNotFoundErr) {
-			return err
+	return mn.transaction("RedisDataManager.DeleteClient", func(mn *RedisDataManager) error {
+		if err := mn.deleteClientObject(realmName, clientName); err != nil {
+			if errors.As(err, &errors2.EmptyNotFoundErr) {
+				return err
+			}
+			return errors2.NewUnknownError("deleteClientObject", "RedisDataManager.DeleteClient", err)
 		}
-		return errors2.NewUnknownError("deleteClientObject", "RedisDataManager.DeleteClient", err)
-	}
-	if err := mn.deleteClientFromRealm(realmName, clientName); err != nil {
-		// todo(UMV): second errors.Is because ErrZeroLength doesn't have custom type
-		if errors.As(err, &errors2.ObjectNotFoundError{}) || errors.Is(err, errors2.ErrZeroLength) {
-			return nil
+		if err := mn.putRevisions(realmName, data.ClientRevision, clientName, nil); err != nil {
+			return errors2.NewUnknownError("putRevisions", "RedisDataManager.DeleteClient", err)
 		}
-		return err
-	}
-	return nil
+		if err := mn.deleteClientFromRealm(realmName, clientName); err != nil {
+			// todo(UMV): second errors.Is because ErrZeroLength doesn't have custom type
+			if errors.As(err, &errors2.ObjectNotFoundError{}) || errors.Is(err, errors2.ErrZeroLength) {
+				return nil
+			}
+			return err
+		}
+		return nil
+	}, sf.Format(clientKeyTemplate, mn.namespace, realmName, clientName), sf.Format(realmClientsKeyTemplate, mn.namespace, realmName),
+		sf.Format(realmRevisionsKeyTemplate, mn.namespace, realmName))
 }
 
 // UpdateClient - updating an existing client
 /* 1. Removes Client fully from clients and realm clients collections
  * 2. Creates client with new body (clientNew)
  * 3. Add relations between Realm and Client
+ * 4. Add Client revision (history is moved to a new name if Client is renamed)
+ * All changes are made in one transaction
  * Arguments:
  *    - realmName - name of a realm
  *    - clientName - name of a client
- *    - clientNew - new client body
- * Returns: error
+ *    - clientNew - new client body, clientNew.Version is an expected version of stored client (see data.CheckVersion)
+ * Returns: error (errors2.ObjectVersionConflictError if stored client has other version, errors2.ObjectAlreadyExistsError if client is
+ *          renamed to a name of other realm client)
  */
-func (mn *RedisDataManager) UpdateClient(realmName string, clientName string, clientNew data.Client) error {
+func (mn *RedisDataManager) UpdateClient(ctx context.Context, realmName string, clientName string, clientNew data.Client) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
 	if !mn.IsAvailable() {
-		return errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
+		return errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
-	// TODO(SIA) Add transaction
-	oldClient, err := mn.GetClient(realmName, clientName)
-	if err != nil {
-		if errors.As(err, &errors2.EmptyNotFoundErr) {
+	return mn.transaction("RedisDataManager.UpdateClient", func(mn *RedisDataManager) error {
+		oldClient, err := mn.GetClient(mn.ctx, realmName, clientName)
+		if err != nil {
+			if errors.As(err, &errors2.EmptyNotFoundErr) {
+				return err
+			}
+			return errors2.NewUnknownError("GetClient", "RedisDataManager.UpdateClient", err)
+		}
+		if err = data.CheckVersion(string(Client), clientName, oldClient.Version, clientNew.Version); err != nil {
 			return err
 		}
-		return errors2.NewUnknownError("GetClient", "RedisDataManager.UpdateClient", err)
-	}
-	if clientNew.ID != oldClient.ID || clientNew.Name != oldClient.Name {
-		if delErr := mn.DeleteClient(realmName, oldClient.Name); delErr != nil {
-			return errors2.NewUnknownError("DeleteClient", "RedisDataManager.UpdateClient", delErr)
+		if clientNew.Name != oldClient.Name {
+			// client could not be renamed to a name of other realm client
+			_, err = mn.GetClient(mn.ctx, realmName, clientNew.Name)
+			if err == nil {
+				return errors2.NewObjectExistsError(string(Client), clientNew.Name, sf.Format("realm: {0}", realmName))
+			}
+			if !errors.As(err, &errors2.ObjectNotFoundError{}) {
+				return err
+			}
 		}
-		if addClientRealmErr := mn.addClientToRealm(realmName, &clientNew); addClientRealmErr != nil {
-			return errors2.NewUnknownError("addClientToRealm", "RedisDataManager.UpdateClient", addClientRealmErr)
+		clientNew.Version = oldClient.Version + 1
+		// history is read before DeleteClient because it removes client revisions
+		history, err := mn.getRevisions(realmName, data.ClientRevision, oldClient.Name)
+		if err != nil {
+			return err
+		}
+		if clientNew.ID != oldClient.ID || clientNew.Name != oldClient.Name {
+			if delErr := mn.DeleteClient(mn.ctx, realmName, oldClient.Name); delErr != nil {
+				return errors2.NewUnknownError("DeleteClient", "RedisDataManager.UpdateClient", delErr)
+			}
+			if addClientRealmErr := mn.addClientToRealm(realmName, &clientNew); addClientRealmErr != nil {
+				return errors2.NewUnknownError("addClientToRealm", "RedisDataManager.UpdateClient", addClientRealmErr)
+			}
 		}
-	}
-
-	clientBytes, err := json.Marshal(clientNew)
-	if err != nil {
-		mn.logger.Error(sf.Format("An error occurred during Marshal Client: {0}", err.Error()))
-		return errors2.NewUnknownError("json.Marshal", "RedisDataManager.UpdateClient", err)
-	}
 
-	err = mn.upsertClientObject(realmName, clientNew.Name, string(clientBytes))
-	if err != nil {
-		return errors2.NewUnknownError("upsertClientObject", "RedisDataManager.UpdateClient", err)
-	}
+		clientBytes, err := json.Marshal(clientNew)
+		if err != nil {
+			mn.logger.Error(sf.Format("An error occurred during Marshal Client: {0}", err.Error()))
+			return errors2.NewUnknownError("json.Marshal", "RedisDataManager.UpdateClient", err)
+		}
 
-	return nil
+		err = mn.upsertClientObject(realmName, clientNew.Name, string(clientBytes))
+		if err != nil {
+			return errors2.NewUnknownError("upsertClientObject", "RedisDataManager.UpdateClient", err)
+		}
+		previous, revisionErr := data.CreateClientRevision(mn.ctx, realmName, oldClient)
+		if revisionErr != nil {
+			return errors2.NewUnknownError("CreateClientRevision", "RedisDataManager.UpdateClient", revisionErr)
+		}
+		revision, revisionErr := data.CreateClientRevision(mn.ctx, realmName, &clientNew)
+		if revisionErr != nil {
+			return errors2.NewUnknownError("CreateClientRevision", "RedisDataManager.UpdateClient", revisionErr)
+		}
+		if revisionErr = mn.addRevision(history, &previous, revision); revisionErr != nil {
+			return errors2.NewUnknownError("addRevision", "RedisDataManager.UpdateClient", revisionErr)
+		}
+		return nil
+	}, sf.Format(clientKeyTemplate, mn.namespace, realmName, clientName), sf.Format(clientKeyTemplate, mn.namespace, realmName, clientNew.Name),
+		sf.Format(realmClientsKeyTemplate, mn.namespace, realmName), sf.Format(realmRevisionsKeyTemplate, mn.namespace, realmName))
 }
 
 // getRealmClients - get realmClients entity.
@@ -191,7 +253,7 @@ func (mn *RedisDataManager) UpdateClient(realmName string, clientName string, cl
  */
 func (mn *RedisDataManager) getRealmClients(realmName string) ([]data.ExtendedIdentifier, error) {
 	realmClientsKey := sf.Format(realmClientsKeyTemplate, mn.namespace, realmName)
-	realmClients, err := getObjectsListOfSlicesItemsFromRedis[data.ExtendedIdentifier](mn.redisClient, mn.ctx, mn.logger, RealmClients, realmClientsKey)
+	realmClients, err := getObjectsListOfSlicesItemsFromRedis[data.ExtendedIdentifier](mn.redisClient, mn.getRedisAddress(), mn.ctx, mn.logger, RealmClients, realmClientsKey)
 	if err != nil {
 		if errors.Is(err, errors2.ErrZeroLength) {
 			return nil, err
@@ -0,0 +1,212 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/wissance/Ferrum/config"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	sf "github.com/wissance/stringFormatter"
+)
+
+// GetOfflineSession returns data.OfflineSession by its identifier
+/* This function constructs Redis key by pattern combines namespace, realm name and session id (offlineSessionKeyTemplate),
+ * expired offline sessions are removed by Redis itself (key has TTL), session that expired but wasn't removed yet is not returned
+ * Parameters:
+ *     - realmName - name of a Realm
+ *     - sessionId - offline session identifier
+ * Returns: offline session and error (appErrs.ObjectNotFoundError if session doesn't exist or expired)
+ */
+func (mn *RedisDataManager) GetOfflineSession(ctx context.Context, realmName string, sessionId uuid.UUID) (*data.OfflineSession, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	if !mn.IsAvailable() {
+		return nil, appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
+	}
+	sessionKey := sf.Format(offlineSessionKeyTemplate, mn.namespace, realmName, sessionId.String())
+	return mn.getOfflineSessionObject(sessionKey)
+}
+
+// GetUserOfflineSessions returns all active offline sessions of a user
+/* This function gets ids of user offline sessions from Redis SET (userOfflineSessionsKeyTemplate) and then every session,
+ * ids of expired sessions are removed from SET
+ * Parameters:
+ *     - realmName - name of a Realm
+ *     - userId - user identifier
+ * Returns: offline sessions ordered by start time (the oldest first) and error
+ */
+func (mn *RedisDataManager) GetUserOfflineSessions(ctx context.Context, realmName string, userId uuid.UUID) ([]data.OfflineSession, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	if !mn.IsAvailable() {
+		return []data.OfflineSession{}, appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
+	}
+	userSessionsKey := sf.Format(userOfflineSessionsKeyTemplate, mn.namespace, realmName, userId.String())
+	redisCmd := mn.redisClient.SMembers(mn.ctx, userSessionsKey)
+	if redisCmd.Err() != nil {
+		mn.logger.Warn(sf.Format("An error occurred during fetching {0}: \"{1}\" from Redis server", OfflineSession, userSessionsKey))
+		return nil, appErrs.NewUnknownError("SMembers", "RedisDataManager.GetUserOfflineSessions",
+			GetRedisError(mn.ctx, mn.getRedisAddress(), redisCmd.Err()))
+	}
+	result := make([]data.OfflineSession, 0, len(redisCmd.Val()))
+	var expiredSessions []interface{}
+	for _, member := range redisCmd.Val() {
+		sessionKey := sf.Format(offlineSessionKeyTemplate, mn.namespace, realmName, member)
+		session, err := mn.getOfflineSessionObject(sessionKey)
+		if err != nil {
+			var notFoundErr appErrs.ObjectNotFoundError
+			if !errors.As(err, &notFoundErr) {
+				return nil, appErrs.NewUnknownError("getSingleRedisObject", "RedisDataManager.GetUserOfflineSessions", err)
+			}
+			expiredSessions = append(expiredSessions, member)
+			continue
+		}
+		result = append(result, *session)
+	}
+	if len(expiredSessions) > 0 {
+		if err := mn.redisClient.SRem(mn.ctx, userSessionsKey, expiredSessions...).Err(); err != nil {
+			mn.logger.Warn(sf.Format("An error occurred during removing expired offline sessions from: \"{0}\"", userSessionsKey))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Started.Before(result[j].Started)
+	})
+	return result, nil
+}
+
+// CreateOfflineSession creates new data.OfflineSession in a Realm
+/* Offline session is stored with TTL until session.Expired, session id is added to user offline sessions SET
+ * Parameters:
+ *     - realmName - name of a Realm
+ *     - session - new offline session
+ * Returns: error (appErrs.ObjectAlreadyExistsError if session with same id exists)
+ */
+func (mn *RedisDataManager) CreateOfflineSession(ctx context.Context, realmName string, session data.OfflineSession) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	if !mn.IsAvailable() {
+		return appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
+	}
+	if _, err := mn.getRealmObject(realmName); err != nil {
+		return err
+	}
+	existing, err := mn.GetOfflineSession(mn.ctx, realmName, session.Id)
+	if existing != nil {
+		return appErrs.NewObjectExistsError(string(OfflineSession), session.Id.String(), sf.Format("realm: {0}", realmName))
+	}
+	var notFoundErr appErrs.ObjectNotFoundError
+	if !errors.As(err, &notFoundErr) {
+		return err
+	}
+	if err = mn.upsertOfflineSessionObject(realmName, &session); err != nil {
+		return appErrs.NewUnknownError("upsertOfflineSessionObject", "RedisDataManager.CreateOfflineSession", err)
+	}
+	return nil
+}
+
+// UpdateOfflineSession updates existing data.OfflineSession, TTL is set according to new session.Expired value
+/* Parameters:
+ *     - realmName - name of a Realm
+ *     - session - offline session new data
+ * Returns: error (appErrs.ObjectNotFoundError if session doesn't exist or expired)
+ */
+func (mn *RedisDataManager) UpdateOfflineSession(ctx context.Context, realmName string, session data.OfflineSession) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	if !mn.IsAvailable() {
+		return appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
+	}
+	if _, err := mn.GetOfflineSession(mn.ctx, realmName, session.Id); err != nil {
+		return err
+	}
+	if err := mn.upsertOfflineSessionObject(realmName, &session); err != nil {
+		return appErrs.NewUnknownError("upsertOfflineSessionObject", "RedisDataManager.UpdateOfflineSession", err)
+	}
+	return nil
+}
+
+// DeleteOfflineSession removes (revokes) data.OfflineSession
+/* Parameters:
+ *     - realmName - name of a Realm
+ *     - sessionId - offline session identifier
+ * Returns: error (appErrs.ObjectNotFoundError if session doesn't exist or expired)
+ */
+func (mn *RedisDataManager) DeleteOfflineSession(ctx context.Context, realmName string, sessionId uuid.UUID) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	if !mn.IsAvailable() {
+		return appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
+	}
+	session, err := mn.GetOfflineSession(mn.ctx, realmName, sessionId)
+	if err != nil {
+		return err
+	}
+	_, err = mn.redisClient.TxPipelined(mn.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(mn.ctx, sf.Format(offlineSessionKeyTemplate, mn.namespace, realmName, sessionId.String()))
+		pipe.SRem(mn.ctx, sf.Format(userOfflineSessionsKeyTemplate, mn.namespace, realmName, session.UserId.String()), sessionId.String())
+		return nil
+	})
+	if err != nil {
+		mn.logger.Warn(sf.Format("An error occurred during Del {0}: \"{1}\" from Redis server", OfflineSession, sessionId))
+		return appErrs.NewUnknownError("TxPipelined", "RedisDataManager.DeleteOfflineSession", GetRedisError(mn.ctx, mn.getRedisAddress(), err))
+	}
+	return nil
+}
+
+// getOfflineSessionObject - get offline session by key
+/* Key of expired session could exist up to a second (minimal TTL, see upsertOfflineSessionObject), therefore session expiration
+ * is checked too
+ * Arguments:
+ *    - sessionKey - offline session key
+ * Returns: offline session and error (appErrs.ObjectNotFoundError if session doesn't exist or expired)
+ */
+func (mn *RedisDataManager) getOfflineSessionObject(sessionKey string) (*data.OfflineSession, error) {
+	session, err := getSingleRedisObject[data.OfflineSession](mn.redisClient, mn.getRedisAddress(), mn.ctx, mn.logger, OfflineSession, sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	if session.Expired.Before(time.Now()) {
+		return nil, appErrs.NewObjectNotFoundError(string(OfflineSession), sessionKey, "")
+	}
+	return session, nil
+}
+
+// upsertOfflineSessionObject - create or update offline session and add it to user offline sessions SET
+/* Session and SET are stored in one transaction, both keys expire with session (SET TTL could be only extended because
+ * it contains other sessions too)
+ * Arguments:
+ *    - realmName - name of a data.Realm
+ *    - session - offline session
+ * Returns: error
+ */
+func (mn *RedisDataManager) upsertOfflineSessionObject(realmName string, session *data.OfflineSession) error {
+	sessionBytes, err := json.Marshal(session)
+	if err != nil {
+		mn.logger.Error(sf.Format("An error occurred during Marshal OfflineSession: {0}", err.Error()))
+		return err
+	}
+	ttl := time.Until(session.Expired)
+	if ttl < time.Second {
+		// zero TTL means key without expiration, already expired session should disappear as soon as possible
+		ttl = time.Second
+	}
+	sessionId := session.Id.String()
+	_, err = mn.redisClient.TxPipelined(mn.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(mn.ctx, sf.Format(offlineSessionKeyTemplate, mn.namespace, realmName, sessionId), string(sessionBytes), ttl)
+		userSessionsKey := sf.Format(userOfflineSessionsKeyTemplate, mn.namespace, realmName, session.UserId.String())
+		pipe.SAdd(mn.ctx, userSessionsKey, sessionId)
+		ExtendTtl(mn.ctx, pipe, userSessionsKey, ttl)
+		return nil
+	})
+	if err != nil {
+		mn.logger.Warn(sf.Format("An error occurred during Set {0}: \"{1}\" from Redis server", OfflineSession, sessionId))
+		return GetRedisError(mn.ctx, mn.getRedisAddress(), err)
+	}
+	return nil
+}
@@ -1,9 +1,11 @@
 package redis
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 
+	"github.com/google/uuid"
 	"github.com/wissance/Ferrum/config"
 	"github.com/wissance/Ferrum/data"
 	appErrs "github.com/wissance/Ferrum/errors"
@@ -18,9 +20,11 @@ import (
  *     - realmName name of a realm
  * Returns: Tuple - realm and error
  */
-func (mn *RedisDataManager) GetRealm(realmName string) (*data.Realm, error) {
+func (mn *RedisDataManager) GetRealm(ctx context.Context, realmName string) (*data.Realm, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
 	if !mn.IsAvailable() {
-		return nil, appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
+		return nil, appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
 
 	realm, err := mn.getRealmObject(realmName)
@@ -33,7 +37,7 @@ func (mn *RedisDataManager) GetRealm(realmName string) (*data.Realm, error) {
 
 	// should get realms too
 	// if realms were stored without clients (we expected so), get clients related to realm and assign here
-	clients, err := mn.GetClients(realmName)
+	clients, err := mn.GetClients(mn.ctx, realmName)
 	if err != nil {
 		if !errors.Is(err, appErrs.ErrZeroLength) {
 			return nil, appErrs.NewUnknownError("GetClients", "RedisDataManager.GetRealm", err)
@@ -41,7 +45,7 @@ func (mn *RedisDataManager) GetRealm(realmName string) (*data.Realm, error) {
 	}
 	realm.Clients = clients
 
-	configs, err := mn.GetUserFederationConfigs(realmName)
+	configs, err := mn.GetUserFederationConfigs(mn.ctx, realmName)
 	if err != nil {
 		if !errors.Is(err, appErrs.ErrZeroLength) {
 			return nil, appErrs.NewUnknownError("GetUserFederationConfigs", "RedisDataManager.GetRealm", err)
@@ -61,97 +65,176 @@ func (mn *RedisDataManager) GetRealm(realmName string) (*data.Realm, error) {
  * 4. Iterate over User's, Create Users
  * 5. Create User's - Realm connection
  * 6. Create Realm
+ * All objects are created in one transaction, realm, its clients and users get version 1, realm and clients get first revision
  * Arguments:
  *    - newRealm - newly creating realm body data with Clients and Users
  * Returns: error
  */
-func (mn *RedisDataManager) CreateRealm(newRealm data.Realm) error {
+func (mn *RedisDataManager) CreateRealm(ctx context.Context, newRealm data.Realm) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	salt := encoding.GenerateRandomSalt()
+	return mn.createRealm(newRealm, salt, encoding.NewPasswordJsonEncoder(salt))
+}
+
+// ImportRealm creates a realm as it is: realm password salt and versions are kept and users are stored without passwords hashing (passwords
+// must be already hashed with realm salt), it is using for a data store seeding (see managers.RealmImporter)
+/* Arguments:
+ *    - realm - realm with Clients, Users and UserFederationServices
+ * Returns: error (appErrs.ObjectAlreadyExistsError if realm exists)
+ */
+func (mn *RedisDataManager) ImportRealm(ctx context.Context, realm data.Realm) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return mn.createRealm(realm, realm.PasswordSalt, nil)
+}
+
+// createRealm creates a realm with password salt = salt, users passwords are hashed with encoder and realm, clients and users get
+// version 1 and realm and clients get first revision (realm is stored as is and revisions are not added if encoder is nil)
+func (mn *RedisDataManager) createRealm(newRealm data.Realm, salt string, encoder *encoding.PasswordJsonEncoder) error {
 	if !mn.IsAvailable() {
-		return appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
+		return appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
-	// TODO(SIA) Add transaction
-	// TODO(SIA) use function isExists
-	_, err := mn.GetRealm(newRealm.Name)
-	if err == nil {
-		return appErrs.NewObjectExistsError(string(Realm), newRealm.Name, "")
+	if encoder != nil {
+		newRealm.Version = 1
 	}
-	if !errors.As(err, &appErrs.EmptyNotFoundErr) {
-		return err
+	// users passwords are hashed before transaction because operation could be repeated
+	newUsers := make([]data.User, len(newRealm.Users))
+	keys := mn.getRealmKeys(newRealm.Name)
+	userNames := make(map[string]bool, len(newRealm.Users))
+	userIds := make(map[uuid.UUID]bool, len(newRealm.Users))
+	for i, user := range newRealm.Users {
+		newUsers[i] = data.CreateUser(user, encoder)
+		if encoder != nil {
+			newUsers[i] = data.CreateUserWithVersion(newUsers[i], 1)
+		}
+		newUserName := newUsers[i].GetUsername()
+		if userNames[newUserName] {
+			return appErrs.NewObjectExistsError(string(User), newUserName, sf.Format("realm: {0}", newRealm.Name))
+		}
+		userNames[newUserName] = true
+		if newUserId := newUsers[i].GetId(); newUserId != uuid.Nil {
+			if userIds[newUserId] {
+				return appErrs.NewObjectExistsError(string(User), newUserId.String(), sf.Format("realm: {0}", newRealm.Name))
+			}
+			userIds[newUserId] = true
+		}
+		keys = append(keys, sf.Format(userKeyTemplate, mn.namespace, newRealm.Name, newUserName))
 	}
+	for _, client := range newRealm.Clients {
+		keys = append(keys, sf.Format(clientKeyTemplate, mn.namespace, newRealm.Name, client.Name))
+	}
+	return mn.transaction("RedisDataManager.CreateRealm", func(mn *RedisDataManager) error {
+		// TODO(SIA) use function isExists
+		_, err := mn.GetRealm(mn.ctx, newRealm.Name)
+		if err == nil {
+			return appErrs.NewObjectExistsError(string(Realm), newRealm.Name, "")
+		}
+		if !errors.As(err, &appErrs.EmptyNotFoundErr) {
+			return err
+		}
 
-	if len(newRealm.Clients) != 0 {
-		realmClients := make([]data.ExtendedIdentifier, len(newRealm.Clients))
-		for i, client := range newRealm.Clients {
-			bytesClient, marshallErr := json.Marshal(client)
-			if marshallErr != nil {
-				mn.logger.Error(sf.Format("An error occurred during Marshal Client: {0}", marshallErr.Error()))
-				return appErrs.NewUnknownError("json.Marshal", "RedisDataManager.CreateRealm", marshallErr)
-			}
-			if upsertClientErr := mn.upsertClientObject(newRealm.Name, client.Name, string(bytesClient)); upsertClientErr != nil {
-				return appErrs.NewUnknownError("upsertClientObject", "RedisDataManager.CreateRealm", upsertClientErr)
+		if len(newRealm.Clients) != 0 {
+			realmClients := make([]data.ExtendedIdentifier, len(newRealm.Clients))
+			for i, client := range newRealm.Clients {
+				if encoder != nil {
+					client.Version = 1
+				}
+				bytesClient, marshallErr := json.Marshal(client)
+				if marshallErr != nil {
+					mn.logger.Error(sf.Format("An error occurred during Marshal Client: {0}", marshallErr.Error()))
+					return appErrs.NewUnknownError("json.Marshal", "RedisDataManager.CreateRealm", marshallErr)
+				}
+				if upsertClientErr := mn.upsertClientObject(newRealm.Name, client.Name, string(bytesClient)); upsertClientErr != nil {
+					return appErrs.NewUnknownError("upsertClientObject", "RedisDataManager.CreateRealm", upsertClientErr)
+				}
+				if encoder != nil {
+					revision, revisionErr := data.CreateClientRevision(mn.ctx, newRealm.Name, &client)
+					if revisionErr != nil {
+						return appErrs.NewUnknownError("CreateClientRevision", "RedisDataManager.CreateRealm", revisionErr)
+					}
+					if revisionErr = mn.addRevision(nil, nil, revision); revisionErr != nil {
+						return appErrs.NewUnknownError("addRevision", "RedisDataManager.CreateRealm", revisionErr)
+					}
+				}
+				realmClients[i] = data.ExtendedIdentifier{
+					ID:   client.ID,
+					Name: client.Name,
+				}
 			}
-			realmClients[i] = data.ExtendedIdentifier{
-				ID:   client.ID,
-				Name: client.Name,
+			if createRealmClientErr := mn.createRealmClients(newRealm.Name, realmClients, true); createRealmClientErr != nil {
+				return appErrs.NewUnknownError("createRealmClients", "RedisDataManager.CreateRealm", createRealmClientErr)
 			}
 		}
-		if createRealmClientErr := mn.createRealmClients(newRealm.Name, realmClients, true); createRealmClientErr != nil {
-			return appErrs.NewUnknownError("createRealmClients", "RedisDataManager.CreateRealm", createRealmClientErr)
-		}
-	}
-
-	salt := encoding.GenerateRandomSalt()
 
-	if len(newRealm.Users) != 0 {
-		realmUsers := make([]data.ExtendedIdentifier, len(newRealm.Users))
-		encoder := encoding.NewPasswordJsonEncoder(salt)
-		for i, user := range newRealm.Users {
-			newUser := data.CreateUser(user, encoder)
-			newUserName := newUser.GetUsername()
-			if upsertUserErr := mn.upsertUserObject(newRealm.Name, newUserName, newUser.GetJsonString()); upsertUserErr != nil {
-				return appErrs.NewUnknownError("upsertUserObject", "RedisDataManager.CreateRealm", upsertUserErr)
+		if len(newUsers) != 0 {
+			// realm users relation and users indexes are created from scratch
+			if deleteRealmUserErr := mn.deleteRealmUsersObject(newRealm.Name); deleteRealmUserErr != nil {
+				return appErrs.NewUnknownError("deleteRealmUsersObject", "RedisDataManager.CreateRealm", deleteRealmUserErr)
 			}
-			newUserId := newUser.GetId()
-			realmUsers[i] = data.ExtendedIdentifier{
-				ID:   newUserId,
-				Name: newUserName,
+			for _, newUser := range newUsers {
+				if upsertUserErr := mn.upsertUserObject(newRealm.Name, newUser.GetUsername(), newUser.GetJsonString()); upsertUserErr != nil {
+					return appErrs.NewUnknownError("upsertUserObject", "RedisDataManager.CreateRealm", upsertUserErr)
+				}
+				if addUserRealmErr := mn.addUserToRealm(newRealm.Name, newUser); addUserRealmErr != nil {
+					return appErrs.NewUnknownError("addUserToRealm", "RedisDataManager.CreateRealm", addUserRealmErr)
+				}
 			}
 		}
-		if createUserRealmErr := mn.createRealmUsers(newRealm.Name, realmUsers, true); createUserRealmErr != nil {
-			return appErrs.NewUnknownError("createRealmUsers", "RedisDataManager.CreateRealm", createUserRealmErr)
-		}
-	}
 
-	shortRealm := data.Realm{
-		Name:                   newRealm.Name,
-		Clients:                []data.Client{},
-		Users:                  []any{},
-		TokenExpiration:        newRealm.TokenExpiration,
-		RefreshTokenExpiration: newRealm.RefreshTokenExpiration,
-		PasswordSalt:           salt,
-		Encoder:                nil,
-	}
-	jsonShortRealm, err := json.Marshal(shortRealm)
-	if err != nil {
-		mn.logger.Error(sf.Format("An error occurred during Marshal Realm: {0}", err.Error()))
-		return appErrs.NewUnknownError("json.Marshal", "RedisDataManager.CreateRealm", err)
-	}
-	if upsertRealmErr := mn.upsertRealmObject(newRealm.Name, string(jsonShortRealm)); upsertRealmErr != nil {
-		return appErrs.NewUnknownError("upsertRealmObject", "RedisDataManager.CreateRealm", upsertRealmErr)
-	}
+		shortRealm := data.Realm{
+			Name:                      newRealm.Name,
+			Clients:                   []data.Client{},
+			Users:                     []any{},
+			TokenExpiration:           newRealm.TokenExpiration,
+			RefreshTokenExpiration:    newRealm.RefreshTokenExpiration,
+			MaxUserSessions:           newRealm.MaxUserSessions,
+			SessionEvictionPolicy:     newRealm.SessionEvictionPolicy,
+			SessionIdleTimeout:        newRealm.SessionIdleTimeout,
+			SessionMaxLifespan:        newRealm.SessionMaxLifespan,
+			RefreshTokenRotation:      newRealm.RefreshTokenRotation,
+			OfflineSessionIdleTimeout: newRealm.OfflineSessionIdleTimeout,
+			OfflineSessionMaxLifespan: newRealm.OfflineSessionMaxLifespan,
+			NotBefore:                 newRealm.NotBefore,
+			Version:                   newRealm.Version,
+			PasswordSalt:              salt,
+			Encoder:                   nil,
+		}
+		jsonShortRealm, err := json.Marshal(shortRealm)
+		if err != nil {
+			mn.logger.Error(sf.Format("An error occurred during Marshal Realm: {0}", err.Error()))
+			return appErrs.NewUnknownError("json.Marshal", "RedisDataManager.CreateRealm", err)
+		}
+		if upsertRealmErr := mn.upsertRealmObject(newRealm.Name, string(jsonShortRealm)); upsertRealmErr != nil {
+			return appErrs.NewUnknownError("upsertRealmObject", "RedisDataManager.CreateRealm", upsertRealmErr)
+		}
+		if encoder != nil {
+			revision, revisionErr := data.CreateRealmRevision(mn.ctx, &shortRealm)
+			if revisionErr != nil {
+				return appErrs.NewUnknownError("CreateRealmRevision", "RedisDataManager.CreateRealm", revisionErr)
+			}
+			if revisionErr = mn.addRevision(nil, nil, revision); revisionErr != nil {
+				return appErrs.NewUnknownError("addRevision", "RedisDataManager.CreateRealm", revisionErr)
+			}
+		}
 
-	// Creating UserFederationServiceConfig[] after Realm creation
-	if len(newRealm.UserFederationServices) > 0 {
+		// Creating UserFederationServiceConfig[] after Realm creation, realm is not saved until transaction is executed,
+		// therefore configs are created without CreateUserFederationConfig checks
 		for _, userFederationCfg := range newRealm.UserFederationServices {
-			createUserFederationServiceErr := mn.CreateUserFederationConfig(newRealm.Name, userFederationCfg)
+			userFederationCfgBytes, marshallErr := json.Marshal(userFederationCfg)
+			if marshallErr != nil {
+				mn.logger.Error(sf.Format("An error occurred during Marshal UserFederationServiceConfig: {0}", marshallErr.Error()))
+				return appErrs.NewUnknownError("json.Marshal", "RedisDataManager.CreateRealm", marshallErr)
+			}
+			createUserFederationServiceErr := mn.createUserFederationConfigObject(newRealm.Name, string(userFederationCfgBytes))
 			if createUserFederationServiceErr != nil {
-				return appErrs.NewUnknownError("createUserFederationService", "RedisDataManager.CreateRealm",
+				return appErrs.NewUnknownError("createUserFederationConfigObject", "RedisDataManager.CreateRealm",
 					createUserFederationServiceErr)
 			}
 		}
-	}
 
-	return nil
+		return nil
+	}, keys...)
 }
 
 // DeleteRealm - deleting the realm with all it Client's and User's
@@ -161,147 +244,207 @@ func (mn *RedisDataManager) CreateRealm(newRealm data.Realm) error {
  * 4. Get Realm User
  * 5. Iterate over User's, Delete User's
  * 6. Delete Realm
+ * 7. Delete revisions of Realm and its Client's
+ * All objects are deleted in one transaction
  * Arguments:
  *    - realmName - name of a Realm to Delete
  * Returns: error
  */
-func (mn *RedisDataManager) DeleteRealm(realmName string) error {
+func (mn *RedisDataManager) DeleteRealm(ctx context.Context, realmName string) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
 	if !mn.IsAvailable() {
-		return appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
+		return appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
-	// TODO(SIA) Add transaction
-	if err := mn.deleteRealmObject(realmName); err != nil {
-		if errors.As(err, &appErrs.EmptyNotFoundErr) {
-			return err
+	return mn.transaction("RedisDataManager.DeleteRealm", func(mn *RedisDataManager) error {
+		if err := mn.deleteRealmObject(realmName); err != nil {
+			if errors.As(err, &appErrs.EmptyNotFoundErr) {
+				return err
+			}
+			return appErrs.NewUnknownError("deleteRealmObject", "RedisDataManager.DeleteRealm", err)
 		}
-		return appErrs.NewUnknownError("deleteRealmObject", "RedisDataManager.DeleteRealm", err)
-	}
 
-	clients, err := mn.getRealmClients(realmName)
-	if err != nil {
-		// todo(UMV): errors.Is because ErrZeroLength doesn't have custom type
-		if !errors.Is(err, appErrs.ErrZeroLength) {
-			return appErrs.NewUnknownError("getRealmClients", "RedisDataManager.DeleteRealm", err)
-		}
-	} else {
-		// TODO(SIA) overwrite to delete all keys at once
-		for _, client := range clients {
-			if deleteClientErr := mn.deleteClientObject(realmName, client.Name); deleteClientErr != nil {
-				return appErrs.NewUnknownError("deleteClientObject", "RedisDataManager.DeleteRealm", deleteClientErr)
+		clients, err := mn.getRealmClients(realmName)
+		if err != nil {
+			// todo(UMV): errors.Is because ErrZeroLength doesn't have custom type
+			if !errors.Is(err, appErrs.ErrZeroLength) {
+				return appErrs.NewUnknownError("getRealmClients", "RedisDataManager.DeleteRealm", err)
+			}
+		} else {
+			// TODO(SIA) overwrite to delete all keys at once
+			for _, client := range clients {
+				if deleteClientErr := mn.deleteClientObject(realmName, client.Name); deleteClientErr != nil {
+					return appErrs.NewUnknownError("deleteClientObject", "RedisDataManager.DeleteRealm", deleteClientErr)
+				}
+			}
+			if deleteRealmClientErr := mn.deleteRealmClientsObject(realmName); deleteRealmClientErr != nil {
+				return appErrs.NewUnknownError("deleteRealmClientsObject", "RedisDataManager.DeleteRealm", deleteRealmClientErr)
 			}
 		}
-		if deleteRealmClientErr := mn.deleteRealmClientsObject(realmName); deleteRealmClientErr != nil {
-			return appErrs.NewUnknownError("deleteRealmClientsObject", "RedisDataManager.DeleteRealm", deleteRealmClientErr)
-		}
-	}
 
-	users, err := mn.getRealmUsers(realmName)
-	if err != nil {
-		// todo(UMV): second errors.Is because ErrZeroLength doesn't have custom type
-		if !errors.Is(err, appErrs.ErrZeroLength) {
-			return appErrs.NewUnknownError("getRealmUsers", "RedisDataManager.DeleteRealm", err)
-		}
-	} else {
-		// TODO(SIA) overwrite to delete all keys at once
-		for _, user := range users {
-			if deleteUserErr := mn.deleteUserObject(realmName, user.Name); deleteUserErr != nil {
-				return appErrs.NewUnknownError("deleteUserObject", "RedisDataManager.DeleteRealm", deleteUserErr)
+		users, err := mn.getRealmUsers(realmName)
+		if err != nil {
+			// todo(UMV): second errors.Is because ErrZeroLength doesn't have custom type
+			if !errors.Is(err, appErrs.ErrZeroLength) {
+				return appErrs.NewUnknownError("getRealmUsers", "RedisDataManager.DeleteRealm", err)
+			}
+		} else {
+			// TODO(SIA) overwrite to delete all keys at once
+			for _, userName := range users {
+				if deleteUserErr := mn.deleteUserObject(realmName, userName); deleteUserErr != nil {
+					return appErrs.NewUnknownError("deleteUserObject", "RedisDataManager.DeleteRealm", deleteUserErr)
+				}
+			}
+			if deleteRealmUserErr := mn.deleteRealmUsersObject(realmName); deleteRealmUserErr != nil {
+				return appErrs.NewUnknownError("deleteRealmUsersObject", "RedisDataManager.DeleteRealm", deleteRealmUserErr)
 			}
 		}
-		if deleteRealmUserErr := mn.deleteRealmUsersObject(realmName); deleteRealmUserErr != nil {
-			return appErrs.NewUnknownError("deleteRealmUsersObject", "RedisDataManager.DeleteRealm", deleteRealmUserErr)
-		}
-	}
 
-	userFederationConfigs, err := mn.GetUserFederationConfigs(realmName)
-	if err != nil {
-		if !errors.Is(err, appErrs.ErrZeroLength) {
-			return appErrs.NewUnknownError("GetUserFederationConfigs", "RedisDataManager.DeleteRealm", err)
+		if deleteUserFederationErr := mn.deleteUserFederationConfigsObject(realmName); deleteUserFederationErr != nil {
+			return appErrs.NewUnknownError("deleteUserFederationConfigsObject", "RedisDataManager.DeleteRealm", deleteUserFederationErr)
 		}
-	} else {
-		for _, userFederation := range userFederationConfigs {
-			if deleteUserFederationErr := mn.DeleteUserFederationConfig(realmName, userFederation.Name); deleteUserFederationErr != nil {
-				return appErrs.NewUnknownError("deleteUserFederationConfigObject", "RedisDataManager.DeleteRealm", deleteUserFederationErr)
-			}
+
+		if deleteRevisionsErr := mn.deleteRealmRevisionsObject(realmName); deleteRevisionsErr != nil {
+			return appErrs.NewUnknownError("deleteRealmRevisionsObject", "RedisDataManager.DeleteRealm", deleteRevisionsErr)
 		}
-	}
 
-	return nil
+		return nil
+	}, mn.getRealmKeys(realmName)...)
 }
 
 // UpdateRealm - realm update. It is expected that realmValue will not contain clients and users.
-/* If the name or id of the realm has changed.  Then this information will be cascaded to all dependent objects.
+/* If the name or id of the realm has changed.  Then this information will be cascaded to all dependent objects (clients, users and
+ * user federation configs).
+ * Revisions of realm and its clients are moved to a new name, realm gets new revision.
+ * All changes are made in one transaction
  * Arguments:
  *    - realmName
- *    - realmNew
- * Returns: error
+ *    - realmNew - realmNew.Version is an expected version of stored realm (see data.CheckVersion)
+ * Returns: error (appErrs.ObjectVersionConflictError if stored realm has other version)
  */
-func (mn *RedisDataManager) UpdateRealm(realmName string, realmNew data.Realm) error {
+func (mn *RedisDataManager) UpdateRealm(ctx context.Context, realmName string, realmNew data.Realm) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
 	if !mn.IsAvailable() {
-		return appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
-	}
-	// TODO(SIA) Add transaction
-	oldRealm, err := mn.getRealmObject(realmName)
-	if err != nil {
-		return err
+		return appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
-	if oldRealm.Name != realmNew.Name {
-		// TODO(SIA) use function isExists
-		_, getRealmErr := mn.getRealmObject(realmNew.Name)
-		if getRealmErr == nil {
-			mn.logger.Error(sf.Format("Realm with a new name \"{0}\" already exists in Redis", realmNew.Name))
-			return appErrs.ErrExists
+	return mn.transaction("RedisDataManager.UpdateRealm", func(mn *RedisDataManager) error {
+		oldRealm, err := mn.getRealmObject(realmName)
+		if err != nil {
+			return err
+		}
+		if err = data.CheckVersion(string(Realm), realmName, oldRealm.Version, realmNew.Version); err != nil {
+			return err
+		}
+		history, err := mn.getRevisions(realmName, data.RealmRevision, "")
+		if err != nil {
+			return err
 		}
-		if !errors.As(getRealmErr, &appErrs.ObjectNotFoundError{}) {
-			return appErrs.NewUnknownError("getRealmObject", "RedisDataManager.UpdateRealm", getRealmErr)
+		previous, err := data.CreateRealmRevision(mn.ctx, oldRealm)
+		if err != nil {
+			return appErrs.NewUnknownError("CreateRealmRevision", "RedisDataManager.UpdateRealm", err)
 		}
+		if oldRealm.Name != realmNew.Name {
+			// TODO(SIA) use function isExists
+			_, getRealmErr := mn.getRealmObject(realmNew.Name)
+			if getRealmErr == nil {
+				mn.logger.Error(sf.Format("Realm with a new name \"{0}\" already exists in Redis", realmNew.Name))
+				return appErrs.ErrExists
+			}
+			if !errors.As(getRealmErr, &appErrs.ObjectNotFoundError{}) {
+				return appErrs.NewUnknownError("getRealmObject", "RedisDataManager.UpdateRealm", getRealmErr)
+			}
 
-		clients, getClientsErr := mn.GetClients(oldRealm.Name)
-		// todo(UMV): errors.Is because ErrZeroLength doesn't have custom type
-		if getClientsErr != nil && !errors.Is(getClientsErr, appErrs.ErrZeroLength) {
-			return appErrs.NewUnknownError("GetClients", "RedisDataManager.UpdateRealm", getClientsErr)
+			clients, getClientsErr := mn.GetClients(mn.ctx, oldRealm.Name)
+			// todo(UMV): errors.Is because ErrZeroLength doesn't have custom type
+			if getClientsErr != nil && !errors.Is(getClientsErr, appErrs.ErrZeroLength) {
+				return appErrs.NewUnknownError("GetClients", "RedisDataManager.UpdateRealm", getClientsErr)
+			}
+			users, getUsersErr := mn.GetUsers(mn.ctx, oldRealm.Name)
+			// todo(UMV): errors.Is because ErrZeroLength doesn't have custom type
+			if getUsersErr != nil && !errors.Is(getUsersErr, appErrs.ErrZeroLength) {
+				return appErrs.NewUnknownError("GetUsers", "RedisDataManager.UpdateRealm", getUsersErr)
+			}
+			usersData := make([]any, len(users))
+			for i, u := range users {
+				usersData[i] = u.GetRawData()
+			}
+			userFederationConfigs, getConfigsErr := mn.GetUserFederationConfigs(mn.ctx, oldRealm.Name)
+			if getConfigsErr != nil && !errors.Is(getConfigsErr, appErrs.ErrZeroLength) {
+				return appErrs.NewUnknownError("GetUserFederationConfigs", "RedisDataManager.UpdateRealm", getConfigsErr)
+			}
+			newRealmWithOldClientsAndUsers := data.Realm{
+				Name:                      realmNew.Name,
+				Clients:                   clients,
+				Users:                     usersData,
+				UserFederationServices:    userFederationConfigs,
+				TokenExpiration:           realmNew.TokenExpiration,
+				RefreshTokenExpiration:    realmNew.RefreshTokenExpiration,
+				MaxUserSessions:           realmNew.MaxUserSessions,
+				SessionEvictionPolicy:     realmNew.SessionEvictionPolicy,
+				SessionIdleTimeout:        realmNew.SessionIdleTimeout,
+				SessionMaxLifespan:        realmNew.SessionMaxLifespan,
+				RefreshTokenRotation:      realmNew.RefreshTokenRotation,
+				OfflineSessionIdleTimeout: realmNew.OfflineSessionIdleTimeout,
+				OfflineSessionMaxLifespan: realmNew.OfflineSessionMaxLifespan,
+				NotBefore:                 realmNew.NotBefore,
+				Version:                   oldRealm.Version + 1,
+			}
+			if deleteRealmErr := mn.DeleteRealm(mn.ctx, oldRealm.Name); deleteRealmErr != nil {
+				return appErrs.NewUnknownError("DeleteRealm", "RedisDataManager.UpdateRealm", deleteRealmErr)
+			}
+			// realm is moved as is: salt is kept (users passwords are already hashed with it) and clients and users keep versions
+			if createRealmErr := mn.createRealm(newRealmWithOldClientsAndUsers, oldRealm.PasswordSalt, nil); createRealmErr != nil {
+				return appErrs.NewUnknownError("createRealm", "RedisDataManager.UpdateRealm", createRealmErr)
+			}
+			if moveRevisionsErr := mn.moveRealmRevisions(oldRealm.Name, realmNew.Name); moveRevisionsErr != nil {
+				return appErrs.NewUnknownError("moveRealmRevisions", "RedisDataManager.UpdateRealm", moveRevisionsErr)
+			}
+			revision, revisionErr := data.CreateRealmRevision(mn.ctx, &newRealmWithOldClientsAndUsers)
+			if revisionErr != nil {
+				return appErrs.NewUnknownError("CreateRealmRevision", "RedisDataManager.UpdateRealm", revisionErr)
+			}
+			if revisionErr = mn.addRevision(history, &previous, revision); revisionErr != nil {
+				return appErrs.NewUnknownError("addRevision", "RedisDataManager.UpdateRealm", revisionErr)
+			}
+			return nil
 		}
-		users, getUsersErr := mn.GetUsers(oldRealm.Name)
-		// todo(UMV): errors.Is because ErrZeroLength doesn't have custom type
-		if getUsersErr != nil && !errors.Is(getUsersErr, appErrs.ErrZeroLength) {
-			return appErrs.NewUnknownError("GetUsers", "RedisDataManager.UpdateRealm", getUsersErr)
+
+		shortRealm := data.Realm{
+			Name:                      realmNew.Name,
+			Clients:                   []data.Client{},
+			Users:                     []any{},
+			TokenExpiration:           realmNew.TokenExpiration,
+			RefreshTokenExpiration:    realmNew.RefreshTokenExpiration,
+			MaxUserSessions:           realmNew.MaxUserSessions,
+			SessionEvictionPolicy:     realmNew.SessionEvictionPolicy,
+			SessionIdleTimeout:        realmNew.SessionIdleTimeout,
+			SessionMaxLifespan:        realmNew.SessionMaxLifespan,
+			RefreshTokenRotation:      realmNew.RefreshTokenRotation,
+			OfflineSessionIdleTimeout: realmNew.OfflineSessionIdleTimeout,
+			OfflineSessionMaxLifespan: realmNew.OfflineSessionMaxLifespan,
+			NotBefore:                 realmNew.NotBefore,
+			Version:                   oldRealm.Version + 1,
+			// salt is not changed on update, otherwise stored passwords hashes become invalid
+			PasswordSalt: oldRealm.PasswordSalt,
 		}
-		usersData := make([]any, len(users))
-		for i, u := range users {
-			usersData[i] = u.GetRawData()
+		jsonShortRealm, err := json.Marshal(shortRealm)
+		if err != nil {
+			mn.logger.Error(sf.Format("An error occurred during Marshal Realm: {0}", err.Error()))
+			return appErrs.NewUnknownError("json.Marshal", "RedisDataManager.UpdateRealm", err)
 		}
-		newRealmWithOldClientsAndUsers := data.Realm{
-			Name:                   realmNew.Name,
-			Clients:                clients,
-			Users:                  usersData,
-			TokenExpiration:        realmNew.TokenExpiration,
-			RefreshTokenExpiration: realmNew.RefreshTokenExpiration,
+		if upsertRealmErr := mn.upsertRealmObject(shortRealm.Name, string(jsonShortRealm)); upsertRealmErr != nil {
+			return appErrs.NewUnknownError("upsertRealmObject", "RedisDataManager.UpdateRealm", upsertRealmErr)
 		}
-		if deleteRealmErr := mn.DeleteRealm(oldRealm.Name); deleteRealmErr != nil {
-			return appErrs.NewUnknownError("DeleteRealm", "RedisDataManager.UpdateRealm", deleteRealmErr)
+		revision, revisionErr := data.CreateRealmRevision(mn.ctx, &shortRealm)
+		if revisionErr != nil {
+			return appErrs.NewUnknownError("CreateRealmRevision", "RedisDataManager.UpdateRealm", revisionErr)
 		}
-		if createRealmErr := mn.CreateRealm(newRealmWithOldClientsAndUsers); createRealmErr != nil {
-			return appErrs.NewUnknownError("CreateRealm", "RedisDataManager.UpdateRealm", createRealmErr)
+		if revisionErr = mn.addRevision(history, &previous, revision); revisionErr != nil {
+			return appErrs.NewUnknownError("addRevision", "RedisDataManager.UpdateRealm", revisionErr)
 		}
 		return nil
-	}
-
-	shortRealm := data.Realm{
-		Name:                   realmNew.Name,
-		Clients:                []data.Client{},
-		Users:                  []any{},
-		TokenExpiration:        realmNew.TokenExpiration,
-		RefreshTokenExpiration: realmNew.RefreshTokenExpiration,
-	}
-	jsonShortRealm, err := json.Marshal(shortRealm)
-	if err != nil {
-		mn.logger.Error(sf.Format("An error occurred during Marshal Realm: {0}", err.Error()))
-		return appErrs.NewUnknownError("json.Marshal", "RedisDataManager.UpdateRealm", err)
-	}
-	if upsertRealmErr := mn.upsertRealmObject(shortRealm.Name, string(jsonShortRealm)); upsertRealmErr != nil {
-		return appErrs.NewUnknownError("upsertRealmObject", "RedisDataManager.UpdateRealm", upsertRealmErr)
-	}
-	return nil
+	}, append(mn.getRealmKeys(realmName), mn.getRealmKeys(realmNew.Name)...)...)
 }
 
 // getRealmObject - getting realm without clients and users
@@ -312,7 +455,7 @@ func (mn *RedisDataManager) UpdateRealm(realmName string, realmNew data.Realm) e
  */
 func (mn *RedisDataManager) getRealmObject(realmName string) (*data.Realm, error) {
 	realmKey := sf.Format(realmKeyTemplate, mn.namespace, realmName)
-	realm, err := getSingleRedisObject[data.Realm](mn.redisClient, mn.ctx, mn.logger, Realm, realmKey)
+	realm, err := getSingleRedisObject[data.Realm](mn.redisClient, mn.getRedisAddress(), mn.ctx, mn.logger, Realm, realmKey)
 	if err != nil {
 		if errors.As(err, &appErrs.EmptyNotFoundErr) {
 			mn.logger.Debug(sf.Format("Redis does not have Realm: \"{0}\"", realmName))
@@ -370,18 +513,29 @@ func (mn *RedisDataManager) deleteRealmClientsObject(realmName string) error {
 	return nil
 }
 
-// deleteRealmUsersObject - deleting realmUsers only
-/* Inside uses realmUsersKeyTemplate
+// deleteRealmUsersObject - deleting realm users relation and users indexes only
+/* Inside uses realmUserNamesKeyTemplate, realmUserIdsKeyTemplate and realmUserEmailsKeyTemplate
  * Arguments:
  *    - realmName
  * Returns: error
  */
 func (mn *RedisDataManager) deleteRealmUsersObject(realmName string) error {
-	realmUsersKey := sf.Format(realmUsersKeyTemplate, mn.namespace, realmName)
-	if err := mn.deleteRedisObject(RealmUsers, realmUsersKey); err != nil {
-		if !errors.As(err, &appErrs.EmptyNotFoundErr) {
-			return appErrs.NewUnknownError("deleteRedisObject", "RedisDataManager.deleteRealmUsersObject", err)
+	objNames := []objectType{RealmUsers, RealmUserIds, RealmUserEmails}
+	for i, realmUsersKey := range mn.getRealmUsersKeys(realmName) {
+		if err := mn.deleteRedisObject(objNames[i], realmUsersKey); err != nil {
+			if !errors.As(err, &appErrs.EmptyNotFoundErr) {
+				return appErrs.NewUnknownError("deleteRedisObject", "RedisDataManager.deleteRealmUsersObject", err)
+			}
 		}
 	}
 	return nil
 }
+
+// getRealmKeys returns keys of all realm level objects (realm, realm clients, realm users and users indexes, user federations,
+// revisions)
+func (mn *RedisDataManager) getRealmKeys(realmName string) []string {
+	return append([]string{
+		sf.Format(realmKeyTemplate, mn.namespace, realmName), sf.Format(realmClientsKeyTemplate, mn.namespace, realmName),
+		sf.Format(realmUserFederationServiceTemplate, mn.namespace, realmName), sf.Format(realmRevisionsKeyTemplate, mn.namespace, realmName),
+	}, mn.getRealmUsersKeys(realmName)...)
+}
@@ -0,0 +1,128 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/wissance/Ferrum/config"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	sf "github.com/wissance/stringFormatter"
+)
+
+// GetRevisions returns revisions of realm or realm client (see managers.RevisionsKeeper)
+/* Parameters:
+ *     - realmName - name of a realm
+ *     - objectType - data.RealmRevision or data.ClientRevision
+ *     - objectName - name of a client (not used for realm)
+ * Returns: revisions ordered by version (empty slice if object doesn't have revisions) and error (appErrs.ObjectNotFoundError
+ * if realm doesn't exist)
+ */
+func (mn *RedisDataManager) GetRevisions(ctx context.Context, realmName string, objectType data.RevisionObjectType, objectName string,
+) ([]data.Revision, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	if !mn.IsAvailable() {
+		return nil, appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
+	}
+	if _, err := mn.getRealmObject(realmName); err != nil {
+		return nil, err
+	}
+	return mn.getRevisions(realmName, objectType, objectName)
+}
+
+// addRevision adds revision to history of changed object (see data.AddRevision), history is not kept if revisionsLimit is 0
+/* History must be read (see getRevisions) before operation changes it because reads in transaction don't see queued writes
+ * Parameters:
+ *     - history - object revisions before change
+ *     - previous - revision of object state before change (nil if object was created)
+ *     - revision - revision of object state after change
+ * Returns: error
+ */
+func (mn *RedisDataManager) addRevision(history []data.Revision, previous *data.Revision, revision data.Revision) error {
+	if mn.revisionsLimit <= 0 {
+		return nil
+	}
+	history = data.AddRevision(history, previous, revision, mn.revisionsLimit)
+	return mn.putRevisions(revision.Realm, revision.ObjectType, revision.ObjectName, history)
+}
+
+// getRevisions reads revisions of object from realm revisions HASH (realmRevisionsKeyTemplate), revisions are returned with
+// actual realm name (realm could be renamed)
+func (mn *RedisDataManager) getRevisions(realmName string, objectType data.RevisionObjectType, objectName string,
+) ([]data.Revision, error) {
+	revisions := make([]data.Revision, 0)
+	revisionsKey := sf.Format(realmRevisionsKeyTemplate, mn.namespace, realmName)
+	revisionsJson, err := mn.getRedisHashField(RealmRevisions, revisionsKey, getRevisionsField(objectType, objectName))
+	if err != nil {
+		if errors.As(err, &appErrs.ObjectNotFoundError{}) {
+			return revisions, nil
+		}
+		return nil, appErrs.NewUnknownError("getRedisHashField", "RedisDataManager.getRevisions", err)
+	}
+	if err = json.Unmarshal([]byte(revisionsJson), &revisions); err != nil {
+		mn.logger.Error(sf.Format("An error occurred during revisions unmarshall: {0}", err.Error()))
+		return nil, appErrs.NewUnknownError("json.Unmarshal", "RedisDataManager.getRevisions", err)
+	}
+	for i := range revisions {
+		revisions[i].Realm = realmName
+	}
+	return revisions, nil
+}
+
+// putRevisions stores revisions of object (JSON array in realm revisions HASH field {objectType}:{objectName}), empty history is removed
+func (mn *RedisDataManager) putRevisions(realmName string, objectType data.RevisionObjectType, objectName string,
+	history []data.Revision,
+) error {
+	revisionsKey := sf.Format(realmRevisionsKeyTemplate, mn.namespace, realmName)
+	field := getRevisionsField(objectType, objectName)
+	if len(history) == 0 {
+		return mn.deleteRedisHashField(RealmRevisions, revisionsKey, field)
+	}
+	for i := range history {
+		history[i].ObjectName = objectName
+	}
+	historyBytes, err := json.Marshal(history)
+	if err != nil {
+		mn.logger.Error(sf.Format("An error occurred during Marshal revisions: {0}", err.Error()))
+		return appErrs.NewUnknownError("json.Marshal", "RedisDataManager.putRevisions", err)
+	}
+	return mn.upsertRedisHashField(RealmRevisions, revisionsKey, field, string(historyBytes))
+}
+
+// moveRealmRevisions copies revisions of realm and its clients to realm with a new name (old revisions are removed with old realm)
+func (mn *RedisDataManager) moveRealmRevisions(oldRealmName string, newRealmName string) error {
+	oldKey := sf.Format(realmRevisionsKeyTemplate, mn.namespace, oldRealmName)
+	redisCmd := mn.redisClient.HGetAll(mn.ctx, oldKey)
+	if redisCmd.Err() != nil {
+		mn.logger.Warn(sf.Format("An error occurred during HGetAll {0}: \"{1}\" from Redis server", RealmRevisions, oldKey))
+		return GetRedisError(mn.ctx, mn.getRedisAddress(), redisCmd.Err())
+	}
+	newKey := sf.Format(realmRevisionsKeyTemplate, mn.namespace, newRealmName)
+	for field, value := range redisCmd.Val() {
+		if err := mn.upsertRedisHashField(RealmRevisions, newKey, field, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteRealmRevisionsObject deletes revisions of realm and its clients, absence of revisions is not an error
+func (mn *RedisDataManager) deleteRealmRevisionsObject(realmName string) error {
+	revisionsKey := sf.Format(realmRevisionsKeyTemplate, mn.namespace, realmName)
+	if err := mn.deleteRedisObject(RealmRevisions, revisionsKey); err != nil {
+		if !errors.As(err, &appErrs.ObjectNotFoundError{}) {
+			return appErrs.NewUnknownError("deleteRedisObject", "RedisDataManager.deleteRealmRevisionsObject", err)
+		}
+	}
+	return nil
+}
+
+// getRevisionsField returns field of object revisions in realm revisions HASH
+func getRevisionsField(objectType data.RevisionObjectType, objectName string) string {
+	if objectType == data.RealmRevision {
+		return string(objectType)
+	}
+	return string(objectType) + ":" + objectName
+}
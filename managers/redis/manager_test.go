@@ -1,11 +1,19 @@
 package redis
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/wissance/Ferrum/config"
@@ -65,13 +73,13 @@ func TestCreateRealmSuccessfully(t *testing.T) {
 				realm.Users = append(realm.Users, rawUser)
 			}
 
-			err := manager.CreateRealm(realm)
+			err := manager.CreateRealm(context.Background(), realm)
 			assert.NoError(t, err)
-			r, err := manager.GetRealm(realm.Name)
+			r, err := manager.GetRealm(context.Background(), realm.Name)
 			assert.NoError(t, err)
 			checkRealm(t, &realm, r)
 			assert.Equal(t, len(tCase.clients), len(r.Clients))
-			users, err := manager.GetUsers(realm.Name)
+			users, err := manager.GetUsers(context.Background(), realm.Name)
 			assert.NoError(t, err)
 			assert.Equal(t, len(realm.Users), len(users))
 			expectedUsers := make([]data.User, len(realm.Users))
@@ -81,7 +89,7 @@ func TestCreateRealmSuccessfully(t *testing.T) {
 				}
 			}
 			checkUsers(t, &expectedUsers, &users)
-			err = manager.DeleteRealm(realm.Name)
+			err = manager.DeleteRealm(context.Background(), realm.Name)
 			assert.NoError(t, err)
 		})
 	}
@@ -122,14 +130,14 @@ func TestCreateRealmWithFederationSuccessfully(t *testing.T) {
 					},
 				},
 			}
-			err := manager.CreateRealm(realm)
+			err := manager.CreateRealm(context.Background(), realm)
 			assert.NoError(t, err)
-			r, err := manager.GetRealm(realm.Name)
+			r, err := manager.GetRealm(context.Background(), realm.Name)
 			assert.NoError(t, err)
 			checkRealm(t, &realm, r)
-			err = manager.DeleteRealm(realm.Name)
+			err = manager.DeleteRealm(context.Background(), realm.Name)
 			assert.NoError(t, err)
-			userFederationConfigs, err := manager.GetUserFederationConfigs(realm.Name)
+			userFederationConfigs, err := manager.GetUserFederationConfigs(context.Background(), realm.Name)
 			assert.ErrorIs(t, err, appErrs.ErrZeroLength)
 			assert.Nil(t, userFederationConfigs)
 		})
@@ -144,14 +152,14 @@ func TestCreateRealmFailsDuplicateRealm(t *testing.T) {
 		RefreshTokenExpiration: 1800,
 	}
 
-	err := manager.CreateRealm(realm)
+	err := manager.CreateRealm(context.Background(), realm)
 	assert.NoError(t, err)
 
-	err = manager.CreateRealm(realm)
+	err = manager.CreateRealm(context.Background(), realm)
 	assert.Error(t, err)
 	assert.True(t, errors.As(err, &appErrs.ErrExists))
 
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
@@ -163,9 +171,9 @@ func TestUpdateRealmSuccessfully(t *testing.T) {
 		TokenExpiration:        3600,
 		RefreshTokenExpiration: 1800,
 	}
-	err := manager.CreateRealm(realm)
+	err := manager.CreateRealm(context.Background(), realm)
 	assert.NoError(t, err)
-	r, err := manager.GetRealm(realm.Name)
+	r, err := manager.GetRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 	checkRealm(t, &realm, r)
 	prevRealmName := realm.Name
@@ -189,13 +197,39 @@ func TestUpdateRealmSuccessfully(t *testing.T) {
 	assert.NoError(t, err)
 	realm.Users = append(realm.Users, rawUser)
 
-	err = manager.UpdateRealm(prevRealmName, realm)
+	err = manager.UpdateRealm(context.Background(), prevRealmName, realm)
 	assert.NoError(t, err)
-	r, err = manager.GetRealm(realm.Name)
+	r, err = manager.GetRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 	checkRealm(t, &realm, r)
 	// 3. Delete Realm
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
+	assert.NoError(t, err)
+}
+
+func TestUpdateRealmKeepsPasswordSalt(t *testing.T) {
+	manager := createTestRedisDataManager(t)
+	realm := data.Realm{
+		Name:                   sf.Format("realm_4_salt_check_{0}", uuid.New().String()),
+		TokenExpiration:        3600,
+		RefreshTokenExpiration: 1800,
+	}
+	err := manager.CreateRealm(context.Background(), realm)
+	assert.NoError(t, err)
+	r, err := manager.GetRealm(context.Background(), realm.Name)
+	assert.NoError(t, err)
+	salt := r.PasswordSalt
+	assert.NotEmpty(t, salt)
+	// realm update with same name changes only realm properties, salt is not changed because it is used for passwords hashes
+	r.NotBefore = time.Now().Unix()
+	r.PasswordSalt = ""
+	err = manager.UpdateRealm(context.Background(), realm.Name, *r)
+	assert.NoError(t, err)
+	updated, err := manager.GetRealm(context.Background(), realm.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, salt, updated.PasswordSalt)
+	assert.Equal(t, r.NotBefore, updated.NotBefore)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
@@ -205,7 +239,7 @@ func TestUpdateRealmFailsNonExistingRealm(t *testing.T) {
 		Name: "super-duper-realm",
 	}
 	nonExistingRealm := sf.Format("non_existing_{0}", uuid.New().String())
-	err := manager.UpdateRealm(nonExistingRealm, realm)
+	err := manager.UpdateRealm(context.Background(), nonExistingRealm, realm)
 	assert.Error(t, err)
 	assert.True(t, errors.As(err, &appErrs.EmptyNotFoundErr))
 }
@@ -214,7 +248,7 @@ func TestDeleteRealmFailsNonExistingRealm(t *testing.T) {
 	manager := createTestRedisDataManager(t)
 
 	nonExistingRealm := sf.Format("non_existing_{0}", uuid.New().String())
-	err := manager.DeleteRealm(nonExistingRealm)
+	err := manager.DeleteRealm(context.Background(), nonExistingRealm)
 	assert.Error(t, err)
 	assert.True(t, errors.As(err, &appErrs.EmptyNotFoundErr))
 }
@@ -223,7 +257,7 @@ func TestGetRealmFailsNonExistingRealm(t *testing.T) {
 	manager := createTestRedisDataManager(t)
 
 	nonExistingRealm := sf.Format("non_existing_{0}", uuid.New().String())
-	_, err := manager.GetRealm(nonExistingRealm)
+	_, err := manager.GetRealm(context.Background(), nonExistingRealm)
 	assert.Error(t, err)
 	assert.True(t, errors.As(err, &appErrs.EmptyNotFoundErr))
 }
@@ -236,7 +270,7 @@ func TestGetClientsSuccessfully(t *testing.T) {
 		TokenExpiration:        3600,
 		RefreshTokenExpiration: 1800,
 	}
-	err := manager.CreateRealm(realm)
+	err := manager.CreateRealm(context.Background(), realm)
 	assert.NoError(t, err)
 	// 2. Create multiple clients
 	clients := make([]data.Client, 3)
@@ -246,15 +280,15 @@ func TestGetClientsSuccessfully(t *testing.T) {
 			Name: sf.Format("client_{0}_test_multiple_client_get_{1}", i, uuid.New().String()),
 			Type: data.Public,
 		}
-		err = manager.CreateClient(realm.Name, clients[i])
+		err = manager.CreateClient(context.Background(), realm.Name, clients[i])
 		assert.NoError(t, err)
 	}
 	// 3. Get all related to realm clients
-	c, err := manager.GetClients(realm.Name)
+	c, err := manager.GetClients(context.Background(), realm.Name)
 	checkClients(t, &clients, &c)
 	assert.NoError(t, err)
 	// 4. Cleanup via Realm Delete
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
@@ -266,21 +300,21 @@ func TestGetClientsSuccessfullyForEmptyRealm(t *testing.T) {
 		TokenExpiration:        3600,
 		RefreshTokenExpiration: 1800,
 	}
-	err := manager.CreateRealm(realm)
+	err := manager.CreateRealm(context.Background(), realm)
 	assert.NoError(t, err)
 	// 3. Get all related to realm clients
-	c, err := manager.GetClients(realm.Name)
+	c, err := manager.GetClients(context.Background(), realm.Name)
 	assert.NoError(t, err)
 	assert.Equal(t, 0, len(c))
 	// 4. Cleanup via Realm Delete
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
 func TestGetClientsSuccessfullyRealmNotExist(t *testing.T) {
 	manager := createTestRedisDataManager(t)
 	nonExistingRealm := sf.Format("non_existing_{0}", uuid.New().String())
-	c, err := manager.GetClients(nonExistingRealm)
+	c, err := manager.GetClients(context.Background(), nonExistingRealm)
 	assert.NoError(t, err)
 	assert.Equal(t, 0, len(c))
 }
@@ -303,9 +337,9 @@ func TestCreateClientSuccessfully(t *testing.T) {
 				TokenExpiration:        3600,
 				RefreshTokenExpiration: 1800,
 			}
-			err := manager.CreateRealm(realm)
+			err := manager.CreateRealm(context.Background(), realm)
 			assert.NoError(t, err)
-			_, err = manager.GetRealm(realm.Name)
+			_, err = manager.GetRealm(context.Background(), realm.Name)
 			assert.NoError(t, err)
 
 			client := data.Client{
@@ -320,14 +354,14 @@ func TestCreateClientSuccessfully(t *testing.T) {
 				}
 			}
 
-			err = manager.CreateClient(realm.Name, client)
+			err = manager.CreateClient(context.Background(), realm.Name, client)
 			assert.NoError(t, err)
 
-			c, err := manager.GetClient(realm.Name, client.Name)
+			c, err := manager.GetClient(context.Background(), realm.Name, client.Name)
 			assert.NoError(t, err)
 			checkClient(t, &client, c)
 
-			err = manager.DeleteRealm(realm.Name)
+			err = manager.DeleteRealm(context.Background(), realm.Name)
 			assert.NoError(t, err)
 		})
 	}
@@ -340,7 +374,7 @@ func TestCreateClientFailsDuplicateClient(t *testing.T) {
 		TokenExpiration:        3600,
 		RefreshTokenExpiration: 1800,
 	}
-	err := manager.CreateRealm(realm)
+	err := manager.CreateRealm(context.Background(), realm)
 	assert.NoError(t, err)
 
 	client := data.Client{
@@ -349,14 +383,14 @@ func TestCreateClientFailsDuplicateClient(t *testing.T) {
 		ID:   uuid.New(),
 	}
 
-	err = manager.CreateClient(realm.Name, client)
+	err = manager.CreateClient(context.Background(), realm.Name, client)
 	assert.NoError(t, err)
 
-	err = manager.CreateClient(realm.Name, client)
+	err = manager.CreateClient(context.Background(), realm.Name, client)
 	assert.Error(t, err)
 	assert.True(t, errors.As(err, &appErrs.ErrExists))
 
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
@@ -367,7 +401,7 @@ func TestUpdateClientSuccessfully(t *testing.T) {
 		TokenExpiration:        3600,
 		RefreshTokenExpiration: 1800,
 	}
-	err := manager.CreateRealm(realm)
+	err := manager.CreateRealm(context.Background(), realm)
 	assert.NoError(t, err)
 
 	client := data.Client{
@@ -376,10 +410,10 @@ func TestUpdateClientSuccessfully(t *testing.T) {
 		ID:   uuid.New(),
 	}
 
-	err = manager.CreateClient(realm.Name, client)
+	err = manager.CreateClient(context.Background(), realm.Name, client)
 	assert.NoError(t, err)
 
-	c, err := manager.GetClient(realm.Name, client.Name)
+	c, err := manager.GetClient(context.Background(), realm.Name, client.Name)
 	assert.NoError(t, err)
 	checkClient(t, &client, c)
 
@@ -388,13 +422,13 @@ func TestUpdateClientSuccessfully(t *testing.T) {
 		Value: uuid.New().String(),
 	}
 
-	err = manager.UpdateClient(realm.Name, client.Name, client)
+	err = manager.UpdateClient(context.Background(), realm.Name, client.Name, client)
 	assert.NoError(t, err)
-	c, err = manager.GetClient(realm.Name, client.Name)
+	c, err = manager.GetClient(context.Background(), realm.Name, client.Name)
 	assert.NoError(t, err)
 	checkClient(t, &client, c)
 
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
@@ -405,7 +439,7 @@ func TestUpdateClientFailsNonExistingClient(t *testing.T) {
 		TokenExpiration:        3600,
 		RefreshTokenExpiration: 1800,
 	}
-	err := manager.CreateRealm(realm)
+	err := manager.CreateRealm(context.Background(), realm)
 	assert.NoError(t, err)
 
 	nonExistingClient := sf.Format("non-existing-client_{0}", uuid.New().String())
@@ -413,11 +447,11 @@ func TestUpdateClientFailsNonExistingClient(t *testing.T) {
 		Name: "Surprise Motherfucker",
 	}
 
-	err = manager.UpdateClient(realm.Name, nonExistingClient, client)
+	err = manager.UpdateClient(context.Background(), realm.Name, nonExistingClient, client)
 	assert.Error(t, err)
 	assert.True(t, errors.As(err, &appErrs.EmptyNotFoundErr))
 
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
@@ -428,16 +462,16 @@ func TestDeleteClientFailsNonExistingClient(t *testing.T) {
 		TokenExpiration:        3600,
 		RefreshTokenExpiration: 1800,
 	}
-	err := manager.CreateRealm(realm)
+	err := manager.CreateRealm(context.Background(), realm)
 	assert.NoError(t, err)
 
 	nonExistingClient := sf.Format("non-existing-client_{0}", uuid.New().String())
 
-	err = manager.DeleteClient(realm.Name, nonExistingClient)
+	err = manager.DeleteClient(context.Background(), realm.Name, nonExistingClient)
 	assert.Error(t, err)
 	assert.True(t, errors.As(err, &appErrs.EmptyNotFoundErr))
 
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
@@ -448,16 +482,16 @@ func TestGetClientFailsNonExistingClient(t *testing.T) {
 		TokenExpiration:        3600,
 		RefreshTokenExpiration: 1800,
 	}
-	err := manager.CreateRealm(realm)
+	err := manager.CreateRealm(context.Background(), realm)
 	assert.NoError(t, err)
 
 	nonExistingClient := sf.Format("non-existing-client_{0}", uuid.New().String())
 
-	_, err = manager.GetClient(realm.Name, nonExistingClient)
+	_, err = manager.GetClient(context.Background(), realm.Name, nonExistingClient)
 	assert.Error(t, err)
 	assert.True(t, errors.As(err, &appErrs.EmptyNotFoundErr))
 
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
@@ -469,9 +503,9 @@ func TestGetUsersSuccessfully(t *testing.T) {
 		TokenExpiration:        3600,
 		RefreshTokenExpiration: 1800,
 	}
-	err := manager.CreateRealm(r)
+	err := manager.CreateRealm(context.Background(), r)
 	assert.NoError(t, err)
-	realm, err := manager.GetRealm(r.Name)
+	realm, err := manager.GetRealm(context.Background(), r.Name)
 	assert.NoError(t, err)
 	// 2. Create multiple users
 	users := make([]data.User, 3)
@@ -484,16 +518,16 @@ func TestGetUsersSuccessfully(t *testing.T) {
 		err = json.Unmarshal([]byte(jsonStr), &rawUser)
 		assert.NoError(t, err)
 		user := data.CreateUser(rawUser, nil)
-		err = manager.CreateUser(realm.Name, user)
+		err = manager.CreateUser(context.Background(), realm.Name, user)
 		users[i] = user
 		assert.NoError(t, err)
 	}
 	// 3. Get all related to realm users
-	u, err := manager.GetUsers(realm.Name)
+	u, err := manager.GetUsers(context.Background(), realm.Name)
 	checkUsers(t, &users, &u)
 	assert.NoError(t, err)
 	// 4. Cleanup via Realm Delete
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
@@ -505,23 +539,23 @@ func TestGetUsersSuccessfullyEmptyRealm(t *testing.T) {
 		TokenExpiration:        3600,
 		RefreshTokenExpiration: 1800,
 	}
-	err := manager.CreateRealm(realm)
+	err := manager.CreateRealm(context.Background(), realm)
 	assert.NoError(t, err)
 
 	// 2. Get all related to realm users
-	u, err := manager.GetUsers(realm.Name)
+	u, err := manager.GetUsers(context.Background(), realm.Name)
 	assert.Equal(t, 0, len(u))
 	assert.NoError(t, err)
 
 	// 3. Cleanup all resources via DeleteRealm
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
 func TestGetUsersSuccessfullyNonExistingRealm(t *testing.T) {
 	manager := createTestRedisDataManager(t)
 	nonExistingRealm := sf.Format("non_existing_{0}", uuid.New().String())
-	u, err := manager.GetUsers(nonExistingRealm)
+	u, err := manager.GetUsers(context.Background(), nonExistingRealm)
 	assert.Equal(t, 0, len(u))
 	assert.NoError(t, err)
 }
@@ -534,7 +568,7 @@ func TestGetUserByIdSuccessfully(t *testing.T) {
 		TokenExpiration:        3600,
 		RefreshTokenExpiration: 1800,
 	}
-	err := manager.CreateRealm(realm)
+	err := manager.CreateRealm(context.Background(), realm)
 	assert.NoError(t, err)
 
 	userId := uuid.New()
@@ -544,14 +578,14 @@ func TestGetUserByIdSuccessfully(t *testing.T) {
 	err = json.Unmarshal([]byte(jsonStr), &rawUser)
 	assert.NoError(t, err)
 	user := data.CreateUser(rawUser, nil)
-	err = manager.CreateUser(realm.Name, user)
+	err = manager.CreateUser(context.Background(), realm.Name, user)
 	assert.NoError(t, err)
 
-	u, err := manager.GetUserById(realm.Name, userId)
+	u, err := manager.GetUserById(context.Background(), realm.Name, userId)
 	assert.NoError(t, err)
 	checkUser(t, &user, &u)
 
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
@@ -563,16 +597,61 @@ func TestGetUserByIdFailsUserDoesNotExists(t *testing.T) {
 		TokenExpiration:        3600,
 		RefreshTokenExpiration: 1800,
 	}
-	err := manager.CreateRealm(realm)
+	err := manager.CreateRealm(context.Background(), realm)
 	assert.NoError(t, err)
 
 	userId := uuid.New()
 
-	_, err = manager.GetUserById(realm.Name, userId)
+	_, err = manager.GetUserById(context.Background(), realm.Name, userId)
 	assert.Error(t, err)
 	assert.True(t, errors.As(err, &appErrs.EmptyNotFoundErr))
 
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
+	assert.NoError(t, err)
+}
+
+func TestGetUserByEmailSuccessfully(t *testing.T) {
+	manager := createTestRedisDataManager(t)
+	realm := data.Realm{
+		Name:                   "realm_4_test_get_user_by_email",
+		TokenExpiration:        3600,
+		RefreshTokenExpiration: 1800,
+	}
+	err := manager.CreateRealm(context.Background(), realm)
+	assert.NoError(t, err)
+
+	userId := uuid.New()
+	jsonTemplate := `{"info":{"sub":"{2}", "preferred_username": "{0}", "email": "{1}"}, "credentials":{"password": "123"}}`
+	var rawUser interface{}
+	err = json.Unmarshal([]byte(sf.Format(jsonTemplate, "lipa", "Lipa@Wissance.com", userId)), &rawUser)
+	assert.NoError(t, err)
+	user := data.CreateUser(rawUser, nil)
+	err = manager.CreateUser(context.Background(), realm.Name, user)
+	assert.NoError(t, err)
+
+	u, err := manager.GetUserByEmail(context.Background(), realm.Name, "lipa@wissance.com")
+	assert.NoError(t, err)
+	checkUser(t, &user, &u)
+
+	// email change must update index
+	err = json.Unmarshal([]byte(sf.Format(jsonTemplate, "lipa", "lipa@ferrum.com", userId)), &rawUser)
+	assert.NoError(t, err)
+	err = manager.UpdateUser(context.Background(), realm.Name, "lipa", data.CreateUser(rawUser, nil))
+	assert.NoError(t, err)
+	_, err = manager.GetUserByEmail(context.Background(), realm.Name, "lipa@wissance.com")
+	assert.True(t, errors.As(err, &appErrs.EmptyNotFoundErr))
+	u, err = manager.GetUserByEmail(context.Background(), realm.Name, "lipa@ferrum.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "lipa", u.GetUsername())
+
+	err = manager.DeleteUser(context.Background(), realm.Name, "lipa")
+	assert.NoError(t, err)
+	_, err = manager.GetUserByEmail(context.Background(), realm.Name, "lipa@ferrum.com")
+	assert.True(t, errors.As(err, &appErrs.EmptyNotFoundErr))
+	_, err = manager.GetUserById(context.Background(), realm.Name, userId)
+	assert.True(t, errors.As(err, &appErrs.EmptyNotFoundErr))
+
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
@@ -595,9 +674,9 @@ func TestCreateUserSuccessfully(t *testing.T) {
 				TokenExpiration:        3600,
 				RefreshTokenExpiration: 1800,
 			}
-			err := manager.CreateRealm(realm)
+			err := manager.CreateRealm(context.Background(), realm)
 			assert.NoError(t, err)
-			r, err := manager.GetRealm(realm.Name)
+			r, err := manager.GetRealm(context.Background(), realm.Name)
 			assert.NoError(t, err)
 			checkRealm(t, &realm, r)
 
@@ -607,12 +686,12 @@ func TestCreateUserSuccessfully(t *testing.T) {
 			err = json.Unmarshal([]byte(jsonStr), &rawUser)
 			assert.NoError(t, err)
 			user := data.CreateUser(rawUser, r.Encoder)
-			err = manager.CreateUser(realm.Name, user)
+			err = manager.CreateUser(context.Background(), realm.Name, user)
 			assert.NoError(t, err)
-			storedUser, err := manager.GetUser(realm.Name, tCase.userName)
+			storedUser, err := manager.GetUser(context.Background(), realm.Name, tCase.userName)
 			assert.NoError(t, err)
 			assert.Equal(t, tCase.userName, storedUser.GetUsername())
-			err = manager.DeleteRealm(realm.Name)
+			err = manager.DeleteRealm(context.Background(), realm.Name)
 			assert.NoError(t, err)
 		})
 	}
@@ -627,7 +706,7 @@ func TestCreateUserFailsDuplicateUser(t *testing.T) {
 		RefreshTokenExpiration: 1800,
 		Encoder:                encoding.NewPasswordJsonEncoder("salt"),
 	}
-	err := manager.CreateRealm(realm)
+	err := manager.CreateRealm(context.Background(), realm)
 	assert.NoError(t, err)
 
 	jsonTemplate := `{"info":{"name":"{0}", "preferred_username": "{0}"}, "credentials":{"password": "{1}"}}`
@@ -636,14 +715,47 @@ func TestCreateUserFailsDuplicateUser(t *testing.T) {
 	err = json.Unmarshal([]byte(jsonStr), &rawUser)
 	assert.NoError(t, err)
 	user := data.CreateUser(rawUser, realm.Encoder)
-	err = manager.CreateUser(realm.Name, user)
+	err = manager.CreateUser(context.Background(), realm.Name, user)
 	assert.NoError(t, err)
 
-	err = manager.CreateUser(realm.Name, user)
+	err = manager.CreateUser(context.Background(), realm.Name, user)
 	assert.Error(t, err)
 	assert.True(t, errors.As(err, &appErrs.ErrExists))
 
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
+	assert.NoError(t, err)
+}
+
+func TestCreateUserFailsDuplicateUserId(t *testing.T) {
+	manager := createTestRedisDataManager(t)
+	realm := data.Realm{
+		Name:                   "realm_4_test_create_user_duplicate_id",
+		TokenExpiration:        3600,
+		RefreshTokenExpiration: 1800,
+	}
+	err := manager.CreateRealm(context.Background(), realm)
+	assert.NoError(t, err)
+
+	userId := uuid.New()
+	jsonTemplate := `{"info":{"sub":"{1}", "preferred_username": "{0}"}, "credentials":{"password": "123"}}`
+	for i, userName := range []string{"first_user", "second_user"} {
+		var rawUser interface{}
+		err = json.Unmarshal([]byte(sf.Format(jsonTemplate, userName, userId)), &rawUser)
+		assert.NoError(t, err)
+		err = manager.CreateUser(context.Background(), realm.Name, data.CreateUser(rawUser, nil))
+		if i == 0 {
+			assert.NoError(t, err)
+		} else {
+			assert.True(t, errors.As(err, &appErrs.ObjectAlreadyExistsError{}))
+		}
+	}
+	_, err = manager.GetUser(context.Background(), realm.Name, "second_user")
+	assert.True(t, errors.As(err, &appErrs.EmptyNotFoundErr))
+	u, err := manager.GetUserById(context.Background(), realm.Name, userId)
+	assert.NoError(t, err)
+	assert.Equal(t, "first_user", u.GetUsername())
+
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
@@ -656,7 +768,7 @@ func TestUpdateUserSuccessfully(t *testing.T) {
 		RefreshTokenExpiration: 1800,
 		Encoder:                encoding.NewPasswordJsonEncoder("salt"),
 	}
-	err := manager.CreateRealm(realm)
+	err := manager.CreateRealm(context.Background(), realm)
 	assert.NoError(t, err)
 	userName := "pppetrov"
 
@@ -666,7 +778,7 @@ func TestUpdateUserSuccessfully(t *testing.T) {
 	err = json.Unmarshal([]byte(jsonStr), &rawUser)
 	assert.NoError(t, err)
 	user := data.CreateUser(rawUser, realm.Encoder)
-	err = manager.CreateUser(realm.Name, user)
+	err = manager.CreateUser(context.Background(), realm.Name, user)
 	assert.NoError(t, err)
 
 	jsonTemplate = `{"info":{"sub":"{2}", "name":"{0}", "preferred_username": "{0}"}, "credentials":{"password": "{1}"}}`
@@ -675,13 +787,13 @@ func TestUpdateUserSuccessfully(t *testing.T) {
 	assert.NoError(t, err)
 	user = data.CreateUser(rawUser, nil)
 
-	err = manager.UpdateUser(realm.Name, userName, user)
+	err = manager.UpdateUser(context.Background(), realm.Name, userName, user)
 	assert.NoError(t, err)
-	u, err := manager.GetUser(realm.Name, userName)
+	u, err := manager.GetUser(context.Background(), realm.Name, userName)
 	assert.NoError(t, err)
 	checkUser(t, &user, &u)
 
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
@@ -693,7 +805,7 @@ func TestUpdateUserFailsNonExistingUser(t *testing.T) {
 		TokenExpiration:        3600,
 		RefreshTokenExpiration: 1800,
 	}
-	err := manager.CreateRealm(realm)
+	err := manager.CreateRealm(context.Background(), realm)
 	assert.NoError(t, err)
 
 	userName := sf.Format("non-existing-user-{0}", uuid.New().String())
@@ -703,11 +815,11 @@ func TestUpdateUserFailsNonExistingUser(t *testing.T) {
 	err = json.Unmarshal([]byte(jsonStr), &rawUser)
 	assert.NoError(t, err)
 	user := data.CreateUser(rawUser, nil)
-	err = manager.UpdateUser(realm.Name, userName, user)
+	err = manager.UpdateUser(context.Background(), realm.Name, userName, user)
 	assert.Error(t, err)
 	assert.True(t, errors.As(err, &appErrs.EmptyNotFoundErr))
 
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
@@ -719,7 +831,7 @@ func TestDeleteUserSuccessfully(t *testing.T) {
 		TokenExpiration:        3600,
 		RefreshTokenExpiration: 1800,
 	}
-	err := manager.CreateRealm(realm)
+	err := manager.CreateRealm(context.Background(), realm)
 	assert.NoError(t, err)
 	userName := "sidorov"
 
@@ -729,15 +841,15 @@ func TestDeleteUserSuccessfully(t *testing.T) {
 	err = json.Unmarshal([]byte(jsonStr), &rawUser)
 	assert.NoError(t, err)
 	user := data.CreateUser(rawUser, nil)
-	err = manager.CreateUser(realm.Name, user)
+	err = manager.CreateUser(context.Background(), realm.Name, user)
 	assert.NoError(t, err)
-	u, err := manager.GetUser(realm.Name, userName)
+	u, err := manager.GetUser(context.Background(), realm.Name, userName)
 	assert.NoError(t, err)
 	checkUser(t, &user, &u)
 
-	err = manager.DeleteUser(realm.Name, userName)
+	err = manager.DeleteUser(context.Background(), realm.Name, userName)
 	assert.NoError(t, err)
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
@@ -749,15 +861,15 @@ func TestDeleteUserFailsNonExistingUser(t *testing.T) {
 		TokenExpiration:        3600,
 		RefreshTokenExpiration: 1800,
 	}
-	err := manager.CreateRealm(realm)
+	err := manager.CreateRealm(context.Background(), realm)
 	assert.NoError(t, err)
 
 	userName := sf.Format("non_existing_user_{0}", uuid.New().String())
-	err = manager.DeleteUser(realm.Name, userName)
+	err = manager.DeleteUser(context.Background(), realm.Name, userName)
 	assert.Error(t, err)
 	assert.True(t, errors.As(err, &appErrs.EmptyNotFoundErr))
 
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
@@ -769,15 +881,15 @@ func TestGetUserFailsNonExistingUser(t *testing.T) {
 		TokenExpiration:        3600,
 		RefreshTokenExpiration: 1800,
 	}
-	err := manager.CreateRealm(realm)
+	err := manager.CreateRealm(context.Background(), realm)
 	assert.NoError(t, err)
 
 	userName := sf.Format("non_existing_user_{0}", uuid.New().String())
-	_, err = manager.GetUser(realm.Name, userName)
+	_, err = manager.GetUser(context.Background(), realm.Name, userName)
 	assert.Error(t, err)
 	assert.True(t, errors.As(err, &appErrs.EmptyNotFoundErr))
 
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
@@ -800,10 +912,10 @@ func TestChangeUserPasswordSuccessfully(t *testing.T) {
 		},
 	}
 	realm.Clients = append(realm.Clients, client)
-	err := manager.CreateRealm(*realm)
+	err := manager.CreateRealm(context.Background(), *realm)
 	assert.NoError(t, err)
 
-	realm, err = manager.GetRealm(realm.Name)
+	realm, err = manager.GetRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 
 	userName := "new_app_user"
@@ -813,12 +925,12 @@ func TestChangeUserPasswordSuccessfully(t *testing.T) {
 	err = json.Unmarshal([]byte(userJson), &rawUser)
 	assert.NoError(t, err)
 	user := data.CreateUser(rawUser, realm.Encoder)
-	err = manager.CreateUser(realm.Name, user)
+	err = manager.CreateUser(context.Background(), realm.Name, user)
 	assert.NoError(t, err)
 
 	// 2. Reset Password and check ...
 	newPassword := "123_ololo_321"
-	err = manager.SetPassword(realm.Name, userName, newPassword)
+	err = manager.SetPassword(context.Background(), realm.Name, userName, newPassword)
 	assert.NoError(t, err)
 
 	var rawUser2 interface{}
@@ -827,11 +939,11 @@ func TestChangeUserPasswordSuccessfully(t *testing.T) {
 	assert.NoError(t, err)
 	expectedUser := data.CreateUser(rawUser2, realm.Encoder)
 	assert.NoError(t, err)
-	u, err := manager.GetUser(realm.Name, userName)
+	u, err := manager.GetUser(context.Background(), realm.Name, userName)
 	assert.NoError(t, err)
 	checkUser(t, &expectedUser, &u)
 
-	err = manager.DeleteRealm(realm.Name)
+	err = manager.DeleteRealm(context.Background(), realm.Name)
 	assert.NoError(t, err)
 }
 
@@ -854,9 +966,9 @@ func TestCreateUserFederationServiceConfigSuccessfully(t *testing.T) {
 				RefreshTokenExpiration: 1800,
 			}
 
-			err := manager.CreateRealm(realm)
+			err := manager.CreateRealm(context.Background(), realm)
 			assert.NoError(t, err)
-			r, err := manager.GetRealm(realm.Name)
+			r, err := manager.GetRealm(context.Background(), realm.Name)
 			assert.NoError(t, err)
 			checkRealm(t, &realm, r)
 
@@ -869,14 +981,14 @@ func TestCreateUserFederationServiceConfigSuccessfully(t *testing.T) {
 				SysPassword: "admin",
 			}
 
-			err = manager.CreateUserFederationConfig(realm.Name, userFederationServiceConfig)
+			err = manager.CreateUserFederationConfig(context.Background(), realm.Name, userFederationServiceConfig)
 			assert.NoError(t, err)
 
-			actualConfig, err := manager.GetUserFederationConfig(realm.Name, userFederationServiceConfig.Name)
+			actualConfig, err := manager.GetUserFederationConfig(context.Background(), realm.Name, userFederationServiceConfig.Name)
 			assert.NoError(t, err)
 			checkUserFederationConfig(t, &userFederationServiceConfig, actualConfig)
 
-			err = manager.DeleteRealm(realm.Name)
+			err = manager.DeleteRealm(context.Background(), realm.Name)
 			assert.NoError(t, err)
 		})
 	}
@@ -901,9 +1013,9 @@ func TestUpdateUserFederationServiceConfigSuccessfully(t *testing.T) {
 				RefreshTokenExpiration: 1800,
 			}
 
-			err := manager.CreateRealm(realm)
+			err := manager.CreateRealm(context.Background(), realm)
 			assert.NoError(t, err)
-			r, err := manager.GetRealm(realm.Name)
+			r, err := manager.GetRealm(context.Background(), realm.Name)
 			assert.NoError(t, err)
 			checkRealm(t, &realm, r)
 
@@ -916,21 +1028,21 @@ func TestUpdateUserFederationServiceConfigSuccessfully(t *testing.T) {
 				SysPassword: "admin",
 			}
 
-			err = manager.CreateUserFederationConfig(realm.Name, userFederationServiceConfig)
+			err = manager.CreateUserFederationConfig(context.Background(), realm.Name, userFederationServiceConfig)
 			assert.NoError(t, err)
 
-			actualConfig, err := manager.GetUserFederationConfig(realm.Name, userFederationServiceConfig.Name)
+			actualConfig, err := manager.GetUserFederationConfig(context.Background(), realm.Name, userFederationServiceConfig.Name)
 			assert.NoError(t, err)
 			checkUserFederationConfig(t, &userFederationServiceConfig, actualConfig)
 
 			userFederationServiceConfig.Url = "ldap://domain2.wissance.com:389"
-			err = manager.UpdateUserFederationConfig(realm.Name, userFederationServiceConfig.Name, userFederationServiceConfig)
+			err = manager.UpdateUserFederationConfig(context.Background(), realm.Name, userFederationServiceConfig.Name, userFederationServiceConfig)
 			assert.NoError(t, err)
-			actualConfig, err = manager.GetUserFederationConfig(realm.Name, userFederationServiceConfig.Name)
+			actualConfig, err = manager.GetUserFederationConfig(context.Background(), realm.Name, userFederationServiceConfig.Name)
 			assert.NoError(t, err)
 			checkUserFederationConfig(t, &userFederationServiceConfig, actualConfig)
 
-			err = manager.DeleteRealm(realm.Name)
+			err = manager.DeleteRealm(context.Background(), realm.Name)
 			assert.NoError(t, err)
 		})
 	}
@@ -955,9 +1067,9 @@ func TestDeleteUserFederationServiceConfigSuccessfully(t *testing.T) {
 				RefreshTokenExpiration: 1800,
 			}
 
-			err := manager.CreateRealm(realm)
+			err := manager.CreateRealm(context.Background(), realm)
 			assert.NoError(t, err)
-			r, err := manager.GetRealm(realm.Name)
+			r, err := manager.GetRealm(context.Background(), realm.Name)
 			assert.NoError(t, err)
 			checkRealm(t, &realm, r)
 
@@ -978,42 +1090,520 @@ func TestDeleteUserFederationServiceConfigSuccessfully(t *testing.T) {
 				SysPassword: "admin2",
 			}
 
-			err = manager.CreateUserFederationConfig(realm.Name, userFederationServiceConfig)
+			err = manager.CreateUserFederationConfig(context.Background(), realm.Name, userFederationServiceConfig)
 			assert.NoError(t, err)
-			err = manager.CreateUserFederationConfig(realm.Name, userFederationServiceConfig2)
+			err = manager.CreateUserFederationConfig(context.Background(), realm.Name, userFederationServiceConfig2)
 			assert.NoError(t, err)
 
-			err = manager.DeleteUserFederationConfig(realm.Name, userFederationServiceConfig.Name)
+			err = manager.DeleteUserFederationConfig(context.Background(), realm.Name, userFederationServiceConfig.Name)
 			assert.NoError(t, err)
-			actualConfig, err := manager.GetUserFederationConfig(realm.Name, userFederationServiceConfig.Name)
+			actualConfig, err := manager.GetUserFederationConfig(context.Background(), realm.Name, userFederationServiceConfig.Name)
 			assert.Error(t, err)
 			assert.Nil(t, actualConfig)
 
-			actualConfig, err = manager.GetUserFederationConfig(realm.Name, userFederationServiceConfig2.Name)
+			actualConfig, err = manager.GetUserFederationConfig(context.Background(), realm.Name, userFederationServiceConfig2.Name)
 			assert.NoError(t, err)
 			checkUserFederationConfig(t, &userFederationServiceConfig2, actualConfig)
 
-			err = manager.DeleteRealm(realm.Name)
+			err = manager.DeleteRealm(context.Background(), realm.Name)
 			assert.NoError(t, err)
 		})
 	}
 }
 
-func createTestRedisDataManager(t *testing.T) *RedisDataManager {
-	rndNamespace := sf.Format("ferrum_test_{0}", uuid.New().String())
+func TestMigrationMovesLegacyRealmUsersToIndexes(t *testing.T) {
+	manager := createTestRedisDataManager(t)
+	ctx := context.Background()
+	realm := data.Realm{
+		Name:                   "legacy_app",
+		TokenExpiration:        3600,
+		RefreshTokenExpiration: 1800,
+	}
+	require.NoError(t, manager.CreateRealm(ctx, realm))
+
+	// namespace data as it was stored by previous Ferrum versions: users LIST and no data version
+	users := []data.User{
+		data.CreateUser(createTestRawUser(t, "legacy_user_1"), nil),
+		data.CreateUser(createTestRawUser(t, "legacy_user_2"), nil),
+	}
+	realmUsers := []data.ExtendedIdentifier{{ID: uuid.New(), Name: "deleted_user"}}
+	for _, user := range users {
+		key := sf.Format(userKeyTemplate, manager.namespace, realm.Name, user.GetUsername())
+		require.NoError(t, manager.redisClient.Set(ctx, key, user.GetJsonString(), 0).Err())
+		realmUsers = append(realmUsers, data.ExtendedIdentifier{ID: user.GetId(), Name: user.GetUsername()})
+	}
+	realmUsersJson, err := json.Marshal(realmUsers)
+	require.NoError(t, err)
+	legacyKey := sf.Format(legacyRealmUsersKeyTemplate, manager.namespace, realm.Name)
+	require.NoError(t, manager.redisClient.RPush(ctx, legacyKey, string(realmUsersJson)).Err())
+	require.NoError(t, manager.redisClient.Del(ctx, sf.Format(schemaVersionKeyTemplate, manager.namespace)).Err())
+
+	// second call checks that migration is not applied twice
+	for i := 0; i < 2; i++ {
+		_, err = manager.applyMigrations(false)
+		require.NoError(t, err)
+	}
+
+	exists, err := manager.redisClient.Exists(ctx, legacyKey).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), exists)
+	version, err := manager.redisClient.Get(ctx, sf.Format(schemaVersionKeyTemplate, manager.namespace)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(migrations[len(migrations)-1].version), version)
+
+	migratedUsers, err := manager.GetUsers(ctx, realm.Name)
+	require.NoError(t, err)
+	checkUsers(t, &users, &migratedUsers)
+	for _, user := range users {
+		u, getErr := manager.GetUserById(ctx, realm.Name, user.GetId())
+		require.NoError(t, getErr)
+		checkUser(t, &user, &u)
+	}
+
+	require.NoError(t, manager.DeleteRealm(ctx, realm.Name))
+}
+
+func TestMigrationMovesRealmUserNamesToSortedSet(t *testing.T) {
+	manager := createTestRedisDataManager(t)
+	ctx := context.Background()
+	realm := data.Realm{
+		Name:                   "set_app",
+		TokenExpiration:        3600,
+		RefreshTokenExpiration: 1800,
+	}
+	require.NoError(t, manager.CreateRealm(ctx, realm))
+	for _, userName := range []string{"user_c", "user_a", "admin", "user_b"} {
+		require.NoError(t, manager.CreateUser(ctx, realm.Name, data.CreateUser(createTestRawUser(t, userName), nil)))
+	}
+
+	// namespace data as it was stored by data version 1: usernames SET
+	userNamesKey := sf.Format(realmUserNamesKeyTemplate, manager.namespace, realm.Name)
+	require.NoError(t, manager.redisClient.Del(ctx, userNamesKey).Err())
+	require.NoError(t, manager.redisClient.SAdd(ctx, userNamesKey, "user_c", "user_a", "admin", "user_b").Err())
+	require.NoError(t, manager.redisClient.Set(ctx, sf.Format(schemaVersionKeyTemplate, manager.namespace), 1, 0).Err())
+
+	// second call checks that migration is not applied twice
+	for i := 0; i < 2; i++ {
+		_, err := manager.applyMigrations(false)
+		require.NoError(t, err)
+	}
+
+	keyType, err := manager.redisClient.Type(ctx, userNamesKey).Result()
+	require.NoError(t, err)
+	assert.Equal(t, "zset", keyType)
+	usersPage, err := manager.SearchUsers(ctx, realm.Name, data.UsersFilter{UsernamePrefix: "user_"}, data.PageRequest{Offset: 1, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 3, usersPage.Total)
+	require.Len(t, usersPage.Users, 1)
+	assert.Equal(t, "user_b", usersPage.Users[0].GetUsername())
+
+	require.NoError(t, manager.DeleteRealm(ctx, realm.Name))
+}
+
+func TestMigrateWhenAutoMigrationIsDisabled(t *testing.T) {
+	dataSourceCfg := createTestRedisDataSourceConfig()
+	dataSourceCfg.Options[config.AutoMigrate] = "false"
+	logger := logging.CreateLogger(&config.LoggingConfig{})
+	manager, err := CreateRedisDataManager(&dataSourceCfg, logger)
+	require.NoError(t, err)
+	ctx := context.Background()
+	versionKey := sf.Format(schemaVersionKeyTemplate, manager.namespace)
+	latestVersion := migrations[len(migrations)-1].version
+
+	// 1. Data that is not migrated can't be used, it could be only read with outdated data reading context
+	assert.False(t, manager.IsAvailable())
+	_, err = manager.GetRealm(ctx, "app")
+	assert.True(t, errors.As(err, &appErrs.DataProviderNotAvailable{}))
+	_, err = manager.GetRealm(data.WithOutdatedDataReading(ctx), "app")
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+	assert.False(t, manager.IsAvailable())
+
+	// 2. Dry run doesn't change data
+	report, err := manager.Migrate(ctx, true)
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 0, report.SchemaVersion)
+	assert.Equal(t, latestVersion, report.TargetVersion)
+	require.Len(t, report.Migrations, len(migrations))
+	assert.Equal(t, migrations[0].version, report.Migrations[0].Version)
+	assert.Equal(t, migrations[0].description, report.Migrations[0].Description)
+	exists, err := manager.redisClient.Exists(ctx, versionKey).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), exists)
+	assert.False(t, manager.IsAvailable())
+
+	// 3. Migration makes data store available, migrated data has nothing to migrate
+	report, err = manager.Migrate(ctx, false)
+	require.NoError(t, err)
+	assert.False(t, report.DryRun)
+	assert.Len(t, report.Migrations, len(migrations))
+	version, err := manager.redisClient.Get(ctx, versionKey).Result()
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(latestVersion), version)
+	assert.True(t, manager.IsAvailable())
+	report, err = manager.Migrate(ctx, true)
+	require.NoError(t, err)
+	assert.Equal(t, latestVersion, report.SchemaVersion)
+	assert.Empty(t, report.Migrations)
+
+	require.NoError(t, manager.redisClient.Del(ctx, versionKey).Err())
+}
+
+func TestMigrationsAreOrderedByVersion(t *testing.T) {
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.version)
+		assert.NotEmpty(t, m.description)
+	}
+}
+
+func TestCreateManagerWhenRedisIsNotAvailable(t *testing.T) {
 	dataSourceCfg := config.DataSourceConfig{
 		Type:   config.REDIS,
-		Source: testRedisSource,
+		Source: "127.0.0.1:1",
 		Options: map[config.DataSourceConnOption]string{
-			config.Namespace: rndNamespace,
+			config.Namespace: "ferrum_test_not_available",
 			config.DbNumber:  "0",
 		},
+	}
+	logger := logging.CreateLogger(&config.LoggingConfig{})
+	manager, err := CreateRedisDataManager(&dataSourceCfg, logger)
+	require.NoError(t, err)
+	assert.False(t, manager.IsAvailable())
+	assert.False(t, manager.migrations.migrated.Load())
+}
+
+func TestOperationsFailWhenRedisIsNotAvailable(t *testing.T) {
+	// listener accepts connections but never replies, operations must be stopped by operation deadline
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+	go func() {
+		for {
+			conn, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+		}
+	}()
+
+	testCases := []struct {
+		name   string
+		source string
+	}{
+		{name: "ConnectionRefused", source: "127.0.0.1:1"},
+		{name: "NoResponse", source: listener.Addr().String()},
+	}
+
+	logger := logging.CreateLogger(&config.LoggingConfig{})
+	ctx := context.Background()
+	for _, tCase := range testCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			dataSourceCfg := config.DataSourceConfig{
+				Type:   config.REDIS,
+				Source: tCase.source,
+				Options: map[config.DataSourceConnOption]string{
+					config.Namespace:            "ferrum_test_not_available",
+					config.DbNumber:             "0",
+					config.MaxRetries:           "-1",
+					config.DataOperationTimeout: "200",
+				},
+			}
+			manager, err := CreateRedisDataManager(&dataSourceCfg, logger)
+			require.NoError(t, err)
+			defer func() {
+				_ = manager.redisClient.Close()
+			}()
+
+			started := time.Now()
+			_, err = manager.GetRealm(ctx, "app")
+			assert.True(t, errors.As(err, &appErrs.DataProviderNotAvailable{}))
+			_, err = manager.GetUsers(ctx, "app")
+			assert.True(t, errors.As(err, &appErrs.DataProviderNotAvailable{}))
+			err = manager.CreateRealm(ctx, data.Realm{Name: "app"})
+			assert.True(t, errors.As(err, &appErrs.DataProviderNotAvailable{}))
+			assert.Less(t, time.Since(started), 5*time.Second)
+		})
+	}
+}
+
+func TestCreateRedisClientForDeploymentModes(t *testing.T) {
+	testCases := []struct {
+		name              string
+		source            string
+		options           map[config.DataSourceConnOption]string
+		expectedCluster   bool
+		expectedNamespace string
+		expectedAddress   string
+	}{
+		{
+			name: "Standalone", source: testRedisSource,
+			options: map[config.DataSourceConnOption]string{config.DbNumber: "1", config.Namespace: "ferrum"}, expectedNamespace: "ferrum",
+			expectedAddress: testRedisSource,
+		},
+		{
+			name: "Sentinel", source: "sentinel-1:26379,sentinel-2:26379",
+			options: map[config.DataSourceConnOption]string{
+				config.RedisModeOption: "sentinel", config.SentinelMasterName: "ferrum_master", config.DbNumber: "1",
+			},
+			expectedNamespace: defaultNamespace, expectedAddress: "ferrum_master@sentinel-1:26379,sentinel-2:26379",
+		},
+		{
+			name: "Cluster", source: "node-1:6379,node-2:6379",
+			options:         map[config.DataSourceConnOption]string{config.RedisModeOption: "cluster", config.Namespace: "ferrum"},
+			expectedCluster: true, expectedNamespace: "{ferrum}", expectedAddress: "node-1:6379,node-2:6379",
+		},
+	}
+
+	logger := logging.CreateLogger(&config.LoggingConfig{})
+	for _, tCase := range testCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			tCase.options[config.PoolSize] = "20"
+			tCase.options[config.MinIdleConns] = "2"
+			tCase.options[config.ReadTimeout] = "-1"
+			tCase.options[config.WriteTimeout] = "300"
+			tCase.options[config.MaxRetries] = "5"
+			dataSourceCfg := config.DataSourceConfig{Type: config.REDIS, Source: tCase.source, Options: tCase.options}
+			require.NoError(t, dataSourceCfg.Validate())
+
+			client, opts := CreateRedisClient(&dataSourceCfg, logger)
+			defer func() {
+				_ = client.Close()
+			}()
+			_, isCluster := client.(*redis.ClusterClient)
+			assert.Equal(t, tCase.expectedCluster, isCluster)
+			assert.Equal(t, dataSourceCfg.GetRedisAddresses(), opts.Addrs)
+			assert.Equal(t, tCase.options[config.SentinelMasterName], opts.MasterName)
+			assert.Equal(t, 20, opts.PoolSize)
+			assert.Equal(t, 2, opts.MinIdleConns)
+			assert.Equal(t, time.Duration(-1), opts.ReadTimeout)
+			assert.Equal(t, 300*time.Millisecond, opts.WriteTimeout)
+			assert.Equal(t, 5, opts.MaxRetries)
+			assert.Equal(t, tCase.expectedNamespace, GetNamespace(&dataSourceCfg))
+			// address of failover client is not known by client itself, it is taken from config
+			assert.Equal(t, tCase.expectedAddress, GetRedisAddress(&dataSourceCfg))
+			err := GetRedisError(context.Background(), GetRedisAddress(&dataSourceCfg), context.DeadlineExceeded)
+			assert.Equal(t, appErrs.NewDataProviderNotAvailable(string(config.REDIS), tCase.expectedAddress), err)
+		})
+	}
+}
+
+func TestClusterModeOperationsSuccessfully(t *testing.T) {
+	namespace := sf.Format("ferrum_test_{0}", uuid.New().String())
+	dataSourceCfg := config.DataSourceConfig{
+		Type:   config.REDIS,
+		Source: testRedisSource,
+		Options: map[config.DataSourceConnOption]string{
+			config.RedisModeOption: string(config.RedisCluster),
+			config.Namespace:       namespace,
+		},
 		Credentials: &config.CredentialsConfig{
 			Username: testUser,
 			Password: testUserPassword,
 		},
 	}
+	require.NoError(t, dataSourceCfg.Validate())
+	manager, err := CreateRedisDataManager(&dataSourceCfg, logging.CreateLogger(&config.LoggingConfig{}))
+	require.NoError(t, err)
+	ctx := context.Background()
 
+	realm := createTestRealmWithObjects(t)
+	require.NoError(t, manager.ImportRealm(ctx, realm))
+	users, err := manager.GetUsers(ctx, realm.Name)
+	require.NoError(t, err)
+	assert.Len(t, users, len(realm.Users))
+	user, err := manager.GetUserById(ctx, realm.Name, users[0].GetId())
+	require.NoError(t, err)
+	assert.Equal(t, users[0].GetUsername(), user.GetUsername())
+
+	// multi keys transaction
+	realm.Name = "renamed_atomic_app"
+	require.NoError(t, manager.UpdateRealm(ctx, "atomic_app", realm))
+	clients, err := manager.GetClients(ctx, realm.Name)
+	require.NoError(t, err)
+	assert.Len(t, clients, len(realm.Clients))
+
+	// all namespace keys are in one cluster slot
+	keys := getNamespaceKeys(getNamespaceData(t, manager), manager.namespace)
+	assert.NotEmpty(t, keys)
+	assert.Equal(t, "{"+namespace+"}", manager.namespace)
+	require.NoError(t, manager.DeleteRealm(ctx, realm.Name))
+}
+
+func TestRealmRevisionsAreRemovedWithRealm(t *testing.T) {
+	manager := createTestRedisDataManager(t)
+	realm := createTestRealmWithObjects(t)
+	require.NoError(t, manager.CreateRealm(context.Background(), realm))
+	assert.Contains(t, getNamespaceKeys(getNamespaceData(t, manager), manager.namespace), ".realm_"+realm.Name+"_revisions")
+	require.NoError(t, manager.DeleteRealm(context.Background(), realm.Name))
+	assert.NotContains(t, getNamespaceKeys(getNamespaceData(t, manager), manager.namespace), ".realm_"+realm.Name+"_revisions")
+}
+
+func TestOperationsFailWithCancelledContext(t *testing.T) {
+	manager := createTestRedisDataManager(t)
+	realm := data.Realm{Name: sf.Format("app_{0}", uuid.New().String()), TokenExpiration: 300, RefreshTokenExpiration: 200}
+	require.NoError(t, manager.CreateRealm(context.Background(), realm))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := manager.GetRealm(ctx, realm.Name)
+	assert.True(t, errors.As(err, &appErrs.DataProviderNotAvailable{}))
+	err = manager.DeleteRealm(ctx, realm.Name)
+	assert.True(t, errors.As(err, &appErrs.DataProviderNotAvailable{}))
+	// cancelled operation doesn't affect manager, next operations use own context
+	_, err = manager.GetRealm(context.Background(), realm.Name)
+	assert.NoError(t, err)
+}
+
+func TestOperationsAreAtomicWhenRedisFailsInTheMiddle(t *testing.T) {
+	testCases := []struct {
+		name      string
+		prepare   bool
+		operation func(manager *RedisDataManager, realm data.Realm) error
+	}{
+		{name: "import_realm", prepare: false, operation: func(manager *RedisDataManager, realm data.Realm) error {
+			return manager.ImportRealm(context.Background(), realm)
+		}},
+		{name: "delete_realm", prepare: true, operation: func(manager *RedisDataManager, realm data.Realm) error {
+			return manager.DeleteRealm(context.Background(), realm.Name)
+		}},
+		{name: "update_realm_with_new_name", prepare: true, operation: func(manager *RedisDataManager, realm data.Realm) error {
+			renamedRealm := realm
+			renamedRealm.Name = realm.Name + "_renamed"
+			return manager.UpdateRealm(context.Background(), realm.Name, renamedRealm)
+		}},
+		{name: "create_user", prepare: true, operation: func(manager *RedisDataManager, realm data.Realm) error {
+			return manager.CreateUser(context.Background(), realm.Name, data.CreateUser(createTestRawUser(t, "new_user"), nil))
+		}},
+		{name: "update_user_with_new_name", prepare: true, operation: func(manager *RedisDataManager, realm data.Realm) error {
+			return manager.UpdateUser(context.Background(), realm.Name, "user_1", data.CreateUser(createTestRawUser(t, "renamed_user"), nil))
+		}},
+		{name: "delete_user", prepare: true, operation: func(manager *RedisDataManager, realm data.Realm) error {
+			return manager.DeleteUser(context.Background(), realm.Name, "user_1")
+		}},
+		{name: "create_client", prepare: true, operation: func(manager *RedisDataManager, realm data.Realm) error {
+			return manager.CreateClient(context.Background(), realm.Name, createTestClient("new_client"))
+		}},
+		{name: "update_client_with_new_name", prepare: true, operation: func(manager *RedisDataManager, realm data.Realm) error {
+			return manager.UpdateClient(context.Background(), realm.Name, "client_1", createTestClient("renamed_client"))
+		}},
+		{name: "delete_client", prepare: true, operation: func(manager *RedisDataManager, realm data.Realm) error {
+			return manager.DeleteClient(context.Background(), realm.Name, "client_1")
+		}},
+	}
+
+	for _, tCase := range testCases {
+		tCase := tCase
+		t.Run(tCase.name, func(t *testing.T) {
+			t.Parallel()
+			// 1. Operation without failures gives number of Redis commands and expected keys
+			manager, hook := createTestRedisDataManagerWithFailingHook(t, tCase.prepare)
+			hook.reset(0)
+			require.NoError(t, tCase.operation(manager, createTestRealmWithObjects(t)))
+			commands := hook.processed
+			expectedKeys := getNamespaceKeys(getNamespaceData(t, manager), manager.namespace)
+
+			// 2. Every Redis command of operation fails, operation must change all keys or nothing
+			for failAt := 1; failAt <= commands; failAt++ {
+				manager, hook = createTestRedisDataManagerWithFailingHook(t, tCase.prepare)
+				dataBefore := getNamespaceData(t, manager)
+				hook.reset(failAt)
+				err := tCase.operation(manager, createTestRealmWithObjects(t))
+				hook.reset(0)
+				dataAfter := getNamespaceData(t, manager)
+				if err != nil {
+					assert.Equal(t, dataBefore, dataAfter, "command %d failed, but data was changed", failAt)
+				} else {
+					assert.Equal(t, expectedKeys, getNamespaceKeys(dataAfter, manager.namespace))
+				}
+			}
+		})
+	}
+}
+
+func TestConcurrentUsersChangesKeepRealmUsersConsistent(t *testing.T) {
+	manager := createTestRedisDataManager(t)
+	realm := createTestRealmWithObjects(t)
+	for i := 0; i < 4; i++ {
+		realm.Users = append(realm.Users, createTestRawUser(t, sf.Format("deleted_user_{0}", i)))
+	}
+	require.NoError(t, manager.ImportRealm(context.Background(), realm))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, manager.DeleteUser(context.Background(), realm.Name, sf.Format("deleted_user_{0}", i)))
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			newUser := data.CreateUser(createTestRawUser(t, sf.Format("created_user_{0}", i)), nil)
+			assert.NoError(t, manager.CreateUser(context.Background(), realm.Name, newUser))
+		}(i)
+	}
+	wg.Wait()
+
+	users, err := manager.GetUsers(context.Background(), realm.Name)
+	require.NoError(t, err)
+	userNames := make([]string, len(users))
+	for i, u := range users {
+		userNames[i] = u.GetUsername()
+	}
+	assert.ElementsMatch(t, []string{
+		"user_1", "user_2", "created_user_0", "created_user_1", "created_user_2", "created_user_3",
+	}, userNames)
+	userKeys, err := manager.redisClient.Keys(context.Background(), sf.Format(userKeyTemplate, manager.namespace, realm.Name, "*")).Result()
+	require.NoError(t, err)
+	assert.Equal(t, len(users), len(userKeys))
+}
+
+func TestMessageBusDeliversMessagesToAllSubscribers(t *testing.T) {
+	dataSourceCfg := createTestRedisDataSourceConfig()
+	logger := logging.CreateLogger(&config.LoggingConfig{})
+	buses := []*RedisMessageBus{
+		CreateRedisMessageBus(&dataSourceCfg, "test", logger),
+		CreateRedisMessageBus(&dataSourceCfg, "test", logger),
+	}
+	received := make(chan string, 10)
+	subscribed := make(chan struct{}, 10)
+	for _, bus := range buses {
+		bus.Subscribe(func(message string) {
+			received <- message
+		}, func() {
+			subscribed <- struct{}{}
+		})
+	}
+	defer func() {
+		for _, bus := range buses {
+			assert.NoError(t, bus.Close())
+		}
+	}()
+	for range buses {
+		select {
+		case <-subscribed:
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "subscription was not confirmed")
+		}
+	}
+
+	require.NoError(t, buses[0].Publish(context.Background(), "invalidate"))
+	for range buses {
+		select {
+		case message := <-received:
+			assert.Equal(t, "invalidate", message)
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "message was not received")
+		}
+	}
+}
+
+func createTestRedisDataManager(t *testing.T) *RedisDataManager {
+	dataSourceCfg := createTestRedisDataSourceConfig()
 	loggerCfg := config.LoggingConfig{}
 
 	logger := logging.CreateLogger(&loggerCfg)
@@ -1022,6 +1612,161 @@ func createTestRedisDataManager(t *testing.T) *RedisDataManager {
 	return manager
 }
 
+// createTestRedisDataSourceConfig creates config of test Redis with random namespace
+func createTestRedisDataSourceConfig() config.DataSourceConfig {
+	rndNamespace := sf.Format("ferrum_test_{0}", uuid.New().String())
+	return config.DataSourceConfig{
+		Type:   config.REDIS,
+		Source: testRedisSource,
+		Options: map[config.DataSourceConnOption]string{
+			config.Namespace: rndNamespace,
+			config.DbNumber:  "0",
+		},
+		Credentials: &config.CredentialsConfig{
+			Username: testUser,
+			Password: testUserPassword,
+		},
+	}
+}
+
+// failingHook counts Redis commands (pipeline is counted as one command) and fails command with number failAt
+type failingHook struct {
+	mutex     sync.Mutex
+	processed int
+	failAt    int
+}
+
+var errInjectedFailure = errors.New("injected Redis failure")
+
+func (h *failingHook) reset(failAt int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.processed = 0
+	h.failAt = failAt
+}
+
+func (h *failingHook) fail() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.processed++
+	return h.processed == h.failAt
+}
+
+func (h *failingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *failingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if h.fail() {
+			return errInjectedFailure
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h *failingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if h.fail() {
+			return errInjectedFailure
+		}
+		return next(ctx, cmds)
+	}
+}
+
+// createTestRedisDataManagerWithFailingHook creates manager with empty namespace (or with realm from createTestRealmWithObjects
+// if withRealm is true) and hook that fails no commands until it is reset
+func createTestRedisDataManagerWithFailingHook(t *testing.T, withRealm bool) (*RedisDataManager, *failingHook) {
+	manager := createTestRedisDataManager(t)
+	t.Cleanup(func() {
+		_ = manager.redisClient.Close()
+	})
+	if withRealm {
+		require.NoError(t, manager.ImportRealm(context.Background(), createTestRealmWithObjects(t)))
+	}
+	hook := &failingHook{}
+	manager.redisClient.AddHook(hook)
+	return manager, hook
+}
+
+func createTestRealmWithObjects(t *testing.T) data.Realm {
+	return data.Realm{
+		Name:                   "atomic_app",
+		TokenExpiration:        3600,
+		RefreshTokenExpiration: 1800,
+		PasswordSalt:           "salt",
+		Clients:                []data.Client{createTestClient("client_1"), createTestClient("client_2")},
+		Users:                  []any{createTestRawUser(t, "user_1"), createTestRawUser(t, "user_2")},
+		UserFederationServices: []data.UserFederationServiceConfig{
+			{Name: "test_ldap", Type: data.LDAP, Url: "ldap://ldap.wissance.com:389"},
+		},
+	}
+}
+
+func createTestClient(clientName string) data.Client {
+	return data.Client{
+		Name: clientName,
+		Type: data.Confidential,
+		ID:   uuid.New(),
+		Auth: data.Authentication{Type: data.ClientIdAndSecrets, Value: uuid.New().String()},
+	}
+}
+
+func createTestRawUser(t *testing.T, userName string) any {
+	userJson := sf.Format(`{"info":{"sub":"{0}","preferred_username":"{1}"},"credentials":{"password":"hash"}}`, uuid.New().String(), userName)
+	var rawUser any
+	require.NoError(t, json.Unmarshal([]byte(userJson), &rawUser))
+	return rawUser
+}
+
+// getNamespaceData returns values of all keys of manager namespace (lists, sets and sorted sets items are joined)
+func getNamespaceData(t *testing.T, manager *RedisDataManager) map[string]string {
+	ctx := context.Background()
+	keys, err := manager.redisClient.Keys(ctx, manager.namespace+".*").Result()
+	require.NoError(t, err)
+	namespaceData := make(map[string]string, len(keys))
+	for _, key := range keys {
+		keyType, typeErr := manager.redisClient.Type(ctx, key).Result()
+		require.NoError(t, typeErr)
+		var items []string
+		switch keyType {
+		case "string":
+			value, getErr := manager.redisClient.Get(ctx, key).Result()
+			require.NoError(t, getErr)
+			items = []string{value}
+		case "list":
+			items, err = manager.redisClient.LRange(ctx, key, 0, -1).Result()
+			require.NoError(t, err)
+		case "set":
+			items, err = manager.redisClient.SMembers(ctx, key).Result()
+			require.NoError(t, err)
+			sort.Strings(items)
+		case "zset":
+			items, err = manager.redisClient.ZRange(ctx, key, 0, -1).Result()
+			require.NoError(t, err)
+		case "hash":
+			fields, getErr := manager.redisClient.HGetAll(ctx, key).Result()
+			require.NoError(t, getErr)
+			for field, value := range fields {
+				items = append(items, field+"="+value)
+			}
+			sort.Strings(items)
+		}
+		namespaceData[key] = strings.Join(items, "\n")
+	}
+	return namespaceData
+}
+
+// getNamespaceKeys returns sorted keys without namespace prefix
+func getNamespaceKeys(namespaceData map[string]string, namespace string) []string {
+	keys := make([]string, 0, len(namespaceData))
+	for key := range namespaceData {
+		keys = append(keys, strings.TrimPrefix(key, namespace))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func checkRealm(t *testing.T, expected *data.Realm, actual *data.Realm) {
 	assert.Equal(t, expected.Name, actual.Name)
 	assert.Equal(t, expected.TokenExpiration, actual.TokenExpiration)
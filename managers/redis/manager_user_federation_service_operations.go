@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 
@@ -18,13 +19,15 @@ import (
  *     - configName - name of a User Federation Service config
  * Returns: config and error
  */
-func (mn *RedisDataManager) GetUserFederationConfig(realmName string, configName string) (*data.UserFederationServiceConfig, error) {
+func (mn *RedisDataManager) GetUserFederationConfig(ctx context.Context, realmName string, configName string) (*data.UserFederationServiceConfig, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
 	if !mn.IsAvailable() {
-		return nil, appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
+		return nil, appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
 
 	realmUserFederationServiceConfigKey := sf.Format(realmUserFederationServiceTemplate, mn.namespace, realmName)
-	realmUserFederationConfig, err := getObjectsListOfNonSlicesItemsFromRedis[data.UserFederationServiceConfig](mn.redisClient, mn.ctx, mn.logger, RealmUserFederationConfig,
+	realmUserFederationConfig, err := getObjectsListOfNonSlicesItemsFromRedis[data.UserFederationServiceConfig](mn.redisClient, mn.getRedisAddress(), mn.ctx, mn.logger, RealmUserFederationConfig,
 		realmUserFederationServiceConfigKey)
 	if err != nil {
 		if errors.Is(err, appErrs.ErrZeroLength) {
@@ -40,13 +43,15 @@ func (mn *RedisDataManager) GetUserFederationConfig(realmName string, configName
 	return nil, appErrs.NewObjectNotFoundError(realmUserFederationServiceTemplate, configName, sf.Format("realm: {0}", realmName))
 }
 
-func (mn *RedisDataManager) GetUserFederationConfigs(realmName string) ([]data.UserFederationServiceConfig, error) {
+func (mn *RedisDataManager) GetUserFederationConfigs(ctx context.Context, realmName string) ([]data.UserFederationServiceConfig, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
 	if !mn.IsAvailable() {
-		return []data.UserFederationServiceConfig{}, appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
+		return []data.UserFederationServiceConfig{}, appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
 
 	realmUserFederationServiceConfigKey := sf.Format(realmUserFederationServiceTemplate, mn.namespace, realmName)
-	realmUserFederationConfig, err := getObjectsListOfNonSlicesItemsFromRedis[data.UserFederationServiceConfig](mn.redisClient, mn.ctx, mn.logger,
+	realmUserFederationConfig, err := getObjectsListOfNonSlicesItemsFromRedis[data.UserFederationServiceConfig](mn.redisClient, mn.getRedisAddress(), mn.ctx, mn.logger,
 		RealmUserFederationConfig, realmUserFederationServiceConfigKey)
 	return realmUserFederationConfig, err
 }
@@ -59,16 +64,18 @@ func (mn *RedisDataManager) GetUserFederationConfigs(realmName string) ([]data.U
  *     - userFederationConfig - newly creating object data.UserFederationServiceConfig
  * Returns: error
  */
-func (mn *RedisDataManager) CreateUserFederationConfig(realmName string, userFederationConfig data.UserFederationServiceConfig) error {
+func (mn *RedisDataManager) CreateUserFederationConfig(ctx context.Context, realmName string, userFederationConfig data.UserFederationServiceConfig) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
 	if !mn.IsAvailable() {
-		return appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
+		return appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
 	_, err := mn.getRealmObject(realmName)
 	if err != nil {
 		return err
 	}
 	// TODO(UMV): use function isExists
-	cfg, err := mn.GetUserFederationConfig(realmName, userFederationConfig.Name)
+	cfg, err := mn.GetUserFederationConfig(mn.ctx, realmName, userFederationConfig.Name)
 	if cfg != nil {
 		return appErrs.NewObjectExistsError(string(RealmUserFederationConfig), userFederationConfig.Name, sf.Format("realm: {0}", realmName))
 	}
@@ -90,24 +97,35 @@ func (mn *RedisDataManager) CreateUserFederationConfig(realmName string, userFed
 }
 
 // UpdateUserFederationConfig - updating an existing data.UserFederationServiceConfig
-/*  Just upsert object
+/*  Just upsert object, config could be renamed but not to a name of other realm config
  * Arguments:
  *    - realmName - name of a data.Realm
  *    - configName - name of a data.UserFederationServiceConfig
  *    - userFederationConfig - new User Federation Service Config body
  * Returns: error
  */
-func (mn *RedisDataManager) UpdateUserFederationConfig(realmName string, configName string, userFederationConfig data.UserFederationServiceConfig) error {
+func (mn *RedisDataManager) UpdateUserFederationConfig(ctx context.Context, realmName string, configName string, userFederationConfig data.UserFederationServiceConfig) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
 	if !mn.IsAvailable() {
-		return appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
+		return appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
-	_, err := mn.GetUserFederationConfig(realmName, configName)
+	_, err := mn.GetUserFederationConfig(mn.ctx, realmName, configName)
 	if err != nil {
 		if errors.As(err, &appErrs.EmptyNotFoundErr) {
 			return err
 		}
 		return appErrs.NewUnknownError("GetUserFederationConfig", "RedisDataManager.UpdateUserFederationConfig", err)
 	}
+	if userFederationConfig.Name != configName {
+		cfg, getErr := mn.GetUserFederationConfig(mn.ctx, realmName, userFederationConfig.Name)
+		if cfg != nil {
+			return appErrs.NewObjectExistsError(string(RealmUserFederationConfig), userFederationConfig.Name, sf.Format("realm: {0}", realmName))
+		}
+		if !errors.As(getErr, &appErrs.ObjectNotFoundError{}) {
+			return getErr
+		}
+	}
 
 	configBytes, err := json.Marshal(userFederationConfig)
 	if err != nil {
@@ -115,7 +133,7 @@ func (mn *RedisDataManager) UpdateUserFederationConfig(realmName string, configN
 		return appErrs.NewUnknownError("json.Marshal", "RedisDataManager.UpdateUserFederationConfig", err)
 	}
 
-	err = mn.updateUserFederationConfigObject(realmName, userFederationConfig.Name, string(configBytes))
+	err = mn.updateUserFederationConfigObject(realmName, configName, string(configBytes))
 	if err != nil {
 		return appErrs.NewUnknownError("updateUserFederationConfigObject", "RedisDataManager.UpdateUserFederationConfig", err)
 	}
@@ -130,12 +148,14 @@ func (mn *RedisDataManager) UpdateUserFederationConfig(realmName string, configN
  *    - configName - name of a data.UserFederationServiceConfig
  * Returns: error
  */
-func (mn *RedisDataManager) DeleteUserFederationConfig(realmName string, configName string) error {
+func (mn *RedisDataManager) DeleteUserFederationConfig(ctx context.Context, realmName string, configName string) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
 	if !mn.IsAvailable() {
-		return appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
+		return appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
 
-	cfg, err := mn.GetUserFederationConfig(realmName, configName)
+	cfg, err := mn.GetUserFederationConfig(mn.ctx, realmName, configName)
 	if err != nil {
 		if errors.As(err, &appErrs.EmptyNotFoundErr) {
 			return err
@@ -164,7 +184,7 @@ func (mn *RedisDataManager) DeleteUserFederationConfig(realmName string, configN
  */
 func (mn *RedisDataManager) createUserFederationConfigObject(realmName string, userFederationJson string) error {
 	realmConfigsKey := sf.Format(realmUserFederationServiceTemplate, mn.namespace, realmName)
-	_, err := getObjectsListOfNonSlicesItemsFromRedis[data.UserFederationServiceConfig](mn.redisClient, mn.ctx, mn.logger, RealmUserFederationConfig, realmConfigsKey)
+	_, err := getObjectsListOfNonSlicesItemsFromRedis[data.UserFederationServiceConfig](mn.redisClient, mn.getRedisAddress(), mn.ctx, mn.logger, RealmUserFederationConfig, realmConfigsKey)
 	if err != nil {
 		if errors.Is(err, appErrs.ErrZeroLength) {
 		} else {
@@ -188,7 +208,7 @@ func (mn *RedisDataManager) createUserFederationConfigObject(realmName string, u
  */
 func (mn *RedisDataManager) updateUserFederationConfigObject(realmName string, userFederationName string, userFederationJson string /**data.UserFederationServiceConfig*/) error {
 	realmConfigsKey := sf.Format(realmUserFederationServiceTemplate, mn.namespace, realmName)
-	configs, err := getObjectsListOfNonSlicesItemsFromRedis[data.UserFederationServiceConfig](mn.redisClient, mn.ctx, mn.logger, RealmUserFederationConfig, realmConfigsKey)
+	configs, err := getObjectsListOfNonSlicesItemsFromRedis[data.UserFederationServiceConfig](mn.redisClient, mn.getRedisAddress(), mn.ctx, mn.logger, RealmUserFederationConfig, realmConfigsKey)
 	if err != nil {
 		if errors.Is(err, appErrs.ErrZeroLength) {
 		} else {
@@ -198,7 +218,7 @@ func (mn *RedisDataManager) updateUserFederationConfigObject(realmName string, u
 
 	for k, v := range configs {
 		if v.Name == userFederationName {
-			return updateObjectListItemInRedis[string](mn.redisClient, mn.ctx, mn.logger, RealmUserFederationConfig,
+			return updateObjectListItemInRedis[string](mn.redisClient, mn.getRedisAddress(), mn.ctx, mn.logger, RealmUserFederationConfig,
 				realmConfigsKey, int64(k), userFederationJson)
 		}
 	}
@@ -223,3 +243,19 @@ func (mn *RedisDataManager) deleteUserFederationConfigObject(realmName string, v
 	}
 	return nil
 }
+
+// deleteUserFederationConfigsObject - deleting all data.UserFederationServiceConfig of a realm
+/* Inside uses realmUserFederationService, absence of configs is not an error
+ * Arguments:
+ *    - realmName - name of data.Realm
+ * Returns: error
+ */
+func (mn *RedisDataManager) deleteUserFederationConfigsObject(realmName string) error {
+	configsKey := sf.Format(realmUserFederationServiceTemplate, mn.namespace, realmName)
+	if err := mn.deleteRedisObject(RealmUserFederationConfig, configsKey); err != nil {
+		if !errors.As(err, &appErrs.EmptyNotFoundErr) {
+			return appErrs.NewUnknownError("deleteRedisObject", "RedisDataManager.deleteUserFederationConfigsObject", err)
+		}
+	}
+	return nil
+}
@@ -1,10 +1,12 @@
 package redis
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
+	"strings"
 
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 	"github.com/wissance/Ferrum/config"
 	"github.com/wissance/Ferrum/data"
 	errors2 "github.com/wissance/Ferrum/errors"
@@ -15,15 +17,17 @@ import (
 /* This function select all realm users (used by getRealmUsers) by constructing redis key from namespace and realm name
  * Probably in future this function could consume a lot of memory (if we would have a lot of users in a realm) probably we should limit amount of Users to fetch
  * This function works in two steps:
- *     1. Get all data.ExtendedIdentifier pairs id-name
+ *     1. Get all realm usernames (users are ordered by username)
  *     2. Get all User objects at once by key slices (every redis key for user combines from namespace, realm, username)
  * Parameters:
  *    - realmName - name of the realm
  * Returns slice of Users and error
  */
-func (mn *RedisDataManager) GetUsers(realmName string) ([]data.User, error) {
+func (mn *RedisDataManager) GetUsers(ctx context.Context, realmName string) ([]data.User, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
 	if !mn.IsAvailable() {
-		return []data.User{}, errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
+		return []data.User{}, errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
 	// TODO(UMV): possibly we should not use this method ??? what if we have 1M+ users .... ? think maybe it should be somehow optimized ...
 	realmUsers, err := mn.getRealmUsers(realmName)
@@ -36,17 +40,14 @@ func (mn *RedisDataManager) GetUsers(realmName string) ([]data.User, error) {
 
 	// todo(UMV): probably we should organize batching here if we have many users i.e. 100K+
 	userRedisKeys := make([]string, len(realmUsers))
-	for i, ru := range realmUsers {
-		userRedisKeys[i] = sf.Format(userKeyTemplate, mn.namespace, realmName, ru.Name)
+	for i, userName := range realmUsers {
+		userRedisKeys[i] = sf.Format(userKeyTemplate, mn.namespace, realmName, userName)
 	}
 
-	// userFullDataRealmsKey := sf.Format(realmUsersFullDataKeyTemplate, mn.namespace, realmName)
-	// this is wrong, we can't get rawUsers such way ...
-	realmUsersData, err := getMultipleRedisObjects[interface{}](mn.redisClient, mn.ctx, mn.logger, RealmUsers, userRedisKeys)
+	realmUsersData, err := getMultipleRedisObjects[interface{}](mn.redisClient, mn.getRedisAddress(), mn.ctx, mn.logger, RealmUsers, userRedisKeys)
 	if err != nil {
 		return nil, errors2.NewUnknownError("getMultipleRedisObjects", "RedisDataManager.GetUsers", err)
 	}
-	// getObjectsListFromRedis[interface{}](mn.redisClient, mn.ctx, mn.logger, RealmUsers, userFullDataRealmsKey)
 	if len(realmUsersData) == 0 {
 		mn.logger.Error(sf.Format("Redis does not have all users that belong to Realm: \"{0}\"", realmName))
 		return nil, err
@@ -63,6 +64,78 @@ func (mn *RedisDataManager) GetUsers(realmName string) ([]data.User, error) {
 	return userData, nil
 }
 
+// ListUsers function for getting page of realm users ordered by username
+/* Parameters:
+ *    - realmName - name of the realm
+ *    - page - requested page
+ * Returns: page of users (empty page if realm doesn't have users) and error
+ */
+func (mn *RedisDataManager) ListUsers(ctx context.Context, realmName string, page data.PageRequest) (*data.UsersPage, error) {
+	return mn.SearchUsers(ctx, realmName, data.UsersFilter{}, page)
+}
+
+// SearchUsers function for getting page of realm users that match filter ordered by username
+/* Realm usernames are stored in a SORTED SET (realmUserNamesKeyTemplate), therefore:
+ *     1. If filter has no other criteria only usernames and users of requested page are read (ZRANGE BYLEX with LIMIT), total is
+ *        counted by ZLEXCOUNT
+ *     2. Otherwise, all usernames with filter prefix are read, users are read by batches of usersSearchBatchSize users and filtered,
+ *        therefore search over users data reads all users with filter prefix, but doesn't hold all of them in memory
+ * Parameters:
+ *    - realmName - name of the realm
+ *    - filter - search criteria
+ *    - page - requested page
+ * Returns: page of users (empty page if realm doesn't have users) and error
+ */
+func (mn *RedisDataManager) SearchUsers(ctx context.Context, realmName string, filter data.UsersFilter, page data.PageRequest) (*data.UsersPage, error) {
+	if err := page.Validate(); err != nil {
+		return nil, err
+	}
+	matcher, err := filter.GetMatcher()
+	if err != nil {
+		return nil, err
+	}
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	if !mn.IsAvailable() {
+		return nil, errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
+	}
+	result := &data.UsersPage{Users: []data.User{}, Offset: page.Offset, Limit: page.GetLimit()}
+	isUsernameOnly := filter.IsUsernameOnly()
+	var userNames []string
+	if isUsernameOnly {
+		if result.Total, err = mn.countRealmUsersByPrefix(realmName, filter.UsernamePrefix); err != nil {
+			return nil, errors2.NewUnknownError("countRealmUsersByPrefix", "RedisDataManager.SearchUsers", err)
+		}
+		userNames, err = mn.getRealmUsersByPrefix(realmName, filter.UsernamePrefix, page.Offset, result.Limit)
+	} else {
+		userNames, err = mn.getRealmUsersByPrefix(realmName, filter.UsernamePrefix, 0, -1)
+	}
+	if err != nil {
+		return nil, errors2.NewUnknownError("getRealmUsersByPrefix", "RedisDataManager.SearchUsers", err)
+	}
+
+	for start := 0; start < len(userNames); start += usersSearchBatchSize {
+		users, getErr := mn.getUsersByNames(realmName, userNames[start:min(start+usersSearchBatchSize, len(userNames))])
+		if getErr != nil {
+			return nil, errors2.NewUnknownError("getUsersByNames", "RedisDataManager.SearchUsers", getErr)
+		}
+		for _, user := range users {
+			if isUsernameOnly {
+				result.Users = append(result.Users, user)
+				continue
+			}
+			if !matcher(user) {
+				continue
+			}
+			if result.Total >= page.Offset && len(result.Users) < result.Limit {
+				result.Users = append(result.Users, user)
+			}
+			result.Total++
+		}
+	}
+	return result, nil
+}
+
 // GetUser function for getting realm user by username
 /* This function constructs Redis key by pattern combines namespace, realm name and username (userKeyTemplate)
  * Parameters:
@@ -70,13 +143,15 @@ func (mn *RedisDataManager) GetUsers(realmName string) ([]data.User, error) {
  *    - userName
  * Returns: User and error
  */
-func (mn *RedisDataManager) GetUser(realmName string, userName string) (data.User, error) {
+func (mn *RedisDataManager) GetUser(ctx context.Context, realmName string, userName string) (data.User, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
 	if !mn.IsAvailable() {
 		// todo(UMV): is this Valid or NOT ????
-		return data.User(nil), errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
+		return data.User(nil), errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
 	userKey := sf.Format(userKeyTemplate, mn.namespace, realmName, userName)
-	rawUser, err := getSingleRedisObject[interface{}](mn.redisClient, mn.ctx, mn.logger, User, userKey)
+	rawUser, err := getSingleRedisObject[interface{}](mn.redisClient, mn.getRedisAddress(), mn.ctx, mn.logger, User, userKey)
 	if err != nil {
 		if errors.As(err, &errors2.EmptyNotFoundErr) {
 			return nil, err
@@ -88,25 +163,27 @@ func (mn *RedisDataManager) GetUser(realmName string, userName string) (data.Use
 }
 
 // GetUserById function for getting realm user by userId
-/* This function is more complex than GetUser, because we are using combination of realm name and username to store user data,
- * therefore this function extracts all realm users data and find appropriate by relation id-name after that it behaves like GetUser function
+/* We are using combination of realm name and username to store user data, therefore this function gets username from users ids index
+ * (realmUserIdsKeyTemplate) after that it behaves like GetUser function
  * Parameters:
  *    - realmName
  *    - userId - identifier of searching user
  * Returns: User and error
  */
-func (mn *RedisDataManager) GetUserById(realmName string, userId uuid.UUID) (data.User, error) {
+func (mn *RedisDataManager) GetUserById(ctx context.Context, realmName string, userId uuid.UUID) (data.User, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
 	if !mn.IsAvailable() {
-		return data.User(nil), errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
+		return data.User(nil), errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
-	realmUser, err := mn.getRealmUserById(realmName, userId)
+	userName, err := mn.getRealmUserNameById(realmName, userId)
 	if err != nil {
 		if errors.As(err, &errors2.EmptyNotFoundErr) {
 			return nil, err
 		}
-		return nil, errors2.NewUnknownError("getRealmUserById", "RedisDataManager.GetUserById", err)
+		return nil, errors2.NewUnknownError("getRealmUserNameById", "RedisDataManager.GetUserById", err)
 	}
-	user, err := mn.GetUser(realmName, realmUser.Name)
+	user, err := mn.GetUser(mn.ctx, realmName, userName)
 	if err != nil {
 		if errors.As(err, &errors2.EmptyNotFoundErr) {
 			mn.logger.Error(sf.Format("Realm: \"{0}\" has user: \"{1}\", that Redis does not have", realmName, userId))
@@ -116,225 +193,346 @@ func (mn *RedisDataManager) GetUserById(realmName string, userId uuid.UUID) (dat
 	return user, nil
 }
 
+// GetUserByEmail function for getting realm user by email
+/* This function gets username from users emails index (realmUserEmailsKeyTemplate) after that it behaves like GetUser function,
+ * emails are case-insensitive. If several users have same email, the user that was saved last is returned
+ * Parameters:
+ *    - realmName
+ *    - email - email of searching user
+ * Returns: User and error
+ */
+func (mn *RedisDataManager) GetUserByEmail(ctx context.Context, realmName string, email string) (data.User, error) {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	if !mn.IsAvailable() {
+		return data.User(nil), errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
+	}
+	emailsKey := sf.Format(realmUserEmailsKeyTemplate, mn.namespace, realmName)
+	userName, err := mn.getRedisHashField(RealmUserEmails, emailsKey, strings.ToLower(email))
+	if err != nil {
+		if errors.As(err, &errors2.EmptyNotFoundErr) {
+			return nil, errors2.NewObjectNotFoundError(string(User), email, sf.Format("realm: {0}", realmName))
+		}
+		return nil, errors2.NewUnknownError("getRedisHashField", "RedisDataManager.GetUserByEmail", err)
+	}
+	return mn.GetUser(mn.ctx, realmName, userName)
+}
+
 // CreateUser - new user creation
-/* Returns an error if the user exists in redis
+/* Returns an error if the user (or user with same id) exists in redis. User (with version 1), realm users relation and users indexes
+ * are saved in one transaction
  * Arguments:
  *    - realmName
  *    - userNew
  * Returns: error
  */
-func (mn *RedisDataManager) CreateUser(realmName string, userNew data.User) error {
+func (mn *RedisDataManager) CreateUser(ctx context.Context, realmName string, userNew data.User) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
 	if !mn.IsAvailable() {
-		return errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
-	}
-	// TODO(SIA) Add transaction
-	// TODO(SIA) use function isExists
-	_, err := mn.GetRealm(realmName)
-	if err != nil {
-		mn.logger.Warn(sf.Format("CreateUser: GetRealmObject failed, error: {0}", err.Error()))
-		return err
+		return errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
 	userName := userNew.GetUsername()
-	// TODO(SIA) use function isExists
-	_, err = mn.GetUser(realmName, userName)
-	if err == nil {
-		return errors2.NewObjectExistsError(string(User), userName, sf.Format("realm: {0}", realmName))
-	}
-	if !errors.As(err, &errors2.EmptyNotFoundErr) {
-		mn.logger.Warn(sf.Format("CreateUser: GetUser failed, error: {0}", err.Error()))
-		return err
-	}
-	upsertUserErr := mn.upsertUserObject(realmName, userName, userNew.GetJsonString())
-	if upsertUserErr != nil {
-		mn.logger.Error(sf.Format("CreateUser: addUserToRealm failed, error: {0}", upsertUserErr.Error()))
-		return upsertUserErr
-	}
-
-	if addUserRealmErr := mn.addUserToRealm(realmName, userNew); addUserRealmErr != nil {
-		mn.logger.Error(sf.Format("CreateUser: addUserToRealm failed, error: {0}", addUserRealmErr.Error()))
-		return addUserRealmErr
-	}
+	userNew = data.CreateUserWithVersion(userNew, 1)
+	return mn.transaction("RedisDataManager.CreateUser", func(mn *RedisDataManager) error {
+		// TODO(SIA) use function isExists
+		_, err := mn.GetRealm(mn.ctx, realmName)
+		if err != nil {
+			mn.logger.Warn(sf.Format("CreateUser: GetRealmObject failed, error: {0}", err.Error()))
+			return err
+		}
+		// TODO(SIA) use function isExists
+		_, err = mn.GetUser(mn.ctx, realmName, userName)
+		if err == nil {
+			return errors2.NewObjectExistsError(string(User), userName, sf.Format("realm: {0}", realmName))
+		}
+		if !errors.As(err, &errors2.EmptyNotFoundErr) {
+			mn.logger.Warn(sf.Format("CreateUser: GetUser failed, error: {0}", err.Error()))
+			return err
+		}
+		if userId := userNew.GetId(); userId != uuid.Nil {
+			_, err = mn.getRealmUserNameById(realmName, userId)
+			if err == nil {
+				return errors2.NewObjectExistsError(string(User), userId.String(), sf.Format("realm: {0}", realmName))
+			}
+			if !errors.As(err, &errors2.EmptyNotFoundErr) {
+				return err
+			}
+		}
+		upsertUserErr := mn.upsertUserObject(realmName, userName, userNew.GetJsonString())
+		if upsertUserErr != nil {
+			mn.logger.Error(sf.Format("CreateUser: addUserToRealm failed, error: {0}", upsertUserErr.Error()))
+			return upsertUserErr
+		}
 
-	return nil
+		if addUserRealmErr := mn.addUserToRealm(realmName, userNew); addUserRealmErr != nil {
+			mn.logger.Error(sf.Format("CreateUser: addUserToRealm failed, error: {0}", addUserRealmErr.Error()))
+			return addUserRealmErr
+		}
+		return nil
+	}, append(mn.getRealmUsersKeys(realmName), sf.Format(realmKeyTemplate, mn.namespace, realmName),
+		sf.Format(userKeyTemplate, mn.namespace, realmName, userName))...)
 }
 
 // DeleteUser - deleting an existing user
-/* It also deletes the user from realmUsers
+/* It also deletes the user from realm users and users indexes in the same transaction
  * Arguments:
  *    - realmName
  *    - userName
  * Returns: error
  */
-func (mn *RedisDataManager) DeleteUser(realmName string, userName string) error {
+func (mn *RedisDataManager) DeleteUser(ctx context.Context, realmName string, userName string) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
 	if !mn.IsAvailable() {
-		return errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
+		return errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
-	if err := mn.deleteUserObject(realmName, userName); err != nil {
-		if errors.As(err, &errors2.EmptyNotFoundErr) {
-			return err
+	return mn.transaction("RedisDataManager.DeleteUser", func(mn *RedisDataManager) error {
+		user, err := mn.GetUser(mn.ctx, realmName, userName)
+		if err != nil {
+			if errors.As(err, &errors2.EmptyNotFoundErr) {
+				return err
+			}
+			return errors2.NewUnknownError("GetUser", "RedisDataManager.DeleteUser", err)
 		}
-		return errors2.NewUnknownError("deleteUserObject", "RedisDataManager.DeleteUser", err)
-	}
-	if err := mn.deleteUserFromRealm(realmName, userName); err != nil {
-		// todo(UMV): second errors.Is because ErrZeroLength doesn't have custom type
-		if errors.As(err, &errors2.EmptyNotFoundErr) || errors.Is(err, errors2.ErrZeroLength) {
-			return nil
+		if err = mn.deleteUserObject(realmName, userName); err != nil {
+			if errors.As(err, &errors2.EmptyNotFoundErr) {
+				return err
+			}
+			return errors2.NewUnknownError("deleteUserObject", "RedisDataManager.DeleteUser", err)
 		}
-		return errors2.NewUnknownError("deleteUserFromRealm", "RedisDataManager.DeleteUser", err)
-	}
-	return nil
+		if err = mn.deleteUserFromRealm(realmName, user); err != nil {
+			return errors2.NewUnknownError("deleteUserFromRealm", "RedisDataManager.DeleteUser", err)
+		}
+		return nil
+	}, append(mn.getRealmUsersKeys(realmName), sf.Format(userKeyTemplate, mn.namespace, realmName, userName))...)
 }
 
 // UpdateUser - upgrading an existing user
-/*
+/* User is changed in one transaction (if username was changed old user is deleted and new one is created), users indexes are
+ * updated if user id or email was changed
  * Arguments:
  *    - realmName
  *    - userName
- *    - userNew
- * Returns: error
+ *    - userNew - userNew version is an expected version of stored user (see data.CheckVersion)
+ * Returns: error (errors2.ObjectVersionConflictError if stored user has other version)
  */
-func (mn *RedisDataManager) UpdateUser(realmName string, userName string, userNew data.User) error {
+func (mn *RedisDataManager) UpdateUser(ctx context.Context, realmName string, userName string, userNew data.User) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
 	if !mn.IsAvailable() {
-		return errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.redisOption.Addr)
+		return errors2.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
 	}
-	// TODO(SIA) Add transaction
-	oldUser, err := mn.GetUser(realmName, userName)
-	if err != nil {
-		if errors.As(err, &errors2.EmptyNotFoundErr) {
-			return err
-		}
-		return errors2.NewUnknownError("GetUser", "RedisDataManager.UpdateUser", err)
-	}
-	oldUserName := oldUser.GetUsername()
-	oldUserId := oldUser.GetId()
-
 	newUserName := userNew.GetUsername()
-	newUserId := userNew.GetId()
-
-	if newUserId != oldUserId || newUserName != oldUserName {
-		if delUserErr := mn.DeleteUser(realmName, oldUserName); delUserErr != nil {
-			return errors2.NewUnknownError("DeleteUser", "RedisDataManager.UpdateUser", delUserErr)
+	return mn.transaction("RedisDataManager.UpdateUser", func(mn *RedisDataManager) error {
+		oldUser, err := mn.GetUser(mn.ctx, realmName, userName)
+		if err != nil {
+			if errors.As(err, &errors2.EmptyNotFoundErr) {
+				return err
+			}
+			return errors2.NewUnknownError("GetUser", "RedisDataManager.UpdateUser", err)
 		}
-		if addUserRealmErr := mn.addUserToRealm(realmName, userNew); addUserRealmErr != nil {
-			return errors2.NewUnknownError("addUserToRealm", "RedisDataManager.UpdateUser", addUserRealmErr)
+		if err = data.CheckVersion(string(User), userName, oldUser.GetVersion(), userNew.GetVersion()); err != nil {
+			return err
 		}
-	}
+		userNew := data.CreateUserWithVersion(userNew, oldUser.GetVersion()+1)
+		oldUserName := oldUser.GetUsername()
+		oldUserId := oldUser.GetId()
+		newUserId := userNew.GetId()
 
-	err = mn.upsertUserObject(realmName, newUserName, userNew.GetJsonString())
-	if err != nil {
-		return errors2.NewUnknownError("upsertUserObject", "RedisDataManager.UpdateUser", err)
-	}
+		if newUserId != oldUserId || newUserName != oldUserName {
+			if newUserName != oldUserName {
+				_, err = mn.GetUser(mn.ctx, realmName, newUserName)
+				if err == nil {
+					return errors2.NewObjectExistsError(string(User), newUserName, sf.Format("realm: {0}", realmName))
+				}
+				if !errors.As(err, &errors2.EmptyNotFoundErr) {
+					return errors2.NewUnknownError("GetUser", "RedisDataManager.UpdateUser", err)
+				}
+			}
+			if delUserErr := mn.DeleteUser(mn.ctx, realmName, oldUserName); delUserErr != nil {
+				return errors2.NewUnknownError("DeleteUser", "RedisDataManager.UpdateUser", delUserErr)
+			}
+			if newUserId != oldUserId && newUserId != uuid.Nil {
+				_, err = mn.getRealmUserNameById(realmName, newUserId)
+				if err == nil {
+					return errors2.NewObjectExistsError(string(User), newUserId.String(), sf.Format("realm: {0}", realmName))
+				}
+				if !errors.As(err, &errors2.EmptyNotFoundErr) {
+					return errors2.NewUnknownError("getRealmUserNameById", "RedisDataManager.UpdateUser", err)
+				}
+			}
+			if addUserRealmErr := mn.addUserToRealm(realmName, userNew); addUserRealmErr != nil {
+				return errors2.NewUnknownError("addUserToRealm", "RedisDataManager.UpdateUser", addUserRealmErr)
+			}
+		} else if !strings.EqualFold(oldUser.GetEmail(), userNew.GetEmail()) {
+			if delUserRealmErr := mn.deleteUserFromRealm(realmName, oldUser); delUserRealmErr != nil {
+				return errors2.NewUnknownError("deleteUserFromRealm", "RedisDataManager.UpdateUser", delUserRealmErr)
+			}
+			if addUserRealmErr := mn.addUserToRealm(realmName, userNew); addUserRealmErr != nil {
+				return errors2.NewUnknownError("addUserToRealm", "RedisDataManager.UpdateUser", addUserRealmErr)
+			}
+		}
 
-	return nil
+		err = mn.upsertUserObject(realmName, newUserName, userNew.GetJsonString())
+		if err != nil {
+			return errors2.NewUnknownError("upsertUserObject", "RedisDataManager.UpdateUser", err)
+		}
+		return nil
+	}, append(mn.getRealmUsersKeys(realmName), sf.Format(userKeyTemplate, mn.namespace, realmName, userName),
+		sf.Format(userKeyTemplate, mn.namespace, realmName, newUserName))...)
 }
 
 // SetPassword - setting a password for user
-/*
+/* User is read and saved with incremented version in one transaction
  * Arguments:
  *    - realmName
  *    - userName
  *    - password - string
  * Returns: error
  */
-func (mn *RedisDataManager) SetPassword(realmName string, userName string, password string) error {
-	user, err := mn.GetUser(realmName, userName)
-	if err != nil {
-		return errors2.NewUnknownError("GetUser", "RedisDataManager.SetPassword", err)
-	}
-	realm, err := mn.GetRealm(realmName)
+func (mn *RedisDataManager) SetPassword(ctx context.Context, realmName string, userName string, password string) error {
+	mn, cancel := mn.withOperationContext(ctx)
+	defer cancel()
+	return mn.transaction("RedisDataManager.SetPassword", func(mn *RedisDataManager) error {
+		user, err := mn.GetUser(mn.ctx, realmName, userName)
+		if err != nil {
+			return errors2.NewUnknownError("GetUser", "RedisDataManager.SetPassword", err)
+		}
+		realm, err := mn.GetRealm(mn.ctx, realmName)
+		if err != nil {
+			return errors2.NewUnknownError("GetRealm", "RedisDataManager.SetPassword", err)
+		}
+		if setPasswordErr := user.SetPassword(password, realm.Encoder); setPasswordErr != nil {
+			return errors2.NewUnknownError("SetPassword", "RedisDataManager.SetPassword", setPasswordErr)
+		}
+		user.SetVersion(user.GetVersion() + 1)
+		if upsertUserErr := mn.upsertUserObject(realmName, userName, user.GetJsonString()); upsertUserErr != nil {
+			return errors2.NewUnknownError("upsertUserObject", "RedisDataManager.SetPassword", upsertUserErr)
+		}
+		return nil
+	}, sf.Format(userKeyTemplate, mn.namespace, realmName, userName))
+}
+
+// getRealmUsers - get usernames of realm users.
+/* realmUserNamesKeyTemplate is used inside.
+ * Arguments:
+ *    - realmName
+ * Returns: sorted slice of usernames, error (errors2.ErrZeroLength if realm doesn't have users)
+ */
+func (mn *RedisDataManager) getRealmUsers(realmName string) ([]string, error) {
+	userNames, err := mn.getRealmUsersByPrefix(realmName, "", 0, -1)
 	if err != nil {
-		return errors2.NewUnknownError("GetRealm", "RedisDataManager.SetPassword", err)
-	}
-	if setPasswordErr := user.SetPassword(password, realm.Encoder); setPasswordErr != nil {
-		return errors2.NewUnknownError("SetPassword", "RedisDataManager.SetPassword", setPasswordErr)
+		return nil, err
 	}
-	if upsertUserErr := mn.upsertUserObject(realmName, userName, user.GetJsonString()); upsertUserErr != nil {
-		return errors2.NewUnknownError("upsertUserObject", "RedisDataManager.SetPassword", upsertUserErr)
+	if len(userNames) == 0 {
+		return nil, errors2.ErrZeroLength
 	}
-	return nil
+	return userNames, nil
 }
 
-// getRealmUsers - get realmUsers entity.
-/* realmUsersKeyTemplate is used inside.
- * Arguments:
+// getRealmUsersByPrefix - get sorted usernames of realm users that start with prefix (ZRANGE BYLEX)
+/* Arguments:
  *    - realmName
- * Returns: slice of ExtendedIdentifier, error
+ *    - prefix - username prefix, empty prefix means all usernames
+ *    - offset - number of skipped usernames
+ *    - count - max number of usernames, -1 means all usernames after offset
+ * Returns: sorted slice of usernames (empty if there are no usernames with prefix), error
  */
-func (mn *RedisDataManager) getRealmUsers(realmName string) ([]data.ExtendedIdentifier, error) {
-	userRealmsKey := sf.Format(realmUsersKeyTemplate, mn.namespace, realmName)
-	realmUsers, err := getObjectsListOfSlicesItemsFromRedis[data.ExtendedIdentifier](mn.redisClient, mn.ctx, mn.logger, RealmUsers, userRealmsKey)
-	if err != nil {
-		if errors.Is(err, errors2.ErrZeroLength) {
-			return nil, err
-		}
+func (mn *RedisDataManager) getRealmUsersByPrefix(realmName string, prefix string, offset int, count int) ([]string, error) {
+	realmUsersKey := sf.Format(realmUserNamesKeyTemplate, mn.namespace, realmName)
+	minName, maxName := getUsernamePrefixRange(prefix)
+	redisCmd := mn.redisClient.ZRangeByLex(mn.ctx, realmUsersKey, &redis.ZRangeBy{
+		Min: minName, Max: maxName, Offset: int64(offset), Count: int64(count),
+	})
+	if redisCmd.Err() != nil {
+		mn.logger.Warn(sf.Format("An error occurred during fetching {0}: \"{1}\" from Redis server", RealmUsers, realmUsersKey))
+		return nil, errors2.NewUnknownError("ZRangeByLex", "RedisDataManager.getRealmUsersByPrefix",
+			GetRedisError(mn.ctx, mn.getRedisAddress(), redisCmd.Err()))
+	}
+	return redisCmd.Val(), nil
+}
 
-		return nil, errors2.NewUnknownError("getObjectsListOfSlicesItemsFromRedis", "RedisDataManager.getRealmUsers", err)
+// countRealmUsersByPrefix - get number of realm users whose usernames start with prefix (ZLEXCOUNT)
+/* Arguments:
+ *    - realmName
+ *    - prefix - username prefix, empty prefix means all usernames
+ * Returns: number of users, error
+ */
+func (mn *RedisDataManager) countRealmUsersByPrefix(realmName string, prefix string) (int, error) {
+	realmUsersKey := sf.Format(realmUserNamesKeyTemplate, mn.namespace, realmName)
+	minName, maxName := getUsernamePrefixRange(prefix)
+	redisCmd := mn.redisClient.ZLexCount(mn.ctx, realmUsersKey, minName, maxName)
+	if redisCmd.Err() != nil {
+		mn.logger.Warn(sf.Format("An error occurred during counting {0}: \"{1}\" in Redis server", RealmUsers, realmUsersKey))
+		return 0, errors2.NewUnknownError("ZLexCount", "RedisDataManager.countRealmUsersByPrefix",
+			GetRedisError(mn.ctx, mn.getRedisAddress(), redisCmd.Err()))
+	}
+	return int(redisCmd.Val()), nil
+}
+
+// getUsernamePrefixRange returns lexicographical range (ZRANGE BYLEX min and max) of usernames that start with prefix,
+// usernames are UTF-8 strings, therefore they never contain 0xff byte and prefix + 0xff is greater than any of them
+func getUsernamePrefixRange(prefix string) (string, string) {
+	if len(prefix) == 0 {
+		return "-", "+"
 	}
-	return realmUsers, nil
+	return "[" + prefix, "[" + prefix + "\xff"
 }
 
-// getRealmUser - get ExtendedIdentifier entity.
-/* First, getRealmUsers happens. Then there are comparisons by name
+// getUsersByNames - get realm users by usernames at once
+/* Users that don't exist (i.e. were deleted after usernames reading) are skipped
  * Arguments:
  *    - realmName
- *    - userName
- * Returns: *ExtendedIdentifier, error
+ *    - userNames
+ * Returns: users in usernames order, error
  */
-// nolint unused
-func (mn *RedisDataManager) getRealmUser(realmName string, userName string) (*data.ExtendedIdentifier, error) {
-	realmUsers, err := mn.getRealmUsers(realmName)
-	if err != nil {
-		return nil, errors2.NewUnknownError("getRealmUsers", "RedisDataManager.getRealmUser", err)
+func (mn *RedisDataManager) getUsersByNames(realmName string, userNames []string) ([]data.User, error) {
+	if len(userNames) == 0 {
+		return []data.User{}, nil
 	}
-
-	var user data.ExtendedIdentifier
-	userFound := false
-	for _, rc := range realmUsers {
-		if rc.Name == userName {
-			userFound = true
-			user = rc
-			break
-		}
+	userRedisKeys := make([]string, len(userNames))
+	for i, userName := range userNames {
+		userRedisKeys[i] = sf.Format(userKeyTemplate, mn.namespace, realmName, userName)
+	}
+	rawUsers, err := getMultipleRedisObjects[interface{}](mn.redisClient, mn.getRedisAddress(), mn.ctx, mn.logger, User, userRedisKeys)
+	if err != nil {
+		return nil, errors2.NewUnknownError("getMultipleRedisObjects", "RedisDataManager.getUsersByNames", err)
 	}
-	if !userFound {
-		mn.logger.Debug(sf.Format("User with name: \"{0}\" was not found for realm: \"{1}\"", userName, realmName))
-		return nil, errors2.NewObjectNotFoundError(string(User), userName, sf.Format("realm: {0}", realmName))
+	users := make([]data.User, len(rawUsers))
+	for i, rawUser := range rawUsers {
+		users[i] = data.CreateUser(rawUser, nil)
 	}
-	return &user, nil
+	return users, nil
 }
 
-// getRealmUserById - get ExtendedIdentifier entity.
-/* First, getRealmUsers happens. Then there are comparisons by id
+// getRealmUserNameById - get username of realm user by user id
+/* realmUserIdsKeyTemplate (users ids index) is used inside
  * Arguments:
  *    - realmName
  *    - userId
- * Returns: *ExtendedIdentifier, error
+ * Returns: username, error
  */
-func (mn *RedisDataManager) getRealmUserById(realmName string, userId uuid.UUID) (*data.ExtendedIdentifier, error) {
-	realmUsers, err := mn.getRealmUsers(realmName)
+func (mn *RedisDataManager) getRealmUserNameById(realmName string, userId uuid.UUID) (string, error) {
+	userIdsKey := sf.Format(realmUserIdsKeyTemplate, mn.namespace, realmName)
+	userName, err := mn.getRedisHashField(RealmUserIds, userIdsKey, userId.String())
 	if err != nil {
 		if errors.As(err, &errors2.EmptyNotFoundErr) {
-			return nil, err
+			mn.logger.Debug(sf.Format("User with id: \"{0}\" was not found for realm: \"{1}\"", userId, realmName))
+			return "", errors2.NewObjectNotFoundError(string(User), userId.String(), sf.Format("realm: {0}", realmName))
 		}
-		if errors.Is(err, errors2.ErrZeroLength) {
-			return nil, errors2.NewObjectNotFoundError(string(User), userId.String(), sf.Format("realm: {0}", realmName))
-		}
-		return nil, errors2.NewUnknownError("getRealmUsers", "RedisDataManager.getRealmUserById", err)
+		return "", errors2.NewUnknownError("getRedisHashField", "RedisDataManager.getRealmUserNameById", err)
 	}
-	var user data.ExtendedIdentifier
-	userFound := false
-	for _, rc := range realmUsers {
-		if rc.ID == userId {
-			userFound = true
-			user = rc
-			break
-		}
-	}
-	if !userFound {
-		mn.logger.Debug(sf.Format("User with id: \"{0}\" was not found for realm: \"{1}\"", userId, realmName))
-		return nil, errors2.NewObjectNotFoundError(string(User), userId.String(), sf.Format("realm: {0}", realmName))
+	return userName, nil
+}
+
+// getRealmUsersKeys returns keys of realm users relation and users indexes (keys that are changed when user is created or deleted)
+func (mn *RedisDataManager) getRealmUsersKeys(realmName string) []string {
+	return []string{
+		sf.Format(realmUserNamesKeyTemplate, mn.namespace, realmName),
+		sf.Format(realmUserIdsKeyTemplate, mn.namespace, realmName),
+		sf.Format(realmUserEmailsKeyTemplate, mn.namespace, realmName),
 	}
-	return &user, nil
 }
 
 // upsertUserObject - create or update a user
@@ -353,54 +551,30 @@ func (mn *RedisDataManager) upsertUserObject(realmName string, userName string,
 	return nil
 }
 
-// addUserToRealm - adding a client to the realmUser entity
-/* Uses createRealmUsers internally
+// addUserToRealm - adding a user to the realm usernames SORTED SET and to users indexes
+/* User without id is not indexed by id, user without email is not indexed by email
  * Arguments:
  *    - realmName
  *    - user
  * Returns: error
  */
 func (mn *RedisDataManager) addUserToRealm(realmName string, user data.User) error {
-	userId := user.GetId()
 	userName := user.GetUsername()
-	realmUser := data.ExtendedIdentifier{
-		ID:   userId,
-		Name: userName,
-	}
-	sliceRealmUser := []data.ExtendedIdentifier{realmUser}
-	if err := mn.createRealmUsers(realmName, sliceRealmUser, false); err != nil {
-		return errors2.NewUnknownError("createRealmUsers", "RedisDataManager.addUserToRealm", err)
-	}
-	return nil
-}
-
-// createRealmUsers - To add a new item to the list or create a new realmUsers
-/* Adds users to the realm. If the argument isAllPreDelete = true, all other users will be deleted before they are added
- * Arguments:
- *    - realmName
- *    - realmUsers - slice of ExtendedIdentifier
- *    - isAllPreDelete - flag, If true, the already existing realmUsers will be deleted. If false, new ones will be added to it.
- * Returns: error
- */
-func (mn *RedisDataManager) createRealmUsers(realmName string, realmUsers []data.ExtendedIdentifier, isAllPreDelete bool) error {
-	// TODO(SIA) maybe split into two functions
-	bytesRealmUsers, err := json.Marshal(realmUsers)
-	if err != nil {
-		mn.logger.Error(sf.Format("An error occurred during Marshal realmUsers"))
-		return errors2.NewUnknownError("json.Marshal", "RedisDataManager.createRealmUsers", err)
-	}
-
-	if isAllPreDelete {
-		if deleteRealmUserErr := mn.deleteRealmUsersObject(realmName); deleteRealmUserErr != nil {
-			// todo(UMV): errors.Is because ErrNotExists doesn't have custom type
-			if !errors.Is(deleteRealmUserErr, errors2.ErrNotExists) {
-				return errors2.NewUnknownError("deleteRealmUsersObject", "RedisDataManager.createRealmUsers", deleteRealmUserErr)
-			}
+	realmUsersKey := sf.Format(realmUserNamesKeyTemplate, mn.namespace, realmName)
+	if err := mn.addRedisSortedSetItem(RealmUsers, realmUsersKey, userName); err != nil {
+		return errors2.NewUnknownError("addRedisSortedSetItem", "RedisDataManager.addUserToRealm", err)
+	}
+	if userId := user.GetId(); userId != uuid.Nil {
+		userIdsKey := sf.Format(realmUserIdsKeyTemplate, mn.namespace, realmName)
+		if err := mn.upsertRedisHashField(RealmUserIds, userIdsKey, userId.String(), userName); err != nil {
+			return errors2.NewUnknownError("upsertRedisHashField", "RedisDataManager.addUserToRealm", err)
 		}
 	}
-	realmUsersKey := sf.Format(realmUsersKeyTemplate, mn.namespace, realmName)
-	if appendStringErr := mn.appendStringToRedisList(RealmUsers, realmUsersKey, string(bytesRealmUsers)); appendStringErr != nil {
-		return errors2.NewUnknownError("appendStringToRedisList", "RedisDataManager.createRealmUsers", appendStringErr)
+	if email := user.GetEmail(); email != "" {
+		userEmailsKey := sf.Format(realmUserEmailsKeyTemplate, mn.namespace, realmName)
+		if err := mn.upsertRedisHashField(RealmUserEmails, userEmailsKey, strings.ToLower(email), userName); err != nil {
+			return errors2.NewUnknownError("upsertRedisHashField", "RedisDataManager.addUserToRealm", err)
+		}
 	}
 	return nil
 }
@@ -423,38 +597,45 @@ func (mn *RedisDataManager) deleteUserObject(realmName string, userName string)
 	return nil
 }
 
-// deleteUserFromRealm - deleting a user from realmUsers entity
-/* Deletes user from realmUsers, does not delete user. Will return an error if there is no user in realm.
- * After deletion, all items in the list are merged into one.
- * A lot of things happen to delete a user: get users, find the user, delete it from the array,
- * delete all users from the realm, add a new array of users to the realm.
+// deleteUserFromRealm - deleting a user from realm usernames SORTED SET and from users indexes
+/* Does not delete user itself. Index item is deleted only if it refers to the user (other user could have same email)
  * Arguments:
  *    - realmName
- *    - userName
+ *    - user
  * Returns: error
  */
-func (mn *RedisDataManager) deleteUserFromRealm(realmName string, userName string) error {
-	realmUsers, err := mn.getRealmUsers(realmName)
-	if err != nil {
-		return errors2.NewUnknownError("getRealmUsers", "RedisDataManager.deleteUserFromRealm", err)
-	}
-
-	isHasUser := false
-	for i := range realmUsers {
-		if realmUsers[i].Name == userName {
-			isHasUser = true
-			if i != (len(realmUsers) - 1) {
-				realmUsers[i] = realmUsers[len(realmUsers)-1]
+func (mn *RedisDataManager) deleteUserFromRealm(realmName string, user data.User) error {
+	userName := user.GetUsername()
+	realmUsersKey := sf.Format(realmUserNamesKeyTemplate, mn.namespace, realmName)
+	if err := mn.deleteRedisSortedSetItem(RealmUsers, realmUsersKey, userName); err != nil {
+		return errors2.NewUnknownError("deleteRedisSortedSetItem", "RedisDataManager.deleteUserFromRealm", err)
+	}
+	type userIndex struct {
+		objName objectType
+		key     string
+		field   string
+	}
+	var indexes []userIndex
+	if userId := user.GetId(); userId != uuid.Nil {
+		indexes = append(indexes, userIndex{RealmUserIds, sf.Format(realmUserIdsKeyTemplate, mn.namespace, realmName), userId.String()})
+	}
+	if email := user.GetEmail(); email != "" {
+		indexes = append(indexes, userIndex{RealmUserEmails, sf.Format(realmUserEmailsKeyTemplate, mn.namespace, realmName), strings.ToLower(email)})
+	}
+	for _, index := range indexes {
+		indexedUserName, err := mn.getRedisHashField(index.objName, index.key, index.field)
+		if err != nil {
+			if errors.As(err, &errors2.EmptyNotFoundErr) {
+				continue
 			}
-			realmUsers = realmUsers[:len(realmUsers)-1]
-			break
+			return errors2.NewUnknownError("getRedisHashField", "RedisDataManager.deleteUserFromRealm", err)
+		}
+		if indexedUserName != userName {
+			continue
+		}
+		if err = mn.deleteRedisHashField(index.objName, index.key, index.field); err != nil {
+			return errors2.NewUnknownError("deleteRedisHashField", "RedisDataManager.deleteUserFromRealm", err)
 		}
-	}
-	if !isHasUser {
-		return errors2.NewObjectNotFoundError(string(User), userName, sf.Format("realm: {0}", realmName))
-	}
-	if createRealmUserErr := mn.createRealmUsers(realmName, realmUsers, true); createRealmUserErr != nil {
-		return errors2.NewUnknownError("createRealmUsers", "RedisDataManager.deleteUserFromRealm", createRealmUserErr)
 	}
 	return nil
 }
@@ -0,0 +1,99 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/wissance/Ferrum/config"
+	appErrs "github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/logging"
+	sf "github.com/wissance/stringFormatter"
+)
+
+// messageChannelTemplate is a Redis pub/sub channel name template (namespace and channel name)
+const messageChannelTemplate = "{0}.channel_{1}"
+
+// RedisMessageBus delivers messages to all Ferrum instances that use the same Redis and namespace (Redis pub/sub)
+/* Messages are not persisted: instance that was disconnected from Redis at the moment of publishing doesn't receive message,
+ * therefore subscriber is notified about every (re)subscription and should treat it as a possible loss of messages.
+ */
+type RedisMessageBus struct {
+	channel          string
+	redisClient      redis.UniversalClient
+	address          string
+	pubSub           *redis.PubSub
+	logger           *logging.AppLogger
+	operationTimeout time.Duration
+}
+
+// CreateRedisMessageBus creates bus of messages of channel in Redis that is configured in data source config (must be config.REDIS)
+/* Parameters:
+ *     - dataSourceCfg - Redis data source config, channel is created in data source namespace
+ *     - channel - name of channel
+ *     - logger - logger instance
+ * Returns: message bus
+ */
+func CreateRedisMessageBus(dataSourceCfg *config.DataSourceConfig, channel string, logger *logging.AppLogger) *RedisMessageBus {
+	rClient, _ := CreateRedisClient(dataSourceCfg, logger)
+	return &RedisMessageBus{
+		channel: sf.Format(messageChannelTemplate, GetNamespace(dataSourceCfg), channel), redisClient: rClient, logger: logger,
+		address: GetRedisAddress(dataSourceCfg), operationTimeout: dataSourceCfg.GetOperationTimeout(),
+	}
+}
+
+// Publish sends message to all subscribers of channel (including subscriber of this bus)
+/* Parameters:
+ *     - ctx - context of operation
+ *     - message - message
+ * Returns: error (errors.DataProviderNotAvailable if Redis is not available)
+ */
+func (bus *RedisMessageBus) Publish(ctx context.Context, message string) error {
+	var cancel context.CancelFunc
+	if bus.operationTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, bus.operationTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+	if err := bus.redisClient.Publish(ctx, bus.channel, message).Err(); err != nil {
+		bus.logger.Warn(sf.Format("An error occurred during message publishing to channel \"{0}\": {1}", bus.channel, err.Error()))
+		return appErrs.NewUnknownError("Publish", "RedisMessageBus.Publish", GetRedisError(ctx, bus.address, err))
+	}
+	return nil
+}
+
+// Subscribe starts receiving of channel messages, must be called once
+/* Messages are handled one by one in a separate goroutine. go-redis restores subscription after connection loss, messages
+ * that were published meanwhile are lost, therefore onSubscribe is called on every (re)subscription.
+ * Parameters:
+ *     - onMessage - message handler
+ *     - onSubscribe - (re)subscription handler
+ */
+func (bus *RedisMessageBus) Subscribe(onMessage func(message string), onSubscribe func()) {
+	bus.pubSub = bus.redisClient.Subscribe(context.Background(), bus.channel)
+	messages := bus.pubSub.ChannelWithSubscriptions()
+	go func() {
+		for message := range messages {
+			switch msg := message.(type) {
+			case *redis.Subscription:
+				if msg.Kind == "subscribe" {
+					bus.logger.Debug(sf.Format("Subscribed to channel \"{0}\"", bus.channel))
+					onSubscribe()
+				}
+			case *redis.Message:
+				onMessage(msg.Payload)
+			}
+		}
+	}()
+}
+
+// Close stops receiving of messages and closes Redis client
+func (bus *RedisMessageBus) Close() error {
+	if bus.pubSub != nil {
+		if err := bus.pubSub.Close(); err != nil {
+			bus.logger.Warn(sf.Format("An error occurred during channel \"{0}\" unsubscribing: {1}", bus.channel, err.Error()))
+		}
+	}
+	return bus.redisClient.Close()
+}
@@ -0,0 +1,321 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/wissance/Ferrum/config"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	sf "github.com/wissance/stringFormatter"
+)
+
+const (
+	// schemaVersionKeyTemplate is a key of namespace data version (version of the latest applied migration)
+	schemaVersionKeyTemplate = "{0}.schema_version"
+	// legacyRealmUsersKeyTemplate is a key of User to Realm relation that was stored as LIST of data.ExtendedIdentifier by previous
+	// Ferrum versions (see migration 1)
+	legacyRealmUsersKeyTemplate = "{0}.realm_{1}_users"
+	// migrationScanCount is a number of keys that are requested by one SCAN command
+	migrationScanCount = 100
+)
+
+// migrationsState guards migrations applying, it is shared by all copies of manager
+type migrationsState struct {
+	mutex    sync.Mutex
+	migrated atomic.Bool
+	// autoMigrate is a config.AutoMigrate option, if it is false data is not migrated by manager itself (see migrate)
+	autoMigrate bool
+}
+
+// migration is a versioned namespace data change
+type migration struct {
+	version     int
+	description string
+	apply       func(mn *RedisDataManager) error
+}
+
+// migrations is an ordered (by version) list of namespace data changes, applied migrations must never be changed,
+// every data change must be added as a new migration with next version. Migrations must be idempotent because several
+// Ferrum instances could apply them simultaneously
+var migrations = []migration{
+	{
+		version:     1,
+		description: "realm users LIST is replaced by usernames SET and users ids and emails indexes",
+		apply:       migrateRealmUsersToIndexes,
+	},
+	{
+		version:     2,
+		description: "realm usernames SET is replaced by usernames SORTED SET",
+		apply:       migrateRealmUserNamesToSortedSets,
+	},
+}
+
+// migrate applies migrations (see applyMigrations) once per manager, it must be called only when Redis is available
+/* Migrations are applied by a manager copy without operation deadline (namespace could have many users). If config.AutoMigrate
+ * option is false data is only checked: function fails until data is migrated by Migrate
+ * Parameters: no
+ * Returns: error
+ */
+func (mn *RedisDataManager) migrate() error {
+	if mn.migrations.migrated.Load() {
+		return nil
+	}
+	mn.migrations.mutex.Lock()
+	defer mn.migrations.mutex.Unlock()
+	if mn.migrations.migrated.Load() {
+		return nil
+	}
+	migrator := *mn
+	migrator.ctx = context.Background()
+	report, err := migrator.applyMigrations(!mn.migrations.autoMigrate)
+	if err != nil {
+		return err
+	}
+	if len(report.Migrations) > 0 && report.DryRun {
+		mn.logger.Warn(sf.Format("Redis namespace \"{0}\" data version {1} is outdated (latest version is {2}), data must be migrated "+
+			"by admin CLI migrate operation", mn.namespace, report.SchemaVersion, report.TargetVersion))
+		return appErrs.NewUnknownError("migrate", "RedisDataManager.migrate",
+			errors.New(sf.Format("data version {0} is outdated", report.SchemaVersion)))
+	}
+	mn.migrations.migrated.Store(true)
+	return nil
+}
+
+// Migrate applies migrations that were not applied to namespace data yet (see managers.SchemaMigrator)
+/* Migrations are applied without operation deadline (namespace could have many users), therefore ctx should have own deadline
+ * Parameters:
+ *     - ctx - context of operation
+ *     - dryRun - if true migrations are not applied, they are only returned in report
+ * Returns: migration report and error
+ */
+func (mn *RedisDataManager) Migrate(ctx context.Context, dryRun bool) (*data.MigrationReport, error) {
+	migrator := *mn
+	migrator.ctx = ctx
+	if err := migrator.redisClient.Ping(ctx).Err(); err != nil {
+		mn.logger.Debug(sf.Format("Redis Ping executed with error: {0}", err.Error()))
+		return nil, appErrs.NewDataProviderNotAvailable(string(config.REDIS), mn.getRedisAddress())
+	}
+	mn.migrations.mutex.Lock()
+	defer mn.migrations.mutex.Unlock()
+	report, err := migrator.applyMigrations(dryRun)
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		mn.migrations.migrated.Store(true)
+	}
+	return report, nil
+}
+
+// applyMigrations applies all not applied migrations to namespace data
+/* Version of the latest applied migration is stored by schemaVersionKeyTemplate key. Function fails if namespace data version
+ * is newer than the latest known migration (namespace was migrated by newer Ferrum version)
+ * Parameters:
+ *     - dryRun - if true migrations are not applied, they are only returned in report
+ * Returns: migration report and error
+ */
+func (mn *RedisDataManager) applyMigrations(dryRun bool) (*data.MigrationReport, error) {
+	versionKey := sf.Format(schemaVersionKeyTemplate, mn.namespace)
+	currentVersion, err := mn.getSchemaVersion(versionKey)
+	if err != nil {
+		return nil, err
+	}
+	latestVersion := migrations[len(migrations)-1].version
+	if currentVersion > latestVersion {
+		mn.logger.Error(sf.Format("Redis namespace \"{0}\" data version {1} is newer than supported version {2}", mn.namespace,
+			currentVersion, latestVersion))
+		return nil, appErrs.NewUnknownError("applyMigrations", "RedisDataManager.applyMigrations",
+			errors.New(sf.Format("data version {0} is not supported", currentVersion)))
+	}
+	report := &data.MigrationReport{SchemaVersion: currentVersion, TargetVersion: latestVersion, Migrations: []data.Migration{}, DryRun: dryRun}
+	for _, m := range migrations {
+		if m.version <= currentVersion {
+			continue
+		}
+		report.Migrations = append(report.Migrations, data.Migration{Version: m.version, Description: m.description})
+		if dryRun {
+			continue
+		}
+		if err = m.apply(mn); err != nil {
+			mn.logger.Error(sf.Format("An error occurred during redis namespace \"{0}\" migration {1} (\"{2}\"): {3}",
+				mn.namespace, m.version, m.description, err.Error()))
+			return nil, err
+		}
+		if err = mn.redisClient.Set(mn.ctx, versionKey, m.version, 0).Err(); err != nil {
+			return nil, appErrs.NewUnknownError("Set", "RedisDataManager.applyMigrations", GetRedisError(mn.ctx, mn.getRedisAddress(), err))
+		}
+		mn.logger.Info(sf.Format("Redis namespace \"{0}\" was migrated to version {1}: {2}", mn.namespace, m.version, m.description))
+	}
+	return report, nil
+}
+
+// getSchemaVersion returns version of the latest applied migration (0 if there are no applied migrations)
+func (mn *RedisDataManager) getSchemaVersion(versionKey string) (int, error) {
+	value, err := mn.redisClient.Get(mn.ctx, versionKey).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+		return 0, appErrs.NewUnknownError("Get", "RedisDataManager.getSchemaVersion", GetRedisError(mn.ctx, mn.getRedisAddress(), err))
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, appErrs.NewUnknownError("strconv.Atoi", "RedisDataManager.getSchemaVersion", err)
+	}
+	return version, nil
+}
+
+// migrateRealmUsersToIndexes is a migration 1, it moves users of every realm from LIST (legacyRealmUsersKeyTemplate) to usernames
+// SET and users ids and emails indexes (see addUserToRealm)
+/* Every realm is migrated in a separate transaction, LIST is deleted after migration, therefore realm that was already migrated
+ * (i.e. by other Ferrum instance) is skipped. Users that are in LIST but don't exist are skipped too.
+ * Parameters:
+ *     - mn - manager
+ * Returns: error
+ */
+func migrateRealmUsersToIndexes(mn *RedisDataManager) error {
+	keyPrefix := sf.Format("{0}.realm_", mn.namespace)
+	// namespace is escaped because it could contain glob special characters
+	legacyKeys, err := mn.scanKeys(sf.Format(legacyRealmUsersKeyTemplate, escapeGlob(mn.namespace), "*"), "list")
+	if err != nil {
+		return appErrs.NewUnknownError("scanKeys", "RedisDataManager.migrateRealmUsersToIndexes", err)
+	}
+
+	for _, legacyKey := range legacyKeys {
+		realmName := strings.TrimSuffix(strings.TrimPrefix(legacyKey, keyPrefix), "_users")
+		err = mn.transaction("RedisDataManager.migrateRealmUsersToIndexes", func(mn *RedisDataManager) error {
+			realmUsers, err := getObjectsListOfSlicesItemsFromRedis[data.ExtendedIdentifier](mn.redisClient, mn.getRedisAddress(), mn.ctx, mn.logger,
+				RealmUsers, legacyKey)
+			if err != nil {
+				if errors.Is(err, appErrs.ErrZeroLength) {
+					// realm was already migrated
+					return nil
+				}
+				return appErrs.NewUnknownError("getObjectsListOfSlicesItemsFromRedis", "RedisDataManager.migrateRealmUsersToIndexes", err)
+			}
+			for _, realmUser := range realmUsers {
+				userKey := sf.Format(userKeyTemplate, mn.namespace, realmName, realmUser.Name)
+				rawUser, getUserErr := getSingleRedisObject[interface{}](mn.redisClient, mn.getRedisAddress(), mn.ctx, mn.logger, User, userKey)
+				if getUserErr != nil {
+					if errors.As(getUserErr, &appErrs.EmptyNotFoundErr) {
+						mn.logger.Warn(sf.Format("User \"{0}\" of realm \"{1}\" doesn't exist, it is not migrated", realmUser.Name, realmName))
+						continue
+					}
+					return appErrs.NewUnknownError("getSingleRedisObject", "RedisDataManager.migrateRealmUsersToIndexes", getUserErr)
+				}
+				if addUserRealmErr := mn.addUserToRealm(realmName, data.CreateUser(*rawUser, nil)); addUserRealmErr != nil {
+					return appErrs.NewUnknownError("addUserToRealm", "RedisDataManager.migrateRealmUsersToIndexes", addUserRealmErr)
+				}
+			}
+			if deleteErr := mn.deleteRedisObject(RealmUsers, legacyKey); deleteErr != nil {
+				if !errors.As(deleteErr, &appErrs.EmptyNotFoundErr) {
+					return appErrs.NewUnknownError("deleteRedisObject", "RedisDataManager.migrateRealmUsersToIndexes", deleteErr)
+				}
+			}
+			return nil
+		}, append(mn.getRealmUsersKeys(realmName), legacyKey)...)
+		if err != nil {
+			return err
+		}
+		mn.logger.Info(sf.Format("Users of realm \"{0}\" were migrated", realmName))
+	}
+	return nil
+}
+
+// migrateRealmUserNamesToSortedSets is a migration 2, it replaces usernames SET of every realm (realmUserNamesKeyTemplate) by
+// SORTED SET with the same key and items with score 0 (see addUserToRealm), therefore users pages are read without reading all usernames
+/* Every realm is migrated in a separate transaction, key that is not a SET anymore (i.e. was migrated by other Ferrum instance)
+ * is skipped.
+ * Parameters:
+ *     - mn - manager
+ * Returns: error
+ */
+func migrateRealmUserNamesToSortedSets(mn *RedisDataManager) error {
+	// namespace is escaped because it could contain glob special characters
+	userNamesKeys, err := mn.scanKeys(sf.Format(realmUserNamesKeyTemplate, escapeGlob(mn.namespace), "*"), "set")
+	if err != nil {
+		return appErrs.NewUnknownError("scanKeys", "RedisDataManager.migrateRealmUserNamesToSortedSets", err)
+	}
+
+	for _, userNamesKey := range userNamesKeys {
+		err = mn.transaction("RedisDataManager.migrateRealmUserNamesToSortedSets", func(mn *RedisDataManager) error {
+			keyType, typeErr := mn.redisClient.Type(mn.ctx, userNamesKey).Result()
+			if typeErr != nil {
+				return appErrs.NewUnknownError("Type", "RedisDataManager.migrateRealmUserNamesToSortedSets",
+					GetRedisError(mn.ctx, mn.getRedisAddress(), typeErr))
+			}
+			if keyType != "set" {
+				// key was already migrated
+				return nil
+			}
+			userNames, getErr := mn.redisClient.SMembers(mn.ctx, userNamesKey).Result()
+			if getErr != nil {
+				return appErrs.NewUnknownError("SMembers", "RedisDataManager.migrateRealmUserNamesToSortedSets",
+					GetRedisError(mn.ctx, mn.getRedisAddress(), getErr))
+			}
+			if deleteErr := mn.deleteRedisObject(RealmUsers, userNamesKey); deleteErr != nil {
+				if !errors.As(deleteErr, &appErrs.EmptyNotFoundErr) {
+					return appErrs.NewUnknownError("deleteRedisObject", "RedisDataManager.migrateRealmUserNamesToSortedSets", deleteErr)
+				}
+			}
+			for _, userName := range userNames {
+				if addErr := mn.addRedisSortedSetItem(RealmUsers, userNamesKey, userName); addErr != nil {
+					return appErrs.NewUnknownError("addRedisSortedSetItem", "RedisDataManager.migrateRealmUserNamesToSortedSets", addErr)
+				}
+			}
+			return nil
+		}, userNamesKey)
+		if err != nil {
+			return err
+		}
+		mn.logger.Info(sf.Format("Usernames \"{0}\" were migrated to SORTED SET", userNamesKey))
+	}
+	return nil
+}
+
+// scanKeys returns all keys of keyType that match pattern, in cluster mode keys of all master nodes are scanned
+func (mn *RedisDataManager) scanKeys(pattern string, keyType string) ([]string, error) {
+	var mutex sync.Mutex
+	var keys []string
+	scanNode := func(ctx context.Context, client *redis.Client) error {
+		var cursor uint64
+		for {
+			nodeKeys, nextCursor, err := client.ScanType(ctx, cursor, pattern, migrationScanCount, keyType).Result()
+			if err != nil {
+				return GetRedisError(ctx, mn.getRedisAddress(), err)
+			}
+			mutex.Lock()
+			keys = append(keys, nodeKeys...)
+			mutex.Unlock()
+			if nextCursor == 0 {
+				return nil
+			}
+			cursor = nextCursor
+		}
+	}
+	var err error
+	if clusterClient, ok := mn.redisClient.(*redis.ClusterClient); ok {
+		err = clusterClient.ForEachMaster(mn.ctx, scanNode)
+	} else {
+		err = scanNode(mn.ctx, mn.redisClient.(*redis.Client))
+	}
+	return keys, err
+}
+
+// escapeGlob escapes characters that have special meaning in Redis glob-style patterns
+func escapeGlob(value string) string {
+	var escaped strings.Builder
+	for _, char := range value {
+		if strings.ContainsRune(`*?[]\`, char) {
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(char)
+	}
+	return escaped.String()
+}
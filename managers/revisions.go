@@ -0,0 +1,115 @@
+package managers
+
+import (
+	"context"
+
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	sf "github.com/wissance/stringFormatter"
+)
+
+// RevisionsKeeper is an optional DataContext extension that provides history of realms and clients changes (see data.Revision)
+/* Revisions are added by data store itself on realm or client creation and update (with author from context, see
+ * data.WithRevisionAuthor), therefore changes made via any API are kept. All built-in data stores implement this interface.
+ */
+type RevisionsKeeper interface {
+	// GetRevisions returns revisions of realm (objectType is data.RealmRevision, objectName is not used) or realm client ordered by version
+	GetRevisions(ctx context.Context, realmName string, objectType data.RevisionObjectType, objectName string) ([]data.Revision, error)
+}
+
+// revisionObject is a revision object type (for errors)
+const revisionObject = "revision"
+
+// GetRevision returns revision of realm or realm client by version
+/* Parameters:
+ *     - ctx - context of operation
+ *     - dataContext - data context (must implement RevisionsKeeper)
+ *     - realmName - name of a realm
+ *     - objectType - type of object (data.RealmRevision or data.ClientRevision)
+ *     - objectName - name of a client (not used for realm)
+ *     - version - revision version
+ * Returns: revision and error (errors.ErrOperationNotImplemented if data context doesn't keep history, errors.ObjectNotFoundError
+ * if revision is not kept)
+ */
+func GetRevision(ctx context.Context, dataContext DataContext, realmName string, objectType data.RevisionObjectType, objectName string,
+	version int64,
+) (*data.Revision, error) {
+	keeper, ok := dataContext.(RevisionsKeeper)
+	if !ok {
+		return nil, appErrs.ErrOperationNotImplemented
+	}
+	revisions, err := keeper.GetRevisions(ctx, realmName, objectType, objectName)
+	if err != nil {
+		return nil, err
+	}
+	revision := data.FindRevision(revisions, version)
+	if revision == nil {
+		return nil, appErrs.NewObjectNotFoundError(revisionObject, sf.Format("{0} {1} version {2}", objectType, objectName, version),
+			sf.Format("realm: {0}", realmName))
+	}
+	return revision, nil
+}
+
+// RollbackRealm restores realm settings that were kept in revision, rollback itself is an update (realm gets new version and revision)
+/* Realm name and not-before (token revocation time) are not restored, rollback fails if realm is changed during rollback
+ * Parameters:
+ *     - ctx - context of operation (contains author, see data.WithRevisionAuthor)
+ *     - dataContext - data context (must implement RevisionsKeeper)
+ *     - realmName - name of a realm
+ *     - version - version of restored revision
+ * Returns: error (errors.ObjectNotFoundError if revision is not kept, errors.ObjectVersionConflictError if realm was changed
+ * during rollback)
+ */
+func RollbackRealm(ctx context.Context, dataContext DataContext, realmName string, version int64) error {
+	revision, err := GetRevision(ctx, dataContext, realmName, data.RealmRevision, "", version)
+	if err != nil {
+		return err
+	}
+	realm, err := revision.GetRealm()
+	if err != nil {
+		return appErrs.NewUnknownError("json.Unmarshal", "RollbackRealm", err)
+	}
+	currentRealm, err := dataContext.GetRealm(ctx, realmName)
+	if err != nil {
+		return err
+	}
+	realm.Name = currentRealm.Name
+	// tokens that were revoked must remain revoked
+	realm.NotBefore = currentRealm.NotBefore
+	realm.Version = currentRealm.Version
+	return dataContext.UpdateRealm(ctx, realmName, *realm)
+}
+
+// RollbackClient restores realm client that was kept in revision, rollback itself is an update (client gets new version and revision)
+/* Client name, id and secret (revision keeps masked secret) are not restored, rollback fails if client is changed during rollback
+ * Parameters:
+ *     - ctx - context of operation (contains author, see data.WithRevisionAuthor)
+ *     - dataContext - data context (must implement RevisionsKeeper)
+ *     - realmName - name of a realm
+ *     - clientName - name of a client
+ *     - version - version of restored revision
+ * Returns: error (errors.ObjectNotFoundError if revision is not kept, errors.ObjectVersionConflictError if client was changed
+ * during rollback)
+ */
+func RollbackClient(ctx context.Context, dataContext DataContext, realmName string, clientName string, version int64) error {
+	revision, err := GetRevision(ctx, dataContext, realmName, data.ClientRevision, clientName, version)
+	if err != nil {
+		return err
+	}
+	client, err := revision.GetClient()
+	if err != nil {
+		return appErrs.NewUnknownError("json.Unmarshal", "RollbackClient", err)
+	}
+	currentClient, err := dataContext.GetClient(ctx, realmName, clientName)
+	if err != nil {
+		return err
+	}
+	client.Name = currentClient.Name
+	client.ID = currentClient.ID
+	client.Version = currentClient.Version
+	// revisions don't keep secrets (see data.CreateClientRevision)
+	if client.Auth.Value == data.SecretMask {
+		client.Auth.Value = currentClient.Auth.Value
+	}
+	return dataContext.UpdateClient(ctx, realmName, clientName, *client)
+}
@@ -0,0 +1,96 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wissance/Ferrum/config"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/logging"
+	"github.com/wissance/Ferrum/managers/files"
+)
+
+func TestRollbackClient(t *testing.T) {
+	realmName := "rollback_client_realm"
+	serverData := createTestServerData(t, realmName, "salt", "password")
+	logger := logging.CreateLogger(&config.LoggingConfig{})
+	mn, err := files.CreateFileDataManagerWithInitData(&serverData, logger)
+	require.NoError(t, err)
+	ctx := data.WithRevisionAuthor(context.Background(), "master/admin")
+
+	client, err := mn.GetClient(ctx, realmName, "client")
+	require.NoError(t, err)
+	client.Type = data.Confidential
+	client.Auth = data.Authentication{Type: data.ClientIdAndSecrets, Value: "first_secret"}
+	require.NoError(t, mn.UpdateClient(ctx, realmName, "client", *client))
+	client, err = mn.GetClient(ctx, realmName, "client")
+	require.NoError(t, err)
+	restoredVersion := client.Version
+	refreshTokenRotation := true
+	client.RefreshTokenRotation = &refreshTokenRotation
+	client.Auth.Value = "second_secret"
+	require.NoError(t, mn.UpdateClient(ctx, realmName, "client", *client))
+
+	err = RollbackClient(ctx, mn, realmName, "client", restoredVersion)
+	require.NoError(t, err)
+	rolledBackClient, err := mn.GetClient(ctx, realmName, "client")
+	require.NoError(t, err)
+	assert.Nil(t, rolledBackClient.RefreshTokenRotation)
+	// revisions don't keep secrets, current secret is kept
+	assert.Equal(t, "second_secret", rolledBackClient.Auth.Value)
+	assert.Equal(t, data.Confidential, rolledBackClient.Type)
+	assert.Equal(t, client.ID, rolledBackClient.ID)
+	assert.Equal(t, restoredVersion+2, rolledBackClient.Version)
+
+	// rollback itself is a new revision
+	revision, err := GetRevision(ctx, mn, realmName, data.ClientRevision, "client", rolledBackClient.Version)
+	require.NoError(t, err)
+	assert.Equal(t, "master/admin", revision.Author)
+
+	err = RollbackClient(ctx, mn, realmName, "client", 100)
+	assert.True(t, errors.As(err, &appErrs.ObjectNotFoundError{}))
+}
+
+func TestRollbackRealm(t *testing.T) {
+	realmName := "rollback_realm"
+	serverData := createTestServerData(t, realmName, "salt", "password")
+	logger := logging.CreateLogger(&config.LoggingConfig{})
+	mn, err := files.CreateFileDataManagerWithInitData(&serverData, logger)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	realm, err := mn.GetRealm(ctx, realmName)
+	require.NoError(t, err)
+	realm.TokenExpiration = 100
+	require.NoError(t, mn.UpdateRealm(ctx, realmName, *realm))
+	realm, err = mn.GetRealm(ctx, realmName)
+	require.NoError(t, err)
+	restoredVersion := realm.Version
+	realm.TokenExpiration = 200
+	realm.NotBefore = 1700000000
+	require.NoError(t, mn.UpdateRealm(ctx, realmName, *realm))
+
+	err = RollbackRealm(ctx, mn, realmName, restoredVersion)
+	require.NoError(t, err)
+	rolledBackRealm, err := mn.GetRealm(ctx, realmName)
+	require.NoError(t, err)
+	assert.Equal(t, 100, rolledBackRealm.TokenExpiration)
+	// revoked tokens remain revoked and realm objects are not affected
+	assert.Equal(t, int64(1700000000), rolledBackRealm.NotBefore)
+	assert.Equal(t, restoredVersion+2, rolledBackRealm.Version)
+	clients, err := mn.GetClients(ctx, realmName)
+	require.NoError(t, err)
+	assert.Len(t, clients, 1)
+	users, err := mn.GetUsers(ctx, realmName)
+	require.NoError(t, err)
+	assert.Len(t, users, 1)
+}
+
+func TestGetRevisionFromDataContextWithoutHistory(t *testing.T) {
+	_, err := GetRevision(context.Background(), &dataContextWithoutImport{}, "realm", data.RealmRevision, "", 1)
+	assert.ErrorIs(t, err, appErrs.ErrOperationNotImplemented)
+}
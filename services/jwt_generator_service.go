@@ -50,6 +50,23 @@ func (generator *JwtGenerator) GenerateJwtRefreshToken(realmBaseUrl string, toke
 	return generator.generateJwtRefreshToken(refreshToken)
 }
 
+// GenerateJwtOfflineToken generates encoded string of offline token in JWT format
+/* Offline token is a refresh token that is issued by offline session (data.OfflineSession), it has same structure as refresh token
+ * but session identifier (sid) relates to offline session and expiration relates to offline session expiration.
+ * Parameters:
+ *    - realmBaseUrl - common path of all routes, usually ~/auth/realms/{realm}/ (see api/rest/getRealmBaseUrl)
+ *    - tokenType - string with type of token, rest.OfflineToken
+ *    - scope - verification scope, must contain globals.OfflineAccessScope
+ *    - offlineSession - offline session data
+ * Returns: JWT-encoded string with offline token
+ */
+func (generator *JwtGenerator) GenerateJwtOfflineToken(realmBaseUrl string, tokenType string, scope string, offlineSession *data.OfflineSession) string {
+	jwtCommon := data.JwtCommonInfo{Issuer: realmBaseUrl, Type: tokenType, Audience: realmBaseUrl, Scope: scope, JwtId: uuid.New(),
+		IssuedAt: offlineSession.LastActivity, ExpiredAt: offlineSession.Expired, Subject: offlineSession.UserId,
+		SessionId: offlineSession.Id, SessionState: offlineSession.Id, AuthorizedParty: offlineSession.ClientId}
+	return generator.generateJwtRefreshToken(data.CreateRefreshToken(&jwtCommon))
+}
+
 // generateJwtAccessToken this is actual access token JWT generation with SignKey as a Token signature (HMAC-SHA-256)
 func (generator *JwtGenerator) generateJwtAccessToken(tokenData *data.AccessTokenData) string {
 	token := jwt.New(jwt.SigningMethodHS256)
@@ -81,7 +98,7 @@ func (generator *JwtGenerator) prepareAccessToken(realmBaseUrl string, tokenType
 	issuer := realmBaseUrl
 	jwtCommon := data.JwtCommonInfo{Issuer: issuer, Type: tokenType, Audience: "account", Scope: scope, JwtId: uuid.New(),
 		IssuedAt: sessionData.Started, ExpiredAt: sessionData.Expired, Subject: sessionData.UserId,
-		SessionId: sessionData.Id, SessionState: sessionData.Id}
+		SessionId: sessionData.Id, SessionState: sessionData.Id, AuthorizedParty: sessionData.ClientId}
 	accessToken := data.CreateAccessToken(&jwtCommon, userData)
 	return accessToken
 }
@@ -91,7 +108,7 @@ func (generator *JwtGenerator) prepareRefreshToken(realmBaseUrl string, tokenTyp
 	issuer := realmBaseUrl
 	jwtCommon := data.JwtCommonInfo{Issuer: issuer, Type: tokenType, Audience: issuer, Scope: scope, JwtId: uuid.New(),
 		IssuedAt: sessionData.Started, ExpiredAt: sessionData.Expired, Subject: sessionData.UserId,
-		SessionId: sessionData.Id, SessionState: sessionData.Id}
+		SessionId: sessionData.Id, SessionState: sessionData.Id, AuthorizedParty: sessionData.ClientId}
 	accessToken := data.CreateRefreshToken(&jwtCommon)
 	return accessToken
 }
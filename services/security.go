@@ -1,31 +1,67 @@
 package services
 
 import (
+	"context"
+
 	"github.com/google/uuid"
 	"github.com/wissance/Ferrum/data"
 	"github.com/wissance/Ferrum/dto"
 )
 
 // SecurityService is an interface that implements all checks and manipulation with sessions data
+/* All methods that access data store or sessions store receive context.Context (context of HTTP request), therefore they are
+ * cancelled when client disconnects
+ */
 type SecurityService interface {
 	// Validate checks whether provided tokenIssueData could be used for token generation or not
 	Validate(tokenIssueData *dto.TokenGenerationData, realm *data.Realm) *data.OperationError
 	// CheckCredentials validates provided in tokenIssueData pairs of clientId+clientSecret and username+password
-	CheckCredentials(tokenIssueData *dto.TokenGenerationData, realmName string) *data.OperationError
+	CheckCredentials(ctx context.Context, tokenIssueData *dto.TokenGenerationData, realmName string) *data.OperationError
 	// GetCurrentUserByName return CurrentUser data by name
-	GetCurrentUserByName(realmName string, userName string) data.User
+	GetCurrentUserByName(ctx context.Context, realmName string, userName string) data.User
 	// GetCurrentUserById return CurrentUser data by id
-	GetCurrentUserById(realmName string, userId uuid.UUID) data.User
-	// StartOrUpdateSession starting new session on new successful token issue request or updates existing one with new request with valid token
-	StartOrUpdateSession(realm string, userId uuid.UUID, duration int, refresh int) uuid.UUID
-	// AssignTokens this function creates relation between userId and issued tokens (access and refresh)
-	AssignTokens(realm string, userId uuid.UUID, accessToken *string, refreshToken *string)
-	// GetSession returns user session data
-	GetSession(realm string, userId uuid.UUID) *data.UserSession
+	GetCurrentUserById(ctx context.Context, realmName string, userId uuid.UUID) data.User
+	// StartOrUpdateSession starts new session on new successful login (sessionId is uuid.Nil) or updates existing one on token refresh,
+	// new session could be rejected if user reached realm sessions limit
+	StartOrUpdateSession(ctx context.Context, realm *data.Realm, sessionId uuid.UUID, userId uuid.UUID, clientId string,
+		ipAddress string) (uuid.UUID, *data.OperationError)
+	// AssignTokens this function creates relation between session and issued tokens (access and refresh) if session still has
+	// replaced refresh token (only one of concurrent refreshes succeeds), tokens must not be issued if it fails
+	AssignTokens(ctx context.Context, realm string, sessionId uuid.UUID, replacedRefreshToken *string, accessToken *string,
+		refreshToken *string) *data.OperationError
+	// GetSession returns session data by session id
+	GetSession(ctx context.Context, realm string, sessionId uuid.UUID) *data.UserSession
+	// GetUserSessions returns all user sessions (user could be logged in from several clients or devices at the same time)
+	GetUserSessions(ctx context.Context, realm string, userId uuid.UUID) []data.UserSession
+	// GetRealmSessions returns all active sessions of a realm
+	GetRealmSessions(ctx context.Context, realm string) []data.UserSession
+	// GetClientSessions returns all active sessions of a realm that were started by client with name = clientId
+	GetClientSessions(ctx context.Context, realm string, clientId string) []data.UserSession
 	// GetSessionByAccessToken returns session data by access token
-	GetSessionByAccessToken(realm string, token *string) *data.UserSession
+	GetSessionByAccessToken(ctx context.Context, realm string, token *string) *data.UserSession
 	// GetSessionByRefreshToken returns session data by access token
-	GetSessionByRefreshToken(realm string, token *string) *data.UserSession
+	GetSessionByRefreshToken(ctx context.Context, realm string, token *string) *data.UserSession
+	// GetSessionByUsedRefreshToken returns session if already used refresh token was presented and refresh token rotation is
+	// disabled (replaced refresh tokens stay valid while session is active), otherwise nil
+	GetSessionByUsedRefreshToken(ctx context.Context, realm *data.Realm, clientId string, token *string) *data.UserSession
+	// RevokeReusedRefreshToken revokes session if already used refresh token was presented and refresh token rotation is enabled
+	RevokeReusedRefreshToken(ctx context.Context, realm *data.Realm, clientId string, token *string) bool
+	// StartOrUpdateOfflineSession starts new offline session on login with offline_access scope (offlineSessionId is uuid.Nil)
+	// or extends existing one on offline token refresh, offline session is stored in a data store
+	StartOrUpdateOfflineSession(ctx context.Context, realm *data.Realm, offlineSessionId uuid.UUID, userSessionId uuid.UUID, userId uuid.UUID,
+		clientId string) (*data.OfflineSession, *data.OperationError)
+	// AssignOfflineToken creates relation between offline session and issued offline token, previous offline token becomes invalid
+	AssignOfflineToken(ctx context.Context, realm string, offlineSession *data.OfflineSession, token *string)
+	// GetOfflineSessionByToken returns active offline session by offline token
+	GetOfflineSessionByToken(ctx context.Context, realm string, token *string) *data.OfflineSession
+	// TerminateSession removes (forcibly logs out) one session, returns false if session doesn't exist
+	TerminateSession(ctx context.Context, realm string, sessionId uuid.UUID) bool
+	// TerminateUserSessions removes all user sessions, returns number of removed sessions
+	TerminateUserSessions(ctx context.Context, realm string, userId uuid.UUID) int
+	// TerminateRealmSessions removes all realm sessions, returns number of removed sessions
+	TerminateRealmSessions(ctx context.Context, realm string) int
+	// SetRealmNotBefore sets realm revocation timestamp, tokens of sessions that were not active since this time are not valid
+	SetRealmNotBefore(ctx context.Context, realm *data.Realm, notBefore int64) error
 	// CheckSessionAndRefreshExpired checks is user tokens expired or not (could user use them or should get new ones)
-	CheckSessionAndRefreshExpired(realm string, userId uuid.UUID) (bool, bool)
+	CheckSessionAndRefreshExpired(ctx context.Context, realm string, sessionId uuid.UUID) (bool, bool)
 }
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SecurityEventType is a type of security related event that requires attention (i.e. of auditors)
+type SecurityEventType string
+
+const (
+	// RefreshTokenReuseEvent : already used refresh token was presented, it is a sign of refresh token theft
+	RefreshTokenReuseEvent SecurityEventType = "REFRESH_TOKEN_REUSE"
+)
+
+// SecurityEvent is a security related event, TokenBasedSecurityService writes such events to log with warning level
+type SecurityEvent struct {
+	Type      SecurityEventType `json:"type"`
+	Time      time.Time         `json:"time"`
+	Realm     string            `json:"realm"`
+	ClientId  string            `json:"client_id"`
+	UserId    uuid.UUID         `json:"user_id"`
+	SessionId uuid.UUID         `json:"session_id"`
+	Details   string            `json:"details"`
+}
@@ -0,0 +1,342 @@
+package sessions
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+)
+
+// sessionEntry is a stored session with identifiers (jti) of tokens that were assigned to it and hashes of refresh tokens
+// that were replaced by newer ones
+type sessionEntry struct {
+	session           data.UserSession
+	accessJti         uuid.UUID
+	refreshJti        uuid.UUID
+	usedRefreshTokens []string
+}
+
+// realmSessions is a set of sessions of a one realm with all indexes that are using for a fast search
+type realmSessions struct {
+	sessions     map[uuid.UUID]*sessionEntry
+	byUser       map[uuid.UUID]map[uuid.UUID]struct{}
+	byAccessJti  map[uuid.UUID]uuid.UUID
+	byRefreshJti map[uuid.UUID]uuid.UUID
+	byUsedToken  map[string]uuid.UUID
+}
+
+// MemorySessionStore is a concurrency-safe in-memory storage of data.UserSession
+/* This store doesn't share sessions between Ferrum instances and loses them on restart.
+ * Sessions are grouped by realm, every realm group has indexes:
+ * 1. by session id (main storage)
+ * 2. by user id (user id -> set of session id, user could have multiple sessions)
+ * 3. by access and refresh token identifiers (jti -> session id)
+ * 4. by hashes of used refresh tokens (hash -> session id)
+ * All operations except GetUserSessions (O(number of user sessions)) and GetRealmSessions (O(number of realm sessions)) are O(1). MemorySessionStore returns copies of stored sessions, therefore changes of returned value
+ * doesn't affect stored session, use Save to update session. Operations don't wait for any external resource, therefore
+ * context.Context that every operation receives is not used.
+ */
+type MemorySessionStore struct {
+	mutex  sync.RWMutex
+	realms map[string]*realmSessions
+}
+
+// CreateMemorySessionStore creates empty MemorySessionStore
+func CreateMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{realms: map[string]*realmSessions{}}
+}
+
+// Save adds new or replaces existing (by session.Id) session
+/* This function also rebuilds session indexes: user id and identifiers of assigned tokens (if tokens were assigned)
+ * Parameters:
+ *    - realm - name of a realm
+ *    - session - session to save
+ * Returns error, always nil for this store
+ */
+func (store *MemorySessionStore) Save(ctx context.Context, realm string, session *data.UserSession) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.save(realm, session)
+	return nil
+}
+
+// Rotate replaces existing session if it has refresh token = expectedRefreshToken, tokens are compared under store mutex
+/* Parameters:
+ *    - realm - name of a realm
+ *    - expectedRefreshToken - refresh token that stored session must have (refresh token that session was read with)
+ *    - session - new session state
+ * Returns error: errors.ObjectNotFoundError if session doesn't exist, ErrRefreshTokenReplaced if session has other refresh token
+ */
+func (store *MemorySessionStore) Rotate(ctx context.Context, realm string, expectedRefreshToken string, session *data.UserSession) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	rs, ok := store.realms[realm]
+	if !ok {
+		return appErrs.NewObjectNotFoundError(sessionObjectType, session.Id.String(), sessionIdDetails(realm))
+	}
+	current, exists := rs.sessions[session.Id]
+	if !exists {
+		return appErrs.NewObjectNotFoundError(sessionObjectType, session.Id.String(), sessionIdDetails(realm))
+	}
+	if current.session.JwtRefreshToken != expectedRefreshToken {
+		return ErrRefreshTokenReplaced
+	}
+	store.save(realm, session)
+	return nil
+}
+
+// save adds or replaces session and rebuilds its indexes, store mutex must be locked
+func (store *MemorySessionStore) save(realm string, session *data.UserSession) {
+	accessJti := getTokenId(session.JwtAccessToken)
+	refreshJti := getTokenId(session.JwtRefreshToken)
+
+	rs, ok := store.realms[realm]
+	if !ok {
+		rs = &realmSessions{
+			sessions:     map[uuid.UUID]*sessionEntry{},
+			byUser:       map[uuid.UUID]map[uuid.UUID]struct{}{},
+			byAccessJti:  map[uuid.UUID]uuid.UUID{},
+			byRefreshJti: map[uuid.UUID]uuid.UUID{},
+			byUsedToken:  map[string]uuid.UUID{},
+		}
+		store.realms[realm] = rs
+	}
+	entry := &sessionEntry{session: *session, accessJti: accessJti, refreshJti: refreshJti}
+	if old, exists := rs.sessions[session.Id]; exists {
+		rs.removeIndexes(old)
+		entry.usedRefreshTokens = old.usedRefreshTokens
+		if len(old.session.JwtRefreshToken) > 0 && old.session.JwtRefreshToken != session.JwtRefreshToken {
+			entry.usedRefreshTokens = append(entry.usedRefreshTokens, GetTokenHash(old.session.JwtRefreshToken))
+		}
+	}
+	for _, tokenHash := range entry.usedRefreshTokens {
+		rs.byUsedToken[tokenHash] = session.Id
+	}
+	rs.sessions[session.Id] = entry
+	userSessions, ok := rs.byUser[session.UserId]
+	if !ok {
+		userSessions = map[uuid.UUID]struct{}{}
+		rs.byUser[session.UserId] = userSessions
+	}
+	userSessions[session.Id] = struct{}{}
+	if accessJti != uuid.Nil {
+		rs.byAccessJti[accessJti] = session.Id
+	}
+	if refreshJti != uuid.Nil {
+		rs.byRefreshJti[refreshJti] = session.Id
+	}
+}
+
+// Get returns copy of a session by session id
+func (store *MemorySessionStore) Get(ctx context.Context, realm string, sessionId uuid.UUID) (*data.UserSession, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	rs, ok := store.realms[realm]
+	if !ok {
+		return nil, appErrs.NewObjectNotFoundError(sessionObjectType, sessionId.String(), sessionIdDetails(realm))
+	}
+	return rs.get(realm, sessionId)
+}
+
+// GetUserSessions returns copies of all user sessions ordered by start time
+func (store *MemorySessionStore) GetUserSessions(ctx context.Context, realm string, userId uuid.UUID) ([]data.UserSession, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	rs, ok := store.realms[realm]
+	if !ok {
+		return []data.UserSession{}, nil
+	}
+	userSessions := rs.byUser[userId]
+	result := make([]data.UserSession, 0, len(userSessions))
+	for sessionId := range userSessions {
+		if entry, exists := rs.sessions[sessionId]; exists {
+			result = append(result, entry.session)
+		}
+	}
+	sortSessionsByStart(result)
+	return result, nil
+}
+
+// GetRealmSessions returns copies of all realm sessions ordered by start time
+func (store *MemorySessionStore) GetRealmSessions(ctx context.Context, realm string) ([]data.UserSession, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	rs, ok := store.realms[realm]
+	if !ok {
+		return []data.UserSession{}, nil
+	}
+	result := make([]data.UserSession, 0, len(rs.sessions))
+	for _, entry := range rs.sessions {
+		result = append(result, entry.session)
+	}
+	sortSessionsByStart(result)
+	return result, nil
+}
+
+// GetByAccessToken returns copy of a session that has such access token
+/* Session is searching by token identifier (jti), after that we check that token is fully matches assigned to session token
+ * Parameters:
+ *    - realm - name of a realm
+ *    - token - JWT encoded access token
+ * Returns session and error
+ */
+func (store *MemorySessionStore) GetByAccessToken(ctx context.Context, realm string, token string) (*data.UserSession, error) {
+	jti := getTokenId(token)
+	notFoundErr := appErrs.NewObjectNotFoundError(sessionObjectType, jti.String(), sessionIdDetails(realm))
+	if jti == uuid.Nil {
+		return nil, notFoundErr
+	}
+
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	rs, ok := store.realms[realm]
+	if !ok {
+		return nil, notFoundErr
+	}
+	sessionId, ok := rs.byAccessJti[jti]
+	if !ok {
+		return nil, notFoundErr
+	}
+	s, err := rs.get(realm, sessionId)
+	if err != nil || s.JwtAccessToken != token {
+		return nil, notFoundErr
+	}
+	return s, nil
+}
+
+// GetByRefreshToken returns copy of a session that has such refresh token
+/* Session is searching by token identifier (jti), after that we check that token is fully matches assigned to session token
+ * Parameters:
+ *    - realm - name of a realm
+ *    - token - JWT encoded refresh token
+ * Returns session and error
+ */
+func (store *MemorySessionStore) GetByRefreshToken(ctx context.Context, realm string, token string) (*data.UserSession, error) {
+	jti := getTokenId(token)
+	notFoundErr := appErrs.NewObjectNotFoundError(sessionObjectType, jti.String(), sessionIdDetails(realm))
+	if jti == uuid.Nil {
+		return nil, notFoundErr
+	}
+
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	rs, ok := store.realms[realm]
+	if !ok {
+		return nil, notFoundErr
+	}
+	sessionId, ok := rs.byRefreshJti[jti]
+	if !ok {
+		return nil, notFoundErr
+	}
+	s, err := rs.get(realm, sessionId)
+	if err != nil || s.JwtRefreshToken != token {
+		return nil, notFoundErr
+	}
+	return s, nil
+}
+
+// GetByUsedRefreshToken returns copy of a session that refresh token was issued by before it was replaced by a new one
+/* Session is searching by token hash
+ * Parameters:
+ *    - realm - name of a realm
+ *    - token - JWT encoded refresh token
+ * Returns session and error
+ */
+func (store *MemorySessionStore) GetByUsedRefreshToken(ctx context.Context, realm string, token string) (*data.UserSession, error) {
+	tokenHash := GetTokenHash(token)
+	notFoundErr := appErrs.NewObjectNotFoundError(sessionObjectType, tokenHash, sessionIdDetails(realm))
+
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	rs, ok := store.realms[realm]
+	if !ok {
+		return nil, notFoundErr
+	}
+	sessionId, ok := rs.byUsedToken[tokenHash]
+	if !ok {
+		return nil, notFoundErr
+	}
+	return rs.get(realm, sessionId)
+}
+
+// Delete removes session with all its indexes
+func (store *MemorySessionStore) Delete(ctx context.Context, realm string, sessionId uuid.UUID) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	rs, ok := store.realms[realm]
+	if !ok {
+		return appErrs.NewObjectNotFoundError(sessionObjectType, sessionId.String(), sessionIdDetails(realm))
+	}
+	entry, ok := rs.sessions[sessionId]
+	if !ok {
+		return appErrs.NewObjectNotFoundError(sessionObjectType, sessionId.String(), sessionIdDetails(realm))
+	}
+	rs.removeIndexes(entry)
+	delete(rs.sessions, sessionId)
+	return nil
+}
+
+// DeleteExpired removes expired sessions of all realms, this function is using by SessionJanitor
+/* This function holds write lock during whole sweep, it is O(number of sessions)
+ * Parameters:
+ *    - current - time to check session expiration against
+ * Returns number of removed sessions and error, error is always nil for this store
+ */
+func (store *MemorySessionStore) DeleteExpired(ctx context.Context, current time.Time) (int, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	removed := 0
+	for realm, rs := range store.realms {
+		for sessionId, entry := range rs.sessions {
+			if isSessionExpired(&entry.session, current) {
+				rs.removeIndexes(entry)
+				delete(rs.sessions, sessionId)
+				removed++
+			}
+		}
+		if len(rs.sessions) == 0 {
+			delete(store.realms, realm)
+		}
+	}
+	return removed, nil
+}
+
+func (rs *realmSessions) get(realm string, sessionId uuid.UUID) (*data.UserSession, error) {
+	entry, ok := rs.sessions[sessionId]
+	if !ok {
+		return nil, appErrs.NewObjectNotFoundError(sessionObjectType, sessionId.String(), sessionIdDetails(realm))
+	}
+	s := entry.session
+	return &s, nil
+}
+
+func (rs *realmSessions) removeIndexes(entry *sessionEntry) {
+	if userSessions, ok := rs.byUser[entry.session.UserId]; ok {
+		delete(userSessions, entry.session.Id)
+		if len(userSessions) == 0 {
+			delete(rs.byUser, entry.session.UserId)
+		}
+	}
+	if entry.accessJti != uuid.Nil {
+		delete(rs.byAccessJti, entry.accessJti)
+	}
+	if entry.refreshJti != uuid.Nil {
+		delete(rs.byRefreshJti, entry.refreshJti)
+	}
+	for _, tokenHash := range entry.usedRefreshTokens {
+		delete(rs.byUsedToken, tokenHash)
+	}
+}
@@ -0,0 +1,473 @@
+package sessions
+
+import (
+	"context"
+	"encoding/base64"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wissance/Ferrum/data"
+	sf "github.com/wissance/stringFormatter"
+)
+
+const testRealm = "test_realm"
+
+func TestMemorySessionStoreSaveAndGetSessionSuccessfully(t *testing.T) {
+	checkSaveAndGetSession(t, CreateMemorySessionStore())
+}
+
+func TestMemorySessionStoreReturnsCopy(t *testing.T) {
+	checkGetSessionReturnsCopy(t, CreateMemorySessionStore())
+}
+
+func TestMemorySessionStoreSaveReplacesTokenIndexes(t *testing.T) {
+	checkSaveReplacesTokenIndexes(t, CreateMemorySessionStore())
+}
+
+func TestMemorySessionStoreGetSessionByTokenFailsInvalidToken(t *testing.T) {
+	checkGetSessionByInvalidToken(t, CreateMemorySessionStore())
+}
+
+func TestMemorySessionStoreDeleteSessionSuccessfully(t *testing.T) {
+	checkDeleteSession(t, CreateMemorySessionStore())
+}
+
+func TestMemorySessionStoreMultipleUserSessions(t *testing.T) {
+	checkMultipleUserSessions(t, CreateMemorySessionStore())
+}
+
+func TestMemorySessionStoreRealmSessions(t *testing.T) {
+	checkRealmSessions(t, CreateMemorySessionStore())
+}
+
+func TestMemorySessionStoreRemembersUsedRefreshTokens(t *testing.T) {
+	checkUsedRefreshTokens(t, CreateMemorySessionStore())
+}
+
+func TestMemorySessionStoreDeleteExpiredSessions(t *testing.T) {
+	store := CreateMemorySessionStore()
+	activeSession := createTestSession(uuid.New())
+	err := store.Save(context.Background(), testRealm, &activeSession)
+	assert.NoError(t, err)
+	expiredSession := createExpiredTestSession(activeSession.UserId)
+	err = store.Save(context.Background(), testRealm, &expiredSession)
+	assert.NoError(t, err)
+	// session with expired access token but with active refresh token is not expired
+	refreshableSession := createTestSession(uuid.New())
+	refreshableSession.Expired = time.Now().Add(-time.Second)
+	err = store.Save(context.Background(), "other_realm", &refreshableSession)
+	assert.NoError(t, err)
+
+	removed, err := store.DeleteExpired(context.Background(), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	_, err = store.Get(context.Background(), testRealm, expiredSession.Id)
+	checkNotFound(t, err)
+	_, err = store.GetByAccessToken(context.Background(), testRealm, expiredSession.JwtAccessToken)
+	checkNotFound(t, err)
+	userSessions, err := store.GetUserSessions(context.Background(), testRealm, activeSession.UserId)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(userSessions))
+	checkSession(t, &activeSession, &userSessions[0])
+	_, err = store.Get(context.Background(), "other_realm", refreshableSession.Id)
+	assert.NoError(t, err)
+}
+
+// TestMemorySessionStoreConcurrentAccess is intended to be run with -race flag
+func TestMemorySessionStoreConcurrentAccess(t *testing.T) {
+	checkConcurrentSessionsAccess(t, CreateMemorySessionStore())
+}
+
+func TestMemorySessionStoreConcurrentRotations(t *testing.T) {
+	checkConcurrentRotations(t, CreateMemorySessionStore())
+}
+
+func TestMemorySessionStoreConcurrentRefreshes(t *testing.T) {
+	checkConcurrentSessionRefreshes(t, CreateMemorySessionStore())
+}
+
+func BenchmarkMemorySessionStoreGetSessionByAccessToken(b *testing.B) {
+	store := CreateMemorySessionStore()
+	sessionsNumber := 100000
+	tokens := make([]string, sessionsNumber)
+	for i := 0; i < sessionsNumber; i++ {
+		session := createTestSession(uuid.New())
+		err := store.Save(context.Background(), testRealm, &session)
+		require.NoError(b, err)
+		tokens[i] = session.JwtAccessToken
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			_, _ = store.GetByAccessToken(context.Background(), testRealm, tokens[i%sessionsNumber])
+			i++
+		}
+	})
+}
+
+func checkSaveAndGetSession(t *testing.T, store SessionStore) {
+	session := createTestSession(uuid.New())
+	err := store.Save(context.Background(), testRealm, &session)
+	assert.NoError(t, err)
+
+	s, err := store.Get(context.Background(), testRealm, session.Id)
+	assert.NoError(t, err)
+	checkSession(t, &session, s)
+	userSessions, err := store.GetUserSessions(context.Background(), testRealm, session.UserId)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(userSessions))
+	checkSession(t, &session, &userSessions[0])
+	s, err = store.GetByAccessToken(context.Background(), testRealm, session.JwtAccessToken)
+	assert.NoError(t, err)
+	checkSession(t, &session, s)
+	s, err = store.GetByRefreshToken(context.Background(), testRealm, session.JwtRefreshToken)
+	assert.NoError(t, err)
+	checkSession(t, &session, s)
+	// sessions are isolated by realm
+	_, err = store.Get(context.Background(), "other_realm", session.Id)
+	checkNotFound(t, err)
+	_, err = store.GetByAccessToken(context.Background(), "other_realm", session.JwtAccessToken)
+	checkNotFound(t, err)
+}
+
+func checkGetSessionReturnsCopy(t *testing.T, store SessionStore) {
+	session := createTestSession(uuid.New())
+	err := store.Save(context.Background(), testRealm, &session)
+	assert.NoError(t, err)
+
+	s, err := store.Get(context.Background(), testRealm, session.Id)
+	assert.NoError(t, err)
+	s.JwtAccessToken = "modified"
+	s, err = store.Get(context.Background(), testRealm, session.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, session.JwtAccessToken, s.JwtAccessToken)
+}
+
+func checkSaveReplacesTokenIndexes(t *testing.T, store SessionStore) {
+	session := createTestSession(uuid.New())
+	err := store.Save(context.Background(), testRealm, &session)
+	assert.NoError(t, err)
+	oldAccessToken := session.JwtAccessToken
+	oldRefreshToken := session.JwtRefreshToken
+
+	session.JwtAccessToken = createTestToken(uuid.New())
+	session.JwtRefreshToken = createTestToken(uuid.New())
+	err = store.Save(context.Background(), testRealm, &session)
+	assert.NoError(t, err)
+
+	_, err = store.GetByAccessToken(context.Background(), testRealm, oldAccessToken)
+	checkNotFound(t, err)
+	_, err = store.GetByRefreshToken(context.Background(), testRealm, oldRefreshToken)
+	checkNotFound(t, err)
+	_, err = store.GetByAccessToken(context.Background(), testRealm, session.JwtAccessToken)
+	assert.NoError(t, err)
+	_, err = store.GetByRefreshToken(context.Background(), testRealm, session.JwtRefreshToken)
+	assert.NoError(t, err)
+}
+
+func checkGetSessionByInvalidToken(t *testing.T, store SessionStore) {
+	testCases := []struct {
+		name  string
+		token string
+	}{
+		{name: "empty_token", token: ""},
+		{name: "malformed_token", token: "not.a.jwt"},
+		{name: "unknown_token", token: createTestToken(uuid.New())},
+	}
+
+	session := createTestSession(uuid.New())
+	err := store.Save(context.Background(), testRealm, &session)
+	assert.NoError(t, err)
+	for _, tCase := range testCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			_, err := store.GetByAccessToken(context.Background(), testRealm, tCase.token)
+			checkNotFound(t, err)
+			_, err = store.GetByRefreshToken(context.Background(), testRealm, tCase.token)
+			checkNotFound(t, err)
+		})
+	}
+}
+
+func checkDeleteSession(t *testing.T, store SessionStore) {
+	session := createTestSession(uuid.New())
+	err := store.Save(context.Background(), testRealm, &session)
+	assert.NoError(t, err)
+
+	err = store.Delete(context.Background(), testRealm, session.Id)
+	assert.NoError(t, err)
+	_, err = store.Get(context.Background(), testRealm, session.Id)
+	checkNotFound(t, err)
+	userSessions, err := store.GetUserSessions(context.Background(), testRealm, session.UserId)
+	assert.NoError(t, err)
+	assert.Empty(t, userSessions)
+	_, err = store.GetByAccessToken(context.Background(), testRealm, session.JwtAccessToken)
+	checkNotFound(t, err)
+	_, err = store.GetByRefreshToken(context.Background(), testRealm, session.JwtRefreshToken)
+	checkNotFound(t, err)
+	err = store.Delete(context.Background(), testRealm, session.Id)
+	checkNotFound(t, err)
+}
+
+func checkMultipleUserSessions(t *testing.T, store SessionStore) {
+	userId := uuid.New()
+	started := time.Now()
+	sessionsNumber := 3
+	userSessions := make([]data.UserSession, sessionsNumber)
+	// saving in reverse order to check that sessions are ordered by start time
+	for i := sessionsNumber - 1; i >= 0; i-- {
+		userSessions[i] = createTestSession(userId)
+		userSessions[i].Started = started.Add(time.Second * time.Duration(i))
+		userSessions[i].ClientId = sf.Format("client_{0}", i)
+		err := store.Save(context.Background(), testRealm, &userSessions[i])
+		assert.NoError(t, err)
+	}
+
+	actualSessions, err := store.GetUserSessions(context.Background(), testRealm, userId)
+	assert.NoError(t, err)
+	assert.Equal(t, sessionsNumber, len(actualSessions))
+	for i := range actualSessions {
+		checkSession(t, &userSessions[i], &actualSessions[i])
+		assert.Equal(t, userSessions[i].ClientId, actualSessions[i].ClientId)
+	}
+	// every session keeps its own tokens
+	for i := range userSessions {
+		s, err := store.GetByAccessToken(context.Background(), testRealm, userSessions[i].JwtAccessToken)
+		assert.NoError(t, err)
+		checkSession(t, &userSessions[i], s)
+	}
+
+	err = store.Delete(context.Background(), testRealm, userSessions[1].Id)
+	assert.NoError(t, err)
+	actualSessions, err = store.GetUserSessions(context.Background(), testRealm, userId)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(actualSessions))
+	checkSession(t, &userSessions[0], &actualSessions[0])
+	checkSession(t, &userSessions[2], &actualSessions[1])
+}
+
+func checkRealmSessions(t *testing.T, store SessionStore) {
+	realm := sf.Format("realm_{0}", uuid.New().String())
+	started := time.Now()
+	sessionsNumber := 3
+	realmSessions := make([]data.UserSession, sessionsNumber)
+	// sessions of different users, saving in reverse order to check that sessions are ordered by start time
+	for i := sessionsNumber - 1; i >= 0; i-- {
+		realmSessions[i] = createTestSession(uuid.New())
+		realmSessions[i].Started = started.Add(time.Second * time.Duration(i))
+		err := store.Save(context.Background(), realm, &realmSessions[i])
+		assert.NoError(t, err)
+	}
+	// session of other realm must not be listed
+	otherRealmSession := createTestSession(realmSessions[0].UserId)
+	err := store.Save(context.Background(), testRealm, &otherRealmSession)
+	assert.NoError(t, err)
+
+	actualSessions, err := store.GetRealmSessions(context.Background(), realm)
+	assert.NoError(t, err)
+	assert.Equal(t, sessionsNumber, len(actualSessions))
+	for i := range actualSessions {
+		checkSession(t, &realmSessions[i], &actualSessions[i])
+	}
+
+	err = store.Delete(context.Background(), realm, realmSessions[0].Id)
+	assert.NoError(t, err)
+	actualSessions, err = store.GetRealmSessions(context.Background(), realm)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(actualSessions))
+	checkSession(t, &realmSessions[1], &actualSessions[0])
+	checkSession(t, &realmSessions[2], &actualSessions[1])
+
+	actualSessions, err = store.GetRealmSessions(context.Background(), "unknown_realm")
+	assert.NoError(t, err)
+	assert.Empty(t, actualSessions)
+}
+
+func checkUsedRefreshTokens(t *testing.T, store SessionStore) {
+	session := createTestSession(uuid.New())
+	err := store.Save(context.Background(), testRealm, &session)
+	assert.NoError(t, err)
+	firstRefreshToken := session.JwtRefreshToken
+	_, err = store.GetByUsedRefreshToken(context.Background(), testRealm, firstRefreshToken)
+	checkNotFound(t, err)
+
+	// 1. Rotated refresh token is remembered as used
+	session.JwtRefreshToken = createTestToken(uuid.New())
+	err = store.Save(context.Background(), testRealm, &session)
+	assert.NoError(t, err)
+	secondRefreshToken := session.JwtRefreshToken
+	s, err := store.GetByUsedRefreshToken(context.Background(), testRealm, firstRefreshToken)
+	assert.NoError(t, err)
+	checkSession(t, &session, s)
+	_, err = store.GetByUsedRefreshToken(context.Background(), testRealm, secondRefreshToken)
+	checkNotFound(t, err)
+
+	// 2. Save without refresh token change doesn't mark it as used, previously used tokens are kept
+	session.Expired = session.Expired.Add(time.Second)
+	err = store.Save(context.Background(), testRealm, &session)
+	assert.NoError(t, err)
+	_, err = store.GetByUsedRefreshToken(context.Background(), testRealm, secondRefreshToken)
+	checkNotFound(t, err)
+	session.JwtRefreshToken = createTestToken(uuid.New())
+	err = store.Save(context.Background(), testRealm, &session)
+	assert.NoError(t, err)
+	for _, token := range []string{firstRefreshToken, secondRefreshToken} {
+		s, err = store.GetByUsedRefreshToken(context.Background(), testRealm, token)
+		assert.NoError(t, err)
+		checkSession(t, &session, s)
+	}
+
+	// 3. Used tokens are forgotten with session
+	err = store.Delete(context.Background(), testRealm, session.Id)
+	assert.NoError(t, err)
+	for _, token := range []string{firstRefreshToken, secondRefreshToken} {
+		_, err = store.GetByUsedRefreshToken(context.Background(), testRealm, token)
+		checkNotFound(t, err)
+	}
+}
+
+func checkConcurrentSessionsAccess(t *testing.T, store SessionStore) {
+	workers := 16
+	iterations := 100
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			userId := uuid.New()
+			for i := 0; i < iterations; i++ {
+				session := createTestSession(userId)
+				assert.NoError(t, store.Save(context.Background(), testRealm, &session))
+				_, err := store.GetByAccessToken(context.Background(), testRealm, session.JwtAccessToken)
+				assert.NoError(t, err)
+				userSessions, err := store.GetUserSessions(context.Background(), testRealm, userId)
+				assert.NoError(t, err)
+				assert.Equal(t, 1, len(userSessions))
+				_, err = store.GetByRefreshToken(context.Background(), testRealm, session.JwtRefreshToken)
+				assert.NoError(t, err)
+				assert.NoError(t, store.Delete(context.Background(), testRealm, session.Id))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// checkConcurrentSessionRefreshes checks that concurrent refreshes of the same session don't lose used refresh tokens
+func checkConcurrentSessionRefreshes(t *testing.T, store SessionStore) {
+	session := createTestSession(uuid.New())
+	require.NoError(t, store.Save(context.Background(), testRealm, &session))
+	refreshTokens := []string{session.JwtRefreshToken}
+	workers := 8
+	for w := 0; w < workers; w++ {
+		refreshTokens = append(refreshTokens, createTestToken(uuid.New()))
+	}
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 1; w <= workers; w++ {
+		refreshedSession := session
+		refreshedSession.JwtRefreshToken = refreshTokens[w]
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, store.Save(context.Background(), testRealm, &refreshedSession))
+		}()
+	}
+	wg.Wait()
+
+	current, err := store.Get(context.Background(), testRealm, session.Id)
+	require.NoError(t, err)
+	for _, token := range refreshTokens {
+		if token == current.JwtRefreshToken {
+			continue
+		}
+		_, err = store.GetByUsedRefreshToken(context.Background(), testRealm, token)
+		assert.NoError(t, err)
+	}
+}
+
+func checkConcurrentRotations(t *testing.T, store SessionStore) {
+	session := createTestSession(uuid.New())
+	require.NoError(t, store.Save(context.Background(), testRealm, &session))
+	workers := 8
+	refreshTokens := make([]string, workers)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		refreshTokens[w] = createTestToken(uuid.New())
+		refreshedSession := session
+		refreshedSession.JwtRefreshToken = refreshTokens[w]
+		go func(w int) {
+			defer wg.Done()
+			errs[w] = store.Rotate(context.Background(), testRealm, session.JwtRefreshToken, &refreshedSession)
+		}(w)
+	}
+	wg.Wait()
+
+	// only one of refreshes with the same refresh token replaces it
+	winner := -1
+	for w, err := range errs {
+		if err == nil {
+			assert.Equal(t, -1, winner, "refresh token was replaced twice")
+			winner = w
+			continue
+		}
+		assert.ErrorIs(t, err, ErrRefreshTokenReplaced)
+	}
+	require.NotEqual(t, -1, winner)
+	current, err := store.Get(context.Background(), testRealm, session.Id)
+	require.NoError(t, err)
+	assert.Equal(t, refreshTokens[winner], current.JwtRefreshToken)
+	usedSession, err := store.GetByUsedRefreshToken(context.Background(), testRealm, session.JwtRefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, session.Id, usedSession.Id)
+
+	unknownSession := createTestSession(session.UserId)
+	err = store.Rotate(context.Background(), testRealm, unknownSession.JwtRefreshToken, &unknownSession)
+	assert.True(t, isNotFound(err))
+	require.NoError(t, store.Delete(context.Background(), testRealm, session.Id))
+}
+
+func createTestSession(userId uuid.UUID) data.UserSession {
+	started := time.Now()
+	return data.UserSession{
+		Id: uuid.New(), UserId: userId, Started: started,
+		Expired:         started.Add(time.Minute),
+		RefreshExpired:  started.Add(time.Minute * 2),
+		JwtAccessToken:  createTestToken(uuid.New()),
+		JwtRefreshToken: createTestToken(uuid.New()),
+	}
+}
+
+func createExpiredTestSession(userId uuid.UUID) data.UserSession {
+	session := createTestSession(userId)
+	session.Started = time.Now().Add(-time.Minute * 3)
+	session.Expired = session.Started.Add(time.Minute)
+	session.RefreshExpired = session.Started.Add(time.Minute * 2)
+	return session
+}
+
+// createTestToken creates JWT-like token, signature isn't checked by store, therefore it is just a stub
+func createTestToken(jti uuid.UUID) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(sf.Format(`{"jti":"{0}"}`, jti.String())))
+	return sf.Format("{0}.{1}.signature", header, payload)
+}
+
+func checkNotFound(t *testing.T, err error) {
+	assert.Error(t, err)
+	assert.True(t, isNotFound(err))
+}
+
+func checkSession(t *testing.T, expected *data.UserSession, actual *data.UserSession) {
+	require.NotNil(t, actual)
+	assert.Equal(t, expected.Id, actual.Id)
+	assert.Equal(t, expected.UserId, actual.UserId)
+	assert.Equal(t, expected.JwtAccessToken, actual.JwtAccessToken)
+	assert.Equal(t, expected.JwtRefreshToken, actual.JwtRefreshToken)
+	assert.True(t, expected.Expired.Equal(actual.Expired))
+	assert.True(t, expected.RefreshExpired.Equal(actual.RefreshExpired))
+}
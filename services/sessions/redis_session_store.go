@@ -0,0 +1,373 @@
+package sessions
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/wissance/Ferrum/config"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/logging"
+	redisManager "github.com/wissance/Ferrum/managers/redis"
+	sf "github.com/wissance/stringFormatter"
+)
+
+// This set of const of a templates to all session data storing in Redis, {0} is a namespace, {1} is a realm name
+const (
+	sessionKeyTemplate             = "{0}.realm_{1}_session_{2}"
+	userSessionsKeyTemplate        = "{0}.realm_{1}_user_{2}_sessions"
+	realmSessionsKeyTemplate       = "{0}.realm_{1}_sessions"
+	accessTokenSessionKeyTemplate  = "{0}.realm_{1}_access_token_{2}_session"
+	refreshTokenSessionKeyTemplate = "{0}.realm_{1}_refresh_token_{2}_session"
+	usedTokenSessionKeyTemplate    = "{0}.realm_{1}_used_token_{2}_session"
+)
+
+// redisSessionRecord is a value stored by sessionKeyTemplate key
+type redisSessionRecord struct {
+	Session           data.UserSession `json:"session"`
+	AccessJti         uuid.UUID        `json:"access_jti"`
+	RefreshJti        uuid.UUID        `json:"refresh_jti"`
+	UsedRefreshTokens []string         `json:"used_refresh_tokens,omitempty"`
+}
+
+// RedisSessionStore is a SessionStore that keeps sessions in Redis, therefore sessions survive restarts and are shared between instances
+/* Store rules (namespace is the same as RedisDataManager uses):
+ * 1. Every session stores by its own key (sessionKeyTemplate) i.e. fe.realm_wissance_session_{session_id} together with
+ *    identifiers (jti) of assigned tokens
+ * 2. User and realm indexes are sets of sessions ids (userSessionsKeyTemplate, realmSessionsKeyTemplate), token indexes are string keys that contain
+ *    session id (accessTokenSessionKeyTemplate, refreshTokenSessionKeyTemplate), hashes of replaced (used) refresh tokens
+ *    are also string keys that contain session id (usedTokenSessionKeyTemplate)
+ * 3. Session and token index keys have TTL equal to session refresh expiration (or access expiration if it is later),
+ *    so Redis removes expired sessions itself. User and realm indexes TTL is extended to the latest session TTL, ids of
+ *    expired sessions are removed from indexes on GetUserSessions and GetRealmSessions
+ * Session and its indexes are written in a MULTI/EXEC transaction, session key is watched (WATCH) from reading of previous
+ * session state to transaction execution, therefore concurrent changes of the same session (i.e. two refreshes) are not lost.
+ * Rotate compares refresh token of previous session state in the same transaction.
+ */
+type RedisSessionStore struct {
+	namespace        string
+	redisClient      redis.UniversalClient
+	address          string
+	logger           *logging.AppLogger
+	ctx              context.Context
+	operationTimeout time.Duration
+}
+
+// CreateRedisSessionStore creates RedisSessionStore that keeps sessions in the same Redis as data store
+/* Parameters:
+ *     - redisClient - client of RedisDataManager (see redisManager.ClientProvider), store doesn't open own connections pool
+ *     - dataSourceCfg - data source config (must be config.REDIS), namespace, address and operation timeout are taken from it
+ *     - logger - logger instance
+ * Returns: new instance of RedisSessionStore
+ */
+func CreateRedisSessionStore(redisClient redis.UniversalClient, dataSourceCfg *config.DataSourceConfig, logger *logging.AppLogger) *RedisSessionStore {
+	return &RedisSessionStore{
+		namespace: redisManager.GetNamespace(dataSourceCfg), redisClient: redisClient, logger: logger,
+		address: redisManager.GetRedisAddress(dataSourceCfg), ctx: context.Background(), operationTimeout: dataSourceCfg.GetOperationTimeout(),
+	}
+}
+
+// withOperationContext returns copy of store that executes all Redis commands of one operation with ctx limited by
+// operationTimeout (config.DataOperationTimeout), store itself is never changed
+func (store *RedisSessionStore) withOperationContext(ctx context.Context) (*RedisSessionStore, context.CancelFunc) {
+	operationStore := *store
+	var cancel context.CancelFunc
+	if store.operationTimeout > 0 {
+		operationStore.ctx, cancel = context.WithTimeout(ctx, store.operationTimeout)
+	} else {
+		operationStore.ctx, cancel = context.WithCancel(ctx)
+	}
+	return &operationStore, cancel
+}
+
+// Save adds new or replaces existing (by session.Id) session
+/* This function writes session and all its indexes in a one transaction, indexes of previously assigned tokens are removed
+ * Parameters:
+ *    - realm - name of a realm
+ *    - session - session to save
+ * Returns error
+ */
+func (store *RedisSessionStore) Save(ctx context.Context, realm string, session *data.UserSession) error {
+	store, cancel := store.withOperationContext(ctx)
+	defer cancel()
+	return store.save(realm, session, nil, "RedisSessionStore.Save")
+}
+
+// Rotate replaces existing session if it has refresh token = expectedRefreshToken
+/* Refresh token of stored session is compared inside transaction that watches session key, therefore session could not be
+ * changed between comparison and writing
+ * Parameters:
+ *    - realm - name of a realm
+ *    - expectedRefreshToken - refresh token that stored session must have (refresh token that session was read with)
+ *    - session - new session state
+ * Returns error: errors.ObjectNotFoundError if session doesn't exist, ErrRefreshTokenReplaced if session has other refresh token
+ */
+func (store *RedisSessionStore) Rotate(ctx context.Context, realm string, expectedRefreshToken string, session *data.UserSession) error {
+	store, cancel := store.withOperationContext(ctx)
+	defer cancel()
+	return store.save(realm, session, &expectedRefreshToken, "RedisSessionStore.Rotate")
+}
+
+// save writes session with its indexes in a transaction, if expectedRefreshToken is not nil session is written only if it
+// exists and has such refresh token
+func (store *RedisSessionStore) save(realm string, session *data.UserSession, expectedRefreshToken *string, method string) error {
+	record := redisSessionRecord{
+		Session: *session, AccessJti: getTokenId(session.JwtAccessToken), RefreshJti: getTokenId(session.JwtRefreshToken),
+	}
+	ttl := getSessionTtl(session)
+	sessionId := session.Id.String()
+	sessionKey := sf.Format(sessionKeyTemplate, store.namespace, realm, sessionId)
+	return redisManager.ExecuteTransaction(store.ctx, store.redisClient, store.address, store.logger, method, func(tx *redis.Tx, pipe redis.Pipeliner) error {
+		// previous state is read after session key is watched, transaction is repeated if session was changed concurrently
+		oldRecord, err := store.readRecord(tx, realm, session.Id)
+		if err != nil && (expectedRefreshToken != nil || !isNotFound(err)) {
+			return err
+		}
+		if expectedRefreshToken != nil && oldRecord.Session.JwtRefreshToken != *expectedRefreshToken {
+			return ErrRefreshTokenReplaced
+		}
+		record.UsedRefreshTokens = nil
+		if oldRecord != nil {
+			record.UsedRefreshTokens = oldRecord.UsedRefreshTokens
+			oldRefreshToken := oldRecord.Session.JwtRefreshToken
+			if len(oldRefreshToken) > 0 && oldRefreshToken != session.JwtRefreshToken {
+				record.UsedRefreshTokens = append(record.UsedRefreshTokens, GetTokenHash(oldRefreshToken))
+			}
+		}
+		recordBytes, err := json.Marshal(record)
+		if err != nil {
+			return appErrs.NewUnknownError("json.Marshal", "RedisSessionStore.Save", err)
+		}
+
+		pipe.Set(store.ctx, sessionKey, string(recordBytes), ttl)
+		userSessionsKey := sf.Format(userSessionsKeyTemplate, store.namespace, realm, session.UserId.String())
+		pipe.SAdd(store.ctx, userSessionsKey, sessionId)
+		// new set hasn't TTL, for existing set TTL could be only extended
+		redisManager.ExtendTtl(store.ctx, pipe, userSessionsKey, ttl)
+		realmSessionsKey := sf.Format(realmSessionsKeyTemplate, store.namespace, realm)
+		pipe.SAdd(store.ctx, realmSessionsKey, sessionId)
+		redisManager.ExtendTtl(store.ctx, pipe, realmSessionsKey, ttl)
+		if oldRecord != nil {
+			if oldRecord.AccessJti != uuid.Nil && oldRecord.AccessJti != record.AccessJti {
+				pipe.Del(store.ctx, sf.Format(accessTokenSessionKeyTemplate, store.namespace, realm, oldRecord.AccessJti.String()))
+			}
+			if oldRecord.RefreshJti != uuid.Nil && oldRecord.RefreshJti != record.RefreshJti {
+				pipe.Del(store.ctx, sf.Format(refreshTokenSessionKeyTemplate, store.namespace, realm, oldRecord.RefreshJti.String()))
+			}
+		}
+		if record.AccessJti != uuid.Nil {
+			pipe.Set(store.ctx, sf.Format(accessTokenSessionKeyTemplate, store.namespace, realm, record.AccessJti.String()), sessionId, ttl)
+		}
+		if record.RefreshJti != uuid.Nil {
+			pipe.Set(store.ctx, sf.Format(refreshTokenSessionKeyTemplate, store.namespace, realm, record.RefreshJti.String()), sessionId, ttl)
+		}
+		// used tokens are remembered as long as session lives
+		for _, tokenHash := range record.UsedRefreshTokens {
+			pipe.Set(store.ctx, sf.Format(usedTokenSessionKeyTemplate, store.namespace, realm, tokenHash), sessionId, ttl)
+		}
+		return nil
+	}, sessionKey)
+}
+
+// Get returns session by session id
+func (store *RedisSessionStore) Get(ctx context.Context, realm string, sessionId uuid.UUID) (*data.UserSession, error) {
+	store, cancel := store.withOperationContext(ctx)
+	defer cancel()
+	record, err := store.getRecord(realm, sessionId)
+	if err != nil {
+		return nil, err
+	}
+	return &record.Session, nil
+}
+
+// GetUserSessions returns all user sessions ordered by start time, ids of expired sessions are removed from user index
+func (store *RedisSessionStore) GetUserSessions(ctx context.Context, realm string, userId uuid.UUID) ([]data.UserSession, error) {
+	store, cancel := store.withOperationContext(ctx)
+	defer cancel()
+	userSessionsKey := sf.Format(userSessionsKeyTemplate, store.namespace, realm, userId.String())
+	return store.getIndexedSessions(realm, userSessionsKey, "RedisSessionStore.GetUserSessions")
+}
+
+// GetRealmSessions returns all realm sessions ordered by start time, ids of expired sessions are removed from realm index
+func (store *RedisSessionStore) GetRealmSessions(ctx context.Context, realm string) ([]data.UserSession, error) {
+	store, cancel := store.withOperationContext(ctx)
+	defer cancel()
+	realmSessionsKey := sf.Format(realmSessionsKeyTemplate, store.namespace, realm)
+	return store.getIndexedSessions(realm, realmSessionsKey, "RedisSessionStore.GetRealmSessions")
+}
+
+// GetByAccessToken returns session that has such access token, searching by access token identifier (jti) index key
+func (store *RedisSessionStore) GetByAccessToken(ctx context.Context, realm string, token string) (*data.UserSession, error) {
+	store, cancel := store.withOperationContext(ctx)
+	defer cancel()
+	session, err := store.getByToken(realm, token, accessTokenSessionKeyTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if session.JwtAccessToken != token {
+		return nil, appErrs.NewObjectNotFoundError(sessionObjectType, session.Id.String(), sessionIdDetails(realm))
+	}
+	return session, nil
+}
+
+// GetByRefreshToken returns session that has such refresh token, searching by refresh token identifier (jti) index key
+func (store *RedisSessionStore) GetByRefreshToken(ctx context.Context, realm string, token string) (*data.UserSession, error) {
+	store, cancel := store.withOperationContext(ctx)
+	defer cancel()
+	session, err := store.getByToken(realm, token, refreshTokenSessionKeyTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if session.JwtRefreshToken != token {
+		return nil, appErrs.NewObjectNotFoundError(sessionObjectType, session.Id.String(), sessionIdDetails(realm))
+	}
+	return session, nil
+}
+
+// GetByUsedRefreshToken returns session that refresh token was issued by before it was replaced, searching by token hash index key
+func (store *RedisSessionStore) GetByUsedRefreshToken(ctx context.Context, realm string, token string) (*data.UserSession, error) {
+	store, cancel := store.withOperationContext(ctx)
+	defer cancel()
+	sessionId, err := store.getIndexValue(sf.Format(usedTokenSessionKeyTemplate, store.namespace, realm, GetTokenHash(token)), realm)
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(store.ctx, realm, sessionId)
+}
+
+// Delete removes session and all its index keys in a one transaction (session key is watched as in Save)
+func (store *RedisSessionStore) Delete(ctx context.Context, realm string, sessionId uuid.UUID) error {
+	store, cancel := store.withOperationContext(ctx)
+	defer cancel()
+	sessionKey := sf.Format(sessionKeyTemplate, store.namespace, realm, sessionId.String())
+	return redisManager.ExecuteTransaction(store.ctx, store.redisClient, store.address, store.logger, "RedisSessionStore.Delete", func(tx *redis.Tx, pipe redis.Pipeliner) error {
+		record, err := store.readRecord(tx, realm, sessionId)
+		if err != nil {
+			return err
+		}
+		pipe.Del(store.ctx, sessionKey)
+		pipe.SRem(store.ctx, sf.Format(userSessionsKeyTemplate, store.namespace, realm, record.Session.UserId.String()), sessionId.String())
+		pipe.SRem(store.ctx, sf.Format(realmSessionsKeyTemplate, store.namespace, realm), sessionId.String())
+		if record.AccessJti != uuid.Nil {
+			pipe.Del(store.ctx, sf.Format(accessTokenSessionKeyTemplate, store.namespace, realm, record.AccessJti.String()))
+		}
+		if record.RefreshJti != uuid.Nil {
+			pipe.Del(store.ctx, sf.Format(refreshTokenSessionKeyTemplate, store.namespace, realm, record.RefreshJti.String()))
+		}
+		for _, tokenHash := range record.UsedRefreshTokens {
+			pipe.Del(store.ctx, sf.Format(usedTokenSessionKeyTemplate, store.namespace, realm, tokenHash))
+		}
+		return nil
+	}, sessionKey)
+}
+
+// DeleteExpired doesn't do anything because Redis removes expired session keys itself (all keys have TTL),
+// ids of expired sessions are removed from user index sets on GetUserSessions
+func (store *RedisSessionStore) DeleteExpired(ctx context.Context, current time.Time) (int, error) {
+	return 0, nil
+}
+
+func (store *RedisSessionStore) getByToken(realm string, token string, indexKeyTemplate string) (*data.UserSession, error) {
+	jti := getTokenId(token)
+	if jti == uuid.Nil {
+		return nil, appErrs.NewObjectNotFoundError(sessionObjectType, jti.String(), sessionIdDetails(realm))
+	}
+	sessionId, err := store.getIndexValue(sf.Format(indexKeyTemplate, store.namespace, realm, jti.String()), realm)
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(store.ctx, realm, sessionId)
+}
+
+func (store *RedisSessionStore) getRecord(realm string, sessionId uuid.UUID) (*redisSessionRecord, error) {
+	return store.readRecord(store.redisClient, realm, sessionId)
+}
+
+// readRecord reads session record with reader (redis client or transaction that watches session key)
+func (store *RedisSessionStore) readRecord(reader redis.Cmdable, realm string, sessionId uuid.UUID) (*redisSessionRecord, error) {
+	sessionKey := sf.Format(sessionKeyTemplate, store.namespace, realm, sessionId.String())
+	redisCmd := reader.Get(store.ctx, sessionKey)
+	if redisCmd.Err() != nil {
+		if redisCmd.Err() == redis.Nil {
+			return nil, appErrs.NewObjectNotFoundError(sessionObjectType, sessionId.String(), sessionIdDetails(realm))
+		}
+		store.logger.Warn(sf.Format("An error occurred during fetching session: \"{0}\" from Redis server", sessionKey))
+		return nil, appErrs.NewUnknownError("Get", "RedisSessionStore.readRecord",
+			redisManager.GetRedisError(store.ctx, store.address, redisCmd.Err()))
+	}
+	var record redisSessionRecord
+	if err := json.Unmarshal([]byte(redisCmd.Val()), &record); err != nil {
+		store.logger.Error(sf.Format("An error occurred during unmarshall session: \"{0}\"", sessionKey))
+		return nil, appErrs.NewUnknownError("json.Unmarshal", "RedisSessionStore.getRecord", err)
+	}
+	return &record, nil
+}
+
+func (store *RedisSessionStore) getIndexValue(indexKey string, realm string) (uuid.UUID, error) {
+	redisCmd := store.redisClient.Get(store.ctx, indexKey)
+	if redisCmd.Err() != nil {
+		if redisCmd.Err() == redis.Nil {
+			return uuid.Nil, appErrs.NewObjectNotFoundError(sessionObjectType, indexKey, sessionIdDetails(realm))
+		}
+		store.logger.Warn(sf.Format("An error occurred during fetching session index: \"{0}\" from Redis server", indexKey))
+		return uuid.Nil, appErrs.NewUnknownError("Get", "RedisSessionStore.getIndexValue",
+			redisManager.GetRedisError(store.ctx, store.address, redisCmd.Err()))
+	}
+	sessionId, err := uuid.Parse(redisCmd.Val())
+	if err != nil {
+		return uuid.Nil, appErrs.NewUnknownError("uuid.Parse", "RedisSessionStore.getIndexValue", err)
+	}
+	return sessionId, nil
+}
+
+// getIndexedSessions returns sessions which ids are stored in index set with key = indexKey ordered by start time,
+// ids of expired sessions are removed from index set
+func (store *RedisSessionStore) getIndexedSessions(realm string, indexKey string, method string) ([]data.UserSession, error) {
+	redisCmd := store.redisClient.SMembers(store.ctx, indexKey)
+	if redisCmd.Err() != nil {
+		store.logger.Warn(sf.Format("An error occurred during fetching sessions index: \"{0}\" from Redis server", indexKey))
+		return nil, appErrs.NewUnknownError("SMembers", method, redisManager.GetRedisError(store.ctx, store.address, redisCmd.Err()))
+	}
+	result := make([]data.UserSession, 0, len(redisCmd.Val()))
+	var expiredSessions []interface{}
+	for _, member := range redisCmd.Val() {
+		sessionId, err := uuid.Parse(member)
+		if err != nil {
+			expiredSessions = append(expiredSessions, member)
+			continue
+		}
+		record, err := store.getRecord(realm, sessionId)
+		if err != nil {
+			if !isNotFound(err) {
+				return nil, err
+			}
+			expiredSessions = append(expiredSessions, member)
+			continue
+		}
+		result = append(result, record.Session)
+	}
+	if len(expiredSessions) > 0 {
+		if err := store.redisClient.SRem(store.ctx, indexKey, expiredSessions...).Err(); err != nil {
+			store.logger.Warn(sf.Format("An error occurred during removing expired sessions from index: \"{0}\"", indexKey))
+		}
+	}
+	sortSessionsByStart(result)
+	return result, nil
+}
+
+// getSessionTtl returns time to live of session keys: until refresh expiration or access expiration if it is later
+func getSessionTtl(session *data.UserSession) time.Duration {
+	expiration := session.RefreshExpired
+	if session.Expired.After(expiration) {
+		expiration = session.Expired
+	}
+	ttl := time.Until(expiration)
+	if ttl < time.Second {
+		// already expired session is kept for a moment to be reported as expired, not as unknown
+		ttl = time.Second
+	}
+	return ttl
+}
@@ -0,0 +1,110 @@
+package sessions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/wissance/Ferrum/config"
+	"github.com/wissance/Ferrum/logging"
+	redisManager "github.com/wissance/Ferrum/managers/redis"
+	sf "github.com/wissance/stringFormatter"
+)
+
+const (
+	testUser         = "ferrum_db"
+	testUserPassword = "FeRRuM000"
+	testRedisSource  = "127.0.0.1:6379"
+)
+
+func TestRedisSessionStoreSaveAndGetSessionSuccessfully(t *testing.T) {
+	checkSaveAndGetSession(t, createTestRedisSessionStore(t))
+}
+
+func TestRedisSessionStoreReturnsCopy(t *testing.T) {
+	checkGetSessionReturnsCopy(t, createTestRedisSessionStore(t))
+}
+
+func TestRedisSessionStoreSaveReplacesTokenIndexes(t *testing.T) {
+	checkSaveReplacesTokenIndexes(t, createTestRedisSessionStore(t))
+}
+
+func TestRedisSessionStoreGetSessionByTokenFailsInvalidToken(t *testing.T) {
+	checkGetSessionByInvalidToken(t, createTestRedisSessionStore(t))
+}
+
+func TestRedisSessionStoreDeleteSessionSuccessfully(t *testing.T) {
+	checkDeleteSession(t, createTestRedisSessionStore(t))
+}
+
+func TestRedisSessionStoreMultipleUserSessions(t *testing.T) {
+	checkMultipleUserSessions(t, createTestRedisSessionStore(t))
+}
+
+func TestRedisSessionStoreRealmSessions(t *testing.T) {
+	checkRealmSessions(t, createTestRedisSessionStore(t))
+}
+
+func TestRedisSessionStoreRemembersUsedRefreshTokens(t *testing.T) {
+	checkUsedRefreshTokens(t, createTestRedisSessionStore(t))
+}
+
+func TestRedisSessionStoreConcurrentAccess(t *testing.T) {
+	checkConcurrentSessionsAccess(t, createTestRedisSessionStore(t))
+}
+
+func TestRedisSessionStoreConcurrentRefreshes(t *testing.T) {
+	checkConcurrentSessionRefreshes(t, createTestRedisSessionStore(t))
+}
+
+func TestRedisSessionStoreConcurrentRotations(t *testing.T) {
+	checkConcurrentRotations(t, createTestRedisSessionStore(t))
+}
+
+func TestRedisSessionStoreSetsTtl(t *testing.T) {
+	store := createTestRedisSessionStore(t)
+	session := createTestSession(uuid.New())
+	err := store.Save(context.Background(), testRealm, &session)
+	assert.NoError(t, err)
+	sessionKey := sf.Format(sessionKeyTemplate, store.namespace, testRealm, session.Id.String())
+	ttl := store.redisClient.TTL(store.ctx, sessionKey).Val()
+	assert.True(t, ttl > time.Minute && ttl <= time.Minute*2)
+	userSessionsKey := sf.Format(userSessionsKeyTemplate, store.namespace, testRealm, session.UserId.String())
+	// user index TTL is extended by later session, but isn't reduced by earlier one
+	laterSession := createTestSession(session.UserId)
+	laterSession.RefreshExpired = laterSession.Started.Add(time.Minute * 5)
+	err = store.Save(context.Background(), testRealm, &laterSession)
+	assert.NoError(t, err)
+	err = store.Save(context.Background(), testRealm, &session)
+	assert.NoError(t, err)
+	ttl = store.redisClient.TTL(store.ctx, userSessionsKey).Val()
+	assert.True(t, ttl > time.Minute*4 && ttl <= time.Minute*5)
+	err = store.Delete(context.Background(), testRealm, laterSession.Id)
+	assert.NoError(t, err)
+	err = store.Delete(context.Background(), testRealm, session.Id)
+	assert.NoError(t, err)
+}
+
+func createTestRedisSessionStore(t *testing.T) *RedisSessionStore {
+	loggerCfg := config.LoggingConfig{}
+	logger := logging.CreateLogger(&loggerCfg)
+	dataSourceCfg := config.DataSourceConfig{
+		Type:   config.REDIS,
+		Source: testRedisSource,
+		Credentials: &config.CredentialsConfig{
+			Username: testUser,
+			Password: testUserPassword,
+		},
+		Options: map[config.DataSourceConnOption]string{
+			config.DbNumber:  "0",
+			config.Namespace: "ferrum_sessions_test",
+		},
+	}
+	redisClient, _ := redisManager.CreateRedisClient(&dataSourceCfg, logger)
+	t.Cleanup(func() {
+		_ = redisClient.Close()
+	})
+	return CreateRedisSessionStore(redisClient, &dataSourceCfg, logger)
+}
@@ -0,0 +1,88 @@
+package sessions
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/wissance/Ferrum/logging"
+	sf "github.com/wissance/stringFormatter"
+)
+
+// SessionJanitor is a background worker that periodically removes expired sessions from SessionStore
+/* Without janitor expired sessions of users that never log in again are kept in a store forever (i.e. MemorySessionStore
+ * grows for as long as the process runs). Janitor is started by Start and must be stopped by Stop, Start and Stop
+ * are safe to call several times.
+ */
+type SessionJanitor struct {
+	store    SessionStore
+	interval time.Duration
+	logger   *logging.AppLogger
+	mutex    sync.Mutex
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// CreateSessionJanitor creates SessionJanitor (not started) that sweeps store every interval
+func CreateSessionJanitor(store SessionStore, interval time.Duration, logger *logging.AppLogger) *SessionJanitor {
+	return &SessionJanitor{store: store, interval: interval, logger: logger}
+}
+
+// Start starts background sweeping, if janitor is already started function does nothing
+func (janitor *SessionJanitor) Start() {
+	janitor.mutex.Lock()
+	defer janitor.mutex.Unlock()
+
+	if janitor.stop != nil {
+		return
+	}
+	janitor.stop = make(chan struct{})
+	janitor.done = make(chan struct{})
+	go janitor.run(janitor.stop, janitor.done)
+	janitor.logger.Info(sf.Format("Expired sessions janitor started with interval: {0}", janitor.interval.String()))
+}
+
+// Stop stops background sweeping and waits until current sweep finishes, if janitor is not started function does nothing
+func (janitor *SessionJanitor) Stop() {
+	janitor.mutex.Lock()
+	defer janitor.mutex.Unlock()
+
+	if janitor.stop == nil {
+		return
+	}
+	close(janitor.stop)
+	<-janitor.done
+	janitor.stop = nil
+	janitor.done = nil
+	janitor.logger.Info("Expired sessions janitor stopped")
+}
+
+// Sweep removes expired sessions at once
+/* Parameters: no
+ * Returns number of removed sessions
+ */
+func (janitor *SessionJanitor) Sweep() int {
+	removed, err := janitor.store.DeleteExpired(context.Background(), time.Now())
+	if err != nil {
+		janitor.logger.Error(sf.Format("An error occurred during expired sessions removing: {0}", err.Error()))
+		return removed
+	}
+	if removed > 0 {
+		janitor.logger.Debug(sf.Format("Expired sessions janitor removed {0} sessions", removed))
+	}
+	return removed
+}
+
+func (janitor *SessionJanitor) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(janitor.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			janitor.Sweep()
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package sessions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/wissance/Ferrum/config"
+	"github.com/wissance/Ferrum/logging"
+)
+
+func TestSessionJanitorRemovesExpiredSessions(t *testing.T) {
+	store := CreateMemorySessionStore()
+	loggerCfg := config.LoggingConfig{}
+	logger := logging.CreateLogger(&loggerCfg)
+	janitor := CreateSessionJanitor(store, time.Millisecond*10, logger)
+
+	activeSession := createTestSession(uuid.New())
+	err := store.Save(context.Background(), testRealm, &activeSession)
+	assert.NoError(t, err)
+	expiredSession := createExpiredTestSession(uuid.New())
+	err = store.Save(context.Background(), testRealm, &expiredSession)
+	assert.NoError(t, err)
+
+	janitor.Start()
+	// second start does nothing
+	janitor.Start()
+	assert.Eventually(t, func() bool {
+		_, getErr := store.Get(context.Background(), testRealm, expiredSession.Id)
+		return getErr != nil
+	}, time.Second, time.Millisecond*10)
+	janitor.Stop()
+	// second stop does nothing
+	janitor.Stop()
+
+	_, err = store.Get(context.Background(), testRealm, activeSession.Id)
+	assert.NoError(t, err)
+	// stopped janitor doesn't sweep store
+	expiredSession = createExpiredTestSession(uuid.New())
+	err = store.Save(context.Background(), testRealm, &expiredSession)
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 50)
+	_, err = store.Get(context.Background(), testRealm, expiredSession.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, janitor.Sweep())
+}
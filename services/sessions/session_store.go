@@ -0,0 +1,105 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wissance/Ferrum/config"
+	"github.com/wissance/Ferrum/data"
+	appErrs "github.com/wissance/Ferrum/errors"
+	"github.com/wissance/Ferrum/logging"
+	"github.com/wissance/Ferrum/managers"
+	redisManager "github.com/wissance/Ferrum/managers/redis"
+	sf "github.com/wissance/stringFormatter"
+)
+
+const sessionObjectType = "session"
+
+// ErrRefreshTokenReplaced is returned by SessionStore.Rotate when session refresh token was already replaced (i.e. by a concurrent
+// refresh with the same refresh token)
+var ErrRefreshTokenReplaced = errors.New("session refresh token was already replaced")
+
+// SessionStore is an interface of users sessions storage, implementations MUST be safe for concurrent usage
+/* All Get methods return a copy of stored session, if session doesn't exist they return errors.ObjectNotFoundError,
+ * any other errors means that store is not accessible. Every operation receives context.Context (usually context of HTTP
+ * request), stores that access network cancel operation with it.
+ */
+type SessionStore interface {
+	// Save adds new or replaces existing (by session.Id) session and rebuilds session indexes (user id and tokens identifiers),
+	// replaced refresh token is remembered as used until session ends
+	Save(ctx context.Context, realm string, session *data.UserSession) error
+	// Rotate replaces existing session as Save does only if stored session has refresh token = expectedRefreshToken (compare and
+	// swap is atomic), otherwise it returns ErrRefreshTokenReplaced, therefore only one of concurrent refreshes with the same
+	// refresh token succeeds
+	Rotate(ctx context.Context, realm string, expectedRefreshToken string, session *data.UserSession) error
+	// Get returns session by session identifier
+	Get(ctx context.Context, realm string, sessionId uuid.UUID) (*data.UserSession, error)
+	// GetUserSessions returns all sessions of a user ordered by start time (the oldest first), user without sessions is not an error
+	GetUserSessions(ctx context.Context, realm string, userId uuid.UUID) ([]data.UserSession, error)
+	// GetRealmSessions returns all sessions of a realm ordered by start time (the oldest first), realm without sessions is not an error
+	GetRealmSessions(ctx context.Context, realm string) ([]data.UserSession, error)
+	// GetByAccessToken returns session that has such access token (JWT encoded)
+	GetByAccessToken(ctx context.Context, realm string, token string) (*data.UserSession, error)
+	// GetByRefreshToken returns session that has such refresh token (JWT encoded)
+	GetByRefreshToken(ctx context.Context, realm string, token string) (*data.UserSession, error)
+	// GetByUsedRefreshToken returns session that refresh token (JWT encoded) was issued by before it was replaced by a new one (rotated)
+	GetByUsedRefreshToken(ctx context.Context, realm string, token string) (*data.UserSession, error)
+	// Delete removes session with all its indexes
+	Delete(ctx context.Context, realm string, sessionId uuid.UUID) error
+	// DeleteExpired removes all sessions (of all realms) which access and refresh tokens are expired at current time,
+	// returns number of removed sessions
+	DeleteExpired(ctx context.Context, current time.Time) (int, error)
+}
+
+// CreateSessionStore is a factory function that creates SessionStore according to config
+/* If sessionStoreCfg type is config.RedisSessionStore function creates RedisSessionStore that shares Redis client of data store
+ * (dataSourceCfg must be config.REDIS), otherwise MemorySessionStore is creating
+ * Parameters:
+ *     - sessionStoreCfg - session store config section
+ *     - dataSourceCfg - data source config section
+ *     - dataContext - data store, Redis data store provides client for RedisSessionStore (see redisManager.ClientProvider)
+ *     - logger - logger instance
+ * Returns: new instance of SessionStore and error
+ */
+func CreateSessionStore(sessionStoreCfg *config.SessionStoreConfig, dataSourceCfg *config.DataSourceConfig,
+	dataContext managers.DataContext, logger *logging.AppLogger,
+) (SessionStore, error) {
+	if err := sessionStoreCfg.ValidateWithDataSource(dataSourceCfg); err != nil {
+		return nil, err
+	}
+	if sessionStoreCfg.Type == config.RedisSessionStore {
+		provider, ok := dataContext.(redisManager.ClientProvider)
+		if !ok || provider.GetRedisClient() == nil {
+			return nil, errors.New("sessions could be stored in Redis only if data store is Redis")
+		}
+		logger.Info("Users sessions are storing in Redis")
+		return CreateRedisSessionStore(provider.GetRedisClient(), dataSourceCfg, logger), nil
+	}
+	logger.Info("Users sessions are storing in memory")
+	return CreateMemorySessionStore(), nil
+}
+
+func sessionIdDetails(realm string) string {
+	return sf.Format("realm: {0}", realm)
+}
+
+// isNotFound checks that err is ObjectNotFoundError, local target is using because stores are accessed concurrently
+func isNotFound(err error) bool {
+	var notFoundErr appErrs.ObjectNotFoundError
+	return errors.As(err, &notFoundErr)
+}
+
+// sortSessionsByStart orders sessions by start time, the oldest first
+func sortSessionsByStart(userSessions []data.UserSession) {
+	sort.Slice(userSessions, func(i, j int) bool {
+		return userSessions[i].Started.Before(userSessions[j].Started)
+	})
+}
+
+// isSessionExpired checks that both session access and refresh tokens are expired at current time
+func isSessionExpired(session *data.UserSession, current time.Time) bool {
+	return session.Expired.Before(current) && session.RefreshExpired.Before(current)
+}
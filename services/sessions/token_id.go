@@ -0,0 +1,82 @@
+package sessions
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// tokenIdClaim is a part of JWT payload that contains token and session identifiers
+type tokenIdClaim struct {
+	JwtId     string `json:"jti"`
+	SessionId string `json:"sid"`
+}
+
+// getTokenId extracts token identifier (jti) from JWT encoded token
+/* This function doesn't validate token signature, token identifier is using only as index key, tokens itself must be
+ * compared after session was found.
+ * Parameters:
+ *    - token - JWT encoded token
+ * Returns: token identifier or uuid.Nil if token is empty or malformed
+ */
+func getTokenId(token string) uuid.UUID {
+	claim := getTokenIdClaim(token)
+	if claim == nil {
+		return uuid.Nil
+	}
+	jti, err := uuid.Parse(claim.JwtId)
+	if err != nil {
+		return uuid.Nil
+	}
+	return jti
+}
+
+// GetTokenSessionId extracts session identifier (sid) from JWT encoded token
+/* Like getTokenId this function doesn't validate token signature, session identifier could be used only for session search,
+ * token must be compared with session data after session was found (i.e. by GetTokenHash).
+ * Parameters:
+ *    - token - JWT encoded token
+ * Returns: session identifier or uuid.Nil if token is empty or malformed
+ */
+func GetTokenSessionId(token string) uuid.UUID {
+	claim := getTokenIdClaim(token)
+	if claim == nil {
+		return uuid.Nil
+	}
+	sid, err := uuid.Parse(claim.SessionId)
+	if err != nil {
+		return uuid.Nil
+	}
+	return sid
+}
+
+// getTokenIdClaim decodes JWT payload without signature validation, returns nil if token is empty or malformed
+func getTokenIdClaim(token string) *tokenIdClaim {
+	if len(token) == 0 {
+		return nil
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	var claim tokenIdClaim
+	if err = json.Unmarshal(payload, &claim); err != nil {
+		return nil
+	}
+	return &claim
+}
+
+// GetTokenHash returns hex encoded SHA-256 of a token, it is using for storing tokens that are not valid anymore (i.e. already
+// used refresh tokens or offline tokens in a data store) without tokens itself
+func GetTokenHash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
@@ -1,6 +1,9 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
+	e "errors"
 	"time"
 
 	sf "github.com/wissance/stringFormatter"
@@ -11,12 +14,13 @@ import (
 	"github.com/wissance/Ferrum/errors"
 	"github.com/wissance/Ferrum/logging"
 	"github.com/wissance/Ferrum/managers"
+	"github.com/wissance/Ferrum/services/sessions"
 )
 
 // TokenBasedSecurityService structure that implements SecurityService
 type TokenBasedSecurityService struct {
 	DataProvider *managers.DataContext
-	UserSessions map[string][]data.UserSession
+	sessions     sessions.SessionStore
 	logger       *logging.AppLogger
 }
 
@@ -24,11 +28,12 @@ type TokenBasedSecurityService struct {
 /* This function creates SecurityService based on dataProvider as managers.DataContext
  * Parameters:
  *    - dataProvider - any managers.DataContext implementation (config.FILE, config.REDIS)
+ *    - sessionStore - any sessions.SessionStore implementation (in memory or Redis)
  *    - logger - logger service
  * Returns instance of TokenBasedSecurityService as SecurityService
  */
-func CreateSecurityService(dataProvider *managers.DataContext, logger *logging.AppLogger) SecurityService {
-	pwdSecService := &TokenBasedSecurityService{DataProvider: dataProvider, UserSessions: map[string][]data.UserSession{}, logger: logger}
+func CreateSecurityService(dataProvider *managers.DataContext, sessionStore sessions.SessionStore, logger *logging.AppLogger) SecurityService {
+	pwdSecService := &TokenBasedSecurityService{DataProvider: dataProvider, sessions: sessionStore, logger: logger}
 	secService := SecurityService(pwdSecService)
 	return secService
 }
@@ -63,20 +68,30 @@ func (service *TokenBasedSecurityService) Validate(tokenIssueData *dto.TokenGene
 // CheckCredentials function that checks provided credentials (username and password)
 /* This function extracts data.User from DataProvider and also this function checks password from user credentials
  * Parameters:
+ *    - ctx - context of operation
  *    - tokenIssueData - issues token
  *    - realm - name of a data.Realm
- * Returns: nil if credentials are valid, otherwise error (data.OperationError) with description
+ * Returns: nil if credentials are valid, otherwise error (data.OperationError) with description (errors.ServiceIsUnavailable
+ * message if data store is not available)
  */
-func (service *TokenBasedSecurityService) CheckCredentials(tokenIssueData *dto.TokenGenerationData, realmName string) *data.OperationError {
-	user, _ := (*service.DataProvider).GetUser(realmName, tokenIssueData.Username)
+func (service *TokenBasedSecurityService) CheckCredentials(ctx context.Context, tokenIssueData *dto.TokenGenerationData, realmName string) *data.OperationError {
+	var notAvailableErr errors.DataProviderNotAvailable
+	user, err := (*service.DataProvider).GetUser(ctx, realmName, tokenIssueData.Username)
 	if user == nil {
+		if e.As(err, &notAvailableErr) {
+			service.logger.Warn("Credential check: data store is not available")
+			return &data.OperationError{Msg: errors.ServiceIsUnavailable}
+		}
 		service.logger.Trace("Credential check: username mismatch")
 		return &data.OperationError{Msg: errors.InvalidUserCredentialsMsg, Description: errors.InvalidUserCredentialsDesc}
 	}
 
-	realm, err := (*service.DataProvider).GetRealm(realmName)
+	realm, err := (*service.DataProvider).GetRealm(ctx, realmName)
 	if err != nil {
 		service.logger.Trace("Credential check: failed to get realm")
+		if e.As(err, &notAvailableErr) {
+			return &data.OperationError{Msg: errors.ServiceIsUnavailable}
+		}
 		return &data.OperationError{Msg: "failed to get realm", Description: err.Error()}
 	}
 
@@ -102,8 +117,8 @@ func (service *TokenBasedSecurityService) CheckCredentials(tokenIssueData *dto.T
  *    - userName - name of user
  * Returns user from DataProvider or nil (user not found)
  */
-func (service *TokenBasedSecurityService) GetCurrentUserByName(realmName string, userName string) data.User {
-	user, _ := (*service.DataProvider).GetUser(realmName, userName)
+func (service *TokenBasedSecurityService) GetCurrentUserByName(ctx context.Context, realmName string, userName string) data.User {
+	user, _ := (*service.DataProvider).GetUser(ctx, realmName, userName)
 	return user
 }
 
@@ -114,149 +129,593 @@ func (service *TokenBasedSecurityService) GetCurrentUserByName(realmName string,
  *    - userId - user identifier
  * Returns user from DataProvider or nil (user not found)
  */
-func (service *TokenBasedSecurityService) GetCurrentUserById(realmName string, userId uuid.UUID) data.User {
-	user, _ := (*service.DataProvider).GetUserById(realmName, userId)
+func (service *TokenBasedSecurityService) GetCurrentUserById(ctx context.Context, realmName string, userId uuid.UUID) data.User {
+	user, _ := (*service.DataProvider).GetUserById(ctx, realmName, userId)
 	return user
 }
 
 // StartOrUpdateSession this function starts new session or updates existing one
-/* This function starts new session when user successfully gets access token, duration && refresh takes from data.Realm data.Client
- * Sessions storing in internal memory, probably it will be changed and store as temporary key
+/* This function starts new session when user successfully logs in (sessionId is uuid.Nil) or extends existing session on
+ * token refresh, duration && refresh takes from data.Realm. Every login starts its own session, therefore user could have
+ * several sessions (i.e. from different clients or devices). Before new session start expired user sessions are removed and
+ * realm.MaxUserSessions limit is applied according to realm.SessionEvictionPolicy. Existing session could be extended only
+ * if realm.SessionIdleTimeout and realm.SessionMaxLifespan are not exceeded, otherwise session is removed. Tokens expiration
+ * never exceeds these limits.
  * Parameters:
- *    - realm - realm name
+ *    - realm - realm
+ *    - sessionId - identifier of a session to update or uuid.Nil to start new session
  *    - userId - user identifier
- *    - duration - access token == session duration
- *    - refresh - refresh token duration
- * Returns: identifier of session
+ *    - clientId - name of a client that user logs in with
+ *    - ipAddress - IP address of a user client (it is updated on every refresh)
+ * Returns: identifier of session and nil if session was started or updated, otherwise error (data.OperationError) with description
+ * (errors.ServiceIsUnavailable message if session wasn't saved because sessions store is not available, errors.RefreshTokenWasReplaced
+ * description if session refresh token was replaced by concurrent refresh after session had been read)
  */
-func (service *TokenBasedSecurityService) StartOrUpdateSession(realm string, userId uuid.UUID, duration int, refresh int) uuid.UUID {
-	realmSessions, ok := service.UserSessions[realm]
-	sessionId := uuid.New()
-	// if there are no realm sessions ...
-	if !ok {
-		started := time.Now()
-		userSession := data.UserSession{
-			Id: sessionId, UserId: userId, Started: started,
-			Expired:        started.Add(time.Second * time.Duration(duration)),
-			RefreshExpired: started.Add(time.Second * time.Duration(refresh)),
+func (service *TokenBasedSecurityService) StartOrUpdateSession(ctx context.Context, realm *data.Realm, sessionId uuid.UUID, userId uuid.UUID,
+	clientId string, ipAddress string,
+) (uuid.UUID, *data.OperationError) {
+	now := time.Now()
+	var userSession *data.UserSession
+	if sessionId != uuid.Nil {
+		userSession = service.GetSession(ctx, realm.Name, sessionId)
+		if userSession == nil || isSessionLimitExceeded(realm, userSession, now) {
+			service.logger.Debug(sf.Format("Session \"{0}\" is not active and couldn't be extended", sessionId))
+			service.deleteSession(ctx, realm.Name, sessionId)
+			return uuid.Nil, &data.OperationError{Msg: errors.InvalidTokenMsg, Description: errors.SessionIsNotActive}
 		}
-		service.UserSessions[realm] = append(realmSessions, userSession)
-		return sessionId
-	}
-	// realm session exists, we should find and update Expired values OR add new
-	for i, s := range realmSessions {
-		if s.UserId == userId {
-			realmSessions[i].Expired = time.Now().Add(time.Second * time.Duration(duration))
-			realmSessions[i].RefreshExpired = time.Now().Add(time.Second * time.Duration(refresh))
-			service.UserSessions[realm] = realmSessions
-			return s.Id
+	} else {
+		if check := service.applyUserSessionsLimit(ctx, realm, userId); check != nil {
+			return uuid.Nil, check
 		}
+		userSession = &data.UserSession{Id: uuid.New(), UserId: userId, ClientId: clientId, Started: now}
 	}
-	// such session does not exist, adding
-	userSession := data.UserSession{
-		Id: sessionId, UserId: userId, Started: time.Now(),
-		Expired: time.Now().Add(time.Second * time.Duration(duration)),
+	userSession.LastActivity = now
+	userSession.IpAddress = ipAddress
+	userSession.Expired = getSessionLimitedTime(realm, userSession, now.Add(time.Second*time.Duration(realm.TokenExpiration)))
+	userSession.RefreshExpired = getSessionLimitedTime(realm, userSession, now.Add(time.Second*time.Duration(realm.RefreshTokenExpiration)))
+	var err error
+	if sessionId != uuid.Nil {
+		// extended session must not restore refresh token that was replaced by concurrent refresh after session had been read
+		err = service.sessions.Rotate(ctx, realm.Name, userSession.JwtRefreshToken, userSession)
+	} else {
+		err = service.sessions.Save(ctx, realm.Name, userSession)
+	}
+	if err != nil {
+		return uuid.Nil, service.getSessionSaveError(err)
 	}
-	service.UserSessions[realm] = append(realmSessions, userSession)
-	return userSession.Id
+	return userSession.Id, nil
 }
 
 // AssignTokens saves obtained tokens in existing UserSession
-/* This function saves tokens in existing session searching it by userId (session must exist)
+/* This function saves tokens in existing session searching it by sessionId (session must exist). Tokens are saved only if session
+ * still has refresh token = replacedRefreshToken (see sessions.SessionStore Rotate), therefore only one of concurrent refreshes with
+ * the same refresh token gets new tokens
  * Parameters:
  *    - realm - name of realm
- *    - userId - user identifier
+ *    - sessionId - session identifier
+ *    - replacedRefreshToken - refresh token that session had when refresh was requested (empty for new session)
  *    - accessToken - obtained access token
  *    - refreshToken - obtained refresh token
- * Returns nothing
+ * Returns: nil if tokens were saved, otherwise error (data.OperationError) with description (errors.ServiceIsUnavailable message if
+ * sessions store is not available, errors.RefreshTokenWasReplaced description if refresh token was replaced by concurrent refresh),
+ * tokens must not be issued if they weren't saved
  */
-func (service *TokenBasedSecurityService) AssignTokens(realm string, userId uuid.UUID, accessToken *string, refreshToken *string) {
-	realmSessions, ok := service.UserSessions[realm]
-	if ok {
-		// index := -1
-		for i, s := range realmSessions {
-			if s.UserId == userId {
-				realmSessions[i].JwtAccessToken = *accessToken
-				realmSessions[i].JwtRefreshToken = *refreshToken
-				service.UserSessions[realm] = realmSessions
-				break
-			}
-		}
+func (service *TokenBasedSecurityService) AssignTokens(ctx context.Context, realm string, sessionId uuid.UUID, replacedRefreshToken *string,
+	accessToken *string, refreshToken *string,
+) *data.OperationError {
+	userSession, err := service.sessions.Get(ctx, realm, sessionId)
+	if err != nil {
+		return service.getSessionSaveError(err)
+	}
+	userSession.JwtAccessToken = *accessToken
+	userSession.JwtRefreshToken = *refreshToken
+	if err = service.sessions.Rotate(ctx, realm, *replacedRefreshToken, userSession); err != nil {
+		return service.getSessionSaveError(err)
 	}
+	return nil
 }
 
-// GetSession returns user session related to user
-/* Function iterates over sessions and searches appropriate session by comparing userId with s.UserId
+// GetSession returns user session by session id
+/* Function searches session in session store by session id
  * Parameters:
  *    - realm - name of a realm
- *    - userId - user identifier
+ *    - sessionId - session identifier
  * Returns data.UserSession if found or nil
  */
-func (service *TokenBasedSecurityService) GetSession(realm string, userId uuid.UUID) *data.UserSession {
-	realmSessions, ok := service.UserSessions[realm]
-	if !ok {
-		return nil
+func (service *TokenBasedSecurityService) GetSession(ctx context.Context, realm string, sessionId uuid.UUID) *data.UserSession {
+	s, err := service.sessions.Get(ctx, realm, sessionId)
+	return service.handleSessionSearchResult(s, err)
+}
+
+// GetUserSessions returns all user sessions
+/* Function searches sessions in session store by user index
+ * Parameters:
+ *    - realm - name of a realm
+ *    - userId - user identifier
+ * Returns sessions ordered by start time (the oldest first), empty slice if user doesn't have sessions or store is not available
+ */
+func (service *TokenBasedSecurityService) GetUserSessions(ctx context.Context, realm string, userId uuid.UUID) []data.UserSession {
+	userSessions, err := service.sessions.GetUserSessions(ctx, realm, userId)
+	if err != nil {
+		service.logger.Error(sf.Format("An error occurred during user sessions search: {0}", err.Error()))
+		return []data.UserSession{}
+	}
+	return userSessions
+}
+
+// GetRealmSessions returns all realm sessions
+/* Function searches sessions in session store by realm index
+ * Parameters:
+ *    - realm - name of a realm
+ * Returns sessions ordered by start time (the oldest first), empty slice if realm doesn't have sessions or store is not available
+ */
+func (service *TokenBasedSecurityService) GetRealmSessions(ctx context.Context, realm string) []data.UserSession {
+	realmSessions, err := service.sessions.GetRealmSessions(ctx, realm)
+	if err != nil {
+		service.logger.Error(sf.Format("An error occurred during realm sessions search: {0}", err.Error()))
+		return []data.UserSession{}
 	}
-	for _, s := range realmSessions {
-		if s.UserId == userId {
-			return &s
+	return realmSessions
+}
+
+// GetClientSessions returns all realm sessions that were started by a client
+/* Function filters realm sessions by client name
+ * Parameters:
+ *    - realm - name of a realm
+ *    - clientId - name of a client
+ * Returns sessions ordered by start time (the oldest first), empty slice if client doesn't have sessions
+ */
+func (service *TokenBasedSecurityService) GetClientSessions(ctx context.Context, realm string, clientId string) []data.UserSession {
+	clientSessions := make([]data.UserSession, 0)
+	for _, s := range service.GetRealmSessions(ctx, realm) {
+		if s.ClientId == clientId {
+			clientSessions = append(clientSessions, s)
 		}
 	}
-	return nil
+	return clientSessions
 }
 
 // GetSessionByAccessToken returns user session related to user by access token
-/* Function iterates over sessions and searches appropriate session by comparing token with s.JwtAccessToken
+/* Function searches session in session store by access token identifier (jti) and compares token with s.JwtAccessToken
  * Parameters:
  *    - realm - name of a realm
  *    - token - access token
  * Returns data.UserSession if found or nil
  */
-func (service *TokenBasedSecurityService) GetSessionByAccessToken(realm string, token *string) *data.UserSession {
-	realmSessions, ok := service.UserSessions[realm]
-	if !ok {
-		return nil
-	}
-	for _, s := range realmSessions {
-		if s.JwtAccessToken == *token {
-			return &s
-		}
-	}
-	return nil
+func (service *TokenBasedSecurityService) GetSessionByAccessToken(ctx context.Context, realm string, token *string) *data.UserSession {
+	s, err := service.sessions.GetByAccessToken(ctx, realm, *token)
+	return service.handleSessionSearchResult(s, err)
 }
 
 // GetSessionByRefreshToken returns user session related to user by refresh token
-/* Function iterates over sessions and searches appropriate session by comparing token with s.JwtRefreshToken
+/* Function searches session in session store by refresh token identifier (jti) and compares token with s.JwtRefreshToken
  * Parameters:
  *    - realm - name of a realm
  *    - token - refresh token
  * Returns data.UserSession if found or nil
  */
-func (service *TokenBasedSecurityService) GetSessionByRefreshToken(realm string, token *string) *data.UserSession {
-	realmSessions, ok := service.UserSessions[realm]
-	if !ok {
+func (service *TokenBasedSecurityService) GetSessionByRefreshToken(ctx context.Context, realm string, token *string) *data.UserSession {
+	s, err := service.sessions.GetByRefreshToken(ctx, realm, *token)
+	return service.handleSessionSearchResult(s, err)
+}
+
+// GetSessionByUsedRefreshToken returns session that refresh token was issued by before it was replaced by refresh
+/* If refresh token rotation is disabled for realm and for client that token was issued to, replaced refresh tokens stay valid
+ * while session is active (as in Keycloak with disabled revokeRefreshToken), therefore such token could be used for refresh
+ * Parameters:
+ *    - realm - realm
+ *    - clientId - name of a client that presented token
+ *    - token - refresh token
+ * Returns session if token was issued by it and rotation is disabled, otherwise nil
+ */
+func (service *TokenBasedSecurityService) GetSessionByUsedRefreshToken(ctx context.Context, realm *data.Realm, clientId string, token *string) *data.UserSession {
+	userSession, rotationEnabled := service.getSessionByUsedRefreshToken(ctx, realm, clientId, token)
+	if userSession == nil || rotationEnabled {
 		return nil
 	}
-	for _, s := range realmSessions {
-		if s.JwtRefreshToken == *token {
-			return &s
-		}
+	return userSession
+}
+
+// RevokeReusedRefreshToken revokes session that refresh token was issued by if this token was already used
+/* If refresh token rotation is enabled for realm or for client that token was issued to, every refresh token is single-use,
+ * presenting already used (replaced by refresh) token is a sign of token theft, therefore whole session (all tokens that
+ * were issued by it) is revoked and security event is emitted
+ * Parameters:
+ *    - realm - realm
+ *    - clientId - name of a client that presented token
+ *    - token - refresh token
+ * Returns true if session was revoked, otherwise false (token is unknown or rotation is disabled)
+ */
+func (service *TokenBasedSecurityService) RevokeReusedRefreshToken(ctx context.Context, realm *data.Realm, clientId string, token *string) bool {
+	userSession, rotationEnabled := service.getSessionByUsedRefreshToken(ctx, realm, clientId, token)
+	if userSession == nil || !rotationEnabled {
+		return false
 	}
-	return nil
+	service.deleteSession(ctx, realm.Name, userSession.Id)
+	service.emitSecurityEvent(&SecurityEvent{
+		Type: RefreshTokenReuseEvent, Time: time.Now(), Realm: realm.Name, ClientId: clientId, UserId: userSession.UserId,
+		SessionId: userSession.Id, Details: "already used refresh token was presented, session was revoked",
+	})
+	return true
+}
+
+// getSessionByUsedRefreshToken returns session that already used refresh token was issued by and refresh token rotation policy of session client
+func (service *TokenBasedSecurityService) getSessionByUsedRefreshToken(ctx context.Context, realm *data.Realm, clientId string,
+	token *string,
+) (*data.UserSession, bool) {
+	s, err := service.sessions.GetByUsedRefreshToken(ctx, realm.Name, *token)
+	userSession := service.handleSessionSearchResult(s, err)
+	if userSession == nil {
+		return nil, false
+	}
+	sessionClientId := userSession.ClientId
+	if len(sessionClientId) == 0 {
+		sessionClientId = clientId
+	}
+	return userSession, service.isRefreshTokenRotationEnabled(ctx, realm, sessionClientId)
 }
 
 // CheckSessionAndRefreshExpired this function checks both token are expired or not
 /* This function compares current time with expiration time (usually refresh token expires earlier than access)
  * Parameters:
  *    - realm - name of a realm
- *    - userId - user identifier
+ *    - sessionId - session identifier
  * Returns tuple of (bool, bool) with values for access token (first) and refresh token (second) expired. If token expired value is true.
  */
-func (service *TokenBasedSecurityService) CheckSessionAndRefreshExpired(realm string, userId uuid.UUID) (bool, bool) {
-	s := service.GetSession(realm, userId)
+func (service *TokenBasedSecurityService) CheckSessionAndRefreshExpired(ctx context.Context, realm string, sessionId uuid.UUID) (bool, bool) {
+	s := service.GetSession(ctx, realm, sessionId)
 	if s == nil {
 		return true, true
 	}
 	current := time.Now().In(time.UTC)
 	return s.Expired.In(time.UTC).Before(current), s.RefreshExpired.In(time.UTC).Before(current)
 }
+
+// TerminateSession forcibly ends user session
+/* Session is removed from session store, therefore all tokens that were issued by it become invalid
+ * Parameters:
+ *    - realm - name of a realm
+ *    - sessionId - session identifier
+ * Returns true if session was removed, false if session doesn't exist
+ */
+func (service *TokenBasedSecurityService) TerminateSession(ctx context.Context, realm string, sessionId uuid.UUID) bool {
+	if service.GetSession(ctx, realm, sessionId) == nil {
+		return false
+	}
+	service.deleteSession(ctx, realm, sessionId)
+	service.logger.Info(sf.Format("Session \"{0}\" of realm \"{1}\" was terminated", sessionId, realm))
+	return true
+}
+
+// TerminateUserSessions forcibly ends all user sessions (logs user out from all clients and devices)
+/* Offline sessions are not removed, they should be revoked separately
+ * Parameters:
+ *    - realm - name of a realm
+ *    - userId - user identifier
+ * Returns number of removed sessions
+ */
+func (service *TokenBasedSecurityService) TerminateUserSessions(ctx context.Context, realm string, userId uuid.UUID) int {
+	return service.terminateSessions(ctx, realm, service.GetUserSessions(ctx, realm, userId))
+}
+
+// TerminateRealmSessions forcibly ends all realm sessions
+/* Offline sessions are not removed, they should be revoked separately (or by realm not-before, see SetRealmNotBefore)
+ * Parameters:
+ *    - realm - name of a realm
+ * Returns number of removed sessions
+ */
+func (service *TokenBasedSecurityService) TerminateRealmSessions(ctx context.Context, realm string) int {
+	return service.terminateSessions(ctx, realm, service.GetRealmSessions(ctx, realm))
+}
+
+// SetRealmNotBefore sets realm revocation timestamp
+/* Tokens of user and offline sessions which were not active (were not started or refreshed) since notBefore are treated as
+ * revoked. Value is stored in a data store as data.Realm NotBefore property, therefore data store must be writable
+ * Parameters:
+ *    - realm - realm
+ *    - notBefore - unix time (seconds), 0 resets revocation timestamp
+ * Returns error (errors.ErrOperationNotImplemented if data store is read only)
+ */
+func (service *TokenBasedSecurityService) SetRealmNotBefore(ctx context.Context, realm *data.Realm, notBefore int64) error {
+	realmData := *realm
+	realmData.NotBefore = notBefore
+	// not-before is set regardless of realm changes that were made after realm had been read
+	realmData.Version = data.NoExpectedVersion
+	if err := (*service.DataProvider).UpdateRealm(ctx, realm.Name, realmData); err != nil {
+		return err
+	}
+	realm.NotBefore = notBefore
+	service.logger.Info(sf.Format("Realm \"{0}\" not-before was set to {1}", realm.Name, notBefore))
+	return nil
+}
+
+// StartOrUpdateOfflineSession this function starts new offline session or extends existing one
+/* Offline session is started on login with offline_access scope (offlineSessionId is uuid.Nil) and extended on every offline
+ * token refresh. Unlike user sessions, offline sessions are stored in a data store (managers.DataContext), therefore they
+ * survive server restarts, every offline token refresh starts new user session (userSessionId) for new access token and the
+ * user session started by previous refresh is removed. Offline session expires if offline token wasn't used during
+ * realm.OfflineSessionIdleTimeout or when realm.OfflineSessionMaxLifespan passed since login. If offline session couldn't be
+ * started or updated, user session userSessionId is removed too.
+ * Parameters:
+ *    - realm - realm
+ *    - offlineSessionId - identifier of an offline session to update or uuid.Nil to start new offline session
+ *    - userSessionId - identifier of a user session that was started for access token
+ *    - userId - user identifier
+ *    - clientId - name of a client that user logs in with
+ * Returns: offline session and nil if it was started or updated, otherwise nil and error (data.OperationError) with description
+ */
+func (service *TokenBasedSecurityService) StartOrUpdateOfflineSession(ctx context.Context, realm *data.Realm, offlineSessionId uuid.UUID, userSessionId uuid.UUID,
+	userId uuid.UUID, clientId string,
+) (*data.OfflineSession, *data.OperationError) {
+	now := time.Now()
+	var offlineSession *data.OfflineSession
+	if offlineSessionId != uuid.Nil {
+		offlineSession = service.getOfflineSession(ctx, realm.Name, offlineSessionId)
+		if offlineSession == nil {
+			service.deleteSession(ctx, realm.Name, userSessionId)
+			return nil, &data.OperationError{Msg: errors.InvalidTokenMsg, Description: errors.SessionIsNotActive}
+		}
+		if offlineSession.UserSessionId != uuid.Nil && offlineSession.UserSessionId != userSessionId {
+			// access token issued by previous offline token usage is replaced by the new one
+			service.deleteSession(ctx, realm.Name, offlineSession.UserSessionId)
+		}
+	} else {
+		offlineSession = &data.OfflineSession{Id: uuid.New(), UserId: userId, ClientId: clientId, Started: now}
+	}
+	offlineSession.UserSessionId = userSessionId
+	offlineSession.LastActivity = now
+	offlineSession.Expired = getOfflineSessionExpiration(realm, offlineSession)
+	if offlineSession.Expired.Before(now) {
+		service.logger.Debug(sf.Format("Offline session \"{0}\" reached max lifespan", offlineSession.Id))
+		service.deleteOfflineSession(ctx, realm.Name, offlineSession.Id)
+		service.deleteSession(ctx, realm.Name, userSessionId)
+		return nil, &data.OperationError{Msg: errors.InvalidTokenMsg, Description: errors.SessionIsNotActive}
+	}
+	var err error
+	if offlineSessionId != uuid.Nil {
+		err = (*service.DataProvider).UpdateOfflineSession(ctx, realm.Name, *offlineSession)
+	} else {
+		err = (*service.DataProvider).CreateOfflineSession(ctx, realm.Name, *offlineSession)
+	}
+	if err != nil {
+		service.deleteSession(ctx, realm.Name, userSessionId)
+		if e.Is(err, errors.ErrOperationNotImplemented) {
+			service.logger.Debug("Offline session couldn't be started, data store doesn't support it")
+			return nil, &data.OperationError{Msg: errors.InvalidScopeMsg, Description: errors.OfflineTokensNotSupported}
+		}
+		service.logger.Error(sf.Format("An error occurred during offline session save: {0}", err.Error()))
+		return nil, &data.OperationError{Msg: errors.ServiceIsUnavailable}
+	}
+	return offlineSession, nil
+}
+
+// AssignOfflineToken saves obtained offline token hash in offline session
+/* Only token hash is stored in a data store, therefore only the last issued offline token could be used for refresh
+ * Parameters:
+ *    - realm - name of realm
+ *    - offlineSession - offline session that token was issued by
+ *    - token - obtained offline token
+ * Returns nothing
+ */
+func (service *TokenBasedSecurityService) AssignOfflineToken(ctx context.Context, realm string, offlineSession *data.OfflineSession, token *string) {
+	offlineSession.TokenHash = sessions.GetTokenHash(*token)
+	if err := (*service.DataProvider).UpdateOfflineSession(ctx, realm, *offlineSession); err != nil {
+		service.logger.Error(sf.Format("An error occurred during offline session token save: {0}", err.Error()))
+	}
+}
+
+// GetOfflineSessionByToken returns offline session by offline token
+/* Function searches offline session in a data store by session identifier (sid) from token and compares token hash with
+ * offlineSession.TokenHash
+ * Parameters:
+ *    - realm - name of a realm
+ *    - token - offline token
+ * Returns data.OfflineSession if found and not expired or nil
+ */
+func (service *TokenBasedSecurityService) GetOfflineSessionByToken(ctx context.Context, realm string, token *string) *data.OfflineSession {
+	offlineSessionId := sessions.GetTokenSessionId(*token)
+	if offlineSessionId == uuid.Nil {
+		return nil
+	}
+	offlineSession := service.getOfflineSession(ctx, realm, offlineSessionId)
+	if offlineSession == nil || offlineSession.TokenHash != sessions.GetTokenHash(*token) {
+		return nil
+	}
+	if offlineSession.Expired.Before(time.Now()) {
+		return nil
+	}
+	return offlineSession
+}
+
+// applyUserSessionsLimit removes expired user sessions and checks realm.MaxUserSessions before new session start
+/* If user already has realm.MaxUserSessions active sessions, function removes the oldest sessions (data.EvictOldestSession,
+ * default policy) or rejects new session (data.RejectNewSession). Limit is not applied if realm.MaxUserSessions is 0.
+ * Parameters:
+ *    - realm - realm
+ *    - userId - user identifier
+ * Returns: nil if new session could be started, otherwise error (data.OperationError) with description
+ */
+func (service *TokenBasedSecurityService) applyUserSessionsLimit(ctx context.Context, realm *data.Realm, userId uuid.UUID) *data.OperationError {
+	current := time.Now()
+	userSessions := service.GetUserSessions(ctx, realm.Name, userId)
+	activeSessions := make([]data.UserSession, 0, len(userSessions))
+	for _, s := range userSessions {
+		if s.Expired.Before(current) && s.RefreshExpired.Before(current) {
+			service.deleteSession(ctx, realm.Name, s.Id)
+			continue
+		}
+		activeSessions = append(activeSessions, s)
+	}
+	if realm.MaxUserSessions <= 0 {
+		return nil
+	}
+	excess := len(activeSessions) - realm.MaxUserSessions + 1
+	if excess <= 0 {
+		return nil
+	}
+	if realm.SessionEvictionPolicy == data.RejectNewSession {
+		service.logger.Debug(sf.Format("User \"{0}\" reached sessions limit in realm \"{1}\"", userId, realm.Name))
+		return &data.OperationError{
+			Msg:         errors.InvalidUserCredentialsMsg,
+			Description: sf.Format(errors.UserSessionsLimitReachedDescTemplate, realm.MaxUserSessions),
+		}
+	}
+	// activeSessions are ordered by start time, therefore the oldest sessions are first
+	for _, s := range activeSessions[:excess] {
+		service.logger.Debug(sf.Format("Session \"{0}\" of user \"{1}\" was evicted by sessions limit", s.Id, userId))
+		service.deleteSession(ctx, realm.Name, s.Id)
+	}
+	return nil
+}
+
+// isRefreshTokenRotationEnabled returns client refresh token rotation policy if it is set, otherwise realm policy
+func (service *TokenBasedSecurityService) isRefreshTokenRotationEnabled(ctx context.Context, realm *data.Realm, clientId string) bool {
+	var client *data.Client
+	for i := range realm.Clients {
+		if realm.Clients[i].Name == clientId {
+			client = &realm.Clients[i]
+			break
+		}
+	}
+	if client == nil {
+		// realm could be fetched without clients (i.e. from Redis)
+		client, _ = (*service.DataProvider).GetClient(ctx, realm.Name, clientId)
+	}
+	if client != nil && client.RefreshTokenRotation != nil {
+		return *client.RefreshTokenRotation
+	}
+	return realm.RefreshTokenRotation
+}
+
+// emitSecurityEvent writes security event to log
+func (service *TokenBasedSecurityService) emitSecurityEvent(event *SecurityEvent) {
+	eventData, err := json.Marshal(event)
+	if err != nil {
+		service.logger.Error(sf.Format("An error occurred during security event marshal: {0}", err.Error()))
+		return
+	}
+	service.logger.Warn(sf.Format("Security event: {0}", string(eventData)))
+}
+
+// isSessionLimitExceeded checks whether session is idle longer than realm.SessionIdleTimeout or lives longer than realm.SessionMaxLifespan
+func isSessionLimitExceeded(realm *data.Realm, session *data.UserSession, current time.Time) bool {
+	// limited time is before current only if one of the limits is already passed
+	return getSessionLimitedTime(realm, session, current).Before(current)
+}
+
+// getSessionLimitedTime returns expiration time that doesn't exceed realm.SessionIdleTimeout and realm.SessionMaxLifespan
+func getSessionLimitedTime(realm *data.Realm, session *data.UserSession, expiration time.Time) time.Time {
+	if realm.SessionIdleTimeout > 0 {
+		lastActivity := session.LastActivity
+		if lastActivity.IsZero() {
+			lastActivity = session.Started
+		}
+		idleExpiration := lastActivity.Add(time.Second * time.Duration(realm.SessionIdleTimeout))
+		if idleExpiration.Before(expiration) {
+			expiration = idleExpiration
+		}
+	}
+	if realm.SessionMaxLifespan > 0 {
+		lifespanExpiration := session.Started.Add(time.Second * time.Duration(realm.SessionMaxLifespan))
+		if lifespanExpiration.Before(expiration) {
+			expiration = lifespanExpiration
+		}
+	}
+	return expiration
+}
+
+// getOfflineSessionExpiration returns offline session expiration according to realm.OfflineSessionIdleTimeout and realm.OfflineSessionMaxLifespan
+func getOfflineSessionExpiration(realm *data.Realm, offlineSession *data.OfflineSession) time.Time {
+	idleTimeout := realm.OfflineSessionIdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = data.DefaultOfflineSessionIdleTimeout
+	}
+	expiration := offlineSession.LastActivity.Add(time.Second * time.Duration(idleTimeout))
+	if realm.OfflineSessionMaxLifespan > 0 {
+		lifespanExpiration := offlineSession.Started.Add(time.Second * time.Duration(realm.OfflineSessionMaxLifespan))
+		if lifespanExpiration.Before(expiration) {
+			expiration = lifespanExpiration
+		}
+	}
+	return expiration
+}
+
+// getOfflineSession returns offline session from data store or nil, data store errors (except not found and not supported) are logged
+func (service *TokenBasedSecurityService) getOfflineSession(ctx context.Context, realm string, offlineSessionId uuid.UUID) *data.OfflineSession {
+	offlineSession, err := (*service.DataProvider).GetOfflineSession(ctx, realm, offlineSessionId)
+	if err != nil {
+		var notFoundErr errors.ObjectNotFoundError
+		if !e.As(err, &notFoundErr) && !e.Is(err, errors.ErrOperationNotImplemented) {
+			service.logger.Error(sf.Format("An error occurred during offline session search: {0}", err.Error()))
+		}
+		return nil
+	}
+	return offlineSession
+}
+
+// deleteOfflineSession removes offline session from data store and logs errors (already removed session is not an error)
+func (service *TokenBasedSecurityService) deleteOfflineSession(ctx context.Context, realm string, offlineSessionId uuid.UUID) {
+	if err := (*service.DataProvider).DeleteOfflineSession(ctx, realm, offlineSessionId); err != nil {
+		var notFoundErr errors.ObjectNotFoundError
+		if !e.As(err, &notFoundErr) {
+			service.logger.Error(sf.Format("An error occurred during offline session delete: {0}", err.Error()))
+		}
+	}
+}
+
+// terminateSessions removes all provided sessions and returns number of sessions that were removed
+func (service *TokenBasedSecurityService) terminateSessions(ctx context.Context, realm string, sessionsToTerminate []data.UserSession) int {
+	terminated := 0
+	for _, s := range sessionsToTerminate {
+		if err := service.sessions.Delete(ctx, realm, s.Id); err != nil {
+			var notFoundErr errors.ObjectNotFoundError
+			if !e.As(err, &notFoundErr) {
+				service.logger.Error(sf.Format("An error occurred during session delete: {0}", err.Error()))
+			}
+			continue
+		}
+		terminated++
+	}
+	if terminated > 0 {
+		service.logger.Info(sf.Format("{0} sessions of realm \"{1}\" were terminated", terminated, realm))
+	}
+	return terminated
+}
+
+// deleteSession removes session from session store and logs store errors (already removed session is not an error)
+func (service *TokenBasedSecurityService) deleteSession(ctx context.Context, realm string, sessionId uuid.UUID) {
+	if err := service.sessions.Delete(ctx, realm, sessionId); err != nil {
+		var notFoundErr errors.ObjectNotFoundError
+		if !e.As(err, &notFoundErr) {
+			service.logger.Error(sf.Format("An error occurred during session delete: {0}", err.Error()))
+		}
+	}
+}
+
+// getSessionSaveError converts error of session saving to data.OperationError: removed session is not active, replaced refresh
+// token means concurrent refresh, other errors mean that sessions store is not available
+func (service *TokenBasedSecurityService) getSessionSaveError(err error) *data.OperationError {
+	var notFoundErr errors.ObjectNotFoundError
+	if e.As(err, &notFoundErr) {
+		service.logger.Debug(sf.Format("Session was removed before it was saved: {0}", err.Error()))
+		return &data.OperationError{Msg: errors.InvalidTokenMsg, Description: errors.SessionIsNotActive}
+	}
+	if e.Is(err, sessions.ErrRefreshTokenReplaced) {
+		service.logger.Debug("Session refresh token was replaced by concurrent refresh")
+		return &data.OperationError{Msg: errors.InvalidTokenMsg, Description: errors.RefreshTokenWasReplaced}
+	}
+	service.logger.Error(sf.Format("An error occurred during session save: {0}", err.Error()))
+	return &data.OperationError{Msg: errors.ServiceIsUnavailable}
+}
+
+// handleSessionSearchResult logs session store errors (not found is not an error) and returns session or nil
+func (service *TokenBasedSecurityService) handleSessionSearchResult(session *data.UserSession, err error) *data.UserSession {
+	if err != nil {
+		var notFoundErr errors.ObjectNotFoundError
+		if !e.As(err, &notFoundErr) {
+			service.logger.Error(sf.Format("An error occurred during session search: {0}", err.Error()))
+		}
+		return nil
+	}
+	return session
+}